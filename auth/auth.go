@@ -0,0 +1,73 @@
+// Package auth issues and verifies user access tokens. A token is an opaque
+// string naming a user and when the token expires, signed with the server's
+// key so it cannot be forged. Tokens are issued by a trusted backend through
+// the admin API and presented by clients on API requests and WebSocket
+// connections.
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go-realtime-workspace/clock"
+	"go-realtime-workspace/signed"
+)
+
+// Errors returned by VerifyToken.
+var (
+	ErrInvalidToken = errors.New("invalid access token")
+	ErrTokenExpired = errors.New("access token expired")
+)
+
+// claims is what a token carries.
+type claims struct {
+	UserID    string `json:"u"`
+	ExpiresAt int64  `json:"e,omitempty"` // Unix seconds (0 = never)
+}
+
+// Signer issues and verifies access tokens with a secret key. Tokens are
+// accepted by every server sharing the key.
+type Signer struct {
+	key   []byte
+	clock clock.Clock
+}
+
+// NewSigner returns a signer using secret as its key.
+func NewSigner(secret string) *Signer {
+	return &Signer{key: []byte(secret), clock: clock.Real{}}
+}
+
+// SetClock replaces the clock expiry is checked against. It must be called
+// before the signer is used.
+func (s *Signer) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// Issue returns a token of userID that expires at expiresAt, or never if
+// expiresAt is zero.
+func (s *Signer) Issue(userID string, expiresAt time.Time) string {
+	c := claims{UserID: userID}
+	if !expiresAt.IsZero() {
+		c.ExpiresAt = expiresAt.Unix()
+	}
+	return signed.Encode(s.key, c)
+}
+
+// VerifyToken returns the user a token was issued to and when it expires
+// (zero if never). It returns ErrTokenExpired for an expired token and
+// ErrInvalidToken for any other token it did not issue.
+func (s *Signer) VerifyToken(ctx context.Context, token string) (string, time.Time, error) {
+	var c claims
+	if err := signed.Decode(s.key, token, &c); err != nil || c.UserID == "" {
+		return "", time.Time{}, ErrInvalidToken
+	}
+	if c.ExpiresAt == 0 {
+		return c.UserID, time.Time{}, nil
+	}
+	expiresAt := time.Unix(c.ExpiresAt, 0)
+	if !expiresAt.After(s.clock.Now()) {
+		return "", time.Time{}, ErrTokenExpired
+	}
+	return c.UserID, expiresAt, nil
+}
@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go-realtime-workspace/clock"
+)
+
+func TestIssueAndVerify(t *testing.T) {
+	now := time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)
+	s := NewSigner("secret")
+	s.SetClock(clock.NewFake(now))
+
+	token := s.Issue("user-1", now.Add(time.Hour))
+	userID, expiresAt, err := s.VerifyToken(context.Background(), token)
+	if err != nil {
+		t.Fatalf("VerifyToken: %v", err)
+	}
+	if userID != "user-1" || !expiresAt.Equal(now.Add(time.Hour)) {
+		t.Errorf("got %q expiring %v, want user-1 expiring %v", userID, expiresAt, now.Add(time.Hour))
+	}
+}
+
+func TestVerifyTokenWithoutExpiry(t *testing.T) {
+	s := NewSigner("secret")
+	userID, expiresAt, err := s.VerifyToken(context.Background(), s.Issue("user-1", time.Time{}))
+	if err != nil || userID != "user-1" || !expiresAt.IsZero() {
+		t.Errorf("got %q, %v, %v; want user-1 that never expires", userID, expiresAt, err)
+	}
+}
+
+func TestVerifyTokenExpired(t *testing.T) {
+	now := time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(now)
+	s := NewSigner("secret")
+	s.SetClock(fake)
+
+	token := s.Issue("user-1", now.Add(time.Minute))
+	fake.Advance(time.Minute)
+	if _, _, err := s.VerifyToken(context.Background(), token); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("got %v, want ErrTokenExpired", err)
+	}
+}
+
+func TestVerifyTokenRejectsForgeries(t *testing.T) {
+	s := NewSigner("secret")
+	token := s.Issue("user-1", time.Time{})
+	other := NewSigner("other").Issue("user-1", time.Time{})
+	body, sig, _ := strings.Cut(token, ".")
+	forgedBody, _, _ := strings.Cut(NewSigner("secret").Issue("owner", time.Time{}), ".")
+
+	for name, token := range map[string]string{
+		"other key":    other,
+		"swapped body": forgedBody + "." + sig,
+		"no signature": body,
+		"garbage":      "not.a-token",
+		"empty":        "",
+	} {
+		if _, _, err := s.VerifyToken(context.Background(), token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: got %v, want ErrInvalidToken", name, err)
+		}
+	}
+}
@@ -3,16 +3,20 @@
 package config
 
 import (
+	"errors"
 	"time"
 )
 
 // Config holds all configuration for the application.
 // Use DefaultConfig() to get a configuration with sensible defaults.
+// Secret fields are tagged `secret:"true"` so Redacted never exposes them.
 type Config struct {
 	Server     ServerConfig
 	WebSocket  WebSocketConfig
 	PostgreSQL PostgreSQLConfig
 	Redis      RedisConfig
+	Message    MessageConfig
+	User       UserConfig
 }
 
 // ServerConfig holds server-related configuration.
@@ -21,8 +25,34 @@ type ServerConfig struct {
 	ReadTimeout  time.Duration // Maximum duration for reading the entire request
 	WriteTimeout time.Duration // Maximum duration before timing out writes of the response
 	IdleTimeout  time.Duration // Maximum time to wait for the next request when keep-alives are enabled
+	AdminToken   string        `secret:"true"` // Bearer token required by admin endpoints (empty disables them)
+
+	CursorSecret string `secret:"true"` // Key signing page cursors; set the same on every server so cursors survive restarts and load balancing (empty uses a random key per process)
+
+	AuthSecret     string        `secret:"true"` // Key signing user access tokens; set the same on every server (empty disables user authentication)
+	AccessTokenTTL time.Duration // Lifetime of access tokens issued by the admin token endpoint (0 = never expire)
+
+	HandlerTimeout time.Duration // Deadline for an API request's work before it fails with 504 (0 disables; WebSocket routes are exempt)
+
+	ShutdownTimeout time.Duration // Overall deadline for graceful shutdown
+	DrainTimeout    time.Duration // Portion of the shutdown deadline spent flushing hub messages
+
+	RateLimitPerMinute int // API requests allowed per client IP per minute (0 disables rate limiting)
+
+	DefaultOrgID   string // Organization created at startup and used when a request omits the org (empty disables)
+	DefaultOrgName string // Name of the default organization (defaults to DefaultOrgID)
+
+	Environment   string   // "production" sends strict security headers; "development" omits HSTS for plain HTTP
+	CSPScriptSrc  []string // Content-Security-Policy script-src sources (empty keeps the default 'self')
+	CSPConnectSrc []string // Content-Security-Policy connect-src sources (empty keeps the default 'self' ws: wss:)
 }
 
+// Deployment environments.
+const (
+	EnvironmentProduction  = "production"
+	EnvironmentDevelopment = "development"
+)
+
 // WebSocketConfig holds WebSocket-related configuration.
 type WebSocketConfig struct {
 	ReadBufferSize  int           // Size of the read buffer in bytes
@@ -30,8 +60,92 @@ type WebSocketConfig struct {
 	WriteWait       time.Duration // Time allowed to write a message to the peer
 	PongWait        time.Duration // Time allowed to read the next pong message from the peer
 	PingPeriod      time.Duration // Send pings to peer with this period (must be less than PongWait)
-	MaxMessageSize  int64         // Maximum message size allowed from peer
+	MaxMessageSize  int64         // Maximum WebSocket frame size allowed from peer (must exceed Message.MaxContentBytes)
 	MessageBuffer   int           // Size of the buffered channel for messages
+	MaxSlowDrops    int           // Consecutive dropped messages before a slow client is disconnected (0 disables)
+
+	MaxMissedPongs int           // Close a connection after this many pings in a row go unanswered (0 disables; PongWait still applies)
+	ProbeInterval  time.Duration // Ping interval while MaxMissedPongs is set (0 keeps PingPeriod)
+
+	LagSignalInterval time.Duration // Minimum time between lag frames telling a client it missed messages (0 disables)
+
+	AssignClientIDs bool // Without authentication, give group and presence clients a random server-side ID instead of trusting the clientId parameter
+
+	HeartbeatGrace time.Duration // How long a REST heartbeat keeps a user online without a WebSocket
+
+	PresenceBatchWindow time.Duration // Coalesce an org's presence changes over this window into one presence_batch frame (0 sends a presence frame per change)
+
+	RosterRequestInterval time.Duration // Minimum time between roster frames a group client may request (0 disables the limit)
+
+	TypingInterval time.Duration // Minimum time between typing frames relayed from a client; extra ones are dropped (0 disables the limit)
+
+	EnableCompression      bool // Negotiate permessage-deflate with clients that offer it
+	CompressionSampleEvery int  // Measure the compression ratio of every Nth frame written to a compressed connection (0 disables)
+
+	HandshakeTimeout   time.Duration // Time allowed to complete the WebSocket upgrade handshake
+	MaxPendingUpgrades int           // Maximum concurrent in-progress upgrades before rejecting with 503 (0 disables)
+
+	MaintenanceRetryAfter time.Duration // Retry-After sent with 503s while maintenance mode refuses new connections
+
+	MaxConnections        int           // Open WebSocket connections allowed on this server before upgrades get 503 (0 = unlimited)
+	MaxOrgConnections     int           // Open group and presence connections allowed per organization (0 = unlimited)
+	CapacityRetryAfter    time.Duration // Retry-After sent with 503s when a connection cap or MaxPendingUpgrades is hit
+	UserConnectsPerMinute int           // WebSocket connection attempts allowed per user per minute before 429 (0 = unlimited)
+
+	MinProtocolVersion int // Oldest client protocol version accepted; older clients are closed with hub.CloseProtocolOutdated
+
+	ReconcileInterval time.Duration // How often running group hubs are checked against the group registry (0 disables)
+
+	GroupMessagesPerSecond float64 // Default per-group throughput cap across all senders (0 disables)
+	GroupMessageBurst      int     // Messages a group may send at once before the cap applies
+
+	ReauthInterval time.Duration // How often authenticated connections re-check token expiry and org membership (0 disables)
+
+	ParallelFanoutThreshold int // Group size from which broadcasts are delivered by parallel workers (0 always delivers sequentially)
+	FanoutWorkers           int // Workers per parallel broadcast (0 uses GOMAXPROCS)
+
+	DeliveryLatencyBuckets []time.Duration // Bucket bounds of the receive-to-enqueue latency histograms (empty disables them)
+
+	DrainWaves           int           // Waves group connections are closed in at shutdown, before presence and then DM connections (0 or 1 closes all groups at once)
+	DrainWaveDelay       time.Duration // Pause between drain waves, shortened to fit half the time left before Server.DrainTimeout
+	DrainReconnectJitter time.Duration // Upper bound of the random after_ms reconnect hint in shutdown close frames (0 sends empty close frames)
+}
+
+// MessageConfig holds policies applied to message content.
+type MessageConfig struct {
+	Sanitize string // Content sanitization before storage and delivery: "off", "escape" or "strip"
+
+	MaxContentBytes int // Largest message content in UTF-8 bytes accepted from any entry point (0 disables)
+
+	ContentTypes []string // Structured content types clients may send besides text: "location", "contact" or "card" (default none)
+
+	RestoreWindow time.Duration // How long a deleted message can be restored by its author (0 deletes immediately)
+
+	ImportMaxBytes int64 // Largest request body accepted by the message import endpoint
+
+	DMExpiresInMin time.Duration // Shortest expires_in a sender may set on a direct message
+	DMExpiresInMax time.Duration // Longest expires_in a sender may set on a direct message (at most Redis.MessageTTL)
+
+	WindowsExemptAdmins bool // Let org owners and admins edit and delete their messages past the edit and delete windows
+
+	IDScheme string // How new message IDs are minted: "uuid", "ulid" or "snowflake"
+	IDNode   int64  // Snowflake node of this process (0-1023); must differ between processes sharing Redis
+
+	UsernameFallback string        // Username stored when the sender's lookup fails: "cached", "client_id" or "unknown"
+	UsernameCacheTTL time.Duration // How long a looked-up username is reused without a query (0 disables the cache)
+
+	UsernameEnrichment       string // When usernames are looked up: "write" (as messages are sent) or "read" (only cached ones are stored; readers fill in the rest)
+	UsernameLookupsPerSecond int    // Username queries made as messages are sent per second before only cached ones are stored (0 = no limit)
+}
+
+// UserConfig holds limits applied to user fields before they reach the database.
+// Lengths are in characters and may not exceed the column sizes in schema.sql.
+type UserConfig struct {
+	MaxUsernameLength  int // At most 100
+	MaxEmailLength     int // At most 255
+	MaxFullNameLength  int // At most 255
+	MaxAvatarURLLength int // At most 2048
+	MaxBioLength       int // At most 500
 }
 
 // PostgreSQLConfig holds PostgreSQL database configuration.
@@ -39,7 +153,7 @@ type PostgreSQLConfig struct {
 	Host         string        // Database host
 	Port         int           // Database port
 	User         string        // Database user
-	Password     string        // Database password
+	Password     string        `secret:"true"` // Database password
 	Database     string        // Database name
 	SSLMode      string        // SSL mode (disable, require, verify-ca, verify-full)
 	MaxOpenConns int           // Maximum number of open connections
@@ -47,16 +161,62 @@ type PostgreSQLConfig struct {
 	MaxLifetime  time.Duration // Maximum lifetime of a connection
 }
 
+// Redis connection modes.
+const (
+	RedisModeSingle   = "single"
+	RedisModeSentinel = "sentinel"
+	RedisModeCluster  = "cluster"
+)
+
 // RedisConfig holds Redis configuration.
 type RedisConfig struct {
-	Host        string        // Redis host
-	Port        int           // Redis port
-	Password    string        // Redis password (empty if no password)
-	DB          int           // Redis database number
+	Mode          string   // Connection mode: "single" (default), "sentinel" or "cluster"
+	MasterName    string   // Sentinel master name (sentinel mode)
+	SentinelAddrs []string // Sentinel addresses as host:port (sentinel mode)
+	ClusterAddrs  []string // Cluster seed nodes as host:port (cluster mode)
+
+	Host        string        // Redis host (single mode)
+	Port        int           // Redis port (single mode)
+	Password    string        `secret:"true"` // Redis password (empty if no password)
+	DB          int           // Redis database number (ignored in cluster mode)
 	MaxRetries  int           // Maximum number of retries
 	PoolSize    int           // Maximum number of connections
 	MessageTTL  time.Duration // Time-to-live for chat messages
 	MaxMessages int64         // Maximum messages to store per group
+
+	PersistAnnouncements bool          // Store org broadcasts once and reference them from each group's history
+	DedupeWindow         time.Duration // Window in which a repeated message ID is ignored by Save (0 disables)
+
+	MaxReactionsPerUser    int // Distinct reactions one user may add to a single message (0 = unlimited)
+	MaxReactionsPerMessage int // Distinct emoji allowed on a single message (0 = unlimited)
+
+	ExpirySweepInterval time.Duration // How often disappearing messages past their expiry are removed (0 disables)
+
+	SearchMaxGroups    int   // Maximum groups scanned by an org-wide search
+	SearchScanPerGroup int64 // Newest messages examined per group by an org-wide search
+
+	CompressPayloads bool // Gzip stored message payloads; entries written either way remain readable
+	CompressMinBytes int  // Payloads smaller than this are stored uncompressed
+
+	FeatureCacheTTL time.Duration // How long an org's feature flags are cached in Redis
+	FeatureLocalTTL time.Duration // How long each server also keeps an org's flags in memory (0 disables)
+
+	OrgQuotaMessages int64         // Default messages an org may store across its groups (0 = unlimited)
+	OrgQuotaBytes    int64         // Default approximate Redis memory an org's history may use (0 = unlimited)
+	OrgQuotaPolicy   string        // Over quota, "reject" new messages or "trim" the oldest ones
+	QuotaUsageTTL    time.Duration // How long a measurement of an org's usage is reused before scanning again
+
+	MigrateScores bool // Rescale history scores stored in seconds to microseconds at startup
+
+	MaxPinsPerGroup int  // Pinned messages allowed per group; pinned messages are kept past MaxMessages (0 = unlimited)
+	ProtectStarred  bool // Also keep messages starred by any user past MaxMessages
+
+	MaxUndelivered int // ack_required messages kept per user and group after a failed write, redelivered when the user rejoins (0 disables)
+
+	SpilloverSize          int           // Messages held in memory while Redis is unreachable, stored once it recovers (0 disables)
+	SpilloverRetryInterval time.Duration // How often held messages are retried
+
+	SelfTest string // Startup check that history can be written and read back: "off", "warn" (log and continue) or "fail" (exit)
 }
 
 // DefaultConfig returns the default configuration with production-ready settings.
@@ -68,6 +228,15 @@ func DefaultConfig() *Config {
 			ReadTimeout:  15 * time.Second,
 			WriteTimeout: 15 * time.Second,
 			IdleTimeout:  60 * time.Second,
+
+			AccessTokenTTL: time.Hour,
+
+			HandlerTimeout: 10 * time.Second, // Below WriteTimeout so the 504 can still be written
+
+			ShutdownTimeout: 30 * time.Second,
+			DrainTimeout:    10 * time.Second,
+
+			Environment: EnvironmentProduction,
 		},
 		WebSocket: WebSocketConfig{
 			ReadBufferSize:  1024,
@@ -75,8 +244,60 @@ func DefaultConfig() *Config {
 			WriteWait:       10 * time.Second,
 			PongWait:        60 * time.Second,
 			PingPeriod:      54 * time.Second, // Must be less than PongWait
-			MaxMessageSize:  512,
+			MaxMessageSize:  16384,
 			MessageBuffer:   256,
+			MaxSlowDrops:    64,
+
+			MaxMissedPongs: 0,
+			ProbeInterval:  0,
+
+			LagSignalInterval: 5 * time.Second,
+
+			AssignClientIDs: false, // Clients choose their ID for backward compatibility
+
+			HeartbeatGrace: 90 * time.Second,
+
+			PresenceBatchWindow: 0, // Presence subscribers may predate presence_batch frames
+
+			RosterRequestInterval: 2 * time.Second,
+
+			TypingInterval: time.Second,
+
+			EnableCompression:      false,
+			CompressionSampleEvery: 100,
+
+			HandshakeTimeout:   10 * time.Second,
+			MaxPendingUpgrades: 128,
+
+			MaintenanceRetryAfter: 30 * time.Second,
+
+			MaxConnections:        0,
+			MaxOrgConnections:     0,
+			CapacityRetryAfter:    5 * time.Second,
+			UserConnectsPerMinute: 0,
+
+			MinProtocolVersion: 1,
+
+			ReconcileInterval: 30 * time.Second,
+
+			GroupMessagesPerSecond: 50,
+			GroupMessageBurst:      100,
+
+			ReauthInterval: time.Minute,
+
+			ParallelFanoutThreshold: 0, // Sequential delivery is faster for typical groups; see hub.fanout
+			FanoutWorkers:           0,
+
+			DeliveryLatencyBuckets: []time.Duration{
+				100 * time.Microsecond, 500 * time.Microsecond,
+				time.Millisecond, 5 * time.Millisecond, 10 * time.Millisecond,
+				50 * time.Millisecond, 100 * time.Millisecond, 500 * time.Millisecond,
+				time.Second,
+			},
+
+			DrainWaves:           4,
+			DrainWaveDelay:       250 * time.Millisecond,
+			DrainReconnectJitter: 5 * time.Second,
 		},
 		PostgreSQL: PostgreSQLConfig{
 			Host:         "localhost",
@@ -90,6 +311,8 @@ func DefaultConfig() *Config {
 			MaxLifetime:  5 * time.Minute,
 		},
 		Redis: RedisConfig{
+			Mode: RedisModeSingle,
+
 			Host:        "localhost",
 			Port:        6379,
 			Password:    "",
@@ -98,6 +321,254 @@ func DefaultConfig() *Config {
 			PoolSize:    10,
 			MessageTTL:  7 * 24 * time.Hour, // 7 days
 			MaxMessages: 1000,               // Keep last 1000 messages per group
+
+			PersistAnnouncements: true,
+			DedupeWindow:         5 * time.Minute,
+
+			MaxReactionsPerUser:    3,
+			MaxReactionsPerMessage: 20,
+
+			ExpirySweepInterval: time.Second,
+
+			SearchMaxGroups:    200,
+			SearchScanPerGroup: 500,
+
+			CompressPayloads: false,
+			CompressMinBytes: 512,
+
+			FeatureCacheTTL: 5 * time.Minute,
+			FeatureLocalTTL: 5 * time.Second,
+
+			OrgQuotaMessages: 0,
+			OrgQuotaBytes:    0,
+			OrgQuotaPolicy:   "reject",
+			QuotaUsageTTL:    time.Minute,
+
+			MigrateScores: true,
+
+			MaxPinsPerGroup: 50,
+			ProtectStarred:  false,
+
+			MaxUndelivered: 50,
+
+			SpilloverSize:          0,
+			SpilloverRetryInterval: 2 * time.Second,
+
+			SelfTest: "off",
+		},
+		Message: MessageConfig{
+			Sanitize: "off", // Content is returned verbatim for backward compatibility
+
+			MaxContentBytes: 4096,
+
+			RestoreWindow: 5 * time.Minute,
+
+			ImportMaxBytes: 10 << 20, // 10 MiB
+
+			DMExpiresInMin: time.Minute,
+			DMExpiresInMax: 24 * time.Hour,
+
+			WindowsExemptAdmins: true,
+
+			IDScheme: "uuid",
+
+			UsernameFallback: "cached",
+			UsernameCacheTTL: time.Minute,
+
+			UsernameEnrichment: "write",
 		},
+		User: UserConfig{
+			MaxUsernameLength:  100,
+			MaxEmailLength:     255,
+			MaxFullNameLength:  255,
+			MaxAvatarURLLength: 2048,
+			MaxBioLength:       500,
+		},
+	}
+}
+
+// Validate reports configuration values that would make the server misbehave.
+func (c *Config) Validate() error {
+	if c.Server.Address == "" {
+		return errors.New("server address is required")
+	}
+	if c.Server.AccessTokenTTL < 0 {
+		return errors.New("access token TTL must not be negative")
+	}
+	if c.Server.HandlerTimeout < 0 {
+		return errors.New("server handler timeout must not be negative")
+	}
+	if c.Server.HandlerTimeout > 0 && c.Server.WriteTimeout > 0 && c.Server.HandlerTimeout >= c.Server.WriteTimeout {
+		return errors.New("server handler timeout must be less than the write timeout")
+	}
+	if c.Server.RateLimitPerMinute < 0 {
+		return errors.New("server rate limit must not be negative")
+	}
+	switch c.Server.Environment {
+	case EnvironmentProduction, EnvironmentDevelopment:
+	default:
+		return errors.New(`server environment must be "production" or "development"`)
+	}
+	if c.Server.DrainTimeout > c.Server.ShutdownTimeout {
+		return errors.New("drain timeout must not exceed the shutdown timeout")
+	}
+	if c.WebSocket.MaxMissedPongs < 0 || c.WebSocket.ProbeInterval < 0 {
+		return errors.New("websocket dead-peer probing settings must not be negative")
+	}
+	if c.WebSocket.PingPeriod >= c.WebSocket.PongWait {
+		return errors.New("websocket ping period must be less than the pong wait")
+	}
+	if c.WebSocket.HeartbeatGrace <= 0 {
+		return errors.New("websocket heartbeat grace must be positive")
+	}
+	if c.WebSocket.DrainWaves < 0 || c.WebSocket.DrainWaveDelay < 0 || c.WebSocket.DrainReconnectJitter < 0 {
+		return errors.New("websocket drain waves, wave delay and reconnect jitter must not be negative")
+	}
+	if c.WebSocket.PresenceBatchWindow < 0 {
+		return errors.New("websocket presence batch window must not be negative")
+	}
+	if c.WebSocket.RosterRequestInterval < 0 {
+		return errors.New("websocket roster request interval must not be negative")
+	}
+	if c.WebSocket.TypingInterval < 0 {
+		return errors.New("websocket typing interval must not be negative")
+	}
+	if c.WebSocket.CompressionSampleEvery < 0 {
+		return errors.New("websocket compression sample interval must not be negative")
+	}
+	if c.WebSocket.MaxConnections < 0 || c.WebSocket.MaxOrgConnections < 0 || c.WebSocket.UserConnectsPerMinute < 0 {
+		return errors.New("websocket connection limits must not be negative")
+	}
+	if c.WebSocket.MinProtocolVersion < 1 {
+		return errors.New("websocket min protocol version must be at least 1")
+	}
+	if c.WebSocket.CapacityRetryAfter <= 0 {
+		return errors.New("websocket capacity retry-after must be positive")
+	}
+	if c.WebSocket.MessageBuffer <= 0 {
+		return errors.New("websocket message buffer must be positive")
+	}
+	if c.WebSocket.ParallelFanoutThreshold < 0 || c.WebSocket.FanoutWorkers < 0 {
+		return errors.New("websocket fan-out threshold and workers must not be negative")
+	}
+	for _, bound := range c.WebSocket.DeliveryLatencyBuckets {
+		if bound <= 0 {
+			return errors.New("websocket delivery latency buckets must be positive")
+		}
+	}
+	if c.Redis.MaxMessages <= 0 {
+		return errors.New("redis max messages must be positive")
+	}
+	switch c.Redis.Mode {
+	case "", RedisModeSingle:
+	case RedisModeSentinel:
+		if c.Redis.MasterName == "" || len(c.Redis.SentinelAddrs) == 0 {
+			return errors.New("redis sentinel mode requires a master name and sentinel addresses")
+		}
+	case RedisModeCluster:
+		if len(c.Redis.ClusterAddrs) == 0 {
+			return errors.New("redis cluster mode requires cluster addresses")
+		}
+	default:
+		return errors.New(`redis mode must be "single", "sentinel" or "cluster"`)
+	}
+	if c.Redis.OrgQuotaMessages < 0 || c.Redis.OrgQuotaBytes < 0 {
+		return errors.New("redis org quotas must not be negative")
+	}
+	if c.Redis.OrgQuotaPolicy != "reject" && c.Redis.OrgQuotaPolicy != "trim" {
+		return errors.New(`redis org quota policy must be "reject" or "trim"`)
+	}
+	if c.Redis.FeatureLocalTTL < 0 {
+		return errors.New("redis feature local TTL must not be negative")
+	}
+	if c.Redis.MaxPinsPerGroup < 0 {
+		return errors.New("redis max pins per group must not be negative")
+	}
+	if c.Redis.MaxUndelivered < 0 {
+		return errors.New("redis max undelivered messages must not be negative")
+	}
+	switch c.Redis.SelfTest {
+	case "off", "warn", "fail":
+	default:
+		return errors.New(`redis self-test must be "off", "warn" or "fail"`)
+	}
+	if c.Redis.SpilloverSize < 0 {
+		return errors.New("redis spillover size must not be negative")
+	}
+	if c.Redis.SpilloverSize > 0 && c.Redis.SpilloverRetryInterval <= 0 {
+		return errors.New("redis spillover retry interval must be positive")
+	}
+	if c.Redis.QuotaUsageTTL <= 0 {
+		return errors.New("redis quota usage TTL must be positive")
+	}
+	if c.Message.MaxContentBytes < 0 {
+		return errors.New("message max content bytes must not be negative")
+	}
+	if c.Message.MaxContentBytes > 0 && c.WebSocket.MaxMessageSize <= int64(c.Message.MaxContentBytes) {
+		return errors.New("websocket max message size must exceed the message max content bytes")
+	}
+	for _, contentType := range c.Message.ContentTypes {
+		switch contentType {
+		case "text", "location", "contact", "card":
+		default:
+			return errors.New(`message content types must be "text", "location", "contact" or "card"`)
+		}
+	}
+	if c.Message.RestoreWindow < 0 {
+		return errors.New("message restore window must not be negative")
+	}
+	if c.Message.DMExpiresInMin <= 0 || c.Message.DMExpiresInMax < c.Message.DMExpiresInMin {
+		return errors.New("message DM expires_in bounds must be positive with the minimum not above the maximum")
+	}
+	if c.Message.DMExpiresInMax > c.Redis.MessageTTL {
+		return errors.New("message DM expires_in maximum must not exceed the redis message TTL")
+	}
+	if c.Message.ImportMaxBytes <= 0 {
+		return errors.New("message import max bytes must be positive")
+	}
+	if c.User.MaxUsernameLength < 1 || c.User.MaxUsernameLength > 100 {
+		return errors.New("user max username length must be between 1 and 100")
+	}
+	if c.User.MaxEmailLength < 1 || c.User.MaxEmailLength > 255 {
+		return errors.New("user max email length must be between 1 and 255")
+	}
+	if c.User.MaxFullNameLength < 1 || c.User.MaxFullNameLength > 255 {
+		return errors.New("user max full name length must be between 1 and 255")
+	}
+	if c.User.MaxAvatarURLLength < 1 || c.User.MaxAvatarURLLength > 2048 {
+		return errors.New("user max avatar URL length must be between 1 and 2048")
+	}
+	if c.User.MaxBioLength < 1 || c.User.MaxBioLength > 500 {
+		return errors.New("user max bio length must be between 1 and 500")
+	}
+	switch c.Message.Sanitize {
+	case "off", "escape", "strip":
+	default:
+		return errors.New(`message sanitize mode must be "off", "escape" or "strip"`)
+	}
+	switch c.Message.IDScheme {
+	case "uuid", "ulid", "snowflake":
+	default:
+		return errors.New(`message ID scheme must be "uuid", "ulid" or "snowflake"`)
+	}
+	if c.Message.IDNode < 0 || c.Message.IDNode > 1023 {
+		return errors.New("message ID node must be between 0 and 1023")
+	}
+	switch c.Message.UsernameFallback {
+	case "cached", "client_id", "unknown":
+	default:
+		return errors.New(`message username fallback must be "cached", "client_id" or "unknown"`)
+	}
+	if c.Message.UsernameCacheTTL < 0 {
+		return errors.New("message username cache TTL must not be negative")
+	}
+	switch c.Message.UsernameEnrichment {
+	case "write", "read":
+	default:
+		return errors.New(`message username enrichment must be "write" or "read"`)
+	}
+	if c.Message.UsernameLookupsPerSecond < 0 {
+		return errors.New("message username lookups per second must not be negative")
 	}
+	return nil
 }
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"reflect"
+	"time"
+)
+
+// redactedValue replaces secrets in Redacted output.
+const redactedValue = "[REDACTED]"
+
+// Redacted returns the configuration as nested maps keyed by field name,
+// for display to operators. Fields tagged `secret:"true"` are replaced with
+// "[REDACTED]" when set and an empty string otherwise, so the output shows
+// whether a secret is configured without revealing it. Durations are
+// rendered as strings such as "15s".
+func (c *Config) Redacted() map[string]interface{} {
+	return redactStruct(reflect.ValueOf(*c))
+}
+
+// redactStruct converts a config struct into a map, redacting secrets.
+func redactStruct(v reflect.Value) map[string]interface{} {
+	t := v.Type()
+	out := make(map[string]interface{}, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		value := v.Field(i)
+
+		if field.Tag.Get("secret") == "true" {
+			if value.IsZero() {
+				out[field.Name] = ""
+			} else {
+				out[field.Name] = redactedValue
+			}
+			continue
+		}
+
+		switch {
+		case value.Type() == reflect.TypeOf(time.Duration(0)):
+			out[field.Name] = time.Duration(value.Int()).String()
+		case value.Kind() == reflect.Struct:
+			out[field.Name] = redactStruct(value)
+		default:
+			out[field.Name] = value.Interface()
+		}
+	}
+	return out
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRedactedHidesSecrets(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Server.AdminToken = "admin-token-value"
+	cfg.Server.CursorSecret = "cursor-secret-value"
+	cfg.Server.AuthSecret = ""
+	cfg.PostgreSQL.Password = "postgres-password-value"
+	cfg.Redis.Password = "redis-password-value"
+
+	redacted := cfg.Redacted()
+	data, err := json.Marshal(redacted)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	for _, secret := range []string{"admin-token-value", "cursor-secret-value", "postgres-password-value", "redis-password-value"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("redacted config leaks %q", secret)
+		}
+	}
+
+	server := redacted["Server"].(map[string]interface{})
+	if got := server["AdminToken"]; got != redactedValue {
+		t.Errorf("set secret shown as %q, want %q", got, redactedValue)
+	}
+	if got := server["AuthSecret"]; got != "" {
+		t.Errorf("unset secret shown as %q, want empty", got)
+	}
+	// Other values are shown as configured
+	if got := server["Address"]; got != cfg.Server.Address {
+		t.Errorf("Address %v, want %q", got, cfg.Server.Address)
+	}
+	if got := redacted["Redis"].(map[string]interface{})["MessageTTL"]; got != cfg.Redis.MessageTTL.String() {
+		t.Errorf("MessageTTL %v, want %q", got, cfg.Redis.MessageTTL.String())
+	}
+}
+
+// TestSecretFieldsAreTagged guards against a new credential being added
+// without the secret tag.
+func TestSecretFieldsAreTagged(t *testing.T) {
+	var check func(typ reflect.Type, path string)
+	check = func(typ reflect.Type, path string) {
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			name := path + "." + field.Name
+			if field.Type.Kind() == reflect.Struct {
+				check(field.Type, name)
+				continue
+			}
+			if field.Type.Kind() != reflect.String {
+				continue
+			}
+			for _, word := range []string{"Password", "Secret", "Token", "Key"} {
+				if strings.HasSuffix(field.Name, word) && field.Tag.Get("secret") != "true" {
+					t.Errorf("%s looks like a secret but is not tagged secret", name)
+				}
+			}
+		}
+	}
+	check(reflect.TypeOf(Config{}), "Config")
+}
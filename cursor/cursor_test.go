@@ -0,0 +1,61 @@
+package cursor
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRoundTrip(t *testing.T) {
+	s := NewSigner("secret")
+	for _, p := range []Position{
+		{Time: time.Date(2025, 1, 1, 12, 0, 0, 123000, time.UTC), ID: "task-1"},
+		{Time: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC), Skip: 3},
+	} {
+		token := s.Encode(ListTasks, "acme", p)
+		got, err := s.Decode(token, ListTasks, "acme")
+		if err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		if !got.Time.Equal(p.Time) || got.ID != p.ID || got.Skip != p.Skip {
+			t.Errorf("got %+v, want %+v", got, p)
+		}
+	}
+}
+
+func TestDecodeRejectsOtherTokens(t *testing.T) {
+	s := NewSigner("secret")
+	p := Position{Time: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), ID: "u1"}
+	token := s.Encode(ListUsers, "acme", p)
+	body, sig, _ := strings.Cut(token, ".")
+
+	// A body naming another position, kept with the original signature
+	forged := base64.RawURLEncoding.EncodeToString([]byte(`{"l":"users","s":"acme","t":"2030-01-01T00:00:00Z","i":"u9"}`))
+
+	tests := []struct {
+		name, token, list, scope string
+	}{
+		{"no signature", body, ListUsers, "acme"},
+		{"forged body", forged + "." + sig, ListUsers, "acme"},
+		{"altered signature", body + "." + strings.Repeat("A", len(sig)), ListUsers, "acme"},
+		{"other key", NewSigner("other").Encode(ListUsers, "acme", p), ListUsers, "acme"},
+		{"other list", token, ListTasks, "acme"},
+		{"other scope", token, ListUsers, "globex"},
+		{"negative skip", s.Encode(ListMessages, "acme/general", Position{Skip: -1}), ListMessages, "acme/general"},
+		{"garbage", "not a cursor", ListUsers, "acme"},
+	}
+	for _, tt := range tests {
+		if _, err := s.Decode(tt.token, tt.list, tt.scope); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, ErrInvalid)
+		}
+	}
+}
+
+func TestRandomKeysDiffer(t *testing.T) {
+	token := NewSigner("").Encode(ListUsers, "acme", Position{ID: "u1"})
+	if _, err := NewSigner("").Decode(token, ListUsers, "acme"); !errors.Is(err, ErrInvalid) {
+		t.Errorf("another process's random key accepted the token: %v", err)
+	}
+}
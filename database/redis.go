@@ -8,21 +8,19 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
-// RedisClient wraps the redis.Client connection.
+// RedisClient wraps the Redis connection, which is a single node, a
+// Sentinel-managed failover client or a cluster client depending on cfg.Mode.
 type RedisClient struct {
-	*redis.Client
+	redis.UniversalClient
 	cfg config.RedisConfig
 }
 
 // NewRedisClient creates a new Redis client connection.
 func NewRedisClient(cfg config.RedisConfig) (*RedisClient, error) {
-	client := redis.NewClient(&redis.Options{
-		Addr:       fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
-		Password:   cfg.Password,
-		DB:         cfg.DB,
-		MaxRetries: cfg.MaxRetries,
-		PoolSize:   cfg.PoolSize,
-	})
+	client, err := newUniversalClient(cfg)
+	if err != nil {
+		return nil, err
+	}
 
 	// Test the connection
 	ctx := context.Background()
@@ -31,11 +29,46 @@ func NewRedisClient(cfg config.RedisConfig) (*RedisClient, error) {
 	}
 
 	return &RedisClient{
-		Client: client,
-		cfg:    cfg,
+		UniversalClient: client,
+		cfg:             cfg,
 	}, nil
 }
 
+// newUniversalClient builds the client for the configured Redis mode.
+func newUniversalClient(cfg config.RedisConfig) (redis.UniversalClient, error) {
+	switch cfg.Mode {
+	case "", config.RedisModeSingle:
+		return redis.NewClient(&redis.Options{
+			Addr:       fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
+			Password:   cfg.Password,
+			DB:         cfg.DB,
+			MaxRetries: cfg.MaxRetries,
+			PoolSize:   cfg.PoolSize,
+		}), nil
+
+	case config.RedisModeSentinel:
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:    cfg.MasterName,
+			SentinelAddrs: cfg.SentinelAddrs,
+			Password:      cfg.Password,
+			DB:            cfg.DB,
+			MaxRetries:    cfg.MaxRetries,
+			PoolSize:      cfg.PoolSize,
+		}), nil
+
+	case config.RedisModeCluster:
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:      cfg.ClusterAddrs,
+			Password:   cfg.Password,
+			MaxRetries: cfg.MaxRetries,
+			PoolSize:   cfg.PoolSize,
+		}), nil
+
+	default:
+		return nil, fmt.Errorf("unknown Redis mode %q", cfg.Mode)
+	}
+}
+
 // GetConfig returns the Redis configuration.
 func (r *RedisClient) GetConfig() config.RedisConfig {
 	return r.cfg
@@ -0,0 +1,86 @@
+package database
+
+import (
+	"testing"
+
+	"go-realtime-workspace/config"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestNewUniversalClientSelectsMode(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(*config.RedisConfig)
+		check     func(t *testing.T, client redis.UniversalClient)
+	}{
+		{
+			name:      "default is single node",
+			configure: func(cfg *config.RedisConfig) { cfg.Mode = "" },
+			check: func(t *testing.T, client redis.UniversalClient) {
+				c, ok := client.(*redis.Client)
+				if !ok {
+					t.Fatalf("got %T, want *redis.Client", client)
+				}
+				if addr := c.Options().Addr; addr != "localhost:6379" {
+					t.Errorf("addr %q, want localhost:6379", addr)
+				}
+			},
+		},
+		{
+			name: "sentinel",
+			configure: func(cfg *config.RedisConfig) {
+				cfg.Mode = config.RedisModeSentinel
+				cfg.MasterName = "mymaster"
+				cfg.SentinelAddrs = []string{"sentinel-1:26379", "sentinel-2:26379"}
+			},
+			check: func(t *testing.T, client redis.UniversalClient) {
+				c, ok := client.(*redis.Client)
+				if !ok {
+					t.Fatalf("got %T, want a failover *redis.Client", client)
+				}
+				// Failover clients dial through the sentinels, not Addr
+				if addr := c.Options().Addr; addr != "FailoverClient" {
+					t.Errorf("addr %q, want a failover client", addr)
+				}
+			},
+		},
+		{
+			name: "cluster",
+			configure: func(cfg *config.RedisConfig) {
+				cfg.Mode = config.RedisModeCluster
+				cfg.ClusterAddrs = []string{"node-1:6379", "node-2:6379"}
+			},
+			check: func(t *testing.T, client redis.UniversalClient) {
+				c, ok := client.(*redis.ClusterClient)
+				if !ok {
+					t.Fatalf("got %T, want *redis.ClusterClient", client)
+				}
+				if addrs := c.Options().Addrs; len(addrs) != 2 || addrs[0] != "node-1:6379" {
+					t.Errorf("seed nodes %v, want node-1 and node-2", addrs)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.DefaultConfig().Redis
+			tt.configure(&cfg)
+
+			client, err := newUniversalClient(cfg)
+			if err != nil {
+				t.Fatalf("newUniversalClient: %v", err)
+			}
+			t.Cleanup(func() { client.Close() })
+			tt.check(t, client)
+		})
+	}
+}
+
+func TestNewUniversalClientRejectsUnknownMode(t *testing.T) {
+	cfg := config.DefaultConfig().Redis
+	cfg.Mode = "replicated"
+	if _, err := newUniversalClient(cfg); err == nil {
+		t.Fatal("unknown mode accepted")
+	}
+}
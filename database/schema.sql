@@ -12,6 +12,70 @@ CREATE TABLE IF NOT EXISTS users (
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 );
 
+-- Organization role of each user
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'member'
+    CHECK (role IN ('owner', 'admin', 'manager', 'member'));
+
+-- Profile fields shown next to a user's messages
+ALTER TABLE users ADD COLUMN IF NOT EXISTS avatar_url VARCHAR(2048) NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS bio VARCHAR(500) NOT NULL DEFAULT '';
+
+-- Create org_invites table (only a SHA-256 hash of each token is stored)
+CREATE TABLE IF NOT EXISTS org_invites (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    token_hash CHAR(64) UNIQUE NOT NULL,
+    org_id VARCHAR(100) NOT NULL,
+    role VARCHAR(20) NOT NULL DEFAULT 'member' CHECK (role IN ('admin', 'manager', 'member')),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    accepted_at TIMESTAMP WITH TIME ZONE,
+    accepted_by UUID REFERENCES users(id) ON DELETE SET NULL
+);
+
+-- Create audit_log table (administrative changes within an organization)
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    org_id VARCHAR(100) NOT NULL,
+    actor_id UUID,
+    action VARCHAR(100) NOT NULL,
+    target_id VARCHAR(100),
+    metadata JSONB NOT NULL DEFAULT '{}',
+    request_id VARCHAR(100),
+    ip VARCHAR(100),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create org_features table (flags an org has never set are enabled)
+CREATE TABLE IF NOT EXISTS org_features (
+    org_id VARCHAR(100) NOT NULL,
+    feature VARCHAR(50) NOT NULL,
+    enabled BOOLEAN NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (org_id, feature)
+);
+
+-- Create notification_prefs table (users without a row get every notification)
+CREATE TABLE IF NOT EXISTS notification_prefs (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    level VARCHAR(20) NOT NULL DEFAULT 'all' CHECK (level IN ('all', 'mentions', 'dms', 'none')),
+    muted_groups JSONB NOT NULL DEFAULT '[]',
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create message_templates table (canned messages of an organization)
+CREATE TABLE IF NOT EXISTS message_templates (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    org_id VARCHAR(100) NOT NULL,
+    key VARCHAR(50) NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    body TEXT NOT NULL,
+    variables JSONB NOT NULL DEFAULT '[]',
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (org_id, key)
+);
+
 -- Create tasks table
 CREATE TABLE IF NOT EXISTS tasks (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
@@ -26,13 +90,48 @@ CREATE TABLE IF NOT EXISTS tasks (
     completed_at TIMESTAMP WITH TIME ZONE
 );
 
+-- Rank of each task in its user's manual order (lower comes first)
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS position DOUBLE PRECISION NOT NULL DEFAULT 0;
+
+-- Number existing tasks oldest first, for users none of whose tasks have a
+-- position yet; the spacing must match taskPositionGap in task_repository.go.
+UPDATE tasks t SET position = ranked.position
+FROM (
+    SELECT id, ROW_NUMBER() OVER (PARTITION BY user_id ORDER BY created_at) * 1024 AS position
+    FROM tasks
+    WHERE user_id IN (SELECT user_id FROM tasks GROUP BY user_id HAVING bool_and(position = 0))
+) ranked
+WHERE t.id = ranked.id;
+
 -- Create indexes for better query performance
 CREATE INDEX IF NOT EXISTS idx_users_org_id ON users(org_id);
 CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
+-- Keyset pagination of an org's users (see package cursor)
+CREATE INDEX IF NOT EXISTS idx_users_org_id_created_at ON users(org_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_org_invites_org_id ON org_invites(org_id);
+-- Emails are stored lowercased, so this makes them unique regardless of case.
+-- On existing databases, lowercase stored emails and merge duplicates first.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_lower ON users(LOWER(email));
+-- Prefix search of an org's users (UserRepository.SearchInOrg); text_pattern_ops
+-- lets LIKE 'prefix%' use the index under any collation.
+CREATE INDEX IF NOT EXISTS idx_users_org_username_prefix ON users(org_id, LOWER(username) text_pattern_ops);
+CREATE INDEX IF NOT EXISTS idx_users_org_full_name_prefix ON users(org_id, LOWER(full_name) text_pattern_ops);
+CREATE INDEX IF NOT EXISTS idx_users_org_email_prefix ON users(org_id, LOWER(email) text_pattern_ops);
+CREATE INDEX IF NOT EXISTS idx_audit_log_org_id_created_at ON audit_log(org_id, created_at);
 CREATE INDEX IF NOT EXISTS idx_tasks_user_id ON tasks(user_id);
 CREATE INDEX IF NOT EXISTS idx_tasks_status ON tasks(status);
 CREATE INDEX IF NOT EXISTS idx_tasks_due_date ON tasks(due_date);
 CREATE INDEX IF NOT EXISTS idx_tasks_created_at ON tasks(created_at);
+CREATE INDEX IF NOT EXISTS idx_tasks_created_at_id ON tasks(created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_tasks_user_id_created_at ON tasks(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_tasks_user_id_position ON tasks(user_id, position);
+-- Organization task lists (TaskRepository.GetByOrgID) join tasks to users on
+-- user_id and filter on users.org_id: the first index yields an org's user
+-- IDs without reading the table, the second each user's tasks in list order.
+CREATE INDEX IF NOT EXISTS idx_users_org_id_id ON users(org_id, id);
+CREATE INDEX IF NOT EXISTS idx_tasks_user_id_created_at_id ON tasks(user_id, created_at DESC, id DESC);
+-- Full-text task search; the expression must match taskDocument in task_repository.go.
+CREATE INDEX IF NOT EXISTS idx_tasks_search ON tasks USING GIN (to_tsvector('english', title || ' ' || COALESCE(description, '')));
 
 -- Create updated_at trigger function
 CREATE OR REPLACE FUNCTION update_updated_at_column()
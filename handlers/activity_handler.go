@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"go-realtime-workspace/repository"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// ActivityHandler handles organization activity HTTP requests.
+type ActivityHandler struct {
+	repo *repository.ActivityRepository
+}
+
+// NewActivityHandler creates a new activity handler.
+func NewActivityHandler(repo *repository.ActivityRepository) *ActivityHandler {
+	return &ActivityHandler{repo: repo}
+}
+
+// Timeline handles retrieving an organization's activity in time buckets.
+func (h *ActivityHandler) Timeline(w http.ResponseWriter, r *http.Request) {
+	orgID := mux.Vars(r)["orgId"]
+
+	window := 24 * time.Hour
+	if windowStr := r.URL.Query().Get("window"); windowStr != "" {
+		d, err := time.ParseDuration(windowStr)
+		if err != nil {
+			http.Error(w, "Invalid window duration", http.StatusBadRequest)
+			return
+		}
+		window = d
+	}
+
+	bucket := time.Hour
+	if bucketStr := r.URL.Query().Get("bucket"); bucketStr != "" {
+		d, err := time.ParseDuration(bucketStr)
+		if err != nil {
+			http.Error(w, "Invalid bucket duration", http.StatusBadRequest)
+			return
+		}
+		bucket = d
+	}
+
+	if bucket < time.Hour || bucket%time.Hour != 0 {
+		http.Error(w, "bucket must be a whole number of hours", http.StatusBadRequest)
+		return
+	}
+	if window < bucket || window > repository.ActivityRetention {
+		http.Error(w, "window must be at least one bucket and at most 168h", http.StatusBadRequest)
+		return
+	}
+
+	buckets, err := h.repo.Timeline(r.Context(), orgID, time.Now(), window, bucket)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"org_id":  orgID,
+		"window":  window.String(),
+		"bucket":  bucket.String(),
+		"buckets": buckets,
+	})
+}
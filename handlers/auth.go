@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"go-realtime-workspace/middleware"
+	"slices"
+)
+
+// roleLookup returns the roles of users in an organization, keyed by user
+// ID; users outside it are left out (see repository.UserRepository.Roles).
+type roleLookup interface {
+	Roles(ctx context.Context, orgID string, userIDs []string) (map[string]string, error)
+}
+
+// requireCaller returns who an API request acts as: the user of its access
+// token, or "" for the admin token. Anonymous requests get 401 and ok is
+// false.
+func requireCaller(w http.ResponseWriter, r *http.Request) (userID string, ok bool) {
+	if middleware.IsAdmin(r.Context()) {
+		return "", true
+	}
+	if userID = middleware.AuthUserID(r.Context()); userID == "" {
+		writeError(w, r, "Authentication required", http.StatusUnauthorized)
+		return "", false
+	}
+	return userID, true
+}
+
+// requireOrgRole is requireCaller for actions limited to some roles of an
+// organization: an authenticated user whose role in orgID is not one of
+// roles gets 403. The admin token is always allowed.
+func requireOrgRole(w http.ResponseWriter, r *http.Request, users roleLookup, orgID string, roles ...string) (userID string, ok bool) {
+	if userID, ok = requireCaller(w, r); !ok || userID == "" {
+		return userID, ok
+	}
+
+	found, err := users.Roles(r.Context(), orgID, []string{userID})
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return "", false
+	}
+	if !slices.Contains(roles, found[userID]) {
+		writeError(w, r, "Your role in this organization does not allow this", http.StatusForbidden)
+		return "", false
+	}
+	return userID, true
+}
+
+// requireSelf is requireCaller for actions on a user's own data: an
+// authenticated user other than userID gets 403. The admin token is always
+// allowed.
+func requireSelf(w http.ResponseWriter, r *http.Request, userID string) bool {
+	callerID, ok := requireCaller(w, r)
+	if !ok {
+		return false
+	}
+	if callerID != "" && callerID != userID {
+		writeError(w, r, "You may only access your own data", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// requireActor is requireCaller for actions taken as the user a request
+// names in clientID: an authenticated user acts as themselves, and naming
+// anyone else gets 403. The admin token acts as clientID, which may be "".
+func requireActor(w http.ResponseWriter, r *http.Request, clientID string) (actorID string, ok bool) {
+	callerID, ok := requireCaller(w, r)
+	if !ok || callerID == "" {
+		return clientID, ok
+	}
+	if clientID != "" && clientID != callerID {
+		writeError(w, r, "You may only act as yourself", http.StatusForbidden)
+		return "", false
+	}
+	return callerID, true
+}
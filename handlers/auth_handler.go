@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"net/http"
+	"go-realtime-workspace/auth"
+	"go-realtime-workspace/repository"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// AuthHandler issues user access tokens.
+type AuthHandler struct {
+	tokens *auth.Signer
+	users  *repository.UserRepository
+	ttl    time.Duration
+}
+
+// NewAuthHandler creates a new auth handler issuing tokens that expire
+// after ttl (never if ttl is 0).
+func NewAuthHandler(tokens *auth.Signer, users *repository.UserRepository, ttl time.Duration) *AuthHandler {
+	return &AuthHandler{tokens: tokens, users: users, ttl: ttl}
+}
+
+// TokenResponse is the response body of IssueToken.
+type TokenResponse struct {
+	Token     string     `json:"token"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // Omitted if the token never expires
+}
+
+// IssueToken handles issuing an access token for a user. It is meant for
+// the trusted backend that signs users in, so it is admin-only.
+func (h *AuthHandler) IssueToken(w http.ResponseWriter, r *http.Request) {
+	user, err := h.users.GetByID(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, "User not found", http.StatusNotFound)
+		return
+	}
+
+	var resp TokenResponse
+	var expiresAt time.Time
+	if h.ttl > 0 {
+		expiresAt = time.Now().Add(h.ttl).Truncate(time.Second)
+		resp.ExpiresAt = &expiresAt
+	}
+	resp.Token = h.tokens.Issue(user.ID, expiresAt)
+
+	writeJSON(w, r, http.StatusOK, resp, nil)
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-realtime-workspace/middleware"
+)
+
+// testAdminToken is the admin token requests are identified with by asUser.
+const testAdminToken = "admin-token"
+
+// userTokens accepts a user's ID as their access token.
+type userTokens struct{}
+
+func (userTokens) VerifyToken(ctx context.Context, token string) (string, time.Time, error) {
+	return token, time.Time{}, nil
+}
+
+// asUser returns req as identified by middleware.Identify: as userID, as the
+// admin when userID is testAdminToken, or anonymously when userID is empty.
+func asUser(t *testing.T, req *http.Request, userID string) *http.Request {
+	t.Helper()
+	if userID == "" {
+		return req
+	}
+	req.Header.Set("Authorization", "Bearer "+userID)
+
+	var identified *http.Request
+	middleware.Identify(testAdminToken, userTokens{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identified = r
+	})).ServeHTTP(httptest.NewRecorder(), req)
+	if identified == nil {
+		t.Fatalf("request as %q was not identified", userID)
+	}
+	return identified
+}
+
+// fakeRoles is a roleLookup over a fixed map of user ID to role, for a
+// single organization.
+type fakeRoles map[string]string
+
+func (f fakeRoles) Roles(ctx context.Context, orgID string, userIDs []string) (map[string]string, error) {
+	roles := make(map[string]string)
+	for _, id := range userIDs {
+		if role, ok := f[id]; ok {
+			roles[id] = role
+		}
+	}
+	return roles, nil
+}
+
+// failingRoles is a roleLookup whose lookups fail.
+type failingRoles struct{}
+
+func (failingRoles) Roles(ctx context.Context, orgID string, userIDs []string) (map[string]string, error) {
+	return nil, errors.New("database unavailable")
+}
+
+func TestRequireOrgRole(t *testing.T) {
+	roles := fakeRoles{"owner": "owner", "member": "member"}
+
+	tests := []struct {
+		name     string
+		caller   string
+		users    roleLookup
+		wantCode int
+		wantID   string
+	}{
+		{name: "anonymous", users: roles, wantCode: http.StatusUnauthorized},
+		{name: "admin token", caller: testAdminToken, users: roles, wantCode: http.StatusOK},
+		{name: "owner", caller: "owner", users: roles, wantCode: http.StatusOK, wantID: "owner"},
+		{name: "member", caller: "member", users: roles, wantCode: http.StatusForbidden},
+		{name: "outsider", caller: "outsider", users: roles, wantCode: http.StatusForbidden},
+		{name: "lookup fails", caller: "owner", users: failingRoles{}, wantCode: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := asUser(t, httptest.NewRequest(http.MethodGet, "/", nil), tt.caller)
+			rec := httptest.NewRecorder()
+
+			id, ok := requireOrgRole(rec, req, tt.users, "acme", "owner", "admin")
+			if ok != (tt.wantCode == http.StatusOK) || (!ok && rec.Code != tt.wantCode) {
+				t.Fatalf("ok %v, status %d; want status %d", ok, rec.Code, tt.wantCode)
+			}
+			if id != tt.wantID {
+				t.Errorf("caller %q, want %q", id, tt.wantID)
+			}
+		})
+	}
+}
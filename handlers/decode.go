@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// errBodyTooLarge is returned by decodeJSON when the body exceeds the
+// route's size limit; handlers report it as 413.
+var errBodyTooLarge = errors.New("request body is too large")
+
+// decodeJSON decodes a request body into v, rejecting fields v does not
+// declare. The returned error describes what was wrong with the body, e.g.
+// which field had the wrong type, and is meant to be sent back as a 400.
+func decodeJSON(r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(v)
+	if err == nil {
+		if decoder.More() {
+			return errors.New("request body must contain a single JSON object")
+		}
+		return nil
+	}
+
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var timeErr *time.ParseError
+	var maxErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxErr):
+		return fmt.Errorf("%w (limit is %d bytes)", errBodyTooLarge, maxErr.Limit)
+	case errors.As(err, &syntaxErr):
+		return fmt.Errorf("request body is not valid JSON (at byte %d)", syntaxErr.Offset)
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return errors.New("request body is not valid JSON (unexpected end of input)")
+	case errors.Is(err, io.EOF):
+		return errors.New("request body must not be empty")
+	case errors.As(err, &typeErr):
+		if typeErr.Field == "" {
+			return fmt.Errorf("request body must be a JSON object, not %s", typeErr.Value)
+		}
+		return fmt.Errorf("field %q must be %s, not %s", typeErr.Field, jsonType(typeErr.Type), typeErr.Value)
+	case errors.As(err, &timeErr):
+		return fmt.Errorf("timestamp %s is not in RFC 3339 format", timeErr.Value)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no typed error for unknown fields
+		return fmt.Errorf("unknown field %s", strings.TrimPrefix(err.Error(), "json: unknown field "))
+	}
+	return fmt.Errorf("invalid request body: %v", err)
+}
+
+// jsonType names the JSON type expected for a Go type.
+func jsonType(t reflect.Type) string {
+	if t == reflect.TypeOf(time.Time{}) {
+		return "an RFC 3339 timestamp"
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	}
+	return t.String()
+}
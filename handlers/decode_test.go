@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-realtime-workspace/models"
+)
+
+func TestDecodeJSONErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{name: "valid", body: `{"title": "Ship it", "priority": "high"}`},
+		{name: "type mismatch", body: `{"title": "Ship it", "priority": 2}`, want: `field "priority" must be a string, not number`},
+		{name: "unknown field", body: `{"title": "Ship it", "prority": "high"}`, want: `unknown field "prority"`},
+		{name: "malformed", body: `{"title": "Ship it",}`, want: "request body is not valid JSON (at byte 21)"},
+		{name: "truncated", body: `{"title": "Ship`, want: "request body is not valid JSON (unexpected end of input)"},
+		{name: "empty", body: ``, want: "request body must not be empty"},
+		{name: "not an object", body: `["Ship it"]`, want: "request body must be a JSON object, not array"},
+		{name: "bad timestamp", body: `{"title": "Ship it", "due_date": "tomorrow"}`, want: "timestamp tomorrow is not in RFC 3339 format"},
+		{name: "trailing data", body: `{"title": "Ship it"} {}`, want: "request body must contain a single JSON object"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			var task models.CreateTaskRequest
+			err := decodeJSON(req, &task)
+			got := ""
+			if err != nil {
+				got = err.Error()
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
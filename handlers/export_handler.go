@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"log"
+	"net/http"
+	"go-realtime-workspace/models"
+	"go-realtime-workspace/repository"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// exportSchemaVersion is bumped whenever the export document layout changes.
+const exportSchemaVersion = 1
+
+// ExportHandler handles data-portability exports.
+type ExportHandler struct {
+	userRepo  *repository.UserRepository
+	taskRepo  *repository.TaskRepository
+	msgRepo   *repository.MessageRepository
+	auditRepo *repository.AuditRepository
+}
+
+// NewExportHandler creates a new export handler.
+func NewExportHandler(userRepo *repository.UserRepository, taskRepo *repository.TaskRepository, msgRepo *repository.MessageRepository, auditRepo *repository.AuditRepository) *ExportHandler {
+	return &ExportHandler{userRepo: userRepo, taskRepo: taskRepo, msgRepo: msgRepo, auditRepo: auditRepo}
+}
+
+// ExportUser streams a JSON document with a user's profile, tasks and every
+// message they authored in groups and DMs. Messages are written as they are
+// found rather than collected first, so large histories do not build up in memory.
+// Only the user themselves or the admin may export a user's data.
+func (h *ExportHandler) ExportUser(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["id"]
+	if !requireSelf(w, r, userID) {
+		return
+	}
+
+	user, err := h.userRepo.GetByID(r.Context(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	tasks, err := h.taskRepo.GetByUserID(r.Context(), userID, "", "", "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	header, err := json.Marshal(map[string]interface{}{
+		"schema_version": exportSchemaVersion,
+		"generated_at":   time.Now().UTC(),
+		"profile":        user,
+		"tasks":          tasks,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="user-`+userID+`-export.json"`)
+
+	// Reopen the header object and append the messages array to it
+	w.Write(header[:len(header)-1])
+	w.Write([]byte(`,"messages":[`))
+
+	first := true
+	err = h.msgRepo.ForEachMessageBy(r.Context(), userID, func(msg models.ChatMessage) error {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		if !first {
+			w.Write([]byte(","))
+		}
+		first = false
+		_, err = w.Write(data)
+		return err
+	})
+	if err != nil {
+		// Headers are already sent; truncate the document so it fails to parse
+		log.Printf("Error exporting messages for user %s: %v", userID, err)
+		return
+	}
+
+	w.Write([]byte("]}\n"))
+}
+
+// auditCSVHeader names the columns of a CSV audit export.
+var auditCSVHeader = []string{"id", "created_at", "actor_id", "action", "target_id", "metadata", "request_id", "ip"}
+
+// ExportAudit streams an organization's audit log as CSV or NDJSON, oldest
+// first. Entries are written as they are read, a page at a time, so large
+// logs do not build up in memory.
+func (h *ExportHandler) ExportAudit(w http.ResponseWriter, r *http.Request) {
+	orgID := mux.Vars(r)["orgId"]
+	query := r.URL.Query()
+
+	format := query.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "ndjson" {
+		http.Error(w, "format must be csv or ndjson", http.StatusBadRequest)
+		return
+	}
+
+	var from, to time.Time
+	for _, param := range []struct {
+		name string
+		t    *time.Time
+	}{{"from", &from}, {"to", &to}} {
+		if v := query.Get(param.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				http.Error(w, param.name+" must be an RFC 3339 timestamp", http.StatusBadRequest)
+				return
+			}
+			*param.t = t
+		}
+	}
+	if !from.IsZero() && !to.IsZero() && !to.After(from) {
+		http.Error(w, "to must be after from", http.StatusBadRequest)
+		return
+	}
+
+	filename := "audit-" + orgID + "." + format
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	var write func(models.AuditEntry) error
+	var flush func() error
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		cw := csv.NewWriter(w)
+		cw.Write(auditCSVHeader)
+		write = func(entry models.AuditEntry) error {
+			return cw.Write([]string{
+				entry.ID,
+				entry.CreatedAt.UTC().Format(time.RFC3339Nano),
+				entry.ActorID,
+				entry.Action,
+				entry.TargetID,
+				string(entry.Metadata),
+				entry.RequestID,
+				entry.IP,
+			})
+		}
+		flush = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		enc := json.NewEncoder(w)
+		write = func(entry models.AuditEntry) error { return enc.Encode(entry) }
+		flush = func() error { return nil }
+	}
+
+	err := h.auditRepo.ForEach(r.Context(), orgID, from, to, write)
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		// Headers are already sent; the export simply ends early
+		log.Printf("Error exporting audit log for org %s: %v", orgID, err)
+	}
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"go-realtime-workspace/config"
+	"go-realtime-workspace/models"
+	"go-realtime-workspace/repository"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+)
+
+func TestExportUserRequiresSelf(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+	h := NewExportHandler(repository.NewUserRepository(db, config.DefaultConfig().User), nil, nil, nil)
+
+	tests := []struct {
+		caller string
+		want   int
+	}{
+		{caller: "", want: http.StatusUnauthorized},
+		{caller: "mallory", want: http.StatusForbidden},
+		{caller: "alice", want: http.StatusNotFound},
+		{caller: testAdminToken, want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		// Allowed callers reach the profile lookup
+		if tt.want == http.StatusNotFound {
+			mock.ExpectQuery("FROM users WHERE id").WithArgs("alice").WillReturnError(sql.ErrNoRows)
+		}
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/users/alice/export", nil)
+		req = mux.SetURLVars(asUser(t, req, tt.caller), map[string]string{"id": "alice"})
+		rec := httptest.NewRecorder()
+
+		h.ExportUser(rec, req)
+
+		if rec.Code != tt.want {
+			t.Errorf("ExportUser as %q: status %d, want %d", tt.caller, rec.Code, tt.want)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestExportUserContainsOnlyTheirData(t *testing.T) {
+	_, msgRepo := newTestMessageHandler(t, nil)
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+	cfg := config.DefaultConfig()
+	h := NewExportHandler(repository.NewUserRepository(db, cfg.User), repository.NewTaskRepository(db), msgRepo, nil)
+
+	ctx := context.Background()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, msg := range []models.ChatMessage{
+		{ID: "alice-group", OrgID: "acme", GroupID: "general", ClientID: "alice"},
+		{ID: "bob-group", OrgID: "acme", GroupID: "general", ClientID: "bob"},
+		{ID: "alice-dm", OrgID: repository.DMOrgID, GroupID: "alice_bob", ClientID: "alice", RecipientID: "bob"},
+		{ID: "bob-dm", OrgID: repository.DMOrgID, GroupID: "alice_bob", ClientID: "bob", RecipientID: "alice"},
+	} {
+		msg.Content = "hello"
+		msg.Timestamp = start.Add(time.Duration(i) * time.Second)
+		if _, err := msgRepo.Save(ctx, msg); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+	ann := models.ChatMessage{ID: "alice-ann", OrgID: "acme", ClientID: "alice", Content: "news", Timestamp: start}
+	if err := msgRepo.SaveAnnouncement(ctx, ann, []string{"general", "random"}); err != nil {
+		t.Fatalf("SaveAnnouncement: %v", err)
+	}
+
+	now := time.Now()
+	mock.ExpectQuery("FROM users WHERE id").WithArgs("alice").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "email", "full_name", "avatar_url", "bio", "org_id", "role", "created_at", "updated_at"}).
+			AddRow("alice", "alice", "alice@example.com", "", "", "", "acme", models.RoleMember, now, now))
+	mock.ExpectQuery("FROM tasks t\\s+WHERE t.user_id = \\$1").WithArgs("alice").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "title", "description", "status", "priority", "due_date", "position", "created_at", "updated_at", "completed_at"}).
+			AddRow("task-1", "alice", "Write report", "", models.TaskStatusPending, "medium", nil, 1.0, now, now, nil))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/users/alice/export", nil)
+	req = mux.SetURLVars(asUser(t, req, "alice"), map[string]string{"id": "alice"})
+	rec := httptest.NewRecorder()
+	h.ExportUser(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+	var export struct {
+		Profile  models.User          `json:"profile"`
+		Tasks    []models.Task        `json:"tasks"`
+		Messages []models.ChatMessage `json:"messages"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &export); err != nil {
+		t.Fatalf("export does not parse: %v", err)
+	}
+	if export.Profile.ID != "alice" || len(export.Tasks) != 1 || export.Tasks[0].ID != "task-1" {
+		t.Errorf("profile %q with tasks %+v, want alice with task-1", export.Profile.ID, export.Tasks)
+	}
+	var ids []string
+	for _, msg := range export.Messages {
+		ids = append(ids, msg.ID)
+	}
+	slices.Sort(ids)
+	if want := []string{"alice-ann", "alice-dm", "alice-group"}; !slices.Equal(ids, want) {
+		t.Errorf("exported messages %v, want %v", ids, want)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestExportAudit(t *testing.T) {
+	const entries = 502 // A full page of 500 and part of another
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	columns := []string{"id", "org_id", "actor_id", "action", "target_id", "metadata", "request_id", "ip", "created_at"}
+	page := func(first, last int) *sqlmock.Rows {
+		rows := sqlmock.NewRows(columns)
+		for id := first; id <= last; id++ {
+			rows.AddRow(int64(id), "acme", "alice", "user.update", "bob", []byte(`{"field":"role"}`), "req-1", "10.0.0.1", start.Add(time.Duration(id)*time.Second))
+		}
+		return rows
+	}
+
+	for _, format := range []string{"csv", "ndjson"} {
+		t.Run(format, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("sqlmock: %v", err)
+			}
+			defer db.Close()
+			mock.ExpectQuery("FROM audit_log").WithArgs("acme", int64(0), sqlmock.AnyArg(), sqlmock.AnyArg(), 500).
+				WillReturnRows(page(1, 500))
+			mock.ExpectQuery("FROM audit_log").WithArgs("acme", int64(500), sqlmock.AnyArg(), sqlmock.AnyArg(), 500).
+				WillReturnRows(page(501, entries))
+			h := NewExportHandler(nil, nil, nil, repository.NewAuditRepository(db))
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/orgs/acme/audit/export?format="+format+"&from="+start.Format(time.RFC3339), nil)
+			req = mux.SetURLVars(req, map[string]string{"orgId": "acme"})
+			rec := httptest.NewRecorder()
+			h.ExportAudit(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+			}
+			var first models.AuditEntry
+			var rows int
+			if format == "csv" {
+				records, err := csv.NewReader(rec.Body).ReadAll()
+				if err != nil {
+					t.Fatalf("export does not parse: %v", err)
+				}
+				if !slices.Equal(records[0], auditCSVHeader) {
+					t.Errorf("header %v, want %v", records[0], auditCSVHeader)
+				}
+				rows = len(records) - 1
+				r := records[1]
+				first = models.AuditEntry{ID: r[0], ActorID: r[2], Action: r[3], TargetID: r[4], Metadata: json.RawMessage(r[5]), RequestID: r[6], IP: r[7]}
+			} else {
+				dec := json.NewDecoder(rec.Body)
+				for dec.More() {
+					var entry models.AuditEntry
+					if err := dec.Decode(&entry); err != nil {
+						t.Fatalf("line %d does not parse: %v", rows+1, err)
+					}
+					if rows == 0 {
+						first = entry
+					}
+					rows++
+				}
+			}
+
+			if rows != entries {
+				t.Errorf("exported %d rows, want %d", rows, entries)
+			}
+			if first.ID != "1" || first.ActorID != "alice" || first.Action != "user.update" || first.TargetID != "bob" ||
+				string(first.Metadata) != `{"field":"role"}` || first.RequestID != "req-1" || first.IP != "10.0.0.1" {
+				t.Errorf("first row %+v, want the oldest entry with every column", first)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestExportAuditRejectsBadParameters(t *testing.T) {
+	h := NewExportHandler(nil, nil, nil, nil)
+	for _, query := range []string{
+		"format=xml",
+		"from=yesterday",
+		"from=2025-01-02T00:00:00Z&to=2025-01-01T00:00:00Z",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/orgs/acme/audit/export?"+query, nil)
+		req = mux.SetURLVars(req, map[string]string{"orgId": "acme"})
+		rec := httptest.NewRecorder()
+		h.ExportAudit(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want %d", query, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"go-realtime-workspace/models"
+	"go-realtime-workspace/repository"
+
+	"github.com/gorilla/mux"
+)
+
+// FeatureHandler handles per-organization feature flag HTTP requests.
+type FeatureHandler struct {
+	repo *repository.FeatureRepository
+}
+
+// NewFeatureHandler creates a new feature flag handler.
+func NewFeatureHandler(repo *repository.FeatureRepository) *FeatureHandler {
+	return &FeatureHandler{repo: repo}
+}
+
+// Get handles listing an organization's feature flags.
+func (h *FeatureHandler) Get(w http.ResponseWriter, r *http.Request) {
+	h.writeFeatures(w, r, mux.Vars(r)["orgId"])
+}
+
+// Set handles enabling or disabling a feature for an organization.
+func (h *FeatureHandler) Set(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	orgID, feature := vars["orgId"], vars["feature"]
+
+	if !models.ValidFeature(feature) {
+		http.Error(w, "Unknown feature", http.StatusNotFound)
+		return
+	}
+
+	var req models.SetFeatureRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.repo.SetFeature(r.Context(), orgID, feature, req.Enabled); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.writeFeatures(w, r, orgID)
+}
+
+// writeFeatures responds with every feature flag of an organization.
+func (h *FeatureHandler) writeFeatures(w http.ResponseWriter, r *http.Request, orgID string) {
+	features, err := h.repo.Features(r.Context(), orgID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"org_id":   orgID,
+		"features": features,
+	})
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"go-realtime-workspace/middleware"
+	"go-realtime-workspace/models"
+	"go-realtime-workspace/repository"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Invite lifetime bounds, in hours.
+const (
+	defaultInviteHours = 7 * 24
+	maxInviteHours     = 30 * 24
+)
+
+// InviteHandler handles organization invite HTTP requests.
+type InviteHandler struct {
+	repo  *repository.InviteRepository
+	users roleLookup
+}
+
+// NewInviteHandler creates a new invite handler. Invites are managed by the
+// owners and admins of an organization, whose roles are looked up in users.
+func NewInviteHandler(repo *repository.InviteRepository, users roleLookup) *InviteHandler {
+	return &InviteHandler{repo: repo, users: users}
+}
+
+// Create handles creating an invite to an organization. The caller must be
+// an owner or admin of the organization, or use the admin token.
+func (h *InviteHandler) Create(w http.ResponseWriter, r *http.Request) {
+	orgID := mux.Vars(r)["orgId"]
+	if _, ok := requireOrgRole(w, r, h.users, orgID, models.RoleOwner, models.RoleAdmin); !ok {
+		return
+	}
+
+	var req models.CreateInviteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Role == "" {
+		req.Role = models.RoleMember
+	}
+	if !models.ValidRole(req.Role) || req.Role == models.RoleOwner {
+		http.Error(w, "role must be admin, manager or member", http.StatusBadRequest)
+		return
+	}
+
+	hours := req.ExpiresInHours
+	if hours <= 0 {
+		hours = defaultInviteHours
+	}
+	if hours > maxInviteHours {
+		http.Error(w, "expires_in_hours must be at most 720", http.StatusBadRequest)
+		return
+	}
+
+	invite, err := h.repo.Create(r.Context(), orgID, req.Role, time.Duration(hours)*time.Hour)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(invite)
+}
+
+// GetPending handles listing an organization's pending invites, for the
+// same callers as Create.
+func (h *InviteHandler) GetPending(w http.ResponseWriter, r *http.Request) {
+	orgID := mux.Vars(r)["orgId"]
+	if _, ok := requireOrgRole(w, r, h.users, orgID, models.RoleOwner, models.RoleAdmin); !ok {
+		return
+	}
+
+	invites, err := h.repo.GetPending(r.Context(), orgID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(invites)
+}
+
+// Accept handles redeeming an invite token. An authenticated caller joins
+// as themselves; otherwise a new user is created from the body. Only the
+// admin token may link another existing user by user_id, since the token
+// alone does not prove who is accepting.
+func (h *InviteHandler) Accept(w http.ResponseWriter, r *http.Request) {
+	token := mux.Vars(r)["token"]
+
+	var req models.AcceptInviteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if callerID := middleware.AuthUserID(r.Context()); callerID != "" {
+		if req.UserID != "" && req.UserID != callerID {
+			http.Error(w, "An invite can only be accepted for the authenticated user", http.StatusForbidden)
+			return
+		}
+		req.UserID = callerID
+	} else if req.UserID != "" && !middleware.IsAdmin(r.Context()) {
+		http.Error(w, "Authentication required to accept an invite as an existing user", http.StatusUnauthorized)
+		return
+	}
+
+	if req.UserID == "" && (req.Username == "" || req.Email == "") {
+		http.Error(w, "Provide user_id, or username and email to create a user", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.repo.Accept(r.Context(), token, req)
+	switch {
+	case errors.Is(err, repository.ErrInviteNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, repository.ErrInviteUsed):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, repository.ErrInviteExpired):
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	case errors.Is(err, repository.ErrInvalidUser):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, repository.ErrUnknownUser):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, repository.ErrLastOwner):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
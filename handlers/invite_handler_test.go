@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-realtime-workspace/config"
+	"go-realtime-workspace/models"
+	"go-realtime-workspace/repository"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+)
+
+func TestCreateInviteRequiresOrgAdmin(t *testing.T) {
+	h := NewInviteHandler(nil, fakeRoles{"member": "member"})
+
+	for caller, want := range map[string]int{"": http.StatusUnauthorized, "member": http.StatusForbidden} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/orgs/acme/invites", strings.NewReader(`{"role": "admin"}`))
+		req = mux.SetURLVars(asUser(t, req, caller), map[string]string{"orgId": "acme"})
+		rec := httptest.NewRecorder()
+
+		h.Create(rec, req)
+
+		if rec.Code != want {
+			t.Errorf("caller %q: status %d, want %d", caller, rec.Code, want)
+		}
+	}
+}
+
+func TestAcceptInviteRejectsOtherUsers(t *testing.T) {
+	h := NewInviteHandler(nil, fakeRoles{})
+
+	for caller, want := range map[string]int{"": http.StatusUnauthorized, "mallory": http.StatusForbidden} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/invites/token/accept", strings.NewReader(`{"user_id": "owner-id"}`))
+		req = mux.SetURLVars(asUser(t, req, caller), map[string]string{"token": "token"})
+		rec := httptest.NewRecorder()
+
+		h.Accept(rec, req)
+
+		if rec.Code != want {
+			t.Errorf("caller %q: status %d, want %d", caller, rec.Code, want)
+		}
+	}
+}
+
+func TestAcceptInviteForUnknownUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+	h := NewInviteHandler(repository.NewInviteRepository(db, config.DefaultConfig().User), fakeRoles{})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("FROM org_invites WHERE token_hash").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "org_id", "role", "expires_at", "accepted_at"}).
+			AddRow("invite-1", "acme", models.RoleMember, time.Now().Add(time.Hour), nil))
+	mock.ExpectQuery("SELECT org_id, role FROM users").WithArgs("nobody").WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/invites/token/accept", strings.NewReader(`{}`))
+	req = mux.SetURLVars(asUser(t, req, "nobody"), map[string]string{"token": "token"})
+	rec := httptest.NewRecorder()
+	h.Accept(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// APIPrefix is the path prefix of the versioned REST API. The router mounts
+// its API subrouter here, and Location headers are built from it.
+const APIPrefix = "/api/v1"
+
+// userURL returns the canonical URL of a user.
+func userURL(userID string) string {
+	return APIPrefix + "/users/" + url.PathEscape(userID)
+}
+
+// taskURL returns the canonical URL of a task.
+func taskURL(taskID string) string {
+	return APIPrefix + "/tasks/" + url.PathEscape(taskID)
+}
+
+// orgURL returns the canonical URL of an organization.
+func orgURL(orgID string) string {
+	return APIPrefix + "/orgs/" + url.PathEscape(orgID)
+}
+
+// groupURL returns the canonical URL of a group.
+func groupURL(orgID, groupID string) string {
+	return orgURL(orgID) + "/groups/" + url.PathEscape(groupID)
+}
+
+// setLocation points the Location header at a created resource. It must be
+// called before the status is written.
+func setLocation(w http.ResponseWriter, location string) {
+	w.Header().Set("Location", location)
+}
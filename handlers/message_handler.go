@@ -1,10 +1,14 @@
 package handlers
 
 import (
-	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"go-realtime-workspace/cursor"
+	"go-realtime-workspace/models"
 	"go-realtime-workspace/repository"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -12,18 +16,31 @@ import (
 
 // MessageHandler handles message history HTTP requests.
 type MessageHandler struct {
-	repo *repository.MessageRepository
+	repo     *repository.MessageRepository
+	userRepo *repository.UserRepository
+	features *repository.FeatureRepository
+
+	Usernames *UsernameResolver // Fills in usernames on reads that ask for them
+	Cursors   *cursor.Signer    // Signs the cursors of history pages
 }
 
 // NewMessageHandler creates a new message handler.
-func NewMessageHandler(repo *repository.MessageRepository) *MessageHandler {
-	return &MessageHandler{repo: repo}
+func NewMessageHandler(repo *repository.MessageRepository, userRepo *repository.UserRepository, features *repository.FeatureRepository) *MessageHandler {
+	return &MessageHandler{
+		repo:      repo,
+		userRepo:  userRepo,
+		features:  features,
+		Usernames: NewUsernameResolver(userRepo, UsernameFallbackCached, 0),
+		Cursors:   cursor.NewSigner(""),
+	}
 }
 
-// GetHistory retrieves message history for a group.
+// GetHistory retrieves message history for a group, newest first. Older
+// pages are read by passing back the cursor of the previous one.
 func (h *MessageHandler) GetHistory(w http.ResponseWriter, r *http.Request) {
 	orgID := mux.Vars(r)["orgId"]
 	groupID := mux.Vars(r)["groupId"]
+	scope := orgID + "/" + groupID
 
 	// Parse limit parameter
 	limitStr := r.URL.Query().Get("limit")
@@ -34,17 +51,36 @@ func (h *MessageHandler) GetHistory(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	messages, err := h.repo.GetHistory(r.Context(), orgID, groupID, limit)
+	kinds, ok := parseKinds(w, r)
+	if !ok {
+		return
+	}
+	channel, ok := parseChannel(w, r)
+	if !ok {
+		return
+	}
+	after, ok := parseCursor(w, r, h.Cursors, cursor.ListMessages, scope)
+	if !ok {
+		return
+	}
+
+	messages, next, err := h.repo.GetHistoryPage(r.Context(), orgID, groupID, after, limit)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	messages = repository.FilterKinds(messages, kinds)
+	messages = repository.FilterChannel(messages, channel)
+
+	// Optionally embed previews of replied-to messages
+	if r.URL.Query().Get("quotes") == "true" {
+		h.repo.ResolveQuotes(r.Context(), orgID, groupID, messages)
+	}
+	if r.URL.Query().Get("usernames") == "true" {
+		h.Usernames.Fill(r.Context(), messages)
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"messages": messages,
-		"count":    len(messages),
-	})
+	writeMessagePage(w, r, messages, setNextCursor(w, h.Cursors, cursor.ListMessages, scope, next))
 }
 
 // GetHistoryAfter retrieves messages after a specific timestamp.
@@ -55,13 +91,13 @@ func (h *MessageHandler) GetHistoryAfter(w http.ResponseWriter, r *http.Request)
 	// Parse after timestamp parameter
 	afterStr := r.URL.Query().Get("after")
 	if afterStr == "" {
-		http.Error(w, "after query parameter is required (Unix timestamp)", http.StatusBadRequest)
+		writeError(w, r, "after query parameter is required (Unix timestamp)", http.StatusBadRequest)
 		return
 	}
 
 	afterUnix, err := strconv.ParseInt(afterStr, 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid after timestamp", http.StatusBadRequest)
+		writeError(w, r, "Invalid after timestamp", http.StatusBadRequest)
 		return
 	}
 	after := time.Unix(afterUnix, 0)
@@ -75,17 +111,31 @@ func (h *MessageHandler) GetHistoryAfter(w http.ResponseWriter, r *http.Request)
 		}
 	}
 
+	kinds, ok := parseKinds(w, r)
+	if !ok {
+		return
+	}
+	channel, ok := parseChannel(w, r)
+	if !ok {
+		return
+	}
+
 	messages, err := h.repo.GetHistoryAfter(r.Context(), orgID, groupID, after, limit)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	messages = repository.FilterKinds(messages, kinds)
+	messages = repository.FilterChannel(messages, channel)
+
+	if r.URL.Query().Get("quotes") == "true" {
+		h.repo.ResolveQuotes(r.Context(), orgID, groupID, messages)
+	}
+	if r.URL.Query().Get("usernames") == "true" {
+		h.Usernames.Fill(r.Context(), messages)
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"messages": messages,
-		"count":    len(messages),
-	})
+	writeMessages(w, r, messages)
 }
 
 // GetHistoryBetween retrieves messages between two timestamps.
@@ -96,29 +146,30 @@ func (h *MessageHandler) GetHistoryBetween(w http.ResponseWriter, r *http.Reques
 	// Parse start timestamp
 	startStr := r.URL.Query().Get("start")
 	if startStr == "" {
-		http.Error(w, "start query parameter is required (Unix timestamp)", http.StatusBadRequest)
+		writeError(w, r, "start query parameter is required (Unix timestamp)", http.StatusBadRequest)
 		return
 	}
 	startUnix, err := strconv.ParseInt(startStr, 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid start timestamp", http.StatusBadRequest)
+		writeError(w, r, "Invalid start timestamp", http.StatusBadRequest)
 		return
 	}
 
 	// Parse end timestamp
 	endStr := r.URL.Query().Get("end")
 	if endStr == "" {
-		http.Error(w, "end query parameter is required (Unix timestamp)", http.StatusBadRequest)
+		writeError(w, r, "end query parameter is required (Unix timestamp)", http.StatusBadRequest)
 		return
 	}
 	endUnix, err := strconv.ParseInt(endStr, 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid end timestamp", http.StatusBadRequest)
+		writeError(w, r, "Invalid end timestamp", http.StatusBadRequest)
 		return
 	}
 
 	start := time.Unix(startUnix, 0)
-	end := time.Unix(endUnix, 0)
+	// end is inclusive and given in seconds, so cover all of its second
+	end := time.Unix(endUnix, 0).Add(time.Second - time.Nanosecond)
 
 	// Parse limit parameter
 	limitStr := r.URL.Query().Get("limit")
@@ -129,17 +180,84 @@ func (h *MessageHandler) GetHistoryBetween(w http.ResponseWriter, r *http.Reques
 		}
 	}
 
+	kinds, ok := parseKinds(w, r)
+	if !ok {
+		return
+	}
+	channel, ok := parseChannel(w, r)
+	if !ok {
+		return
+	}
+
 	messages, err := h.repo.GetHistoryBetween(r.Context(), orgID, groupID, start, end, limit)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	messages = repository.FilterKinds(messages, kinds)
+	messages = repository.FilterChannel(messages, channel)
+
+	if r.URL.Query().Get("quotes") == "true" {
+		h.repo.ResolveQuotes(r.Context(), orgID, groupID, messages)
+	}
+	if r.URL.Query().Get("usernames") == "true" {
+		h.Usernames.Fill(r.Context(), messages)
+	}
+
+	writeMessages(w, r, messages)
+}
+
+// writeMessages responds with a list of messages. Unversioned clients get
+// the original {"messages", "count"} body.
+func writeMessages(w http.ResponseWriter, r *http.Request, messages []models.ChatMessage) {
+	writeMessagePage(w, r, messages, "")
+}
+
+// writeMessagePage responds with a page of messages and the cursor of the
+// next one, if any, which unversioned clients get as next_cursor in the body.
+func writeMessagePage(w http.ResponseWriter, r *http.Request, messages []models.ChatMessage, next string) {
+	if !enveloped(r) {
+		body := map[string]interface{}{
+			"messages": messages,
+			"count":    len(messages),
+		}
+		if next != "" {
+			body["next_cursor"] = next
+		}
+		writeJSON(w, r, http.StatusOK, body, nil)
 		return
 	}
+	writeJSON(w, r, http.StatusOK, messages, &Meta{Count: len(messages), NextCursor: next})
+}
+
+// parseKinds reads the optional comma-separated kinds query parameter,
+// responding with 400 and returning false if it names an unknown kind.
+func parseKinds(w http.ResponseWriter, r *http.Request) ([]string, bool) {
+	param := r.URL.Query().Get("kinds")
+	if param == "" {
+		return nil, true
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"messages": messages,
-		"count":    len(messages),
-	})
+	kinds := strings.Split(param, ",")
+	for i, kind := range kinds {
+		kinds[i] = strings.TrimSpace(kind)
+		if !models.ValidKind(kinds[i]) {
+			writeError(w, r, "kinds must be a comma-separated list of chat, announcement, system or poll", http.StatusBadRequest)
+			return nil, false
+		}
+	}
+	return kinds, true
+}
+
+// parseChannel reads the optional channel query parameter, writing a 400
+// response and returning false if it is not a valid channel tag.
+func parseChannel(w http.ResponseWriter, r *http.Request) (string, bool) {
+	channel := r.URL.Query().Get("channel")
+	if channel != "" && !models.ValidChannel(channel) {
+		writeError(w, r, "channel must be 1-50 lowercase letters, digits, underscores or hyphens", http.StatusBadRequest)
+		return "", false
+	}
+	return channel, true
 }
 
 // GetCount retrieves the message count for a group.
@@ -149,12 +267,506 @@ func (h *MessageHandler) GetCount(w http.ResponseWriter, r *http.Request) {
 
 	count, err := h.repo.Count(r.Context(), orgID, groupID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	writeJSON(w, r, http.StatusOK, map[string]interface{}{
 		"count": count,
-	})
+	}, nil)
+}
+
+// SearchOrg searches message content across all groups in an organization.
+// The searching user must belong to the organization.
+func (h *MessageHandler) SearchOrg(w http.ResponseWriter, r *http.Request) {
+	orgID := mux.Vars(r)["orgId"]
+
+	query := r.URL.Query().Get("q")
+	if query == "" {
+		writeError(w, r, "q query parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		writeError(w, r, "user_id query parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	// Direct messages are stored under a reserved org and are never searchable here
+	if orgID == repository.DMOrgID {
+		writeError(w, r, "Organization not found", http.StatusNotFound)
+		return
+	}
+
+	user, err := h.userRepo.GetByID(r.Context(), userID)
+	if err != nil || user.OrgID != orgID {
+		writeError(w, r, "User is not a member of this organization", http.StatusForbidden)
+		return
+	}
+
+	limit := 20
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+	if limit > 100 {
+		limit = 100
+	}
+
+	messages, err := h.repo.SearchOrg(r.Context(), orgID, query, limit)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeMessages(w, r, messages)
+}
+
+// Star bookmarks a group or DM message for a user.
+func (h *MessageHandler) Star(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["userId"]
+
+	var req models.StarRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.OrgID == "" || req.GroupID == "" || req.MessageID == "" {
+		writeError(w, r, "Missing required fields: org_id, group_id, message_id", http.StatusBadRequest)
+		return
+	}
+
+	msg, err := h.repo.GetByID(r.Context(), req.OrgID, req.GroupID, req.MessageID)
+	if err != nil {
+		if errors.Is(err, repository.ErrMessageNotFound) {
+			writeError(w, r, "Message not found", http.StatusNotFound)
+			return
+		}
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Only participants may star a direct message
+	if req.OrgID == repository.DMOrgID && msg.ClientID != userID && msg.RecipientID != userID {
+		writeError(w, r, "Message not found", http.StatusNotFound)
+		return
+	}
+
+	if err := h.repo.Star(r.Context(), userID, req.OrgID, req.GroupID, req.MessageID); err != nil {
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Unstar removes a message from a user's starred messages.
+func (h *MessageHandler) Unstar(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["userId"]
+	query := r.URL.Query()
+
+	orgID, groupID, messageID := query.Get("org_id"), query.Get("group_id"), query.Get("message_id")
+	if orgID == "" || groupID == "" || messageID == "" {
+		writeError(w, r, "org_id, group_id and message_id query parameters are required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.repo.Unstar(r.Context(), userID, orgID, groupID, messageID); err != nil {
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListStarred retrieves a user's starred messages.
+func (h *MessageHandler) ListStarred(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["userId"]
+
+	limit := int64(50)
+	if l, err := strconv.ParseInt(r.URL.Query().Get("limit"), 10, 64); err == nil && l > 0 {
+		limit = l
+	}
+
+	messages, err := h.repo.ListStarred(r.Context(), userID, limit)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeMessages(w, r, messages)
+}
+
+// ListMentions retrieves a page of a user's mentions inbox.
+func (h *MessageHandler) ListMentions(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["userId"]
+	query := r.URL.Query()
+
+	limit := int64(50)
+	if l, err := strconv.ParseInt(query.Get("limit"), 10, 64); err == nil && l > 0 {
+		limit = l
+	}
+
+	var before time.Time
+	if beforeStr := query.Get("before"); beforeStr != "" {
+		var err error
+		before, err = time.Parse(time.RFC3339Nano, beforeStr)
+		if err != nil {
+			writeError(w, r, "Invalid before timestamp (expected RFC 3339)", http.StatusBadRequest)
+			return
+		}
+	}
+
+	page, err := h.repo.ListMentions(r.Context(), userID, before, limit)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, page, nil)
+}
+
+// MarkMentionsRead marks a user's mentions as read, up to the optional at
+// timestamp or now.
+func (h *MessageHandler) MarkMentionsRead(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["userId"]
+
+	at := time.Now()
+	if atStr := r.URL.Query().Get("at"); atStr != "" {
+		var err error
+		at, err = time.Parse(time.RFC3339Nano, atStr)
+		if err != nil {
+			writeError(w, r, "Invalid at timestamp (expected RFC 3339)", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := h.repo.MarkMentionsRead(r.Context(), userID, at); err != nil {
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Edit changes the content of a group message. Only its author may edit it.
+func (h *MessageHandler) Edit(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	var req models.EditMessageRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.ClientID == "" || req.Content == "" {
+		writeError(w, r, "client_id and content are required", http.StatusBadRequest)
+		return
+	}
+
+	err := h.repo.CheckWindow(r.Context(), vars["orgId"], vars["groupId"], vars["messageId"], req.ClientID, repository.WindowEdit)
+	switch {
+	case errors.Is(err, repository.ErrMessageNotFound):
+		writeError(w, r, "Message not found", http.StatusNotFound)
+		return
+	case errors.Is(err, repository.ErrEditWindowClosed):
+		writeError(w, r, err.Error(), http.StatusForbidden)
+		return
+	case err != nil:
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	msg, err := h.repo.Edit(r.Context(), vars["orgId"], vars["groupId"], vars["messageId"], req.ClientID, req.Content)
+	switch {
+	case errors.Is(err, repository.ErrMessageNotFound):
+		writeError(w, r, "Message not found", http.StatusNotFound)
+		return
+	case errors.Is(err, repository.ErrNotMessageAuthor):
+		writeError(w, r, err.Error(), http.StatusForbidden)
+		return
+	case errors.Is(err, models.ErrContentTooLarge):
+		writeError(w, r, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	case errors.Is(err, models.ErrInvalidContent):
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, msg, nil)
+}
+
+// maxBatchGetIDs caps the message IDs accepted by one batch get request.
+const maxBatchGetIDs = 100
+
+// BatchGet handles fetching several messages of a group by ID, e.g. to
+// refresh a client's cached copies. IDs that are not stored are reported
+// as missing rather than failing the request.
+func (h *MessageHandler) BatchGet(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	var req models.BatchGetMessagesRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.IDs) == 0 {
+		writeError(w, r, "ids must not be empty", http.StatusBadRequest)
+		return
+	}
+	if len(req.IDs) > maxBatchGetIDs {
+		writeError(w, r, fmt.Sprintf("at most %d ids can be fetched at once", maxBatchGetIDs), http.StatusBadRequest)
+		return
+	}
+
+	messages, missing, err := h.repo.GetByIDs(r.Context(), vars["orgId"], vars["groupId"], req.IDs)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Optionally embed previews of replied-to messages
+	if r.URL.Query().Get("quotes") == "true" {
+		h.repo.ResolveQuotes(r.Context(), vars["orgId"], vars["groupId"], messages)
+	}
+	if r.URL.Query().Get("usernames") == "true" {
+		h.Usernames.Fill(r.Context(), messages)
+	}
+
+	writeJSON(w, r, http.StatusOK, models.BatchGetMessagesResponse{Messages: messages, Missing: missing}, nil)
+}
+
+// maxImportMessages caps the messages accepted by one import request.
+const maxImportMessages = 1000
+
+// Import handles seeding a group's history with messages migrated from
+// another system, keeping their original authors and timestamps. Invalid
+// rows and rows whose ID is already stored are skipped and reported; the
+// rest are imported.
+func (h *MessageHandler) Import(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	var req models.ImportMessagesRequest
+	if err := decodeJSON(r, &req); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errBodyTooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		writeError(w, r, err.Error(), status)
+		return
+	}
+	if len(req.Messages) == 0 {
+		writeError(w, r, "messages must not be empty", http.StatusBadRequest)
+		return
+	}
+	if len(req.Messages) > maxImportMessages {
+		writeError(w, r, fmt.Sprintf("at most %d messages can be imported at once", maxImportMessages), http.StatusBadRequest)
+		return
+	}
+
+	resp := models.ImportMessagesResponse{Results: make([]models.ImportResult, len(req.Messages))}
+	now := time.Now()
+
+	// Validate each row, batching the valid ones
+	var batch []models.ChatMessage
+	var rows []int // Index in req.Messages of each batched message
+	for i, m := range req.Messages {
+		resp.Results[i] = models.ImportResult{Index: i, ID: m.ID, Status: models.ImportInvalid}
+		switch {
+		case m.ClientID == "" || m.Content == "":
+			resp.Results[i].Error = "client_id and content are required"
+		case m.Timestamp.IsZero():
+			resp.Results[i].Error = "timestamp is required"
+		case m.Timestamp.After(now):
+			resp.Results[i].Error = "timestamp must not be in the future"
+		case m.Channel != "" && !models.ValidChannel(m.Channel):
+			resp.Results[i].Error = "channel must be 1-50 lowercase letters, digits, underscores or hyphens"
+		default:
+			batch = append(batch, models.ChatMessage{
+				ID:        m.ID,
+				ClientID:  m.ClientID,
+				Username:  m.Username,
+				Content:   m.Content,
+				Timestamp: m.Timestamp,
+				ReplyToID: m.ReplyToID,
+				Channel:   m.Channel,
+			})
+			rows = append(rows, i)
+		}
+	}
+
+	if len(batch) > 0 {
+		rowErrs, err := h.repo.SaveBatch(r.Context(), vars["orgId"], vars["groupId"], batch)
+		if err != nil {
+			writeError(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for j, rowErr := range rowErrs {
+			result := &resp.Results[rows[j]]
+			result.ID = batch[j].ID
+			switch {
+			case rowErr == nil:
+				result.Status = models.ImportImported
+			case errors.Is(rowErr, repository.ErrDuplicateMessage):
+				result.Status = models.ImportDuplicate
+			default:
+				result.Error = rowErr.Error()
+			}
+		}
+	}
+
+	for _, result := range resp.Results {
+		if result.Status == models.ImportImported {
+			resp.Imported++
+		} else {
+			resp.Skipped++
+		}
+	}
+
+	writeJSON(w, r, http.StatusOK, resp, nil)
+}
+
+// AddReaction adds an emoji reaction from a user to a group message.
+func (h *MessageHandler) AddReaction(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	orgID, groupID, messageID := vars["orgId"], vars["groupId"], vars["messageId"]
+
+	var req models.ReactionRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.UserID == "" || req.Emoji == "" {
+		writeError(w, r, "user_id and emoji are required", http.StatusBadRequest)
+		return
+	}
+	if !h.features.FeatureEnabled(r.Context(), orgID, models.FeatureReactions) {
+		writeError(w, r, "Reactions are disabled for this organization", http.StatusForbidden)
+		return
+	}
+
+	if _, err := h.repo.GetByID(r.Context(), orgID, groupID, messageID); err != nil {
+		if errors.Is(err, repository.ErrMessageNotFound) {
+			writeError(w, r, "Message not found", http.StatusNotFound)
+			return
+		}
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err := h.repo.AddReaction(r.Context(), orgID, groupID, messageID, req.UserID, req.Emoji)
+	switch {
+	case errors.Is(err, repository.ErrTooManyUserReactions), errors.Is(err, repository.ErrTooManyMessageReactions):
+		writeError(w, r, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.writeReactions(w, r, orgID, groupID, messageID)
+}
+
+// RemoveReaction removes a user's emoji reaction from a group message.
+func (h *MessageHandler) RemoveReaction(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	orgID, groupID, messageID := vars["orgId"], vars["groupId"], vars["messageId"]
+
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		writeError(w, r, "user_id query parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.repo.RemoveReaction(r.Context(), orgID, groupID, messageID, userID, vars["emoji"]); err != nil {
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetReactions lists the reactions on a group message, grouped by emoji.
+func (h *MessageHandler) GetReactions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	h.writeReactions(w, r, vars["orgId"], vars["groupId"], vars["messageId"])
+}
+
+// GetAcks handles reporting who acknowledged a message sent with ack_required.
+func (h *MessageHandler) GetAcks(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	acks, err := h.repo.GetAcks(r.Context(), vars["orgId"], vars["groupId"], vars["messageId"])
+	if errors.Is(err, repository.ErrMessageNotFound) {
+		writeError(w, r, "Message not found or does not require acknowledgement", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, acks, nil)
+}
+
+// Pin handles pinning a group message. Pinned messages are kept in the
+// history past the group's message limit.
+func (h *MessageHandler) Pin(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	err := h.repo.Pin(r.Context(), vars["orgId"], vars["groupId"], vars["messageId"])
+	switch {
+	case errors.Is(err, repository.ErrMessageNotFound):
+		writeError(w, r, "Message not found", http.StatusNotFound)
+		return
+	case errors.Is(err, repository.ErrTooManyPins):
+		writeError(w, r, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Unpin handles unpinning a group message.
+func (h *MessageHandler) Unpin(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	if err := h.repo.Unpin(r.Context(), vars["orgId"], vars["groupId"], vars["messageId"]); err != nil {
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListPins retrieves a group's pinned messages.
+func (h *MessageHandler) ListPins(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	messages, err := h.repo.ListPins(r.Context(), vars["orgId"], vars["groupId"])
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeMessages(w, r, messages)
+}
+
+// writeReactions responds with the current reactions on a message.
+func (h *MessageHandler) writeReactions(w http.ResponseWriter, r *http.Request, orgID, groupID, messageID string) {
+	reactions, err := h.repo.GetReactions(r.Context(), orgID, groupID, messageID)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, map[string]interface{}{
+		"message_id": messageID,
+		"reactions":  reactions,
+	}, nil)
 }
@@ -0,0 +1,710 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"go-realtime-workspace/clock"
+	"go-realtime-workspace/config"
+	"go-realtime-workspace/hub"
+	"go-realtime-workspace/models"
+	"go-realtime-workspace/repository"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestMessageHandler returns a message handler whose message repository,
+// with the default configuration adjusted by configure if it is not nil,
+// is backed by an in-memory Redis server. Every feature is enabled.
+func newTestMessageHandler(t *testing.T, configure func(*config.Config)) (*MessageHandler, *repository.MessageRepository) {
+	t.Helper()
+	srv := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: srv.Addr()})
+	t.Cleanup(func() { client.Close() })
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	cfg := config.DefaultConfig()
+	if configure != nil {
+		configure(cfg)
+	}
+	repo := repository.NewMessageRepository(client, cfg.Redis, cfg.Message)
+	// Feature lookups fail against the empty mock, which leaves features on
+	features := repository.NewFeatureRepository(db, client, time.Minute)
+	return NewMessageHandler(repo, nil, features), repo
+}
+
+// saveMessage stores a message with the given ID in acme/general.
+func saveMessage(t *testing.T, repo *repository.MessageRepository, id, clientID, content string) {
+	t.Helper()
+	_, err := repo.Save(context.Background(), models.ChatMessage{
+		ID: id, OrgID: "acme", GroupID: "general", ClientID: clientID, Content: content,
+	})
+	if err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+}
+
+func TestAddReactionCaps(t *testing.T) {
+	h, repo := newTestMessageHandler(t, func(cfg *config.Config) {
+		cfg.Redis.MaxReactionsPerUser = 1
+		cfg.Redis.MaxReactionsPerMessage = 2
+	})
+	saveMessage(t, repo, "m1", "alice", "hello")
+
+	react := func(userID, emoji string) int {
+		body := `{"user_id": "` + userID + `", "emoji": "` + emoji + `"}`
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/orgs/acme/groups/general/messages/m1/reactions", strings.NewReader(body))
+		req = mux.SetURLVars(req, map[string]string{"orgId": "acme", "groupId": "general", "messageId": "m1"})
+		rec := httptest.NewRecorder()
+		h.AddReaction(rec, req)
+		return rec.Code
+	}
+
+	for _, tt := range []struct {
+		user, emoji string
+		want        int
+	}{
+		{"alice", "👍", http.StatusOK},
+		{"alice", "🎉", http.StatusConflict}, // Per-user cap
+		{"bob", "🎉", http.StatusOK},
+		{"carol", "🚀", http.StatusConflict}, // Per-message cap
+		{"carol", "👍", http.StatusOK},
+	} {
+		if got := react(tt.user, tt.emoji); got != tt.want {
+			t.Errorf("%s reacting %s: status %d, want %d", tt.user, tt.emoji, got, tt.want)
+		}
+	}
+}
+
+func TestSearchOrgRequiresMembership(t *testing.T) {
+	h, repo := newTestMessageHandler(t, nil)
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+	h.userRepo = repository.NewUserRepository(db, config.DefaultConfig().User)
+	saveMessage(t, repo, "m1", "alice", "deploy at noon")
+
+	now := time.Now()
+	expectUser := func(userID, orgID string) {
+		mock.ExpectQuery("FROM users WHERE id").WithArgs(userID).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "username", "email", "full_name", "avatar_url", "bio", "org_id", "role", "created_at", "updated_at"}).
+				AddRow(userID, userID, userID+"@example.com", "", "", "", orgID, models.RoleMember, now, now))
+	}
+	search := func(userID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/orgs/acme/messages/search?q=deploy&user_id="+userID, nil)
+		req = mux.SetURLVars(req, map[string]string{"orgId": "acme"})
+		rec := httptest.NewRecorder()
+		h.SearchOrg(rec, req)
+		return rec
+	}
+
+	expectUser("mallory", "globex")
+	if rec := search("mallory"); rec.Code != http.StatusForbidden {
+		t.Errorf("member of another org: status %d, want 403", rec.Code)
+	}
+
+	expectUser("bob", "acme")
+	rec := search("bob")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("member: status %d, want 200", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), `"m1"`) {
+		t.Errorf("member's results %s, want m1", rec.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHistoryFiltersByKind(t *testing.T) {
+	h, repo := newTestMessageHandler(t, nil)
+	ctx := context.Background()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, msg := range []models.ChatMessage{
+		{ID: "chat", ClientID: "alice", Content: "hello"},
+		{ID: "system", Kind: models.KindSystem, Content: "alice joined"},
+	} {
+		msg.OrgID, msg.GroupID, msg.Timestamp = "acme", "general", start.Add(time.Duration(i)*time.Second)
+		if _, err := repo.Save(ctx, msg); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+	ann := models.ChatMessage{ID: "news", OrgID: "acme", Content: "all hands", Timestamp: start.Add(time.Minute)}
+	if err := repo.SaveAnnouncement(ctx, ann, []string{"general"}); err != nil {
+		t.Fatalf("SaveAnnouncement: %v", err)
+	}
+
+	tests := []struct {
+		kinds  string
+		status int
+		want   []string
+	}{
+		{kinds: "", status: http.StatusOK, want: []string{"news", "system", "chat"}},
+		{kinds: "chat", status: http.StatusOK, want: []string{"chat"}},
+		{kinds: "chat, announcement", status: http.StatusOK, want: []string{"news", "chat"}},
+		{kinds: "chat,bogus", status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/orgs/acme/groups/general/messages?kinds="+url.QueryEscape(tt.kinds), nil)
+		req = mux.SetURLVars(req, map[string]string{"orgId": "acme", "groupId": "general"})
+		rec := httptest.NewRecorder()
+		h.GetHistory(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("kinds=%q: status %d, want %d", tt.kinds, rec.Code, tt.status)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		var body struct {
+			Messages []models.ChatMessage `json:"messages"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		var got []string
+		for _, msg := range body.Messages {
+			got = append(got, msg.ID)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("kinds=%q: got %v, want %v", tt.kinds, got, tt.want)
+		}
+	}
+}
+
+func TestHistoryFiltersByChannel(t *testing.T) {
+	h, repo := newTestMessageHandler(t, nil)
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, channel := range []string{"ops", "", "dev", "ops"} {
+		msg := models.ChatMessage{ID: fmt.Sprintf("m%d", i), OrgID: "acme", GroupID: "general", ClientID: "alice", Content: "hi", Channel: channel, Timestamp: start.Add(time.Duration(i) * time.Second)}
+		if _, err := repo.Save(context.Background(), msg); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+
+	tests := []struct {
+		channel string
+		status  int
+		want    []string
+	}{
+		{channel: "", status: http.StatusOK, want: []string{"m3", "m2", "m1", "m0"}},
+		{channel: "ops", status: http.StatusOK, want: []string{"m3", "m0"}},
+		{channel: "support", status: http.StatusOK, want: nil},
+		{channel: "Not Valid", status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/orgs/acme/groups/general/messages?channel="+url.QueryEscape(tt.channel), nil)
+		req = mux.SetURLVars(req, map[string]string{"orgId": "acme", "groupId": "general"})
+		rec := httptest.NewRecorder()
+		h.GetHistory(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("channel=%q: status %d, want %d", tt.channel, rec.Code, tt.status)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		var body struct {
+			Messages []models.ChatMessage `json:"messages"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		var got []string
+		for _, msg := range body.Messages {
+			got = append(got, msg.ID)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("channel=%q: got %v, want %v", tt.channel, got, tt.want)
+		}
+	}
+}
+
+func TestResponseEnvelope(t *testing.T) {
+	h, repo := newTestMessageHandler(t, nil)
+	saveMessage(t, repo, "m1", "alice", "one")
+	saveMessage(t, repo, "m2", "alice", "two")
+
+	serve := func(handler http.HandlerFunc, method, body, messageID string, envelope bool) (int, map[string]json.RawMessage) {
+		req := httptest.NewRequest(method, "/", strings.NewReader(body))
+		req = mux.SetURLVars(req, map[string]string{"orgId": "acme", "groupId": "general", "messageId": messageID})
+		if envelope {
+			req.Header.Set(APIVersionHeader, "2")
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		var fields map[string]json.RawMessage
+		if err := json.NewDecoder(rec.Body).Decode(&fields); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return rec.Code, fields
+	}
+	keys := func(fields map[string]json.RawMessage) []string {
+		var keys []string
+		for key := range fields {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		return keys
+	}
+
+	// A list carries its count in meta
+	_, list := serve(h.GetHistory, http.MethodGet, "", "", true)
+	if got := keys(list); !slices.Equal(got, []string{"data", "meta"}) {
+		t.Fatalf("list fields %v, want [data meta]", got)
+	}
+	var messages []models.ChatMessage
+	var meta Meta
+	json.Unmarshal(list["data"], &messages)
+	json.Unmarshal(list["meta"], &meta)
+	if len(messages) != 2 || meta.Count != 2 {
+		t.Errorf("list of %d messages with count %d, want 2 and 2", len(messages), meta.Count)
+	}
+
+	// Without the header the legacy shape is kept
+	_, legacy := serve(h.GetHistory, http.MethodGet, "", "", false)
+	if got := keys(legacy); !slices.Equal(got, []string{"count", "messages"}) {
+		t.Errorf("legacy list fields %v, want [count messages]", got)
+	}
+
+	// A single resource has no meta
+	edit := `{"client_id": "alice", "content": "edited"}`
+	_, single := serve(h.Edit, http.MethodPut, edit, "m1", true)
+	if got := keys(single); !slices.Equal(got, []string{"data"}) {
+		t.Fatalf("resource fields %v, want [data]", got)
+	}
+	var msg models.ChatMessage
+	json.Unmarshal(single["data"], &msg)
+	if msg.ID != "m1" || msg.Content != "edited" {
+		t.Errorf("resource %+v, want the edited m1", msg)
+	}
+
+	// Errors replace data
+	status, failed := serve(h.Edit, http.MethodPut, edit, "missing", true)
+	var apiErr APIError
+	json.Unmarshal(failed["error"], &apiErr)
+	if got := keys(failed); !slices.Equal(got, []string{"error"}) || apiErr.Status != status || status != http.StatusNotFound {
+		t.Errorf("error fields %v with %+v (status %d), want a 404 error", got, apiErr, status)
+	}
+}
+
+func TestImportAppearsInHistoryInOrder(t *testing.T) {
+	h, repo := newTestMessageHandler(t, nil)
+	saveMessage(t, repo, "m1", "alice", "live")
+
+	body := `{"messages": [
+		{"id": "i2", "client_id": "bob", "content": "second", "timestamp": "2020-01-01T10:05:00Z"},
+		{"id": "i1", "client_id": "alice", "content": "first", "timestamp": "2020-01-01T10:00:00Z"},
+		{"id": "i3", "client_id": "bob", "timestamp": "2020-01-01T10:10:00Z"},
+		{"id": "m1", "client_id": "alice", "content": "again", "timestamp": "2020-01-01T10:15:00Z"},
+		{"client_id": "carol", "content": "third", "timestamp": "2020-01-01T10:20:00Z"}
+	]}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/orgs/acme/groups/general/messages/import", strings.NewReader(body))
+	req.Header.Set(APIVersionHeader, "2")
+	req = mux.SetURLVars(req, map[string]string{"orgId": "acme", "groupId": "general"})
+	rec := httptest.NewRecorder()
+	h.Import(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+
+	var resp struct {
+		Data models.ImportMessagesResponse `json:"data"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Data.Imported != 3 || resp.Data.Skipped != 2 {
+		t.Errorf("imported %d, skipped %d, want 3 and 2", resp.Data.Imported, resp.Data.Skipped)
+	}
+	wantStatus := []string{models.ImportImported, models.ImportImported, models.ImportInvalid, models.ImportDuplicate, models.ImportImported}
+	for i, result := range resp.Data.Results {
+		if result.Index != i || result.Status != wantStatus[i] {
+			t.Errorf("result %d: %+v, want status %s", i, result, wantStatus[i])
+		}
+	}
+	generated := resp.Data.Results[4].ID
+	if generated == "" {
+		t.Fatal("no ID generated for the row without one")
+	}
+
+	history, err := repo.GetHistory(context.Background(), "acme", "general", 10)
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	var got []string
+	for _, msg := range history {
+		got = append(got, msg.ID)
+	}
+	// Newest first: the live message, then the import by original timestamp
+	if want := []string{"m1", generated, "i2", "i1"}; !slices.Equal(got, want) {
+		t.Errorf("history %v, want %v", got, want)
+	}
+}
+
+func TestAcksAreRecordedAndReported(t *testing.T) {
+	messages, repo := newTestMessageHandler(t, nil)
+	cfg := config.DefaultConfig()
+	o := hub.NewOrgHub(cfg.WebSocket, cfg.Message)
+	o.SetAckStore(repo)
+	group := hub.NewGroupHub(o, "acme", "general")
+	o.StartGroup(group)
+	h := NewWebSocketHandler(o, repo, nil, nil, cfg.WebSocket)
+	srv := serveJoin(t, h)
+
+	conns := make(map[string]*websocket.Conn)
+	for _, id := range []string{"bob", "carol", "dave"} {
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws/orgs/acme/groups/general?clientId="+id, nil)
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		defer conn.Close()
+		conns[id] = conn
+		for !group.HasClient(id) {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	body := `{"id": "m1", "client_id": "alice", "content": "read me", "ack_required": true}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/orgs/acme/groups/general/broadcast", strings.NewReader(body))
+	req = mux.SetURLVars(req, map[string]string{"orgId": "acme", "groupId": "general"})
+	rec := httptest.NewRecorder()
+	h.BroadcastGroup(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("broadcast: status %d: %s", rec.Code, rec.Body)
+	}
+
+	// Everyone receives it; only bob and carol acknowledge
+	for id, conn := range conns {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for {
+			var frame hub.Message
+			if err := conn.ReadJSON(&frame); err != nil {
+				t.Fatalf("%s waiting for m1: %v", id, err)
+			}
+			if frame.ID == "m1" {
+				if !frame.AckRequired {
+					t.Errorf("%s got m1 without ack_required", id)
+				}
+				break
+			}
+		}
+		if id != "dave" {
+			if err := conn.WriteJSON(map[string]string{"type": hub.TypeAck, "id": "m1"}); err != nil {
+				t.Fatalf("write ack: %v", err)
+			}
+		}
+	}
+
+	getAcks := func() models.MessageAcks {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/orgs/acme/groups/general/messages/m1/acks", nil)
+		req.Header.Set(APIVersionHeader, "2")
+		req = mux.SetURLVars(req, map[string]string{"orgId": "acme", "groupId": "general", "messageId": "m1"})
+		rec := httptest.NewRecorder()
+		messages.GetAcks(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GetAcks: status %d: %s", rec.Code, rec.Body)
+		}
+		var resp struct {
+			Data models.MessageAcks `json:"data"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp.Data
+	}
+	userIDs := func(acks []models.MessageAck) []string {
+		var ids []string
+		for _, ack := range acks {
+			ids = append(ids, ack.UserID)
+		}
+		slices.Sort(ids)
+		return ids
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	acks := getAcks()
+	for (len(acks.Acked) < 2 || len(acks.Pending) < 1) && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+		acks = getAcks()
+	}
+	if got := userIDs(acks.Acked); !slices.Equal(got, []string{"bob", "carol"}) {
+		t.Errorf("acked by %v, want [bob carol]", got)
+	}
+	if got := userIDs(acks.Pending); !slices.Equal(got, []string{"dave"}) {
+		t.Errorf("pending %v, want [dave]", got)
+	}
+	for _, ack := range acks.Acked {
+		if ack.DeliveredAt == nil || ack.AckedAt == nil {
+			t.Errorf("%s ack %+v, want delivery and ack times", ack.UserID, ack)
+		}
+	}
+}
+
+func TestBatchGetCapsIDs(t *testing.T) {
+	h, repo := newTestMessageHandler(t, nil)
+	saveMessage(t, repo, "m1", "alice", "hi")
+
+	batchGet := func(ids []string) *httptest.ResponseRecorder {
+		body, err := json.Marshal(models.BatchGetMessagesRequest{IDs: ids})
+		if err != nil {
+			t.Fatalf("marshal: %v", err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/orgs/acme/groups/general/messages/batch-get", strings.NewReader(string(body)))
+		req = mux.SetURLVars(req, map[string]string{"orgId": "acme", "groupId": "general"})
+		rec := httptest.NewRecorder()
+		h.BatchGet(rec, req)
+		return rec
+	}
+
+	ids := make([]string, maxBatchGetIDs+1)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("m%d", i+1)
+	}
+	if rec := batchGet(ids); rec.Code != http.StatusBadRequest {
+		t.Errorf("%d ids: status %d, want %d", len(ids), rec.Code, http.StatusBadRequest)
+	}
+	if rec := batchGet(nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("no ids: status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	rec := batchGet(ids[:maxBatchGetIDs])
+	if rec.Code != http.StatusOK {
+		t.Fatalf("%d ids: status %d", maxBatchGetIDs, rec.Code)
+	}
+	var resp models.BatchGetMessagesResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Messages) != 1 || resp.Messages[0].ID != "m1" || len(resp.Missing) != maxBatchGetIDs-1 {
+		t.Errorf("got %d messages and %d missing, want m1 and %d missing", len(resp.Messages), len(resp.Missing), maxBatchGetIDs-1)
+	}
+}
+
+func TestEditWindow(t *testing.T) {
+	h, repo := newTestMessageHandler(t, nil)
+	fake := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	repo.SetClock(fake)
+	repo.SetRoleLookup(fakeRoles{"root": models.RoleAdmin})
+	ctx := context.Background()
+	saveMessage(t, repo, "m1", "alice", "first")
+	saveMessage(t, repo, "m2", "root", "from an admin")
+
+	// The org allows an hour; general narrows it to a minute
+	if err := repo.SetWindows(ctx, "acme", "", models.MessageWindows{EditSeconds: 3600}); err != nil {
+		t.Fatalf("SetWindows: %v", err)
+	}
+	if err := repo.SetWindows(ctx, "acme", "general", models.MessageWindows{EditSeconds: 60}); err != nil {
+		t.Fatalf("SetWindows: %v", err)
+	}
+	edit := func(id, clientID, content string) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"client_id": %q, "content": %q}`, clientID, content)
+		req := httptest.NewRequest(http.MethodPut, "/api/v1/orgs/acme/groups/general/messages/"+id, strings.NewReader(body))
+		req = mux.SetURLVars(req, map[string]string{"orgId": "acme", "groupId": "general", "messageId": id})
+		rec := httptest.NewRecorder()
+		h.Edit(rec, req)
+		return rec
+	}
+
+	fake.Advance(30 * time.Second)
+	if rec := edit("m1", "alice", "in time"); rec.Code != http.StatusOK {
+		t.Fatalf("in-window edit: status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	fake.Advance(time.Minute)
+	rec := edit("m1", "alice", "too late")
+	if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "can no longer be edited") {
+		t.Errorf("late edit: status %d %q, want 403 with the reason", rec.Code, rec.Body.String())
+	}
+	msg, err := repo.GetByID(ctx, "acme", "general", "m1")
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if msg.Content != "in time" {
+		t.Errorf("stored content %q, want the in-window edit", msg.Content)
+	}
+
+	// Admins are exempt
+	if rec := edit("m2", "root", "admin edit"); rec.Code != http.StatusOK {
+		t.Errorf("admin edit: status %d, want 200", rec.Code)
+	}
+
+	// Clearing the group setting falls back to the org's hour
+	if err := repo.ClearWindows(ctx, "acme", "general"); err != nil {
+		t.Fatalf("ClearWindows: %v", err)
+	}
+	if rec := edit("m1", "alice", "under the org window"); rec.Code != http.StatusOK {
+		t.Errorf("edit under the org window: status %d, want 200", rec.Code)
+	}
+}
+
+func TestMentionsEndpointPages(t *testing.T) {
+	h, repo := newTestMessageHandler(t, nil)
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		_, err := repo.Save(context.Background(), models.ChatMessage{
+			ID: fmt.Sprintf("m%d", i), OrgID: "acme", GroupID: "general", ClientID: "alice",
+			Content: "ping @bob", Timestamp: start.Add(time.Duration(i) * time.Second),
+		})
+		if err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+	list := func(query string) (int, models.MentionsPage) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/users/bob/mentions?"+query, nil)
+		req = mux.SetURLVars(req, map[string]string{"userId": "bob"})
+		rec := httptest.NewRecorder()
+		h.ListMentions(rec, req)
+		var page models.MentionsPage
+		if rec.Code == http.StatusOK {
+			if err := json.NewDecoder(rec.Body).Decode(&page); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+		}
+		return rec.Code, page
+	}
+
+	// Follow next_before until the inbox is exhausted
+	var ids []string
+	query := "limit=2"
+	for pages := 0; ; pages++ {
+		if pages == 3 {
+			t.Fatal("paging did not end")
+		}
+		status, page := list(query)
+		if status != http.StatusOK {
+			t.Fatalf("status %d", status)
+		}
+		for _, mention := range page.Mentions {
+			ids = append(ids, mention.MessageID)
+		}
+		if page.NextBefore == nil {
+			break
+		}
+		query = "limit=2&before=" + url.QueryEscape(page.NextBefore.Format(time.RFC3339Nano))
+	}
+	if want := []string{"m2", "m1", "m0"}; !slices.Equal(ids, want) {
+		t.Errorf("paged through %v, want %v", ids, want)
+	}
+
+	if status, _ := list("before=yesterday"); status != http.StatusBadRequest {
+		t.Errorf("bad before: status %d, want 400", status)
+	}
+}
+
+func TestHistoryIncludesSenderAvatars(t *testing.T) {
+	const alice = "6f1c1a52-0d2f-4b7e-9a57-3c1f0f6b2a01"
+	h, repo := newTestMessageHandler(t, nil)
+	resolver, mock := newMockResolver(t, UsernameFallbackCached, time.Minute)
+	h.Usernames = resolver
+	saveMessage(t, repo, "m1", alice, "hello")
+	mock.ExpectQuery("SELECT id, username, avatar_url FROM users").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "avatar_url"}).AddRow(alice, "alice", "https://cdn.example.com/alice.png"))
+
+	for _, tt := range []struct {
+		query  string
+		avatar string
+	}{
+		{"", ""}, // Only reads that ask for it are enriched
+		{"?usernames=true", "https://cdn.example.com/alice.png"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/orgs/acme/groups/general/messages"+tt.query, nil)
+		req = mux.SetURLVars(req, map[string]string{"orgId": "acme", "groupId": "general"})
+		rec := httptest.NewRecorder()
+		h.GetHistory(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%q: status %d", tt.query, rec.Code)
+		}
+		var body struct {
+			Messages []models.ChatMessage `json:"messages"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if len(body.Messages) != 1 || body.Messages[0].AvatarURL != tt.avatar || (tt.avatar != "" && body.Messages[0].Username != "alice") {
+			t.Errorf("%q: got %+v, want avatar %q", tt.query, body.Messages, tt.avatar)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHistoryCursor(t *testing.T) {
+	h, repo := newTestMessageHandler(t, nil)
+	for i := 0; i < 5; i++ {
+		_, err := repo.Save(context.Background(), models.ChatMessage{
+			ID: fmt.Sprintf("m%d", i), OrgID: "acme", GroupID: "general", ClientID: "alice", Content: "hi",
+			Timestamp: time.Date(2025, 1, 1, 0, 0, i, 0, time.UTC),
+		})
+		if err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+	get := func(groupID, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/orgs/acme/groups/"+groupID+"/messages?limit=2&cursor="+url.QueryEscape(token), nil)
+		req = mux.SetURLVars(req, map[string]string{"orgId": "acme", "groupId": groupID})
+		rec := httptest.NewRecorder()
+		h.GetHistory(rec, req)
+		return rec
+	}
+
+	var read []string
+	token := ""
+	for {
+		rec := get("general", token)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body)
+		}
+		var body struct {
+			Messages   []models.ChatMessage `json:"messages"`
+			NextCursor string               `json:"next_cursor"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		for _, msg := range body.Messages {
+			read = append(read, msg.ID)
+		}
+		if header := rec.Header().Get(NextCursorHeader); header != body.NextCursor {
+			t.Errorf("header cursor %q, body cursor %q", header, body.NextCursor)
+		}
+		if body.NextCursor == "" {
+			break
+		}
+		token = body.NextCursor
+	}
+	if want := []string{"m4", "m3", "m2", "m1", "m0"}; !slices.Equal(read, want) {
+		t.Errorf("paged through %v, want %v", read, want)
+	}
+
+	// A cursor of another group, or an altered one, is refused
+	first := get("general", "").Header().Get(NextCursorHeader)
+	for _, tt := range []struct{ groupID, token string }{
+		{"random", first},
+		{"general", first + "x"},
+		{"general", "x" + first},
+	} {
+		if rec := get(tt.groupID, tt.token); rec.Code != http.StatusBadRequest {
+			t.Errorf("cursor %q on %s: status %d, want 400", tt.token, tt.groupID, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"go-realtime-workspace/models"
+	"go-realtime-workspace/repository"
+
+	"github.com/gorilla/mux"
+)
+
+// NotificationHandler handles notification preference HTTP requests.
+type NotificationHandler struct {
+	repo *repository.NotificationRepository
+}
+
+// NewNotificationHandler creates a new notification preferences handler.
+func NewNotificationHandler(repo *repository.NotificationRepository) *NotificationHandler {
+	return &NotificationHandler{repo: repo}
+}
+
+// GetPrefs handles retrieving a user's notification preferences. Only the
+// user themselves or the admin may read them.
+func (h *NotificationHandler) GetPrefs(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["userId"]
+	if !requireSelf(w, r, userID) {
+		return
+	}
+
+	prefs, err := h.repo.GetPrefs(r.Context(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prefs)
+}
+
+// SetPrefs handles replacing a user's notification preferences. Only the
+// user themselves or the admin may change them.
+func (h *NotificationHandler) SetPrefs(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["userId"]
+	if !requireSelf(w, r, userID) {
+		return
+	}
+
+	var req models.SetNotificationPrefsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !models.ValidNotifyLevel(req.Level) {
+		http.Error(w, "level must be one of: all, mentions, dms, none", http.StatusBadRequest)
+		return
+	}
+	for _, group := range req.MutedGroups {
+		if group.OrgID == "" || group.GroupID == "" {
+			http.Error(w, "muted_groups entries require org_id and group_id", http.StatusBadRequest)
+			return
+		}
+	}
+
+	prefs, err := h.repo.SetPrefs(r.Context(), userID, req)
+	if errors.Is(err, repository.ErrUnknownUser) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prefs)
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-realtime-workspace/repository"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+)
+
+func TestNotificationPrefsRequireSelf(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+	h := NewNotificationHandler(repository.NewNotificationRepository(db))
+
+	tests := []struct {
+		caller string
+		want   int
+	}{
+		{caller: "", want: http.StatusUnauthorized},
+		{caller: "mallory", want: http.StatusForbidden},
+		{caller: "alice", want: http.StatusOK},
+		{caller: testAdminToken, want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		if tt.want == http.StatusOK {
+			mock.ExpectQuery("FROM notification_prefs").WithArgs("alice").WillReturnError(sql.ErrNoRows)
+		}
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/users/alice/notification-prefs", nil)
+		req = mux.SetURLVars(asUser(t, req, tt.caller), map[string]string{"userId": "alice"})
+		rec := httptest.NewRecorder()
+
+		h.GetPrefs(rec, req)
+
+		if rec.Code != tt.want {
+			t.Errorf("GetPrefs as %q: status %d, want %d", tt.caller, rec.Code, tt.want)
+		}
+	}
+
+	for caller, want := range map[string]int{"": http.StatusUnauthorized, "mallory": http.StatusForbidden} {
+		req := httptest.NewRequest(http.MethodPut, "/api/v1/users/alice/notification-prefs", strings.NewReader(`{"level": "none"}`))
+		req = mux.SetURLVars(asUser(t, req, caller), map[string]string{"userId": "alice"})
+		rec := httptest.NewRecorder()
+
+		h.SetPrefs(rec, req)
+
+		if rec.Code != want {
+			t.Errorf("SetPrefs as %q: status %d, want %d", caller, rec.Code, want)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
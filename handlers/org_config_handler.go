@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"go-realtime-workspace/middleware"
+	"go-realtime-workspace/models"
+	"go-realtime-workspace/repository"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// OrgConfigHandler exports an organization's settings as a portable bundle
+// and applies such bundles, so operators can copy settings between
+// environments.
+type OrgConfigHandler struct {
+	userRepo    *repository.UserRepository
+	featureRepo *repository.FeatureRepository
+	msgRepo     *repository.MessageRepository
+}
+
+// NewOrgConfigHandler creates a new org config handler.
+func NewOrgConfigHandler(userRepo *repository.UserRepository, featureRepo *repository.FeatureRepository, msgRepo *repository.MessageRepository) *OrgConfigHandler {
+	return &OrgConfigHandler{userRepo: userRepo, featureRepo: featureRepo, msgRepo: msgRepo}
+}
+
+// Export handles exporting an organization's settings.
+func (h *OrgConfigHandler) Export(w http.ResponseWriter, r *http.Request) {
+	orgID := mux.Vars(r)["orgId"]
+
+	bundle, err := h.export(r.Context(), orgID)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", `attachment; filename="org-`+orgID+`-config.json"`)
+	writeJSON(w, r, http.StatusOK, bundle, nil)
+}
+
+// Import handles applying an exported bundle to an organization. Only
+// settings that differ are written, so importing the same bundle twice
+// changes nothing the second time. Features and users the bundle leaves out
+// keep their current settings. The settings live in different stores, so a
+// failure part way leaves the earlier ones applied; importing again
+// finishes the job.
+func (h *OrgConfigHandler) Import(w http.ResponseWriter, r *http.Request) {
+	orgID := mux.Vars(r)["orgId"]
+	ctx := r.Context()
+
+	var bundle models.OrgConfig
+	if err := decodeJSON(r, &bundle); err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := bundle.Validate(); err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	current, err := h.export(ctx, orgID)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	result := models.OrgConfigImportResult{OrgID: orgID, Changes: []models.ConfigChange{}}
+
+	// Roles first: they are the only part that can be refused
+	audit := models.AuditEntry{
+		RequestID: middleware.GetRequestID(ctx),
+		IP:        middleware.ClientIP(r),
+	}
+	changes, skipped, err := h.userRepo.ImportRoles(ctx, orgID, bundle.Roles, audit)
+	switch {
+	case errors.Is(err, repository.ErrLastOwner):
+		writeError(w, r, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	result.Changes = append(result.Changes, changes...)
+	result.SkippedUsers = skipped
+
+	features := make([]string, 0, len(bundle.Features))
+	for feature := range bundle.Features {
+		features = append(features, feature)
+	}
+	sort.Strings(features)
+	for _, feature := range features {
+		enabled := bundle.Features[feature]
+		if current.Features[feature] == enabled {
+			continue
+		}
+		if err := h.featureRepo.SetFeature(ctx, orgID, feature, enabled); err != nil {
+			writeError(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		result.Changes = append(result.Changes, models.ConfigChange{Setting: "features." + feature, From: current.Features[feature], To: enabled})
+	}
+
+	if !equalPtr(current.Quota, bundle.Quota) {
+		if bundle.Quota == nil {
+			err = h.msgRepo.ClearQuota(ctx, orgID)
+		} else {
+			err = h.msgRepo.SetQuota(ctx, orgID, *bundle.Quota)
+		}
+		if err != nil {
+			writeError(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		result.Changes = append(result.Changes, models.ConfigChange{Setting: "quota", From: current.Quota, To: bundle.Quota})
+	}
+
+	if !equalPtr(current.MessageWindows, bundle.MessageWindows) {
+		if bundle.MessageWindows == nil {
+			err = h.msgRepo.ClearWindows(ctx, orgID, "")
+		} else {
+			err = h.msgRepo.SetWindows(ctx, orgID, "", *bundle.MessageWindows)
+		}
+		if err != nil {
+			writeError(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		result.Changes = append(result.Changes, models.ConfigChange{Setting: "message_windows", From: current.MessageWindows, To: bundle.MessageWindows})
+	}
+
+	writeJSON(w, r, http.StatusOK, result, nil)
+}
+
+// export snapshots the settings of an organization.
+func (h *OrgConfigHandler) export(ctx context.Context, orgID string) (*models.OrgConfig, error) {
+	bundle := &models.OrgConfig{
+		Version:    models.OrgConfigVersion,
+		OrgID:      orgID,
+		ExportedAt: time.Now().UTC(),
+		Roles:      make(map[string]string),
+	}
+
+	features, err := h.featureRepo.Features(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	bundle.Features = features
+
+	quota, override, err := h.msgRepo.Quota(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	if override {
+		bundle.Quota = &quota
+	}
+
+	windows, scope, err := h.msgRepo.Windows(ctx, orgID, "")
+	if err != nil {
+		return nil, err
+	}
+	if scope == models.WindowScopeOrg {
+		bundle.MessageWindows = &windows
+	}
+
+	users, err := h.userRepo.GetByOrgID(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		bundle.Roles[user.Username] = user.Role
+	}
+
+	return bundle, nil
+}
+
+// equalPtr reports whether a and b are both nil or point to equal values.
+func equalPtr[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-realtime-workspace/config"
+	"go-realtime-workspace/models"
+	"go-realtime-workspace/repository"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gorilla/mux"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestOrgConfigHandler returns an org config handler for one
+// environment: users and features in a mock database, everything else in
+// an in-memory Redis server.
+func newTestOrgConfigHandler(t *testing.T) (*OrgConfigHandler, *repository.MessageRepository, sqlmock.Sqlmock) {
+	t.Helper()
+	srv := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: srv.Addr()})
+	t.Cleanup(func() { client.Close() })
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	cfg := config.DefaultConfig()
+	msgRepo := repository.NewMessageRepository(client, cfg.Redis, cfg.Message)
+	h := NewOrgConfigHandler(
+		repository.NewUserRepository(db, cfg.User),
+		repository.NewFeatureRepository(db, client, time.Minute),
+		msgRepo,
+	)
+	return h, msgRepo, mock
+}
+
+// expectRoles expects the users of acme to be read once, with the given
+// role by username.
+func expectRoles(mock sqlmock.Sqlmock, roles ...string) {
+	rows := sqlmock.NewRows([]string{"id", "username", "email", "full_name", "avatar_url", "bio", "org_id", "role", "created_at", "updated_at"})
+	for i := 0; i < len(roles); i += 2 {
+		rows.AddRow("id-"+roles[i], roles[i], roles[i]+"@example.com", "", "", "", "acme", roles[i+1], time.Time{}, time.Time{})
+	}
+	mock.ExpectQuery("FROM users WHERE org_id").WithArgs("acme").WillReturnRows(rows)
+}
+
+func exportOrgConfig(t *testing.T, h *OrgConfigHandler) models.OrgConfig {
+	t.Helper()
+	req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/v1/orgs/acme/config", nil), map[string]string{"orgId": "acme"})
+	rec := httptest.NewRecorder()
+	h.Export(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Export: status %d: %s", rec.Code, rec.Body)
+	}
+	var bundle models.OrgConfig
+	if err := json.NewDecoder(rec.Body).Decode(&bundle); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return bundle
+}
+
+func importOrgConfig(t *testing.T, h *OrgConfigHandler, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/api/v1/orgs/acme/config", strings.NewReader(body)), map[string]string{"orgId": "acme"})
+	rec := httptest.NewRecorder()
+	h.Import(rec, req)
+	return rec
+}
+
+func TestOrgConfigRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	quota := models.OrgQuota{MaxMessages: 1000, Policy: models.QuotaPolicyTrim}
+	windows := models.MessageWindows{EditSeconds: 300, DeleteSeconds: 600}
+
+	// The source environment
+	source, sourceRepo, sourceMock := newTestOrgConfigHandler(t)
+	if err := sourceRepo.SetQuota(ctx, "acme", quota); err != nil {
+		t.Fatalf("SetQuota: %v", err)
+	}
+	if err := sourceRepo.SetWindows(ctx, "acme", "", windows); err != nil {
+		t.Fatalf("SetWindows: %v", err)
+	}
+	sourceMock.ExpectQuery("FROM org_features").WithArgs("acme").
+		WillReturnRows(sqlmock.NewRows([]string{"feature", "enabled"}).AddRow(models.FeatureDM, false))
+	expectRoles(sourceMock, "alice", models.RoleOwner, "bob", models.RoleAdmin, "dave", models.RoleMember)
+	exported := exportOrgConfig(t, source)
+	data, err := json.Marshal(exported)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	// The target environment starts with the defaults; dave is not a member
+	target, _, mock := newTestOrgConfigHandler(t)
+	mock.ExpectQuery("FROM org_features").WithArgs("acme").WillReturnRows(sqlmock.NewRows([]string{"feature", "enabled"}))
+	expectRoles(mock, "alice", models.RoleOwner, "bob", models.RoleMember)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id, username, role FROM users").WithArgs("acme").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "role"}).
+			AddRow("id-alice", "alice", models.RoleOwner).
+			AddRow("id-bob", "bob", models.RoleMember))
+	mock.ExpectExec("UPDATE users SET role").WithArgs(models.RoleAdmin, "id-bob").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO audit_log").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec("INSERT INTO org_features").WithArgs("acme", models.FeatureDM, false).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	rec := importOrgConfig(t, target, string(data))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Import: status %d: %s", rec.Code, rec.Body)
+	}
+	var result models.OrgConfigImportResult
+	if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	var settings []string
+	for _, change := range result.Changes {
+		settings = append(settings, change.Setting)
+	}
+	if want := []string{"roles.bob", "features." + models.FeatureDM, "quota", "message_windows"}; strings.Join(settings, " ") != strings.Join(want, " ") {
+		t.Errorf("changed %v, want %v", settings, want)
+	}
+	if len(result.SkippedUsers) != 1 || result.SkippedUsers[0] != "dave" {
+		t.Errorf("skipped %v, want [dave]", result.SkippedUsers)
+	}
+
+	// Exporting the target gives back the same settings
+	mock.ExpectQuery("FROM org_features").WithArgs("acme").
+		WillReturnRows(sqlmock.NewRows([]string{"feature", "enabled"}).AddRow(models.FeatureDM, false))
+	expectRoles(mock, "alice", models.RoleOwner, "bob", models.RoleAdmin)
+	got := exportOrgConfig(t, target)
+	if !maps.Equal(got.Features, exported.Features) {
+		t.Errorf("features %v, want %v", got.Features, exported.Features)
+	}
+	if !equalPtr(got.Quota, exported.Quota) {
+		t.Errorf("quota %+v, want %+v", got.Quota, exported.Quota)
+	}
+	if !equalPtr(got.MessageWindows, exported.MessageWindows) {
+		t.Errorf("message windows %+v, want %+v", got.MessageWindows, exported.MessageWindows)
+	}
+	delete(exported.Roles, "dave")
+	if !maps.Equal(got.Roles, exported.Roles) {
+		t.Errorf("roles %v, want %v", got.Roles, exported.Roles)
+	}
+
+	// Importing the same bundle again changes nothing
+	expectRoles(mock, "alice", models.RoleOwner, "bob", models.RoleAdmin)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id, username, role FROM users").WithArgs("acme").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "role"}).
+			AddRow("id-alice", "alice", models.RoleOwner).
+			AddRow("id-bob", "bob", models.RoleAdmin))
+	mock.ExpectCommit()
+	rec = importOrgConfig(t, target, string(data))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("second Import: status %d: %s", rec.Code, rec.Body)
+	}
+	result = models.OrgConfigImportResult{}
+	if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(result.Changes) != 0 {
+		t.Errorf("second import changed %+v, want nothing", result.Changes)
+	}
+
+	for _, m := range []sqlmock.Sqlmock{sourceMock, mock} {
+		if err := m.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestOrgConfigImportRejectsBadBundles(t *testing.T) {
+	h, _, mock := newTestOrgConfigHandler(t)
+	for _, body := range []string{
+		`{"version": 2}`,
+		`{"version": 1, "features": {"teleport": true}}`,
+		`{"version": 1, "quota": {"max_messages": -1, "policy": "trim"}}`,
+		`{"version": 1, "message_windows": {"edit_window_seconds": -1}}`,
+		`{"version": 1, "roles": {"alice": "emperor"}}`,
+	} {
+		if rec := importOrgConfig(t, h, body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want %d", body, rec.Code, http.StatusBadRequest)
+		}
+	}
+	// Nothing was read or written
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
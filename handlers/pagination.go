@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"net/http"
+
+	"go-realtime-workspace/cursor"
+)
+
+// NextCursorHeader carries the cursor of a list's next page, for clients
+// that get bare bodies with no room for Meta.NextCursor.
+const NextCursorHeader = "X-Next-Cursor"
+
+// parseCursor reads the optional cursor query parameter of a list. It
+// responds with 400 and returns false if the cursor was not issued for this
+// list and scope, or was tampered with.
+func parseCursor(w http.ResponseWriter, r *http.Request, signer *cursor.Signer, list, scope string) (*cursor.Position, bool) {
+	token := r.URL.Query().Get("cursor")
+	if token == "" {
+		return nil, true
+	}
+	p, err := signer.Decode(token, list, scope)
+	if err != nil {
+		writeError(w, r, "Invalid cursor", http.StatusBadRequest)
+		return nil, false
+	}
+	return &p, true
+}
+
+// setNextCursor encodes where a page ended into the NextCursorHeader and
+// returns the token for Meta.NextCursor. Without a position it does
+// nothing. It must be called before the status is written.
+func setNextCursor(w http.ResponseWriter, signer *cursor.Signer, list, scope string, next *cursor.Position) string {
+	if next == nil {
+		return ""
+	}
+	token := signer.Encode(list, scope, *next)
+	w.Header().Set(NextCursorHeader, token)
+	return token
+}
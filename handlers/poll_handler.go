@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"go-realtime-workspace/hub"
+	"go-realtime-workspace/models"
+	"go-realtime-workspace/repository"
+
+	"github.com/gorilla/mux"
+)
+
+// PollHandler handles polls posted to groups and the votes cast on them.
+type PollHandler struct {
+	repo   *repository.MessageRepository
+	users  *repository.UserRepository
+	orgHub *hub.OrgHub
+}
+
+// NewPollHandler creates a new poll handler.
+func NewPollHandler(repo *repository.MessageRepository, users *repository.UserRepository, orgHub *hub.OrgHub) *PollHandler {
+	return &PollHandler{repo: repo, users: users, orgHub: orgHub}
+}
+
+// Create handles posting a poll to a group. The poll is stored as a history
+// entry of kind poll and delivered to the group like a chat message, with
+// the poll in its data.
+func (h *PollHandler) Create(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	orgID, groupID := vars["orgId"], vars["groupId"]
+
+	var req models.CreatePollRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(h.orgHub.Now()); err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	group, exists := h.orgHub.GetGroup(orgID, groupID)
+	if !exists {
+		writeError(w, r, "Group not found", http.StatusNotFound)
+		return
+	}
+	author, ok := h.member(w, r, orgID, req.ClientID)
+	if !ok {
+		return
+	}
+	if err := group.CheckPost(req.ClientID); err != nil {
+		writeError(w, r, err.Error(), http.StatusForbidden)
+		return
+	}
+	if !group.Allow() {
+		w.Header().Set("Retry-After", "1")
+		writeError(w, r, "Group message rate exceeded", http.StatusTooManyRequests)
+		return
+	}
+
+	message := hub.Message{
+		Kind:      models.KindPoll,
+		OrgID:     orgID,
+		GroupID:   groupID,
+		ClientID:  req.ClientID,
+		Content:   req.Question,
+		Timestamp: h.orgHub.Now(),
+	}
+	message.StampReceived()
+	if err := h.orgHub.ValidateMessage(&message); err != nil {
+		writeError(w, r, err.Error(), invalidMessageStatus(err))
+		return
+	}
+
+	saved, err := h.repo.CreatePoll(r.Context(), models.ChatMessage{
+		OrgID:    orgID,
+		GroupID:  groupID,
+		ClientID: req.ClientID,
+		Username: author.Username,
+		Content:  req.Question,
+		Poll: &models.Poll{
+			CreatedBy:      req.ClientID,
+			Question:       req.Question,
+			Options:        req.Options,
+			MultipleChoice: req.MultipleChoice,
+			ClosesAt:       req.ClosesAt,
+			CreatedAt:      message.Timestamp,
+		},
+	})
+	switch {
+	case errors.Is(err, repository.ErrQuotaExceeded):
+		writeError(w, r, err.Error(), http.StatusInsufficientStorage)
+		return
+	case err != nil:
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	message.ID = saved.ID
+	message.Data = saved.Poll
+	h.orgHub.BroadcastToGroup(orgID, groupID, &message)
+
+	writeJSON(w, r, http.StatusCreated, models.PollResults{
+		Poll:    *saved.Poll,
+		Tallies: make([]int, len(saved.Poll.Options)),
+	}, nil)
+}
+
+// Get handles reporting the tallies of a poll. With a user_id query
+// parameter the results include that user's vote.
+func (h *PollHandler) Get(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	results, err := h.repo.PollResults(r.Context(), vars["orgId"], vars["groupId"], vars["pollId"], r.URL.Query().Get("user_id"))
+	switch {
+	case errors.Is(err, repository.ErrPollNotFound):
+		writeError(w, r, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, results, nil)
+}
+
+// Vote handles a member voting on a poll, or changing or withdrawing their
+// vote. The group is sent the new tallies in a poll_results event.
+func (h *PollHandler) Vote(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	orgID, groupID := vars["orgId"], vars["groupId"]
+
+	var req models.VoteRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.UserID == "" {
+		writeError(w, r, "user_id is required", http.StatusBadRequest)
+		return
+	}
+	if _, ok := h.member(w, r, orgID, req.UserID); !ok {
+		return
+	}
+
+	results, err := h.repo.Vote(r.Context(), orgID, groupID, vars["pollId"], req.UserID, req.Options)
+	switch {
+	case errors.Is(err, repository.ErrPollNotFound):
+		writeError(w, r, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, repository.ErrPollClosed):
+		writeError(w, r, err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, models.ErrInvalidPoll):
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Everyone gets the tallies; only the voter gets their own choice
+	shared := *results
+	shared.Vote = nil
+	h.orgHub.BroadcastToGroup(orgID, groupID, hub.NewPollResultsEvent(&shared, h.orgHub.Now()))
+
+	writeJSON(w, r, http.StatusOK, results, nil)
+}
+
+// member looks up a user and checks that they belong to the organization,
+// responding with 403 and returning false if not.
+func (h *PollHandler) member(w http.ResponseWriter, r *http.Request, orgID, userID string) (*models.User, bool) {
+	user, err := h.users.GetByID(r.Context(), userID)
+	if err != nil || user.OrgID != orgID {
+		writeError(w, r, "User does not belong to this organization", http.StatusForbidden)
+		return nil, false
+	}
+	return user, true
+}
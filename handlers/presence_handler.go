@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"go-realtime-workspace/hub"
+	"go-realtime-workspace/models"
+	"go-realtime-workspace/repository"
+
+	"github.com/gorilla/mux"
+)
+
+// PresenceHandler handles REST presence requests for clients that cannot
+// hold a WebSocket.
+type PresenceHandler struct {
+	repo     *repository.PresenceRepository
+	userRepo *repository.UserRepository
+	orgHub   *hub.OrgHub
+}
+
+// NewPresenceHandler creates a new presence handler.
+func NewPresenceHandler(repo *repository.PresenceRepository, userRepo *repository.UserRepository, orgHub *hub.OrgHub) *PresenceHandler {
+	return &PresenceHandler{repo: repo, userRepo: userRepo, orgHub: orgHub}
+}
+
+// Heartbeat handles a keep-alive from a user, keeping them online in their
+// organization for the heartbeat grace period.
+func (h *PresenceHandler) Heartbeat(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["userId"]
+
+	user, err := h.userRepo.GetByID(r.Context(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	onlineUntil, err := h.repo.Heartbeat(r.Context(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.orgHub.Heartbeat(user.OrgID, userID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user_id":      userID,
+		"online_until": onlineUntil,
+	})
+}
+
+// Get handles reporting whether a user is online, through a WebSocket
+// connection or a recent heartbeat, and when they last sent a heartbeat.
+func (h *PresenceHandler) Get(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["userId"]
+
+	user, err := h.userRepo.GetByID(r.Context(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	beating, lastSeen, err := h.repo.Presence(r.Context(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user_id":   userID,
+		"online":    beating || h.orgHub.IsOnline(user.OrgID, userID),
+		"last_seen": lastSeen,
+	})
+}
+
+// Roster handles listing the members of a group with their roles and live
+// presence. Every user of the organization is a member of its groups; online
+// members come first, then offline ones, each ordered by username. The
+// roster is paginated with limit (default 50, at most 200) and offset.
+func (h *PresenceHandler) Roster(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	orgID := vars["orgId"]
+	groupID := vars["groupId"]
+
+	group, exists := h.orgHub.GetGroup(orgID, groupID)
+	if !exists {
+		writeError(w, r, "Group not found", http.StatusNotFound)
+		return
+	}
+
+	limit, offset := 50, 0
+	query := r.URL.Query()
+	if limitStr := query.Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+			limit = l
+		}
+	}
+	if limit > 200 {
+		limit = 200
+	}
+	if offsetStr := query.Get("offset"); offsetStr != "" {
+		if o, err := strconv.Atoi(offsetStr); err == nil && o > 0 {
+			offset = o
+		}
+	}
+
+	statuses := h.orgHub.OnlineStatuses(orgID)
+	onlineIDs := make([]string, 0, len(statuses))
+	for userID := range statuses {
+		onlineIDs = append(onlineIDs, userID)
+	}
+
+	users, err := h.userRepo.GetRoster(r.Context(), orgID, onlineIDs, limit, offset)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	members := make([]models.RosterMember, 0, len(users))
+	for _, user := range users {
+		status, online := statuses[user.ID]
+		members = append(members, models.RosterMember{
+			UserID:    user.ID,
+			Username:  user.Username,
+			FullName:  user.FullName,
+			AvatarURL: user.AvatarURL,
+			Role:      user.Role,
+			Online:    online,
+			Status:    status,
+			Connected: group.HasClient(user.ID),
+		})
+	}
+
+	writeJSON(w, r, http.StatusOK, members, &Meta{Count: len(members), Limit: limit, Offset: offset})
+}
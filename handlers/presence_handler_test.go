@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"go-realtime-workspace/config"
+	"go-realtime-workspace/models"
+	"go-realtime-workspace/repository"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+// userIDSet matches a Postgres array argument holding exactly its IDs, in
+// any order.
+type userIDSet []string
+
+func (s userIDSet) Match(v driver.Value) bool {
+	array, ok := v.(string)
+	if !ok {
+		return false
+	}
+	got := strings.Split(strings.Trim(array, "{}"), ",")
+	for i := range got {
+		got[i] = strings.Trim(got[i], `"`)
+	}
+	want := slices.Clone(s)
+	slices.Sort(got)
+	slices.Sort(want)
+	return slices.Equal(got, want)
+}
+
+func TestRosterSortsOnlineMembersFirst(t *testing.T) {
+	h := newJoinHandler(t, false, nil)
+	o := h.OrgHub
+	srv := serveJoin(t, h)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws/orgs/acme/groups/general?clientId=zed", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	o.Heartbeat("acme", "bob") // Online without a connection to the group
+	for !o.IsOnline("acme", "zed") {
+		time.Sleep(time.Millisecond)
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+	now := time.Now()
+	// Postgres orders the online users ahead of the alphabetically earlier
+	// offline ones
+	mock.ExpectQuery(`ORDER BY id = ANY\(\$2\) DESC, username ASC`).
+		WithArgs("acme", userIDSet{"bob", "zed"}, 50, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "email", "full_name", "avatar_url", "bio", "org_id", "role", "created_at", "updated_at"}).
+			AddRow("bob", "bob", "bob@acme.com", "", "", "", "acme", models.RoleMember, now, now).
+			AddRow("zed", "zed", "zed@acme.com", "", "", "", "acme", models.RoleAdmin, now, now).
+			AddRow("alice", "alice", "alice@acme.com", "", "", "", "acme", models.RoleOwner, now, now))
+
+	cfg := config.DefaultConfig()
+	presence := NewPresenceHandler(nil, repository.NewUserRepository(db, cfg.User), o)
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/orgs/acme/groups/general/members", nil)
+	req.Header.Set(APIVersionHeader, "2")
+	req = mux.SetURLVars(req, map[string]string{"orgId": "acme", "groupId": "general"})
+	rec := httptest.NewRecorder()
+	presence.Roster(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+
+	var resp struct {
+		Data []models.RosterMember `json:"data"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	want := []struct {
+		id                string
+		online, connected bool
+	}{
+		{"bob", true, false},
+		{"zed", true, true},
+		{"alice", false, false},
+	}
+	if len(resp.Data) != len(want) {
+		t.Fatalf("got %d members, want %d", len(resp.Data), len(want))
+	}
+	for i, w := range want {
+		got := resp.Data[i]
+		if got.UserID != w.id || got.Online != w.online || got.Connected != w.connected {
+			t.Errorf("member %d: %+v, want %s online=%v connected=%v", i, got, w.id, w.online, w.connected)
+		}
+	}
+	if resp.Data[0].Status == "" || resp.Data[2].Status != "" {
+		t.Error("status should be set exactly for online members")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"go-realtime-workspace/models"
+	"go-realtime-workspace/repository"
+
+	"github.com/gorilla/mux"
+)
+
+// QuotaHandler handles per-organization storage quota HTTP requests.
+type QuotaHandler struct {
+	repo *repository.MessageRepository
+}
+
+// NewQuotaHandler creates a new quota handler.
+func NewQuotaHandler(repo *repository.MessageRepository) *QuotaHandler {
+	return &QuotaHandler{repo: repo}
+}
+
+// Get handles reporting an organization's storage usage against its quota.
+func (h *QuotaHandler) Get(w http.ResponseWriter, r *http.Request) {
+	h.writeUsage(w, r, mux.Vars(r)["orgId"])
+}
+
+// Set handles overriding the storage quota of an organization.
+func (h *QuotaHandler) Set(w http.ResponseWriter, r *http.Request) {
+	orgID := mux.Vars(r)["orgId"]
+
+	var quota models.OrgQuota
+	if err := json.NewDecoder(r.Body).Decode(&quota); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if quota.MaxMessages < 0 || quota.MaxBytes < 0 {
+		http.Error(w, "max_messages and max_bytes must not be negative", http.StatusBadRequest)
+		return
+	}
+	if !models.ValidQuotaPolicy(quota.Policy) {
+		http.Error(w, `policy must be "reject" or "trim"`, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.repo.SetQuota(r.Context(), orgID, quota); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.writeUsage(w, r, orgID)
+}
+
+// Clear handles removing an organization's quota override.
+func (h *QuotaHandler) Clear(w http.ResponseWriter, r *http.Request) {
+	orgID := mux.Vars(r)["orgId"]
+
+	if err := h.repo.ClearQuota(r.Context(), orgID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.writeUsage(w, r, orgID)
+}
+
+// writeUsage responds with an organization's usage and quota.
+func (h *QuotaHandler) writeUsage(w http.ResponseWriter, r *http.Request, orgID string) {
+	usage, err := h.repo.QuotaUsage(r.Context(), orgID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(usage)
+}
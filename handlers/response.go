@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// APIVersionHeader selects the response format. Clients that send version 2
+// get responses wrapped in an APIResponse envelope; all others get the
+// original bare bodies, so existing clients keep working.
+const APIVersionHeader = "X-API-Version"
+
+// APIResponse is the standard response envelope of API version 2.
+type APIResponse struct {
+	Data  interface{} `json:"data,omitempty"`  // The requested resource or list
+	Meta  *Meta       `json:"meta,omitempty"`  // Counts and pagination, for lists
+	Error *APIError   `json:"error,omitempty"` // Set instead of Data when the request failed
+}
+
+// Meta describes a list response.
+type Meta struct {
+	Count  int `json:"count"`            // Items in this response
+	Limit  int `json:"limit,omitempty"`  // Page size, for paginated lists
+	Offset int `json:"offset,omitempty"` // Items skipped, for paginated lists
+
+	NextCursor string `json:"next_cursor,omitempty"` // Cursor of the next page, for lists paged with cursors
+}
+
+// APIError describes why a request failed.
+type APIError struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+// enveloped reports whether the client asked for the version 2 envelope.
+func enveloped(r *http.Request) bool {
+	return r.Header.Get(APIVersionHeader) == "2"
+}
+
+// writeJSON responds with data, wrapped with meta in an APIResponse when
+// the client asked for the envelope and bare otherwise.
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, data interface{}, meta *Meta) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if enveloped(r) {
+		json.NewEncoder(w).Encode(APIResponse{Data: data, Meta: meta})
+		return
+	}
+	json.NewEncoder(w).Encode(data)
+}
+
+// writeError responds with an error, as an APIResponse when the client asked
+// for the envelope and as plain text (like http.Error) otherwise.
+func writeError(w http.ResponseWriter, r *http.Request, message string, status int) {
+	if !enveloped(r) {
+		http.Error(w, message, status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(APIResponse{Error: &APIError{Status: status, Message: message}})
+}
@@ -1,8 +1,9 @@
 package handlers
 
 import (
-	"encoding/json"
+	"errors"
 	"net/http"
+	"go-realtime-workspace/cursor"
 	"go-realtime-workspace/models"
 	"go-realtime-workspace/repository"
 	"strconv"
@@ -13,12 +14,20 @@ import (
 
 // TaskHandler handles task-related HTTP requests.
 type TaskHandler struct {
-	repo *repository.TaskRepository
+	repo  *repository.TaskRepository
+	users roleLookup
+
+	Cursors *cursor.Signer // Signs the cursors of org task pages
 }
 
-// NewTaskHandler creates a new task handler.
-func NewTaskHandler(repo *repository.TaskRepository) *TaskHandler {
-	return &TaskHandler{repo: repo}
+// orgTaskViewers are the organization roles that may list every task of
+// the organization.
+var orgTaskViewers = []string{models.RoleOwner, models.RoleAdmin, models.RoleManager}
+
+// NewTaskHandler creates a new task handler. Organization task lists are
+// limited to the users whose roles, looked up in users, are orgTaskViewers.
+func NewTaskHandler(repo *repository.TaskRepository, users roleLookup) *TaskHandler {
+	return &TaskHandler{repo: repo, users: users, Cursors: cursor.NewSigner("")}
 }
 
 // Create handles task creation.
@@ -26,13 +35,13 @@ func (h *TaskHandler) Create(w http.ResponseWriter, r *http.Request) {
 	userID := mux.Vars(r)["userId"]
 
 	var req models.CreateTaskRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	if req.Title == "" {
-		http.Error(w, "Missing required field: title", http.StatusBadRequest)
+		writeError(w, r, "Missing required field: title", http.StatusBadRequest)
 		return
 	}
 
@@ -43,13 +52,12 @@ func (h *TaskHandler) Create(w http.ResponseWriter, r *http.Request) {
 
 	task, err := h.repo.Create(r.Context(), userID, req)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(task)
+	setLocation(w, taskURL(task.ID))
+	writeJSON(w, r, http.StatusCreated, task, nil)
 }
 
 // GetByID handles retrieving a task by ID.
@@ -58,27 +66,136 @@ func (h *TaskHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 
 	task, err := h.repo.GetByID(r.Context(), id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		writeError(w, r, err.Error(), http.StatusNotFound)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(task)
+	writeJSON(w, r, http.StatusOK, task, nil)
 }
 
 // GetByUser handles retrieving all tasks for a user.
 func (h *TaskHandler) GetByUser(w http.ResponseWriter, r *http.Request) {
 	userID := mux.Vars(r)["userId"]
 	status := r.URL.Query().Get("status")
+	search := r.URL.Query().Get("search")
+	sort := r.URL.Query().Get("sort")
+	if sort != "" && sort != models.TaskSortNewest && sort != models.TaskSortManual {
+		writeError(w, r, "Invalid sort (expected newest or manual)", http.StatusBadRequest)
+		return
+	}
 
-	tasks, err := h.repo.GetByUserID(r.Context(), userID, status)
+	tasks, err := h.repo.GetByUserID(r.Context(), userID, status, search, sort)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(tasks)
+	writeJSON(w, r, http.StatusOK, tasks, &Meta{Count: len(tasks)})
+}
+
+// Reorder handles setting the manual order of a user's tasks. It responds
+// with all of the user's tasks in the new order.
+func (h *TaskHandler) Reorder(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["userId"]
+
+	var req models.ReorderTasksRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.TaskIDs) == 0 {
+		writeError(w, r, "Missing required field: task_ids", http.StatusBadRequest)
+		return
+	}
+
+	tasks, err := h.repo.Reorder(r.Context(), userID, req.TaskIDs)
+	if errors.Is(err, repository.ErrInvalidTaskOrder) {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, tasks, &Meta{Count: len(tasks)})
+}
+
+// GetByOrg handles retrieving tasks across all users in an organization.
+// The caller must be an owner, admin or manager of the organization, or use
+// the admin token.
+func (h *TaskHandler) GetByOrg(w http.ResponseWriter, r *http.Request) {
+	orgID := mux.Vars(r)["orgId"]
+	if _, ok := requireOrgRole(w, r, h.users, orgID, orgTaskViewers...); !ok {
+		return
+	}
+	query := r.URL.Query()
+
+	filter := models.TaskFilter{
+		Status:     query.Get("status"),
+		AssigneeID: query.Get("assignee"),
+		Priority:   query.Get("priority"),
+		Search:     query.Get("search"),
+		Limit:      50,
+	}
+
+	// Parse due date range (RFC 3339)
+	if afterStr := query.Get("due_after"); afterStr != "" {
+		after, err := time.Parse(time.RFC3339, afterStr)
+		if err != nil {
+			writeError(w, r, "Invalid due_after timestamp (expected RFC 3339)", http.StatusBadRequest)
+			return
+		}
+		filter.DueAfter = &after
+	}
+	if beforeStr := query.Get("due_before"); beforeStr != "" {
+		before, err := time.Parse(time.RFC3339, beforeStr)
+		if err != nil {
+			writeError(w, r, "Invalid due_before timestamp (expected RFC 3339)", http.StatusBadRequest)
+			return
+		}
+		filter.DueBefore = &before
+	}
+
+	// Parse pagination parameters
+	if limitStr := query.Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+			filter.Limit = l
+		}
+	}
+	if filter.Limit > 200 {
+		filter.Limit = 200
+	}
+	if offsetStr := query.Get("offset"); offsetStr != "" {
+		if o, err := strconv.Atoi(offsetStr); err == nil && o > 0 {
+			filter.Offset = o
+		}
+	}
+	after, ok := parseCursor(w, r, h.Cursors, cursor.ListTasks, orgID)
+	if !ok {
+		return
+	}
+	if after != nil && (filter.Search != "" || filter.Offset > 0) {
+		writeError(w, r, "cursor cannot be combined with search or offset", http.StatusBadRequest)
+		return
+	}
+	filter.After = after
+
+	tasks, err := h.repo.GetByOrgID(r.Context(), orgID, filter)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Search results are ranked by relevance, which a cursor cannot resume
+	var next *cursor.Position
+	if filter.Search == "" && len(tasks) == filter.Limit {
+		last := tasks[len(tasks)-1]
+		next = &cursor.Position{Time: last.CreatedAt, ID: last.ID}
+	}
+	token := setNextCursor(w, h.Cursors, cursor.ListTasks, orgID, next)
+
+	writeJSON(w, r, http.StatusOK, tasks, &Meta{Count: len(tasks), Limit: filter.Limit, Offset: filter.Offset, NextCursor: token})
 }
 
 // GetDueSoon handles retrieving tasks that are due soon.
@@ -96,32 +213,42 @@ func (h *TaskHandler) GetDueSoon(w http.ResponseWriter, r *http.Request) {
 
 	tasks, err := h.repo.GetDueSoon(r.Context(), userID, time.Duration(hours)*time.Hour)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(tasks)
+	writeJSON(w, r, http.StatusOK, tasks, &Meta{Count: len(tasks)})
 }
 
-// Update handles task updates.
+// Update handles partial task updates: only the fields in the body change.
 func (h *TaskHandler) Update(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"]
 
 	var req models.UpdateTaskRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Title != nil && *req.Title == "" {
+		writeError(w, r, "title must not be empty", http.StatusBadRequest)
+		return
+	}
+	if req.Status != nil && !models.ValidTaskStatus(*req.Status) {
+		writeError(w, r, "status must be pending, in_progress, completed or cancelled", http.StatusBadRequest)
+		return
+	}
+	if req.Priority != nil && !models.ValidTaskPriority(*req.Priority) {
+		writeError(w, r, "priority must be low, medium, high or urgent", http.StatusBadRequest)
 		return
 	}
 
 	task, err := h.repo.Update(r.Context(), id, req)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(task)
+	writeJSON(w, r, http.StatusOK, task, nil)
 }
 
 // Delete handles task deletion.
@@ -129,7 +256,7 @@ func (h *TaskHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"]
 
 	if err := h.repo.Delete(r.Context(), id); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"go-realtime-workspace/models"
+	"go-realtime-workspace/repository"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+)
+
+func TestOrgTasksRequireRole(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+	h := NewTaskHandler(repository.NewTaskRepository(db), fakeRoles{"manager": "manager", "member": "member"})
+
+	tests := []struct {
+		caller string
+		want   int
+	}{
+		{caller: "", want: http.StatusUnauthorized},
+		{caller: "member", want: http.StatusForbidden},
+		{caller: "outsider", want: http.StatusForbidden},
+		{caller: "manager", want: http.StatusOK},
+		{caller: testAdminToken, want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		if tt.want == http.StatusOK {
+			mock.ExpectQuery("FROM tasks t").WithArgs("acme", 50, 0).WillReturnRows(sqlmock.NewRows(nil))
+		}
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/orgs/acme/tasks", nil)
+		req = mux.SetURLVars(asUser(t, req, tt.caller), map[string]string{"orgId": "acme"})
+		rec := httptest.NewRecorder()
+
+		h.GetByOrg(rec, req)
+
+		if rec.Code != tt.want {
+			t.Errorf("as %q: status %d, want %d", tt.caller, rec.Code, tt.want)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOrgTasksPagination(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+	h := NewTaskHandler(repository.NewTaskRepository(db), fakeRoles{})
+
+	tests := []struct {
+		query string
+		args  []driver.Value
+	}{
+		{query: "status=pending&priority=high&limit=10&offset=20", args: []driver.Value{"acme", "pending", "high", 10, 20}},
+		{query: "limit=500", args: []driver.Value{"acme", 200, 0}},
+		{query: "limit=-1&offset=-5", args: []driver.Value{"acme", 50, 0}},
+	}
+	for _, tt := range tests {
+		mock.ExpectQuery("FROM tasks t").WithArgs(tt.args...).WillReturnRows(sqlmock.NewRows(nil))
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/orgs/acme/tasks?"+tt.query, nil)
+		req = mux.SetURLVars(asUser(t, req, testAdminToken), map[string]string{"orgId": "acme"})
+		rec := httptest.NewRecorder()
+
+		h.GetByOrg(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("?%s: status %d, want 200", tt.query, rec.Code)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUpdateTaskPatchSemantics(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+	h := NewTaskHandler(repository.NewTaskRepository(db), fakeRoles{})
+	columns := []string{"id", "user_id", "title", "description", "status", "priority", "due_date", "position", "created_at", "updated_at", "completed_at"}
+	now := time.Now()
+	due := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		body string
+		set  string // Expected SET clause before updated_at
+		args []driver.Value
+	}{
+		{"clear description", `{"description": ""}`, "description = $1", []driver.Value{""}},
+		{"unset due date", `{"due_date": null}`, "due_date = $1", []driver.Value{nil}},
+		{"set due date", `{"due_date": "2025-06-01T00:00:00Z"}`, "due_date = $1", []driver.Value{due}},
+		{"omitted fields unchanged", `{"title": "Renamed"}`, "title = $1", []driver.Value{"Renamed"}},
+		{"nothing set", `{}`, "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := "updated_at = CURRENT_TIMESTAMP"
+			if tt.set != "" {
+				set = tt.set + ", " + set
+			}
+			args := append(tt.args, "task-1")
+			mock.ExpectQuery(`UPDATE tasks\s+SET ` + regexp.QuoteMeta(set) + fmt.Sprintf(`\s+WHERE id = \$%d`, len(args))).
+				WithArgs(args...).
+				WillReturnRows(sqlmock.NewRows(columns).
+					AddRow("task-1", "alice", "Renamed", "", models.TaskStatusPending, "medium", nil, 1024.0, now, now, nil))
+
+			req := httptest.NewRequest(http.MethodPatch, "/api/v1/tasks/task-1", strings.NewReader(tt.body))
+			req = mux.SetURLVars(req, map[string]string{"id": "task-1"})
+			rec := httptest.NewRecorder()
+			h.Update(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+
+	// A title cannot be cleared
+	req := httptest.NewRequest(http.MethodPatch, "/api/v1/tasks/task-1", strings.NewReader(`{"title": ""}`))
+	req = mux.SetURLVars(req, map[string]string{"id": "task-1"})
+	rec := httptest.NewRecorder()
+	h.Update(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("empty title: status %d, want 400", rec.Code)
+	}
+}
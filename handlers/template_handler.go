@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"go-realtime-workspace/hub"
+	"go-realtime-workspace/models"
+	"go-realtime-workspace/repository"
+
+	"github.com/gorilla/mux"
+)
+
+// TemplateHandler handles canned message template HTTP requests.
+type TemplateHandler struct {
+	repo     *repository.TemplateRepository
+	users    roleLookup
+	orgHub   *hub.OrgHub
+	features *repository.FeatureRepository
+}
+
+// templateManagers are the organization roles that may manage templates.
+var templateManagers = []string{models.RoleOwner, models.RoleAdmin, models.RoleManager}
+
+// NewTemplateHandler creates a new template handler. Templates are managed
+// by the users whose roles, looked up in users, are templateManagers, and
+// rendered templates are sent through orgHub.
+func NewTemplateHandler(repo *repository.TemplateRepository, users roleLookup, orgHub *hub.OrgHub, features *repository.FeatureRepository) *TemplateHandler {
+	return &TemplateHandler{repo: repo, users: users, orgHub: orgHub, features: features}
+}
+
+// List handles listing an organization's templates.
+func (h *TemplateHandler) List(w http.ResponseWriter, r *http.Request) {
+	templates, err := h.repo.List(r.Context(), mux.Vars(r)["orgId"])
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, templates, nil)
+}
+
+// Get handles retrieving a template by key.
+func (h *TemplateHandler) Get(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	template, err := h.repo.Get(r.Context(), vars["orgId"], vars["key"])
+	if errors.Is(err, repository.ErrTemplateNotFound) {
+		writeError(w, r, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, template, nil)
+}
+
+// Create handles creating a template. The caller must be an owner, admin or
+// manager of the organization, or use the admin token.
+func (h *TemplateHandler) Create(w http.ResponseWriter, r *http.Request) {
+	orgID := mux.Vars(r)["orgId"]
+
+	actorID, ok := requireOrgRole(w, r, h.users, orgID, templateManagers...)
+	if !ok {
+		return
+	}
+	req, ok := h.decodeTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	template, err := h.repo.Create(r.Context(), orgID, actorID, req)
+	if errors.Is(err, repository.ErrTemplateExists) {
+		writeError(w, r, err.Error(), http.StatusConflict)
+		return
+	}
+	if !h.checkSaveError(w, r, err) {
+		return
+	}
+
+	setLocation(w, orgURL(orgID)+"/templates/"+template.Key)
+	writeJSON(w, r, http.StatusCreated, template, nil)
+}
+
+// Update handles replacing a template's title, body and variables, for the
+// same callers as Create.
+func (h *TemplateHandler) Update(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	if _, ok := requireOrgRole(w, r, h.users, vars["orgId"], templateManagers...); !ok {
+		return
+	}
+	req, ok := h.decodeTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	template, err := h.repo.Update(r.Context(), vars["orgId"], req)
+	if !h.checkSaveError(w, r, err) {
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, template, nil)
+}
+
+// Delete handles removing a template, for the same callers as Create.
+func (h *TemplateHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	if _, ok := requireOrgRole(w, r, h.users, vars["orgId"], templateManagers...); !ok {
+		return
+	}
+
+	err := h.repo.Delete(r.Context(), vars["orgId"], vars["key"])
+	if !h.checkSaveError(w, r, err) {
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeTemplate decodes and validates a create or update request. The key
+// in the path, when present, overrides the body.
+func (h *TemplateHandler) decodeTemplate(w http.ResponseWriter, r *http.Request) (models.SaveTemplateRequest, bool) {
+	var req models.SaveTemplateRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return req, false
+	}
+	if key := mux.Vars(r)["key"]; key != "" {
+		req.Key = key
+	}
+	if err := req.Validate(); err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return req, false
+	}
+	return req, true
+}
+
+// checkSaveError responds to an error from a template change and reports
+// whether the handler may continue.
+func (h *TemplateHandler) checkSaveError(w http.ResponseWriter, r *http.Request, err error) bool {
+	switch {
+	case errors.Is(err, repository.ErrTemplateNotFound):
+		writeError(w, r, err.Error(), http.StatusNotFound)
+		return false
+	case err != nil:
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// Send handles rendering a template with the supplied variables and sending
+// the result to a group or as a direct message, through OrgHub.Publish.
+// It is sent by the caller; with the admin token, by the body's client_id,
+// or without one by the system bot, which is not held to the group's rate
+// limit or freeze.
+func (h *TemplateHandler) Send(w http.ResponseWriter, r *http.Request) {
+	orgID := mux.Vars(r)["orgId"]
+
+	var req models.SendTemplateRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	senderID, ok := requireActor(w, r, req.ClientID)
+	if !ok {
+		return
+	}
+	req.ClientID = senderID
+	if req.TemplateKey == "" {
+		writeError(w, r, "template_key is required", http.StatusBadRequest)
+		return
+	}
+	if (req.GroupID == "") == (req.RecipientID == "") {
+		writeError(w, r, "Exactly one of group_id and recipient_id is required", http.StatusBadRequest)
+		return
+	}
+
+	template, err := h.repo.Get(r.Context(), orgID, req.TemplateKey)
+	if errors.Is(err, repository.ErrTemplateNotFound) {
+		writeError(w, r, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	content, err := template.Render(req.Variables)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	message := &hub.Message{ClientID: req.ClientID, Content: content}
+	if !assignAuthor(w, r, message) {
+		return
+	}
+	if req.RecipientID != "" {
+		if h.features != nil && !h.features.FeatureEnabled(r.Context(), orgID, models.FeatureDM) {
+			writeError(w, r, "Direct messages are disabled for this organization", http.StatusForbidden)
+			return
+		}
+		message.RecipientID = req.RecipientID
+	} else {
+		group, exists := h.orgHub.GetGroup(orgID, req.GroupID)
+		if !exists {
+			writeError(w, r, "Organization or group not found", http.StatusNotFound)
+			return
+		}
+		if err := group.CheckPost(message.ClientID); err != nil {
+			writeError(w, r, err.Error(), http.StatusForbidden)
+			return
+		}
+		if !message.Bot && !group.Allow() {
+			w.Header().Set("Retry-After", "1")
+			writeError(w, r, "Group message rate exceeded", http.StatusTooManyRequests)
+			return
+		}
+		message.OrgID, message.GroupID = orgID, req.GroupID
+	}
+
+	delivery, err := h.orgHub.Publish(message)
+	switch {
+	case errors.Is(err, hub.ErrTargetNotFound):
+		writeError(w, r, "Organization or group not found", http.StatusNotFound)
+		return
+	case errors.Is(err, models.ErrContentTooLarge):
+		writeError(w, r, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	case errors.Is(err, repository.ErrQuotaExceeded):
+		writeError(w, r, err.Error(), http.StatusInsufficientStorage)
+		return
+	case err != nil:
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, map[string]interface{}{
+		"id":       message.ID,
+		"content":  message.Content,
+		"delivery": delivery,
+	}, nil)
+}
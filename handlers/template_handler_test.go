@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-realtime-workspace/config"
+	"go-realtime-workspace/hub"
+	"go-realtime-workspace/models"
+	"go-realtime-workspace/repository"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+)
+
+func TestTemplateManagementRequiresManager(t *testing.T) {
+	h := NewTemplateHandler(nil, fakeRoles{"member": "member"}, nil, nil)
+	body := `{"key": "refund", "title": "Refund", "body": "Hi"}`
+
+	routes := map[string]func(http.ResponseWriter, *http.Request){
+		"create": h.Create,
+		"update": h.Update,
+		"delete": h.Delete,
+	}
+	for name, handle := range routes {
+		for caller, want := range map[string]int{"": http.StatusUnauthorized, "member": http.StatusForbidden} {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/orgs/acme/templates", strings.NewReader(body))
+			req = mux.SetURLVars(asUser(t, req, caller), map[string]string{"orgId": "acme", "key": "refund"})
+			rec := httptest.NewRecorder()
+
+			handle(rec, req)
+
+			if rec.Code != want {
+				t.Errorf("%s as %q: status %d, want %d", name, caller, rec.Code, want)
+			}
+		}
+	}
+}
+
+func TestSendTemplateAsSomeoneElse(t *testing.T) {
+	h := NewTemplateHandler(nil, fakeRoles{}, nil, nil)
+	body := `{"template_key": "refund", "group_id": "general", "client_id": "alice"}`
+
+	for caller, want := range map[string]int{"": http.StatusUnauthorized, "bob": http.StatusForbidden} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/orgs/acme/messages/from-template", strings.NewReader(body))
+		req = mux.SetURLVars(asUser(t, req, caller), map[string]string{"orgId": "acme"})
+		rec := httptest.NewRecorder()
+
+		h.Send(rec, req)
+
+		if rec.Code != want {
+			t.Errorf("caller %q: status %d, want %d", caller, rec.Code, want)
+		}
+	}
+}
+
+func TestSendTemplateAsTheBot(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+	cfg := config.DefaultConfig()
+	o := hub.NewOrgHub(cfg.WebSocket, cfg.Message)
+	o.SetRoleLookup(fakeRoles{"bob": models.RoleMember})
+	group := hub.NewGroupHub(o, "acme", "general")
+	o.StartGroup(group)
+	group.SetFrozen(true)
+	h := NewTemplateHandler(repository.NewTemplateRepository(db), fakeRoles{}, o, nil)
+
+	for _, tt := range []struct {
+		name     string
+		caller   string
+		clientID string
+		want     int
+	}{
+		{"member to the frozen group", "bob", "", http.StatusForbidden},
+		{"admin naming the bot", testAdminToken, models.SystemUserID, http.StatusBadRequest},
+		{"admin without client_id", testAdminToken, "", http.StatusOK},
+	} {
+		now := time.Now()
+		mock.ExpectQuery("FROM message_templates WHERE org_id").WithArgs("acme", "notice").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "org_id", "key", "title", "body", "variables", "created_by", "created_at", "updated_at"}).
+				AddRow("t1", "acme", "notice", "Notice", "Maintenance tonight", []byte("[]"), "", now, now))
+
+		body := `{"template_key": "notice", "group_id": "general", "client_id": "` + tt.clientID + `"}`
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/orgs/acme/messages/from-template", strings.NewReader(body))
+		req = mux.SetURLVars(asUser(t, req, tt.caller), map[string]string{"orgId": "acme"})
+		rec := httptest.NewRecorder()
+
+		h.Send(rec, req)
+
+		if rec.Code != tt.want {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, rec.Code, tt.want, rec.Body)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
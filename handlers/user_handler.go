@@ -1,46 +1,67 @@
 package handlers
 
 import (
-	"encoding/json"
+	"errors"
 	"net/http"
+	"go-realtime-workspace/cursor"
+	"go-realtime-workspace/middleware"
 	"go-realtime-workspace/models"
 	"go-realtime-workspace/repository"
+	"strconv"
 
 	"github.com/gorilla/mux"
 )
 
 // UserHandler handles user-related HTTP requests.
 type UserHandler struct {
-	repo *repository.UserRepository
+	repo         *repository.UserRepository
+	defaultOrgID string // Org given to new users that omit org_id (empty requires org_id)
+
+	Cursors *cursor.Signer // Signs the cursors of org user pages
 }
 
-// NewUserHandler creates a new user handler.
-func NewUserHandler(repo *repository.UserRepository) *UserHandler {
-	return &UserHandler{repo: repo}
+// NewUserHandler creates a new user handler. defaultOrgID is the org given
+// to new users that omit one; leave it empty to require org_id.
+func NewUserHandler(repo *repository.UserRepository, defaultOrgID string) *UserHandler {
+	return &UserHandler{repo: repo, defaultOrgID: defaultOrgID, Cursors: cursor.NewSigner("")}
 }
 
 // Create handles user creation.
 func (h *UserHandler) Create(w http.ResponseWriter, r *http.Request) {
 	var req models.CreateUserRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if req.Username == "" || req.Email == "" || req.OrgID == "" {
-		http.Error(w, "Missing required fields: username, email, org_id", http.StatusBadRequest)
+	if req.OrgID == "" {
+		req.OrgID = h.defaultOrgID
+	}
+
+	generate := req.Username == "" && req.GenerateUsername
+	if (req.Username == "" && !generate) || req.Email == "" || req.OrgID == "" {
+		writeError(w, r, "Missing required fields: username, email, org_id", http.StatusBadRequest)
 		return
 	}
 
-	user, err := h.repo.Create(r.Context(), req)
+	var user *models.User
+	var err error
+	if generate {
+		user, err = h.repo.CreateWithGeneratedUsername(r.Context(), req)
+	} else {
+		user, err = h.repo.Create(r.Context(), req)
+	}
+	if errors.Is(err, repository.ErrInvalidUser) {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(user)
+	setLocation(w, userURL(user.ID))
+	writeJSON(w, r, http.StatusCreated, user, nil)
 }
 
 // GetByID handles retrieving a user by ID.
@@ -49,64 +70,177 @@ func (h *UserHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 
 	user, err := h.repo.GetByID(r.Context(), id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		writeError(w, r, err.Error(), http.StatusNotFound)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(user)
+	writeJSON(w, r, http.StatusOK, user, nil)
 }
 
 // GetByUsername handles retrieving a user by username.
 func (h *UserHandler) GetByUsername(w http.ResponseWriter, r *http.Request) {
 	username := r.URL.Query().Get("username")
 	if username == "" {
-		http.Error(w, "username query parameter is required", http.StatusBadRequest)
+		writeError(w, r, "username query parameter is required", http.StatusBadRequest)
 		return
 	}
 
 	user, err := h.repo.GetByUsername(r.Context(), username)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		writeError(w, r, err.Error(), http.StatusNotFound)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(user)
+	writeJSON(w, r, http.StatusOK, user, nil)
 }
 
-// GetByOrg handles retrieving all users in an organization.
+// GetByOrg handles retrieving the users in an organization, newest first.
+// Without limit or cursor every user is returned; with either, one page of
+// limit (default 50, at most 200) users and the cursor of the next.
 func (h *UserHandler) GetByOrg(w http.ResponseWriter, r *http.Request) {
 	orgID := mux.Vars(r)["orgId"]
+	query := r.URL.Query()
+
+	if query.Get("limit") == "" && query.Get("cursor") == "" {
+		users, err := h.repo.GetByOrgID(r.Context(), orgID)
+		if err != nil {
+			writeError(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, r, http.StatusOK, users, &Meta{Count: len(users)})
+		return
+	}
+
+	limit := 50
+	if l, err := strconv.Atoi(query.Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+	if limit > 200 {
+		limit = 200
+	}
+	after, ok := parseCursor(w, r, h.Cursors, cursor.ListUsers, orgID)
+	if !ok {
+		return
+	}
+
+	users, err := h.repo.GetPageByOrgID(r.Context(), orgID, after, limit)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var next *cursor.Position
+	if len(users) == limit {
+		last := users[len(users)-1]
+		next = &cursor.Position{Time: last.CreatedAt, ID: last.ID}
+	}
+	token := setNextCursor(w, h.Cursors, cursor.ListUsers, orgID, next)
+
+	writeJSON(w, r, http.StatusOK, users, &Meta{Count: len(users), Limit: limit, NextCursor: token})
+}
+
+// SearchInOrg handles prefix search of an organization's users by
+// username, full name or email, for member pickers. The number of results
+// is limited with limit (default 20, at most 100).
+func (h *UserHandler) SearchInOrg(w http.ResponseWriter, r *http.Request) {
+	orgID := mux.Vars(r)["orgId"]
+	query := r.URL.Query()
+
+	q := query.Get("q")
+	if q == "" {
+		writeError(w, r, "q query parameter is required", http.StatusBadRequest)
+		return
+	}
+	limit := 20
+	if limitStr := query.Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+			limit = l
+		}
+	}
+	if limit > 100 {
+		limit = 100
+	}
 
-	users, err := h.repo.GetByOrgID(r.Context(), orgID)
+	users, err := h.repo.SearchInOrg(r.Context(), orgID, q, limit)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(users)
+	writeJSON(w, r, http.StatusOK, users, &Meta{Count: len(users), Limit: limit})
 }
 
-// Update handles user updates.
+// Update handles partial user updates: only the fields in the body change.
 func (h *UserHandler) Update(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"]
 
 	var req models.UpdateUserRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	user, err := h.repo.Update(r.Context(), id, req)
+	if errors.Is(err, repository.ErrInvalidUser) {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, repository.ErrUserTaken) {
+		writeError(w, r, err.Error(), http.StatusConflict)
+		return
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, user, nil)
+}
+
+// SetRole handles changing a user's role within an organization. The change
+// is made by the authenticated user, who must be an owner or admin of the
+// organization, or with the admin token.
+func (h *UserHandler) SetRole(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	actorID, ok := requireCaller(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.SetRoleRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !models.ValidRole(req.Role) {
+		writeError(w, r, "role must be owner, admin, manager or member", http.StatusBadRequest)
+		return
+	}
+
+	audit := models.AuditEntry{
+		ActorID:   actorID,
+		RequestID: middleware.GetRequestID(r.Context()),
+		IP:        middleware.ClientIP(r),
+	}
+	user, err := h.repo.SetRole(r.Context(), vars["orgId"], vars["userId"], req.Role, audit)
+	switch {
+	case errors.Is(err, repository.ErrUserNotInOrg):
+		writeError(w, r, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, repository.ErrInsufficientRole):
+		writeError(w, r, err.Error(), http.StatusForbidden)
+		return
+	case errors.Is(err, repository.ErrLastOwner):
+		writeError(w, r, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(user)
+	writeJSON(w, r, http.StatusOK, user, nil)
 }
 
 // Delete handles user deletion.
@@ -114,7 +248,7 @@ func (h *UserHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"]
 
 	if err := h.repo.Delete(r.Context(), id); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-realtime-workspace/config"
+	"go-realtime-workspace/models"
+	"go-realtime-workspace/repository"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+)
+
+func TestSetRoleRequiresAuthentication(t *testing.T) {
+	h := NewUserHandler(nil, "")
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/orgs/acme/users/bob/role",
+		strings.NewReader(`{"actor_id": "owner-id", "role": "owner"}`))
+	req = mux.SetURLVars(req, map[string]string{"orgId": "acme", "userId": "bob"})
+	rec := httptest.NewRecorder()
+
+	h.SetRole(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestCreateUserFallsBackToDefaultOrg(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+	repo := repository.NewUserRepository(db, config.DefaultConfig().User)
+	columns := []string{"id", "username", "email", "full_name", "avatar_url", "bio", "org_id", "role", "created_at", "updated_at"}
+	now := time.Now()
+
+	create := func(h *UserHandler, body string) int {
+		rec := httptest.NewRecorder()
+		h.Create(rec, httptest.NewRequest(http.MethodPost, "/api/v1/users", strings.NewReader(body)))
+		return rec.Code
+	}
+
+	// Without a default org, org_id is required
+	if got := create(NewUserHandler(repo, ""), `{"username": "bob", "email": "bob@acme.com"}`); got != http.StatusBadRequest {
+		t.Errorf("multi-tenant: status %d, want %d", got, http.StatusBadRequest)
+	}
+
+	h := NewUserHandler(repo, "acme")
+	mock.ExpectQuery("INSERT INTO users").WithArgs("bob", "bob@acme.com", "", "", "", "acme").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("1", "bob", "bob@acme.com", "", "", "", "acme", models.RoleMember, now, now))
+	if got := create(h, `{"username": "bob", "email": "bob@acme.com"}`); got != http.StatusCreated {
+		t.Errorf("omitted org: status %d, want %d", got, http.StatusCreated)
+	}
+	// An explicit org still wins
+	mock.ExpectQuery("INSERT INTO users").WithArgs("carol", "carol@globex.com", "", "", "", "globex").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("2", "carol", "carol@globex.com", "", "", "", "globex", models.RoleMember, now, now))
+	if got := create(h, `{"username": "carol", "email": "carol@globex.com", "org_id": "globex"}`); got != http.StatusCreated {
+		t.Errorf("explicit org: status %d, want %d", got, http.StatusCreated)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
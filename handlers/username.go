@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"context"
+	"go-realtime-workspace/metrics"
+	"go-realtime-workspace/models"
+	"go-realtime-workspace/repository"
+	"log"
+	"sync"
+	"time"
+)
+
+// Username fallbacks, stored with a message when its sender's username
+// cannot be looked up. Each first uses the last username seen for the
+// sender, however old.
+const (
+	UsernameFallbackCached   = "cached"    // Otherwise no username
+	UsernameFallbackClientID = "client_id" // Otherwise the sender's client ID
+	UsernameFallbackUnknown  = "unknown"   // Otherwise unknownUsername
+)
+
+// unknownUsername is stored under the unknown fallback.
+const unknownUsername = "Unknown"
+
+// maxCachedUsernames bounds the username cache.
+const maxCachedUsernames = 10000
+
+var usernameLookupFailures = metrics.NewCounter("username_lookup_failures_total")
+
+// Username cache outcomes; their ratio is the cache hit rate. A username
+// left out because lookups were skipped counts as a miss as well.
+var (
+	usernameCacheHits      = metrics.NewCounter("username_cache_hits_total")
+	usernameCacheMisses    = metrics.NewCounter("username_cache_misses_total")
+	usernameLookupsSkipped = metrics.NewCounter("username_lookups_skipped_total")
+)
+
+// UsernameResolver looks up the usernames stored with messages, and the
+// avatars added to them on read, caching them for a short while so a busy sender does not cost a database query
+// per message. Under load it can be limited to the cache, leaving usernames
+// it does not have to be filled in when messages are read. It is safe for
+// concurrent use.
+type UsernameResolver struct {
+	users    *repository.UserRepository
+	fallback string
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cachedProfile
+
+	writeLookups bool      // Whether Username may query the database at all
+	perSecond    int       // Queries Username may make per second (0 = no limit)
+	window       time.Time // Start of the current one-second window
+	windowCount  int       // Queries made by Username in the current window
+}
+
+// cachedProfile is a user's profile and when it was looked up.
+type cachedProfile struct {
+	profile models.UserProfile
+	fetched time.Time
+}
+
+// NewUsernameResolver creates a resolver that trusts a looked-up username
+// for ttl (0 disables caching) and uses fallback when a lookup fails.
+func NewUsernameResolver(users *repository.UserRepository, fallback string, ttl time.Duration) *UsernameResolver {
+	return &UsernameResolver{
+		users:    users,
+		fallback: fallback,
+		ttl:      ttl,
+		entries:  make(map[string]cachedProfile),
+
+		writeLookups: true,
+	}
+}
+
+// SetWriteLookups sets whether Username may query the database, and at
+// most how many times per second (0 for no limit). When it may not, it
+// answers from the cache alone.
+func (u *UsernameResolver) SetWriteLookups(enabled bool, perSecond int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.writeLookups = enabled
+	u.perSecond = perSecond
+}
+
+// Username returns the username to store with a message from userID. A
+// failed lookup is logged and counted, and answered with the fallback.
+// When lookups are disabled or over their limit, the cached username is
+// returned however old it is, and without one no username is stored for
+// readers to fill in (see Fill). Without a user repository no username is
+// stored, except for the system bot, which is always models.SystemUsername.
+func (u *UsernameResolver) Username(ctx context.Context, userID string) string {
+	if userID == models.SystemUserID {
+		return models.SystemUsername
+	}
+	if u.users == nil || userID == "" {
+		return ""
+	}
+
+	u.mu.Lock()
+	cached, ok := u.entries[userID]
+	fresh := ok && time.Since(cached.fetched) < u.ttl
+	allowed := fresh || u.allowLookup()
+	u.mu.Unlock()
+	if fresh {
+		usernameCacheHits.Inc()
+		return cached.profile.Username
+	}
+	usernameCacheMisses.Inc()
+	if !allowed {
+		usernameLookupsSkipped.Inc()
+		return cached.profile.Username
+	}
+
+	user, err := u.users.GetByID(ctx, userID)
+	if err == nil {
+		u.store(userID, models.UserProfile{Username: user.Username, AvatarURL: user.AvatarURL})
+		return user.Username
+	}
+
+	usernameLookupFailures.Inc()
+	log.Printf("Error looking up username of %s: %v", userID, err)
+	switch {
+	case ok:
+		return cached.profile.Username
+	case u.fallback == UsernameFallbackClientID:
+		return userID
+	case u.fallback == UsernameFallbackUnknown:
+		return unknownUsername
+	default:
+		return ""
+	}
+}
+
+// allowLookup reports whether Username may query the database now, and if
+// so counts the query against the limit. u.mu must be held.
+func (u *UsernameResolver) allowLookup() bool {
+	if !u.writeLookups {
+		return false
+	}
+	if u.perSecond <= 0 {
+		return true
+	}
+
+	now := time.Now()
+	if now.Sub(u.window) >= time.Second {
+		u.window = now
+		u.windowCount = 0
+	}
+	if u.windowCount >= u.perSecond {
+		return false
+	}
+	u.windowCount++
+	return true
+}
+
+// Fill fills in the usernames missing from messages and their quotes, and
+// the avatar of each message's sender, from the cache where it can and
+// otherwise with one query for the rest. It is not subject to
+// SetWriteLookups. A failed query is logged and counted, and leaves those
+// fields blank.
+func (u *UsernameResolver) Fill(ctx context.Context, messages []models.ChatMessage) {
+	if u.users == nil {
+		return
+	}
+
+	profiles := make(map[string]models.UserProfile)
+	var missing []string
+	want := func(userID string) {
+		if userID == "" {
+			return
+		}
+		if _, seen := profiles[userID]; seen {
+			return
+		}
+		profiles[userID] = models.UserProfile{}
+		if userID == models.SystemUserID {
+			profiles[userID] = models.UserProfile{Username: models.SystemUsername}
+			return
+		}
+
+		u.mu.Lock()
+		cached, ok := u.entries[userID]
+		u.mu.Unlock()
+		if ok && time.Since(cached.fetched) < u.ttl {
+			usernameCacheHits.Inc()
+			profiles[userID] = cached.profile
+			return
+		}
+		usernameCacheMisses.Inc()
+		missing = append(missing, userID)
+	}
+	for i := range messages {
+		want(messages[i].ClientID)
+		if quote := messages[i].Quote; quote != nil && quote.Username == "" {
+			want(quote.ClientID)
+		}
+	}
+	if len(profiles) == 0 {
+		return
+	}
+
+	if len(missing) > 0 {
+		found, err := u.users.Profiles(ctx, missing)
+		if err != nil {
+			usernameLookupFailures.Inc()
+			log.Printf("Error looking up %d user profiles: %v", len(missing), err)
+		}
+		for id, profile := range found {
+			u.store(id, profile)
+			profiles[id] = profile
+		}
+	}
+
+	for i := range messages {
+		sender := profiles[messages[i].ClientID]
+		if messages[i].Username == "" {
+			messages[i].Username = sender.Username
+		}
+		messages[i].AvatarURL = sender.AvatarURL
+		if quote := messages[i].Quote; quote != nil && quote.Username == "" {
+			quote.Username = profiles[quote.ClientID].Username
+		}
+	}
+}
+
+// store caches a looked-up profile. When the cache is full, expired
+// entries are dropped first, then arbitrary ones.
+func (u *UsernameResolver) store(userID string, profile models.UserProfile) {
+	if u.ttl <= 0 {
+		return
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if _, ok := u.entries[userID]; !ok && len(u.entries) >= maxCachedUsernames {
+		for id, entry := range u.entries {
+			if time.Since(entry.fetched) >= u.ttl {
+				delete(u.entries, id)
+			}
+		}
+		for id := range u.entries {
+			if len(u.entries) < maxCachedUsernames {
+				break
+			}
+			delete(u.entries, id)
+		}
+	}
+	u.entries[userID] = cachedProfile{profile: profile, fetched: time.Now()}
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go-realtime-workspace/config"
+	"go-realtime-workspace/models"
+	"go-realtime-workspace/repository"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// newMockResolver returns a username resolver over a mocked user table.
+func newMockResolver(t *testing.T, fallback string, ttl time.Duration) (*UsernameResolver, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	users := repository.NewUserRepository(db, config.DefaultConfig().User)
+	return NewUsernameResolver(users, fallback, ttl), mock
+}
+
+// expectUser expects one lookup of userID, answered with username.
+func expectUser(mock sqlmock.Sqlmock, userID, username string) {
+	now := time.Now()
+	mock.ExpectQuery("FROM users WHERE id").WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "email", "full_name", "avatar_url", "bio", "org_id", "role", "created_at", "updated_at"}).
+			AddRow(userID, username, userID+"@acme.com", "", "", "", "acme", models.RoleMember, now, now))
+}
+
+func TestUsernameFallbackOnFailedLookup(t *testing.T) {
+	for fallback, want := range map[string]string{
+		UsernameFallbackCached:   "",
+		UsernameFallbackClientID: "bob",
+		UsernameFallbackUnknown:  "Unknown",
+	} {
+		t.Run(fallback, func(t *testing.T) {
+			resolver, mock := newMockResolver(t, fallback, time.Minute)
+			mock.ExpectQuery("FROM users WHERE id").WithArgs("bob").WillReturnError(errors.New("connection refused"))
+			before := usernameLookupFailures.Value()
+
+			if got := resolver.Username(context.Background(), "bob"); got != want {
+				t.Errorf("got %q, want %q", got, want)
+			}
+			if got := usernameLookupFailures.Value() - before; got != 1 {
+				t.Errorf("failure counter rose by %d, want 1", got)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestUsernameCachePreventsRepeatedLookups(t *testing.T) {
+	const ttl = 50 * time.Millisecond
+	resolver, mock := newMockResolver(t, UsernameFallbackClientID, ttl)
+	ctx := context.Background()
+
+	// One query serves every message within the TTL
+	expectUser(mock, "bob", "Bobby")
+	for i := 0; i < 3; i++ {
+		if got := resolver.Username(ctx, "bob"); got != "Bobby" {
+			t.Fatalf("lookup %d: got %q, want Bobby", i+1, got)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Once it expires, a failed lookup falls back to the stale name
+	// rather than the configured fallback
+	time.Sleep(ttl)
+	mock.ExpectQuery("FROM users WHERE id").WithArgs("bob").WillReturnError(errors.New("connection refused"))
+	if got := resolver.Username(ctx, "bob"); got != "Bobby" {
+		t.Errorf("after a failed refresh: got %q, want the cached Bobby", got)
+	}
+
+	// With lookups disabled only the cache answers
+	resolver.SetWriteLookups(false, 0)
+	if got := resolver.Username(ctx, "carol"); got != "" {
+		t.Errorf("uncached user with lookups disabled: got %q, want none", got)
+	}
+	if got := resolver.Username(ctx, models.SystemUserID); got != models.SystemUsername {
+		t.Errorf("system bot: got %q, want %q", got, models.SystemUsername)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWriteEnrichmentUnderLoad(t *testing.T) {
+	resolver, mock := newMockResolver(t, UsernameFallbackClientID, time.Minute)
+	resolver.SetWriteLookups(true, 1)
+	ctx := context.Background()
+	hits, skipped := usernameCacheHits.Value(), usernameLookupsSkipped.Value()
+
+	expectUser(mock, "bob", "Bobby")
+	if got := resolver.Username(ctx, "bob"); got != "Bobby" {
+		t.Fatalf("first lookup: got %q, want Bobby", got)
+	}
+	// The second sender in the same second is over the limit: nothing is
+	// stored for readers to fill in, and the database is not asked
+	if got := resolver.Username(ctx, "carol"); got != "" {
+		t.Errorf("over the limit: got %q, want none", got)
+	}
+	// A cached sender costs no lookup
+	if got := resolver.Username(ctx, "bob"); got != "Bobby" {
+		t.Errorf("cached: got %q, want Bobby", got)
+	}
+
+	if got := usernameCacheHits.Value() - hits; got != 1 {
+		t.Errorf("hit counter rose by %d, want 1", got)
+	}
+	if got := usernameLookupsSkipped.Value() - skipped; got != 1 {
+		t.Errorf("skipped counter rose by %d, want 1", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFillUsernamesOnRead(t *testing.T) {
+	const (
+		bob   = "6f1c1a52-0d2f-4b7e-9a57-3c1f0f6b2a01"
+		carol = "6f1c1a52-0d2f-4b7e-9a57-3c1f0f6b2a02"
+	)
+	resolver, mock := newMockResolver(t, UsernameFallbackCached, time.Minute)
+	resolver.SetWriteLookups(false, 0)
+	ctx := context.Background()
+
+	// Bob is cached from an earlier lookup; carol is not
+	resolver.store(bob, models.UserProfile{Username: "Bobby"})
+	mock.ExpectQuery("SELECT id, username, avatar_url FROM users").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "avatar_url"}).AddRow(carol, "Caz", "https://example.com/caz.png"))
+
+	messages := []models.ChatMessage{
+		{ID: "m1", ClientID: bob},
+		{ID: "m2", ClientID: carol, Quote: &models.MessageQuote{ClientID: bob}},
+		{ID: "m3", ClientID: carol, Username: "Carol at the time"},
+		{ID: "m4", ClientID: models.SystemUserID},
+	}
+	resolver.Fill(ctx, messages)
+
+	for i, want := range []string{"Bobby", "Caz", "Carol at the time", models.SystemUsername} {
+		if messages[i].Username != want {
+			t.Errorf("%s: username %q, want %q", messages[i].ID, messages[i].Username, want)
+		}
+	}
+	if messages[1].Quote.Username != "Bobby" {
+		t.Errorf("quote username %q, want Bobby", messages[1].Quote.Username)
+	}
+	if messages[2].AvatarURL != "https://example.com/caz.png" {
+		t.Errorf("avatar %q, want carol's", messages[2].AvatarURL)
+	}
+
+	// Fill cached carol too, so a send-time lookup now finds her
+	if got := resolver.Username(ctx, carol); got != "Caz" {
+		t.Errorf("after the read: got %q, want the cached Caz", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
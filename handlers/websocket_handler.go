@@ -6,14 +6,21 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"go-realtime-workspace/config"
 	"go-realtime-workspace/hub"
+	"go-realtime-workspace/middleware"
 	"go-realtime-workspace/models"
 	"go-realtime-workspace/repository"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
 )
@@ -24,23 +31,268 @@ type WebSocketHandler struct {
 	OrgHub   *hub.OrgHub
 	MsgRepo  *repository.MessageRepository
 	UserRepo *repository.UserRepository
+	Features *repository.FeatureRepository
+
+	DefaultOrgID string // Organization used by CreateGroup when the route has no org (empty if unset)
+
+	Usernames *UsernameResolver // Looks up the usernames stored with messages
+
+	cfg             config.WebSocketConfig
+	upgrader        websocket.Upgrader
+	pendingUpgrades atomic.Int64 // Upgrades currently in progress
+}
+
+// Errors returned by upgrade when a connection is refused before the handshake.
+var (
+	errTooManyUpgrades = errors.New("too many pending WebSocket upgrades")
+	errMaintenance     = errors.New("maintenance mode refuses new connections")
+	errConnectLimited  = errors.New("too many connection attempts")
+	errOutdatedClient  = errors.New("client protocol version is too old")
+)
+
+// Reasons given in the body of a refused upgrade.
+const (
+	rejectMaintenance = "maintenance"
+	rejectPending     = "pending_upgrades"
+	rejectCapacity    = "capacity"
+	rejectRateLimited = "rate_limited"
+)
+
+// upgradeRejection is the JSON body of a WebSocket upgrade refused with
+// 503 (the server is out of capacity) or 429 (the user reconnects too often).
+type upgradeRejection struct {
+	Error      string `json:"error"`
+	Reason     string `json:"reason"`          // One of the reject constants
+	Scope      string `json:"scope,omitempty"` // For capacity: hub.CapacityServer or hub.CapacityOrg
+	Current    int64  `json:"current,omitempty"`
+	Limit      int64  `json:"limit,omitempty"`
+	RetryAfter int    `json:"retry_after"` // Seconds, as in the Retry-After header
+}
+
+// rejectUpgrade refuses a WebSocket upgrade with a plain HTTP response the
+// client can parse, before any handshake takes place.
+func rejectUpgrade(w http.ResponseWriter, status int, retryAfter time.Duration, rejection upgradeRejection) {
+	seconds := int((retryAfter + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	rejection.RetryAfter = seconds
+
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(rejection)
 }
 
 // NewWebSocketHandler creates a new WebSocket handler.
 // It should be initialized with an active OrgHub instance.
-func NewWebSocketHandler(orgHub *hub.OrgHub, msgRepo *repository.MessageRepository, userRepo *repository.UserRepository) *WebSocketHandler {
+func NewWebSocketHandler(orgHub *hub.OrgHub, msgRepo *repository.MessageRepository, userRepo *repository.UserRepository, features *repository.FeatureRepository, cfg config.WebSocketConfig) *WebSocketHandler {
 	return &WebSocketHandler{
 		OrgHub:   orgHub,
 		MsgRepo:  msgRepo,
 		UserRepo: userRepo,
+		Features: features,
+		cfg:      cfg,
+
+		Usernames: NewUsernameResolver(userRepo, UsernameFallbackCached, 0),
+		// upgrader configures the WebSocket upgrader with buffer sizes, handshake timeout and CORS settings.
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:    cfg.ReadBufferSize,
+			WriteBufferSize:   cfg.WriteBufferSize,
+			HandshakeTimeout:  cfg.HandshakeTimeout,
+			EnableCompression: cfg.EnableCompression,
+			CheckOrigin:       func(r *http.Request) bool { return true }, // Allow all origins (configure for production)
+		},
+	}
+}
+
+// upgrade upgrades the HTTP connection to a WebSocket for a client of an
+// organization (empty for DM clients). Before the handshake it refuses the
+// connection with 503 and Retry-After during maintenance, when too many
+// handshakes are already in progress (bounding the goroutines a
+// slowloris-style client can tie up) or when a connection cap is reached,
+// and with 429 when the user exceeds WebSocket.UserConnectsPerMinute.
+//
+// It also returns the protocol version the client declared in the
+// protocol_version query parameter, negotiated down to hub.ProtocolVersion.
+// A client older than WebSocket.MinProtocolVersion is upgraded and then
+// closed with hub.CloseProtocolOutdated, so it sees a reason it can show.
+func (h *WebSocketHandler) upgrade(w http.ResponseWriter, r *http.Request, orgID, userID string) (*websocket.Conn, int, error) {
+	version, err := hub.ParseProtocolVersion(r.URL.Query().Get("protocol_version"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, 0, err
+	}
+
+	if h.OrgHub.InMaintenance() {
+		rejectUpgrade(w, http.StatusServiceUnavailable, h.cfg.MaintenanceRetryAfter, upgradeRejection{
+			Error:  "Server is in maintenance mode, retry later",
+			Reason: rejectMaintenance,
+		})
+		return nil, 0, errMaintenance
+	}
+	if ok, attempts, retryAfter := h.OrgHub.AllowConnect(userID); !ok {
+		rejectUpgrade(w, http.StatusTooManyRequests, retryAfter, upgradeRejection{
+			Error:   "Too many connection attempts, retry later",
+			Reason:  rejectRateLimited,
+			Current: int64(attempts),
+			Limit:   int64(h.cfg.UserConnectsPerMinute),
+		})
+		return nil, 0, errConnectLimited
+	}
+	var capErr *hub.CapacityError
+	if err := h.OrgHub.CheckCapacity(orgID); errors.As(err, &capErr) {
+		rejectUpgrade(w, http.StatusServiceUnavailable, h.cfg.CapacityRetryAfter, upgradeRejection{
+			Error:   "Too many connections, retry later",
+			Reason:  rejectCapacity,
+			Scope:   capErr.Scope,
+			Current: capErr.Current,
+			Limit:   capErr.Limit,
+		})
+		return nil, 0, err
+	}
+	if max := h.cfg.MaxPendingUpgrades; max > 0 {
+		if pending := h.pendingUpgrades.Add(1); pending > int64(max) {
+			h.pendingUpgrades.Add(-1)
+			rejectUpgrade(w, http.StatusServiceUnavailable, h.cfg.CapacityRetryAfter, upgradeRejection{
+				Error:   "Too many pending connections, retry later",
+				Reason:  rejectPending,
+				Current: pending - 1,
+				Limit:   int64(max),
+			})
+			return nil, 0, errTooManyUpgrades
+		}
+		defer h.pendingUpgrades.Add(-1)
+	}
+
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return nil, 0, err
 	}
+	if min := h.cfg.MinProtocolVersion; version < min {
+		deadline := time.Now().Add(h.cfg.WriteWait)
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(hub.CloseProtocolOutdated, hub.OutdatedProtocolReason(version, min)), deadline)
+		conn.Close()
+		return nil, 0, fmt.Errorf("%w: client %s declared version %d", errOutdatedClient, userID, version)
+	}
+	return conn, version, nil
+}
+
+// compressed reports whether upgrading r negotiates permessage-deflate:
+// the upgrader accepts the extension whenever it is enabled and offered.
+func (h *WebSocketHandler) compressed(r *http.Request) bool {
+	if !h.upgrader.EnableCompression {
+		return false
+	}
+	for _, header := range r.Header.Values("Sec-WebSocket-Extensions") {
+		for _, ext := range strings.Split(header, ",") {
+			name, _, _ := strings.Cut(ext, ";")
+			if strings.TrimSpace(name) == hub.CompressionDeflate {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// authenticate resolves the ID of a connecting client. When the hub
+// requires access tokens, taken from the token query parameter (browsers
+// cannot set headers on WebSocket requests) or an Authorization bearer
+// header, the client is the user of its token: a missing or invalid token
+// gets 401, and a requested ID naming another user 403. Otherwise the
+// requested ID is trusted, unless WebSocket.AssignClientIDs has the server
+// assign a random one (see assignsClientIDs); a missing ID then gets 400.
+// It returns false after responding with an error, and otherwise the
+// client ID and when its token expires (zero if never or unauthenticated).
+func (h *WebSocketHandler) authenticate(w http.ResponseWriter, r *http.Request, requested string) (string, time.Time, bool) {
+	if !h.OrgHub.AuthRequired() {
+		if h.assignsClientIDs() {
+			return uuid.New().String(), time.Time{}, true
+		}
+		if requested == "" {
+			http.Error(w, "clientId query parameter is required", http.StatusBadRequest)
+			return "", time.Time{}, false
+		}
+		return requested, time.Time{}, true
+	}
+
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		token = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+	userID, expiresAt, err := h.OrgHub.Authenticate(r.Context(), token)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return "", time.Time{}, false
+	}
+	if requested != "" && requested != userID {
+		http.Error(w, hub.ErrTokenMismatch.Error(), http.StatusForbidden)
+		return "", time.Time{}, false
+	}
+	return userID, expiresAt, true
+}
+
+// assignsClientIDs reports whether group and presence clients get a random
+// server-side ID. Without authentication a client could claim any ID, so
+// the server can assign one instead, which the client learns from the
+// connection_info frame. With authentication the token names the client.
+func (h *WebSocketHandler) assignsClientIDs() bool {
+	return h.cfg.AssignClientIDs && !h.OrgHub.AuthRequired()
 }
 
-// upgrader configures the WebSocket upgrader with buffer sizes and CORS settings.
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin:     func(r *http.Request) bool { return true }, // Allow all origins (configure for production)
+// featureEnabled reports whether an organization has a feature enabled.
+func (h *WebSocketHandler) featureEnabled(ctx context.Context, orgID, feature string) bool {
+	return h.Features == nil || h.Features.FeatureEnabled(ctx, orgID, feature)
+}
+
+// dmEnabled reports whether a user may send direct messages, which depends
+// on the DM feature of the user's organization. Unknown users have no
+// organization and are allowed.
+func (h *WebSocketHandler) dmEnabled(ctx context.Context, userID string) bool {
+	return h.orgDMEnabled(ctx, h.dmOrg(ctx, userID))
+}
+
+// dmOrg returns the organization whose DM feature governs userID, or "" if
+// the user is unknown.
+func (h *WebSocketHandler) dmOrg(ctx context.Context, userID string) string {
+	if h.Features == nil || h.UserRepo == nil {
+		return ""
+	}
+	user, err := h.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return ""
+	}
+	return user.OrgID
+}
+
+// orgDMEnabled is dmEnabled for a user of orgID ("" for unknown users), for
+// callers that looked the organization up already.
+func (h *WebSocketHandler) orgDMEnabled(ctx context.Context, orgID string) bool {
+	return orgID == "" || h.featureEnabled(ctx, orgID, models.FeatureDM)
+}
+
+// recordActivity increments an organization's activity counter, logging failures.
+func (h *WebSocketHandler) recordActivity(orgID, counter string) {
+	if err := h.MsgRepo.RecordActivity(context.Background(), orgID, counter); err != nil {
+		log.Printf("Error recording %s for org %s: %v", counter, orgID, err)
+	}
+}
+
+// invalidMessageStatus returns the HTTP status for an error from
+// OrgHub.ValidateMessage.
+func invalidMessageStatus(err error) int {
+	if errors.Is(err, models.ErrContentTooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// dmFrame is a direct message as sent by a client, which may ask for the
+// message to expire sooner than the DM history.
+type dmFrame struct {
+	hub.Message
+	ExpiresIn int `json:"expires_in,omitempty"` // Seconds until the message expires (see OrgHub.ApplyDMExpiry)
 }
 
 // CreateOrg creates a new organization
@@ -69,6 +321,7 @@ func (h *WebSocketHandler) CreateOrg(w http.ResponseWriter, r *http.Request) {
 	// Create the organization
 	org := h.OrgHub.CreateOrganization(orgDetails.ID, orgDetails.Name)
 
+	setLocation(w, orgURL(org.ID))
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]string{
 		"status":  "success",
@@ -97,9 +350,29 @@ func (h *WebSocketHandler) GetOrgs(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(orgs)
 }
 
+// GetOrg retrieves a single organization
+func (h *WebSocketHandler) GetOrg(w http.ResponseWriter, r *http.Request) {
+	orgID := mux.Vars(r)["orgId"]
+
+	org, exists := h.OrgHub.GetOrganization(orgID)
+	if !exists {
+		http.Error(w, "Organization not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"id":   org.ID,
+		"name": org.Name,
+	})
+}
+
 // CreateGroup creates a new group in an organization
 func (h *WebSocketHandler) CreateGroup(w http.ResponseWriter, r *http.Request) {
 	orgID := mux.Vars(r)["orgId"]
+	if orgID == "" {
+		orgID = h.DefaultOrgID
+	}
 
 	var groupDetails struct {
 		ID   string `json:"id"`
@@ -130,15 +403,13 @@ func (h *WebSocketHandler) CreateGroup(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create and start the group hub
-	group := hub.NewGroupHub(orgID, groupDetails.ID)
+	group := hub.NewGroupHub(h.OrgHub, orgID, groupDetails.ID)
 	group.Name = groupDetails.Name
 
-	// Add group to organization (we need a method for this)
-	h.OrgHub.Register <- group
-
-	// Start the group hub
-	go group.Run()
+	// Add group to organization and start the group hub
+	h.OrgHub.StartGroup(group)
 
+	setLocation(w, groupURL(orgID, groupDetails.ID))
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]string{
 		"status":   "success",
@@ -175,17 +446,68 @@ func (h *WebSocketHandler) GetOrgGroups(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(groups)
 }
 
+// GetGroup retrieves a single group of an organization
+func (h *WebSocketHandler) GetGroup(w http.ResponseWriter, r *http.Request) {
+	orgID := mux.Vars(r)["orgId"]
+	groupID := mux.Vars(r)["groupId"]
+
+	org, exists := h.OrgHub.GetOrganization(orgID)
+	if !exists {
+		http.Error(w, "Organization not found", http.StatusNotFound)
+		return
+	}
+
+	group, exists := org.Groups[groupID]
+	if !exists {
+		http.Error(w, "Group not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":     group.GroupID,
+		"name":   group.Name,
+		"org_id": orgID,
+		"frozen": group.Frozen(),
+	})
+}
+
 // JoinGroup adds a client to a specific group via WebSocket
 func (h *WebSocketHandler) JoinGroup(w http.ResponseWriter, r *http.Request) {
 	orgID := mux.Vars(r)["orgId"]
 	groupID := mux.Vars(r)["groupId"]
-	clientID := r.URL.Query().Get("clientId")
 
-	if clientID == "" {
-		http.Error(w, "clientId query parameter is required", http.StatusBadRequest)
+	clientID, expiresAt, ok := h.authenticate(w, r, r.URL.Query().Get("clientId"))
+	if !ok {
+		return
+	}
+	if clientID == models.SystemUserID {
+		http.Error(w, "clientId is reserved for the system bot", http.StatusBadRequest)
 		return
 	}
 
+	// Optionally receive only some of the group's channels
+	var channels []string
+	if param := r.URL.Query().Get("channels"); param != "" {
+		channels = strings.Split(param, ",")
+		for _, channel := range channels {
+			if !models.ValidChannel(channel) {
+				http.Error(w, "channels must be a comma-separated list of channel tags", http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	// Optionally replay unread messages after the missed_summary frame
+	replay := false
+	if param := r.URL.Query().Get("replay"); param != "" {
+		var err error
+		if replay, err = strconv.ParseBool(param); err != nil {
+			http.Error(w, "replay must be true or false", http.StatusBadRequest)
+			return
+		}
+	}
+
 	// Check if group exists
 	group, exists := h.OrgHub.GetGroup(orgID, groupID)
 	if !exists {
@@ -193,24 +515,143 @@ func (h *WebSocketHandler) JoinGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	conn, err := upgrader.Upgrade(w, r, nil)
+	conn, version, err := h.upgrade(w, r, orgID, clientID)
 	if err != nil {
 		log.Printf("Failed to upgrade WebSocket connection: %v", err)
 		return
 	}
 
-	client := &hub.Client{
-		ID:    clientID,
-		Conn:  conn,
-		Group: group,
-		Send:  make(chan *hub.Message, 256),
+	client := hub.NewClient(h.OrgHub, clientID, conn, group, h.compressed(r), version)
+	client.SetTokenExpiry(expiresAt)
+	if channels != nil {
+		client.SetChannels(channels)
 	}
 
 	group.AddClient(client)
 	log.Printf("Client %s joined group %s in organization %s", clientID, groupID, orgID)
+
+	// Assigned IDs belong to no user, so there is nothing to summarize
+	if h.MsgRepo != nil && !h.assignsClientIDs() {
+		h.sendMissed(client, orgID, groupID, replay)
+		h.redeliver(client, orgID, groupID)
+	}
+
+	// Count the join and, once the client disconnects, the leave
+	if h.MsgRepo != nil {
+		h.recordActivity(orgID, models.ActivityJoins)
+		go func() {
+			<-client.Done()
+			h.recordActivity(orgID, models.ActivityLeaves)
+		}()
+	}
+}
+
+// sendMissed sends a connecting client the missed_summary frame for its
+// user: unread messages in groupID and the other groups of orgID the user
+// follows, mentions among them, and unread DMs. With replay it follows up
+// with a history frame holding the oldest unread messages of groupID.
+func (h *WebSocketHandler) sendMissed(client *hub.Client, orgID, groupID string, replay bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), h.cfg.WriteWait)
+	defer cancel()
+
+	handles := []string{client.ID}
+	if h.UserRepo != nil {
+		if user, err := h.UserRepo.GetByID(ctx, client.ID); err == nil {
+			handles = append(handles, user.Username)
+		}
+	}
+	var groupIDs []string
+	if groupID != "" {
+		groupIDs = []string{groupID}
+	}
+
+	summary, err := h.MsgRepo.MissedSummary(ctx, client.ID, orgID, groupIDs, handles)
+	if err != nil {
+		log.Printf("Error summarizing missed messages for %s: %v", client.ID, err)
+		return
+	}
+	client.SendFrame(hub.NewMissedSummaryFrame(client.ID, summary, h.OrgHub.Now()))
+
+	if !replay || groupID == "" {
+		return
+	}
+	messages, err := h.MsgRepo.GetUnread(ctx, client.ID, orgID, groupID, maxResyncMessages)
+	if err != nil {
+		log.Printf("Error replaying unread messages for %s: %v", client.ID, err)
+		return
+	}
+	if len(messages) > 0 {
+		client.SendFrame(hub.NewHistoryFrame(orgID, groupID, messages, h.OrgHub.Now()))
+	}
+}
+
+// redeliver sends a rejoining client, in a history frame, the ack_required
+// messages whose write to its previous connection failed.
+func (h *WebSocketHandler) redeliver(client *hub.Client, orgID, groupID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), h.cfg.WriteWait)
+	defer cancel()
+
+	messages, err := h.MsgRepo.TakeUndelivered(ctx, orgID, groupID, client.ID)
+	if err != nil {
+		log.Printf("Error redelivering messages to %s: %v", client.ID, err)
+		return
+	}
+	if len(messages) > 0 {
+		client.SendFrame(hub.NewHistoryFrame(orgID, groupID, messages, h.OrgHub.Now()))
+	}
+}
+
+// ConnectPresence streams presence events for every user of an organization
+// over a WebSocket. The connection also marks the client as online and lets
+// it set its status.
+func (h *WebSocketHandler) ConnectPresence(w http.ResponseWriter, r *http.Request) {
+	orgID := mux.Vars(r)["orgId"]
+
+	clientID, expiresAt, ok := h.authenticate(w, r, r.URL.Query().Get("clientId"))
+	if !ok {
+		return
+	}
+	if clientID == models.SystemUserID {
+		http.Error(w, "clientId is reserved for the system bot", http.StatusBadRequest)
+		return
+	}
+
+	if _, exists := h.OrgHub.GetOrganization(orgID); !exists {
+		http.Error(w, "Organization not found", http.StatusNotFound)
+		return
+	}
+
+	conn, version, err := h.upgrade(w, r, orgID, clientID)
+	if err != nil {
+		log.Printf("Failed to upgrade WebSocket connection: %v", err)
+		return
+	}
+
+	client := hub.NewPresenceClient(h.OrgHub, orgID, clientID, conn, h.compressed(r), version)
+	client.SetTokenExpiry(expiresAt)
+	h.OrgHub.AddPresenceSubscriber(client)
+	log.Printf("Client %s subscribed to presence in organization %s", clientID, orgID)
 }
 
-// BroadcastOrg sends a message to all groups in the specified organization
+// assignAuthor attributes a message posted through the API. Only the admin
+// token may leave client_id out, to post as the system bot; other callers
+// get 400, as does a client_id naming the bot.
+func assignAuthor(w http.ResponseWriter, r *http.Request, message *hub.Message) bool {
+	switch {
+	case message.ClientID == models.SystemUserID:
+		writeError(w, r, "client_id is reserved for the system bot", http.StatusBadRequest)
+		return false
+	case message.ClientID == "" && !middleware.IsAdmin(r.Context()):
+		writeError(w, r, "client_id is required", http.StatusBadRequest)
+		return false
+	}
+	message.AssignSystemAuthor()
+	return true
+}
+
+// BroadcastOrg sends a message to all groups in the specified organization.
+// Announcements without a client_id are posted by the system bot, which
+// requires the admin token.
 func (h *WebSocketHandler) BroadcastOrg(w http.ResponseWriter, r *http.Request) {
 	orgID := mux.Vars(r)["orgId"]
 
@@ -226,8 +667,37 @@ func (h *WebSocketHandler) BroadcastOrg(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "Invalid message format", http.StatusBadRequest)
 		return
 	}
+	message.StampReceived()
 
 	message.OrgID = orgID
+	message.Channel = "" // Channels are per group
+	if !assignAuthor(w, r, &message) {
+		return
+	}
+
+	if err := h.OrgHub.ValidateMessage(&message); err != nil {
+		http.Error(w, err.Error(), invalidMessageStatus(err))
+		return
+	}
+
+	// Persist the announcement once, referenced from every group's history
+	if h.MsgRepo != nil {
+		announcement := models.ChatMessage{
+			OrgID:       message.OrgID,
+			ClientID:    message.ClientID,
+			Content:     message.Content,
+			ContentType: message.ContentType,
+			Timestamp:   h.OrgHub.Now(),
+			Bot:         message.Bot,
+		}
+
+		announcement.Username = h.Usernames.Username(context.Background(), message.ClientID)
+
+		if err := h.MsgRepo.SaveAnnouncement(context.Background(), announcement, h.OrgHub.GetGroupIDs(orgID)); err != nil {
+			log.Printf("Error saving announcement to Redis: %v", err)
+			// Don't fail the request if Redis save fails
+		}
+	}
 
 	// Use the OrgHub broadcast method
 	h.OrgHub.BroadcastToOrg(orgID, &message)
@@ -236,13 +706,16 @@ func (h *WebSocketHandler) BroadcastOrg(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(map[string]string{"status": "Message broadcasted to organization"})
 }
 
-// BroadcastGroup sends a message to all clients in a specific group within an organization
+// BroadcastGroup sends a message to all clients in a specific group within
+// an organization. Messages without a client_id are posted by the system
+// bot, which requires the admin token and is not held to the group's rate
+// limit or freeze.
 func (h *WebSocketHandler) BroadcastGroup(w http.ResponseWriter, r *http.Request) {
 	orgID := mux.Vars(r)["orgId"]
 	groupID := mux.Vars(r)["groupId"]
 
 	// Check if group exists
-	_, exists := h.OrgHub.GetGroup(orgID, groupID)
+	group, exists := h.OrgHub.GetGroup(orgID, groupID)
 	if !exists {
 		http.Error(w, "Organization or group not found", http.StatusNotFound)
 		return
@@ -253,33 +726,88 @@ func (h *WebSocketHandler) BroadcastGroup(w http.ResponseWriter, r *http.Request
 		http.Error(w, "Invalid message format", http.StatusBadRequest)
 		return
 	}
+	message.StampReceived()
 
+	message.StripEvent()
 	message.OrgID = orgID
 	message.GroupID = groupID
+	if !assignAuthor(w, r, &message) {
+		return
+	}
+	if !message.Bot && !group.Allow() {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Group message rate exceeded", http.StatusTooManyRequests)
+		return
+	}
+
+	if err := h.OrgHub.ValidateMessage(&message); err != nil {
+		http.Error(w, err.Error(), invalidMessageStatus(err))
+		return
+	}
+	if err := group.CheckPost(message.ClientID); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if message.ExpiresAt != nil && !message.ExpiresAt.After(h.OrgHub.Now()) {
+		http.Error(w, "expires_at must be in the future", http.StatusBadRequest)
+		return
+	}
+	if message.ReplyToID != "" && !h.featureEnabled(r.Context(), orgID, models.FeatureThreads) {
+		http.Error(w, "Replies are disabled for this organization", http.StatusForbidden)
+		return
+	}
 
 	// Persist message to Redis
 	if h.MsgRepo != nil {
+		// A reply must reference a message stored in the same group
+		if message.ReplyToID != "" {
+			if _, err := h.MsgRepo.GetByID(r.Context(), orgID, groupID, message.ReplyToID); err != nil {
+				http.Error(w, "Replied-to message not found in this group", http.StatusBadRequest)
+				return
+			}
+		}
+
 		chatMsg := models.ChatMessage{
+			ID:        message.ID, // Optional client-supplied ID for idempotent retries
 			OrgID:     message.OrgID,
 			GroupID:   message.GroupID,
 			ClientID:  message.ClientID,
 			Content:   message.Content,
-			Timestamp: time.Now(),
+			Timestamp: h.OrgHub.Now(),
+			ReplyToID: message.ReplyToID,
+			Channel:   message.Channel,
+			ExpiresAt: message.ExpiresAt,
+
+			ContentType: message.ContentType,
+			AckRequired: message.AckRequired,
+			Bot:         message.Bot,
 		}
 
-		// Get username if UserRepo is available
-		if h.UserRepo != nil && message.ClientID != "" {
-			if user, err := h.UserRepo.GetByID(context.Background(), message.ClientID); err == nil {
-				chatMsg.Username = user.Username
-			}
-		}
+		chatMsg.Username = h.Usernames.Username(context.Background(), message.ClientID)
 
-		if err := h.MsgRepo.Save(context.Background(), chatMsg); err != nil {
+		saved, err := h.MsgRepo.Save(context.Background(), chatMsg)
+		if errors.Is(err, repository.ErrQuotaExceeded) {
+			http.Error(w, err.Error(), http.StatusInsufficientStorage)
+			return
+		}
+		if errors.Is(err, repository.ErrDuplicateMessage) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
 			log.Printf("Error saving message to Redis: %v", err)
 			// Don't fail the request if Redis save fails
+		} else {
+			message.ID = saved.ID
 		}
 	}
 
+	// Without a stored ID there is nothing for recipients to acknowledge
+	if message.ID == "" {
+		message.AckRequired = false
+	}
+
 	// Use the OrgHub broadcast method
 	h.OrgHub.BroadcastToGroup(orgID, groupID, &message)
 
@@ -287,6 +815,361 @@ func (h *WebSocketHandler) BroadcastGroup(w http.ResponseWriter, r *http.Request
 	json.NewEncoder(w).Encode(map[string]string{"status": "Message broadcasted to group"})
 }
 
+// SetGroupRateLimit overrides the throughput cap of a single group. The
+// override is stored with the org's settings, so it survives restarts, and
+// applied to the running group hub. The body is validated before anything
+// is stored or applied.
+func (h *WebSocketHandler) SetGroupRateLimit(w http.ResponseWriter, r *http.Request) {
+	orgID := mux.Vars(r)["orgId"]
+	groupID := mux.Vars(r)["groupId"]
+
+	var limit models.GroupRateLimit
+	if err := decodeJSON(r, &limit); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := limit.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	group, exists := h.OrgHub.GetGroup(orgID, groupID)
+	if !exists {
+		http.Error(w, "Organization or group not found", http.StatusNotFound)
+		return
+	}
+
+	if h.MsgRepo != nil {
+		if err := h.MsgRepo.SetGroupRateLimit(r.Context(), orgID, groupID, limit); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	group.SetRateLimit(limit.MessagesPerSecond, limit.Burst)
+	limit.MessagesPerSecond, limit.Burst = group.RateLimit()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(limit)
+}
+
+// SetGroupState freezes or unfreezes a group. While frozen, only org
+// owners and admins may post to it.
+func (h *WebSocketHandler) SetGroupState(w http.ResponseWriter, r *http.Request) {
+	orgID := mux.Vars(r)["orgId"]
+	groupID := mux.Vars(r)["groupId"]
+
+	group, exists := h.OrgHub.GetGroup(orgID, groupID)
+	if !exists {
+		http.Error(w, "Organization or group not found", http.StatusNotFound)
+		return
+	}
+
+	var state struct {
+		Frozen *bool `json:"frozen"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&state); err != nil || state.Frozen == nil {
+		http.Error(w, "Invalid request body: frozen is required", http.StatusBadRequest)
+		return
+	}
+
+	group.SetFrozen(*state.Frozen)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hub.GroupState{Frozen: group.Frozen()})
+}
+
+// DeleteMessage deletes a group message on behalf of its author, who must
+// be the caller, and tells the group's clients. The author can restore it
+// within the restore window. The admin token acts as the client_id query
+// parameter.
+func (h *WebSocketHandler) DeleteMessage(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	orgID, groupID, messageID := vars["orgId"], vars["groupId"], vars["messageId"]
+
+	clientID, ok := requireActor(w, r, r.URL.Query().Get("client_id"))
+	if !ok {
+		return
+	}
+	if clientID == "" {
+		http.Error(w, "client_id query parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	err := h.MsgRepo.CheckWindow(r.Context(), orgID, groupID, messageID, clientID, repository.WindowDelete)
+	switch {
+	case errors.Is(err, repository.ErrMessageNotFound):
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	case errors.Is(err, repository.ErrDeleteWindowClosed):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	_, err = h.MsgRepo.SoftDelete(r.Context(), orgID, groupID, messageID, clientID)
+	switch {
+	case errors.Is(err, repository.ErrMessageNotFound):
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	case errors.Is(err, repository.ErrNotMessageAuthor):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.OrgHub.BroadcastToGroup(orgID, groupID, hub.NewDeleteEvent(orgID, groupID, messageID))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RestoreMessage reinstates a message its author, who must be the caller,
+// deleted within the restore window and tells the group's clients. The
+// admin token acts as the client_id query parameter.
+func (h *WebSocketHandler) RestoreMessage(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	orgID, groupID, messageID := vars["orgId"], vars["groupId"], vars["messageId"]
+
+	clientID, ok := requireActor(w, r, r.URL.Query().Get("client_id"))
+	if !ok {
+		return
+	}
+	if clientID == "" {
+		http.Error(w, "client_id query parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	msg, err := h.MsgRepo.Restore(r.Context(), orgID, groupID, messageID, clientID)
+	switch {
+	case errors.Is(err, repository.ErrMessageNotFound):
+		http.Error(w, "No deleted message to restore (the restore window may have passed)", http.StatusNotFound)
+		return
+	case errors.Is(err, repository.ErrNotMessageAuthor):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.OrgHub.BroadcastToGroup(orgID, groupID, hub.NewRestoreEvent(orgID, groupID, messageID, msg, h.OrgHub.Now()))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(msg)
+}
+
+// ForwardMessage copies a group message into another group of the same
+// organization or into a direct message, attributed to the forwarding user
+// and referencing the original. The forwarder is the caller, or the body's
+// client_id for the admin token, and must belong to the source
+// organization; the copy is stored and delivered like a new message.
+func (h *WebSocketHandler) ForwardMessage(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	orgID, groupID, messageID := vars["orgId"], vars["groupId"], vars["messageId"]
+
+	var req models.ForwardMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	forwarderID, ok := requireActor(w, r, req.ClientID)
+	if !ok {
+		return
+	}
+	req.ClientID = forwarderID
+	if req.ClientID == "" || (req.GroupID == "") == (req.RecipientID == "") {
+		http.Error(w, "client_id and exactly one of group_id or recipient_id are required", http.StatusBadRequest)
+		return
+	}
+
+	// Reading the source requires membership of its organization
+	forwarder, err := h.UserRepo.GetByID(r.Context(), req.ClientID)
+	if err != nil || forwarder.OrgID != orgID {
+		http.Error(w, "User does not belong to this organization", http.StatusForbidden)
+		return
+	}
+
+	source, err := h.MsgRepo.GetByID(r.Context(), orgID, groupID, messageID)
+	if errors.Is(err, repository.ErrMessageNotFound) {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ref := source.ForwardedFrom // Forwarding a forward keeps the original reference
+	if ref == nil {
+		ref = &models.ForwardRef{
+			OrgID:     orgID,
+			GroupID:   groupID,
+			MessageID: source.ID,
+			ClientID:  source.ClientID,
+			Username:  source.Username,
+		}
+	}
+
+	// Stored content is already sanitized; undo it so it is not sanitized twice
+	content := h.MsgRepo.Unsanitize(source.Content, source.ContentType)
+	message := hub.Message{
+		ClientID:      req.ClientID,
+		Content:       content,
+		ContentType:   source.ContentType,
+		Timestamp:     h.OrgHub.Now(),
+		ForwardedFrom: ref,
+	}
+	message.StampReceived()
+	chatMsg := models.ChatMessage{
+		ClientID:      req.ClientID,
+		Username:      forwarder.Username,
+		Content:       content,
+		ContentType:   source.ContentType,
+		Timestamp:     message.Timestamp,
+		ForwardedFrom: ref,
+	}
+
+	var target *hub.GroupHub
+	if req.GroupID != "" {
+		group, exists := h.OrgHub.GetGroup(orgID, req.GroupID)
+		if !exists {
+			http.Error(w, "Target group not found", http.StatusNotFound)
+			return
+		}
+		if err := group.CheckPost(req.ClientID); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if !group.Allow() {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Group message rate exceeded", http.StatusTooManyRequests)
+			return
+		}
+		target = group
+		message.OrgID, message.GroupID = orgID, req.GroupID
+	} else {
+		if !h.dmEnabled(r.Context(), req.ClientID) {
+			http.Error(w, "Direct messages are disabled for this organization", http.StatusForbidden)
+			return
+		}
+		if _, err := h.UserRepo.GetByID(r.Context(), req.RecipientID); err != nil {
+			http.Error(w, "Recipient not found", http.StatusNotFound)
+			return
+		}
+		message.OrgID, message.GroupID = repository.DMOrgID, h.getDMRoomID(req.ClientID, req.RecipientID)
+		message.RecipientID = req.RecipientID
+		chatMsg.RecipientID = req.RecipientID
+	}
+	chatMsg.OrgID, chatMsg.GroupID = message.OrgID, message.GroupID
+
+	if err := h.OrgHub.ValidateMessage(&message); err != nil {
+		http.Error(w, err.Error(), invalidMessageStatus(err))
+		return
+	}
+
+	saved, err := h.MsgRepo.Save(r.Context(), chatMsg)
+	if errors.Is(err, repository.ErrQuotaExceeded) {
+		http.Error(w, err.Error(), http.StatusInsufficientStorage)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	message.ID = saved.ID
+
+	if target != nil {
+		h.OrgHub.BroadcastToGroup(orgID, target.GroupID, &message)
+	} else {
+		h.OrgHub.SendDirectMessage(req.RecipientID, &message)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(saved)
+}
+
+// maxResyncMessages bounds how many stored messages a resync replays.
+const maxResyncMessages = 200
+
+// ResyncGroup replays the group's most recent stored messages to every
+// connected client as a single history frame, so clients that missed
+// deliveries can reconcile their view.
+func (h *WebSocketHandler) ResyncGroup(w http.ResponseWriter, r *http.Request) {
+	orgID := mux.Vars(r)["orgId"]
+	groupID := mux.Vars(r)["groupId"]
+
+	if _, exists := h.OrgHub.GetGroup(orgID, groupID); !exists {
+		http.Error(w, "Organization or group not found", http.StatusNotFound)
+		return
+	}
+
+	limit := int64(50)
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		l, err := strconv.ParseInt(limitStr, 10, 64)
+		if err != nil || l <= 0 || l > maxResyncMessages {
+			http.Error(w, "limit must be between 1 and 200", http.StatusBadRequest)
+			return
+		}
+		limit = l
+	}
+
+	messages, err := h.MsgRepo.GetHistory(r.Context(), orgID, groupID, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// History is newest first; replay in the order the messages were sent
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	h.OrgHub.BroadcastToGroup(orgID, groupID, hub.NewHistoryFrame(orgID, groupID, messages, h.OrgHub.Now()))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":   "resync queued",
+		"messages": len(messages),
+	})
+}
+
+// DebugGroup reports a group's in-memory clients, buffer occupancy and
+// goroutine state, for diagnosing stuck or slow groups.
+func (h *WebSocketHandler) DebugGroup(w http.ResponseWriter, r *http.Request) {
+	orgID := mux.Vars(r)["orgId"]
+	groupID := mux.Vars(r)["groupId"]
+
+	group, exists := h.OrgHub.GetGroup(orgID, groupID)
+	if !exists {
+		http.Error(w, "Organization or group not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(group.Debug())
+}
+
+// FlushGroup discards the broadcasts queued for a group without delivering them.
+func (h *WebSocketHandler) FlushGroup(w http.ResponseWriter, r *http.Request) {
+	orgID := mux.Vars(r)["orgId"]
+	groupID := mux.Vars(r)["groupId"]
+
+	group, exists := h.OrgHub.GetGroup(orgID, groupID)
+	if !exists {
+		http.Error(w, "Organization or group not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "broadcast buffer flushed",
+		"flushed": group.Flush(),
+	})
+}
+
 // ConnectDM establishes a WebSocket connection for direct messaging
 func (h *WebSocketHandler) ConnectDM(w http.ResponseWriter, r *http.Request) {
 	userID := mux.Vars(r)["userId"]
@@ -295,88 +1178,169 @@ func (h *WebSocketHandler) ConnectDM(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "userId is required", http.StatusBadRequest)
 		return
 	}
+	if userID == models.SystemUserID {
+		http.Error(w, "userId is reserved for the system bot", http.StatusBadRequest)
+		return
+	}
+	// The user's organization is looked up once; each frame then only
+	// checks its (cached) DM flag
+	orgID := h.dmOrg(r.Context(), userID)
+	if !h.orgDMEnabled(r.Context(), orgID) {
+		http.Error(w, "Direct messages are disabled for this organization", http.StatusForbidden)
+		return
+	}
 
-	conn, err := upgrader.Upgrade(w, r, nil)
+	_, expiresAt, ok := h.authenticate(w, r, userID)
+	if !ok {
+		return
+	}
+
+	conn, version, err := h.upgrade(w, r, "", userID)
 	if err != nil {
 		log.Printf("Failed to upgrade WebSocket connection: %v", err)
 		return
 	}
 
 	// Create a client for DM (Group is nil for DM clients)
-	client := &hub.Client{
-		ID:    userID,
-		Conn:  conn,
-		Group: nil, // DM clients don't belong to a group
-		Send:  make(chan *hub.Message, 256),
-	}
+	client := hub.NewClient(h.OrgHub, userID, conn, nil, h.compressed(r), version)
+	client.SetTokenExpiry(expiresAt)
 
 	// Register with OrgHub for DM
 	h.OrgHub.RegisterDM <- client
 
 	// Start read and write pumps
 	go client.WritePump()
-	go h.readPumpDM(client)
+	go h.readPumpDM(client, orgID)
+
+	if h.MsgRepo != nil {
+		h.sendMissed(client, "", "", false)
+	}
 
 	log.Printf("Client %s connected for direct messaging", userID)
 }
 
-// readPumpDM handles incoming DM messages from WebSocket
-func (h *WebSocketHandler) readPumpDM(client *hub.Client) {
+// readPumpDM handles incoming DM messages from WebSocket. orgID is the
+// client's organization, as found by dmOrg.
+func (h *WebSocketHandler) readPumpDM(client *hub.Client, orgID string) {
 	defer func() {
 		h.OrgHub.UnregisterDM <- client
 		client.Conn.Close()
 	}()
 
-	client.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
-	client.Conn.SetPongHandler(func(string) error {
-		client.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
-		return nil
-	})
+	client.StartKeepAlive(60 * time.Second)
+	client.Conn.SetReadLimit(h.cfg.MaxMessageSize)
 
 	for {
-		var message hub.Message
-		err := client.Conn.ReadJSON(&message)
+		var frame dmFrame
+		err := client.Conn.ReadJSON(&frame)
 		if err != nil {
+			if hub.IsDecodeError(err) {
+				client.SendError(hub.ErrCodeInvalidMessage, "Message is not valid JSON", nil)
+				continue
+			}
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("WebSocket error: %v", err)
 			}
 			break
 		}
+		frame.StampReceived()
+
+		if frame.Type == hub.TypeReauth {
+			client.Reauth(&frame.Message)
+			continue
+		}
+		if !client.Authorized() {
+			break
+		}
 
-		// Set sender ID and timestamp
+		// Set sender ID and timestamp; clients may only send chat messages
+		message := frame.Message
+		message.StripEvent()
 		message.ClientID = client.ID
-		message.Timestamp = time.Now()
+		message.Channel = "" // Channels are per group
+		message.Timestamp = h.OrgHub.Now()
+
+		if message.RecipientID == "" {
+			client.SendError(hub.ErrCodeInvalidMessage, "recipient_id is required", nil)
+			continue
+		}
+		if err := h.OrgHub.ValidateMessage(&message); err != nil {
+			client.SendInvalid(err)
+			continue
+		}
+		if err := h.OrgHub.ApplyDMExpiry(&message, frame.ExpiresIn); err != nil {
+			client.SendError(hub.ErrCodeInvalidMessage, err.Error(), nil)
+			continue
+		}
+		if !h.orgDMEnabled(context.Background(), orgID) {
+			client.SendError(hub.ErrCodeFeatureDisabled, "Direct messages are disabled for this organization", nil)
+			continue
+		}
 
 		// Persist DM to Redis
-		if h.MsgRepo != nil && message.RecipientID != "" {
+		if h.MsgRepo != nil {
+			roomID := h.getDMRoomID(client.ID, message.RecipientID)
+
+			// Replies to messages outside this conversation are stored without the reference
+			if message.ReplyToID != "" {
+				if _, err := h.MsgRepo.GetByID(context.Background(), "dm", roomID, message.ReplyToID); err != nil {
+					message.ReplyToID = ""
+				}
+			}
+
 			chatMsg := models.ChatMessage{
+				ID:          message.ID,
 				OrgID:       "dm", // Special org ID for direct messages
-				GroupID:     h.getDMRoomID(client.ID, message.RecipientID),
+				GroupID:     roomID,
 				ClientID:    message.ClientID,
 				Content:     message.Content,
+				ContentType: message.ContentType,
 				Timestamp:   message.Timestamp,
 				RecipientID: message.RecipientID,
+				ReplyToID:   message.ReplyToID,
+				ExpiresAt:   message.ExpiresAt,
 			}
 
-			// Get username if available
-			if h.UserRepo != nil {
-				if user, err := h.UserRepo.GetByID(context.Background(), client.ID); err == nil {
-					chatMsg.Username = user.Username
-				}
-			}
+			chatMsg.Username = h.Usernames.Username(context.Background(), client.ID)
 
-			if err := h.MsgRepo.Save(context.Background(), chatMsg); err != nil {
+			saved, err := h.MsgRepo.Save(context.Background(), chatMsg)
+			if errors.Is(err, repository.ErrDuplicateMessage) {
+				client.SendError(hub.ErrCodeInvalidMessage, err.Error(), map[string]interface{}{"id": message.ID})
+				continue
+			}
+			if err != nil {
+				// Not delivered either, so the client can safely resend it
 				log.Printf("Error saving DM to Redis: %v", err)
+				client.SendError(hub.ErrCodeInternal, "Message could not be stored", map[string]interface{}{"id": message.ID})
+				continue
 			}
+			message.ID = saved.ID
 		}
 
 		// Send message to recipient
-		if message.RecipientID != "" {
-			sent := h.OrgHub.SendDirectMessage(message.RecipientID, &message)
-			if !sent {
-				log.Printf("Failed to send DM to %s (user not connected)", message.RecipientID)
-			}
+		sent := h.OrgHub.SendDirectMessage(message.RecipientID, &message)
+		if !sent {
+			log.Printf("Failed to send DM to %s (user not connected)", message.RecipientID)
+			continue
 		}
+		h.recordDMDelivery(context.Background(), h.getDMRoomID(client.ID, message.RecipientID), message.ID)
+	}
+}
+
+// recordDMDelivery notes that direct messages reached their recipient.
+// Empty IDs, of messages that could not be stored, are skipped.
+func (h *WebSocketHandler) recordDMDelivery(ctx context.Context, roomID string, messageIDs ...string) {
+	if h.MsgRepo == nil {
+		return
+	}
+	ids := make([]string, 0, len(messageIDs))
+	for _, id := range messageIDs {
+		if id != "" {
+			ids = append(ids, id)
+		}
+	}
+	if err := h.MsgRepo.RecordDMDelivery(ctx, roomID, ids, h.OrgHub.Now()); err != nil {
+		log.Printf("Error recording delivery of DMs in %s: %v", roomID, err)
 	}
 }
 
@@ -385,36 +1349,75 @@ func (h *WebSocketHandler) SendDM(w http.ResponseWriter, r *http.Request) {
 	senderID := mux.Vars(r)["userId"]
 	recipientID := mux.Vars(r)["recipientId"]
 
-	var message hub.Message
-	if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+	var frame dmFrame
+	if err := json.NewDecoder(r.Body).Decode(&frame); err != nil {
 		http.Error(w, "Invalid message format", http.StatusBadRequest)
 		return
 	}
+	frame.StampReceived()
 
+	message := frame.Message
+	message.StripEvent()
 	message.ClientID = senderID
 	message.RecipientID = recipientID
-	message.Timestamp = time.Now()
+	message.Channel = "" // Channels are per group
+	message.Timestamp = h.OrgHub.Now()
+
+	if err := h.OrgHub.ValidateMessage(&message); err != nil {
+		http.Error(w, err.Error(), invalidMessageStatus(err))
+		return
+	}
+
+	if !h.dmEnabled(r.Context(), senderID) {
+		http.Error(w, "Direct messages are disabled for this organization", http.StatusForbidden)
+		return
+	}
+
+	if message.ExpiresAt != nil && !message.ExpiresAt.After(message.Timestamp) {
+		http.Error(w, "expires_at must be in the future", http.StatusBadRequest)
+		return
+	}
+	if err := h.OrgHub.ApplyDMExpiry(&message, frame.ExpiresIn); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	// Persist DM to Redis
 	if h.MsgRepo != nil {
+		roomID := h.getDMRoomID(senderID, recipientID)
+
+		// A reply must reference a message from the same conversation
+		if message.ReplyToID != "" {
+			if _, err := h.MsgRepo.GetByID(r.Context(), "dm", roomID, message.ReplyToID); err != nil {
+				http.Error(w, "Replied-to message not found in this conversation", http.StatusBadRequest)
+				return
+			}
+		}
+
 		chatMsg := models.ChatMessage{
+			ID:          message.ID,
 			OrgID:       "dm",
-			GroupID:     h.getDMRoomID(senderID, recipientID),
+			GroupID:     roomID,
 			ClientID:    senderID,
 			Content:     message.Content,
+			ContentType: message.ContentType,
 			Timestamp:   message.Timestamp,
 			RecipientID: recipientID,
+			ReplyToID:   message.ReplyToID,
+			ExpiresAt:   message.ExpiresAt,
 		}
 
-		// Get username if available
-		if h.UserRepo != nil {
-			if user, err := h.UserRepo.GetByID(context.Background(), senderID); err == nil {
-				chatMsg.Username = user.Username
-			}
-		}
+		chatMsg.Username = h.Usernames.Username(context.Background(), senderID)
 
-		if err := h.MsgRepo.Save(context.Background(), chatMsg); err != nil {
+		saved, err := h.MsgRepo.Save(context.Background(), chatMsg)
+		if errors.Is(err, repository.ErrDuplicateMessage) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
 			log.Printf("Error saving DM to Redis: %v", err)
+		} else {
+			message.ID = saved.ID
 		}
 	}
 
@@ -424,12 +1427,15 @@ func (h *WebSocketHandler) SendDM(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Recipient not connected", http.StatusNotFound)
 		return
 	}
+	h.recordDMDelivery(r.Context(), h.getDMRoomID(senderID, recipientID), message.ID)
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"status": "Direct message sent"})
 }
 
-// GetDMHistory retrieves direct message history between two users
+// GetDMHistory retrieves direct message history between two users, with
+// the delivery state of each message. Messages to the requesting user
+// count as delivered from then on.
 func (h *WebSocketHandler) GetDMHistory(w http.ResponseWriter, r *http.Request) {
 	user1 := mux.Vars(r)["userId"]
 	user2 := mux.Vars(r)["recipientId"]
@@ -442,10 +1448,91 @@ func (h *WebSocketHandler) GetDMHistory(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	var received []string
+	for _, msg := range messages {
+		if msg.RecipientID == user1 {
+			received = append(received, msg.ID)
+		}
+	}
+	h.recordDMDelivery(r.Context(), dmRoomID, received...)
+	if err := h.MsgRepo.AttachDMReceipts(r.Context(), dmRoomID, messages); err != nil {
+		log.Printf("Error getting DM receipts for %s: %v", dmRoomID, err)
+	}
+
+	if r.URL.Query().Get("quotes") == "true" {
+		h.MsgRepo.ResolveQuotes(r.Context(), "dm", dmRoomID, messages)
+	}
+	if r.URL.Query().Get("usernames") == "true" {
+		h.Usernames.Fill(r.Context(), messages)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(messages)
 }
 
+// GetDMConversations lists a user's DM conversations with last-message previews,
+// most recently active first
+func (h *WebSocketHandler) GetDMConversations(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["userId"]
+
+	limit := int64(20)
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.ParseInt(limitStr, 10, 64); err == nil && l > 0 && l <= 100 {
+			limit = l
+		}
+	}
+
+	conversations, err := h.MsgRepo.GetDMConversations(r.Context(), userID, limit)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to retrieve DM conversations: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"conversations": conversations,
+		"count":         len(conversations),
+	})
+}
+
+// MarkDMRead marks a DM conversation as read up to now for the user
+func (h *WebSocketHandler) MarkDMRead(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["userId"]
+	peerID := mux.Vars(r)["recipientId"]
+
+	if err := h.MsgRepo.MarkRead(r.Context(), userID, repository.DMOrgID, h.getDMRoomID(userID, peerID), h.OrgHub.Now()); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to mark conversation as read: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// MarkAllRead marks every group of the user's organization as read up to
+// now, and with include_dms=true every DM conversation too
+func (h *WebSocketHandler) MarkAllRead(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["userId"]
+	includeDMs, _ := strconv.ParseBool(r.URL.Query().Get("include_dms"))
+
+	user, err := h.UserRepo.GetByID(r.Context(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	cleared, err := h.MsgRepo.MarkAllRead(r.Context(), userID, user.OrgID, h.OrgHub.GetGroupIDs(user.OrgID), includeDMs, h.OrgHub.Now())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to mark conversations as read: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user_id": userID,
+		"cleared": cleared,
+	})
+}
+
 // GetConnectedUsers returns a list of users currently connected for DM
 func (h *WebSocketHandler) GetConnectedUsers(w http.ResponseWriter, r *http.Request) {
 	users := h.OrgHub.GetConnectedDMUsers()
@@ -465,3 +1552,27 @@ func (h *WebSocketHandler) getDMRoomID(user1, user2 string) string {
 	}
 	return fmt.Sprintf("%s_%s", user2, user1)
 }
+
+// GetMaintenance reports whether maintenance mode is on.
+func (h *WebSocketHandler) GetMaintenance(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"enabled": h.OrgHub.InMaintenance()})
+}
+
+// SetMaintenance turns maintenance mode on or off. While it is on, new
+// WebSocket connections and the readiness check get 503, so load balancers
+// stop routing new traffic here while existing connections drain.
+func (h *WebSocketHandler) SetMaintenance(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Enabled == nil {
+		http.Error(w, "enabled (boolean) is required", http.StatusBadRequest)
+		return
+	}
+
+	h.OrgHub.SetMaintenance(*req.Enabled)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"enabled": *req.Enabled})
+}
@@ -0,0 +1,1191 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"go-realtime-workspace/clock"
+	"go-realtime-workspace/config"
+	"go-realtime-workspace/hub"
+	"go-realtime-workspace/models"
+	"go-realtime-workspace/repository"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/redis/go-redis/v9"
+)
+
+// newJoinServer serves JoinGroup for the group acme/general of a new hub,
+// whose configuration is adjusted by configure if it is not nil. With auth,
+// connections are authenticated with userTokens.
+func newJoinServer(t *testing.T, auth bool, configure func(*config.WebSocketConfig)) *httptest.Server {
+	t.Helper()
+	return serveJoin(t, newJoinHandler(t, auth, configure))
+}
+
+// newJoinHandler returns the handler newJoinServer serves.
+func newJoinHandler(t *testing.T, auth bool, configure func(*config.WebSocketConfig)) *WebSocketHandler {
+	t.Helper()
+	cfg := config.DefaultConfig()
+	if configure != nil {
+		configure(&cfg.WebSocket)
+	}
+	o := hub.NewOrgHub(cfg.WebSocket, cfg.Message)
+	if auth {
+		o.SetTokenVerifier(userTokens{})
+	}
+	o.StartGroup(hub.NewGroupHub(o, "acme", "general"))
+	return NewWebSocketHandler(o, nil, nil, nil, cfg.WebSocket)
+}
+
+// serveJoin serves h's JoinGroup.
+func serveJoin(t *testing.T, h *WebSocketHandler) *httptest.Server {
+	t.Helper()
+	r := mux.NewRouter()
+	r.HandleFunc("/ws/orgs/{orgId}/groups/{groupId}", h.JoinGroup)
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// joinGroup connects to srv's group with the given query parameters and
+// returns the client ID of its connection_info frame, or the HTTP status
+// the handshake was refused with.
+func joinGroup(t *testing.T, srv *httptest.Server, params url.Values) (clientID string, status int) {
+	t.Helper()
+	u := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws/orgs/acme/groups/general?" + params.Encode()
+	conn, resp, err := websocket.DefaultDialer.Dial(u, nil)
+	if err != nil {
+		if resp == nil {
+			t.Fatalf("dial: %v", err)
+		}
+		return "", resp.StatusCode
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var frame hub.Message
+	if err := conn.ReadJSON(&frame); err != nil {
+		t.Fatalf("read connection_info: %v", err)
+	}
+	if frame.Type != hub.TypeConnectionInfo {
+		t.Fatalf("first frame is %q, want connection_info", frame.Type)
+	}
+	return frame.ClientID, http.StatusSwitchingProtocols
+}
+
+func TestJoinGroupTakesClientIDFromToken(t *testing.T) {
+	// AssignClientIDs must not replace the authenticated user
+	srv := newJoinServer(t, true, func(cfg *config.WebSocketConfig) {
+		cfg.AssignClientIDs = true
+	})
+
+	tests := []struct {
+		name   string
+		params url.Values
+		wantID string
+		status int
+	}{
+		{name: "token only", params: url.Values{"token": {"alice"}}, wantID: "alice", status: http.StatusSwitchingProtocols},
+		{name: "matching clientId", params: url.Values{"token": {"alice"}, "clientId": {"alice"}}, wantID: "alice", status: http.StatusSwitchingProtocols},
+		{name: "another user's clientId", params: url.Values{"token": {"alice"}, "clientId": {"bob"}}, status: http.StatusForbidden},
+		{name: "no token", params: url.Values{"clientId": {"alice"}}, status: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		clientID, status := joinGroup(t, srv, tt.params)
+		if status != tt.status || clientID != tt.wantID {
+			t.Errorf("%s: got %q with status %d, want %q with %d", tt.name, clientID, status, tt.wantID, tt.status)
+		}
+	}
+}
+
+func TestJoinGroupAssignsClientIDs(t *testing.T) {
+	srv := newJoinServer(t, false, func(cfg *config.WebSocketConfig) {
+		cfg.AssignClientIDs = true
+	})
+
+	clientID, status := joinGroup(t, srv, url.Values{"clientId": {"alice"}})
+	if status != http.StatusSwitchingProtocols {
+		t.Fatalf("status %d", status)
+	}
+	if _, err := uuid.Parse(clientID); err != nil {
+		t.Errorf("client ID %q is not a server-assigned UUID", clientID)
+	}
+
+	// Without assignment the parameter is trusted, and required
+	srv = newJoinServer(t, false, nil)
+	if clientID, _ := joinGroup(t, srv, url.Values{"clientId": {"alice"}}); clientID != "alice" {
+		t.Errorf("got client ID %q, want alice", clientID)
+	}
+	if _, status := joinGroup(t, srv, nil); status != http.StatusBadRequest {
+		t.Errorf("without clientId: status %d, want 400", status)
+	}
+}
+
+func TestDMConnectionLooksUpOrgOnce(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+	redisSrv := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: redisSrv.Addr()})
+	defer client.Close()
+
+	cfg := config.DefaultConfig()
+	o := hub.NewOrgHub(cfg.WebSocket, cfg.Message)
+	go o.Run() // Registers DM clients
+	features := repository.NewFeatureRepository(db, client, time.Minute)
+	features.SetLocalTTL(time.Minute)
+	h := NewWebSocketHandler(o, nil, repository.NewUserRepository(db, cfg.User), features, cfg.WebSocket)
+	r := mux.NewRouter()
+	r.HandleFunc("/ws/dm/{userId}", h.ConnectDM)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	now := time.Now()
+	mock.ExpectQuery("FROM users WHERE id").WithArgs("alice").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "email", "full_name", "avatar_url", "bio", "org_id", "role", "created_at", "updated_at"}).
+			AddRow("alice", "alice", "alice@example.com", "", "", "", "acme", "member", now, now))
+	mock.ExpectQuery("FROM org_features").WithArgs("acme").
+		WillReturnRows(sqlmock.NewRows([]string{"feature", "enabled"}))
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws/dm/alice", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	// Turning DMs off reaches the open connection without another user lookup
+	mock.ExpectExec("INSERT INTO org_features").WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := features.SetFeature(context.Background(), "acme", models.FeatureDM, false); err != nil {
+		t.Fatalf("SetFeature: %v", err)
+	}
+	mock.ExpectQuery("FROM org_features").WithArgs("acme").
+		WillReturnRows(sqlmock.NewRows([]string{"feature", "enabled"}).AddRow(models.FeatureDM, false))
+
+	if err := conn.WriteJSON(map[string]string{"recipient_id": "bob", "content": "hi"}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var frame struct {
+			Type string `json:"type"`
+			Data struct {
+				Code string `json:"code"`
+			} `json:"data"`
+		}
+		if err := conn.ReadJSON(&frame); err != nil {
+			t.Fatalf("waiting for the feature_disabled error: %v", err)
+		}
+		if frame.Type == hub.TypeError {
+			if frame.Data.Code != hub.ErrCodeFeatureDisabled {
+				t.Fatalf("error %q, want %q", frame.Data.Code, hub.ErrCodeFeatureDisabled)
+			}
+			break
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGroupRateLimitIsStored(t *testing.T) {
+	redisSrv := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: redisSrv.Addr()})
+	defer client.Close()
+
+	cfg := config.DefaultConfig()
+	repo := repository.NewMessageRepository(client, cfg.Redis, cfg.Message)
+	o := hub.NewOrgHub(cfg.WebSocket, cfg.Message)
+	o.StartGroup(hub.NewGroupHub(o, "acme", "general"))
+	h := NewWebSocketHandler(o, repo, nil, nil, cfg.WebSocket)
+
+	put := func(groupID, body string) int {
+		req := httptest.NewRequest(http.MethodPut, "/api/v1/orgs/acme/groups/"+groupID+"/rate-limit", strings.NewReader(body))
+		req = mux.SetURLVars(req, map[string]string{"orgId": "acme", "groupId": groupID})
+		rec := httptest.NewRecorder()
+		h.SetGroupRateLimit(rec, req)
+		return rec.Code
+	}
+
+	for body, want := range map[string]int{
+		`{"messages_per_second": -1, "burst": 5}`:  http.StatusBadRequest,
+		`{"messages_per_second": 5, "burts": 5}`:   http.StatusBadRequest,
+		`{"messages_per_second": 5, "burst": 5} x`: http.StatusBadRequest,
+	} {
+		if got := put("general", body); got != want {
+			t.Errorf("%s: status %d, want %d", body, got, want)
+		}
+	}
+	if _, ok, _ := repo.GroupRateLimit(context.Background(), "acme", "general"); ok {
+		t.Fatal("an invalid limit was stored")
+	}
+	if got := put("missing", `{"messages_per_second": 5, "burst": 5}`); got != http.StatusNotFound {
+		t.Errorf("unknown group: status %d, want 404", got)
+	}
+
+	if got := put("general", `{"messages_per_second": 5, "burst": 10}`); got != http.StatusOK {
+		t.Fatalf("status %d, want 200", got)
+	}
+
+	// A hub started later, as after a restart, applies the stored override
+	restarted := hub.NewOrgHub(cfg.WebSocket, cfg.Message)
+	restarted.SetRateLimitStore(repo)
+	group := hub.NewGroupHub(restarted, "acme", "general")
+	restarted.StartGroup(group)
+	if rate, burst := group.RateLimit(); rate != 5 || burst != 10 {
+		t.Errorf("restarted group capped at %v/s with burst %d, want 5/s with burst 10", rate, burst)
+	}
+}
+
+// stalledWriter is a ResponseWriter whose hijacked connection is never
+// read by the peer, so writing the handshake response blocks.
+type stalledWriter struct {
+	*httptest.ResponseRecorder
+	conn net.Conn
+}
+
+func (w stalledWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.conn, bufio.NewReadWriter(bufio.NewReader(w.conn), bufio.NewWriter(w.conn)), nil
+}
+
+// stallUpgrade starts an upgrade through h whose handshake stalls until the
+// handshake timeout, and returns the upgrade's error once it gives up.
+func stallUpgrade(t *testing.T, h *WebSocketHandler) <-chan error {
+	t.Helper()
+	server, client := net.Pipe()
+	t.Cleanup(func() { client.Close() })
+
+	req := httptest.NewRequest(http.MethodGet, "/ws/orgs/acme/groups/general", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := h.upgrade(stalledWriter{httptest.NewRecorder(), server}, req, "acme", "alice")
+		done <- err
+	}()
+	return done
+}
+
+func TestHandshakeTimesOut(t *testing.T) {
+	h := newJoinHandler(t, false, func(cfg *config.WebSocketConfig) {
+		cfg.HandshakeTimeout = 50 * time.Millisecond
+	})
+
+	select {
+	case err := <-stallUpgrade(t, h):
+		var netErr net.Error
+		if !errors.As(err, &netErr) || !netErr.Timeout() {
+			t.Errorf("got %v, want a timeout", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stalled handshake never timed out")
+	}
+	if pending := h.pendingUpgrades.Load(); pending != 0 {
+		t.Errorf("%d upgrades still pending", pending)
+	}
+}
+
+func TestPendingUpgradesAreCapped(t *testing.T) {
+	h := newJoinHandler(t, false, func(cfg *config.WebSocketConfig) {
+		cfg.HandshakeTimeout = 200 * time.Millisecond
+		cfg.MaxPendingUpgrades = 1
+	})
+	srv := serveJoin(t, h)
+
+	stalled := stallUpgrade(t, h)
+	for h.pendingUpgrades.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	u := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws/orgs/acme/groups/general?clientId=bob"
+	_, resp, err := websocket.DefaultDialer.Dial(u, nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("while a handshake is pending: got %v (%+v), want 503", err, resp)
+	}
+	var rejection upgradeRejection
+	if err := json.NewDecoder(resp.Body).Decode(&rejection); err != nil {
+		t.Fatalf("decode rejection: %v", err)
+	}
+	if rejection.Reason != rejectPending || rejection.Limit != 1 || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("rejection %+v (Retry-After %q), want pending_upgrades with limit 1", rejection, resp.Header.Get("Retry-After"))
+	}
+
+	// The slot frees up once the stalled handshake gives up
+	<-stalled
+	if _, status := joinGroup(t, srv, url.Values{"clientId": {"bob"}}); status != http.StatusSwitchingProtocols {
+		t.Errorf("after the timeout: status %d, want 101", status)
+	}
+}
+
+func TestBroadcastRejectsReplyToMissingMessage(t *testing.T) {
+	redisSrv := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: redisSrv.Addr()})
+	defer client.Close()
+
+	cfg := config.DefaultConfig()
+	repo := repository.NewMessageRepository(client, cfg.Redis, cfg.Message)
+	o := hub.NewOrgHub(cfg.WebSocket, cfg.Message)
+	o.StartGroup(hub.NewGroupHub(o, "acme", "general"))
+	h := NewWebSocketHandler(o, repo, nil, nil, cfg.WebSocket)
+
+	post := func(body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/orgs/acme/groups/general/broadcast", strings.NewReader(body))
+		req = mux.SetURLVars(req, map[string]string{"orgId": "acme", "groupId": "general"})
+		rec := httptest.NewRecorder()
+		h.BroadcastGroup(rec, req)
+		return rec.Code
+	}
+
+	if got := post(`{"id": "m1", "client_id": "alice", "content": "lunch?"}`); got != http.StatusOK {
+		t.Fatalf("original: status %d, want 200", got)
+	}
+	if got := post(`{"client_id": "bob", "content": "sure", "reply_to_id": "m1"}`); got != http.StatusOK {
+		t.Errorf("reply: status %d, want 200", got)
+	}
+	if got := post(`{"client_id": "bob", "content": "what?", "reply_to_id": "missing"}`); got != http.StatusBadRequest {
+		t.Errorf("reply to a missing message: status %d, want 400", got)
+	}
+
+	history, err := repo.GetHistory(context.Background(), "acme", "general", 10)
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	if len(history) != 2 {
+		t.Errorf("stored %d messages, want 2", len(history))
+	}
+}
+
+func TestResyncReplaysHistoryToConnectedClients(t *testing.T) {
+	redisSrv := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: redisSrv.Addr()})
+	defer client.Close()
+
+	cfg := config.DefaultConfig()
+	repo := repository.NewMessageRepository(client, cfg.Redis, cfg.Message)
+	o := hub.NewOrgHub(cfg.WebSocket, cfg.Message)
+	group := hub.NewGroupHub(o, "acme", "general")
+	o.StartGroup(group)
+	h := NewWebSocketHandler(o, repo, nil, nil, cfg.WebSocket)
+	srv := serveJoin(t, h)
+
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, id := range []string{"m1", "m2", "m3"} {
+		msg := models.ChatMessage{ID: id, OrgID: "acme", GroupID: "general", ClientID: "alice", Content: id, Timestamp: start.Add(time.Duration(i) * time.Second)}
+		if _, err := repo.Save(context.Background(), msg); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+
+	var conns []*websocket.Conn
+	for _, id := range []string{"alice", "bob"} {
+		u := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws/orgs/acme/groups/general?clientId=" + id
+		conn, _, err := websocket.DefaultDialer.Dial(u, nil)
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		defer conn.Close()
+		conns = append(conns, conn)
+	}
+	for !group.HasClient("alice") || !group.HasClient("bob") {
+		time.Sleep(time.Millisecond)
+	}
+
+	resync := func(groupID, query string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/orgs/acme/groups/"+groupID+"/resync?"+query, nil)
+		req = mux.SetURLVars(req, map[string]string{"orgId": "acme", "groupId": groupID})
+		rec := httptest.NewRecorder()
+		h.ResyncGroup(rec, req)
+		return rec.Code
+	}
+	if got := resync("general", "limit=500"); got != http.StatusBadRequest {
+		t.Errorf("limit past the bound: status %d, want 400", got)
+	}
+	if got := resync("missing", ""); got != http.StatusNotFound {
+		t.Errorf("unknown group: status %d, want 404", got)
+	}
+	if got := resync("general", "limit=2"); got != http.StatusAccepted {
+		t.Fatalf("status %d, want 202", got)
+	}
+
+	for i, conn := range conns {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for {
+			var frame struct {
+				Type string          `json:"type"`
+				Data json.RawMessage `json:"data"`
+			}
+			if err := conn.ReadJSON(&frame); err != nil {
+				t.Fatalf("client %d waiting for the history frame: %v", i, err)
+			}
+			if frame.Type != hub.TypeHistory {
+				continue
+			}
+			var messages []models.ChatMessage
+			if err := json.Unmarshal(frame.Data, &messages); err != nil {
+				t.Fatalf("decode history: %v", err)
+			}
+			var ids []string
+			for _, msg := range messages {
+				ids = append(ids, msg.ID)
+			}
+			// The most recent messages, oldest first
+			if len(ids) != 2 || ids[0] != "m2" || ids[1] != "m3" {
+				t.Errorf("client %d replayed %v, want [m2 m3]", i, ids)
+			}
+			break
+		}
+	}
+}
+
+func TestContentLimitAtEachEntryPoint(t *testing.T) {
+	limit := func(cfg *config.Config) { cfg.Message.MaxContentBytes = 6 }
+	messages, repo := newTestMessageHandler(t, limit)
+	saveMessage(t, repo, "m1", "alice", "hi")
+
+	cfg := config.DefaultConfig()
+	limit(cfg)
+	o := hub.NewOrgHub(cfg.WebSocket, cfg.Message)
+	o.StartGroup(hub.NewGroupHub(o, "acme", "general"))
+	h := NewWebSocketHandler(o, repo, nil, nil, cfg.WebSocket)
+
+	vars := map[string]string{"orgId": "acme", "groupId": "general", "messageId": "m1", "userId": "alice", "recipientId": "bob"}
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		body    func(content string) string
+	}{
+		{"group broadcast", h.BroadcastGroup, func(c string) string { return `{"client_id": "alice", "content": "` + c + `"}` }},
+		{"org broadcast", h.BroadcastOrg, func(c string) string { return `{"client_id": "alice", "content": "` + c + `"}` }},
+		{"direct message", h.SendDM, func(c string) string { return `{"content": "` + c + `"}` }},
+		{"edit", messages.Edit, func(c string) string { return `{"client_id": "alice", "content": "` + c + `"}` }},
+	}
+	for _, tt := range tests {
+		// Six bytes in three runes fit; seven bytes in four runes do not
+		for content, tooLarge := range map[string]bool{"ééé": false, "éééa": true} {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body(content)))
+			req = mux.SetURLVars(req, vars)
+			rec := httptest.NewRecorder()
+			tt.handler(rec, req)
+			if got := rec.Code == http.StatusRequestEntityTooLarge; got != tooLarge {
+				t.Errorf("%s with %q: status %d, want 413 only past the limit", tt.name, content, rec.Code)
+			}
+		}
+	}
+}
+
+func TestJoinGroupFiltersChannels(t *testing.T) {
+	h := newJoinHandler(t, false, nil)
+	srv := serveJoin(t, h)
+
+	u := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws/orgs/acme/groups/general?clientId=alice&channels=ops,oncall"
+	conn, _, err := websocket.DefaultDialer.Dial(u, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	group, _ := h.OrgHub.GetGroup("acme", "general")
+	for !group.HasClient("alice") {
+		time.Sleep(time.Millisecond)
+	}
+
+	for _, msg := range []hub.Message{
+		{ClientID: "bob", Content: "dev", Channel: "dev"},
+		{ClientID: "bob", Content: "ops", Channel: "ops"},
+		{ClientID: "bob", Content: "everyone"},
+		{ClientID: "bob", Content: "oncall", Channel: "oncall"},
+	} {
+		h.OrgHub.BroadcastToGroup("acme", "general", &msg)
+	}
+
+	// Untagged messages reach every client; tagged ones only subscribers
+	var got []string
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for len(got) < 3 {
+		var frame hub.Message
+		if err := conn.ReadJSON(&frame); err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if frame.Type == "" {
+			got = append(got, frame.Content)
+		}
+	}
+	if want := []string{"ops", "everyone", "oncall"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("received %v, want %v", got, want)
+	}
+
+	if _, status := joinGroup(t, srv, url.Values{"clientId": {"bob"}, "channels": {"ops,Not Valid"}}); status != http.StatusBadRequest {
+		t.Errorf("invalid channel: status %d, want 400", status)
+	}
+}
+
+func TestCreateGroupFallsBackToDefaultOrg(t *testing.T) {
+	cfg := config.DefaultConfig()
+	o := hub.NewOrgHub(cfg.WebSocket, cfg.Message)
+	o.CreateOrganization("acme", "Acme")
+	h := NewWebSocketHandler(o, nil, nil, nil, cfg.WebSocket)
+
+	create := func(vars map[string]string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/groups", strings.NewReader(`{"id": "general", "name": "General"}`))
+		rec := httptest.NewRecorder()
+		h.CreateGroup(rec, mux.SetURLVars(req, vars))
+		return rec.Code
+	}
+
+	if got := create(nil); got != http.StatusNotFound {
+		t.Errorf("no default org: status %d, want %d", got, http.StatusNotFound)
+	}
+	h.DefaultOrgID = "acme"
+	if got := create(nil); got >= 300 {
+		t.Fatalf("default org: status %d", got)
+	}
+	org, _ := o.GetOrganization("acme")
+	if _, ok := org.Groups["general"]; !ok {
+		t.Error("group not created in the default org")
+	}
+	// An org in the route still wins
+	o.CreateOrganization("globex", "Globex")
+	if got := create(map[string]string{"orgId": "globex"}); got >= 300 {
+		t.Fatalf("explicit org: status %d", got)
+	}
+	org, _ = o.GetOrganization("globex")
+	if _, ok := org.Groups["general"]; !ok {
+		t.Error("group not created in the route's org")
+	}
+}
+
+func TestForwardGroupMessageToDM(t *testing.T) {
+	_, repo := newTestMessageHandler(t, nil)
+	saveMessage(t, repo, "m1", "alice", "see you at 5")
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	cfg := config.DefaultConfig()
+	o := hub.NewOrgHub(cfg.WebSocket, cfg.Message)
+	go o.Run() // Registers DM clients
+	o.StartGroup(hub.NewGroupHub(o, "acme", "general"))
+	h := NewWebSocketHandler(o, repo, repository.NewUserRepository(db, cfg.User), nil, cfg.WebSocket)
+	r := mux.NewRouter()
+	r.HandleFunc("/ws/dm/{userId}", h.ConnectDM)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	carol, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws/dm/carol", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer carol.Close()
+	for {
+		if _, ok := o.GetDirectClient("carol"); ok {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	columns := []string{"id", "username", "email", "full_name", "avatar_url", "bio", "org_id", "role", "created_at", "updated_at"}
+	now := time.Now()
+	for _, id := range []string{"bob", "carol"} {
+		mock.ExpectQuery("FROM users WHERE id").WithArgs(id).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(id, id, id+"@acme.com", "", "", "", "acme", models.RoleMember, now, now))
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/orgs/acme/groups/general/messages/m1/forward",
+		strings.NewReader(`{"recipient_id": "carol"}`))
+	req = mux.SetURLVars(asUser(t, req, "bob"), map[string]string{"orgId": "acme", "groupId": "general", "messageId": "m1"})
+	rec := httptest.NewRecorder()
+	h.ForwardMessage(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+
+	wantRef := models.ForwardRef{OrgID: "acme", GroupID: "general", MessageID: "m1", ClientID: "alice"}
+	var saved models.ChatMessage
+	if err := json.NewDecoder(rec.Body).Decode(&saved); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if saved.ClientID != "bob" || saved.RecipientID != "carol" || saved.Content != "see you at 5" {
+		t.Errorf("forward saved as %+v, want bob's copy sent to carol", saved)
+	}
+	if saved.ForwardedFrom == nil || *saved.ForwardedFrom != wantRef {
+		t.Errorf("forwarded_from %+v, want %+v", saved.ForwardedFrom, wantRef)
+	}
+	stored, err := repo.GetByID(context.Background(), repository.DMOrgID, "bob_carol", saved.ID)
+	if err != nil {
+		t.Fatalf("forward was not persisted in the DM room: %v", err)
+	}
+	if stored.ForwardedFrom == nil || *stored.ForwardedFrom != wantRef {
+		t.Errorf("stored forwarded_from %+v, want %+v", stored.ForwardedFrom, wantRef)
+	}
+
+	// The recipient's DM connection receives the forward
+	carol.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var frame hub.Message
+		if err := carol.ReadJSON(&frame); err != nil {
+			t.Fatalf("waiting for the forward: %v", err)
+		}
+		if frame.ID == saved.ID {
+			if frame.ForwardedFrom == nil || *frame.ForwardedFrom != wantRef {
+				t.Errorf("delivered forwarded_from %+v, want %+v", frame.ForwardedFrom, wantRef)
+			}
+			break
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestShortLivedDMDisappearsFromHistory(t *testing.T) {
+	_, repo := newTestMessageHandler(t, nil)
+	fake := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	repo.SetClock(fake)
+	cfg := config.DefaultConfig()
+	o := hub.NewOrgHub(cfg.WebSocket, cfg.Message)
+	o.SetClock(fake)
+	h := NewWebSocketHandler(o, repo, nil, nil, cfg.WebSocket)
+
+	send := func(body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/dm/alice/bob", strings.NewReader(body))
+		req = mux.SetURLVars(req, map[string]string{"userId": "alice", "recipientId": "bob"})
+		rec := httptest.NewRecorder()
+		h.SendDM(rec, req)
+		return rec.Code
+	}
+
+	// Outside the configured bounds, or combined with expires_at
+	for _, body := range []string{
+		`{"content": "too short", "expires_in": 5}`,
+		`{"content": "too long", "expires_in": 172800}`,
+		`{"content": "both", "expires_in": 120, "expires_at": "2025-01-01T01:00:00Z"}`,
+	} {
+		if got := send(body); got != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want %d", body, got, http.StatusBadRequest)
+		}
+	}
+
+	// Bob is not connected, so both are stored for later and reported undelivered
+	send(`{"id": "short", "content": "self-destructs", "expires_in": 60}`)
+	fake.Advance(time.Second)
+	send(`{"id": "normal", "content": "stays"}`)
+	history := func() []string {
+		messages, err := repo.GetHistory(context.Background(), repository.DMOrgID, "alice_bob", 10)
+		if err != nil {
+			t.Fatalf("GetHistory: %v", err)
+		}
+		var ids []string
+		for _, msg := range messages {
+			ids = append(ids, msg.ID)
+		}
+		return ids
+	}
+	if got := history(); !slices.Equal(got, []string{"normal", "short"}) {
+		t.Fatalf("history %v, want [normal short]", got)
+	}
+
+	fake.Advance(time.Minute)
+	if got := history(); !slices.Equal(got, []string{"normal"}) {
+		t.Errorf("history after expiry %v, want [normal]", got)
+	}
+}
+
+func TestMaintenanceRefusesNewConnections(t *testing.T) {
+	h := newJoinHandler(t, false, nil)
+	srv := serveJoin(t, h)
+	u := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws/orgs/acme/groups/general?clientId="
+	alice, _, err := websocket.DefaultDialer.Dial(u+"alice", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer alice.Close()
+	group, _ := h.OrgHub.GetGroup("acme", "general")
+	for !group.HasClient("alice") {
+		time.Sleep(time.Millisecond)
+	}
+
+	setMaintenance := func(on bool) {
+		t.Helper()
+		body := fmt.Sprintf(`{"enabled": %v}`, on)
+		rec := httptest.NewRecorder()
+		h.SetMaintenance(rec, httptest.NewRequest(http.MethodPut, "/api/v1/admin/maintenance", strings.NewReader(body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("SetMaintenance: status %d", rec.Code)
+		}
+	}
+	setMaintenance(true)
+
+	_, resp, err := websocket.DefaultDialer.Dial(u+"bob", nil)
+	if err == nil || resp == nil {
+		t.Fatal("new connection accepted during maintenance")
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") != "30" {
+		t.Errorf("status %d, Retry-After %q, want 503 and 30", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+
+	// The existing connection keeps receiving messages
+	h.OrgHub.BroadcastToGroup("acme", "general", &hub.Message{OrgID: "acme", GroupID: "general", ClientID: "carol", Content: "still here"})
+	alice.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var frame hub.Message
+		if err := alice.ReadJSON(&frame); err != nil {
+			t.Fatalf("existing connection dropped: %v", err)
+		}
+		if frame.Content == "still here" {
+			break
+		}
+	}
+
+	setMaintenance(false)
+	if _, status := joinGroup(t, srv, url.Values{"clientId": {"bob"}}); status != http.StatusSwitchingProtocols {
+		t.Errorf("after maintenance: status %d, want 101", status)
+	}
+}
+
+func TestRefusedUpgradesDistinguishCapacityFromRateLimits(t *testing.T) {
+	// refused dials srv as clientID and returns the status, Retry-After
+	// header and body of the refused handshake.
+	refused := func(t *testing.T, srv *httptest.Server, clientID string) (int, string, upgradeRejection) {
+		t.Helper()
+		u := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws/orgs/acme/groups/general?clientId=" + clientID
+		conn, resp, err := websocket.DefaultDialer.Dial(u, nil)
+		if err == nil {
+			conn.Close()
+			t.Fatalf("%s was upgraded", clientID)
+		}
+		if resp == nil {
+			t.Fatalf("dial: %v", err)
+		}
+		var body upgradeRejection
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("decode rejection: %v", err)
+		}
+		return resp.StatusCode, resp.Header.Get("Retry-After"), body
+	}
+
+	t.Run("capacity", func(t *testing.T) {
+		h := newJoinHandler(t, false, func(cfg *config.WebSocketConfig) {
+			cfg.MaxOrgConnections = 1
+			cfg.CapacityRetryAfter = 10 * time.Second
+		})
+		srv := serveJoin(t, h)
+		alice, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws/orgs/acme/groups/general?clientId=alice", nil)
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		defer alice.Close()
+		group, _ := h.OrgHub.GetGroup("acme", "general")
+		for !group.HasClient("alice") {
+			time.Sleep(time.Millisecond)
+		}
+
+		status, retryAfter, body := refused(t, srv, "bob")
+		want := upgradeRejection{Reason: rejectCapacity, Scope: hub.CapacityOrg, Current: 1, Limit: 1, RetryAfter: 10}
+		body.Error = ""
+		if status != http.StatusServiceUnavailable || retryAfter != "10" || body != want {
+			t.Errorf("got %d, Retry-After %q, %+v; want 503, 10, %+v", status, retryAfter, body, want)
+		}
+	})
+
+	t.Run("rate limit", func(t *testing.T) {
+		srv := newJoinServer(t, false, func(cfg *config.WebSocketConfig) {
+			cfg.UserConnectsPerMinute = 2
+		})
+		for i := 0; i < 2; i++ {
+			if _, status := joinGroup(t, srv, url.Values{"clientId": {"alice"}}); status != http.StatusSwitchingProtocols {
+				t.Fatalf("attempt %d: status %d", i+1, status)
+			}
+		}
+
+		status, retryAfter, body := refused(t, srv, "alice")
+		if status != http.StatusTooManyRequests || retryAfter == "" {
+			t.Errorf("got %d, Retry-After %q; want 429 with Retry-After", status, retryAfter)
+		}
+		if body.Reason != rejectRateLimited || body.Current != 2 || body.Limit != 2 || body.Scope != "" {
+			t.Errorf("rejection %+v, want rate_limited at 2 of 2", body)
+		}
+		// Other users are not limited
+		if _, status := joinGroup(t, srv, url.Values{"clientId": {"bob"}}); status != http.StatusSwitchingProtocols {
+			t.Errorf("bob: status %d, want 101", status)
+		}
+	})
+}
+
+func TestMinProtocolVersion(t *testing.T) {
+	dial := func(srv *httptest.Server, version string) *websocket.Conn {
+		t.Helper()
+		u := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws/orgs/acme/groups/general?clientId=alice&protocol_version=" + version
+		conn, _, err := websocket.DefaultDialer.Dial(u, nil)
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		return conn
+	}
+
+	// A client older than the minimum is told to upgrade
+	old := newJoinServer(t, false, func(cfg *config.WebSocketConfig) {
+		cfg.MinProtocolVersion = hub.ProtocolVersion + 1
+	})
+	var frame hub.Message
+	err := dial(old, fmt.Sprint(hub.ProtocolVersion)).ReadJSON(&frame)
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) {
+		t.Fatalf("outdated client: got %v, want a close frame", err)
+	}
+	if closeErr.Code != hub.CloseProtocolOutdated {
+		t.Errorf("close code %d, want %d", closeErr.Code, hub.CloseProtocolOutdated)
+	}
+	if want := fmt.Sprintf("version %d or later", hub.ProtocolVersion+1); !strings.Contains(closeErr.Text, want) {
+		t.Errorf("close reason %q does not mention %q", closeErr.Text, want)
+	}
+
+	// A current client proceeds; a newer one is negotiated down
+	srv := newJoinServer(t, false, nil)
+	for _, version := range []string{"", fmt.Sprint(hub.ProtocolVersion), fmt.Sprint(hub.ProtocolVersion + 5)} {
+		var info struct {
+			Type string             `json:"type"`
+			Data hub.ConnectionInfo `json:"data"`
+		}
+		if err := dial(srv, version).ReadJSON(&info); err != nil {
+			t.Fatalf("version %q: read connection_info: %v", version, err)
+		}
+		if info.Type != hub.TypeConnectionInfo || info.Data.Protocol != hub.ProtocolVersion {
+			t.Errorf("version %q: got %s with protocol %d, want connection_info with %d", version, info.Type, info.Data.Protocol, hub.ProtocolVersion)
+		}
+	}
+
+	if _, status := joinGroup(t, srv, url.Values{"clientId": {"bob"}, "protocol_version": {"v2"}}); status != http.StatusBadRequest {
+		t.Errorf("malformed version: status %d, want 400", status)
+	}
+}
+
+func TestReconnectReceivesMissedSummary(t *testing.T) {
+	_, repo := newTestMessageHandler(t, nil)
+	cfg := config.DefaultConfig()
+	o := hub.NewOrgHub(cfg.WebSocket, cfg.Message)
+	o.StartGroup(hub.NewGroupHub(o, "acme", "general"))
+	o.StartGroup(hub.NewGroupHub(o, "acme", "random"))
+	srv := serveJoin(t, NewWebSocketHandler(o, repo, nil, nil, cfg.WebSocket))
+
+	// Bob read both groups at start, then went offline
+	ctx := context.Background()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, msg := range []models.ChatMessage{
+		{ID: "read", GroupID: "general", ClientID: "alice", Content: "seen"},
+		{ID: "m1", GroupID: "general", ClientID: "alice", Content: "hey @bob"},
+		{ID: "m2", GroupID: "general", ClientID: "carol", Content: "hi all"},
+		{ID: "m3", GroupID: "random", ClientID: "alice", Content: "@bob look at this"},
+		{ID: "dm", OrgID: repository.DMOrgID, GroupID: "alice_bob", ClientID: "alice", RecipientID: "bob", Content: "psst"},
+	} {
+		if msg.OrgID == "" {
+			msg.OrgID = "acme"
+		}
+		msg.Timestamp = start.Add(time.Duration(i) * time.Second)
+		if _, err := repo.Save(ctx, msg); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+	for _, groupID := range []string{"general", "random"} {
+		if err := repo.MarkRead(ctx, "bob", "acme", groupID, start); err != nil {
+			t.Fatalf("MarkRead: %v", err)
+		}
+	}
+
+	u := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws/orgs/acme/groups/general?clientId=bob&replay=true"
+	conn, _, err := websocket.DefaultDialer.Dial(u, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	read := func(data interface{}) string {
+		t.Helper()
+		frame := struct {
+			Type string      `json:"type"`
+			Data interface{} `json:"data"`
+		}{Data: data}
+		if err := conn.ReadJSON(&frame); err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		return frame.Type
+	}
+
+	if typ := read(nil); typ != hub.TypeConnectionInfo {
+		t.Fatalf("first frame is %q, want connection_info", typ)
+	}
+	var summary models.MissedSummary
+	if typ := read(&summary); typ != hub.TypeMissedSummary {
+		t.Fatalf("second frame is %q, want missed_summary", typ)
+	}
+	want := models.MissedSummary{
+		Groups: []models.GroupUnread{
+			{OrgID: "acme", GroupID: "general", Unread: 2, Mentions: 1},
+			{OrgID: "acme", GroupID: "random", Unread: 1, Mentions: 1},
+		},
+		Unread: 3, Mentions: 2, DMs: 1, DMRooms: 1,
+	}
+	if !slices.Equal(summary.Groups, want.Groups) || summary.Unread != want.Unread || summary.Mentions != want.Mentions ||
+		summary.DMs != want.DMs || summary.DMRooms != want.DMRooms {
+		t.Errorf("summary %+v, want %+v", summary, want)
+	}
+
+	// Replay follows the summary with the joined group's unread messages, oldest first
+	var replayed []models.ChatMessage
+	if typ := read(&replayed); typ != hub.TypeHistory {
+		t.Fatalf("third frame is %q, want history", typ)
+	}
+	var ids []string
+	for _, msg := range replayed {
+		ids = append(ids, msg.ID)
+	}
+	if !slices.Equal(ids, []string{"m1", "m2"}) {
+		t.Errorf("replayed %v, want [m1 m2]", ids)
+	}
+
+	// Without replay the summary is all that is sent
+	quiet, _, err := websocket.DefaultDialer.Dial(strings.TrimSuffix(u, "&replay=true"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer quiet.Close()
+	conn = quiet
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	read(nil)
+	if typ := read(nil); typ != hub.TypeMissedSummary {
+		t.Fatalf("second frame is %q, want missed_summary", typ)
+	}
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	var frame hub.Message
+	if err := conn.ReadJSON(&frame); err == nil {
+		t.Errorf("got a %q frame without replay", frame.Type)
+	}
+}
+
+func TestRejoinRedeliversStashedMessages(t *testing.T) {
+	_, repo := newTestMessageHandler(t, nil)
+	cfg := config.DefaultConfig()
+	o := hub.NewOrgHub(cfg.WebSocket, cfg.Message)
+	o.SetUndeliveredStore(repo)
+	o.StartGroup(hub.NewGroupHub(o, "acme", "general"))
+	srv := serveJoin(t, NewWebSocketHandler(o, repo, nil, nil, cfg.WebSocket))
+
+	// Writing m1 and m2 to bob's previous connection failed
+	ctx := context.Background()
+	for _, id := range []string{"m1", "m2", "m3"} {
+		saveMessage(t, repo, id, "alice", "important "+id)
+	}
+	if err := repo.StashUndelivered(ctx, "acme", "general", "bob", []string{"m2", "m1"}); err != nil {
+		t.Fatalf("StashUndelivered: %v", err)
+	}
+
+	u := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws/orgs/acme/groups/general?clientId=bob"
+	dial := func() *websocket.Conn {
+		t.Helper()
+		conn, _, err := websocket.DefaultDialer.Dial(u, nil)
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		return conn
+	}
+	read := func(conn *websocket.Conn, data interface{}) string {
+		t.Helper()
+		frame := struct {
+			Type string      `json:"type"`
+			Data interface{} `json:"data"`
+		}{Data: data}
+		if err := conn.ReadJSON(&frame); err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		return frame.Type
+	}
+
+	conn := dial()
+	read(conn, nil) // connection_info
+	if typ := read(conn, nil); typ != hub.TypeMissedSummary {
+		t.Fatalf("second frame is %q, want missed_summary", typ)
+	}
+	var redelivered []models.ChatMessage
+	if typ := read(conn, &redelivered); typ != hub.TypeHistory {
+		t.Fatalf("third frame is %q, want history", typ)
+	}
+	var ids []string
+	for _, msg := range redelivered {
+		ids = append(ids, msg.ID)
+	}
+	if !slices.Equal(ids, []string{"m2", "m1"}) {
+		t.Errorf("redelivered %v, want [m2 m1]", ids)
+	}
+
+	// The stash is emptied by the redelivery
+	again := dial()
+	read(again, nil)
+	read(again, nil)
+	again.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	var frame hub.Message
+	if err := again.ReadJSON(&frame); err == nil {
+		t.Errorf("got a %q frame on the second rejoin", frame.Type)
+	}
+}
+
+func TestBroadcastToFrozenGroup(t *testing.T) {
+	cfg := config.DefaultConfig()
+	o := hub.NewOrgHub(cfg.WebSocket, cfg.Message)
+	o.SetRoleLookup(fakeRoles{"alice": models.RoleAdmin, "bob": models.RoleMember})
+	group := hub.NewGroupHub(o, "acme", "general")
+	o.StartGroup(group)
+	group.SetFrozen(true)
+	h := NewWebSocketHandler(o, nil, nil, nil, cfg.WebSocket)
+
+	for _, tt := range []struct {
+		clientID string
+		want     int
+	}{
+		{"bob", http.StatusForbidden},
+		{"alice", http.StatusOK},
+	} {
+		body := `{"client_id": "` + tt.clientID + `", "content": "hello"}`
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/orgs/acme/groups/general/broadcast", strings.NewReader(body))
+		req = mux.SetURLVars(req, map[string]string{"orgId": "acme", "groupId": "general"})
+		rec := httptest.NewRecorder()
+		h.BroadcastGroup(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.clientID, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestSystemBotIDIsReserved(t *testing.T) {
+	srv := newJoinServer(t, false, nil)
+	if _, status := joinGroup(t, srv, url.Values{"clientId": {models.SystemUserID}}); status != http.StatusBadRequest {
+		t.Errorf("joining as the bot: status %d, want 400", status)
+	}
+}
+
+func TestDeleteAndRestoreRequireTheAuthor(t *testing.T) {
+	_, repo := newTestMessageHandler(t, nil)
+	saveMessage(t, repo, "m1", "alice", "oops")
+	cfg := config.DefaultConfig()
+	o := hub.NewOrgHub(cfg.WebSocket, cfg.Message)
+	o.StartGroup(hub.NewGroupHub(o, "acme", "general"))
+	h := NewWebSocketHandler(o, repo, nil, nil, cfg.WebSocket)
+
+	send := func(handle http.HandlerFunc, caller, query string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/orgs/acme/groups/general/messages/m1?"+query, nil)
+		req = mux.SetURLVars(asUser(t, req, caller), map[string]string{"orgId": "acme", "groupId": "general", "messageId": "m1"})
+		rec := httptest.NewRecorder()
+		handle(rec, req)
+		return rec.Code
+	}
+
+	for _, tt := range []struct {
+		name   string
+		handle http.HandlerFunc
+		caller string
+		query  string
+		want   int
+	}{
+		{"anonymous delete", h.DeleteMessage, "", "client_id=alice", http.StatusUnauthorized},
+		{"delete naming the author", h.DeleteMessage, "bob", "client_id=alice", http.StatusForbidden},
+		{"delete by someone else", h.DeleteMessage, "bob", "", http.StatusForbidden},
+		{"delete by the author", h.DeleteMessage, "alice", "", http.StatusNoContent},
+		{"restore naming the author", h.RestoreMessage, "bob", "client_id=alice", http.StatusForbidden},
+		{"restore by someone else", h.RestoreMessage, "bob", "", http.StatusForbidden},
+		{"restore by the author", h.RestoreMessage, "alice", "", http.StatusOK},
+		{"delete with the admin token", h.DeleteMessage, testAdminToken, "client_id=alice", http.StatusNoContent},
+	} {
+		if got := send(tt.handle, tt.caller, tt.query); got != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestForwardAsSomeoneElse(t *testing.T) {
+	_, repo := newTestMessageHandler(t, nil)
+	saveMessage(t, repo, "m1", "alice", "see you at 5")
+	cfg := config.DefaultConfig()
+	o := hub.NewOrgHub(cfg.WebSocket, cfg.Message)
+	o.SetRoleLookup(fakeRoles{"alice": models.RoleAdmin, "bob": models.RoleMember})
+	group := hub.NewGroupHub(o, "acme", "announcements")
+	o.StartGroup(group)
+	group.SetFrozen(true)
+	h := NewWebSocketHandler(o, repo, nil, nil, cfg.WebSocket)
+
+	for caller, want := range map[string]int{"": http.StatusUnauthorized, "bob": http.StatusForbidden} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/orgs/acme/groups/general/messages/m1/forward",
+			strings.NewReader(`{"client_id": "alice", "group_id": "announcements"}`))
+		req = mux.SetURLVars(asUser(t, req, caller), map[string]string{"orgId": "acme", "groupId": "general", "messageId": "m1"})
+		rec := httptest.NewRecorder()
+		h.ForwardMessage(rec, req)
+		if rec.Code != want {
+			t.Errorf("caller %q: status %d, want %d", caller, rec.Code, want)
+		}
+	}
+	history, err := repo.GetHistory(context.Background(), "acme", "announcements", 10)
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	if len(history) != 0 {
+		t.Errorf("forwarded %d messages into the frozen group, want none", len(history))
+	}
+}
+
+func TestOnlyTheAdminBroadcastsAsTheBot(t *testing.T) {
+	cfg := config.DefaultConfig()
+	o := hub.NewOrgHub(cfg.WebSocket, cfg.Message)
+	o.SetRoleLookup(fakeRoles{"alice": models.RoleAdmin, "bob": models.RoleMember})
+	group := hub.NewGroupHub(o, "acme", "general")
+	o.StartGroup(group)
+	group.SetFrozen(true)
+	group.SetRateLimit(1, 1)
+	h := NewWebSocketHandler(o, nil, nil, nil, cfg.WebSocket)
+
+	for _, tt := range []struct {
+		name   string
+		handle http.HandlerFunc
+		caller string
+		body   string
+		want   int
+	}{
+		{"group broadcast without client_id", h.BroadcastGroup, "", `{"content": "hi"}`, http.StatusBadRequest},
+		{"group broadcast as the bot", h.BroadcastGroup, "", `{"client_id": "system", "content": "hi"}`, http.StatusBadRequest},
+		{"org broadcast without client_id", h.BroadcastOrg, "", `{"content": "hi"}`, http.StatusBadRequest},
+		{"org broadcast as the bot", h.BroadcastOrg, "", `{"client_id": "system", "content": "hi"}`, http.StatusBadRequest},
+		{"admin naming the bot", h.BroadcastGroup, testAdminToken, `{"client_id": "system", "content": "hi"}`, http.StatusBadRequest},
+		{"member to the frozen group", h.BroadcastGroup, "", `{"client_id": "bob", "content": "hi"}`, http.StatusForbidden},
+		// The bot is held to neither the freeze nor the rate limit
+		{"admin without client_id", h.BroadcastGroup, testAdminToken, `{"content": "hi"}`, http.StatusOK},
+		{"admin without client_id again", h.BroadcastGroup, testAdminToken, `{"content": "hi"}`, http.StatusOK},
+		{"admin announcement", h.BroadcastOrg, testAdminToken, `{"content": "hi"}`, http.StatusOK},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/orgs/acme/groups/general/broadcast", strings.NewReader(tt.body))
+		req = mux.SetURLVars(asUser(t, req, tt.caller), map[string]string{"orgId": "acme", "groupId": "general"})
+		rec := httptest.NewRecorder()
+		tt.handle(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+}
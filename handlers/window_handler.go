@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"net/http"
+	"go-realtime-workspace/models"
+	"go-realtime-workspace/repository"
+
+	"github.com/gorilla/mux"
+)
+
+// WindowHandler handles the edit and delete windows of organizations and
+// groups. Routes with a groupId act on the group, others on the
+// organization.
+type WindowHandler struct {
+	repo *repository.MessageRepository
+}
+
+// NewWindowHandler creates a new window handler.
+func NewWindowHandler(repo *repository.MessageRepository) *WindowHandler {
+	return &WindowHandler{repo: repo}
+}
+
+// Get handles reporting the windows that apply and where they are set.
+func (h *WindowHandler) Get(w http.ResponseWriter, r *http.Request) {
+	h.writeWindows(w, r)
+}
+
+// Set handles setting the windows of an organization or group.
+func (h *WindowHandler) Set(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	var windows models.MessageWindows
+	if err := decodeJSON(r, &windows); err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if windows.EditSeconds < 0 || windows.DeleteSeconds < 0 {
+		writeError(w, r, "edit_window_seconds and delete_window_seconds must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.repo.SetWindows(r.Context(), vars["orgId"], vars["groupId"], windows); err != nil {
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.writeWindows(w, r)
+}
+
+// Clear handles removing the windows of an organization or group.
+func (h *WindowHandler) Clear(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	if err := h.repo.ClearWindows(r.Context(), vars["orgId"], vars["groupId"]); err != nil {
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.writeWindows(w, r)
+}
+
+// writeWindows responds with the windows that now apply.
+func (h *WindowHandler) writeWindows(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	windows, scope, err := h.repo.Windows(r.Context(), vars["orgId"], vars["groupId"])
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, models.MessageWindowsResponse{MessageWindows: windows, Scope: scope}, nil)
+}
@@ -0,0 +1,59 @@
+package hub
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// AckStore keeps the delivery and acknowledgement state of group messages
+// sent with ack_required.
+type AckStore interface {
+	RecordDeliveries(ctx context.Context, orgID, groupID, messageID string, userIDs []string, at time.Time) error
+	Ack(ctx context.Context, orgID, groupID, messageID, userID string, at time.Time) (bool, error)
+}
+
+// SetAckStore sets where deliveries and acks of ack_required messages are
+// recorded. It must be called before clients connect; without it ack
+// frames are refused.
+func (o *OrgHub) SetAckStore(acks AckStore) {
+	o.acks = acks
+}
+
+// recordDeliveries notes which clients an ack_required message was
+// delivered to. It runs in its own goroutine so the group's Run loop does
+// not wait on storage.
+func (g *GroupHub) recordDeliveries(message *Message, userIDs []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), g.hub.cfg.WriteWait)
+	defer cancel()
+
+	if err := g.hub.acks.RecordDeliveries(ctx, g.OrgID, g.GroupID, message.ID, userIDs, g.hub.clock.Now()); err != nil {
+		log.Printf("Error recording deliveries of message %s in group %s: %v", message.ID, g.GroupID, err)
+	}
+}
+
+// ack handles an ack frame acknowledging the group message with the given
+// ID. It runs on the read pump.
+func (c *Client) ack(messageID string) {
+	if c.hub.acks == nil {
+		c.SendError(ErrCodeInvalidMessage, "Acknowledgements are not available", nil)
+		return
+	}
+	if messageID == "" {
+		c.SendError(ErrCodeInvalidMessage, "Ack frames must carry the message id", nil)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.hub.cfg.WriteWait)
+	defer cancel()
+
+	ok, err := c.hub.acks.Ack(ctx, c.Group.OrgID, c.Group.GroupID, messageID, c.ID, c.hub.clock.Now())
+	if err != nil {
+		log.Printf("Error recording ack of message %s from client %s: %v", messageID, c.ID, err)
+		c.SendError(ErrCodeInternal, "Could not record the acknowledgement", map[string]interface{}{"id": messageID})
+		return
+	}
+	if !ok {
+		c.SendError(ErrCodeInvalidMessage, "Message does not require acknowledgement", map[string]interface{}{"id": messageID})
+	}
+}
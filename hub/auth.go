@@ -0,0 +1,201 @@
+package hub
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go-realtime-workspace/metrics"
+)
+
+// CloseUnauthorized is the close code sent to a client whose access token
+// expired or who is no longer a member of its organization.
+const CloseUnauthorized = 4001
+
+// Errors returned when a client's access is checked.
+var (
+	ErrTokenRequired   = errors.New("an access token is required")
+	ErrTokenMismatch   = errors.New("the access token belongs to another user")
+	ErrTokenExpired    = errors.New("access token expired")
+	ErrAccessRevoked   = errors.New("no longer a member of the organization")
+	ErrReauthDisabled  = errors.New("reauthentication is not enabled")
+	errReauthMalformed = errors.New("reauth frames carry the new token as data.token")
+)
+
+// unauthorizedCloses counts connections closed because their access ended.
+var unauthorizedCloses = metrics.NewCounter("hub_unauthorized_closes_total")
+
+// TokenVerifier checks the access tokens clients present when connecting
+// and in reauth frames.
+type TokenVerifier interface {
+	// VerifyToken returns the user a valid token belongs to and when it
+	// expires (zero if never), or an error if the token is not valid.
+	VerifyToken(ctx context.Context, token string) (userID string, expiresAt time.Time, err error)
+}
+
+// SetTokenVerifier makes WebSocket connections present an access token,
+// whose user becomes their client ID, and re-checks their access every
+// ReauthInterval. It must
+// be called before clients connect; without it connections are not
+// authenticated.
+func (o *OrgHub) SetTokenVerifier(tokens TokenVerifier) {
+	o.tokens = tokens
+}
+
+// AuthRequired reports whether connections must present an access token.
+func (o *OrgHub) AuthRequired() bool {
+	return o.tokens != nil
+}
+
+// Authenticate checks that token is a valid, unexpired access token and
+// returns the user it belongs to and when it expires (zero if never).
+func (o *OrgHub) Authenticate(ctx context.Context, token string) (userID string, expiresAt time.Time, err error) {
+	if o.tokens == nil {
+		return "", time.Time{}, ErrReauthDisabled
+	}
+	if token == "" {
+		return "", time.Time{}, ErrTokenRequired
+	}
+
+	userID, expiresAt, err = o.tokens.VerifyToken(ctx, token)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if !expiresAt.IsZero() && !expiresAt.After(o.clock.Now()) {
+		return "", time.Time{}, ErrTokenExpired
+	}
+	return userID, expiresAt, nil
+}
+
+// VerifyToken checks that token is a valid, unexpired access token of
+// userID and returns when it expires (zero if never).
+func (o *OrgHub) VerifyToken(ctx context.Context, userID, token string) (time.Time, error) {
+	subject, expiresAt, err := o.Authenticate(ctx, token)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if subject != userID {
+		return time.Time{}, ErrTokenMismatch
+	}
+	return expiresAt, nil
+}
+
+// SetTokenExpiry records when the client's access token expires (zero if
+// never). Once it has passed the client is closed with CloseUnauthorized
+// at its next chat message or access check.
+func (c *Client) SetTokenExpiry(expiresAt time.Time) {
+	if expiresAt.IsZero() {
+		c.tokenExpiry.Store(0)
+		return
+	}
+	c.tokenExpiry.Store(expiresAt.UnixNano())
+}
+
+// tokenExpired reports whether the client's access token has expired.
+func (c *Client) tokenExpired() bool {
+	expiry := c.tokenExpiry.Load()
+	return expiry != 0 && c.hub.clock.Now().UnixNano() >= expiry
+}
+
+// Authorized reports whether the client's access token is still valid,
+// closing the connection with CloseUnauthorized if it is not. Read pumps
+// call it before acting on a chat message.
+func (c *Client) Authorized() bool {
+	if !c.tokenExpired() {
+		return true
+	}
+	c.closeUnauthorized(ErrTokenExpired)
+	return false
+}
+
+// checkAccess returns why the client may no longer stay connected, or nil:
+// its token expired, or it is no longer a member of its organization. A
+// failed role lookup keeps the client connected, so an outage does not
+// disconnect everyone.
+func (c *Client) checkAccess() error {
+	if c.tokenExpired() {
+		return ErrTokenExpired
+	}
+	if c.hub.roles == nil || c.Info.OrgID == "" {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.hub.cfg.WriteWait)
+	defer cancel()
+	roles, err := c.hub.roles.Roles(ctx, c.Info.OrgID, []string{c.ID})
+	if err != nil {
+		log.Printf("Error checking the access of client %s to org %s: %v", c.ID, c.Info.OrgID, err)
+		return nil
+	}
+	if _, ok := roles[c.ID]; !ok {
+		return ErrAccessRevoked
+	}
+	return nil
+}
+
+// watchAuth re-checks the client's access every ReauthInterval until it
+// disconnects, closing it with CloseUnauthorized once access has ended.
+func (c *Client) watchAuth() {
+	ticker := time.NewTicker(c.hub.cfg.ReauthInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			if err := c.checkAccess(); err != nil {
+				c.closeUnauthorized(err)
+				return
+			}
+		}
+	}
+}
+
+// closeUnauthorized closes the client with CloseUnauthorized.
+func (c *Client) closeUnauthorized(reason error) {
+	unauthorizedCloses.Inc()
+	c.CloseWithCode(CloseUnauthorized, reason.Error())
+}
+
+// ReauthFrame is the payload of a reauth_ok event.
+type ReauthFrame struct {
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // When the new token expires; omitted if never
+}
+
+// Reauth handles a reauth frame, in which a client presents a refreshed
+// access token as data.token without reconnecting. A valid token replaces
+// the current one and is confirmed with a reauth_ok event; otherwise the
+// client gets an unauthorized error frame and keeps its current token
+// until it expires.
+func (c *Client) Reauth(msg *Message) {
+	token := ""
+	if data, ok := msg.Data.(map[string]interface{}); ok {
+		token, _ = data["token"].(string)
+	}
+	if token == "" && c.hub.tokens != nil {
+		c.SendError(ErrCodeUnauthorized, errReauthMalformed.Error(), nil)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.hub.cfg.WriteWait)
+	defer cancel()
+	expiresAt, err := c.hub.VerifyToken(ctx, c.ID, token)
+	if err != nil {
+		c.SendError(ErrCodeUnauthorized, err.Error(), nil)
+		return
+	}
+
+	c.SetTokenExpiry(expiresAt)
+	frame := ReauthFrame{}
+	if !expiresAt.IsZero() {
+		frame.ExpiresAt = &expiresAt
+	}
+	c.deliver(&Message{
+		Type:      TypeReauthOK,
+		ClientID:  c.ID,
+		Timestamp: c.hub.clock.Now(),
+		Data:      frame,
+	})
+}
@@ -0,0 +1,78 @@
+package hub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go-realtime-workspace/clock"
+
+	"github.com/gorilla/websocket"
+)
+
+// userTokens accepts a user's ID as their access token, never expiring.
+type userTokens struct{}
+
+func (userTokens) VerifyToken(ctx context.Context, token string) (string, time.Time, error) {
+	return token, time.Time{}, nil
+}
+
+// authedClient connects client "a" to a new group of a hub that checks
+// tokens with userTokens on the fake clock, with a token expiring in a
+// minute. It returns the client's end of the connection.
+func authedClient(t *testing.T, fake *clock.Fake) *websocket.Conn {
+	t.Helper()
+	o := newTestHub(t, nil)
+	o.SetClock(fake)
+	o.SetTokenVerifier(userTokens{})
+	group := NewGroupHub(o, "org", "group")
+	o.StartGroup(group)
+
+	conn := dialGroup(t, o, group, "a")
+	for !group.HasClient("a") {
+		time.Sleep(time.Millisecond)
+	}
+	group.mu.RLock()
+	group.Clients["a"].SetTokenExpiry(fake.Now().Add(time.Minute))
+	group.mu.RUnlock()
+	return conn
+}
+
+func TestExpiredTokenClosesConnection(t *testing.T) {
+	fake := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	conn := authedClient(t, fake)
+
+	fake.Advance(2 * time.Minute)
+	if err := conn.WriteJSON(Message{Content: "hello"}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := readUntilClose(t, conn); !websocket.IsCloseError(err, CloseUnauthorized) {
+		t.Fatalf("got %v, want close %d", err, CloseUnauthorized)
+	}
+}
+
+func TestReauthKeepsConnectionOpen(t *testing.T) {
+	fake := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	conn := authedClient(t, fake)
+
+	if err := conn.WriteJSON(Message{Type: TypeReauth, Data: map[string]string{"token": "a"}}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	readFrame(t, conn, TypeReauthOK)
+
+	// The refreshed token never expires, so chat goes on past the old expiry
+	fake.Advance(2 * time.Minute)
+	if err := conn.WriteJSON(Message{Content: "still here"}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var message Message
+		if err := conn.ReadJSON(&message); err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if message.Type == "" && message.Content == "still here" {
+			return
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package hub
+
+import (
+	"fmt"
+	"time"
+)
+
+// Scopes of a connection cap.
+const (
+	CapacityServer = "server" // WebSocket.MaxConnections
+	CapacityOrg    = "org"    // WebSocket.MaxOrgConnections
+)
+
+// CapacityError is returned by CheckCapacity when a connection cap is reached.
+type CapacityError struct {
+	Scope   string // CapacityServer or CapacityOrg
+	Current int64  // Connections open in the scope
+	Limit   int64  // The configured cap
+}
+
+func (e *CapacityError) Error() string {
+	return fmt.Sprintf("%s connection limit reached (%d of %d)", e.Scope, e.Current, e.Limit)
+}
+
+// connectWindow is the period UserConnectsPerMinute counts attempts over.
+const connectWindow = time.Minute
+
+// connectionOpened counts a new connection. orgID is empty for DM clients,
+// which count towards the server cap only.
+func (o *OrgHub) connectionOpened(orgID string) {
+	o.connections.Add(1)
+	if orgID == "" {
+		return
+	}
+	o.connMu.Lock()
+	o.orgConnections[orgID]++
+	o.connMu.Unlock()
+}
+
+// connectionClosed releases a connection counted by connectionOpened.
+func (o *OrgHub) connectionClosed(orgID string) {
+	o.connections.Add(-1)
+	if orgID == "" {
+		return
+	}
+	o.connMu.Lock()
+	if o.orgConnections[orgID]--; o.orgConnections[orgID] <= 0 {
+		delete(o.orgConnections, orgID)
+	}
+	o.connMu.Unlock()
+}
+
+// CheckCapacity returns a *CapacityError if the server, or the organization
+// when orgID is set, already has as many connections as its cap allows.
+// Handshakes in flight are not counted, so concurrent upgrades may overshoot
+// a cap slightly.
+func (o *OrgHub) CheckCapacity(orgID string) error {
+	if max := int64(o.cfg.MaxConnections); max > 0 {
+		if current := o.connections.Load(); current >= max {
+			return &CapacityError{Scope: CapacityServer, Current: current, Limit: max}
+		}
+	}
+	if max := int64(o.cfg.MaxOrgConnections); max > 0 && orgID != "" {
+		o.connMu.Lock()
+		current := o.orgConnections[orgID]
+		o.connMu.Unlock()
+		if current >= max {
+			return &CapacityError{Scope: CapacityOrg, Current: current, Limit: max}
+		}
+	}
+	return nil
+}
+
+// AllowConnect counts a connection attempt by a user against
+// UserConnectsPerMinute. Attempts are counted in fixed one-minute windows
+// shared by all users. When the limit is reached it returns false, the
+// attempts made in the window and the time until the window resets.
+func (o *OrgHub) AllowConnect(userID string) (ok bool, attempts int, retryAfter time.Duration) {
+	max := o.cfg.UserConnectsPerMinute
+	if max <= 0 {
+		return true, 0, 0
+	}
+
+	o.connMu.Lock()
+	defer o.connMu.Unlock()
+
+	now := o.clock.Now()
+	if now.Sub(o.connectStart) >= connectWindow {
+		o.connectStart = now
+		o.connectCounts = make(map[string]int)
+	}
+	if o.connectCounts[userID] >= max {
+		return false, o.connectCounts[userID], o.connectStart.Add(connectWindow).Sub(now)
+	}
+	o.connectCounts[userID]++
+	return true, o.connectCounts[userID], 0
+}
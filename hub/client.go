@@ -1,24 +1,28 @@
 package hub
 
 import (
+	"errors"
 	"log"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"go-realtime-workspace/metrics"
+	"go-realtime-workspace/models"
+
 	"github.com/gorilla/websocket"
 )
 
-const (
-	// writeWait is the time allowed to write a message to the peer
-	writeWait = 10 * time.Second
-
-	// pongWait is the time allowed to read the next pong message from the peer
-	pongWait = 60 * time.Second
+// CloseSlowConsumer is the close code sent to a client that was disconnected
+// because it could not keep up with the messages sent to it.
+const CloseSlowConsumer = 4005
 
-	// pingPeriod is the interval for sending pings to peer. Must be less than pongWait
-	pingPeriod = (pongWait * 9) / 10
-
-	// maxMessageSize is the maximum message size allowed from peer
-	maxMessageSize = 512
+// Write failures, split by whether the peer was too slow or the connection broke.
+var (
+	writeTimeouts = metrics.NewCounter("hub_write_timeouts_total")
+	writeErrors   = metrics.NewCounter("hub_write_errors_total")
 )
 
 // Client represents a WebSocket client connected to a group.
@@ -28,6 +32,205 @@ type Client struct {
 	Conn  *websocket.Conn // WebSocket connection
 	Group *GroupHub       // Parent group hub
 	Send  chan *Message   // Buffered channel for outbound messages
+	Info  ConnectionInfo  // Resolved connection metadata sent to the client on connect
+
+	// ProtocolVersion is the protocol version negotiated in the handshake.
+	// Features added in later versions check it before sending new frames.
+	ProtocolVersion int
+
+	hub       *OrgHub       // Owning organization hub (for configuration)
+	drops     atomic.Int32  // Consecutive messages dropped because Send was full
+	closeOnce sync.Once     // Guards the forced close of a slow client
+	done      chan struct{} // Closed when the write pump exits
+
+	sendMu     sync.RWMutex // Guards sends on Send against closeSend
+	sendClosed bool         // Send was closed by closeSend; later deliveries are dropped
+
+	closeFrame atomic.Pointer[[]byte] // Close frame written when Send is closed, if not empty (see hintReconnect)
+
+	channels map[string]bool // Channels the client subscribed to; nil receives every channel
+
+	compressed    bool // permessage-deflate was negotiated for the connection
+	framesWritten int  // Frames written, for compression sampling (write pump only)
+
+	lastRoster time.Time // When the client last got a roster frame (read pump only)
+	lastTyping time.Time // When the client's last typing frame was relayed (read pump only)
+
+	lastPing    atomic.Int64 // When the last ping was written, in Unix nanoseconds
+	lastPong    atomic.Int64 // When the last pong arrived, in Unix nanoseconds (0 = never)
+	missedPongs atomic.Int32 // Pings left unanswered in a row
+
+	tokenExpiry atomic.Int64 // When the access token expires, in Unix nanoseconds (0 = never)
+
+	lagMu   sync.Mutex // Guards lag and lastLag
+	lag     LagFrame   // Drops not yet reported to the client
+	lastLag time.Time  // When the last lag frame was written
+}
+
+// NewClient creates a client for the given connection using the hub's
+// WebSocket configuration. Group is nil for direct-messaging clients,
+// compressed reports whether permessage-deflate was negotiated for conn, and
+// version is the negotiated protocol version. A connection_info frame is
+// queued so it is the first frame the client receives.
+func NewClient(orgHub *OrgHub, id string, conn *websocket.Conn, group *GroupHub, compressed bool, version int) *Client {
+	orgID := ""
+	if group != nil {
+		orgID = group.OrgID
+	}
+	return newClient(orgHub, id, conn, group, orgID, compressed, version)
+}
+
+// NewPresenceClient creates a client that streams the presence events of an
+// org. Register it with OrgHub.AddPresenceSubscriber.
+func NewPresenceClient(orgHub *OrgHub, orgID, id string, conn *websocket.Conn, compressed bool, version int) *Client {
+	return newClient(orgHub, id, conn, nil, orgID, compressed, version)
+}
+
+// newClient creates a client and queues its connection_info frame.
+func newClient(orgHub *OrgHub, id string, conn *websocket.Conn, group *GroupHub, orgID string, compressed bool, version int) *Client {
+	c := &Client{
+		ID:              id,
+		Conn:            conn,
+		Group:           group,
+		Send:            make(chan *Message, orgHub.cfg.MessageBuffer),
+		ProtocolVersion: version,
+		hub:             orgHub,
+		done:            make(chan struct{}),
+		compressed:      compressed,
+	}
+
+	connectionsTotal.Inc()
+	orgHub.connectionOpened(orgID)
+	compression := CompressionNone
+	if compressed {
+		connectionsCompressed.Inc()
+		compression = CompressionDeflate
+	}
+
+	c.Info = ConnectionInfo{
+		ClientID:    id,
+		Subprotocol: conn.Subprotocol(),
+		Protocol:    version,
+		Codec:       "json",
+		Compression: compression,
+		OrgID:       orgID,
+	}
+	if group != nil {
+		c.Info.GroupID = group.GroupID
+		c.Info.Frozen = group.Frozen()
+	}
+
+	c.deliver(NewConnectionInfoFrame(c.Info, orgHub.clock.Now()))
+	if orgHub.tokens != nil && orgHub.cfg.ReauthInterval > 0 {
+		go c.watchAuth()
+	}
+	return c
+}
+
+// Done returns a channel that is closed once the client has disconnected.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// deliver performs a non-blocking send to the client. When the send buffer
+// is full the message is dropped, and a client that keeps dropping messages
+// is disconnected so it can reconnect and resync from history. Messages for
+// a client whose send channel was closed are dropped.
+func (c *Client) deliver(message *Message) bool {
+	c.sendMu.RLock()
+	defer c.sendMu.RUnlock()
+	if c.sendClosed {
+		return false
+	}
+
+	select {
+	case c.Send <- message:
+		c.drops.Store(0)
+		c.hub.latency.observe(message)
+		return true
+	default:
+	}
+
+	drops := c.drops.Add(1)
+	log.Printf("Warning: Client %s send channel is full (%d consecutive drops)", c.ID, drops)
+
+	c.lagMu.Lock()
+	c.lag.Missed++
+	if message.Type == "" {
+		c.lag.LatestID = message.ID
+		c.lag.LatestTimestamp = message.Timestamp
+	}
+	c.lagMu.Unlock()
+
+	if max := c.hub.cfg.MaxSlowDrops; max > 0 && int(drops) >= max {
+		go c.CloseWithCode(CloseSlowConsumer, "slow consumer")
+	}
+	return false
+}
+
+// closeSend closes the send channel so the write pump flushes what is
+// queued, sends a close frame and exits. The read pump and other goroutines
+// may still be delivering to the client, so Send is only ever closed here,
+// under sendMu, and later deliveries are dropped. Safe to call more than once.
+func (c *Client) closeSend() {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	if !c.sendClosed {
+		c.sendClosed = true
+		close(c.Send)
+	}
+}
+
+// SendFrame queues an event for the client alone. It reports whether the
+// event fit in the send buffer.
+func (c *Client) SendFrame(message *Message) bool {
+	return c.deliver(message)
+}
+
+// SendError queues an error frame for the client, telling it why a message
+// it sent was rejected.
+func (c *Client) SendError(code, message string, details map[string]interface{}) {
+	c.deliver(NewErrorFrame(code, message, details, c.hub.clock.Now()))
+}
+
+// SendInvalid tells the client why OrgHub.ValidateMessage rejected its message.
+func (c *Client) SendInvalid(err error) {
+	if errors.Is(err, models.ErrContentTooLarge) {
+		c.SendError(ErrCodeMessageTooLarge, err.Error(), map[string]interface{}{"max_bytes": c.hub.maxContentBytes})
+		return
+	}
+	c.SendError(ErrCodeInvalidMessage, err.Error(), nil)
+}
+
+// SetChannels limits the tagged messages the client receives to the given
+// channels; untagged messages and events are always delivered. Call it
+// before adding the client to its group.
+func (c *Client) SetChannels(channels []string) {
+	c.channels = make(map[string]bool, len(channels))
+	for _, channel := range channels {
+		c.channels[channel] = true
+	}
+}
+
+// wants reports whether a group broadcast should be delivered to the client.
+// Typing indicators are not echoed back to their sender.
+func (c *Client) wants(message *Message) bool {
+	if isTyping(message.Type) && message.ClientID == c.ID {
+		return false
+	}
+	return c.channels == nil || message.Channel == "" || c.channels[message.Channel]
+}
+
+// CloseWithCode sends a close frame with the given code and closes the
+// connection. The read pump then observes the closed connection and
+// unregisters the client as usual. Safe to call from any goroutine.
+func (c *Client) CloseWithCode(code int, reason string) {
+	c.closeOnce.Do(func() {
+		log.Printf("Closing client %s: %s", c.ID, reason)
+		deadline := time.Now().Add(c.hub.cfg.WriteWait)
+		c.Conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), deadline)
+		c.Conn.Close()
+	})
 }
 
 // writePump sends messages to the client's WebSocket connection.
@@ -40,37 +243,97 @@ type Client struct {
 // The application ensures that there is at most one writer to a connection
 // by executing all writes from this goroutine.
 func (c *Client) WritePump() {
-	ticker := time.NewTicker(pingPeriod)
+	cfg := c.hub.cfg
+	ticker := time.NewTicker(c.pingInterval())
 	defer func() {
 		ticker.Stop()
 		c.Conn.Close()
+		c.hub.connectionClosed(c.Info.OrgID)
+		close(c.done)
 	}()
 
 	for {
 		select {
 		case message, ok := <-c.Send:
-			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			c.Conn.SetWriteDeadline(time.Now().Add(cfg.WriteWait))
 			if !ok {
 				// The hub closed the channel
-				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
+				c.Conn.WriteMessage(websocket.CloseMessage, c.closeMessage())
 				return
 			}
 
 			if err := c.Conn.WriteJSON(message); err != nil {
-				log.Printf("Error writing message to client %s: %v", c.ID, err)
+				c.writeFailed("message", err)
+				c.stashUndelivered(message)
+				return
+			}
+			c.sampleCompression(message)
+			if err := c.writeLag(); err != nil {
+				c.writeFailed("lag signal", err)
+				c.stashUndelivered(nil)
 				return
 			}
 
 		case <-ticker.C:
-			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !c.probe() {
+				c.stashUndelivered(nil)
+				return
+			}
+			c.Conn.SetWriteDeadline(time.Now().Add(cfg.WriteWait))
 			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-				log.Printf("Error sending ping to client %s: %v", c.ID, err)
+				c.writeFailed("ping", err)
+				c.stashUndelivered(nil)
+				return
+			}
+			c.lastPing.Store(c.hub.clock.Now().UnixNano())
+			if err := c.writeLag(); err != nil {
+				c.writeFailed("lag signal", err)
+				c.stashUndelivered(nil)
 				return
 			}
 		}
 	}
 }
 
+// writeLag writes a lag frame if messages were dropped since the last one
+// and at least LagSignalInterval has passed, so a client that keeps falling
+// behind is told about it without being flooded. It runs on the write pump,
+// once the client has drained enough of its buffer to be written to again.
+func (c *Client) writeLag() error {
+	interval := c.hub.cfg.LagSignalInterval
+	if interval <= 0 {
+		return nil
+	}
+
+	c.lagMu.Lock()
+	now := c.hub.clock.Now()
+	if c.lag.Missed == 0 || now.Sub(c.lastLag) < interval {
+		c.lagMu.Unlock()
+		return nil
+	}
+	lag := c.lag
+	c.lag = LagFrame{}
+	c.lastLag = now
+	c.lagMu.Unlock()
+
+	c.Conn.SetWriteDeadline(time.Now().Add(c.hub.cfg.WriteWait))
+	return c.Conn.WriteJSON(NewLagFrame(lag, now))
+}
+
+// writeFailed records why a write to the client failed. A write that fails
+// cannot be retried: the frame may be partly on the wire and the connection
+// rejects every later write, so the write pump always exits afterwards.
+func (c *Client) writeFailed(what string, err error) {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		writeTimeouts.Inc()
+		log.Printf("Timed out writing %s to client %s after %s; disconnecting", what, c.ID, c.hub.cfg.WriteWait)
+		return
+	}
+	writeErrors.Inc()
+	log.Printf("Error writing %s to client %s: %v", what, c.ID, err)
+}
+
 // readPump reads messages from the client's WebSocket connection.
 // It runs in its own goroutine and handles:
 // - Reading incoming messages from the client
@@ -82,32 +345,92 @@ func (c *Client) WritePump() {
 // ensures that there is at most one reader on a connection by executing all
 // reads from this goroutine.
 func (c *Client) readPump() {
+	cfg := c.hub.cfg
 	defer func() {
 		c.Group.RemoveClient(c)
 		c.Conn.Close()
 	}()
 
-	c.Conn.SetReadDeadline(time.Now().Add(pongWait))
-	c.Conn.SetReadLimit(maxMessageSize)
-	c.Conn.SetPongHandler(func(string) error {
-		c.Conn.SetReadDeadline(time.Now().Add(pongWait))
-		return nil
-	})
+	c.StartKeepAlive(cfg.PongWait)
+	c.Conn.SetReadLimit(cfg.MaxMessageSize)
 
 	for {
 		var msg Message
 		if err := c.Conn.ReadJSON(&msg); err != nil {
+			if IsDecodeError(err) {
+				c.SendError(ErrCodeInvalidMessage, "Message is not valid JSON", nil)
+				continue
+			}
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("Unexpected close error for client %s: %v", c.ID, err)
 			}
 			break
 		}
+		msg.StampReceived()
+
+		if msg.Type == TypeRosterRequest {
+			c.sendRoster()
+			continue
+		}
+		if msg.Type == TypeAck {
+			c.ack(msg.ID)
+			continue
+		}
+		if msg.Type == TypeReauth {
+			c.Reauth(&msg)
+			continue
+		}
+		if !c.Authorized() {
+			break
+		}
+		if isTyping(msg.Type) {
+			if !c.relayTyping(&msg) {
+				return
+			}
+			continue
+		}
 
-		// Set the client ID and group ID from the connection context
+		// Set the client ID and group ID from the connection context;
+		// clients may only send chat messages, not events
+		msg.StripEvent()
 		msg.ClientID = c.ID
 		msg.GroupID = c.Group.GroupID
 		msg.OrgID = c.Group.OrgID
+		msg.AckRequired = false // Only stored messages can be acknowledged, and these are not stored
 
-		c.Group.Broadcast <- &msg
+		if err := c.hub.ValidateMessage(&msg); err != nil {
+			c.SendInvalid(err)
+			continue
+		}
+		if err := c.Group.CheckPost(c.ID); err != nil {
+			c.SendError(ErrCodeGroupFrozen, err.Error(), nil)
+			continue
+		}
+
+		// A slash command is replaced by what it delivers, if anything
+		message := &msg
+		if strings.HasPrefix(msg.Content, commandPrefix) {
+			var ok bool
+			if message, ok = c.runCommand(&msg); !ok {
+				continue
+			}
+		}
+		message.Content = c.hub.sanitize.ApplyContent(message.Content, models.StructuredContent(message.ContentType))
+
+		if message.ReplyToID != "" && !c.hub.featureEnabled(message.OrgID, models.FeatureThreads) {
+			c.SendError(ErrCodeFeatureDisabled, "Replies are disabled for this organization", nil)
+			continue
+		}
+
+		if !c.Group.Allow() {
+			c.SendError(ErrCodeRateLimited, "Group message rate exceeded", nil)
+			continue
+		}
+
+		select {
+		case c.Group.Broadcast <- message:
+		case <-c.Group.stopped:
+			return
+		}
 	}
 }
@@ -0,0 +1,364 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-realtime-workspace/clock"
+	"go-realtime-workspace/config"
+	"go-realtime-workspace/metrics"
+
+	"github.com/gorilla/websocket"
+)
+
+// newTestHub returns an OrgHub with the default configuration, adjusted by
+// configure if it is not nil.
+func newTestHub(t *testing.T, configure func(*config.WebSocketConfig)) *OrgHub {
+	t.Helper()
+	cfg := config.DefaultConfig()
+	if configure != nil {
+		configure(&cfg.WebSocket)
+	}
+	return NewOrgHub(cfg.WebSocket, cfg.Message)
+}
+
+// dialGroup connects a WebSocket client to group through a test server and
+// returns the client's end of the connection. The server end is registered
+// with the group under id.
+func dialGroup(t *testing.T, o *OrgHub, group *GroupHub, id string) *websocket.Conn {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		group.AddClient(NewClient(o, id, conn, group, false, ProtocolVersion))
+	}))
+	t.Cleanup(srv.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// acceptClient connects a WebSocket client through a test server and returns
+// the server's Client for it, without registering it or starting its pumps,
+// along with the client's end of the connection.
+func acceptClient(t *testing.T, o *OrgHub, id string) (*Client, *websocket.Conn) {
+	t.Helper()
+	accepted := make(chan *Client, 1)
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		accepted <- NewClient(o, id, conn, nil, false, ProtocolVersion)
+	}))
+	t.Cleanup(srv.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	select {
+	case c := <-accepted:
+		t.Cleanup(func() { c.Conn.Close() })
+		return c, conn
+	case <-time.After(5 * time.Second):
+		t.Fatal("NewClient blocked")
+		return nil, nil
+	}
+}
+
+// readUntilClose reads frames from conn until it is closed and returns the
+// close error.
+func readUntilClose(t *testing.T, conn *websocket.Conn) error {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return err
+		}
+	}
+}
+
+func TestShutdownWhileClientSends(t *testing.T) {
+	o := newTestHub(t, func(cfg *config.WebSocketConfig) {
+		cfg.DrainWaveDelay = 0
+	})
+	group := NewGroupHub(o, "org", "group")
+	o.StartGroup(group)
+
+	var conns []*websocket.Conn
+	for _, id := range []string{"a", "b", "c"} {
+		conns = append(conns, dialGroup(t, o, group, id))
+	}
+	for !group.HasClient("c") {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Invalid frames make each read pump queue error frames on Send while
+	// Shutdown closes it
+	var wg sync.WaitGroup
+	for _, conn := range conns {
+		wg.Add(1)
+		go func(conn *websocket.Conn) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				if conn.WriteMessage(websocket.TextMessage, []byte("not json")) != nil {
+					return
+				}
+			}
+		}(conn)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := o.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	wg.Wait()
+
+	for _, conn := range conns {
+		if err := readUntilClose(t, conn); !websocket.IsCloseError(err, websocket.CloseServiceRestart) {
+			t.Errorf("read after shutdown: got %v, want close %d", err, websocket.CloseServiceRestart)
+		}
+	}
+}
+
+func TestDeliverAfterCloseSend(t *testing.T) {
+	o := newTestHub(t, nil)
+	c := &Client{ID: "a", hub: o, Send: make(chan *Message, 1)}
+
+	c.closeSend()
+	c.closeSend() // Closing twice must not panic
+	if c.deliver(NewErrorFrame(ErrCodeInternal, "late", nil, time.Now())) {
+		t.Fatal("deliver after closeSend reported success")
+	}
+}
+
+func TestFramesUseHubClock(t *testing.T) {
+	o := newTestHub(t, nil)
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	o.SetClock(clock.NewFake(now))
+	group := NewGroupHub(o, "acme", "general")
+	o.StartGroup(group)
+
+	conn := dialGroup(t, o, group, "alice")
+	info := readFrame(t, conn, TypeConnectionInfo)
+	if !info.Timestamp.Equal(now) {
+		t.Errorf("connection_info stamped %v, want %v", info.Timestamp, now)
+	}
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("not json")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if frame := readFrame(t, conn, TypeError); !frame.Timestamp.Equal(now) {
+		t.Errorf("error frame stamped %v, want %v", frame.Timestamp, now)
+	}
+}
+
+func TestNewClientDoesNotBlockOnFullBuffer(t *testing.T) {
+	o := newTestHub(t, func(cfg *config.WebSocketConfig) {
+		cfg.MessageBuffer = 0
+	})
+	acceptClient(t, o, "alice")
+}
+
+func TestConnectionInfoFrame(t *testing.T) {
+	o := newTestHub(t, nil)
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	o.SetClock(clock.NewFake(now))
+	group := NewGroupHub(o, "acme", "general")
+	o.StartGroup(group)
+	group.SetFrozen(true)
+
+	conn := dialGroup(t, o, group, "alice")
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var frame struct {
+		Type string         `json:"type"`
+		Data ConnectionInfo `json:"data"`
+	}
+	if err := conn.ReadJSON(&frame); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if frame.Type != TypeConnectionInfo {
+		t.Fatalf("first frame is %q, want connection_info", frame.Type)
+	}
+	want := ConnectionInfo{
+		ClientID:    "alice",
+		OrgID:       "acme",
+		GroupID:     "general",
+		Protocol:    ProtocolVersion,
+		Codec:       "json",
+		Compression: CompressionNone,
+		Frozen:      true,
+		ServerTime:  now,
+	}
+	if frame.Data != want {
+		t.Errorf("connection_info %+v, want %+v", frame.Data, want)
+	}
+
+	// The client keeps the metadata it was sent
+	group.mu.RLock()
+	info := group.Clients["alice"].Info
+	group.mu.RUnlock()
+	info.ServerTime = now
+	if info != want {
+		t.Errorf("client info %+v, want %+v", info, want)
+	}
+}
+
+func TestSlowConsumerIsDisconnected(t *testing.T) {
+	o := newTestHub(t, func(cfg *config.WebSocketConfig) {
+		cfg.MessageBuffer = 4
+		cfg.MaxSlowDrops = 8
+	})
+	// Nothing drains Send, so the client never catches up
+	c, conn := acceptClient(t, o, "alice")
+
+	for i := 0; i < 100; i++ {
+		c.deliver(NewErrorFrame(ErrCodeInternal, "filler", nil, time.Now()))
+	}
+	if err := readUntilClose(t, conn); !websocket.IsCloseError(err, CloseSlowConsumer) {
+		t.Fatalf("got %v, want close %d", err, CloseSlowConsumer)
+	}
+	if drops := c.drops.Load(); drops < 8 {
+		t.Errorf("%d consecutive drops, want at least 8", drops)
+	}
+}
+
+func TestDeliverResetsDropsOnSuccess(t *testing.T) {
+	o := newTestHub(t, func(cfg *config.WebSocketConfig) {
+		cfg.MaxSlowDrops = 3
+	})
+	c := &Client{ID: "a", hub: o, Send: make(chan *Message, 1)}
+
+	for round := 0; round < 5; round++ {
+		c.deliver(NewErrorFrame(ErrCodeInternal, "fits", nil, time.Now()))
+		if c.deliver(NewErrorFrame(ErrCodeInternal, "dropped", nil, time.Now())) {
+			t.Fatal("deliver to a full buffer reported success")
+		}
+		<-c.Send
+	}
+	// Drops never ran consecutively past the limit, so the client stays
+	if drops := c.drops.Load(); drops != 1 {
+		t.Errorf("%d consecutive drops, want 1", drops)
+	}
+}
+
+func TestWriteFailuresCloseTheConnection(t *testing.T) {
+	tests := []struct {
+		name    string
+		writeAt time.Duration
+		closed  bool
+		counter *metrics.Counter
+	}{
+		{name: "timeout", writeAt: time.Nanosecond, counter: writeTimeouts},
+		{name: "connection error", writeAt: time.Second, closed: true, counter: writeErrors},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newTestHub(t, func(cfg *config.WebSocketConfig) {
+				cfg.WriteWait = tt.writeAt
+			})
+			c, _ := acceptClient(t, o, "alice")
+			if tt.closed {
+				c.Conn.NetConn().Close()
+			}
+			before := tt.counter.Value()
+
+			go c.WritePump()
+			c.deliver(NewErrorFrame(ErrCodeInternal, "never written", nil, time.Now()))
+			select {
+			case <-c.done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("write pump kept running after a failed write")
+			}
+			if got := tt.counter.Value() - before; got != 1 {
+				t.Errorf("counter rose by %d, want 1", got)
+			}
+		})
+	}
+}
+
+func TestSaturatedClientReceivesLag(t *testing.T) {
+	o := newTestHub(t, func(cfg *config.WebSocketConfig) {
+		cfg.MessageBuffer = 3
+		cfg.MaxSlowDrops = 0
+		cfg.LagSignalInterval = 5 * time.Second
+	})
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	o.SetClock(clock.NewFake(now))
+	// The connection_info frame takes the first slot
+	c, conn := acceptClient(t, o, "alice")
+
+	for i := 1; i <= 5; i++ {
+		c.deliver(&Message{ID: fmt.Sprintf("m%d", i), Content: "hi", Timestamp: now.Add(time.Duration(i) * time.Second)})
+	}
+	go c.WritePump()
+
+	lag := readFrame(t, conn, TypeLag)
+	var frame LagFrame
+	data, _ := json.Marshal(lag.Data)
+	if err := json.Unmarshal(data, &frame); err != nil {
+		t.Fatalf("decode lag: %v", err)
+	}
+	if frame.Missed != 3 || frame.LatestID != "m5" {
+		t.Errorf("lag reports %d missed up to %q, want 3 up to m5", frame.Missed, frame.LatestID)
+	}
+	if !frame.LatestTimestamp.Equal(now.Add(5 * time.Second)) {
+		t.Errorf("latest timestamp %v, want that of m5", frame.LatestTimestamp)
+	}
+}
+
+func TestLagIsThrottled(t *testing.T) {
+	o := newTestHub(t, func(cfg *config.WebSocketConfig) {
+		cfg.LagSignalInterval = 5 * time.Second
+	})
+	fake := clock.NewFake(time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC))
+	o.SetClock(fake)
+	c, conn := acceptClient(t, o, "alice")
+
+	// The write pump is not running, so only lag frames reach the connection
+	missed := func(n int64) {
+		c.lagMu.Lock()
+		c.lag.Missed += n
+		c.lagMu.Unlock()
+		if err := c.writeLag(); err != nil {
+			t.Fatalf("writeLag: %v", err)
+		}
+	}
+	missed(1)
+	missed(2) // Within the interval: held back
+	fake.Advance(5 * time.Second)
+	missed(3)
+
+	for _, want := range []int64{1, 5} {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var frame struct {
+			Type string   `json:"type"`
+			Data LagFrame `json:"data"`
+		}
+		if err := conn.ReadJSON(&frame); err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if frame.Type != TypeLag || frame.Data.Missed != want {
+			t.Errorf("got %s frame missing %d, want lag missing %d", frame.Type, frame.Data.Missed, want)
+		}
+	}
+}
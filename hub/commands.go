@@ -0,0 +1,189 @@
+package hub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// commandPrefix starts a slash command. Content starting with two of them is
+// sent as a chat message with the first removed, so "//shrug" reads "/shrug".
+const commandPrefix = "/"
+
+// commandName is the charset and length allowed for command names.
+var commandName = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,31}$`)
+
+// Command is a slash command sent by a group client, e.g. "/me waves".
+type Command struct {
+	Name    string   // Command name without the slash, lowercased
+	Args    string   // Text after the name, trimmed
+	Client  *Client  // Sender
+	Message *Message // The message that carried the command, already validated
+}
+
+// CommandHandler runs a slash command on the sender's read pump. It returns
+// the message or event to deliver to the group in the command's place, or
+// nil when the command had nothing to deliver. A returned error is sent to
+// the sender as a command_failed error frame, so its text should be fit for
+// users.
+type CommandHandler func(cmd *Command) (*Message, error)
+
+// PinStore pins group messages for the /pin command.
+type PinStore interface {
+	Pin(ctx context.Context, orgID, groupID, id string) error
+}
+
+// SetPinStore sets where /pin pins messages. It must be called before
+// clients connect; without it /pin fails.
+func (o *OrgHub) SetPinStore(pins PinStore) {
+	o.pins = pins
+}
+
+// commandRegistry holds the slash commands known to an OrgHub.
+type commandRegistry struct {
+	mu       sync.RWMutex
+	handlers map[string]CommandHandler
+}
+
+// RegisterCommand registers handler for /name, replacing any built-in or
+// earlier command of that name. Names are 1-32 lowercase letters, digits,
+// underscores or hyphens, starting with a letter.
+func (o *OrgHub) RegisterCommand(name string, handler CommandHandler) {
+	if !commandName.MatchString(name) {
+		panic(fmt.Sprintf("hub: invalid command name %q", name))
+	}
+
+	o.commands.mu.Lock()
+	defer o.commands.mu.Unlock()
+	if o.commands.handlers == nil {
+		o.commands.handlers = make(map[string]CommandHandler)
+	}
+	o.commands.handlers[name] = handler
+}
+
+// lookup returns the handler registered for name.
+func (r *commandRegistry) lookup(name string) (CommandHandler, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	handler, ok := r.handlers[name]
+	return handler, ok
+}
+
+// registerBuiltinCommands registers the commands every hub supports.
+func (o *OrgHub) registerBuiltinCommands() {
+	o.RegisterCommand("me", meCommand)
+	o.RegisterCommand("pin", o.pinCommand)
+}
+
+// runCommand handles a message whose content starts with commandPrefix. It
+// returns the message to deliver in its place, or false when there is
+// nothing to deliver; unknown commands and failures are reported to the
+// client with an error frame.
+func (c *Client) runCommand(msg *Message) (*Message, bool) {
+	if strings.HasPrefix(msg.Content, commandPrefix+commandPrefix) {
+		msg.Content = strings.TrimPrefix(msg.Content, commandPrefix)
+		return msg, true
+	}
+
+	line := strings.TrimPrefix(msg.Content, commandPrefix)
+	name, args := line, ""
+	if i := strings.IndexFunc(line, unicode.IsSpace); i >= 0 {
+		name, args = line[:i], line[i:]
+	}
+	name = strings.ToLower(name)
+	handler, ok := c.hub.commands.lookup(name)
+	if !ok {
+		c.SendError(ErrCodeUnknownCommand, fmt.Sprintf("Unknown command /%s", name), map[string]interface{}{"command": name})
+		return nil, false
+	}
+
+	out, err := c.callCommand(handler, &Command{
+		Name:    name,
+		Args:    strings.TrimSpace(args),
+		Client:  c,
+		Message: msg,
+	})
+	if err != nil {
+		c.SendError(ErrCodeCommandFailed, err.Error(), map[string]interface{}{"command": name})
+		return nil, false
+	}
+	return out, out != nil
+}
+
+// errCommandPanicked is reported to the sender of a command whose handler
+// panicked.
+var errCommandPanicked = errors.New("command failed unexpectedly")
+
+// callCommand runs handler, turning a panic into an error so a faulty
+// command cannot take down the read pump.
+func (c *Client) callCommand(handler CommandHandler, cmd *Command) (out *Message, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			log.Printf("Command /%s from client %s panicked: %v", cmd.Name, c.ID, p)
+			out, err = nil, errCommandPanicked
+		}
+	}()
+	return handler(cmd)
+}
+
+// meCommand handles "/me <action>", sending the action as a chat message
+// that clients render as an action of the sender, e.g. "* alice waves".
+func meCommand(cmd *Command) (*Message, error) {
+	if cmd.Args == "" {
+		return nil, errors.New("usage: /me <action>")
+	}
+	cmd.Message.Content = cmd.Args
+	cmd.Message.Action = true
+	return cmd.Message, nil
+}
+
+// pinCommand handles "/pin" sent as a reply to the message to pin, or
+// "/pin <message-id>", and tells the group with a pin event.
+func (o *OrgHub) pinCommand(cmd *Command) (*Message, error) {
+	if o.pins == nil {
+		return nil, errors.New("pinning is not available")
+	}
+
+	id := cmd.Args
+	if id == "" {
+		id = cmd.Message.ReplyToID
+	}
+	if id == "" {
+		return nil, errors.New("usage: reply to a message with /pin, or /pin <message-id>")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), o.cfg.WriteWait)
+	defer cancel()
+
+	group := cmd.Client.Group
+	if err := o.pins.Pin(ctx, group.OrgID, group.GroupID, id); err != nil {
+		return nil, fmt.Errorf("could not pin message: %w", err)
+	}
+	return NewPinEvent(group.OrgID, group.GroupID, id, cmd.Client.ID, o.clock.Now()), nil
+}
+
+// PinFrame is the payload of a pin event.
+type PinFrame struct {
+	MessageID string `json:"message_id"`
+	PinnedBy  string `json:"pinned_by"`
+}
+
+// NewPinEvent returns an event telling clients that a member pinned the
+// group message with the given ID.
+func NewPinEvent(orgID, groupID, messageID, pinnedBy string, now time.Time) *Message {
+	return &Message{
+		Type:      TypePin,
+		ID:        messageID,
+		OrgID:     orgID,
+		GroupID:   groupID,
+		ClientID:  pinnedBy,
+		Timestamp: now,
+		Data:      PinFrame{MessageID: messageID, PinnedBy: pinnedBy},
+	}
+}
@@ -0,0 +1,147 @@
+package hub
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// pinned is a PinStore recording the IDs it pinned.
+type pinned struct {
+	mu  sync.Mutex
+	ids []string
+}
+
+func (p *pinned) Pin(ctx context.Context, orgID, groupID, id string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ids = append(p.ids, id)
+	return nil
+}
+
+// commandGroup starts a group with alice and bob connected and returns
+// their ends of the connections.
+func commandGroup(t *testing.T, o *OrgHub) (alice, bob *websocket.Conn) {
+	t.Helper()
+	group := NewGroupHub(o, "acme", "general")
+	o.StartGroup(group)
+	alice = dialGroup(t, o, group, "alice")
+	bob = dialGroup(t, o, group, "bob")
+	for !group.HasClient("alice") || !group.HasClient("bob") {
+		time.Sleep(time.Millisecond)
+	}
+	return alice, bob
+}
+
+// send writes a chat message with the given content from conn.
+func send(t *testing.T, conn *websocket.Conn, content string) {
+	t.Helper()
+	if err := conn.WriteJSON(Message{Content: content}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+}
+
+func TestMeCommand(t *testing.T) {
+	o := newTestHub(t, nil)
+	alice, bob := commandGroup(t, o)
+
+	send(t, alice, "/me waves")
+	got := readFrame(t, bob, "")
+	if got.Content != "waves" || !got.Action || got.ClientID != "alice" {
+		t.Errorf("got %+v, want alice's action \"waves\"", got)
+	}
+
+	send(t, alice, "/me")
+	if got := readError(t, alice); got.Code != ErrCodeCommandFailed || !strings.Contains(got.Message, "usage") {
+		t.Errorf("/me without an action: got %+v, want command_failed with usage", got)
+	}
+
+	// A doubled slash sends the text as an ordinary message
+	send(t, alice, "//shrug")
+	if got := readFrame(t, bob, ""); got.Content != "/shrug" || got.Action {
+		t.Errorf("escaped command: got %+v, want the message \"/shrug\"", got)
+	}
+}
+
+func TestPinCommand(t *testing.T) {
+	o := newTestHub(t, nil)
+	var pins pinned
+	o.SetPinStore(&pins)
+	alice, bob := commandGroup(t, o)
+
+	if err := alice.WriteJSON(Message{Content: "/pin", ReplyToID: "m1"}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	got := readFrame(t, bob, TypePin)
+	if got.ID != "m1" || got.ClientID != "alice" {
+		t.Errorf("got %+v, want alice pinning m1", got)
+	}
+	pins.mu.Lock()
+	defer pins.mu.Unlock()
+	if len(pins.ids) != 1 || pins.ids[0] != "m1" {
+		t.Errorf("pinned %v, want [m1]", pins.ids)
+	}
+}
+
+func TestUnknownCommandIsNotDelivered(t *testing.T) {
+	o := newTestHub(t, nil)
+	alice, bob := commandGroup(t, o)
+
+	send(t, alice, "/frobnicate now")
+	got := readError(t, alice)
+	if got.Code != ErrCodeUnknownCommand || got.Message != "Unknown command /frobnicate" {
+		t.Errorf("got %+v, want unknown_command for /frobnicate", got)
+	}
+
+	// The next chat message bob sees is the one after the command
+	send(t, alice, "after")
+	if got := readFrame(t, bob, ""); got.Content != "after" {
+		t.Errorf("bob received %q, want only the message after the command", got.Content)
+	}
+}
+
+func TestRegisteredCommand(t *testing.T) {
+	o := newTestHub(t, nil)
+	o.RegisterCommand("shout", func(cmd *Command) (*Message, error) {
+		cmd.Message.Content = strings.ToUpper(cmd.Args)
+		return cmd.Message, nil
+	})
+	o.RegisterCommand("boom", func(cmd *Command) (*Message, error) {
+		panic("handler bug")
+	})
+	alice, bob := commandGroup(t, o)
+
+	// Names are matched case-insensitively
+	send(t, alice, "/SHOUT hello")
+	if got := readFrame(t, bob, ""); got.Content != "HELLO" {
+		t.Errorf("got %q, want HELLO", got.Content)
+	}
+
+	// A panicking handler is reported and the connection survives
+	send(t, alice, "/boom")
+	if got := readError(t, alice); got.Code != ErrCodeCommandFailed {
+		t.Errorf("panicking command: got %+v, want command_failed", got)
+	}
+	send(t, alice, "/shout still here")
+	if got := readFrame(t, bob, ""); got.Content != "STILL HERE" {
+		t.Errorf("got %q after the panic, want STILL HERE", got.Content)
+	}
+}
+
+func TestRegisterCommandRejectsBadNames(t *testing.T) {
+	o := newTestHub(t, nil)
+	for _, name := range []string{"", "Shout", "1st", "with space", strings.Repeat("x", 33)} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("RegisterCommand(%q) did not panic", name)
+				}
+			}()
+			o.RegisterCommand(name, meCommand)
+		}()
+	}
+}
@@ -0,0 +1,52 @@
+package hub
+
+import (
+	"strings"
+	"testing"
+
+	"go-realtime-workspace/config"
+)
+
+func TestCompressionRatioSampled(t *testing.T) {
+	o := newTestHub(t, func(cfg *config.WebSocketConfig) {
+		cfg.CompressionSampleEvery = 2
+	})
+	c, _ := acceptClient(t, o, "alice")
+	c.compressed = true
+
+	frames := compressionSampledFrames.Value()
+	raw := compressionSampledRawBytes.Value()
+	compressed := compressionSampledCompressedBytes.Value()
+	saved := compressionBytesSaved.Value()
+
+	message := &Message{OrgID: "acme", GroupID: "general", ClientID: "alice", Content: strings.Repeat("hello world ", 50)}
+	for i := 0; i < 4; i++ {
+		c.sampleCompression(message)
+	}
+
+	if got := compressionSampledFrames.Value() - frames; got != 2 {
+		t.Errorf("sampled %d frames, want every second of 4", got)
+	}
+	rawDelta := compressionSampledRawBytes.Value() - raw
+	compressedDelta := compressionSampledCompressedBytes.Value() - compressed
+	if rawDelta == 0 || compressedDelta >= rawDelta {
+		t.Errorf("sampled %d compressed bytes for %d raw, want a ratio below 1", compressedDelta, rawDelta)
+	}
+	// The saving of each sample stands for the frames skipped since the last
+	if got, want := compressionBytesSaved.Value()-saved, 2*(rawDelta-compressedDelta); got != want {
+		t.Errorf("estimated %d bytes saved, want %d", got, want)
+	}
+}
+
+func TestUncompressedConnectionsAreNotSampled(t *testing.T) {
+	o := newTestHub(t, func(cfg *config.WebSocketConfig) {
+		cfg.CompressionSampleEvery = 1
+	})
+	c, _ := acceptClient(t, o, "alice")
+
+	frames := compressionSampledFrames.Value()
+	c.sampleCompression(&Message{Content: strings.Repeat("hello world ", 50)})
+	if got := compressionSampledFrames.Value() - frames; got != 0 {
+		t.Errorf("sampled %d frames of an uncompressed connection", got)
+	}
+}
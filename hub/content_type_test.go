@@ -0,0 +1,46 @@
+package hub
+
+import (
+	"testing"
+	"time"
+
+	"go-realtime-workspace/config"
+	"go-realtime-workspace/models"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestStructuredContentFrames(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Message.ContentTypes = []string{models.ContentLocation}
+	o := NewOrgHub(cfg.WebSocket, cfg.Message)
+	group := NewGroupHub(o, "acme", "general")
+	o.StartGroup(group)
+	alice := dialGroup(t, o, group, "alice")
+	bob := dialGroup(t, o, group, "bob")
+	for !group.HasClient("alice") || !group.HasClient("bob") {
+		time.Sleep(time.Millisecond)
+	}
+
+	location := `{"content_type":"location","content":"{\"latitude\":48.85,\"longitude\":2.35}"}`
+	if err := alice.WriteMessage(websocket.TextMessage, []byte(location)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	got := readFrame(t, bob, "")
+	if got.ContentType != models.ContentLocation || got.Content != `{"latitude":48.85,"longitude":2.35}` {
+		t.Errorf("delivered %q content %s, want the location", got.ContentType, got.Content)
+	}
+
+	// Types the server does not allow are refused with an error frame
+	for _, frame := range []string{
+		`{"content_type":"contact","content":"{\"name\":\"Bob\",\"email\":\"bob@example.com\"}"}`,
+		`{"content_type":"hologram","content":"{}"}`,
+	} {
+		if err := alice.WriteMessage(websocket.TextMessage, []byte(frame)); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if got := readError(t, alice); got.Code != ErrCodeInvalidMessage {
+			t.Errorf("%s: error code %q, want %q", frame, got.Code, ErrCodeInvalidMessage)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package hub
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// drainWaves splits groups into at most n waves for Shutdown to close one
+// after another, so clients do not all reconnect at once. Groups are dealt
+// out in turn; with n below 2 they all close in one wave.
+func drainWaves(groups []*GroupHub, n int) [][]*GroupHub {
+	if n < 1 {
+		n = 1
+	}
+	if n > len(groups) {
+		n = len(groups)
+	}
+	waves := make([][]*GroupHub, n)
+	for i, group := range groups {
+		waves[i%n] = append(waves[i%n], group)
+	}
+	return waves
+}
+
+// waveDelay returns the pause before each of pauses drain waves: the
+// configured WebSocket.DrainWaveDelay, shortened if needed so that all the
+// pauses take at most half the time left before ctx's deadline, leaving
+// the rest for connections to flush.
+func (o *OrgHub) waveDelay(ctx context.Context, pauses int) time.Duration {
+	delay := o.cfg.DrainWaveDelay
+	if pauses <= 0 || delay <= 0 {
+		return 0
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if budget := time.Until(deadline) / 2 / time.Duration(pauses); budget < delay {
+			delay = budget
+		}
+	}
+	return delay
+}
+
+// pause waits for d or until ctx is done.
+func pause(ctx context.Context, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+// hintReconnect makes the client's close frame, written once its send
+// channel is closed, a service restart telling it to reconnect after a
+// random delay below WebSocket.DrainReconnectJitter, given in the reason as
+// {"after_ms":N}. Without a jitter the close frame stays empty.
+func (c *Client) hintReconnect() {
+	jitter := c.hub.cfg.DrainReconnectJitter
+	if jitter <= 0 {
+		return
+	}
+	after := rand.N(jitter)
+	frame := websocket.FormatCloseMessage(websocket.CloseServiceRestart, fmt.Sprintf(`{"after_ms":%d}`, after.Milliseconds()))
+	c.closeFrame.Store(&frame)
+}
+
+// closeMessage returns the payload of the close frame the write pump sends
+// when the send channel is closed: a reconnect hint if one was set, and
+// empty otherwise.
+func (c *Client) closeMessage() []byte {
+	if frame := c.closeFrame.Load(); frame != nil {
+		return *frame
+	}
+	return []byte{}
+}
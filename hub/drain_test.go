@@ -0,0 +1,126 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"go-realtime-workspace/config"
+
+	"github.com/gorilla/websocket"
+)
+
+// drainClose is how a connection was closed during a drain.
+type drainClose struct {
+	name    string
+	at      time.Time
+	code    int
+	afterMS int64
+}
+
+// awaitClose reads conn until it is closed and reports the close frame.
+func awaitClose(conn *websocket.Conn, name string, closes chan<- drainClose) {
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			c := drainClose{name: name, at: time.Now()}
+			var closeErr *websocket.CloseError
+			if errors.As(err, &closeErr) {
+				c.code = closeErr.Code
+				var hint struct {
+					AfterMS int64 `json:"after_ms"`
+				}
+				if json.Unmarshal([]byte(closeErr.Text), &hint) == nil {
+					c.afterMS = hint.AfterMS
+				}
+			}
+			closes <- c
+			return
+		}
+	}
+}
+
+func TestShutdownDrainsInWaves(t *testing.T) {
+	const (
+		delay  = 100 * time.Millisecond
+		jitter = 5 * time.Second
+	)
+	o := newTestHub(t, func(cfg *config.WebSocketConfig) {
+		cfg.DrainWaves = 3
+		cfg.DrainWaveDelay = delay
+		cfg.DrainReconnectJitter = jitter
+	})
+	go o.Run() // Registers DM clients
+
+	const clients = 6 // Two per group
+	closes := make(chan drainClose, clients+1)
+	for g := 0; g < 3; g++ {
+		group := NewGroupHub(o, "acme", fmt.Sprintf("group%d", g))
+		o.StartGroup(group)
+		for c := 0; c < 2; c++ {
+			id := fmt.Sprintf("user%d-%d", g, c)
+			go awaitClose(dialGroup(t, o, group, id), group.GroupID, closes)
+			for !group.HasClient(id) {
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}
+	dm, dmConn := acceptClient(t, o, "carol")
+	o.RegisterDM <- dm
+	for _, ok := o.GetDirectClient("carol"); !ok; _, ok = o.GetDirectClient("carol") {
+		time.Sleep(time.Millisecond)
+	}
+	go dm.WritePump()
+	go awaitClose(dmConn, "dm", closes)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := o.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	var order []drainClose
+	for len(order) < clients+1 {
+		select {
+		case c := <-closes:
+			order = append(order, c)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%d of %d connections closed", len(order), clients+1)
+		}
+	}
+
+	// Every connection is told to come back after its own random delay
+	hints := make(map[int64]bool)
+	for _, c := range order {
+		if c.code != websocket.CloseServiceRestart {
+			t.Errorf("%s closed with code %d, want %d", c.name, c.code, websocket.CloseServiceRestart)
+		}
+		if c.afterMS < 0 || c.afterMS >= jitter.Milliseconds() {
+			t.Errorf("%s told to reconnect after %dms, want below %s", c.name, c.afterMS, jitter)
+		}
+		hints[c.afterMS] = true
+	}
+	if len(hints) < 2 {
+		t.Errorf("every connection got the same reconnect hint %v", hints)
+	}
+
+	// Each group's connections close together, a wave apart, and DMs last
+	first := make(map[string]time.Time)
+	for _, c := range order {
+		if at, ok := first[c.name]; !ok || c.at.Before(at) {
+			first[c.name] = c.at
+		}
+	}
+	if last := order[len(order)-1]; last.name != "dm" {
+		t.Errorf("%s closed last, want the DM connection", last.name)
+	}
+	waves := []time.Time{first["group0"], first["group1"], first["group2"], first["dm"]}
+	for i := 1; i < len(waves); i++ {
+		if gap := waves[i].Sub(waves[i-1]); gap < delay/2 {
+			t.Errorf("wave %d closed %s after wave %d, want about %s", i, gap, i-1, delay)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package hub
+
+import (
+	"runtime"
+	"sync"
+
+	"go-realtime-workspace/metrics"
+)
+
+// minFanoutChunk is the fewest clients a fan-out worker is given; smaller
+// chunks cost more in goroutine handoff than they save.
+const minFanoutChunk = 64
+
+// parallelFanouts counts broadcasts delivered by parallel workers.
+var parallelFanouts = metrics.NewCounter("hub_parallel_fanouts_total")
+
+// fanout delivers a message to every client of the group that wants it and
+// returns the IDs of those it was delivered to if track is set. Groups of
+// at least ParallelFanoutThreshold clients are split into chunks delivered
+// by FanoutWorkers goroutines; smaller groups, or all of them when the
+// threshold is 0, are delivered to sequentially on the calling goroutine.
+//
+// Either way fanout returns only once every client has been handed the
+// message, so Run never starts on the next message early and each client
+// still receives the group's messages in the order they were broadcast.
+// The caller must hold g.mu for reading.
+func (g *GroupHub) fanout(message *Message, track bool) []string {
+	threshold := g.hub.cfg.ParallelFanoutThreshold
+	if threshold <= 0 || len(g.Clients) < threshold {
+		var delivered []string
+		for _, client := range g.Clients {
+			// Non-blocking send to avoid deadlock
+			if client.wants(message) && client.deliver(message) && track {
+				delivered = append(delivered, client.ID)
+			}
+		}
+		return delivered
+	}
+
+	// Only Run calls fanout, so the snapshot buffer can be reused
+	g.fanoutBuf = g.fanoutBuf[:0]
+	for _, client := range g.Clients {
+		g.fanoutBuf = append(g.fanoutBuf, client)
+	}
+	clients := g.fanoutBuf
+
+	workers := g.hub.cfg.FanoutWorkers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if most := (len(clients) + minFanoutChunk - 1) / minFanoutChunk; workers > most {
+		workers = most
+	}
+	chunk := (len(clients) + workers - 1) / workers
+
+	parallelFanouts.Inc()
+	results := make([][]string, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		start, end := w*chunk, min((w+1)*chunk, len(clients))
+		if start >= end {
+			break
+		}
+		wg.Add(1)
+		go func(w int, part []*Client) {
+			defer wg.Done()
+			for _, client := range part {
+				if client.wants(message) && client.deliver(message) && track {
+					results[w] = append(results[w], client.ID)
+				}
+			}
+		}(w, clients[start:end])
+	}
+	wg.Wait()
+	clear(g.fanoutBuf) // Do not keep departed clients reachable
+
+	var delivered []string
+	for _, part := range results {
+		delivered = append(delivered, part...)
+	}
+	return delivered
+}
@@ -0,0 +1,122 @@
+package hub
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"go-realtime-workspace/config"
+)
+
+// addFanoutClients adds n clients without connections to group, each able
+// to buffer buffer messages, and returns them in ID order.
+func addFanoutClients(o *OrgHub, group *GroupHub, n, buffer int) []*Client {
+	clients := make([]*Client, n)
+	for i := range clients {
+		c := &Client{ID: fmt.Sprintf("user%05d", i), Group: group, Send: make(chan *Message, buffer), hub: o, done: make(chan struct{})}
+		group.Clients[c.ID] = c
+		clients[i] = c
+	}
+	return clients
+}
+
+func TestParallelFanout(t *testing.T) {
+	o := newTestHub(t, func(cfg *config.WebSocketConfig) {
+		cfg.ParallelFanoutThreshold = 100
+		cfg.FanoutWorkers = 4
+	})
+	group := NewGroupHub(o, "acme", "general")
+	const messages = 20
+	clients := addFanoutClients(o, group, 1000, messages+1)
+
+	before := parallelFanouts.Value()
+	for i := 0; i < messages; i++ {
+		group.mu.RLock()
+		group.fanout(&Message{ID: fmt.Sprint(i), ClientID: "alice", Content: "hello"}, false)
+		group.mu.RUnlock()
+	}
+	if got := parallelFanouts.Value() - before; got != messages {
+		t.Errorf("%d parallel fan-outs, want %d", got, messages)
+	}
+
+	// Every client has every message, in the order it was broadcast
+	for _, c := range clients {
+		if len(c.Send) != messages {
+			t.Fatalf("%s received %d messages, want %d", c.ID, len(c.Send), messages)
+		}
+		for i := 0; i < messages; i++ {
+			if msg := <-c.Send; msg.ID != fmt.Sprint(i) {
+				t.Fatalf("%s received message %s at position %d", c.ID, msg.ID, i)
+			}
+		}
+	}
+
+	// Tracked deliveries from every worker are merged, skipping clients
+	// that do not want the message
+	var want []string
+	for i, c := range clients {
+		if i%2 == 0 {
+			c.SetChannels([]string{"ops"})
+		} else {
+			want = append(want, c.ID)
+		}
+	}
+	group.mu.RLock()
+	delivered := group.fanout(&Message{ID: "dev", ClientID: "alice", Content: "deploy", Channel: "dev"}, true)
+	group.mu.RUnlock()
+	slices.Sort(delivered)
+	if !slices.Equal(delivered, want) {
+		t.Errorf("delivered to %d clients, want the %d subscribed to every channel", len(delivered), len(want))
+	}
+}
+
+func TestFanoutBelowThresholdIsSequential(t *testing.T) {
+	o := newTestHub(t, func(cfg *config.WebSocketConfig) { cfg.ParallelFanoutThreshold = 100 })
+	group := NewGroupHub(o, "acme", "general")
+	addFanoutClients(o, group, 99, 1)
+
+	before := parallelFanouts.Value()
+	group.mu.RLock()
+	delivered := group.fanout(&Message{ID: "m1", ClientID: "alice", Content: "hello"}, true)
+	group.mu.RUnlock()
+	if len(delivered) != 99 {
+		t.Errorf("delivered to %d clients, want 99", len(delivered))
+	}
+	if got := parallelFanouts.Value() - before; got != 0 {
+		t.Errorf("%d parallel fan-outs, want 0", got)
+	}
+}
+
+func BenchmarkFanout(b *testing.B) {
+	for _, size := range []int{100, 1000, 20000} {
+		for _, strategy := range []struct {
+			name      string
+			threshold int
+		}{
+			{"sequential", 0},
+			{"parallel", 1},
+		} {
+			b.Run(fmt.Sprintf("%s/%d", strategy.name, size), func(b *testing.B) {
+				cfg := config.DefaultConfig()
+				cfg.WebSocket.ParallelFanoutThreshold = strategy.threshold
+				o := NewOrgHub(cfg.WebSocket, cfg.Message)
+				group := NewGroupHub(o, "acme", "general")
+				clients := addFanoutClients(o, group, size, 1)
+				message := &Message{ID: "m1", ClientID: "alice", Content: "hello"}
+
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					group.mu.RLock()
+					group.fanout(message, false)
+					group.mu.RUnlock()
+
+					b.StopTimer()
+					for _, c := range clients {
+						<-c.Send
+					}
+					b.StartTimer()
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package hub
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"go-realtime-workspace/models"
+)
+
+// Event types carried in Message.Type. Chat messages leave Type empty.
+const (
+	TypeDelete         = "delete"          // A stored message was removed
+	TypeRestore        = "restore"         // A deleted message was restored by its author
+	TypeHistory        = "history"         // Stored messages replayed to connected clients
+	TypeLag            = "lag"             // The client missed messages and should backfill from history
+	TypePresence       = "presence"        // A user of the org came online, went offline or changed status
+	TypePresenceBatch  = "presence_batch"  // Several users' presence changed; sent instead of presence frames while batching
+	TypeConnectionInfo = "connection_info" // First frame on every connection
+	TypeRosterRequest  = "roster_request"  // Sent by a group client to ask for a roster frame
+	TypeRoster         = "roster"          // The members connected to the group
+	TypeAck            = "ack"             // Sent by a group client to acknowledge an ack_required message
+	TypePin            = "pin"             // A member pinned a group message with /pin
+	TypeMissedSummary  = "missed_summary"  // What the user missed while offline, sent after connection_info
+	TypeReauth         = "reauth"          // Sent by a client to present a refreshed access token
+	TypeReauthOK       = "reauth_ok"       // The refreshed access token was accepted
+	TypePollResults    = "poll_results"    // The tallies of a group poll changed
+	TypeGroupState     = "group_state"     // The group was frozen or unfrozen
+	TypeTyping         = "typing"          // A group client started typing; relayed to the rest of the group, never stored
+	TypeStopTyping     = "stop_typing"     // A group client stopped typing; relayed like typing
+	TypeNotification   = "notification"    // A direct message arrived while the user had no DM connection
+	TypeError          = "error"           // A client message was rejected
+)
+
+// Error codes carried by error frames.
+const (
+	ErrCodeUnauthorized    = "unauthorized"      // The client may not perform the action
+	ErrCodeRateLimited     = "rate_limited"      // Too many messages; back off and retry
+	ErrCodeMessageTooLarge = "message_too_large" // The message exceeds a size limit
+	ErrCodeNotAMember      = "not_a_member"      // The client does not belong to the group
+	ErrCodeGroupFrozen     = "group_frozen"      // The group is frozen and only admins may post
+	ErrCodeBlocked         = "blocked"           // The recipient does not accept messages from the client
+	ErrCodeFeatureDisabled = "feature_disabled"  // The organization has turned the feature off
+	ErrCodeInvalidMessage  = "invalid_message"   // The message is malformed or missing fields
+	ErrCodeUnknownCommand  = "unknown_command"   // The message starts with / but names no known command
+	ErrCodeCommandFailed   = "command_failed"    // A slash command was recognized but could not be carried out
+	ErrCodeInternal        = "internal"          // A server-side failure; retrying may succeed
+)
+
+// retryableCodes lists the error codes for which resending the same message
+// later may succeed. Clients should back off before retrying these.
+var retryableCodes = map[string]bool{
+	ErrCodeRateLimited: true,
+	ErrCodeInternal:    true,
+}
+
+// ErrorFrame is the payload of an error event.
+type ErrorFrame struct {
+	Code      string                 `json:"code"`
+	Message   string                 `json:"message"`
+	Retryable bool                   `json:"retryable"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+}
+
+// NewErrorFrame returns an error event with the given code, stamped now.
+// Whether the error is retryable is determined by the code.
+func NewErrorFrame(code, message string, details map[string]interface{}, now time.Time) *Message {
+	return &Message{
+		Type:      TypeError,
+		Timestamp: now,
+		Data: ErrorFrame{
+			Code:      code,
+			Message:   message,
+			Retryable: retryableCodes[code],
+			Details:   details,
+		},
+	}
+}
+
+// IsDecodeError reports whether err from ReadJSON means the frame was read
+// but did not decode as a message. The connection is still usable, unlike
+// after other read errors.
+func IsDecodeError(err error) bool {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	return errors.As(err, &syntaxErr) || errors.As(err, &typeErr)
+}
+
+// ConnectionInfo describes a connection as the server resolved it, so
+// clients can confirm their identity and settings after connecting.
+type ConnectionInfo struct {
+	ClientID    string    `json:"client_id"`
+	OrgID       string    `json:"org_id,omitempty"`
+	GroupID     string    `json:"group_id,omitempty"`
+	Subprotocol string    `json:"subprotocol,omitempty"`
+	Protocol    int       `json:"protocol_version"` // Negotiated protocol version
+	Codec       string    `json:"codec"`
+	Compression string    `json:"compression"`
+	Frozen      bool      `json:"frozen,omitempty"` // The group is frozen; see GroupHub.SetFrozen
+	ServerTime  time.Time `json:"server_time"`      // For clients to estimate clock skew
+}
+
+// NewConnectionInfoFrame returns a connection_info event carrying info,
+// stamped with the server time now.
+func NewConnectionInfoFrame(info ConnectionInfo, now time.Time) *Message {
+	info.ServerTime = now.UTC()
+	return &Message{
+		Type:      TypeConnectionInfo,
+		ClientID:  info.ClientID,
+		OrgID:     info.OrgID,
+		GroupID:   info.GroupID,
+		Timestamp: info.ServerTime,
+		Data:      info,
+	}
+}
+
+// NewDeleteEvent returns an event telling clients that the message with the
+// given ID was removed from the group (or DM room) history.
+func NewDeleteEvent(orgID, groupID, messageID string) *Message {
+	return &Message{
+		Type:    TypeDelete,
+		ID:      messageID,
+		OrgID:   orgID,
+		GroupID: groupID,
+	}
+}
+
+// NewRestoreEvent returns an event telling clients that a deleted message
+// is back in the group history. message is the restored stored message.
+func NewRestoreEvent(orgID, groupID, messageID string, message interface{}, now time.Time) *Message {
+	return &Message{
+		Type:      TypeRestore,
+		ID:        messageID,
+		OrgID:     orgID,
+		GroupID:   groupID,
+		Timestamp: now,
+		Data:      message,
+	}
+}
+
+// NewPollResultsEvent returns an event telling clients the new tallies of
+// a group poll after a vote.
+func NewPollResultsEvent(results *models.PollResults, now time.Time) *Message {
+	return &Message{
+		Type:      TypePollResults,
+		ID:        results.ID,
+		OrgID:     results.OrgID,
+		GroupID:   results.GroupID,
+		Timestamp: now,
+		Data:      results,
+	}
+}
+
+// NewHistoryFrame returns an event replaying stored messages of a group to
+// its connected clients, oldest first. messages is the list of stored
+// messages as returned by the history API.
+func NewHistoryFrame(orgID, groupID string, messages interface{}, now time.Time) *Message {
+	return &Message{
+		Type:      TypeHistory,
+		OrgID:     orgID,
+		GroupID:   groupID,
+		Timestamp: now,
+		Data:      messages,
+	}
+}
+
+// LagFrame is the payload of a lag event.
+type LagFrame struct {
+	Missed          int64     `json:"missed"`                     // Messages dropped since the last lag event
+	LatestID        string    `json:"latest_id,omitempty"`        // ID of the newest dropped message, if it was stored
+	LatestTimestamp time.Time `json:"latest_timestamp,omitempty"` // Timestamp of the newest dropped message
+}
+
+// NewLagFrame returns an event telling a client that messages were dropped
+// because it could not keep up, so it can backfill from history.
+func NewLagFrame(lag LagFrame, now time.Time) *Message {
+	return &Message{
+		Type:      TypeLag,
+		Timestamp: now,
+		Data:      lag,
+	}
+}
+
+// NewMissedSummaryFrame returns an event telling a connecting user what
+// they have not read yet.
+func NewMissedSummaryFrame(clientID string, summary *models.MissedSummary, now time.Time) *Message {
+	return &Message{
+		Type:      TypeMissedSummary,
+		ClientID:  clientID,
+		Timestamp: now,
+		Data:      summary,
+	}
+}
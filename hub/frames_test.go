@@ -0,0 +1,115 @@
+package hub
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"go-realtime-workspace/clock"
+
+	"github.com/gorilla/websocket"
+)
+
+// readError reads frames from conn until an error frame arrives and returns
+// its payload.
+func readError(t *testing.T, conn *websocket.Conn) ErrorFrame {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var frame struct {
+			Type string     `json:"type"`
+			Data ErrorFrame `json:"data"`
+		}
+		if err := conn.ReadJSON(&frame); err != nil {
+			t.Fatalf("waiting for an error frame: %v", err)
+		}
+		if frame.Type == TypeError {
+			return frame.Data
+		}
+	}
+}
+
+func TestRejectionErrorCodes(t *testing.T) {
+	tests := []struct {
+		name          string
+		setup         func(o *OrgHub, group *GroupHub)
+		frames        []string
+		wantCode      string
+		wantRetryable bool
+	}{
+		{
+			name:     "invalid JSON",
+			frames:   []string{`not json`},
+			wantCode: ErrCodeInvalidMessage,
+		},
+		{
+			name:     "content too large",
+			frames:   []string{`{"content":"` + strings.Repeat("x", 5000) + `"}`},
+			wantCode: ErrCodeMessageTooLarge,
+		},
+		{
+			name:     "group frozen",
+			setup:    func(o *OrgHub, group *GroupHub) { group.SetFrozen(true) },
+			frames:   []string{`{"content":"hello"}`},
+			wantCode: ErrCodeGroupFrozen,
+		},
+		{
+			name:     "unknown command",
+			frames:   []string{`{"content":"/nope"}`},
+			wantCode: ErrCodeUnknownCommand,
+		},
+		{
+			name:     "malformed reauth",
+			setup:    func(o *OrgHub, group *GroupHub) { o.SetTokenVerifier(userTokens{}) },
+			frames:   []string{`{"type":"reauth"}`},
+			wantCode: ErrCodeUnauthorized,
+		},
+		{
+			name:          "group rate limited",
+			setup:         func(o *OrgHub, group *GroupHub) { group.SetRateLimit(1, 1) },
+			frames:        []string{`{"content":"one"}`, `{"content":"two"}`},
+			wantCode:      ErrCodeRateLimited,
+			wantRetryable: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newTestHub(t, nil)
+			// The clock stands still, so rate limits never refill
+			o.SetClock(clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)))
+			group := NewGroupHub(o, "acme", "general")
+			o.StartGroup(group)
+			if tt.setup != nil {
+				tt.setup(o, group)
+			}
+
+			conn := dialGroup(t, o, group, "alice")
+			for _, frame := range tt.frames {
+				if err := conn.WriteMessage(websocket.TextMessage, []byte(frame)); err != nil {
+					t.Fatalf("write: %v", err)
+				}
+			}
+			got := readError(t, conn)
+			if got.Code != tt.wantCode || got.Retryable != tt.wantRetryable {
+				t.Errorf("got %q (retryable %v), want %q (retryable %v)", got.Code, got.Retryable, tt.wantCode, tt.wantRetryable)
+			}
+		})
+	}
+}
+
+func TestErrorFrameRetryable(t *testing.T) {
+	for code, want := range map[string]bool{
+		ErrCodeUnauthorized:    false,
+		ErrCodeRateLimited:     true,
+		ErrCodeMessageTooLarge: false,
+		ErrCodeNotAMember:      false,
+		ErrCodeBlocked:         false,
+		ErrCodeInvalidMessage:  false,
+		ErrCodeInternal:        true,
+	} {
+		frame := NewErrorFrame(code, "rejected", nil, time.Now()).Data.(ErrorFrame)
+		if frame.Retryable != want {
+			t.Errorf("%s: retryable %v, want %v", code, frame.Retryable, want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package hub
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go-realtime-workspace/models"
+)
+
+// ErrGroupFrozen is returned by CheckPost when a frozen group refuses a
+// message.
+var ErrGroupFrozen = errors.New("group is frozen; only organization admins can post")
+
+// GroupState is the payload of a group_state event.
+type GroupState struct {
+	Frozen bool `json:"frozen"`
+}
+
+// NewGroupStateEvent returns an event telling a group's clients that the
+// group was frozen or unfrozen.
+func NewGroupStateEvent(orgID, groupID string, state GroupState, now time.Time) *Message {
+	return &Message{
+		Type:      TypeGroupState,
+		OrgID:     orgID,
+		GroupID:   groupID,
+		Timestamp: now,
+		Data:      state,
+	}
+}
+
+// Frozen reports whether the group is frozen.
+func (g *GroupHub) Frozen() bool {
+	return g.frozen.Load()
+}
+
+// SetFrozen freezes or unfreezes the group. While frozen, only owners and
+// admins of the organization may post; reading is unaffected. The group's
+// clients are sent a group_state event when the state changes.
+func (g *GroupHub) SetFrozen(frozen bool) {
+	if g.frozen.Swap(frozen) == frozen {
+		return
+	}
+	g.hub.BroadcastToGroup(g.OrgID, g.GroupID, NewGroupStateEvent(g.OrgID, g.GroupID, GroupState{Frozen: frozen}, g.hub.clock.Now()))
+}
+
+// CheckPost returns ErrGroupFrozen if the group is frozen and userID is
+// not an owner or admin of its organization. Without a role lookup, or if
+// the lookup fails, no one may post to a frozen group but the system bot,
+// which always may.
+func (g *GroupHub) CheckPost(userID string) error {
+	if !g.Frozen() || userID == models.SystemUserID {
+		return nil
+	}
+	if g.hub.roles == nil {
+		return ErrGroupFrozen
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), g.hub.cfg.WriteWait)
+	defer cancel()
+	roles, err := g.hub.roles.Roles(ctx, g.OrgID, []string{userID})
+	if err != nil {
+		log.Printf("Error checking the role of %s in frozen group %s: %v", userID, g.GroupID, err)
+		return ErrGroupFrozen
+	}
+	if role := roles[userID]; role != models.RoleOwner && role != models.RoleAdmin {
+		return ErrGroupFrozen
+	}
+	return nil
+}
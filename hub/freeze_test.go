@@ -0,0 +1,57 @@
+package hub
+
+import (
+	"testing"
+	"time"
+
+	"go-realtime-workspace/models"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestFrozenGroupAllowsOnlyAdminPosts(t *testing.T) {
+	o := newTestHub(t, nil)
+	o.SetRoleLookup(fixedRoles{"alice": models.RoleAdmin, "bob": models.RoleMember})
+	group := NewGroupHub(o, "acme", "general")
+	o.StartGroup(group)
+	alice := dialGroup(t, o, group, "alice")
+	bob := dialGroup(t, o, group, "bob")
+	for !group.HasClient("alice") || !group.HasClient("bob") {
+		time.Sleep(time.Millisecond)
+	}
+	post := func(conn *websocket.Conn, content string) {
+		t.Helper()
+		if err := conn.WriteJSON(map[string]string{"content": content}); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+
+	group.SetFrozen(true)
+	if got := readFrame(t, bob, TypeGroupState); got.Data.(map[string]interface{})["frozen"] != true {
+		t.Errorf("group_state %v, want frozen", got.Data)
+	}
+
+	post(bob, "can anyone hear me?")
+	if got := readError(t, bob); got.Code != ErrCodeGroupFrozen {
+		t.Errorf("member post: error code %q, want %q", got.Code, ErrCodeGroupFrozen)
+	}
+	// Members still read what admins post; the refused post never arrives
+	post(alice, "we are looking into it")
+	if got := readFrame(t, bob, ""); got.ClientID != "alice" || got.Content != "we are looking into it" {
+		t.Errorf("bob received %+v, want alice's post", got)
+	}
+	if err := group.CheckPost(models.SystemUserID); err != nil {
+		t.Errorf("system bot: got %v, want it allowed", err)
+	}
+
+	group.SetFrozen(false)
+	readFrame(t, bob, TypeGroupState)
+	post(bob, "thanks")
+	if got := readFrame(t, alice, ""); got.ClientID != "alice" {
+		// Alice's own post is echoed first
+		t.Fatalf("alice received %+v, want her own post", got)
+	}
+	if got := readFrame(t, alice, ""); got.ClientID != "bob" || got.Content != "thanks" {
+		t.Errorf("after unfreezing alice received %+v, want bob's post", got)
+	}
+}
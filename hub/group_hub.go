@@ -1,20 +1,75 @@
 package hub
 
 import (
+	"errors"
 	"fmt"
+	"log"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"go-realtime-workspace/models"
 )
 
 // Message represents a message sent within a group or organization.
 // It contains routing information and the actual message content.
 type Message struct {
-	OrgID       string    `json:"org_id"`       // Organization ID for routing
-	GroupID     string    `json:"group_id"`     // Group ID for routing
-	ClientID    string    `json:"client_id"`    // Originating client ID
-	RecipientID string    `json:"recipient_id"` // Recipient ID for direct messages
-	Content     string    `json:"content"`      // Message payload
-	Timestamp   time.Time `json:"timestamp"`    // Message timestamp
+	Type        string     `json:"type,omitempty"`         // Event type; empty for chat messages
+	Kind        string     `json:"kind,omitempty"`         // Stored kind of a published message (see models.ValidKind); empty for chat
+	ID          string     `json:"id,omitempty"`           // Stored message ID (set once persisted)
+	OrgID       string     `json:"org_id"`                 // Organization ID for routing
+	GroupID     string     `json:"group_id"`               // Group ID for routing
+	ClientID    string     `json:"client_id"`              // Originating client ID
+	RecipientID string     `json:"recipient_id"`           // Recipient ID for direct messages
+	Content     string     `json:"content"`                // Message payload
+	ContentType string     `json:"content_type,omitempty"` // Kind of payload (see models.ValidateContentType); empty for text
+	Timestamp   time.Time  `json:"timestamp"`              // Message timestamp
+	ReplyToID   string     `json:"reply_to_id,omitempty"`  // ID of the message being replied to
+	Channel     string     `json:"channel,omitempty"`      // Optional sub-channel of the group
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`   // Optional time after which the message is deleted
+	AckRequired bool       `json:"ack_required,omitempty"` // Recipients should acknowledge the stored message with an ack frame
+	Action      bool       `json:"action,omitempty"`       // Sent with /me; render as an action of the sender (server-set)
+	Bot         bool       `json:"bot,omitempty"`          // Posted by the system bot (server-set; see NewSystemMessage)
+
+	ForwardedFrom *models.ForwardRef `json:"forwarded_from,omitempty"` // Original of a forwarded message (server-set)
+
+	Data interface{} `json:"data,omitempty"` // Structured payload of an event (see frames.go)
+
+	received time.Time // When the message entered the server (see StampReceived)
+}
+
+// StripEvent clears the event and server-set fields of a client-supplied
+// message, since clients may only send chat messages and never server events.
+func (m *Message) StripEvent() {
+	m.Type = ""
+	m.Kind = ""
+	m.Action = false
+	m.Bot = false
+	m.Data = nil
+	m.ForwardedFrom = nil
+}
+
+// ErrInvalidChannel is returned by Validate for a malformed channel tag.
+var ErrInvalidChannel = errors.New("channel must be 1-50 lowercase letters, digits, underscores or hyphens")
+
+// Validate checks a client-supplied message before it is stored or
+// delivered. It returns an error wrapping models.ErrContentTooLarge when the
+// content exceeds maxContentBytes, ErrInvalidChannel, or an error wrapping
+// models.ErrInvalidContent when structured content is not of one of
+// contentTypes or does not match its schema. Valid structured content is
+// rewritten in canonical form.
+func (m *Message) Validate(maxContentBytes int, contentTypes []string) error {
+	if m.Channel != "" && !models.ValidChannel(m.Channel) {
+		return ErrInvalidChannel
+	}
+	if err := models.ValidateContent(m.Content, maxContentBytes); err != nil {
+		return err
+	}
+	if m.ContentType == models.ContentText {
+		m.ContentType = "" // Text is the default
+	}
+	return models.ValidateContentType(m.ContentType, &m.Content, contentTypes)
 }
 
 // GroupHub manages clients for a specific group within an organization.
@@ -27,19 +82,30 @@ type GroupHub struct {
 	Broadcast  chan *Message      // Channel for broadcasting messages
 	Register   chan *Client       // Channel for registering clients
 	Unregister chan *Client       // Channel for unregistering clients
+	hub        *OrgHub            // Parent organization hub
+	limiter    *tokenBucket       // Throughput cap shared by all senders in the group
+	frozen     atomic.Bool        // Only org owners and admins may post (see CheckPost)
+	quit       chan struct{}      // Closed to ask Run to drain and stop
+	stopped    chan struct{}      // Closed once Run has stopped
+	stopOnce   sync.Once          // Guards closing quit
 	mu         sync.RWMutex       // Mutex for thread-safe access to Clients
+	fanoutBuf  []*Client          // Client snapshot reused by parallel fan-out (Run goroutine only)
 }
 
 // NewGroupHub creates and initializes a new group hub.
 // The group hub must be started by calling Run() in a goroutine.
-func NewGroupHub(orgID, groupID string) *GroupHub {
+func NewGroupHub(orgHub *OrgHub, orgID, groupID string) *GroupHub {
 	return &GroupHub{
+		hub:        orgHub,
+		limiter:    newTokenBucket(orgHub.cfg.GroupMessagesPerSecond, orgHub.cfg.GroupMessageBurst, orgHub.clock),
 		OrgID:      orgID,
 		GroupID:    groupID,
 		Clients:    make(map[string]*Client),
 		Broadcast:  make(chan *Message, 256),
 		Register:   make(chan *Client),
 		Unregister: make(chan *Client),
+		quit:       make(chan struct{}),
+		stopped:    make(chan struct{}),
 	}
 }
 
@@ -50,43 +116,248 @@ func NewGroupHub(orgID, groupID string) *GroupHub {
 // 1. Register: Adds a new client to the group
 // 2. Unregister: Removes a client from the group and closes their channel
 // 3. Broadcast: Sends a message to all clients in the group (non-blocking)
+//
+// Clients whose send buffer stays full are disconnected as slow consumers.
+// When Stop is called, Run delivers any pending broadcasts, closes every
+// client's send channel so their write pumps flush and exit, and returns.
 func (g *GroupHub) Run() {
+	defer close(g.stopped)
+
 	for {
 		select {
+		case <-g.quit:
+			g.drain()
+			return
+
 		case client := <-g.Register:
 			g.mu.Lock()
+			_, exists := g.Clients[client.ID]
+			if !exists {
+				g.hub.userConnected(g.OrgID, client.ID)
+			}
 			g.Clients[client.ID] = client
 			g.mu.Unlock()
 			fmt.Printf("Client %s joined group %s in org %s\n", client.ID, g.GroupID, g.OrgID)
+			if !exists {
+				g.hub.observers.connect(g.OrgID, g.GroupID, client.ID)
+			}
 
 		case client := <-g.Unregister:
 			g.mu.Lock()
-			if _, exists := g.Clients[client.ID]; exists {
+			_, exists := g.Clients[client.ID]
+			if exists {
 				delete(g.Clients, client.ID)
-				close(client.Send)
+				client.closeSend()
+				g.hub.userDisconnected(g.OrgID, client.ID)
 				fmt.Printf("Client %s left group %s in org %s\n", client.ID, g.GroupID, g.OrgID)
 			}
 			g.mu.Unlock()
+			if exists {
+				g.hub.observers.disconnect(g.OrgID, g.GroupID, client.ID)
+			}
 
 		case message := <-g.Broadcast:
-			g.mu.RLock()
-			for _, client := range g.Clients {
-				// Non-blocking send to avoid deadlock
-				select {
-				case client.Send <- message:
-				default:
-					fmt.Printf("Warning: Client %s send channel is full\n", client.ID)
-				}
+			g.broadcast(message)
+		}
+	}
+}
+
+// broadcast delivers a message to every client of the group that wants it.
+// Deliveries of a stored ack_required message are recorded. It runs on the
+// Run goroutine.
+func (g *GroupHub) broadcast(message *Message) {
+	g.hub.observers.message(message)
+
+	track := message.AckRequired && message.ID != "" && g.hub.acks != nil
+
+	g.mu.RLock()
+	delivered := g.fanout(message, track)
+	g.mu.RUnlock()
+
+	if len(delivered) > 0 {
+		go g.recordDeliveries(message, delivered)
+	}
+}
+
+// drain delivers the broadcasts still queued for the group and then closes
+// every client's send channel. It runs on the Run goroutine during shutdown.
+func (g *GroupHub) drain() {
+	for drained := false; !drained; {
+		select {
+		case message := <-g.Broadcast:
+			g.broadcast(message)
+		default:
+			drained = true
+		}
+	}
+
+	g.mu.Lock()
+	var left []string
+	for id, client := range g.Clients {
+		delete(g.Clients, id)
+		client.closeSend()
+		g.hub.userDisconnected(g.OrgID, id)
+		left = append(left, id)
+	}
+	g.mu.Unlock()
+
+	for _, id := range left {
+		g.hub.observers.disconnect(g.OrgID, g.GroupID, id)
+	}
+}
+
+// Stop asks the group hub to drain pending broadcasts and disconnect its
+// clients. It returns a channel that is closed once Run has stopped.
+func (g *GroupHub) Stop() <-chan struct{} {
+	g.stopOnce.Do(func() { close(g.quit) })
+	return g.stopped
+}
+
+// Allow reports whether the group's throughput cap admits another message.
+// Callers check it before enqueueing a message on Broadcast; it protects the
+// group as a whole, however many clients the messages come from.
+func (g *GroupHub) Allow() bool {
+	if g.limiter.allow() {
+		return true
+	}
+	groupRateLimited.Inc()
+	return false
+}
+
+// SetRateLimit overrides the group's throughput cap. A rate of zero removes the cap.
+func (g *GroupHub) SetRateLimit(messagesPerSecond float64, burst int) {
+	g.limiter.set(messagesPerSecond, burst)
+}
+
+// RateLimit returns the group's throughput cap.
+func (g *GroupHub) RateLimit() (messagesPerSecond float64, burst int) {
+	return g.limiter.limits()
+}
+
+// ClientDebug is a snapshot of one client's buffer and pump state.
+type ClientDebug struct {
+	ID            string `json:"id"`
+	SendLen       int    `json:"send_len"`
+	SendCap       int    `json:"send_cap"`
+	Drops         int32  `json:"consecutive_drops"`
+	PendingLag    int64  `json:"pending_lag"`     // Dropped messages not yet reported in a lag frame
+	WritePumpDone bool   `json:"write_pump_done"` // The write pump exited but the client is still registered
+
+	LastPong    *time.Time `json:"last_pong,omitempty"` // When the client last answered a ping
+	MissedPongs int        `json:"missed_pongs"`        // Pings left unanswered in a row
+}
+
+// GroupDebug is a snapshot of a group's in-memory state, for diagnostics.
+type GroupDebug struct {
+	OrgID        string        `json:"org_id"`
+	GroupID      string        `json:"group_id"`
+	BroadcastLen int           `json:"broadcast_len"`
+	BroadcastCap int           `json:"broadcast_cap"`
+	Stopping     bool          `json:"stopping"` // Stop was called
+	Running      bool          `json:"running"`  // Run has not returned
+	Clients      []ClientDebug `json:"clients"`
+}
+
+// Debug returns a snapshot of the group's buffers and goroutine state. The
+// values are read without stopping the group, so they may be slightly stale.
+func (g *GroupHub) Debug() GroupDebug {
+	debug := GroupDebug{
+		OrgID:        g.OrgID,
+		GroupID:      g.GroupID,
+		BroadcastLen: len(g.Broadcast),
+		BroadcastCap: cap(g.Broadcast),
+		Stopping:     isClosed(g.quit),
+		Running:      !isClosed(g.stopped),
+		Clients:      []ClientDebug{},
+	}
+
+	g.mu.RLock()
+	for _, client := range g.Clients {
+		client.lagMu.Lock()
+		pendingLag := client.lag.Missed
+		client.lagMu.Unlock()
+
+		debug.Clients = append(debug.Clients, ClientDebug{
+			ID:            client.ID,
+			SendLen:       len(client.Send),
+			SendCap:       cap(client.Send),
+			Drops:         client.drops.Load(),
+			PendingLag:    pendingLag,
+			WritePumpDone: isClosed(client.done),
+			MissedPongs:   client.MissedPongs(),
+		})
+		if lastPong := client.LastPong(); !lastPong.IsZero() {
+			debug.Clients[len(debug.Clients)-1].LastPong = &lastPong
+		}
+	}
+	g.mu.RUnlock()
+
+	sort.Slice(debug.Clients, func(i, j int) bool { return debug.Clients[i].ID < debug.Clients[j].ID })
+	return debug
+}
+
+// Flush discards the broadcasts queued for the group without delivering
+// them and returns how many were dropped. It is a diagnostic tool for a
+// group whose buffer is stuck; clients miss the flushed messages.
+func (g *GroupHub) Flush() int {
+	flushed := 0
+	for {
+		select {
+		case <-g.Broadcast:
+			flushed++
+		default:
+			if flushed > 0 {
+				log.Printf("Flushed %d queued broadcasts from group %s in org %s", flushed, g.GroupID, g.OrgID)
 			}
-			g.mu.RUnlock()
+			return flushed
 		}
 	}
 }
 
+// queue hands a message to the group's Run loop without blocking. It
+// returns the number of clients connected at that moment, and false if the
+// broadcast channel is full and the message was dropped.
+func (g *GroupHub) queue(message *Message) (int, bool) {
+	select {
+	case g.Broadcast <- message:
+	default:
+		fmt.Printf("Warning: Group %s broadcast channel is full\n", g.GroupID)
+		return 0, false
+	}
+
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return len(g.Clients), true
+}
+
+// HasClient reports whether a client with the given ID is connected to the group.
+func (g *GroupHub) HasClient(id string) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	_, exists := g.Clients[id]
+	return exists
+}
+
+// isClosed reports whether a signal channel has been closed.
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
 // AddClient adds a new client to the group and starts their read/write pumps.
 // This is a convenience method that handles all the setup for a new client.
 func (g *GroupHub) AddClient(client *Client) {
-	g.Register <- client
+	select {
+	case g.Register <- client:
+	case <-g.stopped:
+		client.Conn.Close()
+		close(client.done) // The write pump never runs
+		return
+	}
 	go client.WritePump()
 	go client.readPump()
 }
@@ -94,5 +365,8 @@ func (g *GroupHub) AddClient(client *Client) {
 // RemoveClient removes a client from the group.
 // This will trigger cleanup and close the client's send channel.
 func (g *GroupHub) RemoveClient(client *Client) {
-	g.Unregister <- client
+	select {
+	case g.Unregister <- client:
+	case <-g.stopped:
+	}
 }
@@ -0,0 +1,40 @@
+package hub
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDebugReflectsQueuedMessages(t *testing.T) {
+	o := newTestHub(t, nil)
+	// Not started, so nothing drains the broadcast channel
+	group := NewGroupHub(o, "acme", "general")
+	alice := &Client{ID: "alice", hub: o, Group: group, Send: make(chan *Message, 4), done: make(chan struct{})}
+	group.Clients["alice"] = alice
+
+	for i := 0; i < 3; i++ {
+		if _, ok := group.queue(&Message{Content: "queued"}); !ok {
+			t.Fatalf("queue %d dropped", i+1)
+		}
+	}
+	alice.deliver(NewErrorFrame(ErrCodeInternal, "pending", nil, time.Now()))
+	alice.deliver(NewErrorFrame(ErrCodeInternal, "pending", nil, time.Now()))
+
+	debug := group.Debug()
+	if debug.BroadcastLen != 3 || debug.BroadcastCap != cap(group.Broadcast) {
+		t.Errorf("broadcast %d/%d, want 3/%d", debug.BroadcastLen, debug.BroadcastCap, cap(group.Broadcast))
+	}
+	if len(debug.Clients) != 1 {
+		t.Fatalf("got %d clients, want 1", len(debug.Clients))
+	}
+	if c := debug.Clients[0]; c.ID != "alice" || c.SendLen != 2 || c.SendCap != 4 || c.WritePumpDone {
+		t.Errorf("client %+v, want alice with 2 of 4 queued and a live write pump", c)
+	}
+
+	if flushed := group.Flush(); flushed != 3 {
+		t.Errorf("flushed %d, want 3", flushed)
+	}
+	if debug := group.Debug(); debug.BroadcastLen != 0 {
+		t.Errorf("broadcast holds %d after flushing, want 0", debug.BroadcastLen)
+	}
+}
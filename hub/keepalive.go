@@ -0,0 +1,74 @@
+package hub
+
+import (
+	"log"
+	"time"
+
+	"go-realtime-workspace/metrics"
+)
+
+// deadPeers counts connections closed because the peer stopped answering pings.
+var deadPeers = metrics.NewCounter("hub_dead_peers_total")
+
+// StartKeepAlive arms the read deadline of the client's connection and
+// extends it by pongWait whenever a pong arrives, recording the pong for
+// dead-peer detection. It must be called on the read pump before reading.
+func (c *Client) StartKeepAlive(pongWait time.Duration) {
+	c.Conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.Conn.SetPongHandler(func(string) error {
+		c.lastPong.Store(c.hub.clock.Now().UnixNano())
+		c.Conn.SetReadDeadline(time.Now().Add(pongWait))
+		return nil
+	})
+}
+
+// LastPong returns when the client last answered a ping, or the zero time
+// if it never has.
+func (c *Client) LastPong() time.Time {
+	if nanos := c.lastPong.Load(); nanos != 0 {
+		return time.Unix(0, nanos)
+	}
+	return time.Time{}
+}
+
+// MissedPongs returns how many pings in a row the client has left
+// unanswered.
+func (c *Client) MissedPongs() int {
+	return int(c.missedPongs.Load())
+}
+
+// pingInterval returns how often the write pump pings the client: every
+// ProbeInterval when dead-peer probing is configured, else every PingPeriod.
+func (c *Client) pingInterval() time.Duration {
+	if cfg := c.hub.cfg; cfg.MaxMissedPongs > 0 && cfg.ProbeInterval > 0 {
+		return cfg.ProbeInterval
+	}
+	return c.hub.cfg.PingPeriod
+}
+
+// probe runs on the write pump before each ping. It counts the pings left
+// unanswered since the last pong and reports false once MaxMissedPongs is
+// reached, after closing the connection: a half-open connection keeps
+// accepting pings into the OS buffer, so write errors alone do not reveal
+// a peer that is gone. Closing makes the read pump fail and unregister the
+// client as usual.
+func (c *Client) probe() bool {
+	max := c.hub.cfg.MaxMissedPongs
+	if max <= 0 {
+		return true
+	}
+
+	pinged := c.lastPing.Load()
+	if pinged == 0 || c.lastPong.Load() >= pinged {
+		c.missedPongs.Store(0)
+		return true
+	}
+	if missed := c.missedPongs.Add(1); int(missed) < max {
+		return true
+	}
+
+	deadPeers.Inc()
+	log.Printf("Client %s missed %d pongs (last pong %s); closing dead connection", c.ID, max, c.LastPong().Format(time.RFC3339))
+	c.closeOnce.Do(func() { c.Conn.Close() })
+	return false
+}
@@ -0,0 +1,62 @@
+package hub
+
+import (
+	"testing"
+	"time"
+
+	"go-realtime-workspace/config"
+)
+
+func TestMissedPongsCloseDeadPeers(t *testing.T) {
+	const probe = 20 * time.Millisecond
+	o := newTestHub(t, func(cfg *config.WebSocketConfig) {
+		cfg.MaxMissedPongs = 3
+		cfg.ProbeInterval = probe
+		cfg.PongWait = time.Minute // Far beyond the expected window
+	})
+	group := NewGroupHub(o, "acme", "general")
+	o.StartGroup(group)
+
+	// Gorilla answers pings while reading, so a client that reads stays
+	// alive and one that never reads looks like a silent peer
+	alive := dialGroup(t, o, group, "alive")
+	go func() {
+		for {
+			if _, _, err := alive.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	dialGroup(t, o, group, "dead")
+	for !group.HasClient("alive") || !group.HasClient("dead") {
+		time.Sleep(time.Millisecond)
+	}
+	start := time.Now()
+	before := deadPeers.Value()
+
+	deadline := start.Add(5 * time.Second)
+	for group.HasClient("dead") {
+		if time.Now().After(deadline) {
+			t.Fatal("silent peer was never closed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// Three unanswered pings, then the probe before the fourth closes it
+	if elapsed := time.Since(start); elapsed > 20*probe {
+		t.Errorf("silent peer closed after %s, want about %s", elapsed, 4*probe)
+	}
+	if got := deadPeers.Value() - before; got != 1 {
+		t.Errorf("dead peer counter rose by %d, want 1", got)
+	}
+
+	time.Sleep(5 * probe)
+	if !group.HasClient("alive") {
+		t.Fatal("peer answering pings was closed")
+	}
+	group.mu.RLock()
+	c := group.Clients["alive"]
+	group.mu.RUnlock()
+	if c.LastPong().IsZero() || c.MissedPongs() != 0 {
+		t.Errorf("last pong %s with %d missed, want a recent pong and none missed", c.LastPong(), c.MissedPongs())
+	}
+}
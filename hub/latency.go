@@ -0,0 +1,62 @@
+package hub
+
+import (
+	"time"
+
+	"go-realtime-workspace/metrics"
+)
+
+// Delivery paths the latency histograms are labeled by.
+const (
+	pathGroup = "group" // A message to one group
+	pathDM    = "dm"    // A direct message
+	pathOrg   = "org"   // An announcement to every group of an organization
+)
+
+// deliveryLatency holds the histograms of the time from a message entering
+// the server to its being queued on each recipient's send channel. For
+// stored messages this includes the write to Redis, which REST handlers
+// and the DM read pump make before fan-out.
+type deliveryLatency struct {
+	group, dm, org *metrics.Histogram
+}
+
+// newDeliveryLatency registers the latency histograms with the given
+// bucket bounds, or returns nil when there are none.
+func newDeliveryLatency(bounds []time.Duration) *deliveryLatency {
+	if len(bounds) == 0 {
+		return nil
+	}
+	const name = "hub_delivery_latency_us"
+	return &deliveryLatency{
+		group: metrics.NewHistogram(name, `path="`+pathGroup+`"`, bounds),
+		dm:    metrics.NewHistogram(name, `path="`+pathDM+`"`, bounds),
+		org:   metrics.NewHistogram(name, `path="`+pathOrg+`"`, bounds),
+	}
+}
+
+// observe records the latency of a message just queued for a recipient.
+// Messages not stamped with StampReceived, such as events, are skipped.
+func (l *deliveryLatency) observe(message *Message) {
+	if l == nil || message.received.IsZero() {
+		return
+	}
+	since := time.Since(message.received)
+	switch {
+	case message.RecipientID != "":
+		l.dm.Observe(since)
+	case message.GroupID == "":
+		l.org.Observe(since)
+	default:
+		l.group.Observe(since)
+	}
+}
+
+// StampReceived marks the time the message entered the server, from which
+// its delivery latency is measured. Read pumps and REST handlers call it
+// as soon as a message is decoded; a stamped message keeps its time.
+func (m *Message) StampReceived() {
+	if m.received.IsZero() {
+		m.received = time.Now()
+	}
+}
@@ -0,0 +1,77 @@
+package hub
+
+import (
+	"testing"
+	"time"
+
+	"go-realtime-workspace/metrics"
+	"go-realtime-workspace/models"
+)
+
+// latencyCount returns how many latencies the histogram of path holds.
+func latencyCount(path string) int64 {
+	return metrics.Snapshot()[`hub_delivery_latency_us_count{path="`+path+`"}`]
+}
+
+// waitLatencyCount waits briefly for the histogram of path to reach want,
+// since a latency is observed just after the message is queued, and
+// returns the count it ends with.
+func waitLatencyCount(path string, want int64) int64 {
+	deadline := time.Now().Add(time.Second)
+	for latencyCount(path) < want && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	return latencyCount(path)
+}
+
+func TestDeliveryLatencyIsObserved(t *testing.T) {
+	o := newTestHub(t, nil)
+	go o.Run() // Registers DM clients
+	o.SetMessageStore(&recordingStore{})
+	general := NewGroupHub(o, "acme", "general")
+	o.StartGroup(general)
+	alice := dialGroup(t, o, general, "alice")
+	bob := dialGroup(t, o, general, "bob")
+	dm, _ := acceptClient(t, o, "carol")
+	o.RegisterDM <- dm
+	for !general.HasClient("alice") || !general.HasClient("bob") {
+		time.Sleep(time.Millisecond)
+	}
+	for _, ok := o.GetDirectClient("carol"); !ok; _, ok = o.GetDirectClient("carol") {
+		time.Sleep(time.Millisecond)
+	}
+	group, org, direct := latencyCount(pathGroup), latencyCount(pathOrg), latencyCount(pathDM)
+
+	// A message read from a client is stamped by the read pump and
+	// observed once per recipient
+	if err := alice.WriteJSON(map[string]string{"content": "hello"}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	readFrame(t, alice, "")
+	readFrame(t, bob, "")
+	if got := waitLatencyCount(pathGroup, group+2) - group; got != 2 {
+		t.Errorf("group histogram rose by %d, want 2", got)
+	}
+
+	if _, err := o.Publish(&Message{OrgID: "acme", Kind: models.KindAnnouncement, Content: "office closed"}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	readFrame(t, alice, "")
+	readFrame(t, bob, "")
+	if got := waitLatencyCount(pathOrg, org+2) - org; got != 2 {
+		t.Errorf("org histogram rose by %d, want 2", got)
+	}
+	if _, err := o.Publish(&Message{ClientID: "alice", RecipientID: "carol", Content: "ping"}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if got := waitLatencyCount(pathDM, direct+1) - direct; got != 1 {
+		t.Errorf("DM histogram rose by %d, want 1", got)
+	}
+
+	// Events are not stamped and so not observed
+	general.SetFrozen(true)
+	readFrame(t, bob, TypeGroupState)
+	if got := latencyCount(pathGroup) - group; got != 2 {
+		t.Errorf("group histogram rose by %d after an event, want 2", got)
+	}
+}
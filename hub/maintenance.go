@@ -0,0 +1,17 @@
+package hub
+
+import "log"
+
+// SetMaintenance turns maintenance mode on or off. While it is on, handlers
+// refuse new WebSocket connections; existing connections are unaffected and
+// keep working until they close or the server shuts down.
+func (o *OrgHub) SetMaintenance(on bool) {
+	if o.maintenance.Swap(on) != on {
+		log.Printf("Maintenance mode %s", map[bool]string{true: "enabled", false: "disabled"}[on])
+	}
+}
+
+// InMaintenance reports whether maintenance mode is on.
+func (o *OrgHub) InMaintenance() bool {
+	return o.maintenance.Load()
+}
@@ -0,0 +1,85 @@
+package hub
+
+import (
+	"context"
+
+	"go-realtime-workspace/models"
+)
+
+// NotificationFilter decides whether an event should notify a user, from
+// their notification preferences (see repository.NotificationRepository).
+type NotificationFilter interface {
+	ShouldNotify(ctx context.Context, userID, event, orgID, groupID string) bool
+}
+
+// SetNotificationFilter sets whose preferences are consulted before a user
+// is sent a notification frame. It must be called before clients connect;
+// without it every notification is sent.
+func (o *OrgHub) SetNotificationFilter(filter NotificationFilter) {
+	o.notifications = filter
+}
+
+// NotificationFrame is the payload of a notification event.
+type NotificationFrame struct {
+	Event     string `json:"event"`                // One of the models.Notification* events
+	MessageID string `json:"message_id,omitempty"` // The stored message the event is about
+	From      string `json:"from"`                 // Who sent the message
+}
+
+// notify sends userID a notification frame about message on each of their
+// group connections, unless their preferences turn the event off, and
+// returns how many connections it was sent to. orgID and groupID name the
+// group of a group event and are empty for DMs.
+func (o *OrgHub) notify(userID, event, orgID, groupID string, message *Message) int {
+	clients := o.groupClientsOf(userID)
+	if len(clients) == 0 {
+		return 0
+	}
+
+	if o.notifications != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), o.cfg.WriteWait)
+		defer cancel()
+		if !o.notifications.ShouldNotify(ctx, userID, event, orgID, groupID) {
+			return 0
+		}
+	}
+
+	frame := &Message{
+		Type:      TypeNotification,
+		OrgID:     orgID,
+		GroupID:   groupID,
+		Timestamp: o.clock.Now(),
+		Data:      NotificationFrame{Event: event, MessageID: message.ID, From: message.ClientID},
+	}
+	sent := 0
+	for _, client := range clients {
+		if client.deliver(frame) {
+			sent++
+		}
+	}
+	return sent
+}
+
+// groupClientsOf returns the group connections of a user in every organization.
+func (o *OrgHub) groupClientsOf(userID string) []*Client {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	var clients []*Client
+	for _, org := range o.Organizations {
+		for _, group := range org.Groups {
+			group.mu.RLock()
+			if client, ok := group.Clients[userID]; ok {
+				clients = append(clients, client)
+			}
+			group.mu.RUnlock()
+		}
+	}
+	return clients
+}
+
+// notifyDM tells the recipient of a direct message, who is not connected
+// for DMs, about it on their group connections.
+func (o *OrgHub) notifyDM(recipientID string, message *Message) {
+	o.notify(recipientID, models.NotificationDM, "", "", message)
+}
@@ -0,0 +1,72 @@
+package hub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// mutedUsers is a NotificationFilter that notifies everyone but its users.
+type mutedUsers map[string]bool
+
+func (m mutedUsers) ShouldNotify(ctx context.Context, userID, event, orgID, groupID string) bool {
+	return !m[userID]
+}
+
+// readFrame reads frames from conn until one of type typ arrives.
+func readFrame(t *testing.T, conn *websocket.Conn, typ string) *Message {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var message Message
+		if err := conn.ReadJSON(&message); err != nil {
+			t.Fatalf("waiting for a %q frame: %v", typ, err)
+		}
+		if message.Type == typ {
+			return &message
+		}
+	}
+}
+
+func TestDirectMessageNotification(t *testing.T) {
+	o := newTestHub(t, nil)
+	o.SetNotificationFilter(mutedUsers{"bob": true})
+	group := NewGroupHub(o, "acme", "general")
+	o.StartGroup(group)
+
+	alice := dialGroup(t, o, group, "alice")
+	bob := dialGroup(t, o, group, "bob")
+	for !group.HasClient("alice") || !group.HasClient("bob") {
+		time.Sleep(time.Millisecond)
+	}
+
+	for _, recipient := range []string{"alice", "bob"} {
+		if o.SendDirectMessage(recipient, &Message{ID: "dm-" + recipient, ClientID: "carol", RecipientID: recipient, Content: "hi"}) {
+			t.Fatalf("DM to %s reported delivered without a DM connection", recipient)
+		}
+	}
+
+	frame := readFrame(t, alice, TypeNotification)
+	data := frame.Data.(map[string]interface{})
+	if data["event"] != "dm" || data["message_id"] != "dm-alice" || data["from"] != "carol" {
+		t.Errorf("alice got notification %v", data)
+	}
+
+	// Bob muted DMs, so the next frame he gets is the broadcast after the DM
+	o.BroadcastToGroup("acme", "general", &Message{Type: TypeGroupState})
+	bob.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var message Message
+		if err := bob.ReadJSON(&message); err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if message.Type == TypeNotification {
+			t.Fatal("bob was notified despite muting DMs")
+		}
+		if message.Type == TypeGroupState {
+			break
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package hub
+
+import (
+	"log"
+	"sync"
+)
+
+// EventObserver is notified of hub events, for integrations such as
+// analytics, webhooks or auditing. Observers are called synchronously on
+// the hub goroutine that handles the event, so they must return quickly and
+// hand slow work off to their own goroutines. The Message passed to
+// OnMessage is shared with every recipient and must not be modified.
+type EventObserver interface {
+	OnConnect(orgID, groupID, clientID string)    // A client joined a group (groupID and orgID are empty for DM connections)
+	OnDisconnect(orgID, groupID, clientID string) // A client left a group or DMs
+	OnMessage(message *Message)                   // A message or event is being delivered to a group
+	OnGroupCreated(orgID, groupID string)         // A group was registered with the hub
+}
+
+// NopObserver implements EventObserver with no-op methods. Embed it to
+// implement only the callbacks an observer cares about.
+type NopObserver struct{}
+
+func (NopObserver) OnConnect(orgID, groupID, clientID string)    {}
+func (NopObserver) OnDisconnect(orgID, groupID, clientID string) {}
+func (NopObserver) OnMessage(message *Message)                   {}
+func (NopObserver) OnGroupCreated(orgID, groupID string)         {}
+
+// observerRegistry holds the observers registered with an OrgHub.
+type observerRegistry struct {
+	mu        sync.RWMutex
+	observers []EventObserver
+}
+
+// AddObserver registers an observer for hub events. Observers are called
+// in registration order; a panicking observer is logged and does not
+// affect the hub or the other observers.
+func (o *OrgHub) AddObserver(observer EventObserver) {
+	o.observers.mu.Lock()
+	defer o.observers.mu.Unlock()
+	o.observers.observers = append(o.observers.observers, observer)
+}
+
+// notify calls fn for every registered observer, isolating panics.
+func (r *observerRegistry) notify(event string, fn func(EventObserver)) {
+	r.mu.RLock()
+	observers := r.observers
+	r.mu.RUnlock()
+
+	for _, observer := range observers {
+		func() {
+			defer func() {
+				if p := recover(); p != nil {
+					log.Printf("Event observer %T panicked in %s: %v", observer, event, p)
+				}
+			}()
+			fn(observer)
+		}()
+	}
+}
+
+func (r *observerRegistry) connect(orgID, groupID, clientID string) {
+	r.notify("OnConnect", func(obs EventObserver) { obs.OnConnect(orgID, groupID, clientID) })
+}
+
+func (r *observerRegistry) disconnect(orgID, groupID, clientID string) {
+	r.notify("OnDisconnect", func(obs EventObserver) { obs.OnDisconnect(orgID, groupID, clientID) })
+}
+
+func (r *observerRegistry) message(message *Message) {
+	r.notify("OnMessage", func(obs EventObserver) { obs.OnMessage(message) })
+}
+
+func (r *observerRegistry) groupCreated(orgID, groupID string) {
+	r.notify("OnGroupCreated", func(obs EventObserver) { obs.OnGroupCreated(orgID, groupID) })
+}
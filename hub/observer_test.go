@@ -0,0 +1,65 @@
+package hub
+
+import (
+	"testing"
+	"time"
+)
+
+// recordingObserver sends a description of every event it sees.
+type recordingObserver struct {
+	events chan string
+}
+
+func (r recordingObserver) OnConnect(orgID, groupID, clientID string) {
+	r.events <- "connect " + orgID + "/" + groupID + " " + clientID
+}
+
+func (r recordingObserver) OnDisconnect(orgID, groupID, clientID string) {
+	r.events <- "disconnect " + orgID + "/" + groupID + " " + clientID
+}
+
+func (r recordingObserver) OnMessage(message *Message) {
+	r.events <- "message " + message.OrgID + "/" + message.GroupID + " " + message.Content
+}
+
+func (r recordingObserver) OnGroupCreated(orgID, groupID string) {
+	r.events <- "group " + orgID + "/" + groupID
+}
+
+// panickingObserver fails on every connection.
+type panickingObserver struct{ NopObserver }
+
+func (panickingObserver) OnConnect(orgID, groupID, clientID string) { panic("boom") }
+
+func TestObserversReceiveEvents(t *testing.T) {
+	o := newTestHub(t, nil)
+	recorder := recordingObserver{events: make(chan string, 16)}
+	// A panicking observer does not keep the others from being called
+	o.AddObserver(panickingObserver{})
+	o.AddObserver(recorder)
+
+	expect := func(want string) {
+		t.Helper()
+		select {
+		case got := <-recorder.events:
+			if got != want {
+				t.Fatalf("got event %q, want %q", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no event, want %q", want)
+		}
+	}
+
+	group := NewGroupHub(o, "acme", "general")
+	o.StartGroup(group)
+	expect("group acme/general")
+
+	alice := dialGroup(t, o, group, "alice")
+	expect("connect acme/general alice")
+
+	o.BroadcastToGroup("acme", "general", &Message{OrgID: "acme", GroupID: "general", ClientID: "bob", Content: "hi"})
+	expect("message acme/general hi")
+
+	alice.Close()
+	expect("disconnect acme/general alice")
+}
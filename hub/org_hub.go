@@ -3,8 +3,17 @@
 package hub
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-realtime-workspace/clock"
+	"go-realtime-workspace/config"
+	"go-realtime-workspace/models"
+	"go-realtime-workspace/sanitize"
 )
 
 // Org represents an organization that contains multiple groups.
@@ -15,31 +24,103 @@ type Org struct {
 	Groups map[string]*GroupHub `json:"groups"`
 }
 
+// FeatureChecker reports whether an organization has a feature enabled.
+// Names are the feature constants in the models package.
+type FeatureChecker interface {
+	FeatureEnabled(ctx context.Context, orgID, feature string) bool
+}
+
 // OrgHub manages all organizations and their group hubs.
 // It acts as the top-level hub that coordinates message routing
 // across all organizations and groups in the system.
 type OrgHub struct {
-	Organizations     map[string]*Org    // Map of organization ID to Org
-	DirectConnections map[string]*Client // Map of user ID to connected client for DMs
-	Register          chan *GroupHub     // Channel for registering new groups
-	Unregister        chan *GroupHub     // Channel for unregistering groups
-	RegisterDM        chan *Client       // Channel for registering DM clients
-	UnregisterDM      chan *Client       // Channel for unregistering DM clients
-	mu                sync.RWMutex       // Mutex for thread-safe access to Organizations
-	dmMu              sync.RWMutex       // Mutex for thread-safe access to DirectConnections
+	Organizations     map[string]*Org         // Map of organization ID to Org
+	DirectConnections map[string]*Client      // Map of user ID to connected client for DMs
+	Register          chan *GroupHub          // Channel for registering new groups
+	Unregister        chan *GroupHub          // Channel for unregistering groups
+	RegisterDM        chan *Client            // Channel for registering DM clients
+	UnregisterDM      chan *Client            // Channel for unregistering DM clients
+	cfg               config.WebSocketConfig  // WebSocket settings shared by all clients
+	sanitize          sanitize.Mode           // Sanitization applied to message content before delivery
+	maxContentBytes   int                     // Largest message content accepted from clients (0 disables)
+	contentTypes      []string                // Structured content types accepted besides text
+	dmExpiresInMin    time.Duration           // Shortest expires_in accepted on a direct message
+	dmExpiresInMax    time.Duration           // Longest expires_in accepted on a direct message
+	features          FeatureChecker          // Per-org feature flags consulted by read pumps (nil allows everything)
+	roles             RoleLookup              // Member roles for roster frames (nil leaves roles out)
+	acks              AckStore                // Delivery and ack state of ack_required messages (nil refuses acks)
+	store             MessageStore            // Where Publish persists messages (nil delivers without storing)
+	pins              PinStore                // Where /pin pins messages (nil makes /pin fail)
+	tokens            TokenVerifier           // Checks the access tokens of connections (nil leaves them unauthenticated)
+	undelivered       UndeliveredStore        // Where ack_required messages are stashed after a failed write (nil loses them)
+	notifications     NotificationFilter      // Notification preferences of users (nil notifies everyone)
+	rateLimits        RateLimitStore          // Stored group throughput cap overrides (nil keeps the configured cap)
+	commands          commandRegistry         // Slash commands group clients may send
+	observers         observerRegistry        // Integrations notified of connections, messages and new groups
+	latency           *deliveryLatency        // Receive-to-enqueue latency histograms (nil when disabled)
+	clock             clock.Clock             // Time source for group rate limits and frame timestamps
+	running           map[*GroupHub]struct{}  // Group hubs whose Run goroutine is alive
+	presence          map[string]*orgPresence // Map of organization ID to who is online and who is watching
+	closing           bool                    // Set by Shutdown so the reconciler stands down
+	maintenance       atomic.Bool             // New connections are refused while set
+	connections       atomic.Int64            // Open WebSocket connections of every kind
+	orgConnections    map[string]int64        // Open group and presence connections per organization
+	connectStart      time.Time               // Start of the current UserConnectsPerMinute window
+	connectCounts     map[string]int          // Connection attempts per user in the current window
+	connMu            sync.Mutex              // Mutex for thread-safe access to orgConnections and the connect window
+	mu                sync.RWMutex            // Mutex for thread-safe access to Organizations, running and closing
+	dmMu              sync.RWMutex            // Mutex for thread-safe access to DirectConnections
+	presenceMu        sync.Mutex              // Mutex for thread-safe access to presence
 }
 
 // NewOrgHub creates and initializes a new organization hub.
 // It should be called once at application startup.
-func NewOrgHub() *OrgHub {
-	return &OrgHub{
+func NewOrgHub(cfg config.WebSocketConfig, msgCfg config.MessageConfig) *OrgHub {
+	o := &OrgHub{
+		cfg:               cfg,
+		sanitize:          sanitize.Mode(msgCfg.Sanitize),
+		maxContentBytes:   msgCfg.MaxContentBytes,
+		contentTypes:      msgCfg.ContentTypes,
+		latency:           newDeliveryLatency(cfg.DeliveryLatencyBuckets),
+		dmExpiresInMin:    msgCfg.DMExpiresInMin,
+		dmExpiresInMax:    msgCfg.DMExpiresInMax,
 		Organizations:     make(map[string]*Org),
 		DirectConnections: make(map[string]*Client),
+		running:           make(map[*GroupHub]struct{}),
+		presence:          make(map[string]*orgPresence),
+		orgConnections:    make(map[string]int64),
+		connectCounts:     make(map[string]int),
+		clock:             clock.Real{},
 		Register:          make(chan *GroupHub),
 		Unregister:        make(chan *GroupHub),
 		RegisterDM:        make(chan *Client),
 		UnregisterDM:      make(chan *Client),
 	}
+	o.registerBuiltinCommands()
+	return o
+}
+
+// SetFeatureChecker sets the per-org feature flags consulted by client read
+// pumps. It must be called before clients connect.
+func (o *OrgHub) SetFeatureChecker(features FeatureChecker) {
+	o.features = features
+}
+
+// SetClock replaces the time source used by group rate limits and frame
+// timestamps. It must be called before groups are created.
+func (o *OrgHub) SetClock(c clock.Clock) {
+	o.clock = c
+}
+
+// Now returns the current time of the hub's clock, for handlers stamping
+// messages and frames they pass to the hub.
+func (o *OrgHub) Now() time.Time {
+	return o.clock.Now()
+}
+
+// featureEnabled reports whether an organization has a feature enabled.
+func (o *OrgHub) featureEnabled(orgID, feature string) bool {
+	return o.features == nil || o.features.FeatureEnabled(context.Background(), orgID, feature)
 }
 
 // Run handles registration and unregistration for the organization hub.
@@ -56,18 +137,10 @@ func (o *OrgHub) Run() {
 		select {
 		case group := <-o.Register:
 			o.mu.Lock()
-			org, exists := o.Organizations[group.OrgID]
-			if !exists {
-				org = &Org{
-					ID:     group.OrgID,
-					Name:   group.OrgID, // You might want to set this properly
-					Groups: make(map[string]*GroupHub),
-				}
-				o.Organizations[group.OrgID] = org
-			}
-			org.Groups[group.GroupID] = group
+			o.addGroupLocked(group)
 			o.mu.Unlock()
 			fmt.Printf("Group %s registered under organization: %s\n", group.GroupID, group.OrgID)
+			o.observers.groupCreated(group.OrgID, group.GroupID)
 
 		case group := <-o.Unregister:
 			o.mu.Lock()
@@ -85,19 +158,158 @@ func (o *OrgHub) Run() {
 			o.DirectConnections[client.ID] = client
 			o.dmMu.Unlock()
 			fmt.Printf("Client %s registered for direct messaging\n", client.ID)
+			o.observers.connect("", "", client.ID)
 
 		case client := <-o.UnregisterDM:
 			o.dmMu.Lock()
-			if _, exists := o.DirectConnections[client.ID]; exists {
+			_, exists := o.DirectConnections[client.ID]
+			if exists {
 				delete(o.DirectConnections, client.ID)
-				close(client.Send)
+				client.closeSend()
 			}
 			o.dmMu.Unlock()
+			if exists {
+				o.observers.disconnect("", "", client.ID)
+			}
 			fmt.Printf("Client %s unregistered from direct messaging\n", client.ID)
 		}
 	}
 }
 
+// addGroupLocked adds a group to its organization, creating the organization
+// if needed. Callers must hold o.mu.
+func (o *OrgHub) addGroupLocked(group *GroupHub) {
+	org, exists := o.Organizations[group.OrgID]
+	if !exists {
+		org = &Org{
+			ID:     group.OrgID,
+			Name:   group.OrgID, // You might want to set this properly
+			Groups: make(map[string]*GroupHub),
+		}
+		o.Organizations[group.OrgID] = org
+	}
+	org.Groups[group.GroupID] = group
+}
+
+// Shutdown drains the hub before the process exits. Groups are stopped in
+// WebSocket.DrainWaves waves, WebSocket.DrainWaveDelay apart: each group
+// delivers the broadcasts still queued for it, then its clients have their
+// send channels closed so the write pumps flush buffered messages and send
+// a close frame hinting when to reconnect (see hintReconnect). Presence
+// clients close with the last wave, and DM clients in a wave of their own
+// after it. Connections still flushing when ctx expires are closed
+// forcibly and ctx.Err() is returned.
+func (o *OrgHub) Shutdown(ctx context.Context) error {
+	var clients []*Client
+
+	o.mu.Lock()
+	o.closing = true
+	var groups []*GroupHub
+	for _, org := range o.Organizations {
+		for _, group := range org.Groups {
+			groups = append(groups, group)
+		}
+	}
+	o.mu.Unlock()
+
+	// One pause before each group wave but the first, and one before DMs
+	waves := drainWaves(groups, o.cfg.DrainWaves)
+	delay := o.waveDelay(ctx, len(waves))
+
+	for i, wave := range waves {
+		if i > 0 {
+			pause(ctx, delay)
+		}
+
+		// Collect each group's clients before they are removed
+		var stopped []<-chan struct{}
+		for _, group := range wave {
+			group.mu.RLock()
+			for _, client := range group.Clients {
+				client.hintReconnect()
+				clients = append(clients, client)
+			}
+			group.mu.RUnlock()
+			stopped = append(stopped, group.Stop())
+		}
+		for _, done := range stopped {
+			select {
+			case <-done:
+			case <-ctx.Done():
+			}
+		}
+	}
+
+	// Close presence connections
+	clients = append(clients, o.closePresenceSubscribers()...)
+
+	// Close DM connections last
+	if len(waves) > 0 {
+		pause(ctx, delay)
+	}
+	o.dmMu.Lock()
+	for id, client := range o.DirectConnections {
+		delete(o.DirectConnections, id)
+		client.hintReconnect()
+		client.closeSend()
+		clients = append(clients, client)
+	}
+	o.dmMu.Unlock()
+
+	// Wait for write pumps to flush, forcing the rest closed at the deadline
+	for _, client := range clients {
+		select {
+		case <-client.done:
+		case <-ctx.Done():
+			client.Conn.Close()
+		}
+	}
+
+	fmt.Printf("Hub drained %d connections\n", len(clients))
+	return ctx.Err()
+}
+
+// Stats is a point-in-time summary of hub load.
+type Stats struct {
+	Orgs             int `json:"orgs"`
+	Groups           int `json:"groups"`
+	GroupClients     int `json:"group_clients"`
+	DMConnections    int `json:"dm_connections"`
+	LargestGroupSize int `json:"largest_group_size"`
+
+	Connections int64 `json:"connections"` // Open WebSocket connections of every kind, as counted for WebSocket.MaxConnections
+
+	Maintenance bool `json:"maintenance"` // New connections are being refused
+}
+
+// Stats counts organizations, groups and connections (thread-safe).
+func (o *OrgHub) Stats() Stats {
+	stats := Stats{Maintenance: o.InMaintenance(), Connections: o.connections.Load()}
+
+	o.mu.RLock()
+	stats.Orgs = len(o.Organizations)
+	for _, org := range o.Organizations {
+		stats.Groups += len(org.Groups)
+		for _, group := range org.Groups {
+			group.mu.RLock()
+			size := len(group.Clients)
+			group.mu.RUnlock()
+
+			stats.GroupClients += size
+			if size > stats.LargestGroupSize {
+				stats.LargestGroupSize = size
+			}
+		}
+	}
+	o.mu.RUnlock()
+
+	o.dmMu.RLock()
+	stats.DMConnections = len(o.DirectConnections)
+	o.dmMu.RUnlock()
+
+	return stats
+}
+
 // GetOrganizations returns a copy of all organizations (thread-safe).
 func (o *OrgHub) GetOrganizations() map[string]*Org {
 	o.mu.RLock()
@@ -151,37 +363,66 @@ func (o *OrgHub) GetGroup(orgID, groupID string) (*GroupHub, bool) {
 	return group, exists
 }
 
+// GetGroupIDs returns the IDs of all groups in an organization (thread-safe).
+func (o *OrgHub) GetGroupIDs(orgID string) []string {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	org, exists := o.Organizations[orgID]
+	if !exists {
+		return nil
+	}
+
+	ids := make([]string, 0, len(org.Groups))
+	for id := range org.Groups {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
 // BroadcastToOrg sends a message to all groups in an organization (thread-safe).
 func (o *OrgHub) BroadcastToOrg(orgID string, message *Message) {
+	o.broadcastToOrg(orgID, message)
+}
+
+// broadcastToOrg queues a message on every group of an organization and
+// returns how many groups and connected clients it was queued for.
+func (o *OrgHub) broadcastToOrg(orgID string, message *Message) (groups, clients int) {
 	o.mu.RLock()
 	defer o.mu.RUnlock()
 
+	message = o.sanitized(message)
 	if org, exists := o.Organizations[orgID]; exists {
 		for _, group := range org.Groups {
-			// Non-blocking send to avoid deadlock
-			select {
-			case group.Broadcast <- message:
-			default:
-				fmt.Printf("Warning: Group %s broadcast channel is full\n", group.GroupID)
+			if n, ok := group.queue(message); ok {
+				groups++
+				clients += n
 			}
 		}
 	}
+	return groups, clients
 }
 
 // BroadcastToGroup sends a message to a specific group (thread-safe).
 func (o *OrgHub) BroadcastToGroup(orgID, groupID string, message *Message) {
+	o.broadcastToGroup(orgID, groupID, message)
+}
+
+// broadcastToGroup queues a message on a group and returns how many groups
+// (0 or 1) and connected clients it was queued for.
+func (o *OrgHub) broadcastToGroup(orgID, groupID string, message *Message) (groups, clients int) {
 	o.mu.RLock()
 	defer o.mu.RUnlock()
 
+	message = o.sanitized(message)
 	if org, exists := o.Organizations[orgID]; exists {
 		if group, exists := org.Groups[groupID]; exists {
-			select {
-			case group.Broadcast <- message:
-			default:
-				fmt.Printf("Warning: Group %s broadcast channel is full\n", groupID)
+			if n, ok := group.queue(message); ok {
+				return 1, n
 			}
 		}
 	}
+	return 0, 0
 }
 
 // GetDirectClient returns a connected client by user ID for DM (thread-safe).
@@ -192,20 +433,19 @@ func (o *OrgHub) GetDirectClient(userID string) (*Client, bool) {
 	return client, exists
 }
 
-// SendDirectMessage sends a message directly to a specific user (thread-safe).
+// SendDirectMessage sends a message directly to a specific user (thread-safe)
+// and reports whether it reached their DM connection. A recipient without
+// one is sent a notification frame on their group connections instead, if
+// their notification preferences allow it.
 func (o *OrgHub) SendDirectMessage(recipientID string, message *Message) bool {
 	o.dmMu.RLock()
-	defer o.dmMu.RUnlock()
+	client, exists := o.DirectConnections[recipientID]
+	o.dmMu.RUnlock()
 
-	if client, exists := o.DirectConnections[recipientID]; exists {
-		select {
-		case client.Send <- message:
-			return true
-		default:
-			fmt.Printf("Warning: Client %s send channel is full\n", recipientID)
-			return false
-		}
+	if exists {
+		return client.deliver(o.sanitized(message))
 	}
+	o.notifyDM(recipientID, message)
 	return false
 }
 
@@ -220,3 +460,46 @@ func (o *OrgHub) GetConnectedDMUsers() []string {
 	}
 	return users
 }
+
+// ValidateMessage checks a client-supplied message against the configured
+// content limits and content types, and checks its channel tag. REST handlers and read pumps
+// share it so every entry point rejects the same messages.
+func (o *OrgHub) ValidateMessage(message *Message) error {
+	return message.Validate(o.maxContentBytes, o.contentTypes)
+}
+
+// ErrInvalidExpiry is returned by ApplyDMExpiry for an expiry outside the
+// configured bounds or combined with expires_at.
+var ErrInvalidExpiry = errors.New("invalid message expiry")
+
+// ApplyDMExpiry sets a direct message to expire expiresIn seconds after its
+// timestamp, overriding the normal DM history TTL. expiresIn must lie within
+// Message.DMExpiresInMin and DMExpiresInMax, and cannot be combined with an
+// explicit ExpiresAt. Zero leaves the message unchanged.
+func (o *OrgHub) ApplyDMExpiry(message *Message, expiresIn int) error {
+	if expiresIn == 0 {
+		return nil
+	}
+	if message.ExpiresAt != nil {
+		return fmt.Errorf("%w: expires_in and expires_at cannot both be set", ErrInvalidExpiry)
+	}
+	ttl := time.Duration(expiresIn) * time.Second
+	if ttl < o.dmExpiresInMin || ttl > o.dmExpiresInMax {
+		return fmt.Errorf("%w: expires_in must be between %d and %d seconds", ErrInvalidExpiry,
+			int(o.dmExpiresInMin.Seconds()), int(o.dmExpiresInMax.Seconds()))
+	}
+	expiresAt := message.Timestamp.Add(ttl)
+	message.ExpiresAt = &expiresAt
+	return nil
+}
+
+// sanitized returns a copy of message with its content sanitized, leaving the
+// caller's message untouched so it is never sanitized twice.
+func (o *OrgHub) sanitized(message *Message) *Message {
+	if o.sanitize == sanitize.Off || message.Content == "" {
+		return message
+	}
+	clean := *message
+	clean.Content = o.sanitize.ApplyContent(message.Content, models.StructuredContent(message.ContentType))
+	return &clean
+}
@@ -0,0 +1,122 @@
+package hub
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"go-realtime-workspace/config"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestShutdownFlushesQueuedBroadcasts(t *testing.T) {
+	o := newTestHub(t, func(cfg *config.WebSocketConfig) {
+		cfg.DrainWaveDelay = 0
+	})
+	group := NewGroupHub(o, "acme", "general")
+	o.StartGroup(group)
+	conn := dialGroup(t, o, group, "alice")
+	for !group.HasClient("alice") {
+		time.Sleep(time.Millisecond)
+	}
+
+	const queued = 100
+	for i := 0; i < queued; i++ {
+		o.BroadcastToGroup("acme", "general", &Message{ClientID: "bob", Content: fmt.Sprint(i)})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := o.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	// Every queued message arrives, in order, before the close frame
+	next := 0
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var message Message
+		err := conn.ReadJSON(&message)
+		if websocket.IsCloseError(err, websocket.CloseServiceRestart) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if message.Type != "" {
+			continue
+		}
+		if message.Content != fmt.Sprint(next) {
+			t.Fatalf("got message %q, want %d", message.Content, next)
+		}
+		next++
+	}
+	if next != queued {
+		t.Errorf("received %d of %d queued messages", next, queued)
+	}
+}
+
+func TestStatsCountsJoins(t *testing.T) {
+	o := newTestHub(t, nil)
+	go o.Run() // Registers DM clients
+
+	general := NewGroupHub(o, "acme", "general")
+	random := NewGroupHub(o, "acme", "random")
+	ops := NewGroupHub(o, "globex", "ops")
+	for _, group := range []*GroupHub{general, random, ops} {
+		o.StartGroup(group)
+	}
+	for _, id := range []string{"alice", "bob", "carol"} {
+		dialGroup(t, o, general, id)
+	}
+	dialGroup(t, o, random, "alice")
+	dm, _ := acceptClient(t, o, "dave")
+	o.RegisterDM <- dm
+
+	want := Stats{Orgs: 2, Groups: 3, GroupClients: 4, DMConnections: 1, LargestGroupSize: 3, Connections: 5}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got := o.Stats()
+		if got == want {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("stats %+v, want %+v", got, want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestBroadcastSanitizesContent(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Message.Sanitize = "escape"
+	o := NewOrgHub(cfg.WebSocket, cfg.Message)
+	group := NewGroupHub(o, "acme", "general")
+	o.StartGroup(group)
+	conn := dialGroup(t, o, group, "alice")
+	for !group.HasClient("alice") {
+		time.Sleep(time.Millisecond)
+	}
+
+	sent := &Message{ClientID: "mallory", Content: "<script>alert(1)</script>"}
+	o.BroadcastToGroup("acme", "general", sent)
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var message Message
+		if err := conn.ReadJSON(&message); err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if message.Type != "" {
+			continue
+		}
+		if want := "&lt;script&gt;alert(1)&lt;/script&gt;"; message.Content != want {
+			t.Errorf("delivered %q, want %q", message.Content, want)
+		}
+		break
+	}
+	if sent.Content != "<script>alert(1)</script>" {
+		t.Errorf("the caller's message was modified to %q", sent.Content)
+	}
+}
@@ -0,0 +1,382 @@
+package hub
+
+import (
+	"log"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Presence events carried in PresenceFrame.Event.
+const (
+	PresenceOnline  = "online"  // The user opened their first connection in the org
+	PresenceOffline = "offline" // The user closed their last connection in the org
+	PresenceStatus  = "status"  // The user changed their status while online
+)
+
+// Statuses a user may set while online.
+const (
+	StatusAvailable = "available"
+	StatusAway      = "away"
+	StatusBusy      = "busy"
+)
+
+// ValidStatus reports whether status is one of the user statuses.
+func ValidStatus(status string) bool {
+	switch status {
+	case StatusAvailable, StatusAway, StatusBusy:
+		return true
+	}
+	return false
+}
+
+// PresenceFrame is the payload of a presence event.
+type PresenceFrame struct {
+	UserID string `json:"user_id"`
+	Event  string `json:"event"`
+	Status string `json:"status,omitempty"` // Current status for online and status events
+}
+
+// NewPresenceFrame returns an event telling presence subscribers that a
+// user of the org came online, went offline or changed status.
+func NewPresenceFrame(orgID string, presence PresenceFrame, now time.Time) *Message {
+	return &Message{
+		Type:      TypePresence,
+		OrgID:     orgID,
+		ClientID:  presence.UserID,
+		Timestamp: now,
+		Data:      presence,
+	}
+}
+
+// PresenceBatch is the payload of a presence_batch event: the presence
+// changes of an org over one WebSocket.PresenceBatchWindow, at most one per
+// user, in the order the users first changed.
+type PresenceBatch struct {
+	Changes []PresenceFrame `json:"changes"`
+}
+
+// NewPresenceBatchFrame returns an event telling presence subscribers about
+// several presence changes at once.
+func NewPresenceBatchFrame(orgID string, changes []PresenceFrame, now time.Time) *Message {
+	return &Message{
+		Type:      TypePresenceBatch,
+		OrgID:     orgID,
+		Timestamp: now,
+		Data:      PresenceBatch{Changes: changes},
+	}
+}
+
+// statusUpdate is the frame a presence subscriber sends to change its status.
+type statusUpdate struct {
+	Status string `json:"status"`
+}
+
+// orgPresence tracks who is online in one organization and who is watching.
+type orgPresence struct {
+	connections map[string]int       // User ID to open group and presence connections, plus one for a live heartbeat
+	status      map[string]string    // User ID to status, for online users
+	heartbeats  map[string]time.Time // User ID to when the user's REST heartbeat lapses
+	subscribers map[*Client]struct{} // Presence clients streaming the org's events
+
+	batch   []PresenceFrame // Changes waiting for the batch window to end, nil when no window is open
+	batched map[string]int  // User ID to the index of their change in batch
+}
+
+// presenceLocked returns the presence state of an org, creating it if
+// needed. Callers must hold o.presenceMu.
+func (o *OrgHub) presenceLocked(orgID string) *orgPresence {
+	p, exists := o.presence[orgID]
+	if !exists {
+		p = &orgPresence{
+			connections: make(map[string]int),
+			status:      make(map[string]string),
+			heartbeats:  make(map[string]time.Time),
+			subscribers: make(map[*Client]struct{}),
+		}
+		o.presence[orgID] = p
+	}
+	return p
+}
+
+// publishLocked delivers a presence event to every subscriber of the org.
+// With WebSocket.PresenceBatchWindow set, the event is instead added to the
+// org's open batch, opening one if needed, and delivered when the window
+// ends. Callers must hold o.presenceMu.
+func (o *OrgHub) publishLocked(orgID string, p *orgPresence, presence PresenceFrame) {
+	window := o.cfg.PresenceBatchWindow
+	if window <= 0 {
+		frame := NewPresenceFrame(orgID, presence, o.clock.Now())
+		for client := range p.subscribers {
+			client.deliver(frame)
+		}
+		return
+	}
+	if len(p.subscribers) == 0 {
+		return // Later subscribers start from the current state anyway
+	}
+
+	if p.batch == nil {
+		p.batched = make(map[string]int)
+		time.AfterFunc(window, func() { o.flushPresence(orgID, p) })
+	}
+	i, exists := p.batched[presence.UserID]
+	if !exists {
+		p.batched[presence.UserID] = len(p.batch)
+		p.batch = append(p.batch, presence)
+		return
+	}
+	p.batch[i] = mergePresence(p.batch[i], presence)
+}
+
+// mergePresence coalesces a user's next presence change into their earlier
+// one, so that a subscriber applying the result ends up where it would
+// after applying both: a status change after coming online is still an
+// online event, with the new status.
+func mergePresence(earlier, next PresenceFrame) PresenceFrame {
+	if next.Event == PresenceStatus && earlier.Event == PresenceOnline {
+		next.Event = PresenceOnline
+	}
+	return next
+}
+
+// flushPresence ends the open batch window of an org and delivers its
+// changes to the subscribers as one presence_batch frame.
+func (o *OrgHub) flushPresence(orgID string, p *orgPresence) {
+	o.presenceMu.Lock()
+	defer o.presenceMu.Unlock()
+
+	changes := p.batch
+	p.batch, p.batched = nil, nil
+	if len(changes) == 0 {
+		return
+	}
+	frame := NewPresenceBatchFrame(orgID, changes, o.clock.Now())
+	for client := range p.subscribers {
+		client.deliver(frame)
+	}
+}
+
+// userConnected counts a new connection of a user in an org, announcing the
+// user as online when it is their first.
+func (o *OrgHub) userConnected(orgID, userID string) {
+	o.presenceMu.Lock()
+	defer o.presenceMu.Unlock()
+	o.connectLocked(orgID, o.presenceLocked(orgID), userID)
+}
+
+// userDisconnected counts a closed connection of a user in an org,
+// announcing the user as offline when it was their last.
+func (o *OrgHub) userDisconnected(orgID, userID string) {
+	o.presenceMu.Lock()
+	defer o.presenceMu.Unlock()
+
+	if p, exists := o.presence[orgID]; exists {
+		o.disconnectLocked(orgID, p, userID)
+	}
+}
+
+// connectLocked counts a connection. Callers must hold o.presenceMu.
+func (o *OrgHub) connectLocked(orgID string, p *orgPresence, userID string) {
+	p.connections[userID]++
+	if p.connections[userID] == 1 {
+		p.status[userID] = StatusAvailable
+		o.publishLocked(orgID, p, PresenceFrame{UserID: userID, Event: PresenceOnline, Status: StatusAvailable})
+	}
+}
+
+// disconnectLocked uncounts a connection. Callers must hold o.presenceMu.
+func (o *OrgHub) disconnectLocked(orgID string, p *orgPresence, userID string) {
+	if p.connections[userID] == 0 {
+		return
+	}
+
+	p.connections[userID]--
+	if p.connections[userID] > 0 {
+		return
+	}
+	delete(p.connections, userID)
+	delete(p.status, userID)
+	o.publishLocked(orgID, p, PresenceFrame{UserID: userID, Event: PresenceOffline})
+
+	if len(p.connections) == 0 && len(p.subscribers) == 0 {
+		delete(o.presence, orgID)
+	}
+}
+
+// Heartbeat keeps a user without a WebSocket online in an org for
+// WebSocket.HeartbeatGrace. Each heartbeat restarts the grace period; a live
+// heartbeat counts as one connection of the user.
+func (o *OrgHub) Heartbeat(orgID, userID string) {
+	grace := o.cfg.HeartbeatGrace
+
+	o.presenceMu.Lock()
+	defer o.presenceMu.Unlock()
+
+	p := o.presenceLocked(orgID)
+	_, beating := p.heartbeats[userID]
+	p.heartbeats[userID] = time.Now().Add(grace)
+	if !beating {
+		o.connectLocked(orgID, p, userID)
+		time.AfterFunc(grace, func() { o.expireHeartbeat(orgID, userID) })
+	}
+}
+
+// expireHeartbeat ends a user's heartbeat once its grace period has lapsed,
+// checking again later if a newer heartbeat extended it.
+func (o *OrgHub) expireHeartbeat(orgID, userID string) {
+	o.presenceMu.Lock()
+	defer o.presenceMu.Unlock()
+
+	p, exists := o.presence[orgID]
+	if !exists {
+		return
+	}
+	deadline, beating := p.heartbeats[userID]
+	if !beating {
+		return
+	}
+	if remaining := time.Until(deadline); remaining > 0 {
+		time.AfterFunc(remaining, func() { o.expireHeartbeat(orgID, userID) })
+		return
+	}
+
+	delete(p.heartbeats, userID)
+	o.disconnectLocked(orgID, p, userID)
+}
+
+// IsOnline reports whether a user has a connection or a live heartbeat in an org.
+func (o *OrgHub) IsOnline(orgID, userID string) bool {
+	o.presenceMu.Lock()
+	defer o.presenceMu.Unlock()
+
+	p, exists := o.presence[orgID]
+	return exists && p.connections[userID] > 0
+}
+
+// OnlineStatuses returns the status of every user online in an org, keyed
+// by user ID.
+func (o *OrgHub) OnlineStatuses(orgID string) map[string]string {
+	o.presenceMu.Lock()
+	defer o.presenceMu.Unlock()
+
+	statuses := make(map[string]string)
+	if p, exists := o.presence[orgID]; exists {
+		for userID, status := range p.status {
+			statuses[userID] = status
+		}
+	}
+	return statuses
+}
+
+// SetStatus changes the status of a user who is online in an org and
+// announces it. It returns false if the user is not online.
+func (o *OrgHub) SetStatus(orgID, userID, status string) bool {
+	o.presenceMu.Lock()
+	defer o.presenceMu.Unlock()
+
+	p, exists := o.presence[orgID]
+	if !exists || p.connections[userID] == 0 {
+		return false
+	}
+	if p.status[userID] != status {
+		p.status[userID] = status
+		o.publishLocked(orgID, p, PresenceFrame{UserID: userID, Event: PresenceStatus, Status: status})
+	}
+	return true
+}
+
+// AddPresenceSubscriber registers a presence client for its org and starts
+// its pumps. The subscriber first receives an online event for every user
+// already online, then every presence event of the org as it happens. The
+// connection itself counts towards its user being online.
+func (o *OrgHub) AddPresenceSubscriber(client *Client) {
+	orgID := client.Info.OrgID
+
+	o.presenceMu.Lock()
+	p := o.presenceLocked(orgID)
+	for userID := range p.connections {
+		client.deliver(NewPresenceFrame(orgID, PresenceFrame{UserID: userID, Event: PresenceOnline, Status: p.status[userID]}, o.clock.Now()))
+	}
+	p.subscribers[client] = struct{}{}
+	o.presenceMu.Unlock()
+
+	o.userConnected(orgID, client.ID)
+
+	go client.WritePump()
+	go client.presenceReadPump()
+}
+
+// removePresenceSubscriber unregisters a presence client and closes its
+// send channel. It is a no-op if Shutdown already removed the client.
+func (o *OrgHub) removePresenceSubscriber(client *Client) {
+	orgID := client.Info.OrgID
+
+	o.presenceMu.Lock()
+	p, exists := o.presence[orgID]
+	if exists {
+		if _, subscribed := p.subscribers[client]; subscribed {
+			delete(p.subscribers, client)
+			client.closeSend()
+		} else {
+			exists = false
+		}
+	}
+	o.presenceMu.Unlock()
+
+	if exists {
+		o.userDisconnected(orgID, client.ID)
+	}
+}
+
+// closePresenceSubscribers removes every presence client and closes its
+// send channel with a reconnect hint, returning the clients so Shutdown can
+// wait for them.
+func (o *OrgHub) closePresenceSubscribers() []*Client {
+	o.presenceMu.Lock()
+	defer o.presenceMu.Unlock()
+
+	var clients []*Client
+	for _, p := range o.presence {
+		for client := range p.subscribers {
+			delete(p.subscribers, client)
+			client.hintReconnect()
+			client.closeSend()
+			clients = append(clients, client)
+		}
+	}
+	return clients
+}
+
+// presenceReadPump reads status updates from a presence client until the
+// connection closes, then unregisters the client.
+func (c *Client) presenceReadPump() {
+	cfg := c.hub.cfg
+	defer func() {
+		c.hub.removePresenceSubscriber(c)
+		c.Conn.Close()
+	}()
+
+	c.StartKeepAlive(cfg.PongWait)
+	c.Conn.SetReadLimit(cfg.MaxMessageSize)
+
+	for {
+		var update statusUpdate
+		if err := c.Conn.ReadJSON(&update); err != nil {
+			if IsDecodeError(err) {
+				c.SendError(ErrCodeInvalidMessage, "Message is not valid JSON", nil)
+				continue
+			}
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				log.Printf("Unexpected close error for presence client %s: %v", c.ID, err)
+			}
+			break
+		}
+
+		if !ValidStatus(update.Status) {
+			c.SendError(ErrCodeInvalidMessage, "status must be one of: available, away, busy", nil)
+			continue
+		}
+		c.hub.SetStatus(c.Info.OrgID, c.ID, update.Status)
+	}
+}
@@ -0,0 +1,207 @@
+package hub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-realtime-workspace/config"
+
+	"github.com/gorilla/websocket"
+)
+
+// dialPresence connects a presence subscriber for orgID through a test
+// server and returns the client's end of the connection.
+func dialPresence(t *testing.T, o *OrgHub, orgID, id string) *websocket.Conn {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		o.AddPresenceSubscriber(NewPresenceClient(o, orgID, id, conn, false, ProtocolVersion))
+	}))
+	t.Cleanup(srv.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// readPresence reads frames from conn until a presence event arrives and
+// returns its payload.
+func readPresence(t *testing.T, conn *websocket.Conn) PresenceFrame {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var frame struct {
+			Type string        `json:"type"`
+			Data PresenceFrame `json:"data"`
+		}
+		if err := conn.ReadJSON(&frame); err != nil {
+			t.Fatalf("waiting for a presence frame: %v", err)
+		}
+		if frame.Type == TypePresence {
+			return frame.Data
+		}
+	}
+}
+
+func TestPresenceSubscriberSeesTransitions(t *testing.T) {
+	o := newTestHub(t, nil)
+	acme := NewGroupHub(o, "acme", "general")
+	o.StartGroup(acme)
+	globex := NewGroupHub(o, "globex", "general")
+	o.StartGroup(globex)
+
+	watcher := dialPresence(t, o, "acme", "watcher")
+	if got := readPresence(t, watcher); got.UserID != "watcher" || got.Event != PresenceOnline {
+		t.Fatalf("first event %+v, want the watcher online", got)
+	}
+
+	// Users of other orgs are not reported
+	dialGroup(t, o, globex, "carol")
+	for !globex.HasClient("carol") {
+		time.Sleep(time.Millisecond)
+	}
+
+	bob := dialGroup(t, o, acme, "bob")
+	want := PresenceFrame{UserID: "bob", Event: PresenceOnline, Status: StatusAvailable}
+	if got := readPresence(t, watcher); got != want {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	if !o.IsOnline("acme", "bob") {
+		t.Error("bob is not online")
+	}
+
+	bob.Close()
+	want = PresenceFrame{UserID: "bob", Event: PresenceOffline}
+	if got := readPresence(t, watcher); got != want {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	if o.IsOnline("acme", "bob") {
+		t.Error("bob is still online")
+	}
+}
+
+func TestPresenceSubscriberStartsFromCurrentState(t *testing.T) {
+	o := newTestHub(t, nil)
+	group := NewGroupHub(o, "acme", "general")
+	o.StartGroup(group)
+	dialGroup(t, o, group, "alice")
+	for !o.IsOnline("acme", "alice") {
+		time.Sleep(time.Millisecond)
+	}
+
+	watcher := dialPresence(t, o, "acme", "watcher")
+	want := PresenceFrame{UserID: "alice", Event: PresenceOnline, Status: StatusAvailable}
+	if got := readPresence(t, watcher); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestHeartbeatKeepsUserOnline(t *testing.T) {
+	const grace = 100 * time.Millisecond
+	o := newTestHub(t, func(cfg *config.WebSocketConfig) {
+		cfg.HeartbeatGrace = grace
+	})
+	watcher := dialPresence(t, o, "acme", "watcher")
+	readPresence(t, watcher) // The watcher itself
+
+	// Heartbeats more often than the grace period keep the user online
+	var last time.Time
+	for i := 0; i < 6; i++ {
+		o.Heartbeat("acme", "bot")
+		last = time.Now()
+		if !o.IsOnline("acme", "bot") {
+			t.Fatalf("offline after heartbeat %d", i+1)
+		}
+		time.Sleep(grace / 3)
+	}
+	if got := readPresence(t, watcher); got.UserID != "bot" || got.Event != PresenceOnline {
+		t.Fatalf("got %+v, want bot online once", got)
+	}
+
+	// Once heartbeats stop, the user goes offline after the grace period
+	if got := readPresence(t, watcher); got.UserID != "bot" || got.Event != PresenceOffline {
+		t.Fatalf("got %+v, want bot offline", got)
+	}
+	if elapsed := time.Since(last); elapsed < grace {
+		t.Errorf("offline %s after the last heartbeat, before the %s grace period", elapsed, grace)
+	}
+	if o.IsOnline("acme", "bot") {
+		t.Error("bot is still online")
+	}
+}
+
+// readPresenceBatch reads frames from conn until a presence_batch event
+// arrives and returns its changes. A single presence frame fails the test.
+func readPresenceBatch(t *testing.T, conn *websocket.Conn) []PresenceFrame {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var frame struct {
+			Type string        `json:"type"`
+			Data PresenceBatch `json:"data"`
+		}
+		if err := conn.ReadJSON(&frame); err != nil {
+			t.Fatalf("waiting for a presence_batch frame: %v", err)
+		}
+		switch frame.Type {
+		case TypePresence:
+			t.Fatal("got a presence frame while batching")
+		case TypePresenceBatch:
+			return frame.Data.Changes
+		}
+	}
+}
+
+func TestPresenceChangesAreBatched(t *testing.T) {
+	const window = 200 * time.Millisecond
+	o := newTestHub(t, func(cfg *config.WebSocketConfig) {
+		cfg.PresenceBatchWindow = window
+	})
+	group := NewGroupHub(o, "acme", "general")
+	o.StartGroup(group)
+	watcher := dialPresence(t, o, "acme", "watcher")
+	readPresenceBatch(t, watcher) // The watcher itself
+
+	for _, id := range []string{"alice", "bob", "carol"} {
+		dialGroup(t, o, group, id)
+		for !group.HasClient(id) {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	o.Heartbeat("acme", "bot")
+	o.SetStatus("acme", "bot", StatusBusy)
+
+	// One frame, in the order users first changed, with the bot's status
+	// change folded into its coming online
+	want := []PresenceFrame{
+		{UserID: "alice", Event: PresenceOnline, Status: StatusAvailable},
+		{UserID: "bob", Event: PresenceOnline, Status: StatusAvailable},
+		{UserID: "carol", Event: PresenceOnline, Status: StatusAvailable},
+		{UserID: "bot", Event: PresenceOnline, Status: StatusBusy},
+	}
+	got := readPresenceBatch(t, watcher)
+	if len(got) != len(want) {
+		t.Fatalf("batch %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("change %d: %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	watcher.SetReadDeadline(time.Now().Add(2 * window))
+	var frame Message
+	if err := watcher.ReadJSON(&frame); err == nil {
+		t.Errorf("got another %q frame, want the single batch", frame.Type)
+	}
+}
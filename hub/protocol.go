@@ -0,0 +1,38 @@
+package hub
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// ProtocolVersion is the newest WebSocket protocol version this server
+// speaks. Bump it whenever the handshake, codecs or frames change in a way
+// clients must opt into, and gate the new behaviour on Client.ProtocolVersion.
+const ProtocolVersion = 1
+
+// CloseProtocolOutdated is the close code sent to a client whose declared
+// protocol version is older than WebSocket.MinProtocolVersion.
+const CloseProtocolOutdated = 4006
+
+// ParseProtocolVersion parses the protocol version a client declares when
+// connecting. Clients that declare none predate versioning and speak
+// version 1. A version newer than ProtocolVersion is negotiated down to it.
+func ParseProtocolVersion(declared string) (int, error) {
+	if declared == "" {
+		return 1, nil
+	}
+	version, err := strconv.Atoi(declared)
+	if err != nil || version < 1 {
+		return 0, fmt.Errorf("protocol version must be a positive integer")
+	}
+	if version > ProtocolVersion {
+		version = ProtocolVersion
+	}
+	return version, nil
+}
+
+// OutdatedProtocolReason is the close reason sent with CloseProtocolOutdated.
+// It stays within the 123 bytes a close frame allows.
+func OutdatedProtocolReason(version, minVersion int) string {
+	return fmt.Sprintf("protocol version %d is no longer supported; upgrade the client to version %d or later", version, minVersion)
+}
@@ -0,0 +1,33 @@
+package hub
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseProtocolVersion(t *testing.T) {
+	for _, tt := range []struct {
+		declared string
+		want     int
+		ok       bool
+	}{
+		{"", 1, true}, // Clients from before versioning
+		{"1", 1, true},
+		{fmt.Sprint(ProtocolVersion + 1), ProtocolVersion, true},
+		{"0", 0, false},
+		{"-1", 0, false},
+		{"v1", 0, false},
+	} {
+		got, err := ParseProtocolVersion(tt.declared)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("ParseProtocolVersion(%q) = %d, %v; want %d, ok %v", tt.declared, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestOutdatedProtocolReasonFitsCloseFrame(t *testing.T) {
+	// A close frame's reason is limited to 123 bytes
+	if reason := OutdatedProtocolReason(1<<31-1, 1<<31-1); len(reason) > 123 {
+		t.Errorf("reason is %d bytes: %q", len(reason), reason)
+	}
+}
@@ -0,0 +1,207 @@
+package hub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go-realtime-workspace/models"
+)
+
+// dmOrgID is the org ID direct messages are stored under; it matches
+// repository.DMOrgID.
+const dmOrgID = "dm"
+
+// MessageStore persists messages published through Publish.
+type MessageStore interface {
+	Save(ctx context.Context, msg models.ChatMessage) (*models.ChatMessage, error)
+	SaveAnnouncement(ctx context.Context, msg models.ChatMessage, groupIDs []string) error
+}
+
+// SetMessageStore sets where Publish persists messages. It must be called
+// before Publish is used; without it published messages are delivered but
+// not stored.
+func (o *OrgHub) SetMessageStore(store MessageStore) {
+	o.store = store
+}
+
+var (
+	// ErrNoTarget is returned by Publish for a message without a recipient,
+	// group or organization.
+	ErrNoTarget = errors.New("message has no recipient, group or organization")
+
+	// ErrTargetNotFound is returned by Publish when the target organization
+	// or group does not exist.
+	ErrTargetNotFound = errors.New("organization or group not found")
+
+	// ErrInvalidKind is returned by Publish for a kind that does not fit the
+	// target: announcements go to organizations, chat and system messages to
+	// groups and recipients.
+	ErrInvalidKind = errors.New("invalid message kind for target")
+)
+
+// Delivery reports where Publish sent a message. Group deliveries are
+// queued, so Clients counts the clients connected when the message was
+// queued, not those that have received it.
+type Delivery struct {
+	Groups  int  `json:"groups"`  // Groups the message was queued on
+	Clients int  `json:"clients"` // Clients the message was sent or queued to
+	Stored  bool `json:"stored"`  // The message was persisted
+}
+
+// Publish is the entry point for server code that sends messages outside a
+// client connection, such as background jobs and integrations. The target
+// follows from the message fields:
+//
+//   - RecipientID set: a direct message from ClientID to the recipient
+//   - GroupID set: a message to that group of OrgID
+//   - only OrgID set: an announcement to every group of the organization
+//
+// Chat messages (empty Type) are validated and persisted before delivery
+// according to their Kind; events are only delivered. Group messages and
+// announcements without a ClientID are posted by the system bot (see
+// NewSystemMessage). If persisting fails the message is not delivered, so
+// the caller may retry it. Usernames are not looked up.
+func (o *OrgHub) Publish(message *Message) (Delivery, error) {
+	if message.Type == "" {
+		message.StampReceived()
+	}
+	if message.Timestamp.IsZero() {
+		message.Timestamp = o.clock.Now()
+	}
+
+	var target string
+	switch {
+	case message.RecipientID != "":
+		if message.ClientID == "" {
+			return Delivery{}, fmt.Errorf("%w: direct messages need a client_id", ErrNoTarget)
+		}
+		target = "dm"
+		message.OrgID, message.GroupID, message.Channel = "", "", ""
+	case message.GroupID != "":
+		if _, exists := o.GetGroup(message.OrgID, message.GroupID); !exists {
+			return Delivery{}, ErrTargetNotFound
+		}
+		target = "group"
+	case message.OrgID != "":
+		if _, exists := o.GetOrganization(message.OrgID); !exists {
+			return Delivery{}, ErrTargetNotFound
+		}
+		target = "org"
+		message.Channel = "" // Channels are per group
+	default:
+		return Delivery{}, ErrNoTarget
+	}
+
+	if message.Type == "" {
+		message.AssignSystemAuthor()
+		if err := o.validatePublished(message, target); err != nil {
+			return Delivery{}, err
+		}
+		if err := o.persist(message, target); err != nil {
+			return Delivery{}, err
+		}
+	}
+	if message.ID == "" {
+		message.AckRequired = false // Nothing for recipients to acknowledge
+	}
+
+	delivery := Delivery{Stored: message.Type == "" && o.store != nil}
+	switch target {
+	case "dm":
+		if o.SendDirectMessage(message.RecipientID, message) {
+			delivery.Clients = 1
+		}
+	case "group":
+		delivery.Groups, delivery.Clients = o.broadcastToGroup(message.OrgID, message.GroupID, message)
+	case "org":
+		delivery.Groups, delivery.Clients = o.broadcastToOrg(message.OrgID, message)
+	}
+	return delivery, nil
+}
+
+// validatePublished checks a published chat message the way client
+// messages are checked, plus its kind against the target.
+func (o *OrgHub) validatePublished(message *Message, target string) error {
+	if err := o.ValidateMessage(message); err != nil {
+		return err
+	}
+	if message.ExpiresAt != nil && !message.ExpiresAt.After(message.Timestamp) {
+		return fmt.Errorf("%w: expires_at must be after the timestamp", ErrInvalidExpiry)
+	}
+
+	switch message.Kind {
+	case "":
+	case models.KindAnnouncement:
+		if target != "org" {
+			return ErrInvalidKind
+		}
+	case models.KindChat, models.KindSystem:
+		if target == "org" {
+			return ErrInvalidKind
+		}
+	default:
+		return ErrInvalidKind
+	}
+	return nil
+}
+
+// persist stores a published chat message and sets its stored ID.
+// Announcements are stored once and referenced from every group.
+func (o *OrgHub) persist(message *Message, target string) error {
+	if o.store == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), o.cfg.WriteWait)
+	defer cancel()
+
+	chatMsg := models.ChatMessage{
+		ID:        message.ID,
+		OrgID:     message.OrgID,
+		GroupID:   message.GroupID,
+		ClientID:  message.ClientID,
+		Content:   message.Content,
+		Timestamp: message.Timestamp,
+		ReplyToID: message.ReplyToID,
+		Channel:   message.Channel,
+		ExpiresAt: message.ExpiresAt,
+
+		ContentType: message.ContentType,
+		AckRequired: message.AckRequired,
+		Bot:         message.Bot,
+	}
+	if message.Bot {
+		chatMsg.Username = models.SystemUsername
+	}
+	if message.Kind == models.KindSystem {
+		chatMsg.Kind = models.KindSystem // Chat messages store no kind
+	}
+
+	switch target {
+	case "org":
+		if err := o.store.SaveAnnouncement(ctx, chatMsg, o.GetGroupIDs(message.OrgID)); err != nil {
+			return fmt.Errorf("error storing announcement: %w", err)
+		}
+		return nil
+	case "dm":
+		chatMsg.OrgID, chatMsg.GroupID = dmOrgID, dmRoomID(message.ClientID, message.RecipientID)
+		chatMsg.RecipientID = message.RecipientID
+		chatMsg.AckRequired = false // Acks are tracked for group messages only
+	}
+
+	saved, err := o.store.Save(ctx, chatMsg)
+	if err != nil {
+		return fmt.Errorf("error storing message: %w", err)
+	}
+	message.ID = saved.ID
+	return nil
+}
+
+// dmRoomID returns the room two users' direct messages are stored under.
+func dmRoomID(user1, user2 string) string {
+	if user1 < user2 {
+		return fmt.Sprintf("%s_%s", user1, user2)
+	}
+	return fmt.Sprintf("%s_%s", user2, user1)
+}
@@ -0,0 +1,172 @@
+package hub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"go-realtime-workspace/models"
+)
+
+// recordingStore is a MessageStore keeping what it was asked to persist.
+type recordingStore struct {
+	mu            sync.Mutex
+	saved         []models.ChatMessage
+	announcements map[string][]string // Announcement content by group IDs
+}
+
+func (s *recordingStore) Save(ctx context.Context, msg models.ChatMessage) (*models.ChatMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if msg.ID == "" {
+		msg.ID = fmt.Sprintf("stored-%d", len(s.saved)+1)
+	}
+	s.saved = append(s.saved, msg)
+	return &msg, nil
+}
+
+func (s *recordingStore) SaveAnnouncement(ctx context.Context, msg models.ChatMessage, groupIDs []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.announcements == nil {
+		s.announcements = make(map[string][]string)
+	}
+	s.announcements[msg.Content] = groupIDs
+	return nil
+}
+
+func TestPublishToGroup(t *testing.T) {
+	o := newTestHub(t, nil)
+	store := &recordingStore{}
+	o.SetMessageStore(store)
+	general := NewGroupHub(o, "acme", "general")
+	o.StartGroup(general)
+	o.StartGroup(NewGroupHub(o, "acme", "random"))
+	conn := dialGroup(t, o, general, "alice")
+	for !general.HasClient("alice") {
+		time.Sleep(time.Millisecond)
+	}
+
+	delivery, err := o.Publish(&Message{OrgID: "acme", GroupID: "general", Content: "deploy finished"})
+	if err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if want := (Delivery{Groups: 1, Clients: 1, Stored: true}); delivery != want {
+		t.Errorf("delivery %+v, want %+v", delivery, want)
+	}
+	got := readFrame(t, conn, "")
+	if got.Content != "deploy finished" || got.ClientID != models.SystemUserID || !got.Bot {
+		t.Errorf("delivered %+v, want the bot's message", got)
+	}
+	if got.ID != "stored-1" {
+		t.Errorf("delivered ID %q, want the stored ID", got.ID)
+	}
+	if len(store.saved) != 1 || store.saved[0].GroupID != "general" {
+		t.Errorf("stored %+v, want the message in general", store.saved)
+	}
+}
+
+func TestPublishToOrg(t *testing.T) {
+	o := newTestHub(t, nil)
+	store := &recordingStore{}
+	o.SetMessageStore(store)
+	general := NewGroupHub(o, "acme", "general")
+	o.StartGroup(general)
+	random := NewGroupHub(o, "acme", "random")
+	o.StartGroup(random)
+	o.StartGroup(NewGroupHub(o, "globex", "general"))
+	alice := dialGroup(t, o, general, "alice")
+	bob := dialGroup(t, o, random, "bob")
+	for !general.HasClient("alice") || !random.HasClient("bob") {
+		time.Sleep(time.Millisecond)
+	}
+
+	delivery, err := o.Publish(&Message{OrgID: "acme", Kind: models.KindAnnouncement, Content: "office closed"})
+	if err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if want := (Delivery{Groups: 2, Clients: 2, Stored: true}); delivery != want {
+		t.Errorf("delivery %+v, want %+v", delivery, want)
+	}
+	for _, got := range []*Message{readFrame(t, alice, ""), readFrame(t, bob, "")} {
+		if got.Content != "office closed" {
+			t.Errorf("delivered %q, want the announcement", got.Content)
+		}
+	}
+	if groups := store.announcements["office closed"]; len(groups) != 2 {
+		t.Errorf("announcement stored for %v, want both acme groups", groups)
+	}
+	if len(store.saved) != 0 {
+		t.Errorf("announcement also saved as %d group messages", len(store.saved))
+	}
+}
+
+func TestPublishDirectMessage(t *testing.T) {
+	o := newTestHub(t, nil)
+	go o.Run() // Registers DM clients
+	store := &recordingStore{}
+	o.SetMessageStore(store)
+	dm, _ := acceptClient(t, o, "bob")
+	o.RegisterDM <- dm
+	for _, ok := o.GetDirectClient("bob"); !ok; _, ok = o.GetDirectClient("bob") {
+		time.Sleep(time.Millisecond)
+	}
+
+	delivery, err := o.Publish(&Message{ClientID: "alice", RecipientID: "bob", OrgID: "acme", GroupID: "general", Content: "ping"})
+	if err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if want := (Delivery{Clients: 1, Stored: true}); delivery != want {
+		t.Errorf("delivery %+v, want %+v", delivery, want)
+	}
+	// The client's pumps are not running, so its queue is read directly
+	for got := range dm.Send {
+		if got.Type != "" {
+			continue
+		}
+		if got.Content != "ping" || got.OrgID != "" || got.GroupID != "" {
+			t.Errorf("delivered %+v, want the DM without a group", got)
+		}
+		break
+	}
+	if len(store.saved) != 1 || store.saved[0].OrgID != dmOrgID || store.saved[0].GroupID != "alice_bob" {
+		t.Errorf("stored %+v, want the message in the alice_bob room", store.saved)
+	}
+
+	// A recipient who is not connected still gets the message stored
+	delivery, err = o.Publish(&Message{ClientID: "alice", RecipientID: "carol", Content: "later"})
+	if err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if want := (Delivery{Stored: true}); delivery != want {
+		t.Errorf("offline recipient: delivery %+v, want %+v", delivery, want)
+	}
+}
+
+func TestPublishRejectsBadTargets(t *testing.T) {
+	o := newTestHub(t, nil)
+	o.StartGroup(NewGroupHub(o, "acme", "general"))
+
+	for _, tt := range []struct {
+		name    string
+		message Message
+		want    error
+	}{
+		{"no target", Message{Content: "hi"}, ErrNoTarget},
+		{"DM without sender", Message{RecipientID: "bob", Content: "hi"}, ErrNoTarget},
+		{"unknown group", Message{OrgID: "acme", GroupID: "nope", Content: "hi"}, ErrTargetNotFound},
+		{"unknown org", Message{OrgID: "globex", Content: "hi"}, ErrTargetNotFound},
+		{"announcement to a group", Message{OrgID: "acme", GroupID: "general", Kind: models.KindAnnouncement, Content: "hi"}, ErrInvalidKind},
+		{"chat to an org", Message{OrgID: "acme", Kind: models.KindChat, Content: "hi"}, ErrInvalidKind},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			message := tt.message
+			if _, err := o.Publish(&message); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
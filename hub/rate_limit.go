@@ -0,0 +1,105 @@
+package hub
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"go-realtime-workspace/clock"
+	"go-realtime-workspace/metrics"
+	"go-realtime-workspace/models"
+)
+
+// groupRateLimited counts group messages rejected by the throughput cap.
+var groupRateLimited = metrics.NewCounter("hub_group_rate_limited_total")
+
+// tokenBucket is a token-bucket rate limiter. A rate of zero disables it.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // Tokens added per second
+	burst  float64 // Maximum tokens held
+	tokens float64
+	last   time.Time
+	clock  clock.Clock
+}
+
+// newTokenBucket creates a full bucket that refills according to clk.
+func newTokenBucket(rate float64, burst int, clk clock.Clock) *tokenBucket {
+	b := &tokenBucket{clock: clk}
+	b.set(rate, burst)
+	return b
+}
+
+// set changes the rate and burst and refills the bucket.
+func (b *tokenBucket) set(rate float64, burst int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if burst < 1 {
+		burst = 1
+	}
+	b.rate = rate
+	b.burst = float64(burst)
+	b.tokens = b.burst
+	b.last = b.clock.Now()
+}
+
+// limits returns the configured rate and burst.
+func (b *tokenBucket) limits() (float64, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.rate, int(b.burst)
+}
+
+// allow takes a token if one is available.
+func (b *tokenBucket) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.rate <= 0 {
+		return true
+	}
+
+	now := b.clock.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// RateLimitStore holds the throughput cap overrides of groups (see
+// repository.MessageRepository.GroupRateLimit).
+type RateLimitStore interface {
+	GroupRateLimit(ctx context.Context, orgID, groupID string) (models.GroupRateLimit, bool, error)
+}
+
+// SetRateLimitStore sets where group throughput cap overrides are stored.
+// Groups started afterwards apply their stored override; without a store
+// every group starts with the configured cap.
+func (o *OrgHub) SetRateLimitStore(store RateLimitStore) {
+	o.rateLimits = store
+}
+
+// loadRateLimit applies the stored throughput cap override of a group about
+// to start, if any. A failed lookup is logged and leaves the configured cap.
+func (o *OrgHub) loadRateLimit(group *GroupHub) {
+	if o.rateLimits == nil {
+		return
+	}
+	limit, ok, err := o.rateLimits.GroupRateLimit(context.Background(), group.OrgID, group.GroupID)
+	if err != nil {
+		log.Printf("Error loading rate limit of group %s in org %s: %v", group.GroupID, group.OrgID, err)
+		return
+	}
+	if ok {
+		group.SetRateLimit(limit.MessagesPerSecond, limit.Burst)
+	}
+}
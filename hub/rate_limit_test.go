@@ -0,0 +1,80 @@
+package hub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go-realtime-workspace/clock"
+	"go-realtime-workspace/config"
+	"go-realtime-workspace/models"
+)
+
+// storedLimits is a RateLimitStore holding overrides keyed by group ID.
+type storedLimits map[string]models.GroupRateLimit
+
+func (s storedLimits) GroupRateLimit(ctx context.Context, orgID, groupID string) (models.GroupRateLimit, bool, error) {
+	limit, ok := s[groupID]
+	return limit, ok, nil
+}
+
+func TestGroupCapStartsRejecting(t *testing.T) {
+	o := newTestHub(t, func(cfg *config.WebSocketConfig) {
+		cfg.GroupMessagesPerSecond = 2
+		cfg.GroupMessageBurst = 3
+	})
+	fake := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	o.SetClock(fake)
+	group := NewGroupHub(o, "acme", "general")
+
+	for i := 0; i < 3; i++ {
+		if !group.Allow() {
+			t.Fatalf("message %d of the burst rejected", i+1)
+		}
+	}
+	before := groupRateLimited.Value()
+	if group.Allow() {
+		t.Fatal("message past the burst admitted")
+	}
+	if got := groupRateLimited.Value() - before; got != 1 {
+		t.Errorf("rate limited counter rose by %d, want 1", got)
+	}
+
+	// Half a second at two per second refills one token
+	fake.Advance(500 * time.Millisecond)
+	if !group.Allow() {
+		t.Fatal("message after refill rejected")
+	}
+	if group.Allow() {
+		t.Fatal("second message after refill admitted")
+	}
+}
+
+func TestGroupCapOverride(t *testing.T) {
+	o := newTestHub(t, func(cfg *config.WebSocketConfig) {
+		cfg.GroupMessagesPerSecond = 50
+		cfg.GroupMessageBurst = 100
+	})
+	o.SetClock(clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)))
+	o.SetRateLimitStore(storedLimits{"busy": {MessagesPerSecond: 1, Burst: 1}})
+
+	busy := NewGroupHub(o, "acme", "busy")
+	o.StartGroup(busy)
+	quiet := NewGroupHub(o, "acme", "quiet")
+	o.StartGroup(quiet)
+
+	if rate, burst := busy.RateLimit(); rate != 1 || burst != 1 {
+		t.Errorf("override is %v/s burst %d, want 1/s burst 1", rate, burst)
+	}
+	if rate, burst := quiet.RateLimit(); rate != 50 || burst != 100 {
+		t.Errorf("default is %v/s burst %d, want 50/s burst 100", rate, burst)
+	}
+	busy.Allow()
+	if busy.Allow() {
+		t.Error("overridden group admitted a message past its cap")
+	}
+	// The cap is per group: the other group is unaffected
+	if !quiet.Allow() {
+		t.Error("group without override rejected")
+	}
+}
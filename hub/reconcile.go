@@ -0,0 +1,137 @@
+package hub
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go-realtime-workspace/metrics"
+
+	"github.com/gorilla/websocket"
+)
+
+// Reconciliation metrics.
+var (
+	reconcileRuns   = metrics.NewCounter("hub_reconcile_runs_total")
+	orphanedGroups  = metrics.NewCounter("hub_orphaned_groups_total")
+	restartedGroups = metrics.NewCounter("hub_restarted_groups_total")
+	groupCrashes    = metrics.NewCounter("hub_group_crashes_total")
+)
+
+// StartGroup adds a group to its organization and starts its Run goroutine.
+// The group is registered and marked running under a single lock, so the
+// reconciler never observes one without the other. The group's stored
+// throughput cap override, if any, is applied first.
+func (o *OrgHub) StartGroup(group *GroupHub) {
+	o.loadRateLimit(group)
+
+	o.mu.Lock()
+	o.addGroupLocked(group)
+	o.running[group] = struct{}{}
+	o.mu.Unlock()
+
+	go o.runGroup(group)
+	fmt.Printf("Group %s registered under organization: %s\n", group.GroupID, group.OrgID)
+	o.observers.groupCreated(group.OrgID, group.GroupID)
+}
+
+// runGroup runs a group hub and removes it from the running registry when
+// Run returns. A panic in Run is logged and left for the reconciler to repair.
+func (o *OrgHub) runGroup(group *GroupHub) {
+	defer func() {
+		if r := recover(); r != nil {
+			groupCrashes.Inc()
+			fmt.Printf("Group %s in org %s crashed: %v\n", group.GroupID, group.OrgID, r)
+		}
+		o.mu.Lock()
+		delete(o.running, group)
+		o.mu.Unlock()
+	}()
+	group.Run()
+}
+
+// RunReconciler periodically reconciles the group registry against the
+// running group hubs until ctx is cancelled.
+func (o *OrgHub) RunReconciler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			orphaned, restarted := o.Reconcile()
+			if orphaned > 0 || restarted > 0 {
+				fmt.Printf("Reconciler stopped %d orphaned groups and restarted %d groups\n", orphaned, restarted)
+			}
+		}
+	}
+}
+
+// Reconcile compares the organization group registry with the running group
+// hubs. Hubs that are running but no longer registered are orphans and are
+// stopped; registered groups whose hub is not running are replaced with a
+// fresh hub, and their old clients are disconnected so they reconnect to it.
+func (o *OrgHub) Reconcile() (orphaned, restarted int) {
+	reconcileRuns.Inc()
+
+	var orphans, dead []*GroupHub
+
+	o.mu.Lock()
+	if o.closing {
+		o.mu.Unlock()
+		return 0, 0
+	}
+
+	for group := range o.running {
+		if registered, exists := o.lookupGroupLocked(group.OrgID, group.GroupID); !exists || registered != group {
+			delete(o.running, group)
+			orphans = append(orphans, group)
+		}
+	}
+
+	for _, org := range o.Organizations {
+		for id, group := range org.Groups {
+			if _, running := o.running[group]; running {
+				continue
+			}
+			replacement := NewGroupHub(o, group.OrgID, group.GroupID)
+			replacement.Name = group.Name
+			replacement.limiter = group.limiter // Keep any per-group override
+			org.Groups[id] = replacement
+			o.running[replacement] = struct{}{}
+			go o.runGroup(replacement)
+			dead = append(dead, group)
+		}
+	}
+	o.mu.Unlock()
+
+	for _, group := range orphans {
+		fmt.Printf("Stopping orphaned group %s in org %s\n", group.GroupID, group.OrgID)
+		group.Stop()
+	}
+
+	for _, group := range dead {
+		fmt.Printf("Restarted group %s in org %s\n", group.GroupID, group.OrgID)
+		group.mu.RLock()
+		for _, client := range group.Clients {
+			go client.CloseWithCode(websocket.CloseServiceRestart, "group restarted")
+		}
+		group.mu.RUnlock()
+	}
+
+	orphanedGroups.Add(int64(len(orphans)))
+	restartedGroups.Add(int64(len(dead)))
+	return len(orphans), len(dead)
+}
+
+// lookupGroupLocked returns the registered group hub. Callers must hold o.mu.
+func (o *OrgHub) lookupGroupLocked(orgID, groupID string) (*GroupHub, bool) {
+	org, exists := o.Organizations[orgID]
+	if !exists {
+		return nil, false
+	}
+	group, exists := org.Groups[groupID]
+	return group, exists
+}
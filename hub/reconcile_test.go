@@ -0,0 +1,72 @@
+package hub
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReconcileStopsOrphanedGroups(t *testing.T) {
+	o := newTestHub(t, nil)
+	group := NewGroupHub(o, "acme", "general")
+	o.StartGroup(group)
+
+	// The group is dropped from the registry but its goroutine keeps running
+	o.mu.Lock()
+	delete(o.Organizations["acme"].Groups, "general")
+	o.mu.Unlock()
+
+	before := orphanedGroups.Value()
+	if orphaned, restarted := o.Reconcile(); orphaned != 1 || restarted != 0 {
+		t.Fatalf("got %d orphaned and %d restarted, want 1 and 0", orphaned, restarted)
+	}
+	select {
+	case <-group.stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("orphaned group is still running")
+	}
+	if got := orphanedGroups.Value() - before; got != 1 {
+		t.Errorf("orphan metric grew by %d, want 1", got)
+	}
+
+	// Nothing is left to repair
+	if orphaned, restarted := o.Reconcile(); orphaned != 0 || restarted != 0 {
+		t.Errorf("second pass: got %d orphaned and %d restarted, want none", orphaned, restarted)
+	}
+}
+
+func TestReconcileRestartsStoppedGroups(t *testing.T) {
+	o := newTestHub(t, nil)
+	group := NewGroupHub(o, "acme", "general")
+	o.StartGroup(group)
+	group.SetRateLimit(5, 10)
+
+	// The group's goroutine exits while it stays registered
+	<-group.Stop()
+	for {
+		o.mu.RLock()
+		_, running := o.running[group]
+		o.mu.RUnlock()
+		if !running {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if orphaned, restarted := o.Reconcile(); orphaned != 0 || restarted != 1 {
+		t.Fatalf("got %d orphaned and %d restarted, want 0 and 1", orphaned, restarted)
+	}
+	replacement, ok := o.GetGroup("acme", "general")
+	if !ok || replacement == group {
+		t.Fatal("group was not replaced")
+	}
+	if rate, burst := replacement.RateLimit(); rate != 5 || burst != 10 {
+		t.Errorf("replacement capped at %v/s with burst %d, want the override", rate, burst)
+	}
+
+	// The replacement hub serves clients
+	conn := dialGroup(t, o, replacement, "alice")
+	readFrame(t, conn, TypeConnectionInfo)
+	for !replacement.HasClient("alice") {
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,82 @@
+package hub
+
+import (
+	"context"
+	"log"
+	"sort"
+)
+
+// RoleLookup resolves the organization roles of users, for roster frames.
+type RoleLookup interface {
+	Roles(ctx context.Context, orgID string, userIDs []string) (map[string]string, error)
+}
+
+// RosterMember is one connected member listed in a roster frame.
+type RosterMember struct {
+	UserID string `json:"user_id"`
+	Role   string `json:"role,omitempty"`   // Organization role, when known
+	Status string `json:"status,omitempty"` // Presence status, while online in the org
+}
+
+// RosterFrame is the payload of a roster event.
+type RosterFrame struct {
+	Members []RosterMember `json:"members"`
+}
+
+// SetRoleLookup sets where roster frames get member roles. It must be
+// called before clients connect; without it rosters carry no roles.
+func (o *OrgHub) SetRoleLookup(roles RoleLookup) {
+	o.roles = roles
+}
+
+// Roster lists the clients connected to the group with their role and
+// presence status, ordered by user ID.
+func (g *GroupHub) Roster(ctx context.Context) RosterFrame {
+	g.mu.RLock()
+	userIDs := make([]string, 0, len(g.Clients))
+	for id := range g.Clients {
+		userIDs = append(userIDs, id)
+	}
+	g.mu.RUnlock()
+	sort.Strings(userIDs)
+
+	var roles map[string]string
+	if g.hub.roles != nil && len(userIDs) > 0 {
+		var err error
+		if roles, err = g.hub.roles.Roles(ctx, g.OrgID, userIDs); err != nil {
+			log.Printf("Error looking up roles for the roster of group %s in org %s: %v", g.GroupID, g.OrgID, err)
+		}
+	}
+	statuses := g.hub.OnlineStatuses(g.OrgID)
+
+	frame := RosterFrame{Members: make([]RosterMember, 0, len(userIDs))}
+	for _, id := range userIDs {
+		frame.Members = append(frame.Members, RosterMember{UserID: id, Role: roles[id], Status: statuses[id]})
+	}
+	return frame
+}
+
+// sendRoster answers a roster_request frame. Requests arriving within
+// RosterRequestInterval of the previous one are refused as rate limited.
+// It runs on the read pump.
+func (c *Client) sendRoster() {
+	now := c.hub.clock.Now()
+	if interval := c.hub.cfg.RosterRequestInterval; !c.lastRoster.IsZero() && now.Sub(c.lastRoster) < interval {
+		c.SendError(ErrCodeRateLimited, "Roster requested too often", map[string]interface{}{
+			"retry_after_ms": (interval - now.Sub(c.lastRoster)).Milliseconds(),
+		})
+		return
+	}
+	c.lastRoster = now
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.hub.cfg.WriteWait)
+	defer cancel()
+
+	c.deliver(&Message{
+		Type:      TypeRoster,
+		OrgID:     c.Group.OrgID,
+		GroupID:   c.Group.GroupID,
+		Timestamp: now,
+		Data:      c.Group.Roster(ctx),
+	})
+}
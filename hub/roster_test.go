@@ -0,0 +1,68 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+
+	"go-realtime-workspace/models"
+)
+
+// fixedRoles is a RoleLookup with the roles in its map, keyed by user ID.
+type fixedRoles map[string]string
+
+func (f fixedRoles) Roles(ctx context.Context, orgID string, userIDs []string) (map[string]string, error) {
+	return f, nil
+}
+
+func TestRosterRequestListsMembers(t *testing.T) {
+	o := newTestHub(t, nil)
+	o.SetRoleLookup(fixedRoles{"alice": models.RoleAdmin, "bob": models.RoleMember})
+	group := NewGroupHub(o, "acme", "general")
+	o.StartGroup(group)
+	other := NewGroupHub(o, "acme", "random")
+	o.StartGroup(other)
+
+	bob := dialGroup(t, o, group, "bob")
+	alice := dialGroup(t, o, group, "alice")
+	dialGroup(t, o, other, "carol") // Not in the group
+	for !group.HasClient("alice") || !group.HasClient("bob") || !other.HasClient("carol") {
+		time.Sleep(time.Millisecond)
+	}
+	o.SetStatus("acme", "bob", StatusBusy)
+
+	if err := alice.WriteJSON(map[string]string{"type": TypeRosterRequest}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	frame := readFrame(t, alice, TypeRoster)
+	data, err := json.Marshal(frame.Data)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var roster RosterFrame
+	if err := json.Unmarshal(data, &roster); err != nil {
+		t.Fatalf("decode roster: %v", err)
+	}
+	want := []RosterMember{
+		{UserID: "alice", Role: models.RoleAdmin, Status: StatusAvailable},
+		{UserID: "bob", Role: models.RoleMember, Status: StatusBusy},
+	}
+	if !slices.Equal(roster.Members, want) {
+		t.Errorf("roster %+v, want %+v", roster.Members, want)
+	}
+
+	// A second request right away is refused
+	if err := alice.WriteJSON(map[string]string{"type": TypeRosterRequest}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if got := readError(t, alice); got.Code != ErrCodeRateLimited {
+		t.Errorf("second request: error %q, want %q", got.Code, ErrCodeRateLimited)
+	}
+	// The limit is per client
+	if err := bob.WriteJSON(map[string]string{"type": TypeRosterRequest}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	readFrame(t, bob, TypeRoster)
+}
@@ -0,0 +1,29 @@
+package hub
+
+import "go-realtime-workspace/models"
+
+// NewSystemMessage returns a chat message from the system bot to a group,
+// of kind models.KindSystem, ready for Publish. To send it as a direct
+// message instead, set RecipientID and clear OrgID and GroupID.
+func NewSystemMessage(orgID, groupID, content string) *Message {
+	return &Message{
+		Kind:     models.KindSystem,
+		OrgID:    orgID,
+		GroupID:  groupID,
+		ClientID: models.SystemUserID,
+		Content:  content,
+		Bot:      true,
+	}
+}
+
+// AssignSystemAuthor attributes a message sent by server code without an
+// author to the system bot, and sets Bot on the bot's messages only. It
+// reports whether the bot is the author. Messages from clients must not be
+// passed here, since their ClientID is never empty.
+func (m *Message) AssignSystemAuthor() bool {
+	if m.ClientID == "" {
+		m.ClientID = models.SystemUserID
+	}
+	m.Bot = m.ClientID == models.SystemUserID
+	return m.Bot
+}
@@ -0,0 +1,59 @@
+package hub
+
+import (
+	"testing"
+	"time"
+
+	"go-realtime-workspace/models"
+)
+
+func TestTaskEventIsPostedByTheSystemBot(t *testing.T) {
+	o := newTestHub(t, nil)
+	store := &recordingStore{}
+	o.SetMessageStore(store)
+	group := NewGroupHub(o, "acme", "general")
+	o.StartGroup(group)
+	conn := dialGroup(t, o, group, "alice")
+	for !group.HasClient("alice") {
+		time.Sleep(time.Millisecond)
+	}
+	// The bot posts even where members cannot
+	group.SetFrozen(true)
+
+	if _, err := o.Publish(NewSystemMessage("acme", "general", "Task \"Ship it\" was completed")); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	got := readFrame(t, conn, "")
+	if got.ClientID != models.SystemUserID || !got.Bot || got.Kind != models.KindSystem {
+		t.Errorf("delivered %+v, want a system message from the bot", got)
+	}
+	if len(store.saved) != 1 || store.saved[0].ClientID != models.SystemUserID || !store.saved[0].Bot {
+		t.Errorf("stored %+v, want the bot's message", store.saved)
+	}
+}
+
+func TestAssignSystemAuthor(t *testing.T) {
+	tests := []struct {
+		name    string
+		message Message
+		wantBot bool
+		wantID  string
+	}{
+		{"no author", Message{Content: "reminder"}, true, models.SystemUserID},
+		{"the bot", Message{ClientID: models.SystemUserID}, true, models.SystemUserID},
+		{"a user claiming the flag", Message{ClientID: "mallory", Bot: true}, false, "mallory"},
+	}
+	for _, tt := range tests {
+		message := tt.message
+		if got := message.AssignSystemAuthor(); got != tt.wantBot || message.Bot != tt.wantBot || message.ClientID != tt.wantID {
+			t.Errorf("%s: got bot %v (flag %v) from %q, want bot %v from %q", tt.name, got, message.Bot, message.ClientID, tt.wantBot, tt.wantID)
+		}
+	}
+
+	// Clients cannot set the flag on what they send
+	message := Message{ClientID: "mallory", Content: "hi", Bot: true}
+	message.StripEvent()
+	if message.Bot {
+		t.Error("StripEvent kept the bot flag")
+	}
+}
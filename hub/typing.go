@@ -0,0 +1,54 @@
+package hub
+
+import (
+	"time"
+
+	"go-realtime-workspace/models"
+)
+
+// isTyping reports whether a message type is a typing indicator.
+func isTyping(msgType string) bool {
+	return msgType == TypeTyping || msgType == TypeStopTyping
+}
+
+// relayTyping broadcasts a typing or stop_typing frame from the client to the
+// other clients of its group. Only the routing fields and channel are kept;
+// indicators are never stored and do not count against the group's
+// throughput cap. Typing frames arriving within TypingInterval of the last
+// one relayed are dropped silently, since the next one repeats them;
+// stop_typing is always relayed and lets the next typing frame through. It
+// runs on the read pump and returns false once the group has stopped.
+func (c *Client) relayTyping(msg *Message) bool {
+	if msg.Channel != "" && !models.ValidChannel(msg.Channel) {
+		c.SendInvalid(ErrInvalidChannel)
+		return true
+	}
+	if err := c.Group.CheckPost(c.ID); err != nil {
+		c.SendError(ErrCodeGroupFrozen, err.Error(), nil)
+		return true
+	}
+
+	now := c.hub.clock.Now()
+	if msg.Type == TypeTyping {
+		if interval := c.hub.cfg.TypingInterval; !c.lastTyping.IsZero() && now.Sub(c.lastTyping) < interval {
+			return true
+		}
+		c.lastTyping = now
+	} else {
+		c.lastTyping = time.Time{}
+	}
+
+	select {
+	case c.Group.Broadcast <- &Message{
+		Type:      msg.Type,
+		OrgID:     c.Group.OrgID,
+		GroupID:   c.Group.GroupID,
+		ClientID:  c.ID,
+		Channel:   msg.Channel,
+		Timestamp: now,
+	}:
+		return true
+	case <-c.Group.stopped:
+		return false
+	}
+}
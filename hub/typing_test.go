@@ -0,0 +1,72 @@
+package hub
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"go-realtime-workspace/clock"
+)
+
+func TestTypingIsThrottled(t *testing.T) {
+	o := newTestHub(t, nil)
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(start)
+	o.SetClock(clk)
+	group := NewGroupHub(o, "acme", "general")
+	o.StartGroup(group)
+
+	alice := dialGroup(t, o, group, "alice")
+	bob := dialGroup(t, o, group, "bob")
+	for !group.HasClient("alice") || !group.HasClient("bob") {
+		time.Sleep(time.Millisecond)
+	}
+
+	// relay sends frames of the given types from alice and returns the
+	// indicators bob receives up to the next stop_typing
+	relay := func(types ...string) []string {
+		t.Helper()
+		for _, typ := range types {
+			if err := alice.WriteJSON(map[string]string{"type": typ}); err != nil {
+				t.Fatalf("write %s: %v", typ, err)
+			}
+		}
+		var got []string
+		bob.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for {
+			var message Message
+			if err := bob.ReadJSON(&message); err != nil {
+				t.Fatalf("read: %v", err)
+			}
+			if !isTyping(message.Type) {
+				continue
+			}
+			if !message.Timestamp.Equal(clk.Now()) {
+				t.Errorf("%s stamped %v, want the hub clock's %v", message.Type, message.Timestamp, clk.Now())
+			}
+			got = append(got, message.Type)
+			if message.Type == TypeStopTyping {
+				return got
+			}
+		}
+	}
+
+	// Repeats within TypingInterval are dropped, and stop_typing lets the
+	// next typing frame through
+	for i := 0; i < 2; i++ {
+		got := relay(TypeTyping, TypeTyping, TypeTyping, TypeStopTyping)
+		if want := []string{TypeTyping, TypeStopTyping}; !slices.Equal(got, want) {
+			t.Fatalf("round %d: bob got %v, want %v", i, got, want)
+		}
+	}
+
+	if err := alice.WriteJSON(map[string]string{"type": TypeTyping}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	readFrame(t, bob, TypeTyping)
+	clk.Advance(o.cfg.TypingInterval)
+	got := relay(TypeTyping, TypeStopTyping)
+	if want := []string{TypeTyping, TypeStopTyping}; !slices.Equal(got, want) {
+		t.Errorf("after the interval: bob got %v, want %v", got, want)
+	}
+}
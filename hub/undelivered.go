@@ -0,0 +1,70 @@
+package hub
+
+import (
+	"context"
+	"log"
+
+	"go-realtime-workspace/metrics"
+)
+
+// undeliveredStashed counts ack_required messages stashed for redelivery
+// after a failed write.
+var undeliveredStashed = metrics.NewCounter("hub_undelivered_stashed_total")
+
+// UndeliveredStore keeps group messages that could not be written to a
+// user, so they can be redelivered when the user rejoins the group.
+type UndeliveredStore interface {
+	StashUndelivered(ctx context.Context, orgID, groupID, userID string, messageIDs []string) error
+}
+
+// SetUndeliveredStore sets where ack_required messages are stashed when a
+// write to their recipient fails. It must be called before clients
+// connect; without it such messages are lost with the connection.
+func (o *OrgHub) SetUndeliveredStore(store UndeliveredStore) {
+	o.undelivered = store
+}
+
+// important reports whether a message must not be lost with a failed
+// connection: a stored group message sent with ack_required.
+func important(message *Message) bool {
+	return message.Type == "" && message.AckRequired && message.ID != ""
+}
+
+// stashUndelivered saves the important messages the client will not be
+// written: failed, whose write failed (nil if the failure was a ping or lag
+// frame), and those still queued in the send buffer. It runs on the write
+// pump as it exits, before the connection is closed, so a client that
+// reconnects at once finds them stashed.
+func (c *Client) stashUndelivered(failed *Message) {
+	if c.hub.undelivered == nil || c.Group == nil {
+		return
+	}
+
+	var ids []string
+	if failed != nil && important(failed) {
+		ids = append(ids, failed.ID)
+	}
+	for queued := true; queued; {
+		select {
+		case message, ok := <-c.Send:
+			if !ok {
+				queued = false
+			} else if important(message) {
+				ids = append(ids, message.ID)
+			}
+		default:
+			queued = false
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.hub.cfg.WriteWait)
+	defer cancel()
+	if err := c.hub.undelivered.StashUndelivered(ctx, c.Group.OrgID, c.Group.GroupID, c.ID, ids); err != nil {
+		log.Printf("Error stashing %d undelivered messages for client %s: %v", len(ids), c.ID, err)
+		return
+	}
+	undeliveredStashed.Add(int64(len(ids)))
+}
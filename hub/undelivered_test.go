@@ -0,0 +1,48 @@
+package hub
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+// stashStore is an UndeliveredStore keeping what it was asked to stash.
+type stashStore struct {
+	stashed map[string][]string // Message IDs by "org/group/user"
+}
+
+func (s *stashStore) StashUndelivered(ctx context.Context, orgID, groupID, userID string, messageIDs []string) error {
+	if s.stashed == nil {
+		s.stashed = make(map[string][]string)
+	}
+	key := orgID + "/" + groupID + "/" + userID
+	s.stashed[key] = append(s.stashed[key], messageIDs...)
+	return nil
+}
+
+func TestFailedWriteStashesImportantMessages(t *testing.T) {
+	o := newTestHub(t, nil)
+	store := &stashStore{}
+	o.SetUndeliveredStore(store)
+	c, _ := acceptClient(t, o, "bob")
+	c.Group = NewGroupHub(o, "acme", "general")
+	<-c.Send // connection_info
+
+	for _, message := range []*Message{
+		{ID: "m1", ClientID: "alice", Content: "first", AckRequired: true}, // The write that fails
+		{ID: "m2", ClientID: "alice", Content: "plain"},
+		{Type: TypeTyping, ClientID: "alice", AckRequired: true},
+		{ID: "m3", ClientID: "alice", Content: "queued", AckRequired: true},
+	} {
+		c.Send <- message
+	}
+	c.Conn.Close()
+	c.WritePump() // Returns once the write fails
+
+	if got, want := store.stashed["acme/general/bob"], []string{"m1", "m3"}; !slices.Equal(got, want) {
+		t.Errorf("stashed %v, want %v", got, want)
+	}
+	if len(c.Send) != 0 {
+		t.Errorf("%d messages left in the send buffer", len(c.Send))
+	}
+}
@@ -0,0 +1,185 @@
+// Package idgen mints the IDs of stored messages. Besides random UUIDs it
+// offers ULIDs and Snowflake-style IDs, which embed their creation time so
+// that sorting IDs as strings orders them by creation.
+package idgen
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"go-realtime-workspace/clock"
+
+	"github.com/google/uuid"
+)
+
+// Scheme selects how IDs are generated.
+type Scheme string
+
+// Supported ID schemes.
+const (
+	SchemeUUID      Scheme = "uuid"      // Random UUIDv4, not time-ordered
+	SchemeULID      Scheme = "ulid"      // 26-character ULID, ordered by millisecond
+	SchemeSnowflake Scheme = "snowflake" // 19-digit Snowflake-style ID, ordered by millisecond
+)
+
+// Generator mints unique IDs. Implementations are safe for concurrent use.
+type Generator interface {
+	NewID() string
+}
+
+// New returns a generator for scheme. node identifies this process among
+// those minting Snowflake IDs (0-1023) and is ignored by other schemes.
+func New(scheme Scheme, node int64, c clock.Clock) (Generator, error) {
+	switch scheme {
+	case SchemeUUID:
+		return UUID{}, nil
+	case SchemeULID:
+		return NewULID(c), nil
+	case SchemeSnowflake:
+		g, err := NewSnowflake(node, c)
+		if err != nil {
+			return nil, err
+		}
+		return g, nil
+	default:
+		return nil, fmt.Errorf("unknown ID scheme %q", scheme)
+	}
+}
+
+// UUID mints random UUIDv4 IDs.
+type UUID struct{}
+
+// NewID returns a new random UUID.
+func (UUID) NewID() string {
+	return uuid.New().String()
+}
+
+// crockford is the Crockford base32 alphabet ULIDs are encoded in; it sorts
+// in the same order as the values it encodes.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULID mints ULIDs: a 48-bit millisecond timestamp followed by 80 random
+// bits. IDs minted within the same millisecond increment the random part,
+// so they still sort in the order they were minted.
+type ULID struct {
+	clock clock.Clock
+
+	mu      sync.Mutex
+	lastMs  uint64
+	entropy [10]byte
+}
+
+// NewULID returns a ULID generator reading the time from c.
+func NewULID(c clock.Clock) *ULID {
+	return &ULID{clock: c}
+}
+
+// NewID returns a new ULID.
+func (g *ULID) NewID() string {
+	ms := uint64(g.clock.Now().UnixMilli())
+
+	g.mu.Lock()
+	if ms > g.lastMs || !increment(g.entropy[:]) {
+		// A new millisecond, or the random part overflowed: start afresh
+		if ms <= g.lastMs {
+			ms = g.lastMs + 1
+		}
+		if _, err := rand.Read(g.entropy[:]); err != nil {
+			panic(fmt.Sprintf("idgen: reading random bytes: %v", err))
+		}
+		g.lastMs = ms
+	} else {
+		ms = g.lastMs // Same millisecond, or the clock stepped back: keep minting after the last ID
+	}
+	var id [16]byte
+	binary.BigEndian.PutUint16(id[0:], uint16(ms>>32))
+	binary.BigEndian.PutUint32(id[2:], uint32(ms))
+	copy(id[6:], g.entropy[:])
+	g.mu.Unlock()
+
+	return encodeULID(id)
+}
+
+// increment adds one to the big-endian number in b, reporting false if it
+// overflowed.
+func increment(b []byte) bool {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeULID encodes the 128 bits of id as 26 Crockford base32 characters,
+// the first holding the top 3 bits.
+func encodeULID(id [16]byte) string {
+	hi := binary.BigEndian.Uint64(id[0:])
+	lo := binary.BigEndian.Uint64(id[8:])
+
+	var out [26]byte
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
+
+// Snowflake ID layout: 41 bits of milliseconds since snowflakeEpoch, then
+// 10 bits of node and 12 bits of sequence within the millisecond.
+const (
+	snowflakeNodeBits = 10
+	snowflakeSeqBits  = 12
+	MaxSnowflakeNode  = 1<<snowflakeNodeBits - 1
+	snowflakeMaxSeq   = 1<<snowflakeSeqBits - 1
+)
+
+// snowflakeEpoch is the zero time of Snowflake timestamps; 41 bits of
+// milliseconds last until 2093.
+var snowflakeEpoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Snowflake mints Snowflake-style IDs, formatted as 19 zero-padded decimal
+// digits so they sort as strings. Processes minting IDs for the same data
+// must use different nodes.
+type Snowflake struct {
+	clock clock.Clock
+	node  int64
+
+	mu     sync.Mutex
+	lastMs int64
+	seq    int64
+}
+
+// NewSnowflake returns a Snowflake generator for node, reading the time
+// from c.
+func NewSnowflake(node int64, c clock.Clock) (*Snowflake, error) {
+	if node < 0 || node > MaxSnowflakeNode {
+		return nil, fmt.Errorf("snowflake node must be between 0 and %d", MaxSnowflakeNode)
+	}
+	return &Snowflake{clock: c, node: node}, nil
+}
+
+// NewID returns a new Snowflake ID. When a millisecond's sequence runs out,
+// or the clock steps back, IDs are minted ahead of the clock so they stay
+// increasing.
+func (g *Snowflake) NewID() string {
+	ms := g.clock.Now().Sub(snowflakeEpoch).Milliseconds()
+
+	g.mu.Lock()
+	if ms > g.lastMs {
+		g.lastMs, g.seq = ms, 0
+	} else if g.seq < snowflakeMaxSeq {
+		g.seq++
+	} else {
+		g.lastMs, g.seq = g.lastMs+1, 0
+	}
+	id := g.lastMs<<(snowflakeNodeBits+snowflakeSeqBits) | g.node<<snowflakeSeqBits | g.seq
+	g.mu.Unlock()
+
+	return fmt.Sprintf("%019d", id)
+}
@@ -0,0 +1,98 @@
+package idgen
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go-realtime-workspace/clock"
+)
+
+// mint returns IDs from g, advancing fake between IDs by the given steps
+// (which may be zero or negative).
+func mint(g Generator, fake *clock.Fake, steps ...time.Duration) []string {
+	ids := []string{g.NewID()}
+	for _, step := range steps {
+		fake.Advance(step)
+		ids = append(ids, g.NewID())
+	}
+	return ids
+}
+
+func TestULIDsSortByCreationTime(t *testing.T) {
+	fake := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	g := NewULID(fake)
+
+	// Across milliseconds, within one, and after the clock steps back
+	ids := mint(g, fake, time.Millisecond, 0, 0, time.Second, -time.Minute, 0)
+	if !slices.IsSorted(ids) {
+		t.Errorf("IDs %v are not in minting order", ids)
+	}
+	if len(slices.Compact(slices.Clone(ids))) != len(ids) {
+		t.Errorf("IDs %v are not unique", ids)
+	}
+	for _, id := range ids {
+		if len(id) != 26 || strings.Trim(id, crockford) != "" {
+			t.Errorf("%q is not a 26-character ULID", id)
+		}
+	}
+
+	// The first 10 characters encode the millisecond
+	if got, want := ids[0][:10], "01JGFJJZ00"; got != want {
+		t.Errorf("timestamp part %q, want %q", got, want)
+	}
+}
+
+func TestSnowflakesSortByCreationTime(t *testing.T) {
+	fake := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	g, err := NewSnowflake(7, fake)
+	if err != nil {
+		t.Fatalf("NewSnowflake: %v", err)
+	}
+
+	ids := mint(g, fake, time.Millisecond, 0, 0, time.Second, -time.Minute, 0)
+	if !slices.IsSorted(ids) {
+		t.Errorf("IDs %v are not in minting order", ids)
+	}
+	for _, id := range ids {
+		n, err := strconv.ParseInt(id, 10, 64)
+		if len(id) != 19 || err != nil {
+			t.Fatalf("%q is not a 19-digit ID", id)
+		}
+		if node := n >> snowflakeSeqBits & MaxSnowflakeNode; node != 7 {
+			t.Errorf("%q carries node %d, want 7", id, node)
+		}
+	}
+
+	// Running out of sequence numbers moves on to the next millisecond
+	last := ids[len(ids)-1]
+	for i := 0; i <= snowflakeMaxSeq+1; i++ {
+		id := g.NewID()
+		if id <= last {
+			t.Fatalf("ID %s after %s", id, last)
+		}
+		last = id
+	}
+}
+
+func TestNew(t *testing.T) {
+	c := clock.Real{}
+	for _, scheme := range []Scheme{SchemeUUID, SchemeULID, SchemeSnowflake} {
+		g, err := New(scheme, 1, c)
+		if err != nil {
+			t.Errorf("New(%s): %v", scheme, err)
+			continue
+		}
+		if a, b := g.NewID(), g.NewID(); a == b {
+			t.Errorf("%s minted %q twice", scheme, a)
+		}
+	}
+	if _, err := New("sequential", 0, c); err == nil {
+		t.Error("unknown scheme accepted")
+	}
+	if _, err := New(SchemeSnowflake, MaxSnowflakeNode+1, c); err == nil {
+		t.Error("out-of-range node accepted")
+	}
+}
@@ -0,0 +1,64 @@
+// Package jobs contains background maintenance tasks that run alongside the server.
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go-realtime-workspace/clock"
+	"go-realtime-workspace/hub"
+	"go-realtime-workspace/repository"
+)
+
+// ExpiryJanitor removes disappearing messages once their expiry has passed
+// and tells connected clients to drop them with a delete event.
+type ExpiryJanitor struct {
+	repo     *repository.MessageRepository
+	orgHub   *hub.OrgHub
+	interval time.Duration
+	clock    clock.Clock
+}
+
+// NewExpiryJanitor creates a janitor that sweeps every interval.
+func NewExpiryJanitor(repo *repository.MessageRepository, orgHub *hub.OrgHub, interval time.Duration) *ExpiryJanitor {
+	return &ExpiryJanitor{repo: repo, orgHub: orgHub, interval: interval, clock: clock.Real{}}
+}
+
+// SetClock replaces the clock that decides which messages have expired.
+func (j *ExpiryJanitor) SetClock(c clock.Clock) {
+	j.clock = c
+}
+
+// Run sweeps for expired messages until ctx is cancelled.
+func (j *ExpiryJanitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			j.sweep(ctx)
+		}
+	}
+}
+
+// sweep deletes expired messages and notifies the clients that can see them.
+func (j *ExpiryJanitor) sweep(ctx context.Context) {
+	deleted, err := j.repo.DeleteExpired(ctx, j.clock.Now())
+	if err != nil {
+		log.Printf("Error deleting expired messages: %v", err)
+	}
+
+	for _, msg := range deleted {
+		event := hub.NewDeleteEvent(msg.OrgID, msg.GroupID, msg.ID)
+		if msg.OrgID == repository.DMOrgID {
+			j.orgHub.SendDirectMessage(msg.ClientID, event)
+			j.orgHub.SendDirectMessage(msg.RecipientID, event)
+			continue
+		}
+		j.orgHub.BroadcastToGroup(msg.OrgID, msg.GroupID, event)
+	}
+}
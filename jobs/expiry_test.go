@@ -0,0 +1,105 @@
+package jobs
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-realtime-workspace/clock"
+	"go-realtime-workspace/config"
+	"go-realtime-workspace/hub"
+	"go-realtime-workspace/models"
+	"go-realtime-workspace/repository"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gorilla/websocket"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestMessageRepository returns a message repository with the default
+// configuration, adjusted by configure if it is not nil, backed by an
+// in-memory Redis server.
+func newTestMessageRepository(t *testing.T, configure func(*config.RedisConfig)) (*repository.MessageRepository, *miniredis.Miniredis) {
+	t.Helper()
+	srv := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: srv.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	cfg := config.DefaultConfig()
+	if configure != nil {
+		configure(&cfg.Redis)
+	}
+	return repository.NewMessageRepository(client, cfg.Redis, cfg.Message), srv
+}
+
+// joinGroup connects a WebSocket client with the given ID to group and
+// returns the client's end of the connection.
+func joinGroup(t *testing.T, o *hub.OrgHub, group *hub.GroupHub, id string) *websocket.Conn {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		group.AddClient(hub.NewClient(o, id, conn, group, false, hub.ProtocolVersion))
+	}))
+	t.Cleanup(srv.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	for !group.HasClient(id) {
+		time.Sleep(time.Millisecond)
+	}
+	return conn
+}
+
+func TestExpiryJanitorBroadcastsDeletes(t *testing.T) {
+	repo, _ := newTestMessageRepository(t, nil)
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(start)
+	repo.SetClock(clk)
+
+	cfg := config.DefaultConfig()
+	o := hub.NewOrgHub(cfg.WebSocket, cfg.Message)
+	group := hub.NewGroupHub(o, "acme", "general")
+	o.StartGroup(group)
+	conn := joinGroup(t, o, group, "alice")
+
+	expiresAt := start.Add(time.Second)
+	_, err := repo.Save(context.Background(), models.ChatMessage{
+		ID: "m1", OrgID: "acme", GroupID: "general", ClientID: "bob", Content: "psst",
+		Timestamp: start, ExpiresAt: &expiresAt,
+	})
+	if err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	janitor := NewExpiryJanitor(repo, o, time.Second)
+	janitor.SetClock(clk)
+	clk.Advance(time.Second)
+	janitor.sweep(context.Background())
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var frame hub.Message
+		if err := conn.ReadJSON(&frame); err != nil {
+			t.Fatalf("waiting for the delete event: %v", err)
+		}
+		if frame.Type == hub.TypeDelete {
+			if frame.ID != "m1" {
+				t.Errorf("delete event for %q, want m1", frame.ID)
+			}
+			break
+		}
+	}
+	if history, _ := repo.GetHistory(context.Background(), "acme", "general", 10); len(history) != 0 {
+		t.Errorf("history still holds %+v", history)
+	}
+}
@@ -0,0 +1,69 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go-realtime-workspace/repository"
+)
+
+// spilloverFlushTimeout bounds the last replay attempted at shutdown.
+const spilloverFlushTimeout = 5 * time.Second
+
+// SpilloverReplayer stores messages that were accepted while Redis was
+// unreachable once it is back.
+type SpilloverReplayer struct {
+	repo     *repository.MessageRepository
+	interval time.Duration
+	done     chan struct{}
+}
+
+// NewSpilloverReplayer creates a replayer that retries every interval.
+func NewSpilloverReplayer(repo *repository.MessageRepository, interval time.Duration) *SpilloverReplayer {
+	return &SpilloverReplayer{repo: repo, interval: interval, done: make(chan struct{})}
+}
+
+// Run replays held messages until ctx is cancelled, then makes a last
+// attempt so as few as possible are lost with the process.
+func (j *SpilloverReplayer) Run(ctx context.Context) {
+	defer close(j.done)
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), spilloverFlushTimeout)
+			j.replay(flushCtx)
+			cancel()
+			if held := j.repo.SpilloverLen(); held > 0 {
+				log.Printf("Shutting down with %d messages not stored in Redis", held)
+			}
+			return
+		case <-ticker.C:
+			j.replay(ctx)
+		}
+	}
+}
+
+// Done is closed when Run has returned, after its last replay attempt.
+func (j *SpilloverReplayer) Done() <-chan struct{} {
+	return j.done
+}
+
+// replay stores as many held messages as Redis accepts.
+func (j *SpilloverReplayer) replay(ctx context.Context) {
+	if j.repo.SpilloverLen() == 0 {
+		return
+	}
+
+	replayed, err := j.repo.ReplaySpillover(ctx)
+	if replayed > 0 {
+		log.Printf("Stored %d messages held during a Redis outage", replayed)
+	}
+	if err != nil {
+		log.Printf("Redis still unavailable, %d messages held: %v", j.repo.SpilloverLen(), err)
+	}
+}
@@ -0,0 +1,54 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go-realtime-workspace/config"
+	"go-realtime-workspace/models"
+)
+
+func TestSpilloverReplayerStoresHeldMessages(t *testing.T) {
+	repo, srv := newTestMessageRepository(t, func(cfg *config.RedisConfig) {
+		cfg.SpilloverSize = 10
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv.Close()
+	for _, id := range []string{"m1", "m2"} {
+		if _, err := repo.Save(ctx, models.ChatMessage{ID: id, OrgID: "acme", GroupID: "general", ClientID: "alice", Content: "hi"}); err != nil {
+			t.Fatalf("Save during the outage: %v", err)
+		}
+	}
+	replayer := NewSpilloverReplayer(repo, 10*time.Millisecond)
+	go replayer.Run(ctx)
+	time.Sleep(50 * time.Millisecond) // A few attempts while Redis is down
+	if held := repo.SpilloverLen(); held != 2 {
+		t.Fatalf("%d messages held during the outage, want 2", held)
+	}
+
+	if err := srv.Restart(); err != nil {
+		t.Fatalf("Restart: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for repo.SpilloverLen() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("held messages were never stored")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	for _, id := range []string{"m1", "m2"} {
+		if _, err := repo.GetByID(ctx, "acme", "general", id); err != nil {
+			t.Errorf("GetByID(%s): %v", id, err)
+		}
+	}
+
+	cancel()
+	select {
+	case <-replayer.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("replayer did not stop")
+	}
+}
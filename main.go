@@ -2,58 +2,249 @@ package main
 
 import (
 	"context"
-	"log"
+	"errors"
+	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"go-realtime-workspace/auth"
+	"go-realtime-workspace/clock"
 	"go-realtime-workspace/config"
 	"go-realtime-workspace/database"
 	"go-realtime-workspace/hub"
+	"go-realtime-workspace/idgen"
+	"go-realtime-workspace/jobs"
+	"go-realtime-workspace/middleware"
 	"go-realtime-workspace/repository"
 	"go-realtime-workspace/router"
+
+	"github.com/rs/zerolog"
+)
+
+// Process exit codes, so container restarts can be diagnosed from the status alone.
+const (
+	exitOK       = 0 // Clean shutdown
+	exitFailure  = 1 // Unexpected runtime failure (e.g. listener or shutdown error)
+	exitPostgres = 2 // Could not connect to PostgreSQL
+	exitRedis    = 3 // Could not connect to Redis, or its self-test failed
+	exitConfig   = 4 // Invalid configuration
 )
 
+// selfTestTimeout bounds the startup Redis self-test.
+const selfTestTimeout = 10 * time.Second
+
+// exitError pairs a startup or runtime failure with the exit code to report.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+// withExitCode wraps err so run reports it with the given exit code.
+func withExitCode(code int, err error) error {
+	return &exitError{code: code, err: err}
+}
+
 func main() {
+	logger := zerolog.New(os.Stderr).With().Timestamp().Logger()
+
+	err := run(logger, defaultDeps())
+
+	code := exitCode(err)
+	if err != nil {
+		logger.Error().Err(err).Int("exit_code", code).Msg("Server exited with error")
+	} else {
+		logger.Info().Int("exit_code", code).Msg("Server exited gracefully")
+	}
+
+	os.Exit(code)
+}
+
+// exitCode returns the exit code to report for run's result.
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	var exitErr *exitError
+	if errors.As(err, &exitErr) {
+		return exitErr.code
+	}
+	return exitFailure
+}
+
+// deps supplies what run builds the server from, so tests can substitute
+// failing connectors.
+type deps struct {
+	config          func() *config.Config
+	connectPostgres func(config.PostgreSQLConfig) (*database.PostgresDB, error)
+	connectRedis    func(config.RedisConfig) (*database.RedisClient, error)
+}
+
+// defaultDeps returns the production configuration and connectors.
+func defaultDeps() deps {
+	return deps{
+		config:          config.DefaultConfig,
+		connectPostgres: database.NewPostgresDB,
+		connectRedis:    database.NewRedisClient,
+	}
+}
+
+// run starts the server and blocks until it shuts down. Returning instead of
+// exiting lets deferred Close calls run before main reports the exit code.
+func run(logger zerolog.Logger, d deps) error {
 	// Load configuration
-	cfg := config.DefaultConfig()
+	cfg := d.config()
+	if err := cfg.Validate(); err != nil {
+		return withExitCode(exitConfig, fmt.Errorf("invalid configuration: %w", err))
+	}
 
 	// Initialize PostgreSQL
-	pgDB, err := database.NewPostgresDB(cfg.PostgreSQL)
+	pgDB, err := d.connectPostgres(cfg.PostgreSQL)
 	if err != nil {
-		log.Fatalf("Failed to connect to PostgreSQL: %v", err)
+		return withExitCode(exitPostgres, fmt.Errorf("failed to connect to PostgreSQL: %w", err))
 	}
 	defer pgDB.Close()
-	log.Println("Connected to PostgreSQL")
+	logger.Info().Str("host", cfg.PostgreSQL.Host).Msg("Connected to PostgreSQL")
 
 	// Initialize Redis
-	redisClient, err := database.NewRedisClient(cfg.Redis)
+	redisClient, err := d.connectRedis(cfg.Redis)
 	if err != nil {
-		log.Fatalf("Failed to connect to Redis: %v", err)
+		return withExitCode(exitRedis, fmt.Errorf("failed to connect to Redis: %w", err))
 	}
 	defer redisClient.Close()
-	log.Println("Connected to Redis")
+	logger.Info().Str("mode", cfg.Redis.Mode).Str("host", cfg.Redis.Host).Msg("Connected to Redis")
 
 	// Initialize repositories
-	userRepo := repository.NewUserRepository(pgDB.DB)
+	userRepo := repository.NewUserRepository(pgDB.DB, cfg.User)
 	taskRepo := repository.NewTaskRepository(pgDB.DB)
-	messageRepo := repository.NewMessageRepository(redisClient.Client, cfg.Redis)
+	inviteRepo := repository.NewInviteRepository(pgDB.DB, cfg.User)
+	messageRepo := repository.NewMessageRepository(redisClient.UniversalClient, cfg.Redis, cfg.Message)
+	if cfg.Message.WindowsExemptAdmins {
+		messageRepo.SetRoleLookup(userRepo)
+	}
+	messageRepo.SetMentionResolver(userRepo)
+	ids, err := idgen.New(idgen.Scheme(cfg.Message.IDScheme), cfg.Message.IDNode, clock.Real{})
+	if err != nil {
+		return withExitCode(exitConfig, fmt.Errorf("invalid configuration: %w", err))
+	}
+	messageRepo.SetIDGenerator(ids)
+	featureRepo := repository.NewFeatureRepository(pgDB.DB, redisClient.UniversalClient, cfg.Redis.FeatureCacheTTL)
+	featureRepo.SetLocalTTL(cfg.Redis.FeatureLocalTTL)
+	activityRepo := repository.NewActivityRepository(pgDB.DB, redisClient.UniversalClient)
+	auditRepo := repository.NewAuditRepository(pgDB.DB)
+	notifyRepo := repository.NewNotificationRepository(pgDB.DB)
+	messageRepo.SetNotificationFilter(notifyRepo)
+	templateRepo := repository.NewTemplateRepository(pgDB.DB)
+	presenceRepo := repository.NewPresenceRepository(redisClient.UniversalClient, cfg.WebSocket.HeartbeatGrace)
+
+	// Check that history can actually be written and read back
+	if cfg.Redis.SelfTest != "off" {
+		selfTestCtx, cancelSelfTest := context.WithTimeout(context.Background(), selfTestTimeout)
+		err := messageRepo.SelfTest(selfTestCtx)
+		cancelSelfTest()
+		switch {
+		case err == nil:
+			logger.Info().Msg("Redis self-test passed")
+		case cfg.Redis.SelfTest == "fail":
+			return withExitCode(exitRedis, fmt.Errorf("redis self-test failed: %w", err))
+		default:
+			logger.Warn().Err(err).Msg("REDIS SELF-TEST FAILED: message history may not be stored or read correctly")
+		}
+	}
 
 	// Create the main organization hub
-	orgHub := hub.NewOrgHub()
+	orgHub := hub.NewOrgHub(cfg.WebSocket, cfg.Message)
+	orgHub.SetFeatureChecker(featureRepo)
+	orgHub.SetRoleLookup(userRepo)
+	orgHub.SetAckStore(messageRepo)
+	orgHub.SetMessageStore(messageRepo)
+	orgHub.SetPinStore(messageRepo)
+	orgHub.SetUndeliveredStore(messageRepo)
+	orgHub.SetNotificationFilter(notifyRepo)
+	orgHub.SetRateLimitStore(messageRepo)
+
+	// With an auth secret, users present access tokens to the API and to
+	// the WebSocket endpoints, which take the client ID from the token
+	var tokens *auth.Signer
+	if cfg.Server.AuthSecret != "" {
+		tokens = auth.NewSigner(cfg.Server.AuthSecret)
+		orgHub.SetTokenVerifier(tokens)
+	}
 	go orgHub.Run()
 
+	// Provision the default organization for single-tenant deployments
+	if org := provisionDefaultOrg(orgHub, cfg.Server); org != nil {
+		logger.Info().Str("org_id", org.ID).Msg("Default organization ready")
+	}
+
+	// Bring history written with second-precision scores in line before
+	// the expiry janitor reads the schedule
+	if cfg.Redis.MigrateScores {
+		migrated, err := messageRepo.MigrateScores(context.Background())
+		if err != nil {
+			return withExitCode(exitRedis, fmt.Errorf("failed to migrate message scores: %w", err))
+		}
+		if migrated > 0 {
+			logger.Info().Int64("entries", migrated).Msg("Migrated message scores to microseconds")
+		}
+	}
+
+	// Start background jobs
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	if cfg.WebSocket.ReconcileInterval > 0 {
+		go orgHub.RunReconciler(jobsCtx, cfg.WebSocket.ReconcileInterval)
+	}
+	if cfg.Redis.ExpirySweepInterval > 0 {
+		go jobs.NewExpiryJanitor(messageRepo, orgHub, cfg.Redis.ExpirySweepInterval).Run(jobsCtx)
+	}
+	var spillover *jobs.SpilloverReplayer
+	if cfg.Redis.SpilloverSize > 0 {
+		spillover = jobs.NewSpilloverReplayer(messageRepo, cfg.Redis.SpilloverRetryInterval)
+		go spillover.Run(jobsCtx)
+	}
+
 	// Set up the router with all routes and middleware
 	routerCfg := &router.Config{
-		OrgHub:      orgHub,
-		UserRepo:    userRepo,
-		TaskRepo:    taskRepo,
-		MessageRepo: messageRepo,
-		PgHealth:    pgDB,
-		RedisHealth: redisClient,
+		AppConfig:    cfg,
+		OrgHub:       orgHub,
+		UserRepo:     userRepo,
+		TaskRepo:     taskRepo,
+		InviteRepo:   inviteRepo,
+		FeatureRepo:  featureRepo,
+		ActivityRepo: activityRepo,
+		AuditRepo:    auditRepo,
+		NotifyRepo:   notifyRepo,
+		TemplateRepo: templateRepo,
+		PresenceRepo: presenceRepo,
+		MessageRepo:  messageRepo,
+		PgHealth:     pgDB,
+		RedisHealth:  redisClient,
+		Tokens:       tokens,
+	}
+	if cfg.Server.RateLimitPerMinute > 0 {
+		routerCfg.RateLimit = &middleware.RateLimitConfig{
+			RequestsPerMinute: cfg.Server.RateLimitPerMinute,
+			RedisClient:       redisClient.UniversalClient,
+			Logger:            logger,
+		}
+	}
+	security := middleware.DefaultSecurityConfig()
+	if cfg.Server.Environment == config.EnvironmentDevelopment {
+		security = middleware.DevelopmentSecurityConfig()
+	}
+	if len(cfg.Server.CSPScriptSrc) > 0 {
+		security.ScriptSrc = cfg.Server.CSPScriptSrc
+	}
+	if len(cfg.Server.CSPConnectSrc) > 0 {
+		security.ConnectSrc = cfg.Server.CSPConnectSrc
 	}
+	routerCfg.Security = &security
 	r := router.Setup(routerCfg)
 
 	// Configure the server
@@ -67,26 +258,60 @@ func main() {
 	}
 
 	// Start the server in a goroutine
+	serverErr := make(chan error, 1)
 	go func() {
-		log.Printf("Server is running on %s", address)
+		logger.Info().Str("address", address).Msg("Server is running")
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Failed to start server: %v", err)
+			serverErr <- err
 		}
 	}()
 
 	// Graceful shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
 
-	log.Println("Shutting down server...")
+	select {
+	case sig := <-quit:
+		logger.Info().Str("signal", sig.String()).Msg("Shutting down server")
+	case err := <-serverErr:
+		return withExitCode(exitFailure, fmt.Errorf("failed to start server: %w", err))
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer cancel()
 
 	if err := server.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+		return withExitCode(exitFailure, fmt.Errorf("server forced to shutdown: %w", err))
 	}
 
-	log.Println("Server exited gracefully")
+	stopJobs()
+
+	// Flush pending broadcasts to WebSocket clients before closing them
+	drainCtx, drainCancel := context.WithTimeout(ctx, cfg.Server.DrainTimeout)
+	defer drainCancel()
+
+	if err := orgHub.Shutdown(drainCtx); err != nil {
+		logger.Warn().Err(err).Msg("Hub drain did not complete")
+	}
+
+	// Store messages held during a Redis outage before the client closes
+	if spillover != nil {
+		<-spillover.Done()
+	}
+
+	return nil
+}
+
+// provisionDefaultOrg creates the default organization configured in cfg,
+// named after its ID unless DefaultOrgName is set, and returns it. It
+// returns nil when no default organization is configured.
+func provisionDefaultOrg(orgHub *hub.OrgHub, cfg config.ServerConfig) *hub.Org {
+	if cfg.DefaultOrgID == "" {
+		return nil
+	}
+	name := cfg.DefaultOrgName
+	if name == "" {
+		name = cfg.DefaultOrgID
+	}
+	return orgHub.CreateOrganization(cfg.DefaultOrgID, name)
 }
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"go-realtime-workspace/config"
+	"go-realtime-workspace/database"
+	"go-realtime-workspace/hub"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/rs/zerolog"
+)
+
+// testDeps returns deps whose connectors fail the test if called.
+func testDeps(t *testing.T) deps {
+	t.Helper()
+	return deps{
+		config: config.DefaultConfig,
+		connectPostgres: func(config.PostgreSQLConfig) (*database.PostgresDB, error) {
+			t.Fatal("unexpected PostgreSQL connection")
+			return nil, nil
+		},
+		connectRedis: func(config.RedisConfig) (*database.RedisClient, error) {
+			t.Fatal("unexpected Redis connection")
+			return nil, nil
+		},
+	}
+}
+
+// mockPostgres returns a connector that succeeds with a SQL mock.
+func mockPostgres(t *testing.T) func(config.PostgreSQLConfig) (*database.PostgresDB, error) {
+	t.Helper()
+	return func(config.PostgreSQLConfig) (*database.PostgresDB, error) {
+		db, _, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("sqlmock: %v", err)
+		}
+		return &database.PostgresDB{DB: db}, nil
+	}
+}
+
+func TestRunExitCodes(t *testing.T) {
+	errDown := errors.New("connection refused")
+	tests := []struct {
+		name     string
+		override func(t *testing.T, d *deps)
+		want     int
+	}{
+		{
+			name: "invalid configuration",
+			override: func(t *testing.T, d *deps) {
+				d.config = func() *config.Config {
+					cfg := config.DefaultConfig()
+					cfg.Server.Address = ""
+					return cfg
+				}
+			},
+			want: exitConfig,
+		},
+		{
+			name: "postgres unavailable",
+			override: func(t *testing.T, d *deps) {
+				d.connectPostgres = func(config.PostgreSQLConfig) (*database.PostgresDB, error) {
+					return nil, errDown
+				}
+			},
+			want: exitPostgres,
+		},
+		{
+			name: "redis unavailable",
+			override: func(t *testing.T, d *deps) {
+				d.connectPostgres = mockPostgres(t)
+				d.connectRedis = func(config.RedisConfig) (*database.RedisClient, error) {
+					return nil, errDown
+				}
+			},
+			want: exitRedis,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := testDeps(t)
+			tt.override(t, &d)
+
+			err := run(zerolog.Nop(), d)
+			if got := exitCode(err); got != tt.want {
+				t.Fatalf("exit code %d (%v), want %d", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	if got := exitCode(nil); got != exitOK {
+		t.Errorf("nil error: got %d, want %d", got, exitOK)
+	}
+	if got := exitCode(errors.New("boom")); got != exitFailure {
+		t.Errorf("plain error: got %d, want %d", got, exitFailure)
+	}
+}
+
+func TestProvisionDefaultOrg(t *testing.T) {
+	cfg := config.DefaultConfig()
+	tests := []struct {
+		name     string
+		server   config.ServerConfig
+		wantName string
+	}{
+		{"named", config.ServerConfig{DefaultOrgID: "acme", DefaultOrgName: "Acme Inc"}, "Acme Inc"},
+		{"named after its ID", config.ServerConfig{DefaultOrgID: "acme"}, "acme"},
+		{"unset", config.ServerConfig{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orgHub := hub.NewOrgHub(cfg.WebSocket, cfg.Message)
+			org := provisionDefaultOrg(orgHub, tt.server)
+			if tt.wantName == "" {
+				if org != nil || len(orgHub.GetOrganizations()) != 0 {
+					t.Fatal("an organization was provisioned without a default org")
+				}
+				return
+			}
+			registered, ok := orgHub.GetOrganization("acme")
+			if !ok || registered != org {
+				t.Fatal("default organization not registered in the hub")
+			}
+			if org.Name != tt.wantName {
+				t.Errorf("name %q, want %q", org.Name, tt.wantName)
+			}
+		})
+	}
+}
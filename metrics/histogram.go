@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// Histogram counts observed durations in buckets with fixed upper bounds.
+// It is safe for concurrent use.
+type Histogram struct {
+	name   string
+	label  string          // Label pair such as path="group", or empty
+	bounds []time.Duration // Upper bounds, ascending
+	counts []atomic.Int64  // Per bucket, plus a last one for larger values
+	count  atomic.Int64
+	sum    atomic.Int64 // Microseconds
+}
+
+var histograms = make(map[string]*Histogram)
+
+// NewHistogram registers and returns a histogram with the given name,
+// label and bucket upper bounds. Registering the same name and label twice
+// returns the existing histogram, whatever the bounds.
+//
+// In Snapshot a histogram appears as cumulative counters in the Prometheus
+// style, with bounds in microseconds:
+//
+//	name_bucket{label,le="1000"}, ..., name_bucket{label,le="+Inf"},
+//	name_count{label} and name_sum{label}
+func NewHistogram(name, label string, bounds []time.Duration) *Histogram {
+	mu.Lock()
+	defer mu.Unlock()
+
+	key := name + "{" + label + "}"
+	if h, exists := histograms[key]; exists {
+		return h
+	}
+	sorted := append([]time.Duration(nil), bounds...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	h := &Histogram{
+		name:   name,
+		label:  label,
+		bounds: sorted,
+		counts: make([]atomic.Int64, len(sorted)+1),
+	}
+	histograms[key] = h
+	return h
+}
+
+// Observe records a duration.
+func (h *Histogram) Observe(d time.Duration) {
+	i := sort.Search(len(h.bounds), func(i int) bool { return d <= h.bounds[i] })
+	h.counts[i].Add(1)
+	h.count.Add(1)
+	h.sum.Add(d.Microseconds())
+}
+
+// Count returns the number of observations.
+func (h *Histogram) Count() int64 {
+	return h.count.Load()
+}
+
+// snapshot adds the histogram's counters to values.
+func (h *Histogram) snapshot(values map[string]int64) {
+	labels := func(extra string) string {
+		switch {
+		case h.label == "":
+			return "{" + extra + "}"
+		case extra == "":
+			return "{" + h.label + "}"
+		default:
+			return "{" + h.label + "," + extra + "}"
+		}
+	}
+
+	var cumulative int64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i].Load()
+		values[h.name+"_bucket"+labels(fmt.Sprintf(`le="%d"`, bound.Microseconds()))] = cumulative
+	}
+	cumulative += h.counts[len(h.bounds)].Load()
+	values[h.name+"_bucket"+labels(`le="+Inf"`)] = cumulative
+	values[h.name+"_count"+labels("")] = h.count.Load()
+	values[h.name+"_sum"+labels("")] = h.sum.Load()
+}
@@ -0,0 +1,63 @@
+// Package metrics provides lightweight in-process counters and histograms
+// that are exposed as JSON by the metrics endpoint.
+package metrics
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Counter is a monotonically increasing value that is safe for concurrent use.
+type Counter struct {
+	value atomic.Int64
+}
+
+// Inc increments the counter by one.
+func (c *Counter) Inc() {
+	c.value.Add(1)
+}
+
+// Add increments the counter by n.
+func (c *Counter) Add(n int64) {
+	c.value.Add(n)
+}
+
+// Value returns the current counter value.
+func (c *Counter) Value() int64 {
+	return c.value.Load()
+}
+
+var (
+	mu       sync.RWMutex
+	counters = make(map[string]*Counter)
+)
+
+// NewCounter registers and returns a counter with the given name.
+// Registering the same name twice returns the existing counter.
+func NewCounter(name string) *Counter {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if c, exists := counters[name]; exists {
+		return c
+	}
+	c := &Counter{}
+	counters[name] = c
+	return c
+}
+
+// Snapshot returns the current value of every registered counter, and the
+// counters of every registered histogram.
+func Snapshot() map[string]int64 {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	values := make(map[string]int64, len(counters))
+	for name, c := range counters {
+		values[name] = c.Value()
+	}
+	for _, h := range histograms {
+		h.snapshot(values)
+	}
+	return values
+}
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// AdminAuth middleware restricts access to callers presenting the admin
+// bearer token. When no token is configured, admin endpoints are disabled.
+func AdminAuth(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			provided := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+			if token == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+				requestID := GetRequestID(r.Context())
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprintf(w, `{"error":"Admin access required","request_id":"%s"}`, requestID)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
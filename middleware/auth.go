@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	userIDKey contextKey = "user_id"
+	adminKey  contextKey = "admin"
+)
+
+// TokenVerifier checks the access tokens users present (see auth.Signer).
+type TokenVerifier interface {
+	// VerifyToken returns the user a valid token belongs to and when it
+	// expires (zero if never), or an error if the token is not valid.
+	VerifyToken(ctx context.Context, token string) (userID string, expiresAt time.Time, err error)
+}
+
+// Identify middleware records who is calling: the admin, when the bearer
+// token is the admin token, or the user an access token was issued to.
+// Requests without a bearer token continue anonymously. When tokens is set,
+// a bearer token that is neither is rejected with 401; without it user
+// tokens are not checked and such requests continue anonymously.
+func Identify(adminToken string, tokens TokenVerifier) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || provided == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx := r.Context()
+			if adminToken != "" && subtle.ConstantTimeCompare([]byte(provided), []byte(adminToken)) == 1 {
+				next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, adminKey, true)))
+				return
+			}
+			if tokens == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			userID, _, err := tokens.VerifyToken(ctx, provided)
+			if err != nil {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusUnauthorized)
+				fmt.Fprintf(w, `{"error":%q,"request_id":"%s"}`, err.Error(), GetRequestID(ctx))
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, userIDKey, userID)))
+		})
+	}
+}
+
+// AuthUserID returns the user identified by an access token, or "" if the
+// request did not present one (see Identify).
+func AuthUserID(ctx context.Context) string {
+	userID, _ := ctx.Value(userIDKey).(string)
+	return userID
+}
+
+// IsAdmin reports whether the request presented the admin token (see Identify).
+func IsAdmin(ctx context.Context) bool {
+	admin, _ := ctx.Value(adminKey).(bool)
+	return admin
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeVerifier accepts the tokens in its map, keyed by token.
+type fakeVerifier map[string]string
+
+func (f fakeVerifier) VerifyToken(ctx context.Context, token string) (string, time.Time, error) {
+	if userID, ok := f[token]; ok {
+		return userID, time.Time{}, nil
+	}
+	return "", time.Time{}, errors.New("invalid access token")
+}
+
+func TestIdentify(t *testing.T) {
+	tokens := fakeVerifier{"user-token": "user-1"}
+
+	tests := []struct {
+		name      string
+		header    string
+		tokens    TokenVerifier
+		wantCode  int
+		wantUser  string
+		wantAdmin bool
+	}{
+		{name: "anonymous", wantCode: http.StatusOK, tokens: tokens},
+		{name: "admin", header: "Bearer admin-secret", tokens: tokens, wantCode: http.StatusOK, wantAdmin: true},
+		{name: "user", header: "Bearer user-token", tokens: tokens, wantCode: http.StatusOK, wantUser: "user-1"},
+		{name: "invalid token", header: "Bearer forged", tokens: tokens, wantCode: http.StatusUnauthorized},
+		{name: "user auth disabled", header: "Bearer user-token", wantCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotUser string
+			var gotAdmin bool
+			handler := Identify("admin-secret", tt.tokens)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotUser = AuthUserID(r.Context())
+				gotAdmin = IsAdmin(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d", rec.Code, tt.wantCode)
+			}
+			if gotUser != tt.wantUser || gotAdmin != tt.wantAdmin {
+				t.Errorf("identified user %q admin %v, want %q %v", gotUser, gotAdmin, tt.wantUser, tt.wantAdmin)
+			}
+		})
+	}
+}
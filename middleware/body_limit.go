@@ -0,0 +1,14 @@
+package middleware
+
+import "net/http"
+
+// BodyLimit middleware caps request bodies at maxBytes. Reading past the
+// limit fails with an *http.MaxBytesError, which handlers report as 413.
+func BodyLimit(maxBytes int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -34,7 +34,7 @@ func DefaultCORSConfig() CORSConfig {
 			"Content-Type",
 			"X-Request-ID",
 		},
-		ExposedHeaders:   []string{"X-Request-ID"},
+		ExposedHeaders:   []string{"X-Request-ID", "X-Next-Cursor"},
 		AllowCredentials: true,
 		MaxAge:           3600,
 	}
@@ -2,11 +2,14 @@ package middleware
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
 	"time"
 
+	"go-realtime-workspace/clock"
+
 	"github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog"
 )
@@ -15,17 +18,21 @@ import (
 type RateLimitConfig struct {
 	RequestsPerMinute int
 	BurstSize         int
-	RedisClient       *redis.Client
+	RedisClient       redis.UniversalClient
 	Logger            zerolog.Logger
+	Clock             clock.Clock // Time source for reset headers (defaults to the system clock)
 }
 
 // RateLimit middleware implements Redis-based rate limiting per IP
 func RateLimit(config RateLimitConfig) func(http.Handler) http.Handler {
+	if config.Clock == nil {
+		config.Clock = clock.Real{}
+	}
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Extract IP address
-			ip := getClientIP(r)
-			key := fmt.Sprintf("rate_limit:%s", ip)
+			ip := ClientIP(r)
+			key := rateLimitKey(ip)
 
 			ctx := context.Background()
 
@@ -45,7 +52,7 @@ func RateLimit(config RateLimitConfig) func(http.Handler) http.Handler {
 
 				w.Header().Set("X-RateLimit-Limit", strconv.Itoa(config.RequestsPerMinute))
 				w.Header().Set("X-RateLimit-Remaining", "0")
-				w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(ttl).Unix(), 10))
+				w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(config.Clock.Now().Add(ttl).Unix(), 10))
 				w.Header().Set("Retry-After", strconv.Itoa(int(ttl.Seconds())))
 				w.Header().Set("Content-Type", "application/json")
 				w.WriteHeader(http.StatusTooManyRequests)
@@ -80,8 +87,56 @@ func RateLimit(config RateLimitConfig) func(http.Handler) http.Handler {
 	}
 }
 
-// getClientIP extracts the real client IP address
-func getClientIP(r *http.Request) string {
+// RateLimitStatus handles reporting the caller's rate limit budget. It reads
+// the counter RateLimit maintains without incrementing it, so it should be
+// routed outside the rate-limited routes.
+func RateLimitStatus(config RateLimitConfig) http.HandlerFunc {
+	if config.Clock == nil {
+		config.Clock = clock.Real{}
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ip := ClientIP(r)
+		key := rateLimitKey(ip)
+
+		pipe := config.RedisClient.Pipeline()
+		countCmd := pipe.Get(r.Context(), key)
+		ttlCmd := pipe.TTL(r.Context(), key)
+		if _, err := pipe.Exec(r.Context()); err != nil && err != redis.Nil {
+			config.Logger.Error().Err(err).Str("ip", ip).Msg("Rate limit status check failed")
+			http.Error(w, "Rate limit status unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		count, _ := countCmd.Int()
+		remaining := config.RequestsPerMinute - count
+		if remaining < 0 {
+			remaining = 0
+		}
+
+		// Without a counter the window starts with the next request
+		ttl := ttlCmd.Val()
+		if ttl < 0 {
+			ttl = time.Minute
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"ip":        ip,
+			"limit":     config.RequestsPerMinute,
+			"count":     count,
+			"remaining": remaining,
+			"reset":     config.Clock.Now().Add(ttl).Unix(),
+		})
+	}
+}
+
+// rateLimitKey returns the key counting an IP's requests in the current window.
+func rateLimitKey(ip string) string {
+	return fmt.Sprintf("rate_limit:%s", ip)
+}
+
+// ClientIP extracts the real client IP address
+func ClientIP(r *http.Request) string {
 	// Check X-Forwarded-For header (behind proxy)
 	xff := r.Header.Get("X-Forwarded-For")
 	if xff != "" {
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-realtime-workspace/clock"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+)
+
+func TestRateLimitStatusMatchesCounter(t *testing.T) {
+	srv := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: srv.Addr()})
+	defer client.Close()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg := RateLimitConfig{
+		RequestsPerMinute: 5,
+		RedisClient:       client,
+		Logger:            zerolog.Nop(),
+		Clock:             clock.NewFake(now),
+	}
+	limited := RateLimit(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	status := RateLimitStatus(cfg)
+
+	request := func(h http.Handler, ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Real-IP", ip)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	type report struct {
+		Limit     int   `json:"limit"`
+		Count     int   `json:"count"`
+		Remaining int   `json:"remaining"`
+		Reset     int64 `json:"reset"`
+	}
+	check := func(ip string) report {
+		t.Helper()
+		var got report
+		if err := json.NewDecoder(request(status, ip).Body).Decode(&got); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return got
+	}
+
+	var last *httptest.ResponseRecorder
+	for i := 0; i < 3; i++ {
+		last = request(limited, "10.0.0.1")
+	}
+	want := report{Limit: 5, Count: 3, Remaining: 2, Reset: now.Add(time.Minute).Unix()}
+	if got := check("10.0.0.1"); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if remaining := last.Header().Get("X-RateLimit-Remaining"); remaining != "2" {
+		t.Errorf("middleware reported %s remaining, want 2", remaining)
+	}
+	// Checking the status does not spend the budget
+	if got := check("10.0.0.1"); got != want {
+		t.Errorf("second check: got %+v, want %+v", got, want)
+	}
+
+	if got := check("10.0.0.2"); got.Count != 0 || got.Remaining != 5 {
+		t.Errorf("fresh IP: got %+v, want the full budget", got)
+	}
+}
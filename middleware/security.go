@@ -2,32 +2,94 @@ package middleware
 
 import (
 	"net/http"
+	"strings"
 )
 
+// SecurityConfig holds the security headers to send. An empty header value
+// omits that header.
+type SecurityConfig struct {
+	FrameOptions      string // X-Frame-Options
+	NoSniff           bool   // Send X-Content-Type-Options: nosniff
+	XSSProtection     string // X-XSS-Protection
+	HSTS              string // Strict-Transport-Security; leave empty for plain-HTTP deployments
+	ReferrerPolicy    string // Referrer-Policy
+	PermissionsPolicy string // Permissions-Policy
+
+	CSP        bool     // Send a Content-Security-Policy built from the sources below
+	ScriptSrc  []string // CSP script-src sources
+	ConnectSrc []string // CSP connect-src sources
+}
+
+// DefaultSecurityConfig returns the strict headers meant for production.
+func DefaultSecurityConfig() SecurityConfig {
+	return SecurityConfig{
+		FrameOptions:      "DENY",
+		NoSniff:           true,
+		XSSProtection:     "1; mode=block",
+		HSTS:              "max-age=31536000; includeSubDomains",
+		ReferrerPolicy:    "strict-origin-when-cross-origin",
+		PermissionsPolicy: "geolocation=(), microphone=(), camera=()",
+
+		CSP:        true,
+		ScriptSrc:  []string{"'self'"},
+		ConnectSrc: []string{"'self'", "ws:", "wss:"},
+	}
+}
+
+// DevelopmentSecurityConfig returns the production headers without HSTS,
+// so browsers keep talking plain HTTP to a local server.
+func DevelopmentSecurityConfig() SecurityConfig {
+	config := DefaultSecurityConfig()
+	config.HSTS = ""
+	return config
+}
+
+// contentSecurityPolicy renders the CSP header value for the config.
+func (c SecurityConfig) contentSecurityPolicy() string {
+	return "default-src 'self'; script-src " + strings.Join(c.ScriptSrc, " ") +
+		"; style-src 'self' 'unsafe-inline'; img-src 'self' data:; font-src 'self'; connect-src " +
+		strings.Join(c.ConnectSrc, " ")
+}
+
 // Security middleware adds security headers
-func Security() func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Prevent clickjacking
-			w.Header().Set("X-Frame-Options", "DENY")
+func Security(config SecurityConfig) func(http.Handler) http.Handler {
+	headers := make(map[string]string)
+	set := func(name, value string) {
+		if value != "" {
+			headers[name] = value
+		}
+	}
+
+	// Prevent clickjacking
+	set("X-Frame-Options", config.FrameOptions)
 
-			// Prevent MIME type sniffing
-			w.Header().Set("X-Content-Type-Options", "nosniff")
+	// Prevent MIME type sniffing
+	if config.NoSniff {
+		set("X-Content-Type-Options", "nosniff")
+	}
+
+	// Enable XSS protection
+	set("X-XSS-Protection", config.XSSProtection)
 
-			// Enable XSS protection
-			w.Header().Set("X-XSS-Protection", "1; mode=block")
+	// Enforce HTTPS (only in production)
+	set("Strict-Transport-Security", config.HSTS)
 
-			// Enforce HTTPS (only in production)
-			w.Header().Set("Strict-Transport-Security", "max-age=31536000; includeSubDomains")
+	// Referrer policy
+	set("Referrer-Policy", config.ReferrerPolicy)
 
-			// Referrer policy
-			w.Header().Set("Referrer-Policy", "strict-origin-when-cross-origin")
+	// Content Security Policy
+	if config.CSP {
+		set("Content-Security-Policy", config.contentSecurityPolicy())
+	}
 
-			// Content Security Policy
-			w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'self'; style-src 'self' 'unsafe-inline'; img-src 'self' data:; font-src 'self'; connect-src 'self' ws: wss:")
+	// Permissions Policy (formerly Feature Policy)
+	set("Permissions-Policy", config.PermissionsPolicy)
 
-			// Permissions Policy (formerly Feature Policy)
-			w.Header().Set("Permissions-Policy", "geolocation=(), microphone=(), camera=()")
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for name, value := range headers {
+				w.Header().Set(name, value)
+			}
 
 			next.ServeHTTP(w, r)
 		})
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// securityHeaders returns the headers Security sets with config.
+func securityHeaders(config SecurityConfig) http.Header {
+	rec := httptest.NewRecorder()
+	Security(config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).
+		ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	return rec.Header()
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	prod := securityHeaders(DefaultSecurityConfig())
+	if prod.Get("Strict-Transport-Security") == "" {
+		t.Error("production config omits HSTS")
+	}
+	if csp := prod.Get("Content-Security-Policy"); !strings.Contains(csp, "script-src 'self';") || !strings.HasSuffix(csp, "connect-src 'self' ws: wss:") {
+		t.Errorf("production CSP %q is not the strict default", csp)
+	}
+
+	dev := securityHeaders(DevelopmentSecurityConfig())
+	if hsts := dev.Get("Strict-Transport-Security"); hsts != "" {
+		t.Errorf("development config sends HSTS %q", hsts)
+	}
+	if dev.Get("X-Frame-Options") != "DENY" || dev.Get("Content-Security-Policy") == "" {
+		t.Error("development config dropped headers other than HSTS")
+	}
+
+	custom := DefaultSecurityConfig()
+	custom.ScriptSrc = []string{"'self'", "https://cdn.example.com"}
+	custom.ConnectSrc = []string{"'self'", "wss://chat.example.com"}
+	custom.FrameOptions = ""
+	headers := securityHeaders(custom)
+	want := "default-src 'self'; script-src 'self' https://cdn.example.com; style-src 'self' 'unsafe-inline'; img-src 'self' data:; font-src 'self'; connect-src 'self' wss://chat.example.com"
+	if got := headers.Get("Content-Security-Policy"); got != want {
+		t.Errorf("CSP %q, want %q", got, want)
+	}
+	if _, ok := headers["X-Frame-Options"]; ok {
+		t.Error("an empty header value was still sent")
+	}
+
+	custom.CSP = false
+	if csp := securityHeaders(custom).Get("Content-Security-Policy"); csp != "" {
+		t.Errorf("disabled CSP sent as %q", csp)
+	}
+}
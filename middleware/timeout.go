@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Timeout middleware gives each request a context that is canceled after
+// timeout, so repository calls made with r.Context() give up instead of
+// hanging until the server's write timeout. A request whose deadline passes
+// before it responds, or that fails with a server error after the deadline
+// (typically the canceled query surfacing as a 500), gets 504 Gateway
+// Timeout instead. WebSocket upgrades are passed through untouched.
+//
+// Work that ignores the request context is not interrupted; the handler
+// still runs to completion, only its response is replaced.
+func Timeout(timeout time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Upgrade") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+
+			tw := &timeoutWriter{ResponseWriter: w, ctx: ctx}
+			next.ServeHTTP(tw, r.WithContext(ctx))
+
+			if !tw.wroteHeader && expired(ctx) {
+				tw.writeTimeout()
+			}
+		})
+	}
+}
+
+// timeoutWriter replaces a late server error with a 504 response.
+type timeoutWriter struct {
+	http.ResponseWriter
+	ctx context.Context
+
+	wroteHeader bool
+	timedOut    bool // The handler's response is discarded in favor of a 504
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	if tw.wroteHeader {
+		return
+	}
+	if code >= http.StatusInternalServerError && expired(tw.ctx) {
+		tw.writeTimeout()
+		return
+	}
+	tw.wroteHeader = true
+	tw.ResponseWriter.WriteHeader(code)
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.WriteHeader(http.StatusOK)
+	if tw.timedOut {
+		return len(b), nil
+	}
+	return tw.ResponseWriter.Write(b)
+}
+
+// writeTimeout sends the 504 response.
+func (tw *timeoutWriter) writeTimeout() {
+	tw.wroteHeader = true
+	tw.timedOut = true
+
+	requestID := GetRequestID(tw.ctx)
+	h := tw.ResponseWriter.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Type", "application/json")
+	tw.ResponseWriter.WriteHeader(http.StatusGatewayTimeout)
+	fmt.Fprintf(tw.ResponseWriter, `{"error":"Request timed out","request_id":"%s"}`, requestID)
+}
+
+// expired reports whether ctx hit its deadline.
+func expired(ctx context.Context) bool {
+	return errors.Is(ctx.Err(), context.DeadlineExceeded)
+}
@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestTimeoutCancelsSlowQuery(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+	mock.ExpectQuery("SELECT").WillDelayFor(5 * time.Second).WillReturnRows(sqlmock.NewRows([]string{"n"}).AddRow(1))
+
+	queryErr := make(chan error, 1)
+	handler := Timeout(50 * time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n int
+		err := db.QueryRowContext(r.Context(), "SELECT 1").Scan(&n)
+		queryErr <- err
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	start := time.Now()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/users", nil))
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("request took %s, want the query canceled at the deadline", elapsed)
+	}
+	if err := <-queryErr; err == nil {
+		t.Error("slow query was not canceled")
+	}
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("status %d, want %d", rec.Code, http.StatusGatewayTimeout)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		upgrade bool
+		handler func(w http.ResponseWriter, r *http.Request)
+		want    int
+	}{
+		{
+			name:    "fast handler",
+			handler: func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusCreated) },
+			want:    http.StatusCreated,
+		},
+		{
+			name:    "no response before the deadline",
+			handler: func(w http.ResponseWriter, r *http.Request) { <-r.Context().Done() },
+			want:    http.StatusGatewayTimeout,
+		},
+		{
+			name: "client error after the deadline",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				<-r.Context().Done()
+				w.WriteHeader(http.StatusNotFound)
+			},
+			want: http.StatusNotFound,
+		},
+		{
+			name:    "websocket upgrade",
+			upgrade: true,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if _, ok := r.Context().Deadline(); ok {
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+			},
+			want: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.upgrade {
+				req.Header.Set("Upgrade", "websocket")
+			}
+			rec := httptest.NewRecorder()
+			Timeout(20*time.Millisecond)(http.HandlerFunc(tt.handler)).ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
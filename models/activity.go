@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+)
+
+// Activity counters recorded per organization and hour.
+const (
+	ActivityMessages = "messages"
+	ActivityJoins    = "joins"
+	ActivityLeaves   = "leaves"
+)
+
+// ActivityBucket tallies what happened in an organization during one bucket
+// of an activity timeline.
+type ActivityBucket struct {
+	Start          time.Time `json:"start"`
+	Messages       int64     `json:"messages"`
+	Joins          int64     `json:"joins"`
+	Leaves         int64     `json:"leaves"`
+	AuditEvents    int64     `json:"audit_events"`
+	TasksCompleted int64     `json:"tasks_completed"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Audit log actions.
+const (
+	AuditRoleChanged = "user.role_changed"
+)
+
+// AuditEntry records an administrative change made within an organization.
+type AuditEntry struct {
+	ID        string          `json:"id" db:"id"`
+	OrgID     string          `json:"org_id" db:"org_id"`
+	ActorID   string          `json:"actor_id" db:"actor_id"`
+	Action    string          `json:"action" db:"action"`
+	TargetID  string          `json:"target_id" db:"target_id"`
+	Metadata  json.RawMessage `json:"metadata,omitempty" db:"metadata"`
+	RequestID string          `json:"request_id,omitempty" db:"request_id"`
+	IP        string          `json:"ip,omitempty" db:"ip"`
+	CreatedAt time.Time       `json:"created_at" db:"created_at"`
+}
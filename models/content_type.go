@@ -0,0 +1,147 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Content types of a message. Text is the default and always allowed;
+// the others carry a JSON object in Content, checked against the schema
+// registered for the type, and must be allowed by Message.ContentTypes.
+const (
+	ContentText     = "text"
+	ContentLocation = "location" // See LocationContent
+	ContentContact  = "contact"  // See ContactContent
+	ContentCard     = "card"     // See CardContent
+)
+
+// ErrInvalidContent is returned when a message's content type is not
+// allowed or its content does not match the type's schema.
+var ErrInvalidContent = errors.New("invalid structured content")
+
+// structuredContent is the schema of a structured content type.
+type structuredContent interface {
+	validate() error
+}
+
+// contentSchemas registers the schema of each structured content type.
+var contentSchemas = map[string]func() structuredContent{
+	ContentLocation: func() structuredContent { return &LocationContent{} },
+	ContentContact:  func() structuredContent { return &ContactContent{} },
+	ContentCard:     func() structuredContent { return &CardContent{} },
+}
+
+// LocationContent is the content of a location message.
+type LocationContent struct {
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+	Name      string   `json:"name,omitempty"`
+	Address   string   `json:"address,omitempty"`
+}
+
+func (c *LocationContent) validate() error {
+	if c.Latitude == nil || c.Longitude == nil {
+		return errors.New("latitude and longitude are required")
+	}
+	if *c.Latitude < -90 || *c.Latitude > 90 {
+		return errors.New("latitude must be between -90 and 90")
+	}
+	if *c.Longitude < -180 || *c.Longitude > 180 {
+		return errors.New("longitude must be between -180 and 180")
+	}
+	return nil
+}
+
+// ContactContent is the content of a contact card message. It needs a
+// name and at least one way to reach the contact.
+type ContactContent struct {
+	Name   string `json:"name"`
+	Email  string `json:"email,omitempty"`
+	Phone  string `json:"phone,omitempty"`
+	UserID string `json:"user_id,omitempty"` // Set when the contact is a user of the workspace
+}
+
+func (c *ContactContent) validate() error {
+	if strings.TrimSpace(c.Name) == "" {
+		return errors.New("name is required")
+	}
+	if c.Email == "" && c.Phone == "" && c.UserID == "" {
+		return errors.New("one of email, phone or user_id is required")
+	}
+	return nil
+}
+
+// CardContent is the content of a card message, such as a system or
+// integration notice with a link.
+type CardContent struct {
+	Title string `json:"title"`
+	Text  string `json:"text,omitempty"`
+	URL   string `json:"url,omitempty"` // An http or https link the card opens
+}
+
+func (c *CardContent) validate() error {
+	if strings.TrimSpace(c.Title) == "" {
+		return errors.New("title is required")
+	}
+	if c.URL != "" {
+		u, err := url.Parse(c.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("url must be an http or https URL")
+		}
+	}
+	return nil
+}
+
+// KnownContentType reports whether contentType is text or has a
+// registered schema.
+func KnownContentType(contentType string) bool {
+	_, ok := contentSchemas[contentType]
+	return ok || contentType == ContentText
+}
+
+// StructuredContent reports whether messages of contentType carry a JSON
+// object rather than text. An empty content type is text.
+func StructuredContent(contentType string) bool {
+	return contentType != "" && contentType != ContentText
+}
+
+// ValidateContentType checks content against the schema of contentType,
+// which must be text or one of allowed, and rewrites it in canonical JSON
+// with unknown fields refused. Errors wrap ErrInvalidContent.
+func ValidateContentType(contentType string, content *string, allowed []string) error {
+	if !StructuredContent(contentType) {
+		return nil
+	}
+	newSchema, ok := contentSchemas[contentType]
+	if !ok || !slices.Contains(allowed, contentType) {
+		return fmt.Errorf("%w: content type %q is not allowed", ErrInvalidContent, contentType)
+	}
+
+	schema := newSchema()
+	dec := json.NewDecoder(strings.NewReader(*content))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(schema); err != nil {
+		return fmt.Errorf("%w: %s content is not valid: %v", ErrInvalidContent, contentType, err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return fmt.Errorf("%w: %s content must be a single JSON object", ErrInvalidContent, contentType)
+	}
+	if err := schema.validate(); err != nil {
+		return fmt.Errorf("%w: %s content: %v", ErrInvalidContent, contentType, err)
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(schema); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidContent, err)
+	}
+	*content = strings.TrimSuffix(buf.String(), "\n")
+	return nil
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateContentType(t *testing.T) {
+	allowed := []string{ContentLocation, ContentCard}
+	tests := []struct {
+		name        string
+		contentType string
+		content     string
+		want        string // Canonical content; empty when rejected
+	}{
+		{"text is always allowed", ContentText, "<b>hi</b>", "<b>hi</b>"},
+		{"empty type is text", "", "hi", "hi"},
+		{"valid location", ContentLocation, ` { "longitude": 2.35, "latitude": 48.85, "name": "Paris & co" } `, `{"latitude":48.85,"longitude":2.35,"name":"Paris & co"}`},
+		{"unknown type", "hologram", `{}`, ""},
+		{"known type not allowed", ContentContact, `{"name": "Bob", "email": "bob@example.com"}`, ""},
+		{"missing longitude", ContentLocation, `{"latitude": 48.85}`, ""},
+		{"latitude out of range", ContentLocation, `{"latitude": 91, "longitude": 0}`, ""},
+		{"unknown field", ContentLocation, `{"latitude": 0, "longitude": 0, "altitude": 30}`, ""},
+		{"trailing data", ContentLocation, `{"latitude": 0, "longitude": 0} {}`, ""},
+		{"not JSON", ContentCard, `Deploy finished`, ""},
+		{"card link not http", ContentCard, `{"title": "Deploy", "url": "javascript:alert(1)"}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := tt.content
+			err := ValidateContentType(tt.contentType, &content, allowed)
+			if tt.want == "" {
+				if !errors.Is(err, ErrInvalidContent) {
+					t.Errorf("got %v, want %v", err, ErrInvalidContent)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got %v, want no error", err)
+			}
+			if content != tt.want {
+				t.Errorf("content %s, want %s", content, tt.want)
+			}
+		})
+	}
+}
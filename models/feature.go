@@ -0,0 +1,27 @@
+package models
+
+// Per-organization features. Every feature is enabled unless an org turns it off.
+const (
+	FeatureDM          = "dm"          // Direct messages sent by the org's users
+	FeatureReactions   = "reactions"   // Emoji reactions on group messages
+	FeatureThreads     = "threads"     // Replies to earlier messages (reply_to_id)
+	FeatureAttachments = "attachments" // File attachments (reserved; not yet implemented)
+)
+
+// Features lists every known feature flag.
+var Features = []string{FeatureDM, FeatureReactions, FeatureThreads, FeatureAttachments}
+
+// ValidFeature reports whether name is a known feature flag.
+func ValidFeature(name string) bool {
+	for _, feature := range Features {
+		if feature == name {
+			return true
+		}
+	}
+	return false
+}
+
+// SetFeatureRequest represents the request body for toggling a feature.
+type SetFeatureRequest struct {
+	Enabled bool `json:"enabled"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+)
+
+// OrgInvite is a single-use invitation to join an organization with a role.
+type OrgInvite struct {
+	ID         string     `json:"id" db:"id"`
+	OrgID      string     `json:"org_id" db:"org_id"`
+	Role       string     `json:"role" db:"role"`
+	Token      string     `json:"token,omitempty"` // Only returned when the invite is created
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at" db:"expires_at"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty" db:"accepted_at"`
+	AcceptedBy *string    `json:"accepted_by,omitempty" db:"accepted_by"`
+}
+
+// CreateInviteRequest represents the request body for creating an invite.
+type CreateInviteRequest struct {
+	Role           string `json:"role"`
+	ExpiresInHours int    `json:"expires_in_hours,omitempty"`
+}
+
+// AcceptInviteRequest represents the request body for accepting an invite.
+// Either UserID links an existing user, or Username and Email create a new one.
+type AcceptInviteRequest struct {
+	UserID   string `json:"user_id,omitempty"`
+	Username string `json:"username,omitempty"`
+	Email    string `json:"email,omitempty"`
+	FullName string `json:"full_name,omitempty"`
+}
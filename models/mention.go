@@ -0,0 +1,63 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// mentionPattern matches an @handle mention: a user ID or username after an
+// @ that does not follow a word character, so e-mail addresses do not count.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@([\w.-]*\w)`)
+
+// ExtractMentions returns the handles mentioned in content as @handle,
+// lowercased and without duplicates, in order of first appearance.
+func ExtractMentions(content string) []string {
+	var handles []string
+	seen := make(map[string]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		handle := strings.ToLower(match[1])
+		if !seen[handle] {
+			seen[handle] = true
+			handles = append(handles, handle)
+		}
+	}
+	return handles
+}
+
+// Mentions reports whether content mentions any of handles (a user's ID and
+// username, for example). Handles are compared case-insensitively.
+func Mentions(content string, handles ...string) bool {
+	if !strings.Contains(content, "@") {
+		return false
+	}
+	for _, mentioned := range ExtractMentions(content) {
+		for _, handle := range handles {
+			if handle != "" && strings.EqualFold(mentioned, handle) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Mention is an entry of a user's mentions inbox: a message that mentioned
+// the user, with a preview of its content.
+type Mention struct {
+	OrgID     string    `json:"org_id"`
+	GroupID   string    `json:"group_id"`
+	MessageID string    `json:"message_id"`
+	ClientID  string    `json:"client_id"`
+	Username  string    `json:"username,omitempty"`
+	Snippet   string    `json:"snippet"`
+	Timestamp time.Time `json:"timestamp"`
+	Read      bool      `json:"read"`
+}
+
+// MentionsPage is one page of a user's mentions inbox, newest first.
+type MentionsPage struct {
+	UserID     string     `json:"user_id"`
+	Mentions   []Mention  `json:"mentions"`
+	Unread     int64      `json:"unread"`                // Unread mentions in the whole inbox
+	NextBefore *time.Time `json:"next_before,omitempty"` // Pass as before for the next page; omitted on the last page
+}
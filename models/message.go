@@ -1,17 +1,295 @@
 package models
 
 import (
+	"errors"
+	"fmt"
+	"regexp"
 	"time"
 )
 
+// ErrContentTooLarge is returned when message content exceeds the configured size limit.
+var ErrContentTooLarge = errors.New("message content is too large")
+
+// ValidateContent checks content against a size limit in bytes (0 disables
+// the check). Content is measured in UTF-8 bytes, not characters, so
+// multibyte text reaches the limit with fewer characters.
+func ValidateContent(content string, maxBytes int) error {
+	if maxBytes > 0 && len(content) > maxBytes {
+		return fmt.Errorf("%w: %d bytes exceeds the limit of %d", ErrContentTooLarge, len(content), maxBytes)
+	}
+	return nil
+}
+
+// Kinds of stored history entries.
+const (
+	KindChat         = "chat"         // A message sent by a user
+	KindAnnouncement = "announcement" // An org-wide broadcast shown in each group
+	KindSystem       = "system"       // A message generated by the server
+	KindPoll         = "poll"         // A poll posted by a user; see Poll
+)
+
+// SystemUserID is the client ID of the system bot, the author of messages
+// posted by the server itself, such as automations and announcements sent
+// without an author. It is reserved in every organization: no client may
+// connect with it. Its messages are flagged with Bot.
+const SystemUserID = "system"
+
+// SystemUsername is stored as the username of the system bot's messages.
+const SystemUsername = "System"
+
+// ValidKind reports whether kind is a known history entry kind.
+func ValidKind(kind string) bool {
+	switch kind {
+	case KindChat, KindAnnouncement, KindSystem, KindPoll:
+		return true
+	}
+	return false
+}
+
+// channelPattern is the charset and length allowed for channel tags.
+var channelPattern = regexp.MustCompile(`^[a-z0-9_-]{1,50}$`)
+
+// ValidChannel reports whether name is a valid channel tag: 1-50 lowercase
+// letters, digits, underscores or hyphens.
+func ValidChannel(name string) bool {
+	return channelPattern.MatchString(name)
+}
+
 // ChatMessage represents a stored chat message in Redis.
 type ChatMessage struct {
 	ID          string    `json:"id"`
+	Kind        string    `json:"kind,omitempty"` // Empty for chat messages and announcements; see MessageKind
 	OrgID       string    `json:"org_id"`
 	GroupID     string    `json:"group_id"`
 	ClientID    string    `json:"client_id"`
 	RecipientID string    `json:"recipient_id,omitempty"` // For direct messages
 	Username    string    `json:"username,omitempty"`
+	AvatarURL   string    `json:"avatar_url,omitempty"` // The sender's avatar, filled in on read and never stored
 	Content     string    `json:"content"`
+	ContentType string    `json:"content_type,omitempty"` // Empty for text; see ValidateContentType
 	Timestamp   time.Time `json:"timestamp"`
+	ReplyToID   string    `json:"reply_to_id,omitempty"` // ID of the message being replied to
+
+	// Channel tags the message with a sub-channel of its group. Untagged
+	// messages belong to the whole group.
+	Channel string `json:"channel,omitempty"`
+
+	// ExpiresAt makes the message disappear at the given time, ahead of the
+	// group's normal history TTL. Nil means the message follows the TTL.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	// AnnouncementID marks a group history entry that points at an org-wide
+	// announcement stored once under announcements:{orgId}. Pointers are
+	// expanded to the full announcement when history is read.
+	AnnouncementID string `json:"announcement_id,omitempty"`
+
+	// EditedAt is set when the author last changed Content.
+	EditedAt *time.Time `json:"edited_at,omitempty"`
+
+	// ForwardedFrom references the original of a forwarded message.
+	ForwardedFrom *ForwardRef `json:"forwarded_from,omitempty"`
+
+	// Quote is a short preview of the ReplyToID message, filled in on read.
+	Quote *MessageQuote `json:"quote,omitempty"`
+
+	// Reactions counts reactions by emoji, filled in when history is read.
+	Reactions map[string]int `json:"reactions,omitempty"`
+
+	// AckRequired asks each recipient to acknowledge the message; see
+	// MessageAcks.
+	AckRequired bool `json:"ack_required,omitempty"`
+
+	// Bot marks a message posted by the system bot (see SystemUserID), for
+	// clients to render apart from users' messages.
+	Bot bool `json:"bot,omitempty"`
+
+	// Poll is the poll a KindPoll entry posted, as it was created. Its
+	// tallies are read from the poll results.
+	Poll *Poll `json:"poll,omitempty"`
+
+	// DeliveryState and DeliveredAt report how far a direct message got
+	// with its recipient; see the Delivery constants. They are filled in
+	// when DM history is read.
+	DeliveryState string     `json:"delivery_state,omitempty"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
+}
+
+// Delivery states of a direct message. Each implies the ones before it.
+const (
+	DeliverySent      = "sent"      // Stored, not yet received by the recipient
+	DeliveryDelivered = "delivered" // Received by the recipient, live or from history
+	DeliveryRead      = "read"      // Passed by the recipient's read marker
+)
+
+// MessageKind returns the kind of the history entry. Chat messages and
+// announcements are told apart by AnnouncementID and do not store a kind.
+func (m *ChatMessage) MessageKind() string {
+	switch {
+	case m.Kind != "":
+		return m.Kind
+	case m.AnnouncementID != "":
+		return KindAnnouncement
+	default:
+		return KindChat
+	}
+}
+
+// MessageQuote is a short preview of a quoted message.
+type MessageQuote struct {
+	ID       string `json:"id"`
+	ClientID string `json:"client_id"`
+	Username string `json:"username,omitempty"`
+	Snippet  string `json:"snippet"`
+}
+
+// MessageAck is one recipient's delivery and acknowledgement of a message.
+type MessageAck struct {
+	UserID      string     `json:"user_id"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+	AckedAt     *time.Time `json:"acked_at,omitempty"`
+}
+
+// MessageAcks reports who acknowledged a message sent with ack_required.
+type MessageAcks struct {
+	MessageID string       `json:"message_id"`
+	Acked     []MessageAck `json:"acked"`   // In the order they acknowledged
+	Pending   []MessageAck `json:"pending"` // Delivered but not yet acknowledged
+}
+
+// ForwardRef identifies the original message a forwarded message copies.
+type ForwardRef struct {
+	OrgID     string `json:"org_id"`
+	GroupID   string `json:"group_id"`
+	MessageID string `json:"message_id"`
+	ClientID  string `json:"client_id"` // Original author
+	Username  string `json:"username,omitempty"`
+}
+
+// DMConversation summarizes a direct message conversation for an inbox view.
+type DMConversation struct {
+	RoomID       string       `json:"room_id"`
+	PeerID       string       `json:"peer_id"`
+	LastMessage  *ChatMessage `json:"last_message,omitempty"`
+	UnreadCount  int64        `json:"unread_count"`
+	LastActivity time.Time    `json:"last_activity"`
+}
+
+// MessageWindows limits how long after sending an author may edit or
+// delete a message. A zero window is unlimited.
+type MessageWindows struct {
+	EditSeconds   int64 `json:"edit_window_seconds"`
+	DeleteSeconds int64 `json:"delete_window_seconds"`
+}
+
+// Scopes a MessageWindows setting can come from.
+const (
+	WindowScopeGroup   = "group"   // Set on the group
+	WindowScopeOrg     = "org"     // Set on the organization
+	WindowScopeDefault = "default" // Neither; editing and deleting are unlimited
+)
+
+// MessageWindowsResponse reports the windows that apply to a group or an
+// organization and where they are set.
+type MessageWindowsResponse struct {
+	MessageWindows
+	Scope string `json:"scope"`
+}
+
+// GroupUnread counts what a user has not read in one group.
+type GroupUnread struct {
+	OrgID    string `json:"org_id"`
+	GroupID  string `json:"group_id"`
+	Unread   int64  `json:"unread"`
+	Mentions int64  `json:"mentions"`
+}
+
+// MissedSummary sums up what a user missed while offline: unread messages
+// in the groups they follow, how many of those mention them, and unread
+// direct messages.
+type MissedSummary struct {
+	Groups   []GroupUnread `json:"groups"`   // Groups with unread messages
+	Unread   int64         `json:"unread"`   // Unread group messages in total
+	Mentions int64         `json:"mentions"` // Unread group messages mentioning the user
+	DMs      int64         `json:"dms"`      // Unread direct messages
+	DMRooms  int           `json:"dm_rooms"` // Conversations with unread direct messages
+}
+
+// ReactionRequest represents the request body for adding a reaction.
+type ReactionRequest struct {
+	UserID string `json:"user_id"`
+	Emoji  string `json:"emoji"`
+}
+
+// EditMessageRequest represents the request body for editing a message.
+type EditMessageRequest struct {
+	ClientID string `json:"client_id"` // Must match the message author
+	Content  string `json:"content"`
+}
+
+// BatchGetMessagesRequest represents the request body for fetching several
+// messages of a group by ID.
+type BatchGetMessagesRequest struct {
+	IDs []string `json:"ids"`
+}
+
+// BatchGetMessagesResponse holds the messages found by a batch get and the
+// IDs that are not stored.
+type BatchGetMessagesResponse struct {
+	Messages []ChatMessage `json:"messages"` // In request order
+	Missing  []string      `json:"missing"`  // Never sent, deleted, trimmed or expired
+}
+
+// ImportMessagesRequest represents the request body for importing
+// historical messages into a group.
+type ImportMessagesRequest struct {
+	Messages []ImportMessage `json:"messages"`
+}
+
+// ImportMessage is one historical message to import, with its original
+// author and timestamp. An ID is generated when none is given.
+type ImportMessage struct {
+	ID        string    `json:"id,omitempty"`
+	ClientID  string    `json:"client_id"`
+	Username  string    `json:"username,omitempty"`
+	Content   string    `json:"content"`
+	Timestamp time.Time `json:"timestamp"`
+	ReplyToID string    `json:"reply_to_id,omitempty"`
+	Channel   string    `json:"channel,omitempty"`
+}
+
+// Outcomes of an imported message.
+const (
+	ImportImported  = "imported"
+	ImportDuplicate = "duplicate"
+	ImportInvalid   = "invalid"
+)
+
+// ImportResult reports what happened to one message of an import.
+type ImportResult struct {
+	Index  int    `json:"index"` // Position in the request's messages
+	ID     string `json:"id,omitempty"`
+	Status string `json:"status"` // ImportImported, ImportDuplicate or ImportInvalid
+	Error  string `json:"error,omitempty"`
+}
+
+// ImportMessagesResponse summarizes an import.
+type ImportMessagesResponse struct {
+	Imported int            `json:"imported"`
+	Skipped  int            `json:"skipped"`
+	Results  []ImportResult `json:"results"`
+}
+
+// ForwardMessageRequest represents the request body for forwarding a
+// message. Exactly one of GroupID and RecipientID names the target.
+type ForwardMessageRequest struct {
+	ClientID    string `json:"client_id"`              // The forwarding user
+	GroupID     string `json:"group_id,omitempty"`     // Target group in the same organization
+	RecipientID string `json:"recipient_id,omitempty"` // Target user for a direct message
+}
+
+// StarRequest identifies the message a user wants to star.
+type StarRequest struct {
+	OrgID     string `json:"org_id"`
+	GroupID   string `json:"group_id"`
+	MessageID string `json:"message_id"`
 }
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateContentCountsBytes(t *testing.T) {
+	tests := []struct {
+		content string
+		wantErr error
+	}{
+		{content: "abcdef"},
+		{content: "abcdefg", wantErr: ErrContentTooLarge},
+		{content: "ééé"}, // 3 runes, 6 bytes
+		{content: "éééa", wantErr: ErrContentTooLarge}, // 4 runes, 7 bytes
+		{content: "€€"}, // 2 runes, 6 bytes
+		{content: "€€a", wantErr: ErrContentTooLarge}, // 3 runes, 7 bytes
+		{content: "😀a", wantErr: nil},                 // 2 runes, 5 bytes
+		{content: "😀😀", wantErr: ErrContentTooLarge},  // 2 runes, 8 bytes
+	}
+	for _, tt := range tests {
+		if err := ValidateContent(tt.content, 6); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%q: got %v, want %v", tt.content, err, tt.wantErr)
+		}
+	}
+	if err := ValidateContent("unlimited", 0); err != nil {
+		t.Errorf("limit 0: got %v, want no limit", err)
+	}
+}
@@ -0,0 +1,73 @@
+package models
+
+import "time"
+
+// Notification levels, from most to least notifications.
+const (
+	NotifyAll      = "all"      // Every message in the user's groups, mentions and DMs
+	NotifyMentions = "mentions" // Mentions and DMs only
+	NotifyDMs      = "dms"      // DMs only
+	NotifyNone     = "none"     // Nothing
+)
+
+// ValidNotifyLevel reports whether level is one of the notification levels.
+func ValidNotifyLevel(level string) bool {
+	switch level {
+	case NotifyAll, NotifyMentions, NotifyDMs, NotifyNone:
+		return true
+	}
+	return false
+}
+
+// Events that may notify a user.
+const (
+	NotificationMessage = "message" // A new message in a group
+	NotificationMention = "mention" // A group message mentioning the user
+	NotificationDM      = "dm"      // A direct message to the user
+)
+
+// GroupRef identifies a group within an organization.
+type GroupRef struct {
+	OrgID   string `json:"org_id"`
+	GroupID string `json:"group_id"`
+}
+
+// NotificationPrefs controls which events push notifications to a user.
+// Preferences only affect notifications; messages are always stored and
+// delivered to the user's open connections.
+type NotificationPrefs struct {
+	UserID      string     `json:"user_id"`
+	Level       string     `json:"level"`
+	MutedGroups []GroupRef `json:"muted_groups"`
+	UpdatedAt   *time.Time `json:"updated_at,omitempty"`
+}
+
+// Allows reports whether event should notify the user. orgID and groupID
+// name the group a group event happened in; they are ignored for DMs.
+// A muted group never notifies, whatever the level.
+func (p *NotificationPrefs) Allows(event, orgID, groupID string) bool {
+	if event != NotificationDM {
+		for _, muted := range p.MutedGroups {
+			if muted.OrgID == orgID && muted.GroupID == groupID {
+				return false
+			}
+		}
+	}
+
+	switch p.Level {
+	case NotifyAll:
+		return true
+	case NotifyMentions:
+		return event == NotificationMention || event == NotificationDM
+	case NotifyDMs:
+		return event == NotificationDM
+	}
+	return false
+}
+
+// SetNotificationPrefsRequest represents the request body for replacing a
+// user's notification preferences.
+type SetNotificationPrefsRequest struct {
+	Level       string     `json:"level"`
+	MutedGroups []GroupRef `json:"muted_groups"`
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// OrgConfigVersion is the layout version of OrgConfig bundles. It is bumped
+// whenever the layout changes, and imports of other versions are refused.
+const OrgConfigVersion = 1
+
+// ErrInvalidOrgConfig is returned when an imported bundle is malformed.
+var ErrInvalidOrgConfig = errors.New("invalid org config")
+
+// OrgConfig is a portable snapshot of an organization's settings, used to
+// copy them between environments. Users are referred to by username, since
+// their IDs differ from one environment to the next.
+type OrgConfig struct {
+	Version        int               `json:"version"`
+	OrgID          string            `json:"org_id"` // The organization exported; ignored on import
+	ExportedAt     time.Time         `json:"exported_at"`
+	Features       map[string]bool   `json:"features"`
+	Quota          *OrgQuota         `json:"quota"`           // The org's quota override; null for the global default
+	MessageWindows *MessageWindows   `json:"message_windows"` // The org's edit and delete windows; null if unset
+	Roles          map[string]string `json:"roles"`           // Organization role by username
+}
+
+// Validate reports whether the bundle can be imported: it must be of the
+// current version and name only known features and roles.
+func (c *OrgConfig) Validate() error {
+	if c.Version != OrgConfigVersion {
+		return fmt.Errorf("%w: version %d is not supported; this server reads version %d", ErrInvalidOrgConfig, c.Version, OrgConfigVersion)
+	}
+	for feature := range c.Features {
+		if !ValidFeature(feature) {
+			return fmt.Errorf("%w: unknown feature %q", ErrInvalidOrgConfig, feature)
+		}
+	}
+	if q := c.Quota; q != nil {
+		if q.MaxMessages < 0 || q.MaxBytes < 0 {
+			return fmt.Errorf("%w: quota limits must not be negative", ErrInvalidOrgConfig)
+		}
+		if !ValidQuotaPolicy(q.Policy) {
+			return fmt.Errorf("%w: quota policy must be %s or %s", ErrInvalidOrgConfig, QuotaPolicyReject, QuotaPolicyTrim)
+		}
+	}
+	if w := c.MessageWindows; w != nil && (w.EditSeconds < 0 || w.DeleteSeconds < 0) {
+		return fmt.Errorf("%w: message windows must not be negative", ErrInvalidOrgConfig)
+	}
+	for username, role := range c.Roles {
+		if !ValidRole(role) {
+			return fmt.Errorf("%w: role of %q must be owner, admin, manager or member", ErrInvalidOrgConfig, username)
+		}
+	}
+	return nil
+}
+
+// ConfigChange describes one setting changed by an import. Setting is a
+// dotted path such as "features.dm" or "roles.alice".
+type ConfigChange struct {
+	Setting string      `json:"setting"`
+	From    interface{} `json:"from"`
+	To      interface{} `json:"to"`
+}
+
+// OrgConfigImportResult reports what an import changed. Importing the same
+// bundle again changes nothing.
+type OrgConfigImportResult struct {
+	OrgID        string         `json:"org_id"`
+	Changes      []ConfigChange `json:"changes"`
+	SkippedUsers []string       `json:"skipped_users,omitempty"` // Usernames in the bundle that are not in the organization
+}
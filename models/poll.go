@@ -0,0 +1,116 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Limits on the shape of a poll.
+const (
+	MinPollOptions      = 2
+	MaxPollOptions      = 10
+	MaxPollOptionLength = 200 // Characters
+)
+
+// ErrInvalidPoll is returned when a poll or a vote on it is malformed.
+var ErrInvalidPoll = errors.New("invalid poll")
+
+// Poll is a question posted to a group with options its members vote on.
+// It is stored alongside the history entry of kind KindPoll that announced
+// it, and shares that entry's ID.
+type Poll struct {
+	ID             string     `json:"id"`
+	OrgID          string     `json:"org_id"`
+	GroupID        string     `json:"group_id"`
+	CreatedBy      string     `json:"created_by"`
+	Question       string     `json:"question"`
+	Options        []string   `json:"options"`
+	MultipleChoice bool       `json:"multiple_choice"`     // Voters may pick several options
+	ClosesAt       *time.Time `json:"closes_at,omitempty"` // Votes are refused from this time on; nil keeps the poll open
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// Closed reports whether voting on the poll has ended at now.
+func (p *Poll) Closed(now time.Time) bool {
+	return p.ClosesAt != nil && !now.Before(*p.ClosesAt)
+}
+
+// ValidateVote checks the option indexes of a vote. An empty vote withdraws
+// the voter's earlier vote; otherwise single-choice polls take exactly one
+// option and no option may repeat.
+func (p *Poll) ValidateVote(options []int) error {
+	if len(options) > 1 && !p.MultipleChoice {
+		return fmt.Errorf("%w: this poll takes a single option", ErrInvalidPoll)
+	}
+	seen := make(map[int]bool, len(options))
+	for _, option := range options {
+		if option < 0 || option >= len(p.Options) {
+			return fmt.Errorf("%w: option %d does not exist", ErrInvalidPoll, option)
+		}
+		if seen[option] {
+			return fmt.Errorf("%w: option %d is given twice", ErrInvalidPoll, option)
+		}
+		seen[option] = true
+	}
+	return nil
+}
+
+// CreatePollRequest represents the request body for posting a poll.
+type CreatePollRequest struct {
+	ClientID       string     `json:"client_id"` // The member posting the poll
+	Question       string     `json:"question"`
+	Options        []string   `json:"options"`
+	MultipleChoice bool       `json:"multiple_choice"`
+	ClosesAt       *time.Time `json:"closes_at,omitempty"`
+}
+
+// Validate trims the question and options and checks them against the poll
+// limits. A close time must be after now.
+func (r *CreatePollRequest) Validate(now time.Time) error {
+	r.Question = strings.TrimSpace(r.Question)
+	if r.ClientID == "" || r.Question == "" {
+		return fmt.Errorf("%w: client_id and question are required", ErrInvalidPoll)
+	}
+	if len(r.Options) < MinPollOptions || len(r.Options) > MaxPollOptions {
+		return fmt.Errorf("%w: a poll needs %d to %d options", ErrInvalidPoll, MinPollOptions, MaxPollOptions)
+	}
+
+	seen := make(map[string]bool, len(r.Options))
+	for i, option := range r.Options {
+		option = strings.TrimSpace(option)
+		switch {
+		case option == "":
+			return fmt.Errorf("%w: option %d is empty", ErrInvalidPoll, i)
+		case utf8.RuneCountInString(option) > MaxPollOptionLength:
+			return fmt.Errorf("%w: option %d is longer than %d characters", ErrInvalidPoll, i, MaxPollOptionLength)
+		case seen[option]:
+			return fmt.Errorf("%w: option %q is given twice", ErrInvalidPoll, option)
+		}
+		seen[option] = true
+		r.Options[i] = option
+	}
+
+	if r.ClosesAt != nil && !r.ClosesAt.After(now) {
+		return fmt.Errorf("%w: closes_at must be in the future", ErrInvalidPoll)
+	}
+	return nil
+}
+
+// VoteRequest represents the request body for voting on a poll. Options
+// are indexes into the poll's options; an empty list withdraws the vote.
+type VoteRequest struct {
+	UserID  string `json:"user_id"`
+	Options []int  `json:"options"`
+}
+
+// PollResults reports the tallies of a poll.
+type PollResults struct {
+	Poll
+	Tallies []int  `json:"tallies"` // Votes per option, in the order of Options
+	Voters  int    `json:"voters"`  // Members who have voted
+	Closed  bool   `json:"closed"`
+	Vote    *[]int `json:"vote,omitempty"` // The requesting user's choice, when one is named and has voted
+}
@@ -0,0 +1,40 @@
+package models
+
+// Policies applied when an organization exceeds its storage quota.
+const (
+	QuotaPolicyReject = "reject" // New messages are refused until usage drops
+	QuotaPolicyTrim   = "trim"   // The oldest messages of the group being written are removed
+)
+
+// ValidQuotaPolicy reports whether policy is a known quota policy.
+func ValidQuotaPolicy(policy string) bool {
+	return policy == QuotaPolicyReject || policy == QuotaPolicyTrim
+}
+
+// OrgQuota limits the message history an organization keeps in Redis.
+// A zero limit is unlimited.
+type OrgQuota struct {
+	MaxMessages int64  `json:"max_messages"`
+	MaxBytes    int64  `json:"max_bytes"` // Approximate Redis memory of the org's history
+	Policy      string `json:"policy"`    // QuotaPolicyReject or QuotaPolicyTrim
+}
+
+// Limited reports whether the quota sets any limit.
+func (q OrgQuota) Limited() bool {
+	return q.MaxMessages > 0 || q.MaxBytes > 0
+}
+
+// Exceeded reports whether usage is at or over either limit.
+func (q OrgQuota) Exceeded(messages, bytes int64) bool {
+	return (q.MaxMessages > 0 && messages >= q.MaxMessages) || (q.MaxBytes > 0 && bytes >= q.MaxBytes)
+}
+
+// QuotaUsage reports an organization's storage against its quota.
+type QuotaUsage struct {
+	OrgID    string   `json:"org_id"`
+	Messages int64    `json:"messages"`
+	Bytes    int64    `json:"bytes"`
+	Quota    OrgQuota `json:"quota"`
+	Override bool     `json:"override"` // The quota is set for this org rather than the global default
+	Exceeded bool     `json:"exceeded"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"errors"
+	"math"
+)
+
+// ErrInvalidRateLimit is returned for a group rate limit that cannot be applied.
+var ErrInvalidRateLimit = errors.New("messages_per_second and burst must be finite and not negative")
+
+// GroupRateLimit overrides the throughput cap of one group. A rate of zero
+// removes the cap.
+type GroupRateLimit struct {
+	MessagesPerSecond float64 `json:"messages_per_second"`
+	Burst             int     `json:"burst"`
+}
+
+// Validate reports whether the limit can be applied.
+func (l GroupRateLimit) Validate() error {
+	if l.MessagesPerSecond < 0 || math.IsNaN(l.MessagesPerSecond) || math.IsInf(l.MessagesPerSecond, 0) || l.Burst < 0 {
+		return ErrInvalidRateLimit
+	}
+	return nil
+}
@@ -1,7 +1,10 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
+
+	"go-realtime-workspace/cursor"
 )
 
 // Task represents a user task in the system.
@@ -13,6 +16,7 @@ type Task struct {
 	Status      string     `json:"status" db:"status"`
 	Priority    string     `json:"priority" db:"priority"`
 	DueDate     *time.Time `json:"due_date,omitempty" db:"due_date"`
+	Position    float64    `json:"position" db:"position"` // Rank in the user's manual order; lower comes first
 	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
 	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
 	CompletedAt *time.Time `json:"completed_at,omitempty" db:"completed_at"`
@@ -26,13 +30,85 @@ type CreateTaskRequest struct {
 	DueDate     *time.Time `json:"due_date,omitempty"`
 }
 
-// UpdateTaskRequest represents the request body for updating a task.
+// UpdateTaskRequest represents the request body for updating a task. Only
+// the fields present are changed: an empty description clears it and a
+// null due_date unsets it.
 type UpdateTaskRequest struct {
-	Title       string     `json:"title,omitempty"`
-	Description string     `json:"description,omitempty"`
-	Status      string     `json:"status,omitempty"`
-	Priority    string     `json:"priority,omitempty"`
-	DueDate     *time.Time `json:"due_date,omitempty"`
+	Title       *string      `json:"title,omitempty"`
+	Description *string      `json:"description,omitempty"`
+	Status      *string      `json:"status,omitempty"`
+	Priority    *string      `json:"priority,omitempty"`
+	DueDate     OptionalTime `json:"due_date"`
+}
+
+// OptionalTime is a nullable timestamp in a partial update, telling an
+// omitted field (Set is false) apart from an explicit null (Set is true and
+// Time is nil).
+type OptionalTime struct {
+	Set  bool
+	Time *time.Time
+}
+
+// UnmarshalJSON records that the field was present and decodes it.
+func (o *OptionalTime) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	if string(data) == "null" {
+		o.Time = nil
+		return nil
+	}
+	var t time.Time
+	if err := json.Unmarshal(data, &t); err != nil {
+		return err
+	}
+	o.Time = &t
+	return nil
+}
+
+// ReorderTasksRequest represents the request body for reordering a user's
+// tasks. TaskIDs come first in the given order; the user's other tasks
+// follow in their current order.
+type ReorderTasksRequest struct {
+	TaskIDs []string `json:"task_ids"`
+}
+
+// Task list orders.
+const (
+	TaskSortNewest = "newest" // Newest first, or by relevance when searching (default)
+	TaskSortManual = "manual" // The user's manual order (see Task.Position)
+)
+
+// TaskFilter holds the optional filters and pagination for task listings.
+type TaskFilter struct {
+	Status     string     // Only tasks with this status
+	AssigneeID string     // Only tasks assigned to this user
+	Priority   string     // Only tasks with this priority
+	DueAfter   *time.Time // Only tasks due at or after this time
+	DueBefore  *time.Time // Only tasks due at or before this time
+	Search     string     // Only tasks whose title or description match these words, ranked by relevance
+	Limit      int        // Maximum number of tasks to return
+	Offset     int        // Number of tasks to skip
+
+	// After continues a listing from where a page ended, in newest-first
+	// order; it cannot be combined with Search.
+	After *cursor.Position
+}
+
+// ValidTaskStatus reports whether status is one of the task statuses.
+func ValidTaskStatus(status string) bool {
+	switch status {
+	case TaskStatusPending, TaskStatusInProgress, TaskStatusCompleted, TaskStatusCancelled:
+		return true
+	}
+	return false
+}
+
+// ValidTaskPriority reports whether priority is one of the task priorities.
+func ValidTaskPriority(priority string) bool {
+	switch priority {
+	case TaskPriorityLow, TaskPriorityMedium, TaskPriorityHigh, TaskPriorityUrgent:
+		return true
+	}
+	return false
 }
 
 // TaskStatus constants
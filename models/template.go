@@ -0,0 +1,124 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Errors returned when a template or its rendering is rejected.
+var (
+	ErrInvalidTemplate  = errors.New("invalid template")
+	ErrMissingVariables = errors.New("missing template variables")
+)
+
+// templateKeyPattern is the charset and length allowed for template keys and
+// variable names.
+var templateKeyPattern = regexp.MustCompile(`^[a-z0-9_-]{1,50}$`)
+
+// templatePlaceholder matches a {{variable}} placeholder in a template body.
+var templatePlaceholder = regexp.MustCompile(`\{\{\s*([a-z0-9_-]+)\s*\}\}`)
+
+// TemplateVariable declares a placeholder a template body may use. A
+// required variable without a default must be supplied when rendering;
+// other missing variables render as their default or as nothing.
+type TemplateVariable struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Default     string `json:"default,omitempty"`
+	Required    bool   `json:"required"`
+}
+
+// MessageTemplate is a reusable canned message of an organization. Its
+// body refers to variables as {{name}}.
+type MessageTemplate struct {
+	ID        string             `json:"id"`
+	OrgID     string             `json:"org_id"`
+	Key       string             `json:"key"`
+	Title     string             `json:"title"`
+	Body      string             `json:"body"`
+	Variables []TemplateVariable `json:"variables"`
+	CreatedBy string             `json:"created_by,omitempty"`
+	CreatedAt time.Time          `json:"created_at"`
+	UpdatedAt time.Time          `json:"updated_at"`
+}
+
+// SaveTemplateRequest represents the request body for creating or replacing
+// a template. Key is taken from the path when a template is replaced.
+type SaveTemplateRequest struct {
+	Key       string             `json:"key"`
+	Title     string             `json:"title"`
+	Body      string             `json:"body"`
+	Variables []TemplateVariable `json:"variables"`
+}
+
+// Validate checks a template before it is stored: the key and variable
+// names must be 1-50 lowercase letters, digits, underscores or hyphens,
+// variable names must be unique, and every placeholder in the body must be
+// a declared variable. Errors wrap ErrInvalidTemplate.
+func (req *SaveTemplateRequest) Validate() error {
+	if !templateKeyPattern.MatchString(req.Key) {
+		return fmt.Errorf("%w: key must be 1-50 lowercase letters, digits, underscores or hyphens", ErrInvalidTemplate)
+	}
+	if strings.TrimSpace(req.Title) == "" || strings.TrimSpace(req.Body) == "" {
+		return fmt.Errorf("%w: title and body are required", ErrInvalidTemplate)
+	}
+
+	declared := make(map[string]bool, len(req.Variables))
+	for _, v := range req.Variables {
+		if !templateKeyPattern.MatchString(v.Name) {
+			return fmt.Errorf("%w: variable name %q must be 1-50 lowercase letters, digits, underscores or hyphens", ErrInvalidTemplate, v.Name)
+		}
+		if declared[v.Name] {
+			return fmt.Errorf("%w: variable %q is declared twice", ErrInvalidTemplate, v.Name)
+		}
+		declared[v.Name] = true
+	}
+	for _, match := range templatePlaceholder.FindAllStringSubmatch(req.Body, -1) {
+		if !declared[match[1]] {
+			return fmt.Errorf("%w: body uses undeclared variable %q", ErrInvalidTemplate, match[1])
+		}
+	}
+	return nil
+}
+
+// Render replaces the template's placeholders with values, falling back to
+// each variable's default. It returns an error wrapping ErrMissingVariables,
+// naming every required variable that has neither a value nor a default.
+func (t *MessageTemplate) Render(values map[string]string) (string, error) {
+	resolved := make(map[string]string, len(t.Variables))
+	var missing []string
+	for _, v := range t.Variables {
+		value, ok := values[v.Name]
+		if !ok || value == "" {
+			value = v.Default
+		}
+		if value == "" && v.Required {
+			missing = append(missing, v.Name)
+		}
+		resolved[v.Name] = value
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return "", fmt.Errorf("%w: %s", ErrMissingVariables, strings.Join(missing, ", "))
+	}
+
+	return templatePlaceholder.ReplaceAllStringFunc(t.Body, func(placeholder string) string {
+		name := templatePlaceholder.FindStringSubmatch(placeholder)[1]
+		return resolved[name]
+	}), nil
+}
+
+// SendTemplateRequest represents the request body for sending a message
+// rendered from a template, either to GroupID or as a direct message to
+// RecipientID.
+type SendTemplateRequest struct {
+	TemplateKey string            `json:"template_key"`
+	ClientID    string            `json:"client_id,omitempty"` // The sender; empty sends as the system bot
+	GroupID     string            `json:"group_id,omitempty"`
+	RecipientID string            `json:"recipient_id,omitempty"`
+	Variables   map[string]string `json:"variables"`
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// refundTemplate has a required variable, a required variable with a
+// default, and an optional one.
+var refundTemplate = MessageTemplate{
+	Body: "Hi {{name}}, your refund of {{ amount }} is on its way.{{note}} {{signature}}",
+	Variables: []TemplateVariable{
+		{Name: "name", Required: true},
+		{Name: "amount", Required: true},
+		{Name: "note"},
+		{Name: "signature", Default: "- Support", Required: true},
+	},
+}
+
+func TestRenderTemplate(t *testing.T) {
+	got, err := refundTemplate.Render(map[string]string{"name": "Jane", "amount": "$20"})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if want := "Hi Jane, your refund of $20 is on its way. - Support"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRenderTemplateMissingVariables(t *testing.T) {
+	_, err := refundTemplate.Render(map[string]string{"amount": "", "note": "x"})
+	if !errors.Is(err, ErrMissingVariables) {
+		t.Fatalf("got %v, want ErrMissingVariables", err)
+	}
+	if !strings.HasSuffix(err.Error(), ": amount, name") {
+		t.Errorf("error %q does not name exactly the missing variables", err)
+	}
+}
+
+func TestValidateTemplate(t *testing.T) {
+	tests := []struct {
+		name string
+		req  SaveTemplateRequest
+		ok   bool
+	}{
+		{name: "valid", req: SaveTemplateRequest{Key: "refund", Title: "Refund", Body: "Hi {{name}}", Variables: []TemplateVariable{{Name: "name"}}}, ok: true},
+		{name: "bad key", req: SaveTemplateRequest{Key: "Refund!", Title: "Refund", Body: "Hi"}},
+		{name: "no body", req: SaveTemplateRequest{Key: "refund", Title: "Refund", Body: " "}},
+		{name: "undeclared variable", req: SaveTemplateRequest{Key: "refund", Title: "Refund", Body: "Hi {{name}}"}},
+		{name: "duplicate variable", req: SaveTemplateRequest{Key: "refund", Title: "Refund", Body: "Hi", Variables: []TemplateVariable{{Name: "a"}, {Name: "a"}}}},
+	}
+	for _, tt := range tests {
+		err := tt.req.Validate()
+		if (err == nil) != tt.ok || (err != nil && !errors.Is(err, ErrInvalidTemplate)) {
+			t.Errorf("%s: got %v", tt.name, err)
+		}
+	}
+}
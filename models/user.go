@@ -2,31 +2,95 @@
 package models
 
 import (
+	"regexp"
 	"time"
 )
 
+// usernamePattern is the charset and length allowed for generated usernames.
+var usernamePattern = regexp.MustCompile(`^[a-z0-9._-]{3,100}$`)
+
+// ValidUsername reports whether name satisfies the username charset rules:
+// 3-100 lowercase letters, digits, dots, underscores or hyphens.
+func ValidUsername(name string) bool {
+	return usernamePattern.MatchString(name)
+}
+
 // User represents a user in the system.
 type User struct {
 	ID        string    `json:"id" db:"id"`
 	Username  string    `json:"username" db:"username"`
 	Email     string    `json:"email" db:"email"`
 	FullName  string    `json:"full_name" db:"full_name"`
+	AvatarURL string    `json:"avatar_url" db:"avatar_url"`
+	Bio       string    `json:"bio" db:"bio"`
 	OrgID     string    `json:"org_id" db:"org_id"`
+	Role      string    `json:"role" db:"role"`
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// RosterMember is a user in a group roster, with their live presence.
+type RosterMember struct {
+	UserID    string `json:"user_id"`
+	Username  string `json:"username"`
+	FullName  string `json:"full_name"`
+	AvatarURL string `json:"avatar_url,omitempty"`
+	Role      string `json:"role"`
+	Online    bool   `json:"online"`
+	Status    string `json:"status,omitempty"` // Presence status, while online
+	Connected bool   `json:"connected"`        // Has a WebSocket open to this group
+}
+
+// Organization roles, from most to least privileged.
+const (
+	RoleOwner   = "owner"
+	RoleAdmin   = "admin"
+	RoleManager = "manager"
+	RoleMember  = "member"
+)
+
+// ValidRole reports whether role is one of the organization roles.
+func ValidRole(role string) bool {
+	switch role {
+	case RoleOwner, RoleAdmin, RoleManager, RoleMember:
+		return true
+	}
+	return false
+}
+
 // CreateUserRequest represents the request body for creating a user.
 type CreateUserRequest struct {
-	Username string `json:"username"`
-	Email    string `json:"email"`
-	FullName string `json:"full_name"`
-	OrgID    string `json:"org_id"`
+	Username  string `json:"username"`
+	Email     string `json:"email"`
+	FullName  string `json:"full_name"`
+	AvatarURL string `json:"avatar_url,omitempty"` // An http or https image URL
+	Bio       string `json:"bio,omitempty"`
+	OrgID     string `json:"org_id"`
+
+	// GenerateUsername derives the username from the email local-part when
+	// Username is empty, adding a numeric suffix if it is already taken.
+	GenerateUsername bool `json:"generate_username,omitempty"`
 }
 
-// UpdateUserRequest represents the request body for updating a user.
+// SetRoleRequest represents the request body for changing a user's role.
+// The user making the change is the authenticated caller, never the body.
+type SetRoleRequest struct {
+	Role string `json:"role"`
+}
+
+// UpdateUserRequest represents the request body for updating a user. Only
+// the fields present are changed; an empty full_name, avatar_url or bio
+// clears it. A user's organization and role cannot be changed this way.
 type UpdateUserRequest struct {
-	Username string `json:"username,omitempty"`
-	Email    string `json:"email,omitempty"`
-	FullName string `json:"full_name,omitempty"`
+	Username  *string `json:"username,omitempty"`
+	Email     *string `json:"email,omitempty"`
+	FullName  *string `json:"full_name,omitempty"`
+	AvatarURL *string `json:"avatar_url,omitempty"`
+	Bio       *string `json:"bio,omitempty"`
+}
+
+// UserProfile is what is shown of a user next to their messages.
+type UserProfile struct {
+	Username  string `json:"username"`
+	AvatarURL string `json:"avatar_url,omitempty"`
 }
@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-realtime-workspace/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Fields of a message's ack hash. The hash exists only for messages sent
+// with ack_required; per-user fields hold Unix milliseconds.
+const (
+	ackRequiredField = "required"
+	ackDeliveredPre  = "d:" // Followed by the user ID
+	ackAckedPre      = "a:" // Followed by the user ID
+)
+
+// recordDeliveriesScript marks a message as delivered to the users in ARGV
+// after the first, keeping the time of the first delivery. ARGV[1] is the
+// delivery time. Messages without ack tracking are left alone.
+var recordDeliveriesScript = redis.NewScript(`
+if redis.call("HEXISTS", KEYS[1], "required") == 0 then
+	return 0
+end
+for i = 2, #ARGV do
+	redis.call("HSETNX", KEYS[1], "d:" .. ARGV[i], ARGV[1])
+end
+return 1
+`)
+
+// ackScript records a user's acknowledgement of a message, keeping the
+// first one. A user who read the message from history rather than live is
+// counted as delivered at the same time. Returns 0 if the message does not
+// require acknowledgement.
+var ackScript = redis.NewScript(`
+if redis.call("HEXISTS", KEYS[1], "required") == 0 then
+	return 0
+end
+redis.call("HSETNX", KEYS[1], "d:" .. ARGV[1], ARGV[2])
+redis.call("HSETNX", KEYS[1], "a:" .. ARGV[1], ARGV[2])
+return 1
+`)
+
+// trackAcks starts ack tracking for a message sent with ack_required as
+// part of pipe. The state expires with the message history.
+func (r *MessageRepository) trackAcks(ctx context.Context, pipe redis.Pipeliner, msg models.ChatMessage) {
+	key := acksKey(msg.OrgID, msg.GroupID, msg.ID)
+	pipe.HSet(ctx, key, ackRequiredField, msg.Timestamp.UnixMilli())
+	pipe.Expire(ctx, key, r.cfg.MessageTTL)
+}
+
+// RecordDeliveries notes that a message requiring acknowledgement was
+// delivered to the given users. Messages without ack tracking are ignored.
+func (r *MessageRepository) RecordDeliveries(ctx context.Context, orgID, groupID, messageID string, userIDs []string, at time.Time) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	args := make([]interface{}, 0, len(userIDs)+1)
+	args = append(args, at.UnixMilli())
+	for _, id := range userIDs {
+		args = append(args, id)
+	}
+	if err := recordDeliveriesScript.Run(ctx, r.client, []string{acksKey(orgID, groupID, messageID)}, args...).Err(); err != nil {
+		return fmt.Errorf("error recording deliveries: %w", err)
+	}
+	return nil
+}
+
+// Ack records that a user acknowledged a message. It reports false if the
+// message does not require acknowledgement, or is no longer stored.
+// Acknowledging twice keeps the first time.
+func (r *MessageRepository) Ack(ctx context.Context, orgID, groupID, messageID, userID string, at time.Time) (bool, error) {
+	result, err := ackScript.Run(ctx, r.client, []string{acksKey(orgID, groupID, messageID)}, userID, at.UnixMilli()).Int()
+	if err != nil {
+		return false, fmt.Errorf("error recording acknowledgement: %w", err)
+	}
+	return result == 1, nil
+}
+
+// GetAcks returns who a message requiring acknowledgement was delivered to
+// and who acknowledged it. It returns ErrMessageNotFound if the message
+// does not require acknowledgement or its ack state has expired.
+func (r *MessageRepository) GetAcks(ctx context.Context, orgID, groupID, messageID string) (*models.MessageAcks, error) {
+	fields, err := r.client.HGetAll(ctx, acksKey(orgID, groupID, messageID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error getting acknowledgements: %w", err)
+	}
+	if _, ok := fields[ackRequiredField]; !ok {
+		return nil, ErrMessageNotFound
+	}
+
+	users := make(map[string]*models.MessageAck)
+	user := func(id string) *models.MessageAck {
+		if users[id] == nil {
+			users[id] = &models.MessageAck{UserID: id}
+		}
+		return users[id]
+	}
+	for field, value := range fields {
+		ms, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		at := time.UnixMilli(ms).UTC()
+		switch {
+		case strings.HasPrefix(field, ackDeliveredPre):
+			user(strings.TrimPrefix(field, ackDeliveredPre)).DeliveredAt = &at
+		case strings.HasPrefix(field, ackAckedPre):
+			user(strings.TrimPrefix(field, ackAckedPre)).AckedAt = &at
+		}
+	}
+
+	acks := &models.MessageAcks{
+		MessageID: messageID,
+		Acked:     []models.MessageAck{},
+		Pending:   []models.MessageAck{},
+	}
+	for _, ack := range users {
+		if ack.AckedAt != nil {
+			acks.Acked = append(acks.Acked, *ack)
+		} else {
+			acks.Pending = append(acks.Pending, *ack)
+		}
+	}
+	sort.Slice(acks.Acked, func(i, j int) bool { return acks.Acked[i].AckedAt.Before(*acks.Acked[j].AckedAt) })
+	sort.Slice(acks.Pending, func(i, j int) bool { return acks.Pending[i].UserID < acks.Pending[j].UserID })
+	return acks, nil
+}
+
+// acksKey returns the hash key holding a message's delivery and ack state.
+func acksKey(orgID, groupID, messageID string) string {
+	return fmt.Sprintf("acks:%s:%s:%s", orgID, groupID, messageID)
+}
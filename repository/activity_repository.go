@@ -0,0 +1,158 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go-realtime-workspace/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ActivityRetention is how long hourly activity counters are kept, and so
+// the longest window an activity timeline can cover.
+const ActivityRetention = 7 * 24 * time.Hour
+
+// recordActivity increments an organization's counter for the hour of at.
+func recordActivity(ctx context.Context, pipe redis.Pipeliner, orgID, counter string, at time.Time) {
+	key := activityKey(orgID, at)
+	pipe.HIncrBy(ctx, key, counter, 1)
+	pipe.Expire(ctx, key, ActivityRetention+time.Hour)
+}
+
+// RecordActivity increments an organization's counter (one of the
+// models.Activity* names) for the current hour.
+func (r *MessageRepository) RecordActivity(ctx context.Context, orgID, counter string) error {
+	pipe := r.client.Pipeline()
+	recordActivity(ctx, pipe, orgID, counter, r.clock.Now())
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("error recording activity: %w", err)
+	}
+	return nil
+}
+
+// ActivityRepository builds organization activity timelines from the hourly
+// counters in Redis and from the audit log and tasks in PostgreSQL.
+type ActivityRepository struct {
+	db    *sql.DB
+	redis redis.UniversalClient
+}
+
+// NewActivityRepository creates a new activity repository.
+func NewActivityRepository(db *sql.DB, redisClient redis.UniversalClient) *ActivityRepository {
+	return &ActivityRepository{db: db, redis: redisClient}
+}
+
+// Timeline returns consecutive buckets covering window and ending with the
+// bucket that contains end, oldest first. bucket must be a whole number of
+// hours, since the Redis counters are hourly, and window must not exceed
+// ActivityRetention.
+func (r *ActivityRepository) Timeline(ctx context.Context, orgID string, end time.Time, window, bucket time.Duration) ([]models.ActivityBucket, error) {
+	if bucket < time.Hour || bucket%time.Hour != 0 {
+		return nil, fmt.Errorf("bucket must be a whole number of hours")
+	}
+	if window < bucket || window > ActivityRetention {
+		return nil, fmt.Errorf("window must be between the bucket size and %s", ActivityRetention)
+	}
+
+	// Buckets are aligned to the Unix epoch, like the SQL grouping below
+	seconds := int64(bucket / time.Second)
+	count := int((window + bucket - 1) / bucket)
+	first := time.Unix(end.Unix()/seconds*seconds, 0).Add(-time.Duration(count-1) * bucket)
+	buckets := make([]models.ActivityBucket, count)
+	for i := range buckets {
+		buckets[i].Start = first.Add(time.Duration(i) * bucket).UTC()
+	}
+	index := func(t time.Time) int {
+		if t.Before(first) {
+			return -1
+		}
+		i := int(t.Sub(first) / bucket)
+		if i >= count {
+			return -1
+		}
+		return i
+	}
+
+	// Message and connection counters, one hash per hour
+	pipe := r.redis.Pipeline()
+	hours := make(map[time.Time]*redis.MapStringStringCmd)
+	for hour := first; hour.Before(first.Add(time.Duration(count) * bucket)); hour = hour.Add(time.Hour) {
+		hours[hour] = pipe.HGetAll(ctx, activityKey(orgID, hour))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("error getting activity counters: %w", err)
+	}
+	for hour, cmd := range hours {
+		i := index(hour)
+		if i < 0 {
+			continue
+		}
+		counters := cmd.Val()
+		buckets[i].Messages += parseCounter(counters[models.ActivityMessages])
+		buckets[i].Joins += parseCounter(counters[models.ActivityJoins])
+		buckets[i].Leaves += parseCounter(counters[models.ActivityLeaves])
+	}
+
+	// Audit log entries and task completions, grouped by bucket in the database
+	queries := []struct {
+		sql string
+		add func(b *models.ActivityBucket, n int64)
+	}{
+		{
+			sql: `
+				SELECT floor(extract(epoch FROM created_at) / $2)::bigint, count(*)
+				FROM audit_log
+				WHERE org_id = $1 AND created_at >= $3
+				GROUP BY 1
+			`,
+			add: func(b *models.ActivityBucket, n int64) { b.AuditEvents += n },
+		},
+		{
+			sql: `
+				SELECT floor(extract(epoch FROM t.completed_at) / $2)::bigint, count(*)
+				FROM tasks t JOIN users u ON u.id = t.user_id
+				WHERE u.org_id = $1 AND t.completed_at >= $3
+				GROUP BY 1
+			`,
+			add: func(b *models.ActivityBucket, n int64) { b.TasksCompleted += n },
+		},
+	}
+	for _, q := range queries {
+		rows, err := r.db.QueryContext(ctx, q.sql, orgID, seconds, first)
+		if err != nil {
+			return nil, fmt.Errorf("error getting activity: %w", err)
+		}
+		for rows.Next() {
+			var slot, n int64
+			if err := rows.Scan(&slot, &n); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("error scanning activity: %w", err)
+			}
+			if i := index(time.Unix(slot*seconds, 0)); i >= 0 {
+				q.add(&buckets[i], n)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("error getting activity: %w", err)
+		}
+	}
+
+	return buckets, nil
+}
+
+// parseCounter parses a Redis counter value, treating missing values as zero.
+func parseCounter(value string) int64 {
+	n, _ := strconv.ParseInt(value, 10, 64)
+	return n
+}
+
+// activityKey returns the hash key holding an organization's counters for
+// the hour containing at.
+func activityKey(orgID string, at time.Time) string {
+	return fmt.Sprintf("activity:%s:%d", orgID, at.Unix()/3600*3600)
+}
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go-realtime-workspace/clock"
+	"go-realtime-workspace/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestTimelineBuckets(t *testing.T) {
+	repo, srv := newTestMessageRepository(t, nil)
+	ctx := context.Background()
+	midnight := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(hours, minutes int) time.Time {
+		return midnight.Add(time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute)
+	}
+
+	// Two 2h buckets ending at 05:30 start at 02:00 and 04:00
+	for i, sent := range []time.Time{at(1, 30), at(2, 10), at(3, 50), at(5, 0)} {
+		msg := models.ChatMessage{ID: string(rune('a' + i)), OrgID: "acme", GroupID: "general", ClientID: "alice", Content: "hi", Timestamp: sent}
+		if _, err := repo.Save(ctx, msg); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+	fake := clock.NewFake(at(4, 15))
+	repo.SetClock(fake)
+	for _, counter := range []string{models.ActivityJoins, models.ActivityJoins, models.ActivityLeaves} {
+		if err := repo.RecordActivity(ctx, "acme", counter); err != nil {
+			t.Fatalf("RecordActivity: %v", err)
+		}
+	}
+	// Another org's activity is not counted
+	if err := repo.RecordActivity(ctx, "globex", models.ActivityJoins); err != nil {
+		t.Fatalf("RecordActivity: %v", err)
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+	slot := func(t time.Time) int64 { return t.Unix() / 7200 }
+	mock.ExpectQuery("FROM audit_log").WithArgs("acme", int64(7200), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"slot", "count"}).
+			AddRow(slot(at(0, 0)), 9). // Before the window
+			AddRow(slot(at(2, 0)), 3).
+			AddRow(slot(at(4, 0)), 1))
+	mock.ExpectQuery("FROM tasks").WithArgs("acme", int64(7200), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"slot", "count"}).AddRow(slot(at(4, 0)), 2))
+
+	client := redis.NewClient(&redis.Options{Addr: srv.Addr()})
+	defer client.Close()
+	activity := NewActivityRepository(db, client)
+	buckets, err := activity.Timeline(ctx, "acme", at(5, 30), 4*time.Hour, 2*time.Hour)
+	if err != nil {
+		t.Fatalf("Timeline: %v", err)
+	}
+
+	want := []models.ActivityBucket{
+		{Start: at(2, 0), Messages: 2, AuditEvents: 3},
+		{Start: at(4, 0), Messages: 1, Joins: 2, Leaves: 1, AuditEvents: 1, TasksCompleted: 2},
+	}
+	if len(buckets) != len(want) {
+		t.Fatalf("got %d buckets, want %d", len(buckets), len(want))
+	}
+	for i := range want {
+		if buckets[i] != want[i] {
+			t.Errorf("bucket %d: %+v, want %+v", i, buckets[i], want[i])
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTimelineRejectsBadBuckets(t *testing.T) {
+	activity := NewActivityRepository(nil, nil)
+	end := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, tt := range []struct{ window, bucket time.Duration }{
+		{24 * time.Hour, 30 * time.Minute},
+		{24 * time.Hour, 90 * time.Minute},
+		{time.Hour, 2 * time.Hour},
+		{ActivityRetention + time.Hour, time.Hour},
+	} {
+		if _, err := activity.Timeline(context.Background(), "acme", end, tt.window, tt.bucket); err == nil {
+			t.Errorf("window %s with %s buckets accepted", tt.window, tt.bucket)
+		}
+	}
+}
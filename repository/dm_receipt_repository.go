@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go-realtime-workspace/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RecordDMDelivery notes that direct messages of a DM room reached their
+// recipient, keeping the time of the first delivery of each.
+func (r *MessageRepository) RecordDMDelivery(ctx context.Context, roomID string, messageIDs []string, at time.Time) error {
+	if len(messageIDs) == 0 {
+		return nil
+	}
+
+	key := dmDeliveredKey(roomID)
+	pipe := r.client.TxPipeline()
+	for _, id := range messageIDs {
+		pipe.HSetNX(ctx, key, id, at.UnixMilli())
+	}
+	pipe.Expire(ctx, key, r.cfg.MessageTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("error recording DM delivery: %w", err)
+	}
+	return nil
+}
+
+// AttachDMReceipts fills in the delivery state of the direct messages of a
+// DM room. A message is read once its recipient's read marker for the room
+// has passed it, which also counts as delivered when no delivery was
+// recorded, e.g. for a message read on another device.
+func (r *MessageRepository) AttachDMReceipts(ctx context.Context, roomID string, messages []models.ChatMessage) error {
+	var ids []string
+	recipients := make(map[string]bool)
+	for _, msg := range messages {
+		if msg.RecipientID == "" || msg.ID == "" {
+			continue
+		}
+		ids = append(ids, msg.ID)
+		recipients[msg.RecipientID] = true
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	pipe := r.client.Pipeline()
+	deliveredCmd := pipe.HMGet(ctx, dmDeliveredKey(roomID), ids...)
+	markerCmds := make(map[string]*redis.StringCmd, len(recipients))
+	for userID := range recipients {
+		markerCmds[userID] = pipe.HGet(ctx, readMarkersKey(userID), markerField(DMOrgID, roomID))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return fmt.Errorf("error getting DM receipts: %w", err)
+	}
+
+	delivered := make(map[string]time.Time, len(ids))
+	for i, value := range deliveredCmd.Val() {
+		s, ok := value.(string)
+		if !ok {
+			continue
+		}
+		if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+			delivered[ids[i]] = time.UnixMilli(ms).UTC()
+		}
+	}
+	markers := make(map[string]float64, len(markerCmds))
+	for userID, cmd := range markerCmds {
+		if marker, err := cmd.Float64(); err == nil {
+			markers[userID] = marker
+		}
+	}
+
+	for i := range messages {
+		msg := &messages[i]
+		if msg.RecipientID == "" || msg.ID == "" {
+			continue
+		}
+
+		msg.DeliveryState = models.DeliverySent
+		if at, ok := delivered[msg.ID]; ok {
+			msg.DeliveredAt = &at
+			msg.DeliveryState = models.DeliveryDelivered
+		}
+		if marker, ok := markers[msg.RecipientID]; ok && score(msg.Timestamp) <= marker {
+			msg.DeliveryState = models.DeliveryRead
+		}
+	}
+	return nil
+}
+
+// dmDeliveredKey returns the hash of when each direct message of a DM room
+// was delivered, in Unix milliseconds.
+func dmDeliveredKey(roomID string) string {
+	return fmt.Sprintf("dm_delivered:%s", roomID)
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go-realtime-workspace/models"
+)
+
+func TestDMReceipts(t *testing.T) {
+	repo, _ := newTestMessageRepository(t, nil)
+	ctx := context.Background()
+	sent := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i, id := range []string{"d1", "d2"} {
+		msg := models.ChatMessage{
+			ID: id, OrgID: DMOrgID, GroupID: "alice_bob", ClientID: "alice", RecipientID: "bob",
+			Content: "psst", Timestamp: sent.Add(time.Duration(i) * time.Minute),
+		}
+		if _, err := repo.Save(ctx, msg); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+	states := func() map[string]models.ChatMessage {
+		t.Helper()
+		messages, err := repo.GetHistory(ctx, DMOrgID, "alice_bob", 10)
+		if err != nil {
+			t.Fatalf("GetHistory: %v", err)
+		}
+		if err := repo.AttachDMReceipts(ctx, "alice_bob", messages); err != nil {
+			t.Fatalf("AttachDMReceipts: %v", err)
+		}
+		byID := make(map[string]models.ChatMessage, len(messages))
+		for _, msg := range messages {
+			byID[msg.ID] = msg
+		}
+		return byID
+	}
+
+	for id, msg := range states() {
+		if msg.DeliveryState != models.DeliverySent || msg.DeliveredAt != nil {
+			t.Errorf("%s before delivery: %s at %v, want sent", id, msg.DeliveryState, msg.DeliveredAt)
+		}
+	}
+
+	// Only the first delivery time is kept
+	delivered := sent.Add(time.Hour)
+	if err := repo.RecordDMDelivery(ctx, "alice_bob", []string{"d1", "d2"}, delivered); err != nil {
+		t.Fatalf("RecordDMDelivery: %v", err)
+	}
+	if err := repo.RecordDMDelivery(ctx, "alice_bob", []string{"d1"}, delivered.Add(time.Hour)); err != nil {
+		t.Fatalf("RecordDMDelivery: %v", err)
+	}
+	for id, msg := range states() {
+		if msg.DeliveryState != models.DeliveryDelivered || msg.DeliveredAt == nil || !msg.DeliveredAt.Equal(delivered) {
+			t.Errorf("%s after delivery: %s at %v, want delivered at %v", id, msg.DeliveryState, msg.DeliveredAt, delivered)
+		}
+	}
+
+	// Bob's read marker passes d1 only
+	if err := repo.MarkRead(ctx, "bob", DMOrgID, "alice_bob", sent); err != nil {
+		t.Fatalf("MarkRead: %v", err)
+	}
+	got := states()
+	if got["d1"].DeliveryState != models.DeliveryRead {
+		t.Errorf("d1 after reading: %s, want read", got["d1"].DeliveryState)
+	}
+	if got["d2"].DeliveryState != models.DeliveryDelivered {
+		t.Errorf("d2 after reading: %s, want delivered", got["d2"].DeliveryState)
+	}
+}
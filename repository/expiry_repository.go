@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go-realtime-workspace/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// expiryKey is the sorted set of messages with a per-message expiry,
+// scored by the time they expire.
+const expiryKey = "message_expiry"
+
+// scheduleExpiry queues msg for removal at msg.ExpiresAt as part of pipe.
+func (r *MessageRepository) scheduleExpiry(ctx context.Context, pipe redis.Pipeliner, msg models.ChatMessage) error {
+	ref, err := json.Marshal(messageRef{OrgID: msg.OrgID, GroupID: msg.GroupID, ID: msg.ID})
+	if err != nil {
+		return fmt.Errorf("error marshaling expiry: %w", err)
+	}
+	pipe.ZAdd(ctx, expiryKey, redis.Z{
+		Score:  score(*msg.ExpiresAt),
+		Member: ref,
+	})
+	return nil
+}
+
+// DeleteExpired removes every message whose expiry is at or before now and
+// returns the removed messages. Each scheduled entry is claimed before the
+// message is deleted, so concurrent callers never remove the same message twice.
+func (r *MessageRepository) DeleteExpired(ctx context.Context, now time.Time) ([]models.ChatMessage, error) {
+	refs, err := r.client.ZRangeByScore(ctx, expiryKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: scoreArg(now),
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error getting expired messages: %w", err)
+	}
+
+	var deleted []models.ChatMessage
+	for _, data := range refs {
+		claimed, err := r.client.ZRem(ctx, expiryKey, data).Result()
+		if err != nil {
+			return deleted, fmt.Errorf("error claiming expired message: %w", err)
+		}
+		if claimed == 0 {
+			continue
+		}
+
+		var ref messageRef
+		if err := json.Unmarshal([]byte(data), &ref); err != nil {
+			continue
+		}
+
+		msg, err := r.getStored(ctx, ref.OrgID, ref.GroupID, ref.ID)
+		if err != nil {
+			// Already trimmed, expired with the group TTL, or deleted
+			continue
+		}
+		if err := r.Delete(ctx, ref.OrgID, ref.GroupID, ref.ID); err != nil {
+			continue
+		}
+		deleted = append(deleted, *msg)
+	}
+
+	return deleted, nil
+}
+
+// getStored reads a message from the ID index without the expiry filtering
+// applied by GetByID.
+func (r *MessageRepository) getStored(ctx context.Context, orgID, groupID, id string) (*models.ChatMessage, error) {
+	member, err := r.client.HGet(ctx, indexKey(orgID, groupID), id).Result()
+	if err == redis.Nil {
+		return nil, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting message: %w", err)
+	}
+
+	var msg models.ChatMessage
+	if err := unmarshalMessage(member, &msg); err != nil {
+		return nil, fmt.Errorf("error unmarshaling message: %w", err)
+	}
+	return &msg, nil
+}
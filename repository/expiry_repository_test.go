@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go-realtime-workspace/clock"
+	"go-realtime-workspace/models"
+)
+
+func TestDisappearingMessageIsDeleted(t *testing.T) {
+	repo, _ := newTestMessageRepository(t, nil)
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(start)
+	repo.SetClock(clk)
+	ctx := context.Background()
+
+	expiresAt := start.Add(time.Second)
+	for _, msg := range []models.ChatMessage{
+		{ID: "kept", Content: "stays"},
+		{ID: "gone", Content: "disappears", ExpiresAt: &expiresAt},
+	} {
+		msg.OrgID, msg.GroupID, msg.ClientID, msg.Timestamp = "acme", "general", "alice", start
+		if _, err := repo.Save(ctx, msg); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+
+	if deleted, err := repo.DeleteExpired(ctx, clk.Now()); err != nil || len(deleted) != 0 {
+		t.Fatalf("before the expiry: deleted %v (%v), want nothing", deleted, err)
+	}
+	if history, _ := repo.GetHistory(ctx, "acme", "general", 10); len(history) != 2 {
+		t.Fatalf("before the expiry: history holds %d messages, want 2", len(history))
+	}
+
+	clk.Advance(2 * time.Second)
+
+	// Reads hide the message even before the janitor runs
+	history, err := repo.GetHistory(ctx, "acme", "general", 10)
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	if len(history) != 1 || history[0].ID != "kept" {
+		t.Errorf("after the expiry: history %+v, want only kept", history)
+	}
+
+	deleted, err := repo.DeleteExpired(ctx, clk.Now())
+	if err != nil {
+		t.Fatalf("DeleteExpired: %v", err)
+	}
+	if len(deleted) != 1 || deleted[0].ID != "gone" {
+		t.Fatalf("deleted %+v, want gone", deleted)
+	}
+	if _, err := repo.getStored(ctx, "acme", "general", "gone"); !errors.Is(err, ErrMessageNotFound) {
+		t.Errorf("expired message still stored: %v", err)
+	}
+	if n, _ := repo.Count(ctx, "acme", "general"); n != 1 {
+		t.Errorf("group holds %d messages, want 1", n)
+	}
+
+	// Each expiry is handled once
+	if deleted, _ := repo.DeleteExpired(ctx, clk.Now()); len(deleted) != 0 {
+		t.Errorf("second sweep deleted %+v", deleted)
+	}
+}
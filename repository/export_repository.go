@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"go-realtime-workspace/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ForEachMessageBy calls fn for every stored message authored by clientID
+// across all groups and DM rooms. Keys are visited with SCAN and messages
+// are loaded one key at a time, so memory use is bounded by the largest
+// group history. Org-wide announcements are visited once, not once per group.
+func (r *MessageRepository) ForEachMessageBy(ctx context.Context, clientID string, fn func(models.ChatMessage) error) error {
+	if err := r.scanKeys(ctx, "messages:*", func(key string) error {
+		results, err := r.client.ZRange(ctx, key, 0, -1).Result()
+		if err != nil {
+			return fmt.Errorf("error reading messages: %w", err)
+		}
+		return forEachAuthored(results, clientID, fn)
+	}); err != nil {
+		return err
+	}
+
+	return r.scanKeys(ctx, "announcements:*", func(key string) error {
+		results, err := r.client.HVals(ctx, key).Result()
+		if err != nil {
+			return fmt.Errorf("error reading announcements: %w", err)
+		}
+		return forEachAuthored(results, clientID, fn)
+	})
+}
+
+// forEachAuthored decodes raw messages and calls fn for those sent by
+// clientID. Announcement pointers carry no author and are skipped.
+func forEachAuthored(results []string, clientID string, fn func(models.ChatMessage) error) error {
+	for _, data := range results {
+		var msg models.ChatMessage
+		if err := unmarshalMessage(data, &msg); err != nil {
+			continue
+		}
+		if msg.ClientID != clientID {
+			continue
+		}
+		if err := fn(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanKeys calls fn for every key matching pattern. Under Redis Cluster
+// every master is scanned, since SCAN only covers the node it runs on.
+func (r *MessageRepository) scanKeys(ctx context.Context, pattern string, fn func(key string) error) error {
+	if cluster, ok := r.client.(*redis.ClusterClient); ok {
+		var mu sync.Mutex
+		return cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			return scanNode(ctx, node, pattern, func(key string) error {
+				mu.Lock()
+				defer mu.Unlock()
+				return fn(key)
+			})
+		})
+	}
+	return scanNode(ctx, r.client, pattern, fn)
+}
+
+// scanNode calls fn for every key matching pattern on a single node.
+func scanNode(ctx context.Context, client redis.Cmdable, pattern string, fn func(key string) error) error {
+	var cursor uint64
+	for {
+		keys, next, err := client.Scan(ctx, cursor, pattern, 100).Result()
+		if err != nil {
+			return fmt.Errorf("error scanning keys: %w", err)
+		}
+		for _, key := range keys {
+			if err := fn(key); err != nil {
+				return err
+			}
+		}
+
+		cursor = next
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"maps"
+	"sync"
+	"time"
+
+	"go-realtime-workspace/clock"
+	"go-realtime-workspace/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// FeatureRepository stores per-organization feature flags in PostgreSQL and
+// caches each org's flags in Redis. Writes delete the cached copy, so every
+// server picks up a change on its next check. With a local TTL each server
+// also keeps the flags in memory for that long, so frequent checks (such as
+// one per DM frame) do not each cost a Redis round trip; a change made
+// through another server then shows after at most the local TTL.
+type FeatureRepository struct {
+	db       *sql.DB
+	cache    redis.UniversalClient
+	cacheTTL time.Duration
+	clock    clock.Clock
+
+	mu       sync.Mutex
+	localTTL time.Duration
+	local    map[string]localFeatures
+}
+
+// localFeatures is an organization's flags and when they were read.
+type localFeatures struct {
+	flags   map[string]bool
+	fetched time.Time
+}
+
+// NewFeatureRepository creates a new feature flag repository.
+func NewFeatureRepository(db *sql.DB, cache redis.UniversalClient, cacheTTL time.Duration) *FeatureRepository {
+	return &FeatureRepository{db: db, cache: cache, cacheTTL: cacheTTL, clock: clock.Real{}, local: make(map[string]localFeatures)}
+}
+
+// SetLocalTTL sets how long flags are kept in memory (0, the default,
+// disables the in-memory cache). It must be called before the repository
+// is used.
+func (r *FeatureRepository) SetLocalTTL(ttl time.Duration) {
+	r.localTTL = ttl
+}
+
+// SetClock replaces the clock the in-memory cache is aged by. It must be
+// called before the repository is used.
+func (r *FeatureRepository) SetClock(c clock.Clock) {
+	r.clock = c
+}
+
+// Features returns every known feature flag of an organization. Flags the
+// org has never set are enabled.
+func (r *FeatureRepository) Features(ctx context.Context, orgID string) (map[string]bool, error) {
+	if flags, ok := r.cachedLocally(orgID); ok {
+		return flags, nil
+	}
+	flags, err := r.features(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	r.storeLocally(orgID, flags)
+	return flags, nil
+}
+
+// cachedLocally returns a copy of an organization's flags from memory if
+// they are younger than the local TTL.
+func (r *FeatureRepository) cachedLocally(orgID string) (map[string]bool, bool) {
+	if r.localTTL <= 0 {
+		return nil, false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry, ok := r.local[orgID]
+	if !ok || r.clock.Now().Sub(entry.fetched) >= r.localTTL {
+		return nil, false
+	}
+	return maps.Clone(entry.flags), true
+}
+
+// storeLocally keeps a copy of an organization's flags in memory.
+func (r *FeatureRepository) storeLocally(orgID string, flags map[string]bool) {
+	if r.localTTL <= 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.local[orgID] = localFeatures{flags: maps.Clone(flags), fetched: r.clock.Now()}
+}
+
+// features reads an organization's flags from Redis, or from PostgreSQL
+// when they are not cached there.
+func (r *FeatureRepository) features(ctx context.Context, orgID string) (map[string]bool, error) {
+	key := featuresKey(orgID)
+
+	cached, err := r.cache.HGetAll(ctx, key).Result()
+	if err == nil && len(cached) > 0 {
+		flags := make(map[string]bool, len(models.Features))
+		for _, feature := range models.Features {
+			flags[feature] = cached[feature] != "0"
+		}
+		return flags, nil
+	}
+
+	flags, err := r.load(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]interface{}, len(flags))
+	for feature, enabled := range flags {
+		fields[feature] = "0"
+		if enabled {
+			fields[feature] = "1"
+		}
+	}
+	pipe := r.cache.Pipeline()
+	pipe.HSet(ctx, key, fields)
+	pipe.Expire(ctx, key, r.cacheTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Error caching features for org %s: %v", orgID, err)
+	}
+
+	return flags, nil
+}
+
+// FeatureEnabled reports whether a feature is enabled for an organization.
+// If the flags cannot be read the feature is treated as enabled, so an
+// outage does not switch features off.
+func (r *FeatureRepository) FeatureEnabled(ctx context.Context, orgID, feature string) bool {
+	flags, err := r.Features(ctx, orgID)
+	if err != nil {
+		log.Printf("Error checking feature %s for org %s: %v", feature, orgID, err)
+		return true
+	}
+	enabled, known := flags[feature]
+	return enabled || !known
+}
+
+// SetFeature enables or disables a feature for an organization.
+func (r *FeatureRepository) SetFeature(ctx context.Context, orgID, feature string, enabled bool) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO org_features (org_id, feature, enabled)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (org_id, feature)
+		DO UPDATE SET enabled = EXCLUDED.enabled, updated_at = CURRENT_TIMESTAMP
+	`, orgID, feature, enabled)
+	if err != nil {
+		return fmt.Errorf("error setting feature: %w", err)
+	}
+
+	r.mu.Lock()
+	delete(r.local, orgID)
+	r.mu.Unlock()
+	if err := r.cache.Del(ctx, featuresKey(orgID)).Err(); err != nil {
+		return fmt.Errorf("error invalidating feature cache: %w", err)
+	}
+	return nil
+}
+
+// load reads an organization's flags from PostgreSQL, defaulting unset flags to enabled.
+func (r *FeatureRepository) load(ctx context.Context, orgID string) (map[string]bool, error) {
+	flags := make(map[string]bool, len(models.Features))
+	for _, feature := range models.Features {
+		flags[feature] = true
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT feature, enabled FROM org_features WHERE org_id = $1`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting features: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var feature string
+		var enabled bool
+		if err := rows.Scan(&feature, &enabled); err != nil {
+			return nil, fmt.Errorf("error scanning feature: %w", err)
+		}
+		if _, known := flags[feature]; known {
+			flags[feature] = enabled
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error getting features: %w", err)
+	}
+
+	return flags, nil
+}
+
+// featuresKey returns the hash key caching an organization's feature flags.
+func featuresKey(orgID string) string {
+	return fmt.Sprintf("org_features:%s", orgID)
+}
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go-realtime-workspace/clock"
+	"go-realtime-workspace/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestFeaturesCachedLocally(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+	srv := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: srv.Addr()})
+	defer client.Close()
+
+	clk := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	repo := NewFeatureRepository(db, client, time.Minute)
+	repo.SetLocalTTL(5 * time.Second)
+	repo.SetClock(clk)
+	ctx := context.Background()
+
+	expectLoad := func(enabled bool) {
+		mock.ExpectQuery("FROM org_features").WithArgs("acme").
+			WillReturnRows(sqlmock.NewRows([]string{"feature", "enabled"}).AddRow(models.FeatureDM, enabled))
+	}
+
+	expectLoad(true)
+	if !repo.FeatureEnabled(ctx, "acme", models.FeatureDM) {
+		t.Fatal("dm disabled, want enabled")
+	}
+
+	// Within the local TTL neither Redis nor PostgreSQL is asked
+	srv.FlushAll()
+	if !repo.FeatureEnabled(ctx, "acme", models.FeatureDM) {
+		t.Fatal("dm disabled within the local TTL, want the cached flag")
+	}
+
+	// A change through this server takes effect at once
+	mock.ExpectExec("INSERT INTO org_features").WithArgs("acme", models.FeatureDM, false).WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := repo.SetFeature(ctx, "acme", models.FeatureDM, false); err != nil {
+		t.Fatalf("SetFeature: %v", err)
+	}
+	expectLoad(false)
+	if repo.FeatureEnabled(ctx, "acme", models.FeatureDM) {
+		t.Fatal("dm enabled after it was turned off")
+	}
+
+	// Once the local copy is stale the flags are read from Redis again
+	srv.HSet(featuresKey("acme"), models.FeatureDM, "1")
+	clk.Advance(5 * time.Second)
+	if !repo.FeatureEnabled(ctx, "acme", models.FeatureDM) {
+		t.Fatal("dm disabled after the local TTL, want the flag from Redis")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
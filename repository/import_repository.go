@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"go-realtime-workspace/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrDuplicateMessage is returned by Save for a message whose ID is already
+// stored in the group, and for a batch row whose ID is already stored or
+// appears earlier in the same batch.
+var ErrDuplicateMessage = errors.New("message ID already exists")
+
+// SaveBatch stores messages in a group's history with the timestamps they
+// carry, for seeding history migrated from another system. Messages without
+// an ID get a generated one. It returns one error per message, nil for each
+// stored message; rows that fail (duplicates, oversized content) are skipped
+// and the rest are still stored. The returned error is set only when the
+// batch as a whole could not be written.
+//
+// Imported messages are placed by timestamp, so they interleave with
+// existing history, and the group is trimmed to MaxMessages as usual: an
+// import larger than the limit keeps only its newest messages, plus any
+// pinned ones. They are not
+// counted in the org's activity timeline.
+func (r *MessageRepository) SaveBatch(ctx context.Context, orgID, groupID string, msgs []models.ChatMessage) ([]error, error) {
+	rowErrs := make([]error, len(msgs))
+	idxKey := indexKey(orgID, groupID)
+
+	// Look up every supplied ID in one round trip
+	seen := make(map[string]bool)
+	exists := make([]*redis.BoolCmd, len(msgs))
+	pipe := r.client.Pipeline()
+	for i := range msgs {
+		msgs[i].OrgID = orgID
+		msgs[i].GroupID = groupID
+		if msgs[i].ID == "" {
+			msgs[i].ID = r.ids.NewID()
+			continue
+		}
+		exists[i] = pipe.HExists(ctx, idxKey, msgs[i].ID)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("error checking message IDs: %w", err)
+	}
+
+	protected, err := r.protectedMembers(ctx, orgID, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	key := groupKey(orgID, groupID)
+	pipe = r.client.Pipeline()
+	stored := 0
+	for i := range msgs {
+		msg := &msgs[i]
+		if seen[msg.ID] || (exists[i] != nil && exists[i].Val()) {
+			rowErrs[i] = ErrDuplicateMessage
+			continue
+		}
+		if err := models.ValidateContent(msg.Content, r.maxContentBytes); err != nil {
+			rowErrs[i] = err
+			continue
+		}
+		if msg.ContentType == models.ContentText {
+			msg.ContentType = ""
+		}
+		if err := models.ValidateContentType(msg.ContentType, &msg.Content, r.contentTypes); err != nil {
+			rowErrs[i] = err
+			continue
+		}
+		seen[msg.ID] = true
+		msg.Content = r.sanitize.ApplyContent(msg.Content, models.StructuredContent(msg.ContentType))
+
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling message: %w", err)
+		}
+		data, err = r.encodePayload(data)
+		if err != nil {
+			return nil, err
+		}
+
+		pipe.ZAdd(ctx, key, redis.Z{Score: score(msg.Timestamp), Member: data})
+		pipe.HSet(ctx, idxKey, msg.ID, data)
+		stored++
+	}
+	if stored == 0 {
+		return rowErrs, nil
+	}
+
+	trimmed := r.trimHistory(ctx, pipe, orgID, groupID, protected)
+	pipe.Expire(ctx, key, r.cfg.MessageTTL)
+	pipe.Expire(ctx, idxKey, r.cfg.MessageTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("error saving messages: %w", err)
+	}
+	r.dropTrimmed(ctx, orgID, groupID, trimmed, false)
+
+	return rowErrs, nil
+}
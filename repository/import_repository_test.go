@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"go-realtime-workspace/models"
+)
+
+func TestSaveBatchKeepsOriginalOrder(t *testing.T) {
+	repo, _ := newTestMessageRepository(t, nil)
+	ctx := context.Background()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	saveAt(t, repo, "acme", "general", "live", "already here", 30)
+
+	// Out of order in the batch, and one older than the existing message
+	at := func(id string, offset int) models.ChatMessage {
+		return models.ChatMessage{ID: id, ClientID: "alice", Content: id, Timestamp: start.Add(time.Duration(offset) * time.Second)}
+	}
+	batch := []models.ChatMessage{at("i3", 40), at("i1", 10), at("live", 5), at("i2", 20), at("i1", 50)}
+	rowErrs, err := repo.SaveBatch(ctx, "acme", "general", batch)
+	if err != nil {
+		t.Fatalf("SaveBatch: %v", err)
+	}
+	for i, wantDup := range []bool{false, false, true, false, true} {
+		if got := errors.Is(rowErrs[i], ErrDuplicateMessage); got != wantDup || (!wantDup && rowErrs[i] != nil) {
+			t.Errorf("row %d: error %v, duplicate want %v", i, rowErrs[i], wantDup)
+		}
+	}
+
+	history, err := repo.GetHistory(ctx, "acme", "general", 10)
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	if got, want := messageIDs(history), []string{"i3", "live", "i2", "i1"}; !slices.Equal(got, want) {
+		t.Errorf("history %v, want %v", got, want)
+	}
+	for _, msg := range history {
+		if msg.ID == "i1" && !msg.Timestamp.Equal(start.Add(10*time.Second)) {
+			t.Errorf("i1 timestamp %v, want the original", msg.Timestamp)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go-realtime-workspace/clock"
+	"go-realtime-workspace/config"
+	"go-realtime-workspace/models"
+	"time"
+)
+
+// Errors returned when an invite cannot be accepted.
+var (
+	ErrInviteNotFound = errors.New("invite not found")
+	ErrInviteUsed     = errors.New("invite has already been used")
+	ErrInviteExpired  = errors.New("invite has expired")
+)
+
+// InviteRepository handles organization invite database operations.
+type InviteRepository struct {
+	db     *sql.DB
+	limits config.UserConfig // Limits on the fields of users created by Accept
+	clock  clock.Clock
+}
+
+// NewInviteRepository creates a new invite repository.
+func NewInviteRepository(db *sql.DB, limits config.UserConfig) *InviteRepository {
+	return &InviteRepository{db: db, limits: limits, clock: clock.Real{}}
+}
+
+// SetClock replaces the clock invite expiry is computed and checked against.
+func (r *InviteRepository) SetClock(c clock.Clock) {
+	r.clock = c
+}
+
+// Create creates an invite to orgID with the given role, valid for ttl.
+// The returned invite carries the plaintext token; only its hash is stored.
+func (r *InviteRepository) Create(ctx context.Context, orgID, role string, ttl time.Duration) (*models.OrgInvite, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("error generating invite token: %w", err)
+	}
+	token := hex.EncodeToString(raw)
+
+	query := `
+		INSERT INTO org_invites (token_hash, org_id, role, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, org_id, role, created_at, expires_at
+	`
+
+	invite := &models.OrgInvite{Token: token}
+	err := r.db.QueryRowContext(
+		ctx, query,
+		hashToken(token), orgID, role, r.clock.Now().Add(ttl),
+	).Scan(
+		&invite.ID, &invite.OrgID, &invite.Role, &invite.CreatedAt, &invite.ExpiresAt,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("error creating invite: %w", err)
+	}
+
+	return invite, nil
+}
+
+// GetPending retrieves the unaccepted, unexpired invites of an organization.
+func (r *InviteRepository) GetPending(ctx context.Context, orgID string) ([]models.OrgInvite, error) {
+	query := `
+		SELECT id, org_id, role, created_at, expires_at
+		FROM org_invites
+		WHERE org_id = $1 AND accepted_at IS NULL AND expires_at > $2
+		ORDER BY created_at DESC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, orgID, r.clock.Now())
+	if err != nil {
+		return nil, fmt.Errorf("error getting invites: %w", err)
+	}
+	defer rows.Close()
+
+	invites := []models.OrgInvite{}
+	for rows.Next() {
+		var invite models.OrgInvite
+		err := rows.Scan(&invite.ID, &invite.OrgID, &invite.Role, &invite.CreatedAt, &invite.ExpiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning invite: %w", err)
+		}
+		invites = append(invites, invite)
+	}
+
+	return invites, nil
+}
+
+// Accept redeems an invite token. It links an existing user (req.UserID) or
+// creates a new one in the invite's organization with the invite's role,
+// and marks the invite used, all in one transaction so a token can only
+// ever be redeemed once. Callers must make sure req.UserID is the user
+// accepting; an unknown one fails with ErrUnknownUser. Linking the last owner of an organization fails with
+// ErrLastOwner, since invites never grant the owner role.
+func (r *InviteRepository) Accept(ctx context.Context, token string, req models.AcceptInviteRequest) (*models.User, error) {
+	if req.UserID == "" {
+		if err := normalizeUserFields(r.limits, &req.Username, &req.Email, &req.FullName); err != nil {
+			return nil, err
+		}
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var inviteID, orgID, role string
+	var expiresAt time.Time
+	var acceptedAt sql.NullTime
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, org_id, role, expires_at, accepted_at
+		FROM org_invites WHERE token_hash = $1
+		FOR UPDATE
+	`, hashToken(token)).Scan(&inviteID, &orgID, &role, &expiresAt, &acceptedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrInviteNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting invite: %w", err)
+	}
+	if acceptedAt.Valid {
+		return nil, ErrInviteUsed
+	}
+	if !r.clock.Now().Before(expiresAt) {
+		return nil, ErrInviteExpired
+	}
+
+	user := &models.User{}
+	if req.UserID != "" {
+		if err := checkOwnerLeaving(ctx, tx, req.UserID); err != nil {
+			return nil, err
+		}
+		err = tx.QueryRowContext(ctx, `
+			UPDATE users SET org_id = $1, role = $2, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $3
+			RETURNING id, username, email, full_name, avatar_url, bio, org_id, role, created_at, updated_at
+		`, orgID, role, req.UserID).Scan(
+			&user.ID, &user.Username, &user.Email, &user.FullName, &user.AvatarURL, &user.Bio,
+			&user.OrgID, &user.Role, &user.CreatedAt, &user.UpdatedAt,
+		)
+		if err == sql.ErrNoRows {
+			return nil, ErrUnknownUser
+		}
+	} else {
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO users (username, email, full_name, org_id, role)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id, username, email, full_name, avatar_url, bio, org_id, role, created_at, updated_at
+		`, req.Username, req.Email, req.FullName, orgID, role).Scan(
+			&user.ID, &user.Username, &user.Email, &user.FullName, &user.AvatarURL, &user.Bio,
+			&user.OrgID, &user.Role, &user.CreatedAt, &user.UpdatedAt,
+		)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error joining organization: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE org_invites SET accepted_at = CURRENT_TIMESTAMP, accepted_by = $1
+		WHERE id = $2
+	`, user.ID, inviteID)
+	if err != nil {
+		return nil, fmt.Errorf("error accepting invite: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error accepting invite: %w", err)
+	}
+
+	return user, nil
+}
+
+// checkOwnerLeaving returns ErrLastOwner if userID is the only owner of
+// their organization, which accepting an invite would leave without one.
+// The organization's owners stay locked until tx ends.
+func checkOwnerLeaving(ctx context.Context, tx *sql.Tx, userID string) error {
+	var orgID, role string
+	err := tx.QueryRowContext(ctx, `
+		SELECT org_id, role FROM users WHERE id = $1
+		FOR UPDATE
+	`, userID).Scan(&orgID, &role)
+	if err == sql.ErrNoRows {
+		return ErrUnknownUser
+	}
+	if err != nil {
+		return fmt.Errorf("error getting user: %w", err)
+	}
+	if role != models.RoleOwner {
+		return nil
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id FROM users WHERE org_id = $1 AND role = 'owner'
+		FOR UPDATE
+	`, orgID)
+	if err != nil {
+		return fmt.Errorf("error getting owners: %w", err)
+	}
+	defer rows.Close()
+	owners := 0
+	for rows.Next() {
+		owners++
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error getting owners: %w", err)
+	}
+	if owners <= 1 {
+		return ErrLastOwner
+	}
+	return nil
+}
+
+// hashToken returns the hex SHA-256 of an invite token, which is what is stored.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"go-realtime-workspace/clock"
+	"go-realtime-workspace/config"
+	"go-realtime-workspace/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// newMockInviteRepository returns an invite repository backed by a SQL mock.
+func newMockInviteRepository(t *testing.T) (*InviteRepository, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return NewInviteRepository(db, config.DefaultConfig().User), mock
+}
+
+// expectInvite expects Accept's invite lookup and answers it.
+func expectInvite(mock sqlmock.Sqlmock, expiresAt time.Time, acceptedAt *time.Time) {
+	mock.ExpectBegin()
+	rows := sqlmock.NewRows([]string{"id", "org_id", "role", "expires_at", "accepted_at"})
+	if acceptedAt != nil {
+		rows.AddRow("invite-1", "acme", models.RoleAdmin, expiresAt, *acceptedAt)
+	} else {
+		rows.AddRow("invite-1", "acme", models.RoleAdmin, expiresAt, nil)
+	}
+	mock.ExpectQuery("FROM org_invites WHERE token_hash").WithArgs(hashToken("token")).WillReturnRows(rows)
+}
+
+func TestAcceptInviteCreatesUser(t *testing.T) {
+	repo, mock := newMockInviteRepository(t)
+	now := time.Now()
+	expectInvite(mock, now.Add(time.Hour), nil)
+	mock.ExpectQuery("INSERT INTO users").
+		WithArgs("jane", "jane@example.com", "Jane Doe", "acme", models.RoleAdmin).
+		WillReturnRows(sqlmock.NewRows(userColumns).AddRow("jane-id", "jane", "jane@example.com", "Jane Doe", "", "", "acme", models.RoleAdmin, now, now))
+	mock.ExpectExec("UPDATE org_invites SET accepted_at").WithArgs("jane-id", "invite-1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	user, err := repo.Accept(context.Background(), "token", models.AcceptInviteRequest{
+		Username: "jane", Email: "jane@example.com", FullName: "Jane Doe",
+	})
+	if err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+	if user.OrgID != "acme" || user.Role != models.RoleAdmin {
+		t.Errorf("user in %q as %q, want acme as admin", user.OrgID, user.Role)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAcceptInviteRejected(t *testing.T) {
+	used := time.Now().Add(-time.Minute)
+	tests := []struct {
+		name    string
+		expect  func(sqlmock.Sqlmock)
+		req     models.AcceptInviteRequest
+		wantErr error
+	}{
+		{
+			name:    "reused",
+			expect:  func(mock sqlmock.Sqlmock) { expectInvite(mock, time.Now().Add(time.Hour), &used) },
+			wantErr: ErrInviteUsed,
+		},
+		{
+			name:    "expired",
+			expect:  func(mock sqlmock.Sqlmock) { expectInvite(mock, time.Now().Add(-time.Second), nil) },
+			wantErr: ErrInviteExpired,
+		},
+		{
+			name: "unknown",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery("FROM org_invites").WillReturnError(sql.ErrNoRows)
+			},
+			wantErr: ErrInviteNotFound,
+		},
+		{
+			name: "last owner of another org",
+			expect: func(mock sqlmock.Sqlmock) {
+				expectInvite(mock, time.Now().Add(time.Hour), nil)
+				mock.ExpectQuery("SELECT org_id, role FROM users").WithArgs("owner-id").
+					WillReturnRows(sqlmock.NewRows([]string{"org_id", "role"}).AddRow("other", models.RoleOwner))
+				mock.ExpectQuery("SELECT id FROM users WHERE org_id").WithArgs("other").
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("owner-id"))
+			},
+			req:     models.AcceptInviteRequest{UserID: "owner-id"},
+			wantErr: ErrLastOwner,
+		},
+		{
+			name: "unknown user",
+			expect: func(mock sqlmock.Sqlmock) {
+				expectInvite(mock, time.Now().Add(time.Hour), nil)
+				mock.ExpectQuery("SELECT org_id, role FROM users").WithArgs("nobody").WillReturnError(sql.ErrNoRows)
+			},
+			req:     models.AcceptInviteRequest{UserID: "nobody"},
+			wantErr: ErrUnknownUser,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, mock := newMockInviteRepository(t)
+			tt.expect(mock)
+			mock.ExpectRollback()
+
+			req := tt.req
+			if req.UserID == "" {
+				req = models.AcceptInviteRequest{Username: "jane", Email: "jane@example.com"}
+			}
+			if _, err := repo.Accept(context.Background(), "token", req); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestAcceptInviteExpiresByClock(t *testing.T) {
+	repo, mock := newMockInviteRepository(t)
+	expiresAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	repo.SetClock(clock.NewFake(expiresAt))
+	expectInvite(mock, expiresAt, nil)
+	mock.ExpectRollback()
+
+	req := models.AcceptInviteRequest{Username: "jane", Email: "jane@example.com"}
+	if _, err := repo.Accept(context.Background(), "token", req); !errors.Is(err, ErrInviteExpired) {
+		t.Fatalf("got %v, want ErrInviteExpired", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetPendingUsesClock(t *testing.T) {
+	repo, mock := newMockInviteRepository(t)
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	repo.SetClock(clock.NewFake(now))
+	mock.ExpectQuery("FROM org_invites WHERE org_id").WithArgs("acme", now).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "org_id", "role", "created_at", "expires_at"}).
+			AddRow("invite-1", "acme", models.RoleAdmin, now.Add(-time.Hour), now.Add(time.Hour)))
+
+	invites, err := repo.GetPending(context.Background(), "acme")
+	if err != nil {
+		t.Fatalf("GetPending: %v", err)
+	}
+	if len(invites) != 1 || invites[0].ID != "invite-1" {
+		t.Errorf("got %+v, want invite-1", invites)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,204 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"go-realtime-workspace/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// maxMentionsPerUser bounds a user's mentions inbox; older mentions are
+// dropped as new ones arrive.
+const maxMentionsPerUser = 1000
+
+// MentionResolver maps the handles of @mentions to the users of an
+// organization they refer to.
+type MentionResolver interface {
+	ResolveMentions(ctx context.Context, orgID string, handles []string) ([]string, error)
+}
+
+// SetMentionResolver sets how Save finds the users a message mentions.
+// Without it every handle is taken as a user ID, so @username mentions are
+// not recorded.
+func (r *MessageRepository) SetMentionResolver(resolver MentionResolver) {
+	r.mentions = resolver
+}
+
+// NotificationFilter decides whether an event should notify a user, from
+// their notification preferences (see NotificationRepository.ShouldNotify).
+type NotificationFilter interface {
+	ShouldNotify(ctx context.Context, userID, event, orgID, groupID string) bool
+}
+
+// SetNotificationFilter sets whose preferences Save consults before adding
+// a mention to a user's inbox. Without it every mention is recorded.
+func (r *MessageRepository) SetNotificationFilter(filter NotificationFilter) {
+	r.notifications = filter
+}
+
+// recordMentions adds msg to the mentions inbox of every user it mentions,
+// other than its author and users whose notification preferences turn off
+// mentions in the group. Direct messages are not recorded. A failure to
+// resolve the mentions is logged rather than failing the save.
+func (r *MessageRepository) recordMentions(ctx context.Context, pipe redis.Pipeliner, msg models.ChatMessage) {
+	if msg.OrgID == DMOrgID {
+		return
+	}
+	handles := models.ExtractMentions(msg.Content)
+	if len(handles) == 0 {
+		return
+	}
+
+	userIDs := handles
+	if r.mentions != nil {
+		var err error
+		userIDs, err = r.mentions.ResolveMentions(ctx, msg.OrgID, handles)
+		if err != nil {
+			log.Printf("Error resolving mentions in message %s: %v", msg.ID, err)
+			return
+		}
+	}
+
+	ref, err := json.Marshal(messageRef{OrgID: msg.OrgID, GroupID: msg.GroupID, ID: msg.ID})
+	if err != nil {
+		log.Printf("Error marshaling mention of message %s: %v", msg.ID, err)
+		return
+	}
+	for _, userID := range userIDs {
+		if userID == msg.ClientID {
+			continue
+		}
+		if r.notifications != nil && !r.notifications.ShouldNotify(ctx, userID, models.NotificationMention, msg.OrgID, msg.GroupID) {
+			continue
+		}
+		key := mentionsKey(userID)
+		pipe.ZAdd(ctx, key, redis.Z{Score: score(msg.Timestamp), Member: ref})
+		pipe.ZRemRangeByRank(ctx, key, 0, -maxMentionsPerUser-1)
+		pipe.Expire(ctx, key, r.cfg.MessageTTL)
+	}
+}
+
+// ListMentions returns a page of a user's mentions inbox, newest first,
+// holding up to limit mentions sent before the given time (zero for the
+// newest). Mentions of messages that were deleted, trimmed or expired are
+// skipped but kept, so a restored message reappears.
+func (r *MessageRepository) ListMentions(ctx context.Context, userID string, before time.Time, limit int64) (*models.MentionsPage, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+
+	readScore, err := r.mentionsReadScore(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	key := mentionsKey(userID)
+	page := &models.MentionsPage{UserID: userID, Mentions: []models.Mention{}}
+	page.Unread, err = r.client.ZCount(ctx, key, "("+strconv.FormatFloat(readScore, 'f', -1, 64), "+inf").Result()
+	if err != nil {
+		return nil, fmt.Errorf("error counting unread mentions: %w", err)
+	}
+
+	max := "+inf"
+	if !before.IsZero() {
+		max = "(" + scoreArg(before)
+	}
+
+	// Read references a batch at a time until the page is full, since
+	// some may point to messages that are gone
+	var offset int64
+	for int64(len(page.Mentions)) < limit {
+		refs, err := r.client.ZRevRangeByScoreWithScores(ctx, key, &redis.ZRangeBy{
+			Min:    "-inf",
+			Max:    max,
+			Offset: offset,
+			Count:  limit,
+		}).Result()
+		if err != nil {
+			return nil, fmt.Errorf("error getting mentions: %w", err)
+		}
+		offset += int64(len(refs))
+
+		for _, z := range refs {
+			var ref messageRef
+			if err := json.Unmarshal([]byte(z.Member.(string)), &ref); err != nil {
+				continue
+			}
+			msg, err := r.GetByID(ctx, ref.OrgID, ref.GroupID, ref.ID)
+			if errors.Is(err, ErrMessageNotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			page.Mentions = append(page.Mentions, models.Mention{
+				OrgID:     ref.OrgID,
+				GroupID:   ref.GroupID,
+				MessageID: msg.ID,
+				ClientID:  msg.ClientID,
+				Username:  msg.Username,
+				Snippet:   snippet(msg.Content),
+				Timestamp: msg.Timestamp,
+				Read:      z.Score <= readScore,
+			})
+			if int64(len(page.Mentions)) == limit {
+				break
+			}
+		}
+		if int64(len(refs)) < limit {
+			break
+		}
+	}
+
+	if n := len(page.Mentions); int64(n) == limit {
+		last := page.Mentions[n-1].Timestamp
+		older, err := r.client.ZCount(ctx, key, "-inf", "("+scoreArg(last)).Result()
+		if err != nil {
+			return nil, fmt.Errorf("error counting mentions: %w", err)
+		}
+		if older > 0 {
+			page.NextBefore = &last
+		}
+	}
+	return page, nil
+}
+
+// MarkMentionsRead marks a user's mentions sent up to the given time as read.
+func (r *MessageRepository) MarkMentionsRead(ctx context.Context, userID string, at time.Time) error {
+	if err := r.client.Set(ctx, mentionsReadKey(userID), score(at), r.cfg.MessageTTL).Err(); err != nil {
+		return fmt.Errorf("error marking mentions as read: %w", err)
+	}
+	return nil
+}
+
+// mentionsReadScore returns the score up to which a user has read their
+// mentions, or 0 if they never marked any.
+func (r *MessageRepository) mentionsReadScore(ctx context.Context, userID string) (float64, error) {
+	readScore, err := r.client.Get(ctx, mentionsReadKey(userID)).Float64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error getting mentions read marker: %w", err)
+	}
+	return readScore, nil
+}
+
+// mentionsKey returns the sorted set of references to messages mentioning a user.
+func mentionsKey(userID string) string {
+	return fmt.Sprintf("mentions:%s", userID)
+}
+
+// mentionsReadKey returns the key holding the score up to which a user has
+// read their mentions.
+func mentionsReadKey(userID string) string {
+	return fmt.Sprintf("mentions_read:%s", userID)
+}
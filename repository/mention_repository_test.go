@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"go-realtime-workspace/models"
+)
+
+// mentionIDs returns the message IDs of a mentions page, in order.
+func mentionIDs(page *models.MentionsPage) []string {
+	ids := make([]string, len(page.Mentions))
+	for i, mention := range page.Mentions {
+		ids[i] = mention.MessageID
+	}
+	return ids
+}
+
+func TestMentionsInboxPages(t *testing.T) {
+	repo, _ := newTestMessageRepository(t, nil)
+	ctx := context.Background()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	saveAt(t, repo, "acme", "general", "m0", "@bob hi", 0)
+	saveAt(t, repo, "acme", "general", "m1", "no mention", 1)
+	saveAt(t, repo, "acme", "random", "m2", "@bob and @carol", 2)
+	saveAt(t, repo, "acme", "general", "m3", "@alice talking to myself", 3)
+	saveAt(t, repo, "acme", "general", "m4", "@bob again", 4)
+	// Direct messages are not recorded
+	if _, err := repo.Save(ctx, models.ChatMessage{
+		OrgID: DMOrgID, GroupID: "alice_bob", ClientID: "alice", RecipientID: "bob", Content: "@bob psst", Timestamp: start,
+	}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	page, err := repo.ListMentions(ctx, "bob", time.Time{}, 2)
+	if err != nil {
+		t.Fatalf("ListMentions: %v", err)
+	}
+	if got := mentionIDs(page); !slices.Equal(got, []string{"m4", "m2"}) {
+		t.Fatalf("first page %v, want [m4 m2]", got)
+	}
+	if page.Unread != 3 || page.NextBefore == nil || !page.NextBefore.Equal(start.Add(2*time.Second)) {
+		t.Errorf("first page: %d unread, next before %v; want 3 and m2's time", page.Unread, page.NextBefore)
+	}
+	if m := page.Mentions[1]; m.GroupID != "random" || m.ClientID != "alice" || m.Snippet != "@bob and @carol" {
+		t.Errorf("mention %+v, want m2 in random by alice with its content", m)
+	}
+
+	page, err = repo.ListMentions(ctx, "bob", *page.NextBefore, 2)
+	if err != nil {
+		t.Fatalf("ListMentions: %v", err)
+	}
+	if got := mentionIDs(page); !slices.Equal(got, []string{"m0"}) || page.NextBefore != nil {
+		t.Errorf("last page %v (next before %v), want [m0] and no more", got, page.NextBefore)
+	}
+
+	// The author is never in their own inbox; other mentioned users are
+	for user, want := range map[string][]string{"alice": {}, "carol": {"m2"}} {
+		page, err := repo.ListMentions(ctx, user, time.Time{}, 10)
+		if err != nil {
+			t.Fatalf("ListMentions: %v", err)
+		}
+		if got := mentionIDs(page); !slices.Equal(got, want) {
+			t.Errorf("%s's mentions %v, want %v", user, got, want)
+		}
+	}
+}
+
+func TestMentionsReadAndDeleted(t *testing.T) {
+	repo, _ := newTestMessageRepository(t, nil)
+	ctx := context.Background()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	saveAt(t, repo, "acme", "general", "m0", "@bob one", 0)
+	saveAt(t, repo, "acme", "general", "m1", "@bob two", 1)
+
+	if err := repo.MarkMentionsRead(ctx, "bob", start); err != nil {
+		t.Fatalf("MarkMentionsRead: %v", err)
+	}
+	page, err := repo.ListMentions(ctx, "bob", time.Time{}, 10)
+	if err != nil {
+		t.Fatalf("ListMentions: %v", err)
+	}
+	if page.Unread != 1 || len(page.Mentions) != 2 || page.Mentions[0].Read || !page.Mentions[1].Read {
+		t.Errorf("got %d unread in %+v, want only m1 unread", page.Unread, page.Mentions)
+	}
+
+	// Mentions of deleted messages are skipped
+	saveAt(t, repo, "acme", "general", "m2", "@bob oops", 2)
+	if _, err := repo.SoftDelete(ctx, "acme", "general", "m2", "alice"); err != nil {
+		t.Fatalf("SoftDelete: %v", err)
+	}
+	page, err = repo.ListMentions(ctx, "bob", time.Time{}, 10)
+	if err != nil {
+		t.Fatalf("ListMentions: %v", err)
+	}
+	if got := mentionIDs(page); !slices.Equal(got, []string{"m1", "m0"}) {
+		t.Errorf("mentions %v, want the deleted m2 skipped", got)
+	}
+}
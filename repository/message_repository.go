@@ -3,74 +3,524 @@ package repository
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"go-realtime-workspace/clock"
 	"go-realtime-workspace/config"
+	"go-realtime-workspace/cursor"
+	"go-realtime-workspace/idgen"
 	"go-realtime-workspace/models"
+	"go-realtime-workspace/sanitize"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 )
 
+// ErrMessageNotFound is returned when a message is not (or no longer) stored.
+var ErrMessageNotFound = errors.New("message not found")
+
+// ErrNotMessageAuthor is returned when a user tries to change someone else's message.
+var ErrNotMessageAuthor = errors.New("only the author can change this message")
+
+// replaceMemberScript swaps member ARGV[1] of a history sorted set for
+// ARGV[2] at the same score, keeping the message's place among messages
+// saved in the same microsecond. Returns 0 if ARGV[1] is no longer stored.
+var replaceMemberScript = redis.NewScript(`
+local pos = redis.call("ZSCORE", KEYS[1], ARGV[1])
+if not pos then
+	return 0
+end
+redis.call("ZREM", KEYS[1], ARGV[1])
+redis.call("ZADD", KEYS[1], pos, ARGV[2])
+return 1
+`)
+
+// dropIndexScript removes index entry ARGV[1] if it still names member
+// ARGV[2], so a reader cleaning up after a trim cannot remove the entry a
+// concurrent edit just wrote.
+var dropIndexScript = redis.NewScript(`
+if redis.call("HGET", KEYS[1], ARGV[1]) == ARGV[2] then
+	return redis.call("HDEL", KEYS[1], ARGV[1])
+end
+return 0
+`)
+
+// maxEditAttempts bounds how often Edit retries when the message changes underneath it.
+const maxEditAttempts = 3
+
+// DMOrgID is the special org ID under which direct messages are stored.
+const DMOrgID = "dm"
+
+// quoteSnippetLength is the maximum number of characters kept in a quote or
+// mention preview.
+const quoteSnippetLength = 100
+
+// messageRef identifies a stored message in sets that reference messages
+// across groups, such as the expiry schedule and starred messages.
+type messageRef struct {
+	OrgID   string `json:"org_id"`
+	GroupID string `json:"group_id"`
+	ID      string `json:"id"`
+}
+
 // MessageRepository handles chat message storage in Redis.
 type MessageRepository struct {
-	client *redis.Client
-	cfg    config.RedisConfig
+	client   redis.UniversalClient
+	cfg      config.RedisConfig
+	sanitize sanitize.Mode
+	clock    clock.Clock
+	ids      idgen.Generator
+
+	maxContentBytes int                // Largest content accepted by Edit (0 disables)
+	contentTypes    []string           // Structured content types accepted by Edit and imports
+	restoreWindow   time.Duration      // How long SoftDelete keeps a message restorable
+	roles           RoleLookup         // Exempts owners and admins from edit and delete windows (nil exempts no one)
+	mentions        MentionResolver    // Finds the users a message mentions (nil takes handles as user IDs)
+	notifications   NotificationFilter // Users' notification preferences, consulted for mentions (nil records every mention)
+
+	lastScore atomic.Int64 // Score of the last message saved by this process (see nextScore)
+
+	spillMu sync.Mutex
+	spill   []models.ChatMessage // Messages accepted during a Redis outage, oldest first (see Save)
 }
 
 // NewMessageRepository creates a new message repository.
-func NewMessageRepository(client *redis.Client, cfg config.RedisConfig) *MessageRepository {
+func NewMessageRepository(client redis.UniversalClient, cfg config.RedisConfig, msgCfg config.MessageConfig) *MessageRepository {
 	return &MessageRepository{
-		client: client,
-		cfg:    cfg,
+		client:   client,
+		cfg:      cfg,
+		sanitize: sanitize.Mode(msgCfg.Sanitize),
+		clock:    clock.Real{},
+		ids:      idgen.UUID{},
+
+		maxContentBytes: msgCfg.MaxContentBytes,
+		contentTypes:    msgCfg.ContentTypes,
+		restoreWindow:   msgCfg.RestoreWindow,
 	}
 }
 
-// Save stores a chat message in Redis.
-func (r *MessageRepository) Save(ctx context.Context, msg models.ChatMessage) error {
+// SetClock replaces the clock used for timestamps, trimming and expiry checks.
+func (r *MessageRepository) SetClock(c clock.Clock) {
+	r.clock = c
+}
+
+// SetIDGenerator replaces how IDs are minted for messages stored without
+// one. Stored messages keep their IDs, whatever scheme minted them.
+func (r *MessageRepository) SetIDGenerator(ids idgen.Generator) {
+	r.ids = ids
+}
+
+// Unsanitize returns stored content of the given content type in a form
+// that Save (and the hub's delivery) sanitize back into exactly the stored
+// content, for copying a stored message into a new one.
+func (r *MessageRepository) Unsanitize(content, contentType string) string {
+	return r.sanitize.UnapplyContent(content, models.StructuredContent(contentType))
+}
+
+// Save stores a chat message in Redis and returns the stored message
+// with its generated ID and timestamp.
+//
+// When the caller supplies the message ID, a repeat from the same sender
+// within the configured DedupeWindow is ignored and the originally stored
+// message is returned instead, so retries from a client never create
+// duplicates. Any other ID already stored in the group returns
+// ErrDuplicateMessage.
+//
+// With Redis.SpilloverSize set, a message that cannot be stored because
+// Redis is unreachable is held in memory and returned as if stored; see
+// ReplaySpillover.
+func (r *MessageRepository) Save(ctx context.Context, msg models.ChatMessage) (*models.ChatMessage, error) {
+	if r.cfg.SpilloverSize <= 0 {
+		return r.save(ctx, msg)
+	}
+	if r.SpilloverLen() > 0 {
+		// Queue behind the held messages so history keeps its order
+		return r.spillMessage(msg, nil)
+	}
+
+	saved, err := r.save(ctx, msg)
+	if err != nil && redisUnavailable(err) {
+		return r.spillMessage(msg, err)
+	}
+	return saved, err
+}
+
+// save stores a chat message in Redis.
+func (r *MessageRepository) save(ctx context.Context, msg models.ChatMessage) (*models.ChatMessage, error) {
 	// Generate ID if not provided
 	if msg.ID == "" {
-		msg.ID = uuid.New().String()
+		msg.ID = r.ids.NewID()
+	} else {
+		if r.cfg.DedupeWindow > 0 {
+			dedupe := dedupeKey(msg.OrgID, msg.GroupID, msg.ClientID, msg.ID)
+			first, err := r.client.SetNX(ctx, dedupe, 1, r.cfg.DedupeWindow).Result()
+			if err != nil {
+				return nil, fmt.Errorf("error checking message idempotency: %w", err)
+			}
+			if !first {
+				existing, err := r.GetByID(ctx, msg.OrgID, msg.GroupID, msg.ID)
+				if err == nil && existing.ClientID == msg.ClientID {
+					return existing, nil
+				}
+				// The original was never stored; fall through and store this copy
+			}
+		}
+
+		// Never replace another stored message, whoever sent it
+		taken, err := r.client.HExists(ctx, indexKey(msg.OrgID, msg.GroupID), msg.ID).Result()
+		if err != nil {
+			return nil, fmt.Errorf("error checking message ID: %w", err)
+		}
+		if taken {
+			return nil, ErrDuplicateMessage
+		}
+	}
+
+	tracked, err := r.enforceQuota(ctx, msg.OrgID, msg.GroupID)
+	if err != nil {
+		return nil, err
+	}
+	protected, err := r.protectedMembers(ctx, msg.OrgID, msg.GroupID)
+	if err != nil {
+		return nil, err
 	}
 
 	// Set timestamp if not provided
 	if msg.Timestamp.IsZero() {
-		msg.Timestamp = time.Now()
+		msg.Timestamp = r.clock.Now()
 	}
 
+	msg.Content = r.sanitize.ApplyContent(msg.Content, models.StructuredContent(msg.ContentType))
+
 	// Serialize message to JSON
 	data, err := json.Marshal(msg)
 	if err != nil {
-		return fmt.Errorf("error marshaling message: %w", err)
+		return nil, fmt.Errorf("error marshaling message: %w", err)
+	}
+	data, err = r.encodePayload(data)
+	if err != nil {
+		return nil, err
 	}
 
 	// Create Redis key for the group's message list
-	key := fmt.Sprintf("messages:%s:%s", msg.OrgID, msg.GroupID)
+	key := groupKey(msg.OrgID, msg.GroupID)
 
 	// Use a pipeline for atomic operations
 	pipe := r.client.Pipeline()
 
 	// Add message to sorted set (score is timestamp for ordering)
 	pipe.ZAdd(ctx, key, redis.Z{
-		Score:  float64(msg.Timestamp.Unix()),
+		Score:  r.nextScore(msg.Timestamp),
 		Member: data,
 	})
 
-	// Trim to keep only MaxMessages
-	pipe.ZRemRangeByRank(ctx, key, 0, -r.cfg.MaxMessages-1)
+	// Trim to keep only MaxMessages, plus any protected messages
+	trimmed := r.trimHistory(ctx, pipe, msg.OrgID, msg.GroupID, protected)
 
 	// Set TTL on the key
 	pipe.Expire(ctx, key, r.cfg.MessageTTL)
 
+	// Index the message by ID for single-message lookups
+	idxKey := indexKey(msg.OrgID, msg.GroupID)
+	pipe.HSet(ctx, idxKey, msg.ID, data)
+	pipe.Expire(ctx, idxKey, r.cfg.MessageTTL)
+
+	// Schedule disappearing messages for removal
+	if msg.ExpiresAt != nil {
+		if err := r.scheduleExpiry(ctx, pipe, msg); err != nil {
+			return nil, err
+		}
+	}
+
+	if msg.AckRequired {
+		r.trackAcks(ctx, pipe, msg)
+	}
+
+	r.recordMentions(ctx, pipe, msg)
+
+	if msg.OrgID != DMOrgID {
+		recordActivity(ctx, pipe, msg.OrgID, models.ActivityMessages, msg.Timestamp)
+	}
+
+	// Count the message towards the org's quota; it is stored in the
+	// history and in the index
+	if tracked {
+		addUsage.Eval(ctx, pipe, []string{quotaUsageKey(msg.OrgID)}, 1, 2*len(data))
+	}
+
+	// Track the DM room for both participants; sending implies having read the room
+	if msg.OrgID == DMOrgID && msg.RecipientID != "" {
+		for _, userID := range []string{msg.ClientID, msg.RecipientID} {
+			roomsKey := dmRoomsKey(userID)
+			pipe.ZAdd(ctx, roomsKey, redis.Z{Score: score(msg.Timestamp), Member: msg.GroupID})
+			pipe.Expire(ctx, roomsKey, r.cfg.MessageTTL)
+		}
+		pipe.HSet(ctx, readMarkersKey(msg.ClientID), markerField(msg.OrgID, msg.GroupID), score(msg.Timestamp))
+	}
+
 	// Execute pipeline
 	_, err = pipe.Exec(ctx)
 	if err != nil {
-		return fmt.Errorf("error saving message: %w", err)
+		return nil, fmt.Errorf("error saving message: %w", err)
+	}
+	r.dropTrimmed(ctx, msg.OrgID, msg.GroupID, trimmed, tracked)
+
+	return &msg, nil
+}
+
+// GetByID retrieves a single message from a group by its ID. Messages that
+// were trimmed or expired from the history return ErrMessageNotFound.
+func (r *MessageRepository) GetByID(ctx context.Context, orgID, groupID, id string) (*models.ChatMessage, error) {
+	idxKey := indexKey(orgID, groupID)
+
+	// A second read covers an edit that swapped the history entry between
+	// reading the index and checking the history
+	for attempt := 0; attempt < 2; attempt++ {
+		member, err := r.client.HGet(ctx, idxKey, id).Result()
+		if err == redis.Nil {
+			return nil, ErrMessageNotFound
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error getting message: %w", err)
+		}
+
+		// An index entry may outlive its history entry (see dropTrimmed), so
+		// confirm the member is still stored
+		if err := r.client.ZScore(ctx, groupKey(orgID, groupID), member).Err(); err != nil {
+			if err == redis.Nil {
+				dropIndexScript.Run(ctx, r.client, []string{idxKey}, id, member)
+				continue
+			}
+			return nil, fmt.Errorf("error getting message: %w", err)
+		}
+
+		messages, err := r.decodeMessages(ctx, orgID, []string{member})
+		if err != nil {
+			return nil, err
+		}
+		if len(messages) == 0 {
+			return nil, ErrMessageNotFound
+		}
+		return &messages[0], nil
+	}
+	return nil, ErrMessageNotFound
+}
+
+// GetByIDs looks up several messages of a group in two round trips. It
+// returns the messages found, in the order their IDs were given, and the
+// IDs that are not (or no longer) stored: never sent, deleted, trimmed from
+// the history or expired. Repeated IDs are looked up once.
+func (r *MessageRepository) GetByIDs(ctx context.Context, orgID, groupID string, ids []string) ([]models.ChatMessage, []string, error) {
+	seen := make(map[string]bool, len(ids))
+	unique := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	if len(unique) == 0 {
+		return []models.ChatMessage{}, []string{}, nil
+	}
+
+	idxKey := indexKey(orgID, groupID)
+	members, err := r.client.HMGet(ctx, idxKey, unique...).Result()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error getting messages: %w", err)
 	}
 
+	// The index outlives trimmed history entries, so confirm each member is still stored
+	key := groupKey(orgID, groupID)
+	pipe := r.client.Pipeline()
+	scores := make([]*redis.FloatCmd, len(unique))
+	for i, value := range members {
+		if member, ok := value.(string); ok {
+			scores[i] = pipe.ZScore(ctx, key, member)
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, nil, fmt.Errorf("error getting messages: %w", err)
+	}
+
+	var stored []string
+	cleanup := r.client.Pipeline()
+	for i, cmd := range scores {
+		if cmd == nil {
+			continue
+		}
+		if cmd.Err() == redis.Nil {
+			dropIndexScript.Eval(ctx, cleanup, []string{idxKey}, unique[i], members[i])
+			continue
+		}
+		stored = append(stored, members[i].(string))
+	}
+	if cleanup.Len() > 0 {
+		cleanup.Exec(ctx)
+	}
+
+	decoded, err := r.decodeMessages(ctx, orgID, stored)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := r.attachReactions(ctx, orgID, groupID, decoded); err != nil {
+		return nil, nil, err
+	}
+
+	byID := make(map[string]models.ChatMessage, len(decoded))
+	for _, msg := range decoded {
+		byID[msg.ID] = msg
+	}
+	found := make([]models.ChatMessage, 0, len(byID))
+	missing := []string{}
+	for _, id := range unique {
+		if msg, ok := byID[id]; ok {
+			found = append(found, msg)
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	return found, missing, nil
+}
+
+// ResolveQuotes fills in the Quote preview of every message that replies to
+// another message in the same group. Replies whose target is gone are left
+// without a quote.
+func (r *MessageRepository) ResolveQuotes(ctx context.Context, orgID, groupID string, messages []models.ChatMessage) {
+	for i := range messages {
+		if messages[i].ReplyToID == "" {
+			continue
+		}
+
+		quoted, err := r.GetByID(ctx, orgID, groupID, messages[i].ReplyToID)
+		if err != nil {
+			continue
+		}
+
+		messages[i].Quote = &models.MessageQuote{
+			ID:       quoted.ID,
+			ClientID: quoted.ClientID,
+			Username: quoted.Username,
+			Snippet:  snippet(quoted.Content),
+		}
+	}
+}
+
+// snippet shortens content to a preview of at most quoteSnippetLength
+// characters.
+func snippet(content string) string {
+	runes := []rune(content)
+	if len(runes) > quoteSnippetLength {
+		runes = append(runes[:quoteSnippetLength], '…')
+	}
+	return string(runes)
+}
+
+// SaveAnnouncement stores an org-wide broadcast once under announcements:{orgId}
+// and pushes a lightweight pointer into the history of each listed group, so
+// the announcement shows up in context without duplicating its content.
+// It is a no-op unless PersistAnnouncements is enabled.
+func (r *MessageRepository) SaveAnnouncement(ctx context.Context, msg models.ChatMessage, groupIDs []string) error {
+	if !r.cfg.PersistAnnouncements {
+		return nil
+	}
+
+	if msg.ID == "" {
+		msg.ID = r.ids.NewID()
+	}
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = r.clock.Now()
+	}
+	msg.GroupID = ""
+	msg.Content = r.sanitize.ApplyContent(msg.Content, models.StructuredContent(msg.ContentType))
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("error marshaling announcement: %w", err)
+	}
+	data, err = r.encodePayload(data)
+	if err != nil {
+		return err
+	}
+
+	// Look up every group's protected messages before trimming
+	protectedPipe := r.client.Pipeline()
+	protectedCmds := make([]*redis.StringSliceCmd, len(groupIDs))
+	for i, groupID := range groupIDs {
+		protectedCmds[i] = protectedPipe.HVals(ctx, protectedKey(msg.OrgID, groupID))
+	}
+	if _, err := protectedPipe.Exec(ctx); err != nil && err != redis.Nil {
+		return fmt.Errorf("error getting protected messages: %w", err)
+	}
+
+	pipe := r.client.Pipeline()
+	trimmed := make([]*redis.Cmd, len(groupIDs))
+
+	annKey := announcementKey(msg.OrgID)
+	pipe.HSet(ctx, annKey, msg.ID, data)
+	pipe.Expire(ctx, annKey, r.cfg.MessageTTL)
+
+	// Keep the org's newest MaxMessages announcements, like a group history
+	orderKey := announcementOrderKey(msg.OrgID)
+	pipe.ZAdd(ctx, orderKey, redis.Z{Score: score(msg.Timestamp), Member: msg.ID})
+	annTrimmed := trimScript.Eval(ctx, pipe, []string{orderKey}, "keep", r.cfg.MaxMessages)
+	pipe.Expire(ctx, orderKey, r.cfg.MessageTTL)
+	recordActivity(ctx, pipe, msg.OrgID, models.ActivityMessages, msg.Timestamp)
+
+	for i, groupID := range groupIDs {
+		pointer, err := json.Marshal(models.ChatMessage{
+			ID:             msg.ID,
+			OrgID:          msg.OrgID,
+			GroupID:        groupID,
+			Timestamp:      msg.Timestamp,
+			AnnouncementID: msg.ID,
+		})
+		if err != nil {
+			return fmt.Errorf("error marshaling announcement pointer: %w", err)
+		}
+
+		key := groupKey(msg.OrgID, groupID)
+		pipe.ZAdd(ctx, key, redis.Z{
+			Score:  score(msg.Timestamp),
+			Member: pointer,
+		})
+		trimmed[i] = r.trimHistory(ctx, pipe, msg.OrgID, groupID, protectedCmds[i].Val())
+		pipe.Expire(ctx, key, r.cfg.MessageTTL)
+
+		idxKey := indexKey(msg.OrgID, groupID)
+		pipe.HSet(ctx, idxKey, msg.ID, pointer)
+		pipe.Expire(ctx, idxKey, r.cfg.MessageTTL)
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("error saving announcement: %w", err)
+	}
+	for i, groupID := range groupIDs {
+		r.dropTrimmed(ctx, msg.OrgID, groupID, trimmed[i], false)
+	}
+	r.dropAnnouncements(ctx, msg.OrgID, annTrimmed)
+
 	return nil
 }
 
+// dropAnnouncements removes the announcements trimmed from an org's
+// announcement order from the announcement hash, which lives in another
+// hash slot under Redis Cluster. Group history pointers to them are dropped
+// when read (see decodeMessages).
+func (r *MessageRepository) dropAnnouncements(ctx context.Context, orgID string, trimmed *redis.Cmd) {
+	ids, err := trimmed.StringSlice()
+	if err != nil || len(ids) == 0 {
+		return
+	}
+	if err := r.client.HDel(ctx, announcementKey(orgID), ids...).Err(); err != nil {
+		log.Printf("Error dropping %d trimmed announcements of %s: %v", len(ids), orgID, err)
+	}
+}
+
 // GetHistory retrieves message history for a group.
 func (r *MessageRepository) GetHistory(ctx context.Context, orgID, groupID string, limit int64) ([]models.ChatMessage, error) {
 	if limit <= 0 {
@@ -80,7 +530,7 @@ func (r *MessageRepository) GetHistory(ctx context.Context, orgID, groupID strin
 		limit = r.cfg.MaxMessages
 	}
 
-	key := fmt.Sprintf("messages:%s:%s", orgID, groupID)
+	key := groupKey(orgID, groupID)
 
 	// Get messages in reverse chronological order (most recent first)
 	results, err := r.client.ZRevRange(ctx, key, 0, limit-1).Result()
@@ -88,17 +538,60 @@ func (r *MessageRepository) GetHistory(ctx context.Context, orgID, groupID strin
 		return nil, fmt.Errorf("error getting message history: %w", err)
 	}
 
-	messages := make([]models.ChatMessage, 0, len(results))
-	for _, data := range results {
-		var msg models.ChatMessage
-		if err := json.Unmarshal([]byte(data), &msg); err != nil {
-			// Skip malformed messages
-			continue
+	messages, err := r.decodeMessages(ctx, orgID, results)
+	if err != nil {
+		return nil, err
+	}
+	return messages, r.attachReactions(ctx, orgID, groupID, messages)
+}
+
+// GetHistoryPage retrieves up to limit messages of a group, newest first,
+// starting after the given position (nil for the newest). It also returns
+// the position of the page's end, or nil when there are no older messages.
+// Messages saved in between are newer than any page already read, so they
+// shift nothing; messages sharing a score are told apart by Skip.
+func (r *MessageRepository) GetHistoryPage(ctx context.Context, orgID, groupID string, after *cursor.Position, limit int64) ([]models.ChatMessage, *cursor.Position, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	if limit > r.cfg.MaxMessages {
+		limit = r.cfg.MaxMessages
+	}
+
+	by := &redis.ZRangeBy{Min: "-inf", Max: "+inf", Count: limit}
+	if after != nil {
+		by.Max = scoreArg(after.Time)
+		by.Offset = int64(after.Skip)
+	}
+	results, err := r.client.ZRevRangeByScoreWithScores(ctx, groupKey(orgID, groupID), by).Result()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error getting message history: %w", err)
+	}
+
+	var next *cursor.Position
+	if int64(len(results)) == limit {
+		last := results[len(results)-1].Score
+		skip := 0
+		for _, z := range results {
+			if z.Score == last {
+				skip++
+			}
 		}
-		messages = append(messages, msg)
+		if after != nil && score(after.Time) == last {
+			skip += after.Skip
+		}
+		next = &cursor.Position{Time: time.UnixMicro(int64(last)).UTC(), Skip: skip}
 	}
 
-	return messages, nil
+	members := make([]string, len(results))
+	for i, z := range results {
+		members[i], _ = z.Member.(string)
+	}
+	messages, err := r.decodeMessages(ctx, orgID, members)
+	if err != nil {
+		return nil, nil, err
+	}
+	return messages, next, r.attachReactions(ctx, orgID, groupID, messages)
 }
 
 // GetHistoryAfter retrieves messages after a specific timestamp.
@@ -110,11 +603,11 @@ func (r *MessageRepository) GetHistoryAfter(ctx context.Context, orgID, groupID
 		limit = r.cfg.MaxMessages
 	}
 
-	key := fmt.Sprintf("messages:%s:%s", orgID, groupID)
+	key := groupKey(orgID, groupID)
 
 	// Get messages with score (timestamp) greater than 'after'
 	results, err := r.client.ZRangeByScore(ctx, key, &redis.ZRangeBy{
-		Min:   fmt.Sprintf("%d", after.Unix()),
+		Min:   scoreArg(after),
 		Max:   "+inf",
 		Count: limit,
 	}).Result()
@@ -123,16 +616,11 @@ func (r *MessageRepository) GetHistoryAfter(ctx context.Context, orgID, groupID
 		return nil, fmt.Errorf("error getting messages after timestamp: %w", err)
 	}
 
-	messages := make([]models.ChatMessage, 0, len(results))
-	for _, data := range results {
-		var msg models.ChatMessage
-		if err := json.Unmarshal([]byte(data), &msg); err != nil {
-			continue
-		}
-		messages = append(messages, msg)
+	messages, err := r.decodeMessages(ctx, orgID, results)
+	if err != nil {
+		return nil, err
 	}
-
-	return messages, nil
+	return messages, r.attachReactions(ctx, orgID, groupID, messages)
 }
 
 // GetHistoryBetween retrieves messages between two timestamps.
@@ -144,11 +632,11 @@ func (r *MessageRepository) GetHistoryBetween(ctx context.Context, orgID, groupI
 		limit = r.cfg.MaxMessages
 	}
 
-	key := fmt.Sprintf("messages:%s:%s", orgID, groupID)
+	key := groupKey(orgID, groupID)
 
 	results, err := r.client.ZRangeByScore(ctx, key, &redis.ZRangeBy{
-		Min:   fmt.Sprintf("%d", start.Unix()),
-		Max:   fmt.Sprintf("%d", end.Unix()),
+		Min:   scoreArg(start),
+		Max:   scoreArg(end),
 		Count: limit,
 	}).Result()
 
@@ -156,34 +644,439 @@ func (r *MessageRepository) GetHistoryBetween(ctx context.Context, orgID, groupI
 		return nil, fmt.Errorf("error getting messages between timestamps: %w", err)
 	}
 
-	messages := make([]models.ChatMessage, 0, len(results))
-	for _, data := range results {
-		var msg models.ChatMessage
-		if err := json.Unmarshal([]byte(data), &msg); err != nil {
+	messages, err := r.decodeMessages(ctx, orgID, results)
+	if err != nil {
+		return nil, err
+	}
+	return messages, r.attachReactions(ctx, orgID, groupID, messages)
+}
+
+// GetDMConversations returns the user's most recently active DM
+// conversations, each with its latest message and unread count.
+func (r *MessageRepository) GetDMConversations(ctx context.Context, userID string, limit int64) ([]models.DMConversation, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+
+	rooms, err := r.client.ZRevRangeWithScores(ctx, dmRoomsKey(userID), 0, limit-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error getting DM rooms: %w", err)
+	}
+
+	conversations := make([]models.DMConversation, 0, len(rooms))
+	for _, room := range rooms {
+		roomID, _ := room.Member.(string)
+
+		latest, err := r.GetHistory(ctx, DMOrgID, roomID, 1)
+		if err != nil {
+			return nil, err
+		}
+		if len(latest) == 0 {
+			// The room's history expired; drop it from the index
+			r.client.ZRem(ctx, dmRoomsKey(userID), roomID)
 			continue
 		}
-		messages = append(messages, msg)
+
+		last := latest[0]
+		peerID := last.ClientID
+		if peerID == userID {
+			peerID = last.RecipientID
+		}
+
+		unread, err := r.UnreadCount(ctx, userID, DMOrgID, roomID)
+		if err != nil {
+			return nil, err
+		}
+
+		conversations = append(conversations, models.DMConversation{
+			RoomID:       roomID,
+			PeerID:       peerID,
+			LastMessage:  &last,
+			UnreadCount:  unread,
+			LastActivity: last.Timestamp,
+		})
 	}
 
-	return messages, nil
+	return conversations, nil
+}
+
+// MarkRead sets the user's read marker for a group or DM room to the given time.
+func (r *MessageRepository) MarkRead(ctx context.Context, userID, orgID, groupID string, at time.Time) error {
+	if err := r.client.HSet(ctx, readMarkersKey(userID), markerField(orgID, groupID), score(at)).Err(); err != nil {
+		return fmt.Errorf("error setting read marker: %w", err)
+	}
+	return nil
+}
+
+// MarkAllRead sets the user's read markers to the given time for the given
+// groups of an org, every group the user already has a marker for and, when
+// includeDMs is set, every DM room the user is in. All markers are written
+// with a single HSET. Returns the number of conversations marked.
+func (r *MessageRepository) MarkAllRead(ctx context.Context, userID, orgID string, groupIDs []string, includeDMs bool, at time.Time) (int, error) {
+	key := readMarkersKey(userID)
+
+	pipe := r.client.Pipeline()
+	markersCmd := pipe.HKeys(ctx, key)
+	var roomsCmd *redis.StringSliceCmd
+	if includeDMs {
+		roomsCmd = pipe.ZRange(ctx, dmRoomsKey(userID), 0, -1)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return 0, fmt.Errorf("error getting conversations: %w", err)
+	}
+
+	fields := make(map[string]interface{})
+	for _, groupID := range groupIDs {
+		fields[markerField(orgID, groupID)] = score(at)
+	}
+	for _, field := range markersCmd.Val() {
+		if !strings.HasPrefix(field, DMOrgID+":") {
+			fields[field] = score(at)
+		}
+	}
+	if roomsCmd != nil {
+		for _, roomID := range roomsCmd.Val() {
+			fields[markerField(DMOrgID, roomID)] = score(at)
+		}
+	}
+
+	if len(fields) == 0 {
+		return 0, nil
+	}
+	if err := r.client.HSet(ctx, key, fields).Err(); err != nil {
+		return 0, fmt.Errorf("error setting read markers: %w", err)
+	}
+	return len(fields), nil
+}
+
+// UnreadCount returns how many messages in a group or DM room are newer than
+// the user's read marker. Without a marker every stored message is unread.
+func (r *MessageRepository) UnreadCount(ctx context.Context, userID, orgID, groupID string) (int64, error) {
+	min := "-inf"
+	marker, err := r.client.HGet(ctx, readMarkersKey(userID), markerField(orgID, groupID)).Result()
+	if err != nil && err != redis.Nil {
+		return 0, fmt.Errorf("error getting read marker: %w", err)
+	}
+	if err == nil {
+		min = "(" + marker
+	}
+
+	count, err := r.client.ZCount(ctx, groupKey(orgID, groupID), min, "+inf").Result()
+	if err != nil {
+		return 0, fmt.Errorf("error counting unread messages: %w", err)
+	}
+	return count, nil
 }
 
 // Count returns the total number of messages in a group.
 func (r *MessageRepository) Count(ctx context.Context, orgID, groupID string) (int64, error) {
-	key := fmt.Sprintf("messages:%s:%s", orgID, groupID)
+	key := groupKey(orgID, groupID)
 	return r.client.ZCard(ctx, key).Result()
 }
 
 // DeleteOld deletes messages older than the specified duration.
 func (r *MessageRepository) DeleteOld(ctx context.Context, orgID, groupID string, olderThan time.Duration) (int64, error) {
-	key := fmt.Sprintf("messages:%s:%s", orgID, groupID)
-	cutoff := time.Now().Add(-olderThan).Unix()
+	key := groupKey(orgID, groupID)
+	cutoff := r.clock.Now().Add(-olderThan)
+
+	return r.client.ZRemRangeByScore(ctx, key, "-inf", scoreArg(cutoff)).Result()
+}
+
+// Delete removes a single message from a group's history.
+// Returns ErrMessageNotFound if the message is not stored.
+func (r *MessageRepository) Delete(ctx context.Context, orgID, groupID, id string) error {
+	idxKey := indexKey(orgID, groupID)
+
+	member, err := r.client.HGet(ctx, idxKey, id).Result()
+	if err == redis.Nil {
+		return ErrMessageNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("error getting message: %w", err)
+	}
+
+	pipe := r.client.Pipeline()
+	removed := pipe.ZRem(ctx, groupKey(orgID, groupID), member)
+	pipe.HDel(ctx, idxKey, id)
+	forgetProtection(ctx, pipe, orgID, groupID, id)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("error deleting message: %w", err)
+	}
 
-	return r.client.ZRemRangeByScore(ctx, key, "-inf", fmt.Sprintf("%d", cutoff)).Result()
+	if removed.Val() == 0 {
+		return ErrMessageNotFound
+	}
+	return nil
+}
+
+// Edit replaces the content of a stored message in place, keeping its ID
+// and position in the history, and sets EditedAt. Only the author (clientID)
+// may edit a message; announcements cannot be edited this way.
+//
+// The history entry is swapped by a script that only replaces the member
+// Edit read, so readers never miss the message and a concurrent edit or
+// delete is detected (the script finds nothing) and Edit re-reads the
+// message instead of leaving two versions in the history. The index and
+// protected entries live under other keys (and Cluster slots) and are
+// updated right after; GetByID copes with the index lagging behind.
+//
+// Content over the configured size limit returns an error wrapping
+// models.ErrContentTooLarge.
+func (r *MessageRepository) Edit(ctx context.Context, orgID, groupID, id, clientID, content string) (*models.ChatMessage, error) {
+	if err := models.ValidateContent(content, r.maxContentBytes); err != nil {
+		return nil, err
+	}
+
+	idxKey := indexKey(orgID, groupID)
+	key := groupKey(orgID, groupID)
+
+	for attempt := 0; attempt < maxEditAttempts; attempt++ {
+		member, err := r.client.HGet(ctx, idxKey, id).Result()
+		if err == redis.Nil {
+			return nil, ErrMessageNotFound
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error getting message: %w", err)
+		}
+
+		var msg models.ChatMessage
+		if err := unmarshalMessage(member, &msg); err != nil {
+			return nil, fmt.Errorf("error unmarshaling message: %w", err)
+		}
+		if msg.AnnouncementID != "" || msg.ClientID != clientID {
+			return nil, ErrNotMessageAuthor
+		}
+
+		// An edit keeps the content type, so structured content must still
+		// match its schema
+		edited := content
+		if err := models.ValidateContentType(msg.ContentType, &edited, r.contentTypes); err != nil {
+			return nil, err
+		}
+
+		now := r.clock.Now()
+		msg.Content = r.sanitize.ApplyContent(edited, models.StructuredContent(msg.ContentType))
+		msg.EditedAt = &now
+
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling message: %w", err)
+		}
+		data, err = r.encodePayload(data)
+		if err != nil {
+			return nil, err
+		}
+
+		replaced, err := replaceMemberScript.Run(ctx, r.client, []string{key}, member, data).Int()
+		if err != nil {
+			return nil, fmt.Errorf("error editing message: %w", err)
+		}
+		if replaced == 0 {
+			continue // Edited, deleted or trimmed since it was read
+		}
+
+		pipe := r.client.Pipeline()
+		pipe.HSet(ctx, idxKey, id, data)
+		updateProtectedScript.Eval(ctx, pipe, []string{protectedKey(orgID, groupID)}, id, data)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return nil, fmt.Errorf("error editing message: %w", err)
+		}
+		return &msg, nil
+	}
+
+	// Still missing after retries: the message was deleted or trimmed
+	if _, err := r.GetByID(ctx, orgID, groupID, id); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("error editing message: too many concurrent changes")
 }
 
 // DeleteGroup deletes all messages for a group.
 func (r *MessageRepository) DeleteGroup(ctx context.Context, orgID, groupID string) error {
-	key := fmt.Sprintf("messages:%s:%s", orgID, groupID)
-	return r.client.Del(ctx, key).Err()
+	// Separate commands keep each key in its own hash slot under Redis Cluster
+	pipe := r.client.Pipeline()
+	pipe.Del(ctx, groupKey(orgID, groupID))
+	pipe.Del(ctx, indexKey(orgID, groupID))
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// decodeMessages unmarshals raw sorted-set members into messages, skipping
+// malformed entries and expanding announcement pointers to the full
+// announcement. Pointers whose announcement has expired are dropped.
+func (r *MessageRepository) decodeMessages(ctx context.Context, orgID string, results []string) ([]models.ChatMessage, error) {
+	now := r.clock.Now()
+	messages := make([]models.ChatMessage, 0, len(results))
+	var announcementIDs []string
+	for _, data := range results {
+		var msg models.ChatMessage
+		if err := unmarshalMessage(data, &msg); err != nil {
+			// Skip malformed messages
+			continue
+		}
+		if msg.ExpiresAt != nil && !msg.ExpiresAt.After(now) {
+			// Expired but not yet removed by the janitor
+			continue
+		}
+		if msg.AnnouncementID != "" {
+			announcementIDs = append(announcementIDs, msg.AnnouncementID)
+		}
+		messages = append(messages, msg)
+	}
+
+	if len(announcementIDs) == 0 {
+		return messages, nil
+	}
+
+	values, err := r.client.HMGet(ctx, announcementKey(orgID), announcementIDs...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error getting announcements: %w", err)
+	}
+
+	announcements := make(map[string]models.ChatMessage, len(values))
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var ann models.ChatMessage
+		if err := unmarshalMessage(data, &ann); err != nil {
+			continue
+		}
+		announcements[announcementIDs[i]] = ann
+	}
+
+	expanded := messages[:0]
+	for _, msg := range messages {
+		if msg.AnnouncementID != "" {
+			ann, ok := announcements[msg.AnnouncementID]
+			if !ok {
+				continue
+			}
+			ann.GroupID = msg.GroupID
+			ann.AnnouncementID = msg.AnnouncementID
+			msg = ann
+		}
+		expanded = append(expanded, msg)
+	}
+
+	return expanded, nil
+}
+
+// FilterKinds keeps only the messages whose kind is one of kinds, in place.
+// An empty kinds list keeps every message.
+func FilterKinds(messages []models.ChatMessage, kinds []string) []models.ChatMessage {
+	if len(kinds) == 0 {
+		return messages
+	}
+
+	filtered := messages[:0]
+	for _, msg := range messages {
+		for _, kind := range kinds {
+			if msg.MessageKind() == kind {
+				filtered = append(filtered, msg)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// FilterChannel keeps only the messages tagged with channel, in place.
+// An empty channel keeps every message.
+func FilterChannel(messages []models.ChatMessage, channel string) []models.ChatMessage {
+	if channel == "" {
+		return messages
+	}
+
+	filtered := messages[:0]
+	for _, msg := range messages {
+		if msg.Channel == channel {
+			filtered = append(filtered, msg)
+		}
+	}
+	return filtered
+}
+
+// score converts a timestamp into the sorted-set score used for ordering:
+// Unix microseconds, which a float64 holds exactly until the year 2255.
+// Entries written before scores had sub-second precision hold Unix seconds;
+// MigrateScores rescales them.
+func score(t time.Time) float64 {
+	return float64(t.UnixMicro())
+}
+
+// scoreArg formats a timestamp as a score bound for range commands.
+func scoreArg(t time.Time) string {
+	return strconv.FormatFloat(score(t), 'f', -1, 64)
+}
+
+// scoreTieWindow is how far, in microseconds, a message's score may be
+// moved forward to keep it after the previous one.
+const scoreTieWindow = 1000
+
+// nextScore returns the score for a newly saved message. Messages saved by
+// this process within the same microsecond, or with a clock that stepped
+// back by less than scoreTieWindow, are moved just past the previous
+// message so they keep their insertion order; Redis would otherwise order
+// equal scores by member bytes. Older timestamps, such as backdated
+// messages, keep their own score.
+func (r *MessageRepository) nextScore(t time.Time) float64 {
+	s := t.UnixMicro()
+	for {
+		last := r.lastScore.Load()
+		next := s
+		if next <= last && last-next < scoreTieWindow {
+			next = last + 1
+		}
+		if next <= last {
+			return float64(next)
+		}
+		if r.lastScore.CompareAndSwap(last, next) {
+			return float64(next)
+		}
+	}
+}
+
+// groupKey returns the sorted-set key holding a group's message history.
+func groupKey(orgID, groupID string) string {
+	return fmt.Sprintf("messages:%s:%s", orgID, groupID)
+}
+
+// indexKey returns the hash key mapping message IDs to their stored members.
+func indexKey(orgID, groupID string) string {
+	return fmt.Sprintf("message_index:%s:%s", orgID, groupID)
+}
+
+// dedupeKey returns the idempotency key guarding a message ID supplied by
+// a sender.
+func dedupeKey(orgID, groupID, clientID, id string) string {
+	return fmt.Sprintf("dedupe:%s:%s:%s:%s", orgID, groupID, clientID, id)
+}
+
+// dmRoomsKey returns the sorted set of DM rooms a user participates in,
+// scored by latest activity.
+func dmRoomsKey(userID string) string {
+	return fmt.Sprintf("dm_rooms:%s", userID)
+}
+
+// readMarkersKey returns the hash of a user's read markers.
+func readMarkersKey(userID string) string {
+	return fmt.Sprintf("read_markers:%s", userID)
+}
+
+// markerField returns the read-marker hash field for a group or DM room.
+func markerField(orgID, groupID string) string {
+	return orgID + ":" + groupID
+}
+
+// announcementKey returns the hash key holding an org's announcements.
+func announcementKey(orgID string) string {
+	return fmt.Sprintf("announcements:%s", orgID)
+}
+
+// announcementOrderKey returns the sorted set of an org's announcement IDs,
+// scored by time, used to bound the announcement hash.
+func announcementOrderKey(orgID string) string {
+	return fmt.Sprintf("announcement_order:%s", orgID)
 }
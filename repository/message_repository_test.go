@@ -0,0 +1,542 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"go-realtime-workspace/clock"
+	"go-realtime-workspace/config"
+	"go-realtime-workspace/cursor"
+	"go-realtime-workspace/idgen"
+	"go-realtime-workspace/models"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestMessageRepository returns a message repository with the default
+// configuration, adjusted by configure if it is not nil, backed by an
+// in-memory Redis server.
+func newTestMessageRepository(t *testing.T, configure func(*config.RedisConfig)) (*MessageRepository, *miniredis.Miniredis) {
+	t.Helper()
+	srv := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: srv.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	cfg := config.DefaultConfig()
+	if configure != nil {
+		configure(&cfg.Redis)
+	}
+	return NewMessageRepository(client, cfg.Redis, cfg.Message), srv
+}
+
+func TestTrimmingPrunesIndex(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		repo, srv := newTestMessageRepository(t, func(cfg *config.RedisConfig) {
+			cfg.MaxMessages = 3
+			cfg.CompressPayloads = compress
+			cfg.CompressMinBytes = 1
+		})
+		ctx := context.Background()
+		start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		for i := 0; i < 5; i++ {
+			_, err := repo.Save(ctx, models.ChatMessage{
+				ID:        fmt.Sprintf("m%d", i),
+				OrgID:     "acme",
+				GroupID:   "general",
+				ClientID:  "alice",
+				Content:   strings.Repeat("hello ", 20),
+				Timestamp: start.Add(time.Duration(i) * time.Second),
+			})
+			if err != nil {
+				t.Fatalf("Save: %v", err)
+			}
+		}
+
+		ids, err := srv.HKeys(indexKey("acme", "general"))
+		if err != nil {
+			t.Fatalf("HKeys: %v", err)
+		}
+		sort.Strings(ids)
+		if want := []string{"m2", "m3", "m4"}; !slices.Equal(ids, want) {
+			t.Errorf("compress=%v: index holds %v, want %v", compress, ids, want)
+		}
+	}
+}
+
+func TestSaveDedupesBySender(t *testing.T) {
+	repo, _ := newTestMessageRepository(t, nil)
+	ctx := context.Background()
+	msg := models.ChatMessage{ID: "m1", OrgID: "acme", GroupID: "general", ClientID: "alice", Content: "first"}
+
+	if _, err := repo.Save(ctx, msg); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	retry := msg
+	retry.Content = "retried"
+	saved, err := repo.Save(ctx, retry)
+	if err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if saved.Content != "first" {
+		t.Errorf("retry returned %q, want the original", saved.Content)
+	}
+
+	spoof := msg
+	spoof.ClientID, spoof.Content = "mallory", "replaced"
+	if _, err := repo.Save(ctx, spoof); !errors.Is(err, ErrDuplicateMessage) {
+		t.Fatalf("another sender's ID reuse: got %v, want ErrDuplicateMessage", err)
+	}
+
+	stored, err := repo.GetByID(ctx, "acme", "general", "m1")
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if stored.ClientID != "alice" || stored.Content != "first" {
+		t.Errorf("stored message is %q by %s, want the original", stored.Content, stored.ClientID)
+	}
+	if n, _ := repo.Count(ctx, "acme", "general"); n != 1 {
+		t.Errorf("group holds %d messages, want 1", n)
+	}
+}
+
+func TestSaveRejectsStoredIDWithoutDedupe(t *testing.T) {
+	repo, _ := newTestMessageRepository(t, func(cfg *config.RedisConfig) {
+		cfg.DedupeWindow = 0
+	})
+	ctx := context.Background()
+	msg := models.ChatMessage{ID: "m1", OrgID: "acme", GroupID: "general", ClientID: "alice", Content: "first"}
+
+	if _, err := repo.Save(ctx, msg); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if _, err := repo.Save(ctx, msg); !errors.Is(err, ErrDuplicateMessage) {
+		t.Fatalf("got %v, want ErrDuplicateMessage", err)
+	}
+}
+
+func TestEditReplacesMessageInPlace(t *testing.T) {
+	repo, srv := newTestMessageRepository(t, nil)
+	ctx := context.Background()
+	at := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i, id := range []string{"m1", "m2", "m3"} {
+		msg := models.ChatMessage{ID: id, OrgID: "acme", GroupID: "general", ClientID: "alice", Content: id, Timestamp: at.Add(time.Duration(i) * time.Second)}
+		if _, err := repo.Save(ctx, msg); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+	old := srv.HGet(indexKey("acme", "general"), "m2")
+
+	if _, err := repo.Edit(ctx, "acme", "general", "m2", "bob", "stolen"); !errors.Is(err, ErrNotMessageAuthor) {
+		t.Fatalf("edit by another user: got %v, want ErrNotMessageAuthor", err)
+	}
+	if _, err := repo.Edit(ctx, "acme", "general", "m2", "alice", "edited"); err != nil {
+		t.Fatalf("Edit: %v", err)
+	}
+
+	history, err := repo.GetHistory(ctx, "acme", "general", 10)
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	var got []string
+	for _, msg := range history {
+		got = append(got, msg.ID+"="+msg.Content)
+	}
+	if want := []string{"m3=m3", "m2=edited", "m1=m1"}; !slices.Equal(got, want) {
+		t.Errorf("history %v, want %v", got, want)
+	}
+
+	// A reader that saw the old member must not drop the edited entry
+	dropIndexScript.Run(ctx, repo.client, []string{indexKey("acme", "general")}, "m2", old)
+	stored, err := repo.GetByID(ctx, "acme", "general", "m2")
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if stored.Content != "edited" || stored.EditedAt == nil {
+		t.Errorf("stored %q (edited at %v), want the edit", stored.Content, stored.EditedAt)
+	}
+}
+
+func TestAnnouncementsAreBounded(t *testing.T) {
+	repo, srv := newTestMessageRepository(t, func(cfg *config.RedisConfig) {
+		cfg.MaxMessages = 2
+	})
+	ctx := context.Background()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	if _, err := repo.Save(ctx, models.ChatMessage{ID: "chat", OrgID: "acme", GroupID: "quiet", ClientID: "alice", Content: "hi", Timestamp: start}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	for i := 0; i < 4; i++ {
+		ann := models.ChatMessage{
+			ID:        fmt.Sprintf("a%d", i),
+			OrgID:     "acme",
+			Content:   "news",
+			Timestamp: start.Add(time.Duration(i+1) * time.Second),
+		}
+		groups := []string{"general"}
+		if i == 0 {
+			groups = append(groups, "quiet")
+		}
+		if err := repo.SaveAnnouncement(ctx, ann, groups); err != nil {
+			t.Fatalf("SaveAnnouncement: %v", err)
+		}
+	}
+
+	ids, err := srv.HKeys(announcementKey("acme"))
+	if err != nil {
+		t.Fatalf("HKeys: %v", err)
+	}
+	sort.Strings(ids)
+	if want := []string{"a2", "a3"}; !slices.Equal(ids, want) {
+		t.Errorf("announcements %v, want %v", ids, want)
+	}
+
+	// The quiet group still points at a0, which is gone
+	history, err := repo.GetHistory(ctx, "acme", "quiet", 10)
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	if len(history) != 1 || history[0].ID != "chat" {
+		t.Errorf("quiet group history %+v, want only the chat message", history)
+	}
+}
+
+func TestAnnouncementStoredOnce(t *testing.T) {
+	repo, srv := newTestMessageRepository(t, nil)
+	ctx := context.Background()
+	ann := models.ChatMessage{
+		ID:        "ann",
+		OrgID:     "acme",
+		Content:   "office closed friday",
+		Timestamp: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	if err := repo.SaveAnnouncement(ctx, ann, []string{"general", "random"}); err != nil {
+		t.Fatalf("SaveAnnouncement: %v", err)
+	}
+
+	for _, groupID := range []string{"general", "random"} {
+		history, err := repo.GetHistory(ctx, "acme", groupID, 10)
+		if err != nil {
+			t.Fatalf("GetHistory: %v", err)
+		}
+		if len(history) != 1 || history[0].ID != "ann" || history[0].Content != ann.Content {
+			t.Errorf("%s history %+v, want the announcement", groupID, history)
+		}
+
+		// Groups hold a pointer, not a copy of the content
+		members, err := srv.ZMembers(groupKey("acme", groupID))
+		if err != nil {
+			t.Fatalf("ZMembers: %v", err)
+		}
+		for _, member := range members {
+			if strings.Contains(member, ann.Content) {
+				t.Errorf("%s history stores the announcement content: %s", groupID, member)
+			}
+		}
+	}
+
+	ids, err := srv.HKeys(announcementKey("acme"))
+	if err != nil {
+		t.Fatalf("HKeys: %v", err)
+	}
+	if want := []string{"ann"}; !slices.Equal(ids, want) {
+		t.Errorf("announcements %v, want %v", ids, want)
+	}
+}
+
+func TestResolveQuotes(t *testing.T) {
+	repo, _ := newTestMessageRepository(t, nil)
+	ctx := context.Background()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	long := strings.Repeat("é", quoteSnippetLength+20)
+
+	for i, msg := range []models.ChatMessage{
+		{ID: "short", ClientID: "alice", Username: "Alice", Content: "lunch?"},
+		{ID: "long", ClientID: "bob", Content: long},
+	} {
+		msg.OrgID, msg.GroupID = "acme", "general"
+		msg.Timestamp = start.Add(time.Duration(i) * time.Second)
+		if _, err := repo.Save(ctx, msg); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+
+	replies := []models.ChatMessage{
+		{ID: "r1", ReplyToID: "short"},
+		{ID: "r2", ReplyToID: "long"},
+		{ID: "r3", ReplyToID: "missing"},
+		{ID: "r4"},
+	}
+	repo.ResolveQuotes(ctx, "acme", "general", replies)
+
+	if q := replies[0].Quote; q == nil || q.ID != "short" || q.ClientID != "alice" || q.Username != "Alice" || q.Snippet != "lunch?" {
+		t.Errorf("reply to short: quote %+v", q)
+	}
+	if q := replies[1].Quote; q == nil || q.Snippet != strings.Repeat("é", quoteSnippetLength)+"…" {
+		t.Errorf("reply to long: quote %+v, want a truncated snippet", q)
+	}
+	if replies[2].Quote != nil || replies[3].Quote != nil {
+		t.Errorf("got quotes %+v and %+v, want none", replies[2].Quote, replies[3].Quote)
+	}
+
+	// Quotes resolve within the group only
+	other := []models.ChatMessage{{ID: "r5", ReplyToID: "short"}}
+	repo.ResolveQuotes(ctx, "acme", "random", other)
+	if other[0].Quote != nil {
+		t.Errorf("reply in another group quoted %+v", other[0].Quote)
+	}
+}
+
+func TestDMConversationsSortedByActivity(t *testing.T) {
+	repo, _ := newTestMessageRepository(t, nil)
+	ctx := context.Background()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i, dm := range []struct{ room, from, to string }{
+		{"alice_bob", "bob", "alice"},
+		{"alice_bob", "alice", "bob"},
+		{"alice_dave", "dave", "alice"},
+		{"alice_dave", "alice", "dave"},
+		{"alice_carol", "carol", "alice"},
+		{"alice_carol", "carol", "alice"},
+	} {
+		_, err := repo.Save(ctx, models.ChatMessage{
+			ID:          fmt.Sprintf("m%d", i),
+			OrgID:       DMOrgID,
+			GroupID:     dm.room,
+			ClientID:    dm.from,
+			RecipientID: dm.to,
+			Content:     "hello",
+			Timestamp:   start.Add(time.Duration(i) * time.Second),
+		})
+		if err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+
+	conversations, err := repo.GetDMConversations(ctx, "alice", 10)
+	if err != nil {
+		t.Fatalf("GetDMConversations: %v", err)
+	}
+	type summary struct {
+		peer   string
+		last   string
+		unread int64
+	}
+	var got []summary
+	for _, c := range conversations {
+		got = append(got, summary{c.PeerID, c.LastMessage.ID, c.UnreadCount})
+	}
+	want := []summary{{"carol", "m5", 2}, {"dave", "m3", 0}, {"bob", "m1", 0}}
+	if !slices.Equal(got, want) {
+		t.Errorf("conversations %+v, want %+v", got, want)
+	}
+
+	if conversations, _ := repo.GetDMConversations(ctx, "alice", 2); len(conversations) != 2 || conversations[1].PeerID != "dave" {
+		t.Errorf("limited to 2: got %+v", conversations)
+	}
+	if conversations, _ := repo.GetDMConversations(ctx, "bob", 10); len(conversations) != 1 || conversations[0].PeerID != "alice" {
+		t.Errorf("bob's conversations %+v, want only alice", conversations)
+	}
+}
+
+func TestSaveSanitizesContent(t *testing.T) {
+	for _, tt := range []struct {
+		mode string
+		want string
+	}{
+		{"off", `<script>alert(1)</script>hi`},
+		{"escape", `&lt;script&gt;alert(1)&lt;/script&gt;hi`},
+		{"strip", `hi`},
+	} {
+		srv := miniredis.RunT(t)
+		client := redis.NewClient(&redis.Options{Addr: srv.Addr()})
+		defer client.Close()
+		cfg := config.DefaultConfig()
+		cfg.Message.Sanitize = tt.mode
+		repo := NewMessageRepository(client, cfg.Redis, cfg.Message)
+		ctx := context.Background()
+
+		msg := models.ChatMessage{ID: "m1", OrgID: "acme", GroupID: "general", ClientID: "mallory", Content: `<script>alert(1)</script>hi`}
+		if _, err := repo.Save(ctx, msg); err != nil {
+			t.Fatalf("%s: Save: %v", tt.mode, err)
+		}
+		history, err := repo.GetHistory(ctx, "acme", "general", 10)
+		if err != nil {
+			t.Fatalf("%s: GetHistory: %v", tt.mode, err)
+		}
+		if len(history) != 1 || history[0].Content != tt.want {
+			t.Errorf("%s: stored %+v, want content %q", tt.mode, history, tt.want)
+		}
+	}
+}
+
+func TestMarkAllReadClearsUnreadCounts(t *testing.T) {
+	for _, includeDMs := range []bool{false, true} {
+		repo, _ := newTestMessageRepository(t, nil)
+		ctx := context.Background()
+		start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		saveAt(t, repo, "acme", "general", "g1", "hi", 0)
+		saveAt(t, repo, "acme", "random", "r1", "hi", 1)
+		saveAt(t, repo, "acme", "archived", "a1", "hi", 2)
+		dm := models.ChatMessage{ID: "d1", OrgID: DMOrgID, GroupID: "alice_bob", ClientID: "bob", RecipientID: "alice", Content: "hi", Timestamp: start.Add(3 * time.Second)}
+		if _, err := repo.Save(ctx, dm); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+		// A group the hub no longer knows about, read long ago
+		if err := repo.MarkRead(ctx, "alice", "acme", "archived", start.Add(-time.Hour)); err != nil {
+			t.Fatalf("MarkRead: %v", err)
+		}
+
+		marked, err := repo.MarkAllRead(ctx, "alice", "acme", []string{"general", "random"}, includeDMs, start.Add(time.Minute))
+		if err != nil {
+			t.Fatalf("MarkAllRead: %v", err)
+		}
+		want := 3
+		if includeDMs {
+			want = 4
+		}
+		if marked != want {
+			t.Errorf("includeDMs=%v: marked %d conversations, want %d", includeDMs, marked, want)
+		}
+
+		for _, conv := range []struct{ orgID, groupID string }{{"acme", "general"}, {"acme", "random"}, {"acme", "archived"}, {DMOrgID, "alice_bob"}} {
+			unread, err := repo.UnreadCount(ctx, "alice", conv.orgID, conv.groupID)
+			if err != nil {
+				t.Fatalf("UnreadCount: %v", err)
+			}
+			wantUnread := int64(0)
+			if conv.orgID == DMOrgID && !includeDMs {
+				wantUnread = 1
+			}
+			if unread != wantUnread {
+				t.Errorf("includeDMs=%v: %s/%s has %d unread, want %d", includeDMs, conv.orgID, conv.groupID, unread, wantUnread)
+			}
+		}
+	}
+}
+
+func TestGetByIDsReportsMissing(t *testing.T) {
+	repo, srv := newTestMessageRepository(t, func(cfg *config.RedisConfig) {
+		cfg.MaxMessages = 4
+	})
+	ctx := context.Background()
+	for i := 1; i <= 6; i++ {
+		id := fmt.Sprintf("m%d", i)
+		saveAt(t, repo, "acme", "general", id, id, i)
+	}
+	// m1 and m2 were trimmed by the cap; m4 is deleted
+	if err := repo.Delete(ctx, "acme", "general", "m4"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	// m5's history entry is gone but its index entry was left behind
+	if _, err := srv.ZRem(groupKey("acme", "general"), srv.HGet(indexKey("acme", "general"), "m5")); err != nil {
+		t.Fatalf("ZRem: %v", err)
+	}
+
+	found, missing, err := repo.GetByIDs(ctx, "acme", "general", []string{"m6", "m1", "nope", "m4", "m3", "m5", "m6"})
+	if err != nil {
+		t.Fatalf("GetByIDs: %v", err)
+	}
+	if got := messageIDs(found); !slices.Equal(got, []string{"m6", "m3"}) {
+		t.Errorf("found %v, want [m6 m3]", got)
+	}
+	if !slices.Equal(missing, []string{"m1", "nope", "m4", "m5"}) {
+		t.Errorf("missing %v, want [m1 nope m4 m5]", missing)
+	}
+	if srv.HGet(indexKey("acme", "general"), "m5") != "" {
+		t.Error("stale index entry of m5 was not dropped")
+	}
+}
+
+func TestSwitchingIDSchemeKeepsExistingMessages(t *testing.T) {
+	repo, _ := newTestMessageRepository(t, nil)
+	ctx := context.Background()
+	fake := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	repo.SetClock(fake)
+	save := func() string {
+		t.Helper()
+		saved, err := repo.Save(ctx, models.ChatMessage{OrgID: "acme", GroupID: "general", ClientID: "alice", Content: "hi"})
+		if err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+		fake.Advance(time.Second)
+		return saved.ID
+	}
+
+	legacy := save() // A random UUID
+	repo.SetIDGenerator(idgen.NewULID(fake))
+	first, second := save(), save()
+	if len(first) != 26 || second <= first {
+		t.Errorf("IDs %q then %q, want increasing ULIDs", first, second)
+	}
+
+	for _, id := range []string{legacy, first, second} {
+		if _, err := repo.GetByID(ctx, "acme", "general", id); err != nil {
+			t.Errorf("GetByID(%s): %v", id, err)
+		}
+	}
+	history, err := repo.GetHistory(ctx, "acme", "general", 10)
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	if got, want := messageIDs(history), []string{second, first, legacy}; !slices.Equal(got, want) {
+		t.Errorf("history %v, want %v", got, want)
+	}
+}
+
+func TestHistoryPagesAreStableUnderInserts(t *testing.T) {
+	repo, _ := newTestMessageRepository(t, nil)
+	ctx := context.Background()
+	// Several messages share a timestamp, and so a score
+	offsets := map[string]int{"m1": 1, "m2": 2, "m3": 2, "m4": 2, "m5": 3, "m6": 4, "m7": 4, "m8": 5}
+	for id, offset := range offsets {
+		saveAt(t, repo, "acme", "general", id, "hi", offset)
+	}
+
+	seen := make(map[string]bool)
+	var read []string
+	var after *cursor.Position
+	for page := 0; ; page++ {
+		messages, next, err := repo.GetHistoryPage(ctx, "acme", "general", after, 3)
+		if err != nil {
+			t.Fatalf("GetHistoryPage: %v", err)
+		}
+		for _, msg := range messages {
+			if seen[msg.ID] {
+				t.Errorf("page %d repeats %s", page, msg.ID)
+			}
+			seen[msg.ID] = true
+			read = append(read, msg.ID)
+		}
+		if next == nil {
+			break
+		}
+		// Messages arriving between pages are newer than every page
+		saveAt(t, repo, "acme", "general", fmt.Sprintf("new%d", page), "late", 100+page)
+		after = next
+	}
+
+	if len(read) != len(offsets) {
+		t.Fatalf("read %v, want the %d messages there were at the start", read, len(offsets))
+	}
+	for i, id := range read {
+		if _, ok := offsets[id]; !ok {
+			t.Errorf("read %s, which arrived after paging began", id)
+		}
+		if i > 0 && offsets[id] > offsets[read[i-1]] {
+			t.Errorf("%s after %s, want newest first", id, read[i-1])
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"go-realtime-workspace/models"
+
+	"github.com/lib/pq"
+)
+
+// ErrUnknownUser is returned by SetPrefs and InviteRepository.Accept when
+// the user does not exist.
+var ErrUnknownUser = errors.New("user not found")
+
+// NotificationRepository stores per-user notification preferences in PostgreSQL.
+type NotificationRepository struct {
+	db *sql.DB
+}
+
+// NewNotificationRepository creates a new notification preferences repository.
+func NewNotificationRepository(db *sql.DB) *NotificationRepository {
+	return &NotificationRepository{db: db}
+}
+
+// GetPrefs returns a user's notification preferences. Users who have never
+// set any get every notification.
+func (r *NotificationRepository) GetPrefs(ctx context.Context, userID string) (*models.NotificationPrefs, error) {
+	prefs := &models.NotificationPrefs{UserID: userID, Level: models.NotifyAll, MutedGroups: []models.GroupRef{}}
+
+	var muted []byte
+	var updatedAt time.Time
+	err := r.db.QueryRowContext(ctx, `
+		SELECT level, muted_groups, updated_at FROM notification_prefs WHERE user_id = $1
+	`, userID).Scan(&prefs.Level, &muted, &updatedAt)
+	if err == sql.ErrNoRows {
+		return prefs, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting notification preferences: %w", err)
+	}
+
+	if err := json.Unmarshal(muted, &prefs.MutedGroups); err != nil {
+		return nil, fmt.Errorf("error decoding muted groups: %w", err)
+	}
+	prefs.UpdatedAt = &updatedAt
+	return prefs, nil
+}
+
+// SetPrefs replaces a user's notification preferences.
+func (r *NotificationRepository) SetPrefs(ctx context.Context, userID string, req models.SetNotificationPrefsRequest) (*models.NotificationPrefs, error) {
+	if req.MutedGroups == nil {
+		req.MutedGroups = []models.GroupRef{}
+	}
+	muted, err := json.Marshal(req.MutedGroups)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding muted groups: %w", err)
+	}
+
+	var updatedAt time.Time
+	err = r.db.QueryRowContext(ctx, `
+		INSERT INTO notification_prefs (user_id, level, muted_groups)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id)
+		DO UPDATE SET level = EXCLUDED.level, muted_groups = EXCLUDED.muted_groups, updated_at = CURRENT_TIMESTAMP
+		RETURNING updated_at
+	`, userID, req.Level, muted).Scan(&updatedAt)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+			return nil, ErrUnknownUser
+		}
+		return nil, fmt.Errorf("error setting notification preferences: %w", err)
+	}
+
+	return &models.NotificationPrefs{
+		UserID:      userID,
+		Level:       req.Level,
+		MutedGroups: req.MutedGroups,
+		UpdatedAt:   &updatedAt,
+	}, nil
+}
+
+// ShouldNotify reports whether event should push a notification to a user.
+// If the preferences cannot be read the user is notified, so an outage does
+// not silently drop notifications.
+func (r *NotificationRepository) ShouldNotify(ctx context.Context, userID, event, orgID, groupID string) bool {
+	prefs, err := r.GetPrefs(ctx, userID)
+	if err != nil {
+		log.Printf("Error checking notification preferences for user %s: %v", userID, err)
+		return true
+	}
+	return prefs.Allows(event, orgID, groupID)
+}
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"go-realtime-workspace/models"
+)
+
+// gzipMagic prefixes stored payloads that are gzip-compressed. Plain JSON
+// payloads always start with '{', so compressed and uncompressed entries can
+// coexist and are told apart by their first byte.
+const gzipMagic byte = 0x01
+
+// encodePayload compresses a serialized message when compression is enabled
+// and the payload is large enough for it to pay off.
+func (r *MessageRepository) encodePayload(data []byte) ([]byte, error) {
+	if !r.cfg.CompressPayloads || len(data) < r.cfg.CompressMinBytes {
+		return data, nil
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte(gzipMagic)
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, fmt.Errorf("error compressing message: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("error compressing message: %w", err)
+	}
+
+	// Keep the original if compression did not make it smaller
+	if buf.Len() >= len(data) {
+		return data, nil
+	}
+	return buf.Bytes(), nil
+}
+
+// decodePayload returns the JSON of a stored payload, decompressing it if needed.
+func decodePayload(data string) ([]byte, error) {
+	if len(data) == 0 || data[0] != gzipMagic {
+		return []byte(data), nil
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader([]byte(data[1:])))
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing message: %w", err)
+	}
+	defer zr.Close()
+
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing message: %w", err)
+	}
+	return raw, nil
+}
+
+// unmarshalMessage decodes a stored payload, compressed or not, into msg.
+func unmarshalMessage(data string, msg *models.ChatMessage) error {
+	raw, err := decodePayload(data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, msg)
+}
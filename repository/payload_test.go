@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"go-realtime-workspace/config"
+	"go-realtime-workspace/models"
+)
+
+// compressed configures a repository to compress every payload that shrinks.
+func compressed(cfg *config.RedisConfig) {
+	cfg.CompressPayloads = true
+	cfg.CompressMinBytes = 1
+}
+
+func TestCompressedPayloadRoundTrip(t *testing.T) {
+	repo, srv := newTestMessageRepository(t, compressed)
+	ctx := context.Background()
+	content := strings.Repeat("hello world ", 50)
+
+	if _, err := repo.Save(ctx, models.ChatMessage{ID: "m1", OrgID: "acme", GroupID: "general", ClientID: "alice", Content: content}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	stored := srv.HGet(indexKey("acme", "general"), "m1")
+	if stored == "" || stored[0] != gzipMagic {
+		t.Fatal("payload was not stored compressed")
+	}
+	if len(stored) >= len(content) {
+		t.Errorf("compressed payload is %d bytes, content alone is %d", len(stored), len(content))
+	}
+
+	msg, err := repo.GetByID(ctx, "acme", "general", "m1")
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if msg.Content != content {
+		t.Errorf("GetByID content %q, want the original", msg.Content)
+	}
+	history, err := repo.GetHistory(ctx, "acme", "general", 10)
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	if len(history) != 1 || history[0].Content != content {
+		t.Errorf("history %v, want the original message", messageIDs(history))
+	}
+}
+
+func TestLegacyPayloadStillReads(t *testing.T) {
+	repo, srv := newTestMessageRepository(t, compressed)
+	ctx := context.Background()
+
+	// An entry written before compression was enabled
+	legacy := models.ChatMessage{
+		ID: "old", OrgID: "acme", GroupID: "general", ClientID: "alice",
+		Content: "from before", Timestamp: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	data, err := json.Marshal(legacy)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if _, err := srv.ZAdd(groupKey("acme", "general"), score(legacy.Timestamp), string(data)); err != nil {
+		t.Fatalf("ZAdd: %v", err)
+	}
+	srv.HSet(indexKey("acme", "general"), "old", string(data))
+
+	content := strings.Repeat("compressed ", 50)
+	if _, err := repo.Save(ctx, models.ChatMessage{
+		ID: "new", OrgID: "acme", GroupID: "general", ClientID: "alice",
+		Content: content, Timestamp: legacy.Timestamp.Add(time.Minute),
+	}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	msg, err := repo.GetByID(ctx, "acme", "general", "old")
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if msg.Content != "from before" {
+		t.Errorf("legacy content %q, want %q", msg.Content, "from before")
+	}
+	history, err := repo.GetHistory(ctx, "acme", "general", 10)
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	// Newest first
+	if len(history) != 2 || history[0].Content != content || history[1].Content != "from before" {
+		t.Errorf("history %v, want the compressed and the legacy message", messageIDs(history))
+	}
+}
+
+func TestSmallPayloadsStayUncompressed(t *testing.T) {
+	repo, srv := newTestMessageRepository(t, func(cfg *config.RedisConfig) {
+		cfg.CompressPayloads = true
+		cfg.CompressMinBytes = 512
+	})
+	if _, err := repo.Save(context.Background(), models.ChatMessage{ID: "m1", OrgID: "acme", GroupID: "general", ClientID: "alice", Content: "hi"}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if stored := srv.HGet(indexKey("acme", "general"), "m1"); !strings.HasPrefix(stored, "{") {
+		t.Errorf("small payload stored as %q, want plain JSON", stored)
+	}
+}
@@ -0,0 +1,255 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"go-realtime-workspace/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrTooManyPins is returned by Pin when the group already has
+// MaxPinsPerGroup pinned messages.
+var ErrTooManyPins = errors.New("group has reached the pinned message limit")
+
+// trimScript removes the oldest entries of a history sorted set, skipping
+// the protected members given after the first two arguments. With
+// ARGV[1] "keep" it trims the history down to ARGV[2] unprotected entries;
+// with "remove" it removes ARGV[2] unprotected entries. Protected entries
+// are therefore kept in addition to the cap. Returns the removed members,
+// for dropTrimmed.
+var trimScript = redis.NewScript(`
+local protected, present = {}, 0
+for i = 3, #ARGV do
+	if not protected[ARGV[i]] and redis.call("ZSCORE", KEYS[1], ARGV[i]) then
+		protected[ARGV[i]] = true
+		present = present + 1
+	end
+end
+
+local excess = tonumber(ARGV[2])
+if ARGV[1] == "keep" then
+	excess = redis.call("ZCARD", KEYS[1]) - present - excess
+end
+if excess <= 0 then
+	return {}
+end
+
+local removed = {}
+for _, member in ipairs(redis.call("ZRANGE", KEYS[1], 0, excess + present - 1)) do
+	if #removed >= excess then
+		break
+	end
+	if not protected[member] then
+		redis.call("ZREM", KEYS[1], member)
+		removed[#removed + 1] = member
+	end
+end
+return removed
+`)
+
+// updateProtectedScript replaces the stored member of a protected message
+// after an edit, leaving unprotected messages alone.
+var updateProtectedScript = redis.NewScript(`
+if redis.call("HEXISTS", KEYS[1], ARGV[1]) == 1 then
+	redis.call("HSET", KEYS[1], ARGV[1], ARGV[2])
+end
+return 0
+`)
+
+// protectedMembers returns the stored members of a group's messages that
+// trimming must skip.
+func (r *MessageRepository) protectedMembers(ctx context.Context, orgID, groupID string) ([]string, error) {
+	members, err := r.client.HVals(ctx, protectedKey(orgID, groupID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error getting protected messages: %w", err)
+	}
+	return members, nil
+}
+
+// trimHistory trims a group's history to MaxMessages as part of pipe,
+// keeping protected messages beyond the cap, and keeps the protection
+// alive as long as the history. Once pipe has run, the returned command
+// must be passed to dropTrimmed.
+func (r *MessageRepository) trimHistory(ctx context.Context, pipe redis.Pipeliner, orgID, groupID string, protected []string) *redis.Cmd {
+	args := make([]interface{}, 0, len(protected)+2)
+	args = append(args, "keep", r.cfg.MaxMessages)
+	for _, member := range protected {
+		args = append(args, member)
+	}
+	trimmed := trimScript.Eval(ctx, pipe, []string{groupKey(orgID, groupID)}, args...)
+
+	if len(protected) > 0 {
+		pipe.Expire(ctx, protectedKey(orgID, groupID), r.cfg.MessageTTL)
+		pipe.Expire(ctx, protectRefsKey(orgID, groupID), r.cfg.MessageTTL)
+		pipe.Expire(ctx, pinsKey(orgID, groupID), r.cfg.MessageTTL)
+	}
+	return trimmed
+}
+
+// dropTrimmed removes the messages trimmed by trimScript from the group's
+// ID index, so the index does not outgrow the history. With tracked, for
+// saves counted towards the org's quota usage, it also takes them off the
+// cached usage. The index lives in another hash slot under
+// Redis Cluster, so it cannot be pruned by the script itself; an entry left
+// behind by a failure here is dropped by GetByID when it is next looked up.
+func (r *MessageRepository) dropTrimmed(ctx context.Context, orgID, groupID string, trimmed *redis.Cmd, tracked bool) {
+	members, err := trimmed.StringSlice()
+	if err != nil || len(members) == 0 {
+		return
+	}
+
+	ids := make([]string, 0, len(members))
+	size := 0
+	for _, member := range members {
+		var msg models.ChatMessage
+		if err := unmarshalMessage(member, &msg); err == nil && msg.ID != "" {
+			ids = append(ids, msg.ID)
+		}
+		size += 2 * len(member) // Stored in the history and in the index, as counted by Save
+	}
+
+	pipe := r.client.Pipeline()
+	if len(ids) > 0 {
+		pipe.HDel(ctx, indexKey(orgID, groupID), ids...)
+	}
+	if tracked {
+		addUsage.Eval(ctx, pipe, []string{quotaUsageKey(orgID)}, -len(members), -size)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Error dropping %d trimmed messages of %s/%s: %v", len(members), orgID, groupID, err)
+	}
+}
+
+// protect exempts a message from trimming for one more reason (a pin, or a
+// star when ProtectStarred is set). It returns ErrMessageNotFound if the
+// message is not indexed.
+func (r *MessageRepository) protect(ctx context.Context, orgID, groupID, id string) error {
+	member, err := r.client.HGet(ctx, indexKey(orgID, groupID), id).Result()
+	if err == redis.Nil {
+		return ErrMessageNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("error getting message: %w", err)
+	}
+
+	pipe := r.client.Pipeline()
+	pipe.HIncrBy(ctx, protectRefsKey(orgID, groupID), id, 1)
+	pipe.HSet(ctx, protectedKey(orgID, groupID), id, member)
+	pipe.Expire(ctx, protectRefsKey(orgID, groupID), r.cfg.MessageTTL)
+	pipe.Expire(ctx, protectedKey(orgID, groupID), r.cfg.MessageTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("error protecting message: %w", err)
+	}
+	return nil
+}
+
+// unprotect drops one reason to exempt a message from trimming; the
+// message is trimmed normally again once no reason is left.
+func (r *MessageRepository) unprotect(ctx context.Context, orgID, groupID, id string) error {
+	refs, err := r.client.HIncrBy(ctx, protectRefsKey(orgID, groupID), id, -1).Result()
+	if err != nil {
+		return fmt.Errorf("error unprotecting message: %w", err)
+	}
+	if refs > 0 {
+		return nil
+	}
+
+	pipe := r.client.Pipeline()
+	pipe.HDel(ctx, protectRefsKey(orgID, groupID), id)
+	pipe.HDel(ctx, protectedKey(orgID, groupID), id)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("error unprotecting message: %w", err)
+	}
+	return nil
+}
+
+// forgetProtection removes a deleted message's pin and protection as part
+// of pipe.
+func forgetProtection(ctx context.Context, pipe redis.Pipeliner, orgID, groupID, id string) {
+	pipe.ZRem(ctx, pinsKey(orgID, groupID), id)
+	pipe.HDel(ctx, protectRefsKey(orgID, groupID), id)
+	pipe.HDel(ctx, protectedKey(orgID, groupID), id)
+}
+
+// Pin pins a message of a group. Pinned messages are listed by ListPins and
+// are never trimmed from the history, even past MaxMessages. Pinning an
+// already pinned message is a no-op. It returns ErrMessageNotFound if the
+// message is not stored and ErrTooManyPins once the group has
+// MaxPinsPerGroup pins.
+func (r *MessageRepository) Pin(ctx context.Context, orgID, groupID, id string) error {
+	if _, err := r.GetByID(ctx, orgID, groupID, id); err != nil {
+		return err
+	}
+
+	key := pinsKey(orgID, groupID)
+	pipe := r.client.Pipeline()
+	count := pipe.ZCard(ctx, key)
+	pinned := pipe.ZScore(ctx, key, id)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return fmt.Errorf("error getting pins: %w", err)
+	}
+	if pinned.Err() == nil {
+		return nil
+	}
+	if max := r.cfg.MaxPinsPerGroup; max > 0 && count.Val() >= int64(max) {
+		return ErrTooManyPins
+	}
+
+	pipe = r.client.Pipeline()
+	added := pipe.ZAddNX(ctx, key, redis.Z{Score: score(r.clock.Now()), Member: id})
+	pipe.Expire(ctx, key, r.cfg.MessageTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("error pinning message: %w", err)
+	}
+	if added.Val() == 0 {
+		return nil // Pinned concurrently
+	}
+	return r.protect(ctx, orgID, groupID, id)
+}
+
+// Unpin unpins a message of a group. Unpinning a message that is not
+// pinned is a no-op.
+func (r *MessageRepository) Unpin(ctx context.Context, orgID, groupID, id string) error {
+	removed, err := r.client.ZRem(ctx, pinsKey(orgID, groupID), id).Result()
+	if err != nil {
+		return fmt.Errorf("error unpinning message: %w", err)
+	}
+	if removed == 0 {
+		return nil
+	}
+	return r.unprotect(ctx, orgID, groupID, id)
+}
+
+// ListPins returns the pinned messages of a group, most recently pinned
+// first. Pins of messages that are not currently stored, such as soft-deleted
+// ones that may still be restored, are left out.
+func (r *MessageRepository) ListPins(ctx context.Context, orgID, groupID string) ([]models.ChatMessage, error) {
+	ids, err := r.client.ZRevRange(ctx, pinsKey(orgID, groupID), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error getting pins: %w", err)
+	}
+	messages, _, err := r.GetByIDs(ctx, orgID, groupID, ids)
+	return messages, err
+}
+
+// pinsKey returns the sorted set of a group's pinned message IDs, scored by
+// when they were pinned.
+func pinsKey(orgID, groupID string) string {
+	return fmt.Sprintf("pins:%s:%s", orgID, groupID)
+}
+
+// protectedKey returns the hash mapping the IDs of a group's messages that
+// trimming skips to their stored members.
+func protectedKey(orgID, groupID string) string {
+	return fmt.Sprintf("protected:%s:%s", orgID, groupID)
+}
+
+// protectRefsKey returns the hash counting, per message ID, the reasons a
+// message is protected from trimming.
+func protectRefsKey(orgID, groupID string) string {
+	return fmt.Sprintf("protect_refs:%s:%s", orgID, groupID)
+}
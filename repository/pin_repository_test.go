@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"go-realtime-workspace/config"
+)
+
+func TestPinnedMessageSurvivesTrimming(t *testing.T) {
+	repo, srv := newTestMessageRepository(t, func(cfg *config.RedisConfig) {
+		cfg.MaxMessages = 3
+	})
+	ctx := context.Background()
+
+	saveAt(t, repo, "acme", "general", "pinned", "keep me", 0)
+	saveAt(t, repo, "acme", "general", "old", "not pinned", 1)
+	if err := repo.Pin(ctx, "acme", "general", "pinned"); err != nil {
+		t.Fatalf("Pin: %v", err)
+	}
+	for i := 1; i <= 4; i++ {
+		saveAt(t, repo, "acme", "general", fmt.Sprintf("m%d", i), "filler", i+1)
+	}
+
+	// The cap applies to unpinned messages; the pinned one is kept on top
+	members, err := srv.ZMembers(groupKey("acme", "general"))
+	if err != nil {
+		t.Fatalf("ZMembers: %v", err)
+	}
+	if len(members) != 4 {
+		t.Errorf("history holds %d entries, want 3 unpinned plus the pinned one", len(members))
+	}
+	if msg, err := repo.GetByID(ctx, "acme", "general", "pinned"); err != nil || msg.Content != "keep me" {
+		t.Errorf("pinned message: got %+v, %v", msg, err)
+	}
+	if _, err := repo.GetByID(ctx, "acme", "general", "old"); !errors.Is(err, ErrMessageNotFound) {
+		t.Errorf("unpinned old message: got %v, want ErrMessageNotFound", err)
+	}
+
+	// Once unpinned, it is trimmed like any other message
+	if err := repo.Unpin(ctx, "acme", "general", "pinned"); err != nil {
+		t.Fatalf("Unpin: %v", err)
+	}
+	saveAt(t, repo, "acme", "general", "m5", "filler", 6)
+	if _, err := repo.GetByID(ctx, "acme", "general", "pinned"); !errors.Is(err, ErrMessageNotFound) {
+		t.Errorf("unpinned message: got %v, want ErrMessageNotFound", err)
+	}
+}
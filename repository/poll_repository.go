@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"go-realtime-workspace/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Errors returned by Vote.
+var (
+	ErrPollNotFound = errors.New("poll not found")
+	ErrPollClosed   = errors.New("poll is closed")
+)
+
+// CreatePoll stores msg.Poll and the history entry of kind KindPoll that
+// posts it to the group, with msg.Content as the question. The poll takes
+// the entry's ID, and its question and options are sanitized like message
+// content. Polls expire with the group's history TTL.
+func (r *MessageRepository) CreatePoll(ctx context.Context, msg models.ChatMessage) (*models.ChatMessage, error) {
+	if msg.Poll == nil {
+		return nil, fmt.Errorf("%w: no poll given", models.ErrInvalidPoll)
+	}
+
+	poll := *msg.Poll
+	poll.ID = r.ids.NewID()
+	poll.OrgID, poll.GroupID = msg.OrgID, msg.GroupID
+	if poll.CreatedAt.IsZero() {
+		poll.CreatedAt = r.clock.Now()
+	}
+	poll.Question = r.sanitize.Apply(poll.Question)
+	poll.Options = append([]string(nil), poll.Options...)
+	for i, option := range poll.Options {
+		poll.Options[i] = r.sanitize.Apply(option)
+	}
+
+	data, err := json.Marshal(poll)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling poll: %w", err)
+	}
+	if err := r.client.Set(ctx, pollKey(poll.OrgID, poll.GroupID, poll.ID), data, r.cfg.MessageTTL).Err(); err != nil {
+		return nil, fmt.Errorf("error storing poll: %w", err)
+	}
+
+	msg.ID, msg.Kind, msg.Timestamp = poll.ID, models.KindPoll, poll.CreatedAt
+	msg.Poll = &poll
+	return r.save(ctx, msg)
+}
+
+// Poll returns a stored poll, or ErrPollNotFound.
+func (r *MessageRepository) Poll(ctx context.Context, orgID, groupID, pollID string) (*models.Poll, error) {
+	data, err := r.client.Get(ctx, pollKey(orgID, groupID, pollID)).Bytes()
+	if err == redis.Nil {
+		return nil, ErrPollNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting poll: %w", err)
+	}
+
+	var poll models.Poll
+	if err := json.Unmarshal(data, &poll); err != nil {
+		return nil, fmt.Errorf("error unmarshaling poll: %w", err)
+	}
+	return &poll, nil
+}
+
+// Vote records userID's choice of options on a poll, replacing any earlier
+// vote; an empty choice withdraws it. It returns ErrPollNotFound,
+// ErrPollClosed once the poll's close time has passed, or an error
+// wrapping models.ErrInvalidPoll for options the poll does not accept, and
+// otherwise the updated results.
+func (r *MessageRepository) Vote(ctx context.Context, orgID, groupID, pollID, userID string, options []int) (*models.PollResults, error) {
+	poll, err := r.Poll(ctx, orgID, groupID, pollID)
+	if err != nil {
+		return nil, err
+	}
+	if poll.Closed(r.clock.Now()) {
+		return nil, ErrPollClosed
+	}
+	if err := poll.ValidateVote(options); err != nil {
+		return nil, err
+	}
+
+	key := pollVotesKey(orgID, groupID, pollID)
+	pipe := r.client.Pipeline()
+	if len(options) == 0 {
+		pipe.HDel(ctx, key, userID)
+	} else {
+		choice, err := json.Marshal(options)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling vote: %w", err)
+		}
+		pipe.HSet(ctx, key, userID, choice)
+		pipe.Expire(ctx, key, r.cfg.MessageTTL)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("error recording vote: %w", err)
+	}
+
+	return r.tally(ctx, poll, userID)
+}
+
+// PollResults returns the tallies of a poll, or ErrPollNotFound. When
+// userID is given the results include that user's vote.
+func (r *MessageRepository) PollResults(ctx context.Context, orgID, groupID, pollID, userID string) (*models.PollResults, error) {
+	poll, err := r.Poll(ctx, orgID, groupID, pollID)
+	if err != nil {
+		return nil, err
+	}
+	return r.tally(ctx, poll, userID)
+}
+
+// tally counts the votes cast on a poll.
+func (r *MessageRepository) tally(ctx context.Context, poll *models.Poll, userID string) (*models.PollResults, error) {
+	votes, err := r.client.HGetAll(ctx, pollVotesKey(poll.OrgID, poll.GroupID, poll.ID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error getting votes: %w", err)
+	}
+
+	results := &models.PollResults{
+		Poll:    *poll,
+		Tallies: make([]int, len(poll.Options)),
+		Closed:  poll.Closed(r.clock.Now()),
+	}
+	for voter, data := range votes {
+		var choice []int
+		if err := json.Unmarshal([]byte(data), &choice); err != nil {
+			continue
+		}
+		for _, option := range choice {
+			if option >= 0 && option < len(results.Tallies) {
+				results.Tallies[option]++
+			}
+		}
+		results.Voters++
+		if voter == userID {
+			results.Vote = &choice
+		}
+	}
+	return results, nil
+}
+
+// pollKey returns the key holding a poll's definition.
+func pollKey(orgID, groupID, pollID string) string {
+	return fmt.Sprintf("poll:%s:%s:%s", orgID, groupID, pollID)
+}
+
+// pollVotesKey returns the hash of a poll's votes, keyed by user ID.
+func pollVotesKey(orgID, groupID, pollID string) string {
+	return fmt.Sprintf("poll_votes:%s:%s:%s", orgID, groupID, pollID)
+}
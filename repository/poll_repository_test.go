@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"go-realtime-workspace/clock"
+	"go-realtime-workspace/models"
+)
+
+// createPoll posts a poll with three options to acme/general.
+func createPoll(t *testing.T, repo *MessageRepository, multiple bool, closesAt *time.Time) *models.Poll {
+	t.Helper()
+	saved, err := repo.CreatePoll(context.Background(), models.ChatMessage{
+		OrgID: "acme", GroupID: "general", ClientID: "alice", Content: "Lunch?",
+		Poll: &models.Poll{
+			CreatedBy: "alice", Question: "Lunch?", Options: []string{"pizza", "sushi", "tacos"},
+			MultipleChoice: multiple, ClosesAt: closesAt,
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreatePoll: %v", err)
+	}
+	return saved.Poll
+}
+
+func TestVote(t *testing.T) {
+	repo, _ := newTestMessageRepository(t, nil)
+	ctx := context.Background()
+	poll := createPoll(t, repo, false, nil)
+
+	if _, err := repo.Vote(ctx, "acme", "general", poll.ID, "alice", []int{0}); err != nil {
+		t.Fatalf("Vote: %v", err)
+	}
+	results, err := repo.Vote(ctx, "acme", "general", poll.ID, "bob", []int{2})
+	if err != nil {
+		t.Fatalf("Vote: %v", err)
+	}
+	if want := []int{1, 0, 1}; !slices.Equal(results.Tallies, want) || results.Voters != 2 {
+		t.Errorf("tallies %v from %d voters, want %v from 2", results.Tallies, results.Voters, want)
+	}
+	if results.Vote == nil || !slices.Equal(*results.Vote, []int{2}) {
+		t.Errorf("bob's vote %v, want [2]", results.Vote)
+	}
+
+	// The poll entry is in the group's history
+	msg, err := repo.GetByID(ctx, "acme", "general", poll.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if msg.Kind != models.KindPoll {
+		t.Errorf("history entry of kind %q, want %q", msg.Kind, models.KindPoll)
+	}
+
+	for _, tt := range []struct {
+		name    string
+		options []int
+	}{
+		{"several options on a single-choice poll", []int{0, 1}},
+		{"unknown option", []int{3}},
+	} {
+		if _, err := repo.Vote(ctx, "acme", "general", poll.ID, "carol", tt.options); !errors.Is(err, models.ErrInvalidPoll) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, models.ErrInvalidPoll)
+		}
+	}
+	if _, err := repo.Vote(ctx, "acme", "general", "nope", "carol", []int{0}); !errors.Is(err, ErrPollNotFound) {
+		t.Errorf("unknown poll: got %v, want %v", err, ErrPollNotFound)
+	}
+}
+
+func TestChangeVote(t *testing.T) {
+	repo, _ := newTestMessageRepository(t, nil)
+	ctx := context.Background()
+	poll := createPoll(t, repo, true, nil)
+
+	for _, tt := range []struct {
+		options []int
+		tallies []int
+		voters  int
+	}{
+		{[]int{0, 1}, []int{1, 1, 0}, 1},
+		{[]int{2}, []int{0, 0, 1}, 1}, // Replaces the earlier vote
+		{nil, []int{0, 0, 0}, 0},      // Withdraws it
+	} {
+		results, err := repo.Vote(ctx, "acme", "general", poll.ID, "alice", tt.options)
+		if err != nil {
+			t.Fatalf("Vote %v: %v", tt.options, err)
+		}
+		if !slices.Equal(results.Tallies, tt.tallies) || results.Voters != tt.voters {
+			t.Errorf("after voting %v: tallies %v from %d voters, want %v from %d", tt.options, results.Tallies, results.Voters, tt.tallies, tt.voters)
+		}
+	}
+}
+
+func TestVoteAfterClose(t *testing.T) {
+	repo, _ := newTestMessageRepository(t, nil)
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(now)
+	repo.SetClock(fake)
+	closesAt := now.Add(time.Hour)
+	poll := createPoll(t, repo, false, &closesAt)
+
+	if _, err := repo.Vote(ctx, "acme", "general", poll.ID, "alice", []int{1}); err != nil {
+		t.Fatalf("Vote before close: %v", err)
+	}
+
+	fake.Advance(time.Hour)
+	if _, err := repo.Vote(ctx, "acme", "general", poll.ID, "bob", []int{0}); !errors.Is(err, ErrPollClosed) {
+		t.Errorf("vote at close time: got %v, want %v", err, ErrPollClosed)
+	}
+	results, err := repo.PollResults(ctx, "acme", "general", poll.ID, "")
+	if err != nil {
+		t.Fatalf("PollResults: %v", err)
+	}
+	if !results.Closed || !slices.Equal(results.Tallies, []int{0, 1, 0}) {
+		t.Errorf("results %+v, want the closed poll with alice's vote only", results)
+	}
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go-realtime-workspace/clock"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// lastSeenKey is the hash of users' last heartbeat times (Unix seconds).
+const lastSeenKey = "last_seen"
+
+// PresenceRepository stores REST heartbeats in Redis so users without a
+// WebSocket can appear online, on every server instance.
+type PresenceRepository struct {
+	client redis.UniversalClient
+	grace  time.Duration
+	clock  clock.Clock
+}
+
+// NewPresenceRepository creates a new presence repository. A heartbeat keeps
+// its user online for grace.
+func NewPresenceRepository(client redis.UniversalClient, grace time.Duration) *PresenceRepository {
+	return &PresenceRepository{client: client, grace: grace, clock: clock.Real{}}
+}
+
+// SetClock replaces the clock used for last-seen times.
+func (r *PresenceRepository) SetClock(c clock.Clock) {
+	r.clock = c
+}
+
+// Heartbeat records that a user is alive, keeping them online for the grace
+// period and updating their last-seen time. It returns when the user goes
+// offline unless another heartbeat arrives.
+func (r *PresenceRepository) Heartbeat(ctx context.Context, userID string) (time.Time, error) {
+	now := r.clock.Now()
+
+	pipe := r.client.Pipeline()
+	pipe.Set(ctx, onlineKey(userID), now.Unix(), r.grace)
+	pipe.HSet(ctx, lastSeenKey, userID, now.Unix())
+	if _, err := pipe.Exec(ctx); err != nil {
+		return time.Time{}, fmt.Errorf("error recording heartbeat: %w", err)
+	}
+	return now.Add(r.grace), nil
+}
+
+// Presence reports whether a user has a live heartbeat and when their last
+// heartbeat was. lastSeen is nil if the user never sent one.
+func (r *PresenceRepository) Presence(ctx context.Context, userID string) (online bool, lastSeen *time.Time, err error) {
+	pipe := r.client.Pipeline()
+	onlineCmd := pipe.Exists(ctx, onlineKey(userID))
+	seenCmd := pipe.HGet(ctx, lastSeenKey, userID)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return false, nil, fmt.Errorf("error getting presence: %w", err)
+	}
+
+	if seen, err := strconv.ParseInt(seenCmd.Val(), 10, 64); err == nil {
+		t := time.Unix(seen, 0).UTC()
+		lastSeen = &t
+	}
+	return onlineCmd.Val() > 0, lastSeen, nil
+}
+
+// onlineKey returns the key that exists while a user's heartbeat is live.
+func onlineKey(userID string) string {
+	return fmt.Sprintf("online:%s", userID)
+}
@@ -0,0 +1,222 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"go-realtime-workspace/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrQuotaExceeded is returned by Save when the organization is over its
+// storage quota and the quota policy is to reject new messages.
+var ErrQuotaExceeded = errors.New("organization storage quota exceeded")
+
+// addUsage adds ARGV[1] messages of ARGV[2] bytes (negative for messages
+// trimmed) to the cached usage of an org, but only while a measurement is
+// cached, so an expired cache is measured afresh rather than recreated with
+// partial counts.
+var addUsage = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	redis.call('HINCRBY', KEYS[1], 'messages', ARGV[1])
+	redis.call('HINCRBY', KEYS[1], 'bytes', ARGV[2])
+end
+return 0
+`)
+
+// Quota returns the storage quota of an organization: its override if one
+// is set, otherwise the global default. override reports which.
+func (r *MessageRepository) Quota(ctx context.Context, orgID string) (quota models.OrgQuota, override bool, err error) {
+	quota = models.OrgQuota{
+		MaxMessages: r.cfg.OrgQuotaMessages,
+		MaxBytes:    r.cfg.OrgQuotaBytes,
+		Policy:      r.cfg.OrgQuotaPolicy,
+	}
+
+	fields, err := r.client.HGetAll(ctx, quotaKey(orgID)).Result()
+	if err != nil {
+		return quota, false, fmt.Errorf("error getting quota: %w", err)
+	}
+	if len(fields) == 0 {
+		return quota, false, nil
+	}
+
+	quota.MaxMessages, _ = strconv.ParseInt(fields["max_messages"], 10, 64)
+	quota.MaxBytes, _ = strconv.ParseInt(fields["max_bytes"], 10, 64)
+	if policy := fields["policy"]; models.ValidQuotaPolicy(policy) {
+		quota.Policy = policy
+	}
+	return quota, true, nil
+}
+
+// SetQuota overrides the storage quota of an organization.
+func (r *MessageRepository) SetQuota(ctx context.Context, orgID string, quota models.OrgQuota) error {
+	err := r.client.HSet(ctx, quotaKey(orgID),
+		"max_messages", quota.MaxMessages,
+		"max_bytes", quota.MaxBytes,
+		"policy", quota.Policy,
+	).Err()
+	if err != nil {
+		return fmt.Errorf("error setting quota: %w", err)
+	}
+	return nil
+}
+
+// ClearQuota removes an organization's quota override, so the global
+// default applies again.
+func (r *MessageRepository) ClearQuota(ctx context.Context, orgID string) error {
+	if err := r.client.Del(ctx, quotaKey(orgID)).Err(); err != nil {
+		return fmt.Errorf("error clearing quota: %w", err)
+	}
+	return nil
+}
+
+// QuotaUsage reports an organization's storage against its quota.
+func (r *MessageRepository) QuotaUsage(ctx context.Context, orgID string) (*models.QuotaUsage, error) {
+	quota, override, err := r.Quota(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	messages, bytes, err := r.usage(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	return &models.QuotaUsage{
+		OrgID:    orgID,
+		Messages: messages,
+		Bytes:    bytes,
+		Quota:    quota,
+		Override: override,
+		Exceeded: quota.Exceeded(messages, bytes),
+	}, nil
+}
+
+// usage returns the messages an organization stores across its groups and
+// the Redis memory they use. The measurement scans the org's group keys, so
+// it is cached for QuotaUsageTTL; messages saved meanwhile, and those their
+// saves trimmed, are added to and taken from the cached counts, while other
+// trims, deletions and expiries show up at the next measurement.
+func (r *MessageRepository) usage(ctx context.Context, orgID string) (messages, bytes int64, err error) {
+	key := quotaUsageKey(orgID)
+
+	cached, err := r.client.HGetAll(ctx, key).Result()
+	if err != nil {
+		return 0, 0, fmt.Errorf("error getting quota usage: %w", err)
+	}
+	if len(cached) > 0 {
+		messages, _ = strconv.ParseInt(cached["messages"], 10, 64)
+		bytes, _ = strconv.ParseInt(cached["bytes"], 10, 64)
+		return messages, bytes, nil
+	}
+
+	groupIDs, err := r.scanGroupIDs(ctx, orgID, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	pipe := r.client.Pipeline()
+	counts := make([]*redis.IntCmd, len(groupIDs))
+	sizes := make([]*redis.IntCmd, 0, 2*len(groupIDs))
+	for i, groupID := range groupIDs {
+		counts[i] = pipe.ZCard(ctx, groupKey(orgID, groupID))
+		sizes = append(sizes,
+			pipe.MemoryUsage(ctx, groupKey(orgID, groupID)),
+			pipe.MemoryUsage(ctx, indexKey(orgID, groupID)),
+		)
+	}
+	if len(groupIDs) > 0 {
+		// Keys that expired since the scan report redis.Nil
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return 0, 0, fmt.Errorf("error measuring quota usage: %w", err)
+		}
+	}
+	for _, count := range counts {
+		messages += count.Val()
+	}
+	for _, size := range sizes {
+		bytes += size.Val()
+	}
+
+	pipe = r.client.Pipeline()
+	pipe.HSet(ctx, key, "messages", messages, "bytes", bytes)
+	pipe.Expire(ctx, key, r.cfg.QuotaUsageTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, 0, fmt.Errorf("error caching quota usage: %w", err)
+	}
+	return messages, bytes, nil
+}
+
+// enforceQuota applies the organization's quota before a message is saved
+// to one of its groups. Under the reject policy it returns ErrQuotaExceeded
+// while the org is over quota; under the trim policy it removes enough of
+// the oldest messages of the group being written to bring the org back
+// under quota, as far as that group allows. tracked reports whether the org
+// has a quota, so the save should be added to its usage.
+func (r *MessageRepository) enforceQuota(ctx context.Context, orgID, groupID string) (tracked bool, err error) {
+	if orgID == DMOrgID {
+		return false, nil
+	}
+	quota, _, err := r.Quota(ctx, orgID)
+	if err != nil || !quota.Limited() {
+		return false, err
+	}
+	messages, bytes, err := r.usage(ctx, orgID)
+	if err != nil {
+		return false, err
+	}
+	if !quota.Exceeded(messages, bytes) {
+		return true, nil
+	}
+	if quota.Policy != models.QuotaPolicyTrim {
+		return true, ErrQuotaExceeded
+	}
+
+	// Make room for the new message under both limits
+	var excess int64
+	if quota.MaxMessages > 0 && messages >= quota.MaxMessages {
+		excess = messages - quota.MaxMessages + 1
+	}
+	if quota.MaxBytes > 0 && bytes >= quota.MaxBytes && messages > 0 {
+		perMessage := bytes / messages
+		if perMessage < 1 {
+			perMessage = 1
+		}
+		if n := (bytes-quota.MaxBytes)/perMessage + 1; n > excess {
+			excess = n
+		}
+	}
+
+	protected, err := r.protectedMembers(ctx, orgID, groupID)
+	if err != nil {
+		return true, err
+	}
+	args := make([]interface{}, 0, len(protected)+2)
+	args = append(args, "remove", excess)
+	for _, member := range protected {
+		args = append(args, member)
+	}
+
+	// Protected messages are skipped, so a group holding mostly pinned
+	// messages may stay over quota
+	pipe := r.client.Pipeline()
+	trimmed := trimScript.Eval(ctx, pipe, []string{groupKey(orgID, groupID)}, args...)
+	pipe.Del(ctx, quotaUsageKey(orgID)) // Measure again after trimming
+	if _, err := pipe.Exec(ctx); err != nil {
+		return true, fmt.Errorf("error trimming for quota: %w", err)
+	}
+	r.dropTrimmed(ctx, orgID, groupID, trimmed, false)
+	return true, nil
+}
+
+// quotaKey returns the hash holding an organization's quota override.
+func quotaKey(orgID string) string {
+	return fmt.Sprintf("quota:%s", orgID)
+}
+
+// quotaUsageKey returns the hash caching an organization's measured usage.
+func quotaUsageKey(orgID string) string {
+	return fmt.Sprintf("quota_usage:%s", orgID)
+}
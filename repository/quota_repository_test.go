@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"go-realtime-workspace/config"
+	"go-realtime-workspace/models"
+)
+
+func TestQuotaUsageShrinksWithTrimming(t *testing.T) {
+	repo, _ := newTestMessageRepository(t, func(cfg *config.RedisConfig) {
+		cfg.MaxMessages = 3
+	})
+	ctx := context.Background()
+	if err := repo.SetQuota(ctx, "acme", models.OrgQuota{MaxMessages: 100, Policy: models.QuotaPolicyReject}); err != nil {
+		t.Fatalf("SetQuota: %v", err)
+	}
+
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 6; i++ {
+		_, err := repo.Save(ctx, models.ChatMessage{OrgID: "acme", GroupID: "general", ClientID: "alice", Content: "hello", Timestamp: start.Add(time.Duration(i) * time.Second)})
+		if err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+
+	usage, err := repo.QuotaUsage(ctx, "acme")
+	if err != nil {
+		t.Fatalf("QuotaUsage: %v", err)
+	}
+	if usage.Messages != 3 {
+		t.Errorf("usage counts %d messages, want the 3 kept", usage.Messages)
+	}
+}
+
+func TestQuotaPolicies(t *testing.T) {
+	repo, _ := newTestMessageRepository(t, func(cfg *config.RedisConfig) {
+		cfg.OrgQuotaMessages = 3
+		cfg.OrgQuotaPolicy = models.QuotaPolicyReject
+	})
+	ctx := context.Background()
+	// Globex trims instead, with room for one message more
+	if err := repo.SetQuota(ctx, "globex", models.OrgQuota{MaxMessages: 4, Policy: models.QuotaPolicyTrim}); err != nil {
+		t.Fatalf("SetQuota: %v", err)
+	}
+
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	save := func(orgID string, i int) error {
+		_, err := repo.Save(ctx, models.ChatMessage{
+			ID: fmt.Sprintf("m%d", i), OrgID: orgID, GroupID: "general", ClientID: "alice",
+			Content: "hello", Timestamp: start.Add(time.Duration(i) * time.Second),
+		})
+		return err
+	}
+
+	// Reject: the message that would exceed the quota is refused
+	for i := 1; i <= 3; i++ {
+		if err := save("acme", i); err != nil {
+			t.Fatalf("acme message %d within the quota: %v", i, err)
+		}
+	}
+	if err := save("acme", 4); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("acme message past the quota: got %v, want ErrQuotaExceeded", err)
+	}
+	history, err := repo.GetHistory(ctx, "acme", "general", 10)
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	if got := messageIDs(history); !slices.Equal(got, []string{"m3", "m2", "m1"}) {
+		t.Errorf("acme history %v, want [m3 m2 m1]", got)
+	}
+
+	// Trim: the oldest message makes room for the new one
+	for i := 1; i <= 6; i++ {
+		if err := save("globex", i); err != nil {
+			t.Fatalf("globex message %d: %v", i, err)
+		}
+	}
+	history, err = repo.GetHistory(ctx, "globex", "general", 10)
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	if got := messageIDs(history); !slices.Equal(got, []string{"m6", "m5", "m4", "m3"}) {
+		t.Errorf("globex history %v, want the newest 4", got)
+	}
+	usage, err := repo.QuotaUsage(ctx, "globex")
+	if err != nil {
+		t.Fatalf("QuotaUsage: %v", err)
+	}
+	// At the quota counts as exceeded: the next message trims again
+	if usage.Messages != 4 || !usage.Override || !usage.Exceeded {
+		t.Errorf("globex usage %+v, want 4 messages at its override", usage)
+	}
+}
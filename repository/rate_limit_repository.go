@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"go-realtime-workspace/models"
+)
+
+// GroupRateLimit returns the throughput cap override stored for a group,
+// and whether there is one.
+func (r *MessageRepository) GroupRateLimit(ctx context.Context, orgID, groupID string) (models.GroupRateLimit, bool, error) {
+	fields, err := r.client.HGetAll(ctx, rateLimitKey(orgID, groupID)).Result()
+	if err != nil {
+		return models.GroupRateLimit{}, false, fmt.Errorf("error getting group rate limit: %w", err)
+	}
+	if len(fields) == 0 {
+		return models.GroupRateLimit{}, false, nil
+	}
+
+	var limit models.GroupRateLimit
+	limit.MessagesPerSecond, _ = strconv.ParseFloat(fields["rate"], 64)
+	limit.Burst, _ = strconv.Atoi(fields["burst"])
+	return limit, true, nil
+}
+
+// SetGroupRateLimit stores a group's throughput cap override, so it
+// outlives restarts of the group hub and the server.
+func (r *MessageRepository) SetGroupRateLimit(ctx context.Context, orgID, groupID string, limit models.GroupRateLimit) error {
+	err := r.client.HSet(ctx, rateLimitKey(orgID, groupID),
+		"rate", limit.MessagesPerSecond,
+		"burst", limit.Burst,
+	).Err()
+	if err != nil {
+		return fmt.Errorf("error setting group rate limit: %w", err)
+	}
+	return nil
+}
+
+// rateLimitKey returns the hash holding a group's throughput cap override.
+func rateLimitKey(orgID, groupID string) string {
+	return fmt.Sprintf("group_rate_limit:%s:%s", orgID, groupID)
+}
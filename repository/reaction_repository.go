@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go-realtime-workspace/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Errors returned by AddReaction when a configured cap would be exceeded.
+var (
+	ErrTooManyUserReactions    = errors.New("user has reached the reaction limit for this message")
+	ErrTooManyMessageReactions = errors.New("message has reached the distinct reaction limit")
+)
+
+// reactionSeparator joins emoji and user ID in a reaction set member.
+const reactionSeparator = "\n"
+
+// addReactionScript atomically checks both reaction caps and adds the reaction.
+// Members of the set are "emoji\nuserID".
+//
+// Returns 1 when added, 0 when the reaction already existed, -1 when the user
+// cap is reached and -2 when the message's distinct-emoji cap is reached.
+var addReactionScript = redis.NewScript(`
+local member = ARGV[2] .. "\n" .. ARGV[1]
+if redis.call("SISMEMBER", KEYS[1], member) == 1 then
+	return 0
+end
+
+local userCount, distinct, seen = 0, 0, {}
+for _, m in ipairs(redis.call("SMEMBERS", KEYS[1])) do
+	local sep = string.find(m, "\n", 1, true)
+	local emoji, user = string.sub(m, 1, sep - 1), string.sub(m, sep + 1)
+	if user == ARGV[1] then
+		userCount = userCount + 1
+	end
+	if not seen[emoji] then
+		seen[emoji] = true
+		distinct = distinct + 1
+	end
+end
+
+local maxPerUser, maxPerMessage = tonumber(ARGV[3]), tonumber(ARGV[4])
+if maxPerUser > 0 and userCount >= maxPerUser then
+	return -1
+end
+if maxPerMessage > 0 and not seen[ARGV[2]] and distinct >= maxPerMessage then
+	return -2
+end
+
+redis.call("SADD", KEYS[1], member)
+redis.call("EXPIRE", KEYS[1], ARGV[5])
+return 1
+`)
+
+// AddReaction records a user's emoji reaction on a message, enforcing the
+// configured per-user and per-message caps. Adding an existing reaction is a no-op.
+func (r *MessageRepository) AddReaction(ctx context.Context, orgID, groupID, messageID, userID, emoji string) error {
+	if strings.Contains(emoji, reactionSeparator) || strings.Contains(userID, reactionSeparator) {
+		return fmt.Errorf("invalid reaction")
+	}
+
+	result, err := addReactionScript.Run(ctx, r.client,
+		[]string{reactionsKey(orgID, groupID, messageID)},
+		userID, emoji, r.cfg.MaxReactionsPerUser, r.cfg.MaxReactionsPerMessage, int(r.cfg.MessageTTL.Seconds()),
+	).Int()
+	if err != nil {
+		return fmt.Errorf("error adding reaction: %w", err)
+	}
+
+	switch result {
+	case -1:
+		return ErrTooManyUserReactions
+	case -2:
+		return ErrTooManyMessageReactions
+	}
+	return nil
+}
+
+// RemoveReaction removes a user's emoji reaction from a message.
+func (r *MessageRepository) RemoveReaction(ctx context.Context, orgID, groupID, messageID, userID, emoji string) error {
+	member := emoji + reactionSeparator + userID
+	if err := r.client.SRem(ctx, reactionsKey(orgID, groupID, messageID), member).Err(); err != nil {
+		return fmt.Errorf("error removing reaction: %w", err)
+	}
+	return nil
+}
+
+// GetReactions returns the users who reacted to a message, grouped by emoji.
+func (r *MessageRepository) GetReactions(ctx context.Context, orgID, groupID, messageID string) (map[string][]string, error) {
+	members, err := r.client.SMembers(ctx, reactionsKey(orgID, groupID, messageID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error getting reactions: %w", err)
+	}
+
+	reactions := make(map[string][]string)
+	for _, member := range members {
+		emoji, userID, ok := strings.Cut(member, reactionSeparator)
+		if !ok {
+			continue
+		}
+		reactions[emoji] = append(reactions[emoji], userID)
+	}
+	return reactions, nil
+}
+
+// attachReactions fills in the reaction counts of each message with one
+// pipelined round trip, so history reflects the current reactions.
+func (r *MessageRepository) attachReactions(ctx context.Context, orgID, groupID string, messages []models.ChatMessage) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	pipe := r.client.Pipeline()
+	cmds := make([]*redis.StringSliceCmd, len(messages))
+	for i, msg := range messages {
+		cmds[i] = pipe.SMembers(ctx, reactionsKey(orgID, groupID, msg.ID))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return fmt.Errorf("error getting reactions: %w", err)
+	}
+
+	for i, cmd := range cmds {
+		for _, member := range cmd.Val() {
+			emoji, _, ok := strings.Cut(member, reactionSeparator)
+			if !ok {
+				continue
+			}
+			if messages[i].Reactions == nil {
+				messages[i].Reactions = make(map[string]int)
+			}
+			messages[i].Reactions[emoji]++
+		}
+	}
+	return nil
+}
+
+// reactionsKey returns the set key holding a message's reactions.
+func reactionsKey(orgID, groupID, messageID string) string {
+	return fmt.Sprintf("reactions:%s:%s:%s", orgID, groupID, messageID)
+}
@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+
+	"go-realtime-workspace/config"
+)
+
+func TestReactionCaps(t *testing.T) {
+	repo, _ := newTestMessageRepository(t, func(cfg *config.RedisConfig) {
+		cfg.MaxReactionsPerUser = 2
+		cfg.MaxReactionsPerMessage = 3
+	})
+	ctx := context.Background()
+	react := func(userID, emoji string) error {
+		return repo.AddReaction(ctx, "acme", "general", "m1", userID, emoji)
+	}
+
+	tests := []struct {
+		user, emoji string
+		wantErr     error
+	}{
+		{"alice", "👍", nil},
+		{"alice", "🎉", nil},
+		{"alice", "🎉", nil}, // Repeating a reaction is a no-op
+		{"alice", "❤️", ErrTooManyUserReactions},
+		{"bob", "❤️", nil},
+		{"bob", "🚀", ErrTooManyMessageReactions},
+		{"carol", "👍", nil}, // Emoji already on the message do not count again
+	}
+	for _, tt := range tests {
+		if err := react(tt.user, tt.emoji); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s reacting %s: got %v, want %v", tt.user, tt.emoji, err, tt.wantErr)
+		}
+	}
+
+	reactions, err := repo.GetReactions(ctx, "acme", "general", "m1")
+	if err != nil {
+		t.Fatalf("GetReactions: %v", err)
+	}
+	if len(reactions) != 3 {
+		t.Errorf("reactions %v, want 3 distinct emoji", reactions)
+	}
+	thumbs := reactions["👍"]
+	slices.Sort(thumbs)
+	if want := []string{"alice", "carol"}; !slices.Equal(thumbs, want) {
+		t.Errorf("👍 by %v, want %v", thumbs, want)
+	}
+
+	// Removing a reaction frees the user's slot
+	if err := repo.RemoveReaction(ctx, "acme", "general", "m1", "alice", "🎉"); err != nil {
+		t.Fatalf("RemoveReaction: %v", err)
+	}
+	if err := react("alice", "❤️"); err != nil {
+		t.Errorf("after removing one: %v", err)
+	}
+}
+
+func TestReactionCapsDisabled(t *testing.T) {
+	repo, _ := newTestMessageRepository(t, func(cfg *config.RedisConfig) {
+		cfg.MaxReactionsPerUser = 0
+		cfg.MaxReactionsPerMessage = 0
+	})
+	for _, emoji := range []string{"a", "b", "c", "d", "e", "f"} {
+		if err := repo.AddReaction(context.Background(), "acme", "general", "m1", "alice", emoji); err != nil {
+			t.Fatalf("AddReaction %s: %v", emoji, err)
+		}
+	}
+}
+
+func TestHistoryShowsEditsAndReactions(t *testing.T) {
+	repo, _ := newTestMessageRepository(t, nil)
+	ctx := context.Background()
+	saveAt(t, repo, "acme", "general", "m1", "first draft", 0)
+	saveAt(t, repo, "acme", "general", "m2", "untouched", 1)
+
+	if _, err := repo.Edit(ctx, "acme", "general", "m1", "alice", "final"); err != nil {
+		t.Fatalf("Edit: %v", err)
+	}
+	for _, r := range []struct{ user, emoji string }{{"alice", "👍"}, {"bob", "👍"}, {"bob", "🎉"}} {
+		if err := repo.AddReaction(ctx, "acme", "general", "m1", r.user, r.emoji); err != nil {
+			t.Fatalf("AddReaction: %v", err)
+		}
+	}
+
+	history, err := repo.GetHistory(ctx, "acme", "general", 10)
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	if got := messageIDs(history); !slices.Equal(got, []string{"m2", "m1"}) {
+		t.Fatalf("history %v, want [m2 m1]", got)
+	}
+	edited := history[1]
+	if edited.Content != "final" || edited.EditedAt == nil {
+		t.Errorf("content %q (edited at %v), want the edit", edited.Content, edited.EditedAt)
+	}
+	if want := map[string]int{"👍": 2, "🎉": 1}; !maps.Equal(edited.Reactions, want) {
+		t.Errorf("reactions %v, want %v", edited.Reactions, want)
+	}
+	if len(history[0].Reactions) != 0 {
+		t.Errorf("untouched message has reactions %v", history[0].Reactions)
+	}
+}
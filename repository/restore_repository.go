@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"go-realtime-workspace/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// SoftDelete removes a message from a group's history on behalf of its
+// author (clientID) and returns the removed message. For the configured
+// restore window the stored message is kept aside under a key that Redis
+// expires, so Restore can reinstate it; once the key expires the content is
+// gone for good. With no restore window the message is deleted outright.
+func (r *MessageRepository) SoftDelete(ctx context.Context, orgID, groupID, id, clientID string) (*models.ChatMessage, error) {
+	idxKey := indexKey(orgID, groupID)
+
+	member, err := r.client.HGet(ctx, idxKey, id).Result()
+	if err == redis.Nil {
+		return nil, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting message: %w", err)
+	}
+
+	var msg models.ChatMessage
+	if err := unmarshalMessage(member, &msg); err != nil {
+		return nil, fmt.Errorf("error unmarshaling message: %w", err)
+	}
+	if msg.AnnouncementID != "" || msg.ClientID != clientID {
+		return nil, ErrNotMessageAuthor
+	}
+
+	// Claim the message by removing it from the history first, so a
+	// concurrent delete, edit or trim cannot leave it stashed twice
+	removed, err := r.client.ZRem(ctx, groupKey(orgID, groupID), member).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error deleting message: %w", err)
+	}
+	if removed == 0 {
+		return nil, ErrMessageNotFound
+	}
+
+	pipe := r.client.Pipeline()
+	pipe.HDel(ctx, idxKey, id)
+	if r.restoreWindow > 0 {
+		pipe.Set(ctx, deletedKey(orgID, groupID, id), member, r.restoreWindow)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("error deleting message: %w", err)
+	}
+	return &msg, nil
+}
+
+// Restore reinstates a message removed by SoftDelete, at its original
+// position in the history. Only the author (clientID) may restore it.
+// Returns ErrMessageNotFound once the restore window has passed.
+func (r *MessageRepository) Restore(ctx context.Context, orgID, groupID, id, clientID string) (*models.ChatMessage, error) {
+	stashKey := deletedKey(orgID, groupID, id)
+
+	member, err := r.client.Get(ctx, stashKey).Result()
+	if err == redis.Nil {
+		return nil, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting deleted message: %w", err)
+	}
+
+	var msg models.ChatMessage
+	if err := unmarshalMessage(member, &msg); err != nil {
+		return nil, fmt.Errorf("error unmarshaling message: %w", err)
+	}
+	if msg.ClientID != clientID {
+		return nil, ErrNotMessageAuthor
+	}
+	if msg.ExpiresAt != nil && !msg.ExpiresAt.After(r.clock.Now()) {
+		return nil, ErrMessageNotFound
+	}
+
+	// Claim the stash so concurrent restores reinstate the message once
+	claimed, err := r.client.Del(ctx, stashKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error restoring message: %w", err)
+	}
+	if claimed == 0 {
+		return nil, ErrMessageNotFound
+	}
+
+	protected, err := r.protectedMembers(ctx, orgID, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	key := groupKey(orgID, groupID)
+	idxKey := indexKey(orgID, groupID)
+
+	pipe := r.client.Pipeline()
+	pipe.ZAdd(ctx, key, redis.Z{Score: score(msg.Timestamp), Member: member})
+	trimmed := r.trimHistory(ctx, pipe, orgID, groupID, protected)
+	pipe.Expire(ctx, key, r.cfg.MessageTTL)
+	pipe.HSet(ctx, idxKey, id, member)
+	pipe.Expire(ctx, idxKey, r.cfg.MessageTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("error restoring message: %w", err)
+	}
+	r.dropTrimmed(ctx, orgID, groupID, trimmed, false)
+	return &msg, nil
+}
+
+// deletedKey returns the key holding a soft-deleted message until its
+// restore window ends.
+func deletedKey(orgID, groupID, id string) string {
+	return fmt.Sprintf("deleted_message:%s:%s:%s", orgID, groupID, id)
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"go-realtime-workspace/config"
+)
+
+func TestRestoreWithinWindow(t *testing.T) {
+	repo, _ := newTestMessageRepository(t, nil)
+	ctx := context.Background()
+	for i, id := range []string{"m1", "m2", "m3"} {
+		saveAt(t, repo, "acme", "general", id, id, i)
+	}
+
+	if _, err := repo.SoftDelete(ctx, "acme", "general", "m2", "bob"); !errors.Is(err, ErrNotMessageAuthor) {
+		t.Fatalf("delete by another user: got %v, want ErrNotMessageAuthor", err)
+	}
+	if _, err := repo.SoftDelete(ctx, "acme", "general", "m2", "alice"); err != nil {
+		t.Fatalf("SoftDelete: %v", err)
+	}
+	history, err := repo.GetHistory(ctx, "acme", "general", 10)
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	if got := messageIDs(history); !slices.Equal(got, []string{"m3", "m1"}) {
+		t.Errorf("history after delete %v, want [m3 m1]", got)
+	}
+
+	if _, err := repo.Restore(ctx, "acme", "general", "m2", "bob"); !errors.Is(err, ErrNotMessageAuthor) {
+		t.Fatalf("restore by another user: got %v, want ErrNotMessageAuthor", err)
+	}
+	restored, err := repo.Restore(ctx, "acme", "general", "m2", "alice")
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if restored.Content != "m2" {
+		t.Errorf("restored content %q, want m2", restored.Content)
+	}
+	history, err = repo.GetHistory(ctx, "acme", "general", 10)
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	// Back at its original position
+	if got := messageIDs(history); !slices.Equal(got, []string{"m3", "m2", "m1"}) {
+		t.Errorf("history after restore %v, want [m3 m2 m1]", got)
+	}
+	if _, err := repo.Restore(ctx, "acme", "general", "m2", "alice"); !errors.Is(err, ErrMessageNotFound) {
+		t.Errorf("second restore: got %v, want ErrMessageNotFound", err)
+	}
+}
+
+func TestDeletedContentPurgedAfterWindow(t *testing.T) {
+	repo, srv := newTestMessageRepository(t, nil)
+	ctx := context.Background()
+	saveAt(t, repo, "acme", "general", "m1", "secret", 0)
+
+	if _, err := repo.SoftDelete(ctx, "acme", "general", "m1", "alice"); err != nil {
+		t.Fatalf("SoftDelete: %v", err)
+	}
+	if !srv.Exists(deletedKey("acme", "general", "m1")) {
+		t.Fatal("deleted message was not kept for the restore window")
+	}
+
+	srv.FastForward(config.DefaultConfig().Message.RestoreWindow + time.Second)
+	if srv.Exists(deletedKey("acme", "general", "m1")) {
+		t.Error("deleted content outlived the restore window")
+	}
+	if _, err := repo.Restore(ctx, "acme", "general", "m1", "alice"); !errors.Is(err, ErrMessageNotFound) {
+		t.Errorf("restore after the window: got %v, want ErrMessageNotFound", err)
+	}
+}
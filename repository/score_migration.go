@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// legacyScoreLimit separates scores written in Unix seconds from current
+// ones in Unix microseconds: as seconds it is the year 5138, as
+// microseconds a day after the epoch.
+const legacyScoreLimit = 1e11
+
+// rescaleSortedSet converts the legacy second scores of a sorted set to
+// microseconds. Legacy entries are all older than current ones, so their
+// order is unchanged.
+var rescaleSortedSet = redis.NewScript(`
+local entries = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', '(' .. ARGV[1], 'WITHSCORES')
+for i = 1, #entries, 2 do
+	redis.call('ZADD', KEYS[1], 'XX', tonumber(entries[i + 1]) * 1000000, entries[i])
+end
+return #entries / 2
+`)
+
+// rescaleMarkers converts the legacy second values of a read-marker hash to
+// microseconds.
+var rescaleMarkers = redis.NewScript(`
+local fields = redis.call('HGETALL', KEYS[1])
+local n = 0
+for i = 1, #fields, 2 do
+	local v = tonumber(fields[i + 1])
+	if v and v < tonumber(ARGV[1]) then
+		redis.call('HSET', KEYS[1], fields[i], v * 1000000)
+		n = n + 1
+	end
+end
+return n
+`)
+
+// MigrateScores rescales scores written in Unix seconds, before history
+// scores had sub-second precision, to the microseconds used now. It covers
+// group and DM histories, DM room lists, starred messages, the expiry
+// schedule and read markers, and returns the number of entries changed.
+// Migrated entries are left alone, so it is safe to run on every start.
+//
+// Until it has run, range reads (GetHistoryAfter, GetHistoryBetween,
+// DeleteOld) miss legacy messages and scheduled expiries fire early.
+func (r *MessageRepository) MigrateScores(ctx context.Context) (int64, error) {
+	var migrated int64
+	rescale := func(script *redis.Script) func(key string) error {
+		return func(key string) error {
+			n, err := script.Run(ctx, r.client, []string{key}, legacyScoreLimit).Int64()
+			if err != nil {
+				return fmt.Errorf("error migrating scores of %s: %w", key, err)
+			}
+			migrated += n
+			return nil
+		}
+	}
+
+	for _, pattern := range []string{"messages:*", "dm_rooms:*", "starred:*", expiryKey} {
+		if err := r.scanKeys(ctx, pattern, rescale(rescaleSortedSet)); err != nil {
+			return migrated, err
+		}
+	}
+	if err := r.scanKeys(ctx, "read_markers:*", rescale(rescaleMarkers)); err != nil {
+		return migrated, err
+	}
+	return migrated, nil
+}
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+
+	"go-realtime-workspace/models"
+)
+
+func TestSubSecondMessagesKeepInsertionOrder(t *testing.T) {
+	repo, _ := newTestMessageRepository(t, nil)
+	ctx := context.Background()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Within one second, and two at the same instant. Redis orders equal
+	// scores by member, and these IDs sort opposite to the sending order
+	for _, m := range []struct {
+		id     string
+		offset time.Duration
+	}{
+		{"d", 0},
+		{"c", 300 * time.Millisecond},
+		{"b", 600 * time.Millisecond},
+		{"a", 600 * time.Millisecond},
+	} {
+		_, err := repo.Save(ctx, models.ChatMessage{
+			ID: m.id, OrgID: "acme", GroupID: "general", ClientID: "alice",
+			Content: "hi", Timestamp: start.Add(m.offset),
+		})
+		if err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+
+	history, err := repo.GetHistory(ctx, "acme", "general", 10)
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	if got, want := messageIDs(history), []string{"a", "b", "c", "d"}; !slices.Equal(got, want) {
+		t.Errorf("history %v, want %v", got, want)
+	}
+}
+
+func TestMigrateScoresRescalesLegacyEntries(t *testing.T) {
+	repo, srv := newTestMessageRepository(t, nil)
+	ctx := context.Background()
+	legacyTime := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	legacy := models.ChatMessage{ID: "old", OrgID: "acme", GroupID: "general", ClientID: "alice", Content: "old", Timestamp: legacyTime}
+	data, err := json.Marshal(legacy)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if _, err := srv.ZAdd(groupKey("acme", "general"), float64(legacyTime.Unix()), string(data)); err != nil {
+		t.Fatalf("ZAdd: %v", err)
+	}
+	srv.HSet(indexKey("acme", "general"), "old", string(data))
+	saveAt(t, repo, "acme", "general", "new", "new", 0)
+
+	migrated, err := repo.MigrateScores(ctx)
+	if err != nil {
+		t.Fatalf("MigrateScores: %v", err)
+	}
+	if migrated != 1 {
+		t.Errorf("migrated %d entries, want 1", migrated)
+	}
+	got, err := srv.ZScore(groupKey("acme", "general"), string(data))
+	if err != nil {
+		t.Fatalf("ZScore: %v", err)
+	}
+	if got != score(legacyTime) {
+		t.Errorf("legacy score %v, want %v", got, score(legacyTime))
+	}
+
+	// Range reads now see the legacy message
+	since, err := repo.GetHistoryAfter(ctx, "acme", "general", legacyTime.Add(-time.Second), 10)
+	if err != nil {
+		t.Fatalf("GetHistoryAfter: %v", err)
+	}
+	if len(since) != 2 {
+		t.Errorf("history after the legacy time has %v, want both messages", messageIDs(since))
+	}
+
+	// Running it again changes nothing
+	if migrated, err := repo.MigrateScores(ctx); err != nil || migrated != 0 {
+		t.Errorf("second run migrated %d (%v), want 0", migrated, err)
+	}
+}
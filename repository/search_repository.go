@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go-realtime-workspace/models"
+)
+
+// errScanDone stops a key scan once enough keys have been collected.
+var errScanDone = errors.New("scan done")
+
+// SearchOrg finds messages whose content contains query (case-insensitive)
+// across every group in an organization, most recent first.
+//
+// The work is bounded: at most SearchMaxGroups group keys are scanned and
+// only the newest SearchScanPerGroup messages of each group are examined,
+// so older matches in busy groups may be missed.
+func (r *MessageRepository) SearchOrg(ctx context.Context, orgID, query string, limit int) ([]models.ChatMessage, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+	needle := strings.ToLower(query)
+
+	groupIDs, err := r.scanGroupIDs(ctx, orgID, r.cfg.SearchMaxGroups)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []models.ChatMessage
+	for _, groupID := range groupIDs {
+		results, err := r.client.ZRevRange(ctx, groupKey(orgID, groupID), 0, r.cfg.SearchScanPerGroup-1).Result()
+		if err != nil {
+			return nil, fmt.Errorf("error searching messages: %w", err)
+		}
+
+		messages, err := r.decodeMessages(ctx, orgID, results)
+		if err != nil {
+			return nil, err
+		}
+		for _, msg := range messages {
+			if strings.Contains(strings.ToLower(msg.Content), needle) {
+				matches = append(matches, msg)
+			}
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].Timestamp.After(matches[j].Timestamp)
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	return matches, nil
+}
+
+// scanGroupIDs returns the IDs of up to max groups with stored history in an
+// organization, using SCAN so Redis is never blocked.
+func (r *MessageRepository) scanGroupIDs(ctx context.Context, orgID string, max int) ([]string, error) {
+	prefix := groupKey(orgID, "")
+
+	var groupIDs []string
+	err := r.scanKeys(ctx, escapeGlob(prefix)+"*", func(key string) error {
+		if max > 0 && len(groupIDs) >= max {
+			return errScanDone
+		}
+		groupIDs = append(groupIDs, strings.TrimPrefix(key, prefix))
+		return nil
+	})
+	if err != nil && !errors.Is(err, errScanDone) {
+		return nil, err
+	}
+
+	return groupIDs, nil
+}
+
+// escapeGlob escapes the characters Redis treats specially in MATCH patterns.
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		switch c {
+		case '*', '?', '[', ']', '\\':
+			b.WriteRune('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"go-realtime-workspace/config"
+	"go-realtime-workspace/models"
+)
+
+// saveAt stores a message with the given ID and content in orgID/groupID
+// at start plus offset seconds.
+func saveAt(t *testing.T, repo *MessageRepository, orgID, groupID, id, content string, offset int) {
+	t.Helper()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	_, err := repo.Save(context.Background(), models.ChatMessage{
+		ID:        id,
+		OrgID:     orgID,
+		GroupID:   groupID,
+		ClientID:  "alice",
+		Content:   content,
+		Timestamp: start.Add(time.Duration(offset) * time.Second),
+	})
+	if err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+}
+
+// messageIDs returns the IDs of messages in order.
+func messageIDs(messages []models.ChatMessage) []string {
+	ids := make([]string, len(messages))
+	for i, msg := range messages {
+		ids[i] = msg.ID
+	}
+	return ids
+}
+
+func TestSearchOrgAcrossGroups(t *testing.T) {
+	repo, _ := newTestMessageRepository(t, nil)
+	ctx := context.Background()
+	saveAt(t, repo, "acme", "general", "g1", "Deploy at noon", 1)
+	saveAt(t, repo, "acme", "general", "g2", "lunch?", 2)
+	saveAt(t, repo, "acme", "ops", "o1", "deploy failed", 3)
+	saveAt(t, repo, "acme", "random", "r1", "who broke the DEPLOY", 4)
+	saveAt(t, repo, "globex", "general", "x1", "deploy globex", 5)
+
+	results, err := repo.SearchOrg(ctx, "acme", "deploy", 10)
+	if err != nil {
+		t.Fatalf("SearchOrg: %v", err)
+	}
+	if got, want := messageIDs(results), []string{"r1", "o1", "g1"}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	results, _ = repo.SearchOrg(ctx, "acme", "deploy", 2)
+	if got, want := messageIDs(results), []string{"r1", "o1"}; !slices.Equal(got, want) {
+		t.Errorf("limited to 2: got %v, want %v", got, want)
+	}
+}
+
+func TestSearchOrgBoundsScan(t *testing.T) {
+	repo, _ := newTestMessageRepository(t, func(cfg *config.RedisConfig) {
+		cfg.SearchMaxGroups = 2
+		cfg.SearchScanPerGroup = 1
+	})
+	for i := 0; i < 4; i++ {
+		groupID := fmt.Sprintf("g%d", i)
+		saveAt(t, repo, "acme", groupID, groupID+"-old", "needle", 2*i)
+		saveAt(t, repo, "acme", groupID, groupID+"-new", "needle", 2*i+1)
+	}
+
+	results, err := repo.SearchOrg(context.Background(), "acme", "needle", 100)
+	if err != nil {
+		t.Fatalf("SearchOrg: %v", err)
+	}
+	// Two groups are scanned, and only the newest message of each
+	if len(results) != 2 {
+		t.Fatalf("got %v, want one match from each of 2 groups", messageIDs(results))
+	}
+	for _, msg := range results {
+		if msg.ID != msg.GroupID+"-new" {
+			t.Errorf("got %s, want only the newest message of each group", msg.ID)
+		}
+	}
+}
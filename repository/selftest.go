@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go-realtime-workspace/models"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// selfTestOrgID is the org the startup self-test writes under. Each run
+// uses a fresh group, so it never touches real history.
+const selfTestOrgID = "selftest"
+
+// selfTestTTL is set on the self-test keys, so they disappear on their own
+// if the cleanup fails.
+const selfTestTTL = time.Minute
+
+// ErrSelfTestFailed is wrapped by the errors SelfTest returns when Redis
+// accepted the commands but did not behave as the repository expects.
+var ErrSelfTestFailed = errors.New("redis self-test failed")
+
+// SelfTest checks that Redis supports the operations message history
+// relies on, beyond answering a ping. In a throwaway group it stores a
+// sample message the way Save does (payload encoding, a pipelined ZADD and
+// HSET with TTLs), reads it back through GetByID and checks its TTLs, then
+// removes the keys. It does not count towards quotas or activity.
+func (r *MessageRepository) SelfTest(ctx context.Context) (err error) {
+	groupID := uuid.New().String()
+	key, idxKey := groupKey(selfTestOrgID, groupID), indexKey(selfTestOrgID, groupID)
+	defer func() {
+		// Separate commands keep each key in its own hash slot under Redis Cluster
+		pipe := r.client.Pipeline()
+		pipe.Del(ctx, key)
+		pipe.Del(ctx, idxKey)
+		if _, cleanupErr := pipe.Exec(ctx); cleanupErr != nil && err == nil {
+			err = fmt.Errorf("error removing self-test keys: %w", cleanupErr)
+		}
+	}()
+
+	sample := models.ChatMessage{
+		ID:        r.ids.NewID(),
+		OrgID:     selfTestOrgID,
+		GroupID:   groupID,
+		ClientID:  "selftest",
+		Content:   "self-test message",
+		Timestamp: r.clock.Now(),
+	}
+	data, err := json.Marshal(sample)
+	if err != nil {
+		return fmt.Errorf("error marshaling self-test message: %w", err)
+	}
+	data, err = r.encodePayload(data)
+	if err != nil {
+		return err
+	}
+
+	pipe := r.client.Pipeline()
+	pipe.ZAdd(ctx, key, redis.Z{Score: score(sample.Timestamp), Member: data})
+	pipe.Expire(ctx, key, selfTestTTL)
+	pipe.HSet(ctx, idxKey, sample.ID, data)
+	pipe.Expire(ctx, idxKey, selfTestTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("error writing self-test message: %w", err)
+	}
+
+	stored, err := r.GetByID(ctx, selfTestOrgID, groupID, sample.ID)
+	if err != nil {
+		return fmt.Errorf("%w: reading back the message: %v", ErrSelfTestFailed, err)
+	}
+	if stored.Content != sample.Content || !stored.Timestamp.Equal(sample.Timestamp) {
+		return fmt.Errorf("%w: the message read back differs from the one written", ErrSelfTestFailed)
+	}
+
+	for _, k := range []string{key, idxKey} {
+		ttl, err := r.client.TTL(ctx, k).Result()
+		if err != nil {
+			return fmt.Errorf("error reading self-test TTL: %w", err)
+		}
+		if ttl <= 0 || ttl > selfTestTTL {
+			return fmt.Errorf("%w: %s has TTL %v, expected at most %v", ErrSelfTestFailed, k, ttl, selfTestTTL)
+		}
+	}
+
+	return nil
+}
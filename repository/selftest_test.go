@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// singleKeyHook fails a test when a DEL names several keys, which Redis
+// Cluster refuses with CROSSSLOT unless they share a hash slot.
+type singleKeyHook struct{ t *testing.T }
+
+func (h singleKeyHook) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (h singleKeyHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		h.check(cmd)
+		return next(ctx, cmd)
+	}
+}
+
+func (h singleKeyHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		for _, cmd := range cmds {
+			h.check(cmd)
+		}
+		return next(ctx, cmds)
+	}
+}
+
+func (h singleKeyHook) check(cmd redis.Cmder) {
+	if strings.EqualFold(cmd.Name(), "del") && len(cmd.Args()) > 2 {
+		h.t.Errorf("multi-key command %v", cmd.Args())
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	repo, srv := newTestMessageRepository(t, nil)
+	repo.client.AddHook(singleKeyHook{t})
+
+	if err := repo.SelfTest(context.Background()); err != nil {
+		t.Fatalf("SelfTest: %v", err)
+	}
+	if keys := srv.Keys(); len(keys) != 0 {
+		t.Errorf("self-test left keys behind: %v", keys)
+	}
+}
@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	"go-realtime-workspace/metrics"
+	"go-realtime-workspace/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Spillover metrics.
+var (
+	spilledMessages  = metrics.NewCounter("redis_spilled_messages_total")
+	replayedMessages = metrics.NewCounter("redis_spill_replayed_total")
+	droppedSpills    = metrics.NewCounter("redis_spill_dropped_total")
+)
+
+// ErrSpilloverFull is returned by Save when Redis is unavailable and
+// Redis.SpilloverSize messages are already held.
+var ErrSpilloverFull = errors.New("message spillover buffer is full")
+
+// redisUnavailable reports whether err means Redis could not be reached, as
+// opposed to Redis rejecting the command or the message being refused.
+func redisUnavailable(err error) bool {
+	var reply redis.Error
+	if errors.As(err, &reply) {
+		return false // Redis answered
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, redis.ErrClosed)
+}
+
+// spillMessage holds msg until ReplaySpillover stores it and returns it as
+// Save would, with its ID, timestamp and sanitized content. cause is the
+// error that kept it from being stored, if it was tried.
+func (r *MessageRepository) spillMessage(msg models.ChatMessage, cause error) (*models.ChatMessage, error) {
+	if msg.ID == "" {
+		msg.ID = r.ids.NewID()
+	}
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = r.clock.Now()
+	}
+
+	r.spillMu.Lock()
+	if len(r.spill) >= r.cfg.SpilloverSize {
+		r.spillMu.Unlock()
+		droppedSpills.Inc()
+		if cause != nil {
+			return nil, fmt.Errorf("%w: %v", ErrSpilloverFull, cause)
+		}
+		return nil, ErrSpilloverFull
+	}
+	r.spill = append(r.spill, msg) // Sanitized when it is stored
+	r.spillMu.Unlock()
+	spilledMessages.Inc()
+
+	msg.Content = r.sanitize.ApplyContent(msg.Content, models.StructuredContent(msg.ContentType))
+	return &msg, nil
+}
+
+// SpilloverLen returns the number of messages waiting to be stored.
+func (r *MessageRepository) SpilloverLen() int {
+	r.spillMu.Lock()
+	defer r.spillMu.Unlock()
+	return len(r.spill)
+}
+
+// ReplaySpillover stores the messages Save held during a Redis outage,
+// oldest first and with their original IDs and timestamps. It stops at the
+// first message that still cannot be reached, leaving it and the rest
+// queued, and returns how many were stored. Messages Redis rejects, such as
+// those over an org's quota, are dropped and counted. Only one replay may
+// run at a time.
+func (r *MessageRepository) ReplaySpillover(ctx context.Context) (int, error) {
+	replayed := 0
+	for {
+		r.spillMu.Lock()
+		if len(r.spill) == 0 {
+			r.spillMu.Unlock()
+			return replayed, nil
+		}
+		msg := r.spill[0]
+		r.spillMu.Unlock()
+
+		_, err := r.save(ctx, msg)
+		if err != nil && (redisUnavailable(err) || ctx.Err() != nil) {
+			return replayed, fmt.Errorf("error replaying held messages: %w", err)
+		}
+
+		r.spillMu.Lock()
+		r.spill[0] = models.ChatMessage{}
+		r.spill = r.spill[1:]
+		r.spillMu.Unlock()
+
+		if err != nil {
+			droppedSpills.Inc()
+			continue
+		}
+		replayedMessages.Inc()
+		replayed++
+	}
+}
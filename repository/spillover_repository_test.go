@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"go-realtime-workspace/config"
+	"go-realtime-workspace/models"
+)
+
+func TestSpilloverStoresMessagesAfterOutage(t *testing.T) {
+	repo, srv := newTestMessageRepository(t, func(cfg *config.RedisConfig) {
+		cfg.SpilloverSize = 3
+	})
+	ctx := context.Background()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	save := func(i int) (*models.ChatMessage, error) {
+		return repo.Save(ctx, models.ChatMessage{
+			ID: fmt.Sprintf("m%d", i), OrgID: "acme", GroupID: "general", ClientID: "alice",
+			Content: "hi", Timestamp: start.Add(time.Duration(i) * time.Second),
+		})
+	}
+	if _, err := save(0); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	srv.Close()
+	for i := 1; i <= 3; i++ {
+		saved, err := save(i)
+		if err != nil {
+			t.Fatalf("Save during the outage: %v", err)
+		}
+		if saved.ID != fmt.Sprintf("m%d", i) {
+			t.Errorf("held message returned with ID %q", saved.ID)
+		}
+	}
+	dropped := droppedSpills.Value()
+	if _, err := save(4); !errors.Is(err, ErrSpilloverFull) {
+		t.Errorf("past the buffer: got %v, want ErrSpilloverFull", err)
+	}
+	if got := droppedSpills.Value() - dropped; got != 1 {
+		t.Errorf("dropped counter rose by %d, want 1", got)
+	}
+
+	// Nothing is lost by replaying while Redis is still down
+	if n, err := repo.ReplaySpillover(ctx); err == nil || n != 0 {
+		t.Errorf("replay during the outage: %d stored, %v; want none and an error", n, err)
+	}
+	if held := repo.SpilloverLen(); held != 3 {
+		t.Fatalf("%d messages held, want 3", held)
+	}
+
+	if err := srv.Restart(); err != nil {
+		t.Fatalf("Restart: %v", err)
+	}
+	if n, err := repo.ReplaySpillover(ctx); err != nil || n != 3 {
+		t.Fatalf("replay: %d stored, %v; want 3", n, err)
+	}
+	history, err := repo.GetHistory(ctx, "acme", "general", 10)
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	if got, want := messageIDs(history), []string{"m3", "m2", "m1", "m0"}; !slices.Equal(got, want) {
+		t.Errorf("history %v, want %v", got, want)
+	}
+	for _, msg := range history {
+		if want := start.Add(time.Duration(msg.ID[1]-'0') * time.Second); !msg.Timestamp.Equal(want) {
+			t.Errorf("%s stored at %s, want its original %s", msg.ID, msg.Timestamp, want)
+		}
+	}
+}
+
+func TestSaveWithoutSpilloverFails(t *testing.T) {
+	repo, srv := newTestMessageRepository(t, nil)
+	srv.Close()
+	if _, err := repo.Save(context.Background(), models.ChatMessage{OrgID: "acme", GroupID: "general", ClientID: "alice", Content: "hi"}); err == nil {
+		t.Error("Save succeeded with Redis down and spillover disabled")
+	}
+	if held := repo.SpilloverLen(); held != 0 {
+		t.Errorf("%d messages held with spillover disabled", held)
+	}
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"go-realtime-workspace/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Star bookmarks a message for a user. Starred messages are private to the
+// user and may come from any group or DM room. Starring again refreshes the
+// starred time. With ProtectStarred set, a starred message is not trimmed
+// from its group's history while any user has it starred.
+func (r *MessageRepository) Star(ctx context.Context, userID, orgID, groupID, messageID string) error {
+	ref, err := json.Marshal(messageRef{OrgID: orgID, GroupID: groupID, ID: messageID})
+	if err != nil {
+		return fmt.Errorf("error marshaling starred message: %w", err)
+	}
+
+	key := starredKey(userID)
+	pipe := r.client.Pipeline()
+	added := pipe.ZAdd(ctx, key, redis.Z{Score: score(r.clock.Now()), Member: ref})
+	pipe.Expire(ctx, key, r.cfg.MessageTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("error starring message: %w", err)
+	}
+
+	if r.cfg.ProtectStarred && added.Val() > 0 {
+		// A star on a message that is gone has nothing to protect
+		if err := r.protect(ctx, orgID, groupID, messageID); err != nil && !errors.Is(err, ErrMessageNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Unstar removes a message from a user's starred set.
+func (r *MessageRepository) Unstar(ctx context.Context, userID, orgID, groupID, messageID string) error {
+	ref, err := json.Marshal(messageRef{OrgID: orgID, GroupID: groupID, ID: messageID})
+	if err != nil {
+		return fmt.Errorf("error marshaling starred message: %w", err)
+	}
+
+	removed, err := r.client.ZRem(ctx, starredKey(userID), ref).Result()
+	if err != nil {
+		return fmt.Errorf("error unstarring message: %w", err)
+	}
+
+	if r.cfg.ProtectStarred && removed > 0 {
+		return r.unprotect(ctx, orgID, groupID, messageID)
+	}
+	return nil
+}
+
+// ListStarred returns a user's starred messages, most recently starred first.
+// References to messages that were deleted or trimmed are dropped.
+func (r *MessageRepository) ListStarred(ctx context.Context, userID string, limit int64) ([]models.ChatMessage, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+
+	key := starredKey(userID)
+	refs, err := r.client.ZRevRange(ctx, key, 0, limit-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error getting starred messages: %w", err)
+	}
+
+	messages := make([]models.ChatMessage, 0, len(refs))
+	for _, data := range refs {
+		var ref messageRef
+		if err := json.Unmarshal([]byte(data), &ref); err != nil {
+			continue
+		}
+
+		msg, err := r.GetByID(ctx, ref.OrgID, ref.GroupID, ref.ID)
+		if errors.Is(err, ErrMessageNotFound) {
+			r.client.ZRem(ctx, key, data)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, *msg)
+	}
+
+	return messages, nil
+}
+
+// starredKey returns the sorted set of a user's starred message references.
+func starredKey(userID string) string {
+	return fmt.Sprintf("starred:%s", userID)
+}
@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"go-realtime-workspace/clock"
+	"go-realtime-workspace/config"
+	"go-realtime-workspace/models"
+)
+
+func TestStarGroupAndDMMessages(t *testing.T) {
+	repo, _ := newTestMessageRepository(t, nil)
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(start)
+	repo.SetClock(clk)
+	ctx := context.Background()
+
+	saveAt(t, repo, "acme", "general", "group-msg", "standup moved", 0)
+	saveAt(t, repo, "acme", "general", "deleted-msg", "oops", 1)
+	_, err := repo.Save(ctx, models.ChatMessage{
+		ID: "dm-msg", OrgID: DMOrgID, GroupID: "alice_bob", ClientID: "bob", RecipientID: "alice",
+		Content: "the password is in the vault", Timestamp: start,
+	})
+	if err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	for _, ref := range []messageRef{
+		{OrgID: "acme", GroupID: "general", ID: "group-msg"},
+		{OrgID: "acme", GroupID: "general", ID: "deleted-msg"},
+		{OrgID: DMOrgID, GroupID: "alice_bob", ID: "dm-msg"},
+	} {
+		clk.Advance(time.Second)
+		if err := repo.Star(ctx, "alice", ref.OrgID, ref.GroupID, ref.ID); err != nil {
+			t.Fatalf("Star %s: %v", ref.ID, err)
+		}
+	}
+	if err := repo.Delete(ctx, "acme", "general", "deleted-msg"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	starred, err := repo.ListStarred(ctx, "alice", 10)
+	if err != nil {
+		t.Fatalf("ListStarred: %v", err)
+	}
+	if got, want := messageIDs(starred), []string{"dm-msg", "group-msg"}; !slices.Equal(got, want) {
+		t.Errorf("starred %v, want %v", got, want)
+	}
+
+	// Stars are private to the user
+	if starred, _ := repo.ListStarred(ctx, "bob", 10); len(starred) != 0 {
+		t.Errorf("bob sees alice's stars: %v", messageIDs(starred))
+	}
+
+	if err := repo.Unstar(ctx, "alice", DMOrgID, "alice_bob", "dm-msg"); err != nil {
+		t.Fatalf("Unstar: %v", err)
+	}
+	starred, _ = repo.ListStarred(ctx, "alice", 10)
+	if got, want := messageIDs(starred), []string{"group-msg"}; !slices.Equal(got, want) {
+		t.Errorf("after unstarring: %v, want %v", got, want)
+	}
+}
+
+func TestStarredMessagesSurviveTrimming(t *testing.T) {
+	repo, _ := newTestMessageRepository(t, func(cfg *config.RedisConfig) {
+		cfg.MaxMessages = 2
+		cfg.ProtectStarred = true
+	})
+	ctx := context.Background()
+
+	saveAt(t, repo, "acme", "general", "starred", "keep me", 0)
+	if err := repo.Star(ctx, "alice", "acme", "general", "starred"); err != nil {
+		t.Fatalf("Star: %v", err)
+	}
+	for i := 1; i <= 3; i++ {
+		saveAt(t, repo, "acme", "general", fmt.Sprintf("m%d", i), "filler", i)
+	}
+
+	if _, err := repo.GetByID(ctx, "acme", "general", "starred"); err != nil {
+		t.Errorf("starred message was trimmed: %v", err)
+	}
+	if starred, _ := repo.ListStarred(ctx, "alice", 10); len(starred) != 1 {
+		t.Errorf("starred %v, want the protected message", messageIDs(starred))
+	}
+}
@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go-realtime-workspace/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// summaryScanPerGroup bounds how many of a group's newest unread messages
+// MissedSummary reads to count mentions; older unread messages are counted
+// as unread but not checked for mentions.
+const summaryScanPerGroup = 500
+
+// MissedSummary counts what a user has not read: unread messages in the
+// given groups of orgID and in every other group of orgID the user has a
+// read marker for, the unread ones mentioning any of handles (the user's ID
+// and username), and unread messages in the user's DM rooms. An empty orgID
+// counts DMs only. Like UnreadCount, a conversation without a read marker
+// counts every stored message as unread.
+func (r *MessageRepository) MissedSummary(ctx context.Context, userID, orgID string, groupIDs []string, handles []string) (*models.MissedSummary, error) {
+	pipe := r.client.Pipeline()
+	markersCmd := pipe.HGetAll(ctx, readMarkersKey(userID))
+	roomsCmd := pipe.ZRange(ctx, dmRoomsKey(userID), 0, -1)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("error getting read markers: %w", err)
+	}
+	markers := markersCmd.Val()
+
+	groups := make(map[string]bool)
+	if orgID != "" {
+		for _, groupID := range groupIDs {
+			groups[groupID] = true
+		}
+		for field := range markers {
+			if groupID, ok := strings.CutPrefix(field, orgID+":"); ok {
+				groups[groupID] = true
+			}
+		}
+	}
+
+	// unreadFrom returns the score range start of a conversation's unread messages
+	unreadFrom := func(field string) string {
+		if marker, ok := markers[field]; ok {
+			return "(" + marker
+		}
+		return "-inf"
+	}
+
+	pipe = r.client.Pipeline()
+	groupCounts := make(map[string]*redis.IntCmd, len(groups))
+	for groupID := range groups {
+		groupCounts[groupID] = pipe.ZCount(ctx, groupKey(orgID, groupID), unreadFrom(markerField(orgID, groupID)), "+inf")
+	}
+	rooms := roomsCmd.Val()
+	roomCounts := make([]*redis.IntCmd, len(rooms))
+	for i, roomID := range rooms {
+		roomCounts[i] = pipe.ZCount(ctx, groupKey(DMOrgID, roomID), unreadFrom(markerField(DMOrgID, roomID)), "+inf")
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("error counting unread messages: %w", err)
+	}
+
+	summary := &models.MissedSummary{Groups: []models.GroupUnread{}}
+	for _, count := range roomCounts {
+		if n := count.Val(); n > 0 {
+			summary.DMs += n
+			summary.DMRooms++
+		}
+	}
+
+	// Read the newest unread messages of each group to count mentions
+	pipe = r.client.Pipeline()
+	unread := make(map[string]*redis.StringSliceCmd)
+	for groupID, count := range groupCounts {
+		if count.Val() == 0 {
+			continue
+		}
+		unread[groupID] = pipe.ZRevRangeByScore(ctx, groupKey(orgID, groupID), &redis.ZRangeBy{
+			Min:   unreadFrom(markerField(orgID, groupID)),
+			Max:   "+inf",
+			Count: summaryScanPerGroup,
+		})
+	}
+	if len(unread) > 0 {
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return nil, fmt.Errorf("error getting unread messages: %w", err)
+		}
+	}
+
+	for groupID, results := range unread {
+		messages, err := r.decodeMessages(ctx, orgID, results.Val())
+		if err != nil {
+			return nil, err
+		}
+		group := models.GroupUnread{OrgID: orgID, GroupID: groupID, Unread: groupCounts[groupID].Val()}
+		for _, msg := range messages {
+			if msg.ClientID != userID && models.Mentions(msg.Content, handles...) {
+				group.Mentions++
+			}
+		}
+		summary.Groups = append(summary.Groups, group)
+		summary.Unread += group.Unread
+		summary.Mentions += group.Mentions
+	}
+	sort.Slice(summary.Groups, func(i, j int) bool {
+		return summary.Groups[i].GroupID < summary.Groups[j].GroupID
+	})
+
+	return summary, nil
+}
+
+// GetUnread returns up to limit of the oldest messages in a group or DM
+// room that are newer than the user's read marker, oldest first.
+func (r *MessageRepository) GetUnread(ctx context.Context, userID, orgID, groupID string, limit int64) ([]models.ChatMessage, error) {
+	min := "-inf"
+	marker, err := r.client.HGet(ctx, readMarkersKey(userID), markerField(orgID, groupID)).Result()
+	if err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("error getting read marker: %w", err)
+	}
+	if err == nil {
+		min = "(" + marker
+	}
+
+	results, err := r.client.ZRangeByScore(ctx, groupKey(orgID, groupID), &redis.ZRangeBy{
+		Min:   min,
+		Max:   "+inf",
+		Count: limit,
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error getting unread messages: %w", err)
+	}
+
+	messages, err := r.decodeMessages(ctx, orgID, results)
+	if err != nil {
+		return nil, err
+	}
+	return messages, r.attachReactions(ctx, orgID, groupID, messages)
+}
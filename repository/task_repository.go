@@ -3,36 +3,62 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"go-realtime-workspace/clock"
 	"go-realtime-workspace/models"
+	"sort"
+	"strings"
 	"time"
+
+	"github.com/lib/pq"
+)
+
+// ErrInvalidTaskOrder is returned by Reorder for IDs that are not the
+// user's tasks or that repeat.
+var ErrInvalidTaskOrder = errors.New("invalid task order")
+
+// Manual task positions are spaced taskPositionGap apart, so a task can be
+// moved between two others by giving it the midpoint of their positions.
+// Once neighbours get closer than minTaskPositionStep the user's tasks are
+// renumbered.
+const (
+	taskPositionGap     = 1024
+	minTaskPositionStep = 1e-6
 )
 
 // TaskRepository handles task database operations.
 type TaskRepository struct {
-	db *sql.DB
+	db    *sql.DB
+	clock clock.Clock
 }
 
 // NewTaskRepository creates a new task repository.
 func NewTaskRepository(db *sql.DB) *TaskRepository {
-	return &TaskRepository{db: db}
+	return &TaskRepository{db: db, clock: clock.Real{}}
 }
 
-// Create creates a new task.
+// SetClock replaces the clock used to compute due-soon windows.
+func (r *TaskRepository) SetClock(c clock.Clock) {
+	r.clock = c
+}
+
+// Create creates a new task at the end of the user's manual order.
 func (r *TaskRepository) Create(ctx context.Context, userID string, req models.CreateTaskRequest) (*models.Task, error) {
 	query := `
-		INSERT INTO tasks (user_id, title, description, priority, due_date)
-		VALUES ($1, $2, $3, $4, $5)
-		RETURNING id, user_id, title, description, status, priority, due_date, created_at, updated_at, completed_at
+		INSERT INTO tasks (user_id, title, description, priority, due_date, position)
+		VALUES ($1, $2, $3, $4, $5,
+			COALESCE((SELECT MAX(position) FROM tasks WHERE user_id = $1), 0) + $6)
+		RETURNING id, user_id, title, description, status, priority, due_date, position, created_at, updated_at, completed_at
 	`
 
 	task := &models.Task{}
 	err := r.db.QueryRowContext(
 		ctx, query,
-		userID, req.Title, req.Description, req.Priority, req.DueDate,
+		userID, req.Title, req.Description, req.Priority, req.DueDate, taskPositionGap,
 	).Scan(
 		&task.ID, &task.UserID, &task.Title, &task.Description,
-		&task.Status, &task.Priority, &task.DueDate,
+		&task.Status, &task.Priority, &task.DueDate, &task.Position,
 		&task.CreatedAt, &task.UpdatedAt, &task.CompletedAt,
 	)
 
@@ -46,14 +72,14 @@ func (r *TaskRepository) Create(ctx context.Context, userID string, req models.C
 // GetByID retrieves a task by ID.
 func (r *TaskRepository) GetByID(ctx context.Context, id string) (*models.Task, error) {
 	query := `
-		SELECT id, user_id, title, description, status, priority, due_date, created_at, updated_at, completed_at
+		SELECT id, user_id, title, description, status, priority, due_date, position, created_at, updated_at, completed_at
 		FROM tasks WHERE id = $1
 	`
 
 	task := &models.Task{}
 	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&task.ID, &task.UserID, &task.Title, &task.Description,
-		&task.Status, &task.Priority, &task.DueDate,
+		&task.Status, &task.Priority, &task.DueDate, &task.Position,
 		&task.CreatedAt, &task.UpdatedAt, &task.CompletedAt,
 	)
 
@@ -67,26 +93,38 @@ func (r *TaskRepository) GetByID(ctx context.Context, id string) (*models.Task,
 	return task, nil
 }
 
-// GetByUserID retrieves all tasks for a user.
-func (r *TaskRepository) GetByUserID(ctx context.Context, userID string, status string) ([]models.Task, error) {
-	var query string
-	var args []interface{}
+// taskDocument is the text matched by task searches. It must stay identical
+// to the expression of the idx_tasks_search index in schema.sql.
+const taskDocument = `to_tsvector('english', t.title || ' ' || COALESCE(t.description, ''))`
+
+// GetByUserID retrieves all tasks for a user, optionally narrowed to a
+// status and to tasks whose title or description match search. With sortBy
+// models.TaskSortManual tasks follow the user's manual order; otherwise
+// matches are ranked by relevance and other tasks are ordered newest first.
+func (r *TaskRepository) GetByUserID(ctx context.Context, userID, status, search, sortBy string) ([]models.Task, error) {
+	conditions := []string{"t.user_id = $1"}
+	args := []interface{}{userID}
+	order := "t.created_at DESC"
 
 	if status != "" {
-		query = `
-			SELECT id, user_id, title, description, status, priority, due_date, created_at, updated_at, completed_at
-			FROM tasks WHERE user_id = $1 AND status = $2
-			ORDER BY created_at DESC
-		`
-		args = []interface{}{userID, status}
-	} else {
-		query = `
-			SELECT id, user_id, title, description, status, priority, due_date, created_at, updated_at, completed_at
-			FROM tasks WHERE user_id = $1
-			ORDER BY created_at DESC
-		`
-		args = []interface{}{userID}
+		args = append(args, status)
+		conditions = append(conditions, fmt.Sprintf("t.status = $%d", len(args)))
 	}
+	if search != "" {
+		args = append(args, search)
+		conditions = append(conditions, fmt.Sprintf("%s @@ plainto_tsquery('english', $%d)", taskDocument, len(args)))
+		order = fmt.Sprintf("ts_rank(%s, plainto_tsquery('english', $%d)) DESC, %s", taskDocument, len(args), order)
+	}
+	if sortBy == models.TaskSortManual {
+		order = "t.position, t.created_at"
+	}
+
+	query := fmt.Sprintf(`
+		SELECT t.id, t.user_id, t.title, t.description, t.status, t.priority, t.due_date, t.position, t.created_at, t.updated_at, t.completed_at
+		FROM tasks t
+		WHERE %s
+		ORDER BY %s
+	`, strings.Join(conditions, " AND "), order)
 
 	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -99,7 +137,81 @@ func (r *TaskRepository) GetByUserID(ctx context.Context, userID string, status
 		var task models.Task
 		err := rows.Scan(
 			&task.ID, &task.UserID, &task.Title, &task.Description,
-			&task.Status, &task.Priority, &task.DueDate,
+			&task.Status, &task.Priority, &task.DueDate, &task.Position,
+			&task.CreatedAt, &task.UpdatedAt, &task.CompletedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning task: %w", err)
+		}
+		tasks = append(tasks, task)
+	}
+
+	return tasks, nil
+}
+
+// GetByOrgID retrieves tasks for all users in an organization, narrowed by
+// the optional filters and paginated with Limit and either Offset or After.
+func (r *TaskRepository) GetByOrgID(ctx context.Context, orgID string, filter models.TaskFilter) ([]models.Task, error) {
+	conditions := []string{"u.org_id = $1"}
+	args := []interface{}{orgID}
+
+	addCondition := func(clause string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(clause, len(args)))
+	}
+
+	if filter.Status != "" {
+		addCondition("t.status = $%d", filter.Status)
+	}
+	if filter.AssigneeID != "" {
+		addCondition("t.user_id = $%d", filter.AssigneeID)
+	}
+	if filter.Priority != "" {
+		addCondition("t.priority = $%d", filter.Priority)
+	}
+	if filter.DueAfter != nil {
+		addCondition("t.due_date >= $%d", *filter.DueAfter)
+	}
+	if filter.DueBefore != nil {
+		addCondition("t.due_date <= $%d", *filter.DueBefore)
+	}
+	if filter.After != nil {
+		args = append(args, filter.After.Time, filter.After.ID)
+		conditions = append(conditions, fmt.Sprintf("(t.created_at, t.id) < ($%d, $%d)", len(args)-1, len(args)))
+	}
+	order := "t.created_at DESC, t.id DESC"
+	if filter.Search != "" {
+		addCondition(taskDocument+" @@ plainto_tsquery('english', $%d)", filter.Search)
+		order = fmt.Sprintf("ts_rank(%s, plainto_tsquery('english', $%d)) DESC, %s", taskDocument, len(args), order)
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+	args = append(args, limit, filter.Offset)
+
+	query := fmt.Sprintf(`
+		SELECT t.id, t.user_id, t.title, t.description, t.status, t.priority, t.due_date, t.position, t.created_at, t.updated_at, t.completed_at
+		FROM tasks t
+		JOIN users u ON u.id = t.user_id
+		WHERE %s
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d
+	`, strings.Join(conditions, " AND "), order, len(args)-1, len(args))
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error getting org tasks: %w", err)
+	}
+	defer rows.Close()
+
+	tasks := []models.Task{}
+	for rows.Next() {
+		var task models.Task
+		err := rows.Scan(
+			&task.ID, &task.UserID, &task.Title, &task.Description,
+			&task.Status, &task.Priority, &task.DueDate, &task.Position,
 			&task.CreatedAt, &task.UpdatedAt, &task.CompletedAt,
 		)
 		if err != nil {
@@ -111,27 +223,46 @@ func (r *TaskRepository) GetByUserID(ctx context.Context, userID string, status
 	return tasks, nil
 }
 
-// Update updates a task.
+// Update changes the fields of a task that are set in req, leaving the
+// others as they are.
 func (r *TaskRepository) Update(ctx context.Context, id string, req models.UpdateTaskRequest) (*models.Task, error) {
-	query := `
+	sets := []string{}
+	args := []interface{}{}
+
+	addSet := func(column string, value interface{}) {
+		args = append(args, value)
+		sets = append(sets, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+
+	if req.Title != nil {
+		addSet("title", *req.Title)
+	}
+	if req.Description != nil {
+		addSet("description", *req.Description)
+	}
+	if req.Status != nil {
+		addSet("status", *req.Status)
+	}
+	if req.Priority != nil {
+		addSet("priority", *req.Priority)
+	}
+	if req.DueDate.Set {
+		addSet("due_date", req.DueDate.Time)
+	}
+	sets = append(sets, "updated_at = CURRENT_TIMESTAMP")
+	args = append(args, id)
+
+	query := fmt.Sprintf(`
 		UPDATE tasks
-		SET title = COALESCE(NULLIF($1, ''), title),
-		    description = COALESCE(NULLIF($2, ''), description),
-		    status = COALESCE(NULLIF($3, ''), status),
-		    priority = COALESCE(NULLIF($4, ''), priority),
-		    due_date = COALESCE($5, due_date),
-		    updated_at = CURRENT_TIMESTAMP
-		WHERE id = $6
-		RETURNING id, user_id, title, description, status, priority, due_date, created_at, updated_at, completed_at
-	`
+		SET %s
+		WHERE id = $%d
+		RETURNING id, user_id, title, description, status, priority, due_date, position, created_at, updated_at, completed_at
+	`, strings.Join(sets, ", "), len(args))
 
 	task := &models.Task{}
-	err := r.db.QueryRowContext(
-		ctx, query,
-		req.Title, req.Description, req.Status, req.Priority, req.DueDate, id,
-	).Scan(
+	err := r.db.QueryRowContext(ctx, query, args...).Scan(
 		&task.ID, &task.UserID, &task.Title, &task.Description,
-		&task.Status, &task.Priority, &task.DueDate,
+		&task.Status, &task.Priority, &task.DueDate, &task.Position,
 		&task.CreatedAt, &task.UpdatedAt, &task.CompletedAt,
 	)
 
@@ -169,7 +300,7 @@ func (r *TaskRepository) Delete(ctx context.Context, id string) error {
 // GetDueSoon retrieves tasks that are due within the specified duration.
 func (r *TaskRepository) GetDueSoon(ctx context.Context, userID string, within time.Duration) ([]models.Task, error) {
 	query := `
-		SELECT id, user_id, title, description, status, priority, due_date, created_at, updated_at, completed_at
+		SELECT id, user_id, title, description, status, priority, due_date, position, created_at, updated_at, completed_at
 		FROM tasks 
 		WHERE user_id = $1 
 		  AND status != 'completed'
@@ -178,7 +309,7 @@ func (r *TaskRepository) GetDueSoon(ctx context.Context, userID string, within t
 		ORDER BY due_date ASC
 	`
 
-	dueBy := time.Now().Add(within)
+	dueBy := r.clock.Now().Add(within)
 	rows, err := r.db.QueryContext(ctx, query, userID, dueBy)
 	if err != nil {
 		return nil, fmt.Errorf("error getting due tasks: %w", err)
@@ -190,7 +321,7 @@ func (r *TaskRepository) GetDueSoon(ctx context.Context, userID string, within t
 		var task models.Task
 		err := rows.Scan(
 			&task.ID, &task.UserID, &task.Title, &task.Description,
-			&task.Status, &task.Priority, &task.DueDate,
+			&task.Status, &task.Priority, &task.DueDate, &task.Position,
 			&task.CreatedAt, &task.UpdatedAt, &task.CompletedAt,
 		)
 		if err != nil {
@@ -201,3 +332,163 @@ func (r *TaskRepository) GetDueSoon(ctx context.Context, userID string, within t
 
 	return tasks, nil
 }
+
+// Reorder sets the manual order of a user's tasks: the tasks in orderedIDs
+// come first, in that order, followed by the user's other tasks in their
+// current order. Only tasks whose position must change are updated, each
+// getting a position between its new neighbours, so moving one task
+// rewrites one row. The update runs in one transaction with the user's
+// tasks locked. It returns the user's tasks in the new order, or an error
+// wrapping ErrInvalidTaskOrder.
+func (r *TaskRepository) Reorder(ctx context.Context, userID string, orderedIDs []string) ([]models.Task, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, position FROM tasks
+		WHERE user_id = $1
+		ORDER BY position, created_at
+		FOR UPDATE
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting task order: %w", err)
+	}
+	var current []string
+	positions := make(map[string]float64)
+	for rows.Next() {
+		var id string
+		var position float64
+		if err := rows.Scan(&id, &position); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error scanning task order: %w", err)
+		}
+		current = append(current, id)
+		positions[id] = position
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error getting task order: %w", err)
+	}
+
+	// The requested tasks first, then the rest in their current order
+	listed := make(map[string]bool, len(orderedIDs))
+	for _, id := range orderedIDs {
+		if _, ok := positions[id]; !ok {
+			return nil, fmt.Errorf("%w: task %s is not one of the user's tasks", ErrInvalidTaskOrder, id)
+		}
+		if listed[id] {
+			return nil, fmt.Errorf("%w: task %s is listed twice", ErrInvalidTaskOrder, id)
+		}
+		listed[id] = true
+	}
+	order := append([]string(nil), orderedIDs...)
+	for _, id := range current {
+		if !listed[id] {
+			order = append(order, id)
+		}
+	}
+
+	old := make([]float64, len(order))
+	for i, id := range order {
+		old[i] = positions[id]
+	}
+	var ids []string
+	var values []float64
+	for i, position := range rankPositions(old) {
+		if position != old[i] {
+			ids = append(ids, order[i])
+			values = append(values, position)
+		}
+	}
+
+	if len(ids) > 0 {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE tasks t SET position = v.position
+			FROM unnest($1::uuid[], $2::float8[]) AS v(id, position)
+			WHERE t.id = v.id
+		`, pq.Array(ids), pq.Array(values))
+		if err != nil {
+			return nil, fmt.Errorf("error updating task order: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing task order: %w", err)
+	}
+
+	return r.GetByUserID(ctx, userID, "", "", models.TaskSortManual)
+}
+
+// rankPositions returns positions for tasks listed in their new order,
+// given their current positions. The longest run of tasks that are already
+// in increasing order keeps its positions; the others are spread evenly
+// between their new neighbours, or placed taskPositionGap apart past the
+// first or last kept task. If that would leave neighbours closer than
+// minTaskPositionStep, every task is renumbered taskPositionGap apart.
+func rankPositions(current []float64) []float64 {
+	n := len(current)
+	positions := append([]float64(nil), current...)
+	if n == 0 {
+		return positions
+	}
+
+	// Longest strictly increasing subsequence, by patience sorting
+	tails := []int{}       // tails[k] is the index ending the best run of length k+1
+	prev := make([]int, n) // prev[i] is the index before i in its run
+	for i, position := range current {
+		k := sort.Search(len(tails), func(k int) bool { return current[tails[k]] >= position })
+		prev[i] = -1
+		if k > 0 {
+			prev[i] = tails[k-1]
+		}
+		if k == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[k] = i
+		}
+	}
+	kept := make([]bool, n)
+	for i := tails[len(tails)-1]; i >= 0; i = prev[i] {
+		kept[i] = true
+	}
+
+	for start := 0; start < n; {
+		if kept[start] {
+			start++
+			continue
+		}
+		end := start
+		for end < n && !kept[end] {
+			end++
+		}
+
+		// Spread positions[start:end] between the neighbouring kept tasks
+		count := float64(end - start)
+		var lo, hi float64
+		switch {
+		case start == 0:
+			hi = positions[end]
+			lo = hi - taskPositionGap*(count+1)
+		case end == n:
+			lo = positions[start-1]
+			hi = lo + taskPositionGap*(count+1)
+		default:
+			lo, hi = positions[start-1], positions[end]
+		}
+		step := (hi - lo) / (count + 1)
+		if step < minTaskPositionStep {
+			for i := range positions {
+				positions[i] = float64(i+1) * taskPositionGap
+			}
+			return positions
+		}
+		for i := start; i < end; i++ {
+			positions[i] = lo + step*float64(i-start+1)
+		}
+		start = end
+	}
+	return positions
+}
@@ -0,0 +1,222 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"go-realtime-workspace/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// taskColumns are the columns task queries return.
+var taskColumns = []string{"id", "user_id", "title", "description", "status", "priority", "due_date", "position", "created_at", "updated_at", "completed_at"}
+
+// newMockTaskRepository returns a task repository backed by a SQL mock.
+func newMockTaskRepository(t *testing.T) (*TaskRepository, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return NewTaskRepository(db), mock
+}
+
+func TestGetByOrgIDCombinesFilters(t *testing.T) {
+	repo, mock := newMockTaskRepository(t)
+	after := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	before := after.Add(7 * 24 * time.Hour)
+	now := time.Now()
+
+	mock.ExpectQuery(`FROM tasks t\s+JOIN users u ON u.id = t.user_id\s+`+
+		`WHERE u.org_id = \$1 AND t.status = \$2 AND t.user_id = \$3 AND t.priority = \$4 AND t.due_date >= \$5 AND t.due_date <= \$6\s+`+
+		`ORDER BY t.created_at DESC, t.id DESC\s+LIMIT \$7 OFFSET \$8`).
+		WithArgs("acme", models.TaskStatusPending, "bob", "high", after, before, 10, 20).
+		WillReturnRows(sqlmock.NewRows(taskColumns).
+			AddRow("t1", "bob", "Ship it", "", models.TaskStatusPending, "high", after.Add(time.Hour), 1.0, now, now, nil))
+
+	tasks, err := repo.GetByOrgID(context.Background(), "acme", models.TaskFilter{
+		Status:     models.TaskStatusPending,
+		AssigneeID: "bob",
+		Priority:   "high",
+		DueAfter:   &after,
+		DueBefore:  &before,
+		Limit:      10,
+		Offset:     20,
+	})
+	if err != nil {
+		t.Fatalf("GetByOrgID: %v", err)
+	}
+	if len(tasks) != 1 || tasks[0].ID != "t1" {
+		t.Errorf("got %+v, want task t1", tasks)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetByOrgIDDefaultsPageSize(t *testing.T) {
+	repo, mock := newMockTaskRepository(t)
+	mock.ExpectQuery(`WHERE u.org_id = \$1\s+ORDER BY .*LIMIT \$2 OFFSET \$3`).
+		WithArgs("acme", 50, 0).
+		WillReturnRows(sqlmock.NewRows(taskColumns))
+
+	tasks, err := repo.GetByOrgID(context.Background(), "acme", models.TaskFilter{})
+	if err != nil {
+		t.Fatalf("GetByOrgID: %v", err)
+	}
+	if tasks == nil || len(tasks) != 0 {
+		t.Errorf("got %v, want an empty list", tasks)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetByUserIDSearch(t *testing.T) {
+	repo, mock := newMockTaskRepository(t)
+	now := time.Now()
+	match := regexp.QuoteMeta(taskDocument + " @@ plainto_tsquery('english', $3)")
+	rank := regexp.QuoteMeta("ORDER BY ts_rank(" + taskDocument + ", plainto_tsquery('english', $3)) DESC, t.created_at DESC")
+
+	// Matching tasks come back in the order Postgres ranks them
+	mock.ExpectQuery(`WHERE t.user_id = \$1 AND t.status = \$2 AND `+match+`\s+`+rank).
+		WithArgs("bob", models.TaskStatusPending, "release notes").
+		WillReturnRows(sqlmock.NewRows(taskColumns).
+			AddRow("t2", "bob", "Release notes", "Draft the release notes", models.TaskStatusPending, "high", nil, 2.0, now, now, nil).
+			AddRow("t1", "bob", "Ship it", "Publish after the release notes", models.TaskStatusPending, "low", nil, 1.0, now, now, nil))
+	tasks, err := repo.GetByUserID(context.Background(), "bob", models.TaskStatusPending, "release notes", "")
+	if err != nil {
+		t.Fatalf("GetByUserID: %v", err)
+	}
+	if len(tasks) != 2 || tasks[0].ID != "t2" || tasks[1].ID != "t1" {
+		t.Errorf("got %+v, want t2 then t1", tasks)
+	}
+
+	mock.ExpectQuery(`WHERE t.user_id = \$1 AND `+regexp.QuoteMeta(taskDocument+" @@ plainto_tsquery('english', $2)")).
+		WithArgs("bob", "nothing like it").
+		WillReturnRows(sqlmock.NewRows(taskColumns))
+	tasks, err = repo.GetByUserID(context.Background(), "bob", "", "nothing like it", "")
+	if err != nil {
+		t.Fatalf("GetByUserID: %v", err)
+	}
+	if tasks == nil || len(tasks) != 0 {
+		t.Errorf("got %v, want an empty list", tasks)
+	}
+
+	// Without a search, tasks are not ranked
+	mock.ExpectQuery(`WHERE t.user_id = \$1\s+ORDER BY t.created_at DESC\s*$`).
+		WithArgs("bob").
+		WillReturnRows(sqlmock.NewRows(taskColumns))
+	if _, err := repo.GetByUserID(context.Background(), "bob", "", "", ""); err != nil {
+		t.Fatalf("GetByUserID: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetByOrgIDSearch(t *testing.T) {
+	repo, mock := newMockTaskRepository(t)
+	match := regexp.QuoteMeta(taskDocument + " @@ plainto_tsquery('english', $3)")
+	rank := regexp.QuoteMeta("ORDER BY ts_rank(" + taskDocument + ", plainto_tsquery('english', $3)) DESC, t.created_at DESC, t.id DESC")
+	mock.ExpectQuery(`WHERE u.org_id = \$1 AND t.status = \$2 AND `+match+`\s+`+rank+`\s+LIMIT \$4 OFFSET \$5`).
+		WithArgs("acme", models.TaskStatusPending, "deploy", 50, 0).
+		WillReturnRows(sqlmock.NewRows(taskColumns))
+
+	if _, err := repo.GetByOrgID(context.Background(), "acme", models.TaskFilter{Status: models.TaskStatusPending, Search: "deploy"}); err != nil {
+		t.Fatalf("GetByOrgID: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTaskSearchUsesIndexedExpression(t *testing.T) {
+	schema, err := os.ReadFile("../database/schema.sql")
+	if err != nil {
+		t.Fatalf("read schema: %v", err)
+	}
+	// The index is on the bare columns; queries qualify them with t.
+	indexed := strings.ReplaceAll(taskDocument, "t.", "")
+	if !strings.Contains(string(schema), "idx_tasks_search ON tasks USING GIN ("+indexed+")") {
+		t.Errorf("idx_tasks_search does not index %s, so searches cannot use it", indexed)
+	}
+}
+
+func TestRankPositions(t *testing.T) {
+	tests := []struct {
+		name    string
+		current []float64 // Current positions, in the new order
+		want    []float64
+	}{
+		{"unchanged", []float64{1024, 2048, 3072}, []float64{1024, 2048, 3072}},
+		{"insert between two", []float64{1024, 3072, 2048}, []float64{1024, 1536, 2048}},
+		{"move to the top", []float64{3072, 1024, 2048}, []float64{0, 1024, 2048}},
+		{"move to the bottom", []float64{2048, 3072, 1024}, []float64{2048, 3072, 4096}},
+		{"longest run kept", []float64{1024, 4096, 5120, 2048}, []float64{1024, 4096, 5120, 6144}},
+		{"two moved together", []float64{4096, 5120, 1024, 2048, 3072}, []float64{-1024, 0, 1024, 2048, 3072}},
+		{"gap exhausted", []float64{1, 3, 1 + 1e-7}, []float64{1024, 2048, 3072}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rankPositions(tt.current)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if diff := got[i] - tt.want[i]; diff > 1e-9 || diff < -1e-9 {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestReorderMovesOnlyTheMovedTask(t *testing.T) {
+	repo, mock := newMockTaskRepository(t)
+	now := time.Now()
+	current := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "position"}).
+			AddRow("a", 1024.0).AddRow("b", 2048.0).AddRow("c", 3072.0)
+	}
+
+	// Moving c between a and b rewrites c alone, halfway between them
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id, position FROM tasks\s+WHERE user_id = \$1\s+ORDER BY position, created_at\s+FOR UPDATE`).
+		WithArgs("bob").WillReturnRows(current())
+	mock.ExpectExec("UPDATE tasks t SET position").WithArgs(`{"c"}`, "{1536}").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`WHERE t.user_id = \$1\s+ORDER BY t.position, t.created_at`).WithArgs("bob").
+		WillReturnRows(sqlmock.NewRows(taskColumns).
+			AddRow("a", "bob", "A", "", models.TaskStatusPending, "medium", nil, 1024.0, now, now, nil).
+			AddRow("c", "bob", "C", "", models.TaskStatusPending, "medium", nil, 1536.0, now, now, nil).
+			AddRow("b", "bob", "B", "", models.TaskStatusPending, "medium", nil, 2048.0, now, now, nil))
+	tasks, err := repo.Reorder(context.Background(), "bob", []string{"a", "c"})
+	if err != nil {
+		t.Fatalf("Reorder: %v", err)
+	}
+	if len(tasks) != 3 || tasks[0].ID != "a" || tasks[1].ID != "c" || tasks[2].ID != "b" {
+		t.Errorf("got %+v, want a, c, b", tasks)
+	}
+
+	// Tasks of other users, and duplicates, are refused without writing
+	for _, ids := range [][]string{{"a", "zed"}, {"b", "b"}} {
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT id, position FROM tasks").WithArgs("bob").WillReturnRows(current())
+		mock.ExpectRollback()
+		if _, err := repo.Reorder(context.Background(), "bob", ids); !errors.Is(err, ErrInvalidTaskOrder) {
+			t.Errorf("Reorder(%v): got %v, want ErrInvalidTaskOrder", ids, err)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
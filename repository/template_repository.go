@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"go-realtime-workspace/models"
+
+	"github.com/lib/pq"
+)
+
+// Errors returned by TemplateRepository.
+var (
+	ErrTemplateNotFound = errors.New("template not found")
+	ErrTemplateExists   = errors.New("template key already exists")
+)
+
+// templateKeyConstraint is the unique constraint guarding template keys
+// within an organization.
+const templateKeyConstraint = "message_templates_org_id_key_key"
+
+// TemplateRepository stores the canned message templates of organizations
+// in PostgreSQL.
+type TemplateRepository struct {
+	db *sql.DB
+}
+
+// NewTemplateRepository creates a new template repository.
+func NewTemplateRepository(db *sql.DB) *TemplateRepository {
+	return &TemplateRepository{db: db}
+}
+
+// templateColumns lists the columns scanned by scanTemplate.
+const templateColumns = `id, org_id, key, title, body, variables, COALESCE(created_by::text, ''), created_at, updated_at`
+
+// scanTemplate scans a row selected with templateColumns.
+func scanTemplate(row interface{ Scan(...interface{}) error }) (*models.MessageTemplate, error) {
+	t := &models.MessageTemplate{}
+	var variables []byte
+	if err := row.Scan(&t.ID, &t.OrgID, &t.Key, &t.Title, &t.Body, &variables, &t.CreatedBy, &t.CreatedAt, &t.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(variables, &t.Variables); err != nil {
+		return nil, fmt.Errorf("error decoding template variables: %w", err)
+	}
+	return t, nil
+}
+
+// encodeVariables marshals template variables for the variables column.
+func encodeVariables(variables []models.TemplateVariable) ([]byte, error) {
+	if variables == nil {
+		variables = []models.TemplateVariable{}
+	}
+	data, err := json.Marshal(variables)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding template variables: %w", err)
+	}
+	return data, nil
+}
+
+// Create stores a new template created by actorID, or by no user if actorID
+// is empty. Callers check that the actor may manage templates. It returns
+// ErrTemplateExists if the key is taken.
+func (r *TemplateRepository) Create(ctx context.Context, orgID, actorID string, req models.SaveTemplateRequest) (*models.MessageTemplate, error) {
+	var createdBy interface{}
+	if actorID != "" {
+		createdBy = actorID
+	}
+	variables, err := encodeVariables(req.Variables)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := scanTemplate(r.db.QueryRowContext(ctx, `
+		INSERT INTO message_templates (org_id, key, title, body, variables, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING `+templateColumns,
+		orgID, req.Key, req.Title, req.Body, variables, createdBy))
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == templateKeyConstraint {
+			return nil, ErrTemplateExists
+		}
+		return nil, fmt.Errorf("error creating template: %w", err)
+	}
+	return t, nil
+}
+
+// Get returns the template of an organization with the given key, or
+// ErrTemplateNotFound.
+func (r *TemplateRepository) Get(ctx context.Context, orgID, key string) (*models.MessageTemplate, error) {
+	t, err := scanTemplate(r.db.QueryRowContext(ctx, `
+		SELECT `+templateColumns+` FROM message_templates WHERE org_id = $1 AND key = $2
+	`, orgID, key))
+	if err == sql.ErrNoRows {
+		return nil, ErrTemplateNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting template: %w", err)
+	}
+	return t, nil
+}
+
+// List returns an organization's templates ordered by key.
+func (r *TemplateRepository) List(ctx context.Context, orgID string) ([]models.MessageTemplate, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+templateColumns+` FROM message_templates WHERE org_id = $1 ORDER BY key
+	`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing templates: %w", err)
+	}
+	defer rows.Close()
+
+	templates := []models.MessageTemplate{}
+	for rows.Next() {
+		t, err := scanTemplate(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning template: %w", err)
+		}
+		templates = append(templates, *t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error listing templates: %w", err)
+	}
+	return templates, nil
+}
+
+// Update replaces the title, body and variables of a template.
+func (r *TemplateRepository) Update(ctx context.Context, orgID string, req models.SaveTemplateRequest) (*models.MessageTemplate, error) {
+	variables, err := encodeVariables(req.Variables)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := scanTemplate(r.db.QueryRowContext(ctx, `
+		UPDATE message_templates
+		SET title = $3, body = $4, variables = $5, updated_at = CURRENT_TIMESTAMP
+		WHERE org_id = $1 AND key = $2
+		RETURNING `+templateColumns,
+		orgID, req.Key, req.Title, req.Body, variables))
+	if err == sql.ErrNoRows {
+		return nil, ErrTemplateNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error updating template: %w", err)
+	}
+	return t, nil
+}
+
+// Delete removes a template.
+func (r *TemplateRepository) Delete(ctx context.Context, orgID, key string) error {
+	result, err := r.db.ExecContext(ctx, `
+		DELETE FROM message_templates WHERE org_id = $1 AND key = $2
+	`, orgID, key)
+	if err != nil {
+		return fmt.Errorf("error deleting template: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrTemplateNotFound
+	}
+	return nil
+}
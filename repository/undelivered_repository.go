@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"go-realtime-workspace/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// StashUndelivered keeps the IDs of group messages that could not be
+// written to a user, in the order given, for TakeUndelivered to return when
+// the user rejoins the group. A message stashed twice keeps its first
+// place. Only the newest MaxUndelivered are kept per user and group, for as
+// long as the group's history; with MaxUndelivered 0 nothing is stashed.
+func (r *MessageRepository) StashUndelivered(ctx context.Context, orgID, groupID, userID string, messageIDs []string) error {
+	max := r.cfg.MaxUndelivered
+	if max <= 0 || len(messageIDs) == 0 {
+		return nil
+	}
+
+	// Scores follow the stash time, kept apart so the given order holds
+	base := score(r.clock.Now())
+	members := make([]redis.Z, len(messageIDs))
+	for i, id := range messageIDs {
+		members[i] = redis.Z{Score: base + float64(i), Member: id}
+	}
+
+	key := undeliveredKey(userID, orgID, groupID)
+	pipe := r.client.TxPipeline()
+	pipe.ZAddNX(ctx, key, members...)
+	pipe.ZRemRangeByRank(ctx, key, 0, int64(-max-1))
+	pipe.Expire(ctx, key, r.cfg.MessageTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("error stashing undelivered messages: %w", err)
+	}
+	return nil
+}
+
+// TakeUndelivered removes and returns the messages stashed for a user in a
+// group, in the order they were stashed. Messages deleted or trimmed since
+// are left out.
+func (r *MessageRepository) TakeUndelivered(ctx context.Context, orgID, groupID, userID string) ([]models.ChatMessage, error) {
+	key := undeliveredKey(userID, orgID, groupID)
+	pipe := r.client.TxPipeline()
+	ids := pipe.ZRange(ctx, key, 0, -1)
+	pipe.Del(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("error getting undelivered messages: %w", err)
+	}
+	if len(ids.Val()) == 0 {
+		return []models.ChatMessage{}, nil
+	}
+
+	messages, _, err := r.GetByIDs(ctx, orgID, groupID, ids.Val())
+	if err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// undeliveredKey returns the sorted set of a user's undelivered message IDs
+// in a group.
+func undeliveredKey(userID, orgID, groupID string) string {
+	return fmt.Sprintf("undelivered:%s:%s:%s", userID, orgID, groupID)
+}
@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"go-realtime-workspace/clock"
+	"go-realtime-workspace/config"
+	"go-realtime-workspace/models"
+)
+
+func TestUndeliveredStashIsBounded(t *testing.T) {
+	repo, _ := newTestMessageRepository(t, func(cfg *config.RedisConfig) {
+		cfg.MaxUndelivered = 3
+	})
+	ctx := context.Background()
+	fake := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	repo.SetClock(fake)
+	for _, id := range []string{"m1", "m2", "m3", "m4", "m5"} {
+		if _, err := repo.Save(ctx, models.ChatMessage{ID: id, OrgID: "acme", GroupID: "general", ClientID: "alice", Content: id}); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+
+	for _, ids := range [][]string{{"m1", "m2"}, {"m3", "m1", "m4", "m5"}} {
+		if err := repo.StashUndelivered(ctx, "acme", "general", "bob", ids); err != nil {
+			t.Fatalf("StashUndelivered: %v", err)
+		}
+		fake.Advance(time.Second)
+	}
+
+	// m1 keeps its first place and so is the first trimmed
+	messages, err := repo.TakeUndelivered(ctx, "acme", "general", "bob")
+	if err != nil {
+		t.Fatalf("TakeUndelivered: %v", err)
+	}
+	if got, want := messageIDs(messages), []string{"m3", "m4", "m5"}; !slices.Equal(got, want) {
+		t.Errorf("took %v, want %v", got, want)
+	}
+	if messages, err := repo.TakeUndelivered(ctx, "acme", "general", "bob"); err != nil || len(messages) != 0 {
+		t.Errorf("second take: %v, %v; want nothing", messageIDs(messages), err)
+	}
+}
@@ -4,35 +4,81 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"go-realtime-workspace/config"
+	"go-realtime-workspace/cursor"
 	"go-realtime-workspace/models"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Errors returned when a role change is not allowed.
+var (
+	ErrUserNotInOrg     = errors.New("user not found in organization")
+	ErrInsufficientRole = errors.New("insufficient role for this change")
+	ErrLastOwner        = errors.New("organization must keep at least one owner")
 )
 
+// ErrInvalidUser is returned when user fields are rejected before reaching the database.
+var ErrInvalidUser = errors.New("invalid user")
+
+// ErrUserTaken is returned by Update when the new username or email
+// belongs to another user.
+var ErrUserTaken = errors.New("username or email is already taken")
+
+// maxUsernameAttempts bounds how many suffixed usernames are tried on collision.
+const maxUsernameAttempts = 50
+
+// usernameConstraint is the unique constraint guarding users.username.
+const usernameConstraint = "users_username_key"
+
 // UserRepository handles user database operations.
 type UserRepository struct {
-	db *sql.DB
+	db     *sql.DB
+	limits config.UserConfig
 }
 
 // NewUserRepository creates a new user repository.
-func NewUserRepository(db *sql.DB) *UserRepository {
-	return &UserRepository{db: db}
+func NewUserRepository(db *sql.DB, limits config.UserConfig) *UserRepository {
+	return &UserRepository{db: db, limits: limits}
 }
 
-// Create creates a new user.
+// Create creates a new user. Fields are normalized first (see
+// normalizeUserFields and normalizeProfileFields); a missing or over-long
+// field, or a malformed avatar URL, returns an error wrapping
+// ErrInvalidUser.
 func (r *UserRepository) Create(ctx context.Context, req models.CreateUserRequest) (*models.User, error) {
+	if err := normalizeUserFields(r.limits, &req.Username, &req.Email, &req.FullName); err != nil {
+		return nil, err
+	}
+	if err := normalizeProfileFields(r.limits, &req.AvatarURL, &req.Bio); err != nil {
+		return nil, err
+	}
+	if req.Username == "" || req.Email == "" {
+		return nil, fmt.Errorf("%w: username and email are required", ErrInvalidUser)
+	}
+
 	query := `
-		INSERT INTO users (username, email, full_name, org_id)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id, username, email, full_name, org_id, created_at, updated_at
+		INSERT INTO users (username, email, full_name, avatar_url, bio, org_id)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, username, email, full_name, avatar_url, bio, org_id, role, created_at, updated_at
 	`
 
 	user := &models.User{}
 	err := r.db.QueryRowContext(
 		ctx, query,
-		req.Username, req.Email, req.FullName, req.OrgID,
+		req.Username, req.Email, req.FullName, req.AvatarURL, req.Bio, req.OrgID,
 	).Scan(
-		&user.ID, &user.Username, &user.Email, &user.FullName,
-		&user.OrgID, &user.CreatedAt, &user.UpdatedAt,
+		&user.ID, &user.Username, &user.Email, &user.FullName, &user.AvatarURL, &user.Bio,
+		&user.OrgID, &user.Role, &user.CreatedAt, &user.UpdatedAt,
 	)
 
 	if err != nil {
@@ -42,17 +88,117 @@ func (r *UserRepository) Create(ctx context.Context, req models.CreateUserReques
 	return user, nil
 }
 
+// CreateWithGeneratedUsername creates a user whose username is derived from
+// the email local-part. When the name is taken, a numeric suffix is appended
+// and the insert retried, so concurrent sign-ups with the same email prefix
+// each end up with a distinct username.
+func (r *UserRepository) CreateWithGeneratedUsername(ctx context.Context, req models.CreateUserRequest) (*models.User, error) {
+	base := usernameBase(req.Email)
+
+	for attempt := 0; attempt < maxUsernameAttempts; attempt++ {
+		req.Username = base
+		if attempt > 0 {
+			req.Username = base + strconv.Itoa(attempt+1)
+		}
+		if !models.ValidUsername(req.Username) {
+			return nil, fmt.Errorf("cannot generate a valid username from email %q", req.Email)
+		}
+
+		user, err := r.Create(ctx, req)
+		if err == nil {
+			return user, nil
+		}
+
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == usernameConstraint {
+			continue // Taken, try the next suffix
+		}
+		return nil, err
+	}
+
+	return nil, fmt.Errorf("could not find a free username for %q", base)
+}
+
+// normalizeUserFields trims the user fields in place and lowercases the
+// email, so addresses differing only in case belong to the same user. It
+// returns an error wrapping ErrInvalidUser if a field is longer than its
+// limit, which would otherwise fail as a database constraint error.
+func normalizeUserFields(limits config.UserConfig, username, email, fullName *string) error {
+	*username = strings.TrimSpace(*username)
+	*email = strings.ToLower(strings.TrimSpace(*email))
+	*fullName = strings.TrimSpace(*fullName)
+
+	for _, field := range []struct {
+		name  string
+		value string
+		max   int
+	}{
+		{"username", *username, limits.MaxUsernameLength},
+		{"email", *email, limits.MaxEmailLength},
+		{"full_name", *fullName, limits.MaxFullNameLength},
+	} {
+		if utf8.RuneCountInString(field.value) > field.max {
+			return fmt.Errorf("%w: %s must be at most %d characters", ErrInvalidUser, field.name, field.max)
+		}
+	}
+	return nil
+}
+
+// normalizeProfileFields trims the profile fields in place. It returns an
+// error wrapping ErrInvalidUser if a field is longer than its limit or the
+// avatar URL is set but is not an absolute http or https URL.
+func normalizeProfileFields(limits config.UserConfig, avatarURL, bio *string) error {
+	*avatarURL = strings.TrimSpace(*avatarURL)
+	*bio = strings.TrimSpace(*bio)
+
+	if utf8.RuneCountInString(*avatarURL) > limits.MaxAvatarURLLength {
+		return fmt.Errorf("%w: avatar_url must be at most %d characters", ErrInvalidUser, limits.MaxAvatarURLLength)
+	}
+	if utf8.RuneCountInString(*bio) > limits.MaxBioLength {
+		return fmt.Errorf("%w: bio must be at most %d characters", ErrInvalidUser, limits.MaxBioLength)
+	}
+	if *avatarURL != "" {
+		u, err := url.Parse(*avatarURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%w: avatar_url must be an http or https URL", ErrInvalidUser)
+		}
+	}
+	return nil
+}
+
+// usernameBase derives a username from the local-part of an email address,
+// keeping only characters allowed in usernames.
+func usernameBase(email string) string {
+	local, _, _ := strings.Cut(strings.ToLower(email), "@")
+
+	var b strings.Builder
+	for _, c := range local {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '.' || c == '_' || c == '-' {
+			b.WriteRune(c)
+		}
+	}
+
+	name := b.String()
+	if len(name) > 90 {
+		name = name[:90] // Leave room for a suffix
+	}
+	for len(name) < 3 {
+		name += "_"
+	}
+	return name
+}
+
 // GetByID retrieves a user by ID.
 func (r *UserRepository) GetByID(ctx context.Context, id string) (*models.User, error) {
 	query := `
-		SELECT id, username, email, full_name, org_id, created_at, updated_at
+		SELECT id, username, email, full_name, avatar_url, bio, org_id, role, created_at, updated_at
 		FROM users WHERE id = $1
 	`
 
 	user := &models.User{}
 	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&user.ID, &user.Username, &user.Email, &user.FullName,
-		&user.OrgID, &user.CreatedAt, &user.UpdatedAt,
+		&user.ID, &user.Username, &user.Email, &user.FullName, &user.AvatarURL, &user.Bio,
+		&user.OrgID, &user.Role, &user.CreatedAt, &user.UpdatedAt,
 	)
 
 	if err == sql.ErrNoRows {
@@ -68,14 +214,14 @@ func (r *UserRepository) GetByID(ctx context.Context, id string) (*models.User,
 // GetByUsername retrieves a user by username.
 func (r *UserRepository) GetByUsername(ctx context.Context, username string) (*models.User, error) {
 	query := `
-		SELECT id, username, email, full_name, org_id, created_at, updated_at
+		SELECT id, username, email, full_name, avatar_url, bio, org_id, role, created_at, updated_at
 		FROM users WHERE username = $1
 	`
 
 	user := &models.User{}
 	err := r.db.QueryRowContext(ctx, query, username).Scan(
-		&user.ID, &user.Username, &user.Email, &user.FullName,
-		&user.OrgID, &user.CreatedAt, &user.UpdatedAt,
+		&user.ID, &user.Username, &user.Email, &user.FullName, &user.AvatarURL, &user.Bio,
+		&user.OrgID, &user.Role, &user.CreatedAt, &user.UpdatedAt,
 	)
 
 	if err == sql.ErrNoRows {
@@ -91,7 +237,7 @@ func (r *UserRepository) GetByUsername(ctx context.Context, username string) (*m
 // GetByOrgID retrieves all users in an organization.
 func (r *UserRepository) GetByOrgID(ctx context.Context, orgID string) ([]models.User, error) {
 	query := `
-		SELECT id, username, email, full_name, org_id, created_at, updated_at
+		SELECT id, username, email, full_name, avatar_url, bio, org_id, role, created_at, updated_at
 		FROM users WHERE org_id = $1
 		ORDER BY created_at DESC
 	`
@@ -106,8 +252,8 @@ func (r *UserRepository) GetByOrgID(ctx context.Context, orgID string) ([]models
 	for rows.Next() {
 		var user models.User
 		err := rows.Scan(
-			&user.ID, &user.Username, &user.Email, &user.FullName,
-			&user.OrgID, &user.CreatedAt, &user.UpdatedAt,
+			&user.ID, &user.Username, &user.Email, &user.FullName, &user.AvatarURL, &user.Bio,
+			&user.OrgID, &user.Role, &user.CreatedAt, &user.UpdatedAt,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning user: %w", err)
@@ -118,30 +264,305 @@ func (r *UserRepository) GetByOrgID(ctx context.Context, orgID string) ([]models
 	return users, nil
 }
 
-// Update updates a user.
-func (r *UserRepository) Update(ctx context.Context, id string, req models.UpdateUserRequest) (*models.User, error) {
+// GetPageByOrgID retrieves up to limit users of an organization, newest
+// first, starting after the given position (nil for the first page). Ties
+// in created_at are broken by ID, so pages neither skip nor repeat users
+// however many join in between.
+func (r *UserRepository) GetPageByOrgID(ctx context.Context, orgID string, after *cursor.Position, limit int) ([]models.User, error) {
+	conditions := "org_id = $1"
+	args := []interface{}{orgID, limit}
+	if after != nil {
+		conditions += " AND (created_at, id) < ($3, $4)"
+		args = append(args, after.Time, after.ID)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT id, username, email, full_name, avatar_url, bio, org_id, role, created_at, updated_at
+		FROM users WHERE %s
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2
+	`, conditions)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error getting users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		var user models.User
+		err := rows.Scan(
+			&user.ID, &user.Username, &user.Email, &user.FullName, &user.AvatarURL, &user.Bio,
+			&user.OrgID, &user.Role, &user.CreatedAt, &user.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning user: %w", err)
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error getting users: %w", err)
+	}
+
+	return users, nil
+}
+
+// GetRoster retrieves one page of an organization's users for a group
+// roster: the users in onlineIDs first, then the rest, each part ordered
+// by username.
+func (r *UserRepository) GetRoster(ctx context.Context, orgID string, onlineIDs []string, limit, offset int) ([]models.User, error) {
 	query := `
-		UPDATE users
-		SET username = COALESCE(NULLIF($1, ''), username),
-		    email = COALESCE(NULLIF($2, ''), email),
-		    full_name = COALESCE(NULLIF($3, ''), full_name),
-		    updated_at = CURRENT_TIMESTAMP
-		WHERE id = $4
-		RETURNING id, username, email, full_name, org_id, created_at, updated_at
+		SELECT id, username, email, full_name, avatar_url, bio, org_id, role, created_at, updated_at
+		FROM users WHERE org_id = $1
+		ORDER BY id = ANY($2) DESC, username ASC, id ASC
+		LIMIT $3 OFFSET $4
 	`
 
+	rows, err := r.db.QueryContext(ctx, query, orgID, pq.Array(onlineIDs), limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("error getting roster: %w", err)
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		var user models.User
+		err := rows.Scan(
+			&user.ID, &user.Username, &user.Email, &user.FullName, &user.AvatarURL, &user.Bio,
+			&user.OrgID, &user.Role, &user.CreatedAt, &user.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning user: %w", err)
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error getting roster: %w", err)
+	}
+
+	return users, nil
+}
+
+// likeEscaper escapes the LIKE wildcards in user input.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SearchInOrg returns up to limit users of an organization whose username,
+// full name or email starts with query, ignoring case. An exact username
+// match comes first, then other username matches, then name and email
+// matches, each ordered by username. The prefix matches are served by the
+// idx_users_org_*_prefix indexes in schema.sql.
+func (r *UserRepository) SearchInOrg(ctx context.Context, orgID, query string, limit int) ([]models.User, error) {
+	lowered := strings.ToLower(strings.TrimSpace(query))
+	if lowered == "" {
+		return []models.User{}, nil
+	}
+	pattern := likeEscaper.Replace(lowered) + "%"
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, username, email, full_name, avatar_url, bio, org_id, role, created_at, updated_at
+		FROM users
+		WHERE org_id = $1 AND (
+			LOWER(username) LIKE $2
+			OR LOWER(full_name) LIKE $2
+			OR LOWER(email) LIKE $2
+		)
+		ORDER BY LOWER(username) = $3 DESC, LOWER(username) LIKE $2 DESC, username ASC, id ASC
+		LIMIT $4
+	`, orgID, pattern, lowered, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error searching users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		var user models.User
+		err := rows.Scan(
+			&user.ID, &user.Username, &user.Email, &user.FullName, &user.AvatarURL, &user.Bio,
+			&user.OrgID, &user.Role, &user.CreatedAt, &user.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning user: %w", err)
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error searching users: %w", err)
+	}
+
+	return users, nil
+}
+
+// Roles returns the roles of the given users in an organization, keyed by
+// user ID. Users not in the organization are left out.
+func (r *UserRepository) Roles(ctx context.Context, orgID string, userIDs []string) (map[string]string, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, role FROM users
+		WHERE org_id = $1 AND id = ANY($2)
+	`, orgID, pq.Array(userIDs))
+	if err != nil {
+		return nil, fmt.Errorf("error getting roles: %w", err)
+	}
+	defer rows.Close()
+
+	roles := make(map[string]string, len(userIDs))
+	for rows.Next() {
+		var id, role string
+		if err := rows.Scan(&id, &role); err != nil {
+			return nil, fmt.Errorf("error scanning role: %w", err)
+		}
+		roles[id] = role
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error getting roles: %w", err)
+	}
+	return roles, nil
+}
+
+// Profiles returns the usernames and avatars of the given users, keyed by
+// user ID. Users that do not exist are left out, as are IDs that are not
+// UUIDs and so cannot name a user.
+func (r *UserRepository) Profiles(ctx context.Context, userIDs []string) (map[string]models.UserProfile, error) {
+	ids := make([]string, 0, len(userIDs))
+	for _, id := range userIDs {
+		if uuid.Validate(id) == nil {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return map[string]models.UserProfile{}, nil
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, username, avatar_url FROM users
+		WHERE id = ANY($1)
+	`, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("error getting user profiles: %w", err)
+	}
+	defer rows.Close()
+
+	profiles := make(map[string]models.UserProfile, len(userIDs))
+	for rows.Next() {
+		var id string
+		var profile models.UserProfile
+		if err := rows.Scan(&id, &profile.Username, &profile.AvatarURL); err != nil {
+			return nil, fmt.Errorf("error scanning user profile: %w", err)
+		}
+		profiles[id] = profile
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error getting user profiles: %w", err)
+	}
+	return profiles, nil
+}
+
+// ResolveMentions returns the IDs of the users of an organization that
+// handles (lowercased user IDs or usernames, as extracted from @mentions)
+// refer to. Handles matching no one are left out.
+func (r *UserRepository) ResolveMentions(ctx context.Context, orgID string, handles []string) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id FROM users
+		WHERE org_id = $1 AND (id::text = ANY($2) OR LOWER(username) = ANY($2))
+	`, orgID, pq.Array(handles))
+	if err != nil {
+		return nil, fmt.Errorf("error resolving mentions: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("error scanning mentioned user: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error resolving mentions: %w", err)
+	}
+	return ids, nil
+}
+
+// Update changes the fields of a user that are set in req, leaving the
+// others as they are. Fields are normalized like in Create; an over-long
+// field, a malformed avatar URL, or an empty username or email, returns
+// an error wrapping ErrInvalidUser, and a username or email belonging to
+// another user returns ErrUserTaken.
+func (r *UserRepository) Update(ctx context.Context, id string, req models.UpdateUserRequest) (*models.User, error) {
+	var username, email, fullName, avatarURL, bio string
+	if req.Username != nil {
+		username = *req.Username
+	}
+	if req.Email != nil {
+		email = *req.Email
+	}
+	if req.FullName != nil {
+		fullName = *req.FullName
+	}
+	if req.AvatarURL != nil {
+		avatarURL = *req.AvatarURL
+	}
+	if req.Bio != nil {
+		bio = *req.Bio
+	}
+	if err := normalizeUserFields(r.limits, &username, &email, &fullName); err != nil {
+		return nil, err
+	}
+	if err := normalizeProfileFields(r.limits, &avatarURL, &bio); err != nil {
+		return nil, err
+	}
+	if (req.Username != nil && username == "") || (req.Email != nil && email == "") {
+		return nil, fmt.Errorf("%w: username and email cannot be empty", ErrInvalidUser)
+	}
+
+	sets := []string{}
+	args := []interface{}{}
+
+	addSet := func(column string, value interface{}) {
+		args = append(args, value)
+		sets = append(sets, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+
+	if req.Username != nil {
+		addSet("username", username)
+	}
+	if req.Email != nil {
+		addSet("email", email)
+	}
+	if req.FullName != nil {
+		addSet("full_name", fullName)
+	}
+	if req.AvatarURL != nil {
+		addSet("avatar_url", avatarURL)
+	}
+	if req.Bio != nil {
+		addSet("bio", bio)
+	}
+	sets = append(sets, "updated_at = CURRENT_TIMESTAMP")
+	args = append(args, id)
+
+	query := fmt.Sprintf(`
+		UPDATE users
+		SET %s
+		WHERE id = $%d
+		RETURNING id, username, email, full_name, avatar_url, bio, org_id, role, created_at, updated_at
+	`, strings.Join(sets, ", "), len(args))
+
 	user := &models.User{}
-	err := r.db.QueryRowContext(
-		ctx, query,
-		req.Username, req.Email, req.FullName, id,
-	).Scan(
-		&user.ID, &user.Username, &user.Email, &user.FullName,
-		&user.OrgID, &user.CreatedAt, &user.UpdatedAt,
+	err := r.db.QueryRowContext(ctx, query, args...).Scan(
+		&user.ID, &user.Username, &user.Email, &user.FullName, &user.AvatarURL, &user.Bio,
+		&user.OrgID, &user.Role, &user.CreatedAt, &user.UpdatedAt,
 	)
 
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("user not found")
 	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return nil, ErrUserTaken
+	}
 	if err != nil {
 		return nil, fmt.Errorf("error updating user: %w", err)
 	}
@@ -149,6 +570,191 @@ func (r *UserRepository) Update(ctx context.Context, id string, req models.Updat
 	return user, nil
 }
 
+// SetRole changes the role of a user within an organization on behalf of
+// audit.ActorID, who must be an owner or admin of the same organization; an
+// empty ActorID stands for the admin token and may make any change. Only
+// owners may grant or revoke the owner role, and the last owner cannot be
+// demoted. The organization's owners are locked for the duration of the
+// transaction so concurrent demotions cannot leave it without one. The
+// change is recorded in the audit log.
+func (r *UserRepository) SetRole(ctx context.Context, orgID, userID, role string, audit models.AuditEntry) (*models.User, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	actorID := audit.ActorID
+	if actorID == "" {
+		actorID = userID // Not a valid UUID otherwise
+	}
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, role FROM users
+		WHERE org_id = $1 AND (id = $2 OR id = $3 OR role = 'owner')
+		FOR UPDATE
+	`, orgID, actorID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting roles: %w", err)
+	}
+	roles := make(map[string]string)
+	owners := 0
+	for rows.Next() {
+		var id, current string
+		if err := rows.Scan(&id, &current); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error scanning role: %w", err)
+		}
+		roles[id] = current
+		if current == models.RoleOwner {
+			owners++
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error getting roles: %w", err)
+	}
+
+	actorRole := roles[audit.ActorID]
+	if audit.ActorID == "" {
+		actorRole = models.RoleOwner
+	}
+	if actorRole != models.RoleOwner && actorRole != models.RoleAdmin {
+		return nil, ErrInsufficientRole
+	}
+	previous, exists := roles[userID]
+	if !exists {
+		return nil, ErrUserNotInOrg
+	}
+	if (previous == models.RoleOwner || role == models.RoleOwner) && actorRole != models.RoleOwner {
+		return nil, ErrInsufficientRole
+	}
+	if previous == models.RoleOwner && role != models.RoleOwner && owners <= 1 {
+		return nil, ErrLastOwner
+	}
+
+	user := &models.User{}
+	err = tx.QueryRowContext(ctx, `
+		UPDATE users SET role = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2
+		RETURNING id, username, email, full_name, avatar_url, bio, org_id, role, created_at, updated_at
+	`, role, userID).Scan(
+		&user.ID, &user.Username, &user.Email, &user.FullName, &user.AvatarURL, &user.Bio,
+		&user.OrgID, &user.Role, &user.CreatedAt, &user.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error updating role: %w", err)
+	}
+
+	if previous != role {
+		audit.OrgID = orgID
+		audit.Action = models.AuditRoleChanged
+		audit.TargetID = userID
+		audit.Metadata, _ = json.Marshal(map[string]string{"from": previous, "to": role})
+		if err := insertAuditEntry(ctx, tx, audit); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing role change: %w", err)
+	}
+
+	return user, nil
+}
+
+// ImportRoles sets the roles of an organization's users from roles, keyed
+// by username, as part of an org config import. Unlike SetRole it needs no
+// acting user, since imports are admin-only. Users not in the organization
+// are skipped and reported; users not in roles keep their role. It fails
+// with ErrLastOwner if the organization would be left without an owner.
+// Each change is recorded in the audit log with audit's request details.
+func (r *UserRepository) ImportRoles(ctx context.Context, orgID string, roles map[string]string, audit models.AuditEntry) ([]models.ConfigChange, []string, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, username, role FROM users
+		WHERE org_id = $1
+		ORDER BY username
+		FOR UPDATE
+	`, orgID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error getting roles: %w", err)
+	}
+	type member struct{ id, role string }
+	members := make(map[string]member)
+	var usernames []string
+	owners := 0
+	for rows.Next() {
+		var id, username, role string
+		if err := rows.Scan(&id, &username, &role); err != nil {
+			rows.Close()
+			return nil, nil, fmt.Errorf("error scanning role: %w", err)
+		}
+		members[username] = member{id: id, role: role}
+		usernames = append(usernames, username)
+		if role == models.RoleOwner {
+			owners++
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("error getting roles: %w", err)
+	}
+
+	hadOwner := owners > 0
+	changes := []models.ConfigChange{}
+	for _, username := range usernames {
+		m := members[username]
+		role, ok := roles[username]
+		if !ok || role == m.role {
+			continue
+		}
+		if m.role == models.RoleOwner {
+			owners--
+		}
+		if role == models.RoleOwner {
+			owners++
+		}
+
+		_, err := tx.ExecContext(ctx, `
+			UPDATE users SET role = $1, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $2
+		`, role, m.id)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error updating role: %w", err)
+		}
+
+		audit.OrgID = orgID
+		audit.Action = models.AuditRoleChanged
+		audit.TargetID = m.id
+		audit.Metadata, _ = json.Marshal(map[string]string{"from": m.role, "to": role})
+		if err := insertAuditEntry(ctx, tx, audit); err != nil {
+			return nil, nil, err
+		}
+		changes = append(changes, models.ConfigChange{Setting: "roles." + username, From: m.role, To: role})
+	}
+	if hadOwner && owners == 0 {
+		return nil, nil, ErrLastOwner
+	}
+
+	var skipped []string
+	for username := range roles {
+		if _, ok := members[username]; !ok {
+			skipped = append(skipped, username)
+		}
+	}
+	sort.Strings(skipped)
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, fmt.Errorf("error committing role import: %w", err)
+	}
+	return changes, skipped, nil
+}
+
 // Delete deletes a user.
 func (r *UserRepository) Delete(ctx context.Context, id string) error {
 	query := `DELETE FROM users WHERE id = $1`
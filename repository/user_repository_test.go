@@ -0,0 +1,446 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"go-realtime-workspace/config"
+	"go-realtime-workspace/cursor"
+	"go-realtime-workspace/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+)
+
+// userColumns are the columns user queries return.
+var userColumns = []string{"id", "username", "email", "full_name", "avatar_url", "bio", "org_id", "role", "created_at", "updated_at"}
+
+// newMockUserRepository returns a user repository backed by a SQL mock.
+func newMockUserRepository(t *testing.T) (*UserRepository, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return NewUserRepository(db, config.DefaultConfig().User), mock
+}
+
+// expectRoles expects SetRole's locking query and answers it with roles,
+// keyed by user ID.
+func expectRoles(mock sqlmock.Sqlmock, roles map[string]string) {
+	mock.ExpectBegin()
+	rows := sqlmock.NewRows([]string{"id", "role"})
+	for id, role := range roles {
+		rows.AddRow(id, role)
+	}
+	mock.ExpectQuery("SELECT id, role FROM users").WillReturnRows(rows)
+}
+
+// expectRoleUpdate expects SetRole's update, audit entry and commit.
+func expectRoleUpdate(mock sqlmock.Sqlmock, userID, role string) {
+	now := time.Now()
+	mock.ExpectQuery("UPDATE users SET role").
+		WithArgs(role, userID).
+		WillReturnRows(sqlmock.NewRows(userColumns).AddRow(userID, "bob", "bob@example.com", "", "", "", "acme", role, now, now))
+	mock.ExpectExec("INSERT INTO audit_log").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+}
+
+func TestSetRole(t *testing.T) {
+	tests := []struct {
+		name    string
+		actorID string
+		roles   map[string]string
+		role    string
+		wantErr error
+	}{
+		{
+			name:    "admin promotes member",
+			actorID: "admin",
+			roles:   map[string]string{"admin": models.RoleAdmin, "bob": models.RoleMember, "owner": models.RoleOwner},
+			role:    models.RoleManager,
+		},
+		{
+			name:    "owner demotes one of two owners",
+			actorID: "owner",
+			roles:   map[string]string{"owner": models.RoleOwner, "bob": models.RoleOwner},
+			role:    models.RoleMember,
+		},
+		{
+			name:    "admin token promotes to owner",
+			actorID: "",
+			roles:   map[string]string{"bob": models.RoleAdmin, "owner": models.RoleOwner},
+			role:    models.RoleOwner,
+		},
+		{
+			name:    "last owner cannot be demoted",
+			actorID: "bob",
+			roles:   map[string]string{"bob": models.RoleOwner},
+			role:    models.RoleAdmin,
+			wantErr: ErrLastOwner,
+		},
+		{
+			name:    "member cannot change roles",
+			actorID: "member",
+			roles:   map[string]string{"member": models.RoleMember, "bob": models.RoleMember, "owner": models.RoleOwner},
+			role:    models.RoleAdmin,
+			wantErr: ErrInsufficientRole,
+		},
+		{
+			name:    "admin cannot demote an owner",
+			actorID: "admin",
+			roles:   map[string]string{"admin": models.RoleAdmin, "bob": models.RoleOwner, "owner": models.RoleOwner},
+			role:    models.RoleMember,
+			wantErr: ErrInsufficientRole,
+		},
+		{
+			name:    "admin cannot grant owner",
+			actorID: "admin",
+			roles:   map[string]string{"admin": models.RoleAdmin, "bob": models.RoleMember, "owner": models.RoleOwner},
+			role:    models.RoleOwner,
+			wantErr: ErrInsufficientRole,
+		},
+		{
+			name:    "actor from another org",
+			actorID: "outsider",
+			roles:   map[string]string{"bob": models.RoleMember, "owner": models.RoleOwner},
+			role:    models.RoleAdmin,
+			wantErr: ErrInsufficientRole,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, mock := newMockUserRepository(t)
+			expectRoles(mock, tt.roles)
+			if tt.wantErr == nil {
+				expectRoleUpdate(mock, "bob", tt.role)
+			} else {
+				mock.ExpectRollback()
+			}
+
+			user, err := repo.SetRole(context.Background(), "acme", "bob", tt.role, models.AuditEntry{ActorID: tt.actorID})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && user.Role != tt.role {
+				t.Errorf("role %q, want %q", user.Role, tt.role)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// expectInsertUser expects Create's insert of username and answers it with
+// err, or with a new user if err is nil.
+func expectInsertUser(mock sqlmock.Sqlmock, username, email string, err error) {
+	query := mock.ExpectQuery("INSERT INTO users").WithArgs(username, email, "", "", "", "")
+	if err != nil {
+		query.WillReturnError(err)
+		return
+	}
+	now := time.Now()
+	query.WillReturnRows(sqlmock.NewRows(userColumns).AddRow(username+"-id", username, email, "", "", "", "", models.RoleMember, now, now))
+}
+
+func TestGeneratedUsernamesAreDistinct(t *testing.T) {
+	repo, mock := newMockUserRepository(t)
+	taken := &pq.Error{Code: "23505", Constraint: usernameConstraint}
+	expectInsertUser(mock, "jane.doe", "jane.doe@acme.com", nil)
+	expectInsertUser(mock, "jane.doe", "jane.doe@globex.com", taken)
+	expectInsertUser(mock, "jane.doe2", "jane.doe@globex.com", nil)
+
+	ctx := context.Background()
+	first, err := repo.CreateWithGeneratedUsername(ctx, models.CreateUserRequest{Email: "Jane.Doe@acme.com"})
+	if err != nil {
+		t.Fatalf("first: %v", err)
+	}
+	second, err := repo.CreateWithGeneratedUsername(ctx, models.CreateUserRequest{Email: "jane.doe@globex.com"})
+	if err != nil {
+		t.Fatalf("second: %v", err)
+	}
+	if first.Username != "jane.doe" || second.Username != "jane.doe2" {
+		t.Errorf("got %q and %q, want jane.doe and jane.doe2", first.Username, second.Username)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGeneratedUsernameStopsOnOtherErrors(t *testing.T) {
+	repo, mock := newMockUserRepository(t)
+	emailTaken := &pq.Error{Code: "23505", Constraint: "users_email_key"}
+	expectInsertUser(mock, "jane", "jane@acme.com", emailTaken)
+
+	_, err := repo.CreateWithGeneratedUsername(context.Background(), models.CreateUserRequest{Email: "jane@acme.com"})
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr.Constraint != "users_email_key" {
+		t.Fatalf("got %v, want the email conflict", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUsernameBase(t *testing.T) {
+	for email, want := range map[string]string{
+		"Jane.Doe@acme.com":  "jane.doe",
+		"j+tag@acme.com":     "jtag",
+		"jo@acme.com":        "jo_",
+		"ünï@acme.com":       "n__",
+		"first_last-1@x.org": "first_last-1",
+	} {
+		if got := usernameBase(email); got != want {
+			t.Errorf("usernameBase(%q) = %q, want %q", email, got, want)
+		} else if !models.ValidUsername(got) {
+			t.Errorf("usernameBase(%q) = %q, which is not a valid username", email, got)
+		}
+	}
+}
+
+func TestCreateNormalizesFields(t *testing.T) {
+	repo, mock := newMockUserRepository(t)
+	now := time.Now()
+	mock.ExpectQuery("INSERT INTO users").
+		WithArgs("jane", "jane.doe@example.com", "Jane Doe", "", "", "").
+		WillReturnRows(sqlmock.NewRows(userColumns).AddRow("jane-id", "jane", "jane.doe@example.com", "Jane Doe", "", "", "", models.RoleMember, now, now))
+
+	user, err := repo.Create(context.Background(), models.CreateUserRequest{
+		Username: "  jane ", Email: " Jane.Doe@Example.COM ", FullName: "\tJane Doe\n",
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if user.Email != "jane.doe@example.com" {
+		t.Errorf("email %q, want it lowercased", user.Email)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUpdateNormalizesEmail(t *testing.T) {
+	repo, mock := newMockUserRepository(t)
+	now := time.Now()
+	mock.ExpectQuery("UPDATE users").
+		WithArgs("bob@example.com", "bob-id").
+		WillReturnRows(sqlmock.NewRows(userColumns).AddRow("bob-id", "bob", "bob@example.com", "", "", "", "acme", models.RoleMember, now, now))
+
+	email := "  BOB@example.com "
+	if _, err := repo.Update(context.Background(), "bob-id", models.UpdateUserRequest{Email: &email}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOverLongFieldsNeverReachTheDatabase(t *testing.T) {
+	limits := config.DefaultConfig().User
+	tests := []struct {
+		name string
+		req  models.CreateUserRequest
+	}{
+		{"username", models.CreateUserRequest{Username: strings.Repeat("a", limits.MaxUsernameLength+1), Email: "a@example.com"}},
+		{"email", models.CreateUserRequest{Username: "jane", Email: strings.Repeat("a", limits.MaxEmailLength) + "@x.io"}},
+		{"full name", models.CreateUserRequest{Username: "jane", Email: "a@example.com", FullName: strings.Repeat("é", limits.MaxFullNameLength+1)}},
+		{"empty after trimming", models.CreateUserRequest{Username: "   ", Email: "a@example.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, mock := newMockUserRepository(t)
+			if _, err := repo.Create(context.Background(), tt.req); !errors.Is(err, ErrInvalidUser) {
+				t.Fatalf("got %v, want ErrInvalidUser", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+
+	// Limits count characters, not bytes
+	repo, mock := newMockUserRepository(t)
+	fullName := strings.Repeat("é", limits.MaxFullNameLength)
+	mock.ExpectQuery("INSERT INTO users").WithArgs("jane", "a@example.com", fullName, "", "", "").
+		WillReturnError(errors.New("stop"))
+	_, err := repo.Create(context.Background(), models.CreateUserRequest{Username: "jane", Email: "a@example.com", FullName: fullName})
+	if errors.Is(err, ErrInvalidUser) {
+		t.Errorf("full name of %d multibyte characters rejected: %v", limits.MaxFullNameLength, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUpdateUserPatchSemantics(t *testing.T) {
+	repo, mock := newMockUserRepository(t)
+	now := time.Now()
+	str := func(s string) *string { return &s }
+	row := func() *sqlmock.Rows {
+		return sqlmock.NewRows(userColumns).AddRow("bob-id", "bob", "bob@example.com", "", "", "", "acme", models.RoleMember, now, now)
+	}
+
+	tests := []struct {
+		name string
+		req  models.UpdateUserRequest
+		set  string // Expected SET clause before updated_at
+		args []driver.Value
+	}{
+		{"clear full name", models.UpdateUserRequest{FullName: str("")}, "full_name = $1", []driver.Value{""}},
+		{"omitted fields unchanged", models.UpdateUserRequest{Bio: str("hello")}, "bio = $1", []driver.Value{"hello"}},
+		{"several fields", models.UpdateUserRequest{Username: str("bobby"), AvatarURL: str("")}, "username = $1, avatar_url = $2", []driver.Value{"bobby", ""}},
+		{"nothing set", models.UpdateUserRequest{}, "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := "updated_at = CURRENT_TIMESTAMP"
+			if tt.set != "" {
+				set = tt.set + ", " + set
+			}
+			args := append(tt.args, "bob-id")
+			mock.ExpectQuery(`UPDATE users\s+SET ` + regexp.QuoteMeta(set) + fmt.Sprintf(`\s+WHERE id = \$%d`, len(args))).
+				WithArgs(args...).WillReturnRows(row())
+			if _, err := repo.Update(context.Background(), "bob-id", tt.req); err != nil {
+				t.Fatalf("Update: %v", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+
+	// Username and email can be changed but not cleared
+	for _, req := range []models.UpdateUserRequest{{Username: str(" ")}, {Email: str("")}} {
+		if _, err := repo.Update(context.Background(), "bob-id", req); !errors.Is(err, ErrInvalidUser) {
+			t.Errorf("clearing a required field: got %v, want ErrInvalidUser", err)
+		}
+	}
+
+	// An email already in use is reported as taken
+	mock.ExpectQuery("UPDATE users").WithArgs("alice@example.com", "bob-id").
+		WillReturnError(&pq.Error{Code: "23505"})
+	if _, err := repo.Update(context.Background(), "bob-id", models.UpdateUserRequest{Email: str("alice@example.com")}); !errors.Is(err, ErrUserTaken) {
+		t.Errorf("taken email: got %v, want ErrUserTaken", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestProfileFields(t *testing.T) {
+	repo, mock := newMockUserRepository(t)
+	ctx := context.Background()
+	now := time.Now()
+	const avatar = "https://cdn.example.com/jane.png"
+
+	mock.ExpectQuery("INSERT INTO users").
+		WithArgs("jane", "jane@example.com", "", avatar, "Builds things", "acme").
+		WillReturnRows(sqlmock.NewRows(userColumns).AddRow("jane-id", "jane", "jane@example.com", "", avatar, "Builds things", "acme", models.RoleMember, now, now))
+	user, err := repo.Create(ctx, models.CreateUserRequest{
+		Username: "jane", Email: "jane@example.com", AvatarURL: " " + avatar + " ", Bio: "Builds things\n", OrgID: "acme",
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if user.AvatarURL != avatar || user.Bio != "Builds things" {
+		t.Errorf("created avatar %q and bio %q", user.AvatarURL, user.Bio)
+	}
+
+	mock.ExpectQuery("FROM users WHERE id").WithArgs("jane-id").
+		WillReturnRows(sqlmock.NewRows(userColumns).AddRow("jane-id", "jane", "jane@example.com", "", avatar, "Builds things", "acme", models.RoleMember, now, now))
+	user, err = repo.GetByID(ctx, "jane-id")
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if user.AvatarURL != avatar || user.Bio != "Builds things" {
+		t.Errorf("read avatar %q and bio %q", user.AvatarURL, user.Bio)
+	}
+
+	limits := config.DefaultConfig().User
+	str := func(s string) *string { return &s }
+	for _, tt := range []struct {
+		name string
+		req  models.UpdateUserRequest
+	}{
+		{"relative avatar", models.UpdateUserRequest{AvatarURL: str("/jane.png")}},
+		{"non-http avatar", models.UpdateUserRequest{AvatarURL: str("javascript:alert(1)")}},
+		{"avatar without host", models.UpdateUserRequest{AvatarURL: str("https://")}},
+		{"over-long avatar", models.UpdateUserRequest{AvatarURL: str("https://example.com/" + strings.Repeat("a", limits.MaxAvatarURLLength))}},
+		{"over-long bio", models.UpdateUserRequest{Bio: str(strings.Repeat("é", limits.MaxBioLength+1))}},
+	} {
+		if _, err := repo.Update(ctx, "jane-id", tt.req); !errors.Is(err, ErrInvalidUser) {
+			t.Errorf("%s: got %v, want ErrInvalidUser", tt.name, err)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSearchInOrg(t *testing.T) {
+	repo, mock := newMockUserRepository(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		query   string
+		pattern string
+		lowered string
+	}{
+		{"Ali", "ali%", "ali"},
+		{"  bob ", "bob%", "bob"},
+		{"50%_off", `50\%\_off%`, "50%_off"}, // Wildcards match literally
+	}
+	for _, tt := range tests {
+		// Exact username matches rank first, then other username matches
+		mock.ExpectQuery(`WHERE org_id = \$1 AND \(\s+LOWER\(username\) LIKE \$2\s+OR LOWER\(full_name\) LIKE \$2\s+OR LOWER\(email\) LIKE \$2\s+\)\s+`+
+			regexp.QuoteMeta("ORDER BY LOWER(username) = $3 DESC, LOWER(username) LIKE $2 DESC, username ASC")).
+			WithArgs("acme", tt.pattern, tt.lowered, 10).
+			WillReturnRows(sqlmock.NewRows(userColumns).
+				AddRow("u1", "ali", "ali@example.com", "", "", "", "acme", models.RoleMember, time.Time{}, time.Time{}).
+				AddRow("u2", "alice", "alice@example.com", "", "", "", "acme", models.RoleMember, time.Time{}, time.Time{}))
+		users, err := repo.SearchInOrg(ctx, "acme", tt.query, 10)
+		if err != nil {
+			t.Fatalf("SearchInOrg(%q): %v", tt.query, err)
+		}
+		if len(users) != 2 || users[0].ID != "u1" || users[1].ID != "u2" {
+			t.Errorf("SearchInOrg(%q) = %+v, want the rows in order", tt.query, users)
+		}
+	}
+
+	// A blank query matches nobody without asking the database
+	if users, err := repo.SearchInOrg(ctx, "acme", "  ", 10); err != nil || len(users) != 0 {
+		t.Errorf("blank query: %v, %v; want no users", users, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetPageByOrgIDResumesAfterPosition(t *testing.T) {
+	repo, mock := newMockUserRepository(t)
+	at := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE org_id = $1 ORDER BY created_at DESC, id DESC LIMIT $2")).
+		WithArgs("acme", 2).WillReturnRows(sqlmock.NewRows(userColumns))
+	// Later pages continue below the last (created_at, id), so users added
+	// meanwhile, which sort first, shift nothing
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE org_id = $1 AND (created_at, id) < ($3, $4)")).
+		WithArgs("acme", 2, at, "u7").WillReturnRows(sqlmock.NewRows(userColumns))
+
+	for _, after := range []*cursor.Position{nil, {Time: at, ID: "u7"}} {
+		if _, err := repo.GetPageByOrgID(context.Background(), "acme", after, 2); err != nil {
+			t.Fatalf("GetPageByOrgID: %v", err)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go-realtime-workspace/models"
+)
+
+// Errors returned by CheckWindow once a message is too old to change.
+var (
+	ErrEditWindowClosed   = errors.New("this message can no longer be edited")
+	ErrDeleteWindowClosed = errors.New("this message can no longer be deleted")
+)
+
+// Actions checked by CheckWindow.
+const (
+	WindowEdit   = "edit"
+	WindowDelete = "delete"
+)
+
+// RoleLookup returns the organization roles of users, keyed by user ID.
+type RoleLookup interface {
+	Roles(ctx context.Context, orgID string, userIDs []string) (map[string]string, error)
+}
+
+// SetRoleLookup makes organization owners and admins exempt from edit and
+// delete windows. Without it the windows apply to everyone.
+func (r *MessageRepository) SetRoleLookup(roles RoleLookup) {
+	r.roles = roles
+}
+
+// Windows returns the edit and delete windows that apply to a group: its
+// own setting, else its organization's, else unlimited. An empty groupID
+// resolves the organization's setting. scope reports where they came from.
+func (r *MessageRepository) Windows(ctx context.Context, orgID, groupID string) (models.MessageWindows, string, error) {
+	if groupID != "" {
+		windows, ok, err := r.storedWindows(ctx, windowKey(orgID, groupID))
+		if err != nil || ok {
+			return windows, models.WindowScopeGroup, err
+		}
+	}
+	windows, ok, err := r.storedWindows(ctx, windowKey(orgID, ""))
+	if err != nil || ok {
+		return windows, models.WindowScopeOrg, err
+	}
+	return models.MessageWindows{}, models.WindowScopeDefault, nil
+}
+
+// storedWindows reads the windows stored under key, if any.
+func (r *MessageRepository) storedWindows(ctx context.Context, key string) (models.MessageWindows, bool, error) {
+	fields, err := r.client.HGetAll(ctx, key).Result()
+	if err != nil {
+		return models.MessageWindows{}, false, fmt.Errorf("error getting message windows: %w", err)
+	}
+	if len(fields) == 0 {
+		return models.MessageWindows{}, false, nil
+	}
+
+	var windows models.MessageWindows
+	windows.EditSeconds, _ = strconv.ParseInt(fields["edit"], 10, 64)
+	windows.DeleteSeconds, _ = strconv.ParseInt(fields["delete"], 10, 64)
+	return windows, true, nil
+}
+
+// SetWindows sets the edit and delete windows of a group, or of an
+// organization when groupID is empty. A group setting takes precedence
+// over its organization's.
+func (r *MessageRepository) SetWindows(ctx context.Context, orgID, groupID string, windows models.MessageWindows) error {
+	err := r.client.HSet(ctx, windowKey(orgID, groupID),
+		"edit", windows.EditSeconds,
+		"delete", windows.DeleteSeconds,
+	).Err()
+	if err != nil {
+		return fmt.Errorf("error setting message windows: %w", err)
+	}
+	return nil
+}
+
+// ClearWindows removes the windows of a group, or of an organization when
+// groupID is empty, so the next broader setting applies again.
+func (r *MessageRepository) ClearWindows(ctx context.Context, orgID, groupID string) error {
+	if err := r.client.Del(ctx, windowKey(orgID, groupID)).Err(); err != nil {
+		return fmt.Errorf("error clearing message windows: %w", err)
+	}
+	return nil
+}
+
+// CheckWindow reports whether clientID may still edit or delete (action) a
+// group message. It returns ErrEditWindowClosed or ErrDeleteWindowClosed
+// once the message is older than the group's window, and
+// ErrMessageNotFound if it is not stored. Owners and admins of the
+// organization are exempt when a role lookup is set.
+func (r *MessageRepository) CheckWindow(ctx context.Context, orgID, groupID, id, clientID, action string) error {
+	windows, _, err := r.Windows(ctx, orgID, groupID)
+	if err != nil {
+		return err
+	}
+
+	seconds, closed := windows.EditSeconds, ErrEditWindowClosed
+	if action == WindowDelete {
+		seconds, closed = windows.DeleteSeconds, ErrDeleteWindowClosed
+	}
+	if seconds <= 0 {
+		return nil
+	}
+
+	msg, err := r.getStored(ctx, orgID, groupID, id)
+	if err != nil {
+		return err
+	}
+	if msg.ClientID != clientID {
+		return nil // Not the author; Edit and SoftDelete refuse it
+	}
+	window := time.Duration(seconds) * time.Second
+	if r.clock.Now().Sub(msg.Timestamp) <= window {
+		return nil
+	}
+
+	if r.roles != nil {
+		roles, err := r.roles.Roles(ctx, orgID, []string{clientID})
+		if err != nil {
+			return err
+		}
+		if role := roles[clientID]; role == models.RoleOwner || role == models.RoleAdmin {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: the %s window of %v has passed", closed, action, window)
+}
+
+// windowKey returns the hash holding the edit and delete windows of a
+// group, or of an organization when groupID is empty.
+func windowKey(orgID, groupID string) string {
+	if groupID == "" {
+		return fmt.Sprintf("message_windows:%s", orgID)
+	}
+	return fmt.Sprintf("message_windows:%s:%s", orgID, groupID)
+}
@@ -3,9 +3,15 @@ package router
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
+	"go-realtime-workspace/auth"
+	"go-realtime-workspace/config"
+	"go-realtime-workspace/cursor"
 	"go-realtime-workspace/handlers"
 	"go-realtime-workspace/hub"
+	"go-realtime-workspace/metrics"
+	"go-realtime-workspace/middleware"
 	"go-realtime-workspace/repository"
 
 	"github.com/gorilla/mux"
@@ -13,12 +19,23 @@ import (
 
 // Config holds the dependencies needed for router setup.
 type Config struct {
-	OrgHub      *hub.OrgHub
-	UserRepo    *repository.UserRepository
-	TaskRepo    *repository.TaskRepository
-	MessageRepo *repository.MessageRepository
-	PgHealth    PgHealthChecker
-	RedisHealth RedisHealthChecker
+	AppConfig    *config.Config
+	OrgHub       *hub.OrgHub
+	UserRepo     *repository.UserRepository
+	TaskRepo     *repository.TaskRepository
+	InviteRepo   *repository.InviteRepository
+	FeatureRepo  *repository.FeatureRepository
+	ActivityRepo *repository.ActivityRepository
+	AuditRepo    *repository.AuditRepository
+	NotifyRepo   *repository.NotificationRepository
+	TemplateRepo *repository.TemplateRepository
+	PresenceRepo *repository.PresenceRepository
+	MessageRepo  *repository.MessageRepository
+	Tokens       *auth.Signer // Issues and verifies user access tokens (nil disables user authentication)
+	PgHealth     PgHealthChecker
+	RedisHealth  RedisHealthChecker
+	RateLimit    *middleware.RateLimitConfig // Per-IP API rate limit (nil disables it)
+	Security     *middleware.SecurityConfig  // Security headers on every response (nil disables them)
 }
 
 // PgHealthChecker defines the interface for PostgreSQL health checking.
@@ -34,66 +51,200 @@ type RedisHealthChecker interface {
 // Setup configures all routes and returns a configured router.
 func Setup(cfg *Config) *mux.Router {
 	router := mux.NewRouter()
+	if cfg.Security != nil {
+		router.Use(middleware.Security(*cfg.Security))
+	}
 
 	// Initialize handlers
-	wsHandler := handlers.NewWebSocketHandler(cfg.OrgHub, cfg.MessageRepo, cfg.UserRepo)
-	userHandler := handlers.NewUserHandler(cfg.UserRepo)
-	taskHandler := handlers.NewTaskHandler(cfg.TaskRepo)
-	messageHandler := handlers.NewMessageHandler(cfg.MessageRepo)
+	wsHandler := handlers.NewWebSocketHandler(cfg.OrgHub, cfg.MessageRepo, cfg.UserRepo, cfg.FeatureRepo, cfg.AppConfig.WebSocket)
+	wsHandler.DefaultOrgID = cfg.AppConfig.Server.DefaultOrgID
+	usernames := handlers.NewUsernameResolver(cfg.UserRepo, cfg.AppConfig.Message.UsernameFallback, cfg.AppConfig.Message.UsernameCacheTTL)
+	usernames.SetWriteLookups(cfg.AppConfig.Message.UsernameEnrichment == "write", cfg.AppConfig.Message.UsernameLookupsPerSecond)
+	wsHandler.Usernames = usernames
+	cursors := cursor.NewSigner(cfg.AppConfig.Server.CursorSecret)
+	userHandler := handlers.NewUserHandler(cfg.UserRepo, cfg.AppConfig.Server.DefaultOrgID)
+	userHandler.Cursors = cursors
+	taskHandler := handlers.NewTaskHandler(cfg.TaskRepo, cfg.UserRepo)
+	taskHandler.Cursors = cursors
+	messageHandler := handlers.NewMessageHandler(cfg.MessageRepo, cfg.UserRepo, cfg.FeatureRepo)
+	messageHandler.Usernames = usernames
+	messageHandler.Cursors = cursors
+	inviteHandler := handlers.NewInviteHandler(cfg.InviteRepo, cfg.UserRepo)
+	featureHandler := handlers.NewFeatureHandler(cfg.FeatureRepo)
+	quotaHandler := handlers.NewQuotaHandler(cfg.MessageRepo)
+	windowHandler := handlers.NewWindowHandler(cfg.MessageRepo)
+	activityHandler := handlers.NewActivityHandler(cfg.ActivityRepo)
+	notificationHandler := handlers.NewNotificationHandler(cfg.NotifyRepo)
+	templateHandler := handlers.NewTemplateHandler(cfg.TemplateRepo, cfg.UserRepo, cfg.OrgHub, cfg.FeatureRepo)
+	presenceHandler := handlers.NewPresenceHandler(cfg.PresenceRepo, cfg.UserRepo, cfg.OrgHub)
+	exportHandler := handlers.NewExportHandler(cfg.UserRepo, cfg.TaskRepo, cfg.MessageRepo, cfg.AuditRepo)
+	pollHandler := handlers.NewPollHandler(cfg.MessageRepo, cfg.UserRepo, cfg.OrgHub)
+	orgConfigHandler := handlers.NewOrgConfigHandler(cfg.UserRepo, cfg.FeatureRepo, cfg.MessageRepo)
+
+	// Admin-only routes are wrapped individually with adminOnly
+	adminOnly := middleware.AdminAuth(cfg.AppConfig.Server.AdminToken)
+
+	// Rate limit status is routed ahead of the API subrouter so checking
+	// the budget does not spend it
+	if cfg.RateLimit != nil {
+		router.HandleFunc(handlers.APIPrefix+"/ratelimit/status", middleware.RateLimitStatus(*cfg.RateLimit)).Methods("GET")
+	}
 
 	// API v1 routes
-	api := router.PathPrefix("/api/v1").Subrouter()
+	api := router.PathPrefix(handlers.APIPrefix).Subrouter()
+	if cfg.RateLimit != nil {
+		api.Use(middleware.RateLimit(*cfg.RateLimit))
+	}
+	if timeout := cfg.AppConfig.Server.HandlerTimeout; timeout > 0 {
+		api.Use(middleware.Timeout(timeout))
+	}
+
+	// Identify the admin or the user behind each request's bearer token
+	var tokens middleware.TokenVerifier
+	if cfg.Tokens != nil {
+		tokens = cfg.Tokens
+	}
+	api.Use(middleware.Identify(cfg.AppConfig.Server.AdminToken, tokens))
 
 	// Health check endpoint
-	api.HandleFunc("/health", healthCheckHandler(cfg.PgHealth, cfg.RedisHealth)).Methods("GET")
+	api.HandleFunc("/health", healthCheckHandler(cfg.PgHealth, cfg.RedisHealth, cfg.OrgHub)).Methods("GET")
+	api.Handle("/health/hub", adminOnly(hubStatsHandler(cfg.OrgHub))).Methods("GET")
+	api.Handle("/metrics", adminOnly(metricsHandler())).Methods("GET")
 
 	// Organization routes
 	api.HandleFunc("/orgs", wsHandler.CreateOrg).Methods("POST")
 	api.HandleFunc("/orgs", wsHandler.GetOrgs).Methods("GET")
+	api.HandleFunc("/orgs/{orgId}", wsHandler.GetOrg).Methods("GET")
 	api.HandleFunc("/orgs/{orgId}/groups", wsHandler.CreateGroup).Methods("POST")
 	api.HandleFunc("/orgs/{orgId}/groups", wsHandler.GetOrgGroups).Methods("GET")
+	api.HandleFunc("/orgs/{orgId}/groups/{groupId}", wsHandler.GetGroup).Methods("GET")
+	if wsHandler.DefaultOrgID != "" {
+		api.HandleFunc("/groups", wsHandler.CreateGroup).Methods("POST")
+	}
+	api.Handle("/orgs/{orgId}/groups/{groupId}/rate-limit", adminOnly(http.HandlerFunc(wsHandler.SetGroupRateLimit))).Methods("PUT")
+	api.Handle("/orgs/{orgId}/groups/{groupId}/state", adminOnly(http.HandlerFunc(wsHandler.SetGroupState))).Methods("PUT")
+	api.Handle("/orgs/{orgId}/groups/{groupId}/resync", adminOnly(http.HandlerFunc(wsHandler.ResyncGroup))).Methods("POST")
+	api.Handle("/admin/orgs/{orgId}/groups/{groupId}/debug", adminOnly(http.HandlerFunc(wsHandler.DebugGroup))).Methods("GET")
+	api.Handle("/admin/orgs/{orgId}/groups/{groupId}/flush", adminOnly(http.HandlerFunc(wsHandler.FlushGroup))).Methods("POST")
+	api.Handle("/admin/maintenance", adminOnly(http.HandlerFunc(wsHandler.GetMaintenance))).Methods("GET")
+	api.Handle("/admin/maintenance", adminOnly(http.HandlerFunc(wsHandler.SetMaintenance))).Methods("PUT")
+	api.Handle("/admin/config", adminOnly(configHandler(cfg.AppConfig))).Methods("GET")
+	if cfg.Tokens != nil {
+		authHandler := handlers.NewAuthHandler(cfg.Tokens, cfg.UserRepo, cfg.AppConfig.Server.AccessTokenTTL)
+		api.Handle("/admin/users/{id}/token", adminOnly(http.HandlerFunc(authHandler.IssueToken))).Methods("POST")
+	}
+	api.Handle("/orgs/{orgId}/activity", adminOnly(http.HandlerFunc(activityHandler.Timeline))).Methods("GET")
+	api.Handle("/orgs/{orgId}/features", adminOnly(http.HandlerFunc(featureHandler.Get))).Methods("GET")
+	api.Handle("/orgs/{orgId}/features/{feature}", adminOnly(http.HandlerFunc(featureHandler.Set))).Methods("PUT")
+	api.Handle("/orgs/{orgId}/config/export", adminOnly(http.HandlerFunc(orgConfigHandler.Export))).Methods("GET")
+	api.Handle("/orgs/{orgId}/config/import", adminOnly(http.HandlerFunc(orgConfigHandler.Import))).Methods("POST")
+	api.HandleFunc("/orgs/{orgId}/quota", quotaHandler.Get).Methods("GET")
+	api.Handle("/orgs/{orgId}/quota", adminOnly(http.HandlerFunc(quotaHandler.Set))).Methods("PUT")
+	api.Handle("/orgs/{orgId}/quota", adminOnly(http.HandlerFunc(quotaHandler.Clear))).Methods("DELETE")
+	api.HandleFunc("/orgs/{orgId}/message-windows", windowHandler.Get).Methods("GET")
+	api.Handle("/orgs/{orgId}/message-windows", adminOnly(http.HandlerFunc(windowHandler.Set))).Methods("PUT")
+	api.Handle("/orgs/{orgId}/message-windows", adminOnly(http.HandlerFunc(windowHandler.Clear))).Methods("DELETE")
+	api.HandleFunc("/orgs/{orgId}/groups/{groupId}/message-windows", windowHandler.Get).Methods("GET")
+	api.Handle("/orgs/{orgId}/groups/{groupId}/message-windows", adminOnly(http.HandlerFunc(windowHandler.Set))).Methods("PUT")
+	api.Handle("/orgs/{orgId}/groups/{groupId}/message-windows", adminOnly(http.HandlerFunc(windowHandler.Clear))).Methods("DELETE")
+	api.HandleFunc("/orgs/{orgId}/templates", templateHandler.List).Methods("GET")
+	api.HandleFunc("/orgs/{orgId}/templates", templateHandler.Create).Methods("POST")
+	api.HandleFunc("/orgs/{orgId}/templates/{key}", templateHandler.Get).Methods("GET")
+	api.HandleFunc("/orgs/{orgId}/templates/{key}", templateHandler.Update).Methods("PUT")
+	api.HandleFunc("/orgs/{orgId}/templates/{key}", templateHandler.Delete).Methods("DELETE")
+	api.HandleFunc("/orgs/{orgId}/messages/from-template", templateHandler.Send).Methods("POST")
 
 	// Broadcast routes
 	api.HandleFunc("/orgs/{orgId}/broadcast", wsHandler.BroadcastOrg).Methods("POST")
 	api.HandleFunc("/orgs/{orgId}/groups/{groupId}/broadcast", wsHandler.BroadcastGroup).Methods("POST")
 
 	// Message history routes
+	api.HandleFunc("/orgs/{orgId}/messages/search", messageHandler.SearchOrg).Methods("GET")
+	api.HandleFunc("/orgs/{orgId}/groups/{groupId}/pins", messageHandler.ListPins).Methods("GET")
 	api.HandleFunc("/orgs/{orgId}/groups/{groupId}/messages", messageHandler.GetHistory).Methods("GET")
 	api.HandleFunc("/orgs/{orgId}/groups/{groupId}/messages/after", messageHandler.GetHistoryAfter).Methods("GET")
 	api.HandleFunc("/orgs/{orgId}/groups/{groupId}/messages/between", messageHandler.GetHistoryBetween).Methods("GET")
 	api.HandleFunc("/orgs/{orgId}/groups/{groupId}/messages/count", messageHandler.GetCount).Methods("GET")
+	api.HandleFunc("/orgs/{orgId}/groups/{groupId}/messages/batch-get", messageHandler.BatchGet).Methods("POST")
+	api.Handle("/orgs/{orgId}/groups/{groupId}/messages/import", adminOnly(middleware.BodyLimit(cfg.AppConfig.Message.ImportMaxBytes)(http.HandlerFunc(messageHandler.Import)))).Methods("POST")
+	api.HandleFunc("/orgs/{orgId}/groups/{groupId}/messages/{messageId}", messageHandler.Edit).Methods("PUT")
+	api.HandleFunc("/orgs/{orgId}/groups/{groupId}/messages/{messageId}", wsHandler.DeleteMessage).Methods("DELETE")
+	api.HandleFunc("/orgs/{orgId}/groups/{groupId}/messages/{messageId}/restore", wsHandler.RestoreMessage).Methods("POST")
+	api.HandleFunc("/orgs/{orgId}/groups/{groupId}/messages/{messageId}/forward", wsHandler.ForwardMessage).Methods("POST")
+	api.HandleFunc("/orgs/{orgId}/groups/{groupId}/messages/{messageId}/acks", messageHandler.GetAcks).Methods("GET")
+	api.HandleFunc("/orgs/{orgId}/groups/{groupId}/messages/{messageId}/pin", messageHandler.Pin).Methods("PUT")
+	api.HandleFunc("/orgs/{orgId}/groups/{groupId}/messages/{messageId}/pin", messageHandler.Unpin).Methods("DELETE")
+	api.HandleFunc("/orgs/{orgId}/groups/{groupId}/messages/{messageId}/reactions", messageHandler.GetReactions).Methods("GET")
+	api.HandleFunc("/orgs/{orgId}/groups/{groupId}/messages/{messageId}/reactions", messageHandler.AddReaction).Methods("POST")
+	api.HandleFunc("/orgs/{orgId}/groups/{groupId}/messages/{messageId}/reactions/{emoji}", messageHandler.RemoveReaction).Methods("DELETE")
+
+	// Poll routes
+	api.HandleFunc("/orgs/{orgId}/groups/{groupId}/polls", pollHandler.Create).Methods("POST")
+	api.HandleFunc("/orgs/{orgId}/groups/{groupId}/polls/{pollId}", pollHandler.Get).Methods("GET")
+	api.HandleFunc("/orgs/{orgId}/groups/{groupId}/polls/{pollId}/vote", pollHandler.Vote).Methods("POST")
 
 	// User routes
 	api.HandleFunc("/users", userHandler.Create).Methods("POST")
 	api.HandleFunc("/users/{id}", userHandler.GetByID).Methods("GET")
-	api.HandleFunc("/users/{id}", userHandler.Update).Methods("PUT")
+	api.HandleFunc("/users/{id}", userHandler.Update).Methods("PUT", "PATCH")
 	api.HandleFunc("/users/{id}", userHandler.Delete).Methods("DELETE")
 	api.HandleFunc("/users/search", userHandler.GetByUsername).Methods("GET")
+	api.HandleFunc("/users/{userId}/starred", messageHandler.ListStarred).Methods("GET")
+	api.HandleFunc("/users/{userId}/starred", messageHandler.Star).Methods("POST")
+	api.HandleFunc("/users/{userId}/starred", messageHandler.Unstar).Methods("DELETE")
+	api.HandleFunc("/users/{userId}/mentions", messageHandler.ListMentions).Methods("GET")
+	api.HandleFunc("/users/{userId}/mentions/read", messageHandler.MarkMentionsRead).Methods("POST")
+	api.HandleFunc("/users/{userId}/read-all", wsHandler.MarkAllRead).Methods("POST")
+	api.HandleFunc("/users/{userId}/notification-prefs", notificationHandler.GetPrefs).Methods("GET")
+	api.HandleFunc("/users/{userId}/notification-prefs", notificationHandler.SetPrefs).Methods("PUT")
+	api.HandleFunc("/users/{userId}/heartbeat", presenceHandler.Heartbeat).Methods("POST")
+	api.HandleFunc("/users/{userId}/presence", presenceHandler.Get).Methods("GET")
+	api.HandleFunc("/orgs/{orgId}/groups/{groupId}/members", presenceHandler.Roster).Methods("GET")
+	api.HandleFunc("/users/{id}/export", exportHandler.ExportUser).Methods("GET")
+	api.Handle("/orgs/{orgId}/audit/export", adminOnly(http.HandlerFunc(exportHandler.ExportAudit))).Methods("GET")
 	api.HandleFunc("/orgs/{orgId}/users", userHandler.GetByOrg).Methods("GET")
+	api.HandleFunc("/orgs/{orgId}/users/search", userHandler.SearchInOrg).Methods("GET")
+	api.HandleFunc("/orgs/{orgId}/users/{userId}/role", userHandler.SetRole).Methods("PUT")
+
+	// Invite routes
+	api.HandleFunc("/orgs/{orgId}/invites", inviteHandler.Create).Methods("POST")
+	api.HandleFunc("/orgs/{orgId}/invites", inviteHandler.GetPending).Methods("GET")
+	api.HandleFunc("/invites/{token}/accept", inviteHandler.Accept).Methods("POST")
 
 	// Task routes
 	api.HandleFunc("/users/{userId}/tasks", taskHandler.Create).Methods("POST")
 	api.HandleFunc("/users/{userId}/tasks", taskHandler.GetByUser).Methods("GET")
 	api.HandleFunc("/users/{userId}/tasks/due-soon", taskHandler.GetDueSoon).Methods("GET")
+	api.HandleFunc("/users/{userId}/tasks/order", taskHandler.Reorder).Methods("PUT")
+	api.HandleFunc("/orgs/{orgId}/tasks", taskHandler.GetByOrg).Methods("GET")
 	api.HandleFunc("/tasks/{id}", taskHandler.GetByID).Methods("GET")
-	api.HandleFunc("/tasks/{id}", taskHandler.Update).Methods("PUT")
+	api.HandleFunc("/tasks/{id}", taskHandler.Update).Methods("PUT", "PATCH")
 	api.HandleFunc("/tasks/{id}", taskHandler.Delete).Methods("DELETE")
 
 	// Direct Messaging routes
 	api.HandleFunc("/dm/{userId}/{recipientId}", wsHandler.SendDM).Methods("POST")
 	api.HandleFunc("/dm/{userId}/{recipientId}/history", wsHandler.GetDMHistory).Methods("GET")
+	api.HandleFunc("/dm/{userId}/{recipientId}/read", wsHandler.MarkDMRead).Methods("POST")
+	api.HandleFunc("/dm/{userId}/conversations", wsHandler.GetDMConversations).Methods("GET")
 	api.HandleFunc("/dm/connected-users", wsHandler.GetConnectedUsers).Methods("GET")
 
 	// WebSocket routes
 	router.HandleFunc("/ws/orgs/{orgId}/groups/{groupId}", wsHandler.JoinGroup)
+	router.HandleFunc("/ws/orgs/{orgId}/presence", wsHandler.ConnectPresence)
 	router.HandleFunc("/ws/dm/{userId}", wsHandler.ConnectDM)
 
 	return router
 }
 
 // healthCheckHandler creates a handler for health check endpoints.
-func healthCheckHandler(pgHealth PgHealthChecker, redisHealth RedisHealthChecker) http.HandlerFunc {
+func healthCheckHandler(pgHealth PgHealthChecker, redisHealth RedisHealthChecker, orgHub *hub.OrgHub) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		// Report not ready during maintenance so load balancers stop routing new traffic
+		if orgHub.InMaintenance() {
+			http.Error(w, "Maintenance mode", http.StatusServiceUnavailable)
+			return
+		}
+
 		// Check PostgreSQL
 		if err := pgHealth.HealthCheck(); err != nil {
 			http.Error(w, "PostgreSQL unhealthy", http.StatusServiceUnavailable)
@@ -110,3 +261,28 @@ func healthCheckHandler(pgHealth PgHealthChecker, redisHealth RedisHealthChecker
 		w.Write([]byte("OK"))
 	}
 }
+
+// hubStatsHandler creates a handler that reports live hub load.
+func hubStatsHandler(orgHub *hub.OrgHub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(orgHub.Stats())
+	}
+}
+
+// configHandler creates a handler that reports the active configuration
+// with secrets redacted.
+func configHandler(appConfig *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(appConfig.Redacted())
+	}
+}
+
+// metricsHandler creates a handler that reports all registered counters.
+func metricsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(metrics.Snapshot())
+	}
+}
@@ -0,0 +1,69 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-realtime-workspace/config"
+	"go-realtime-workspace/hub"
+	"go-realtime-workspace/models"
+	"go-realtime-workspace/repository"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+)
+
+func TestCreatedResourcesHaveResolvableLocations(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+	cfg := config.DefaultConfig()
+	router := Setup(&Config{
+		AppConfig: cfg,
+		OrgHub:    hub.NewOrgHub(cfg.WebSocket, cfg.Message),
+		UserRepo:  repository.NewUserRepository(db, cfg.User),
+		TaskRepo:  repository.NewTaskRepository(db),
+	})
+
+	now := time.Now()
+	mock.ExpectQuery("INSERT INTO users").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "email", "full_name", "avatar_url", "bio", "org_id", "role", "created_at", "updated_at"}).
+			AddRow("user-1", "bob", "bob@acme.com", "", "", "", "acme", models.RoleMember, now, now))
+	mock.ExpectQuery("INSERT INTO tasks").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "title", "description", "status", "priority", "due_date", "position", "created_at", "updated_at", "completed_at"}).
+			AddRow("task-1", "user-1", "Ship it", "", models.TaskStatusPending, "medium", nil, 1.0, now, now, nil))
+
+	tests := []struct {
+		name, path, body, want string
+	}{
+		{"org", "/api/v1/orgs", `{"id": "acme", "name": "Acme"}`, "/api/v1/orgs/acme"},
+		{"group", "/api/v1/orgs/acme/groups", `{"id": "general", "name": "General"}`, "/api/v1/orgs/acme/groups/general"},
+		{"user", "/api/v1/users", `{"username": "bob", "email": "bob@acme.com", "org_id": "acme"}`, "/api/v1/users/user-1"},
+		{"task", "/api/v1/users/user-1/tasks", `{"title": "Ship it"}`, "/api/v1/tasks/task-1"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body)))
+		if rec.Code != http.StatusCreated {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, rec.Code, http.StatusCreated, rec.Body)
+			continue
+		}
+		location := rec.Header().Get("Location")
+		if location != tt.want {
+			t.Errorf("%s: Location %q, want %q", tt.name, location, tt.want)
+			continue
+		}
+		var match mux.RouteMatch
+		if !router.Match(httptest.NewRequest(http.MethodGet, location, nil), &match) || match.MatchErr != nil {
+			t.Errorf("%s: no GET route serves %s", tt.name, location)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,109 @@
+// Package sanitize neutralizes HTML in user-supplied message content for
+// clients that render message content as markup.
+package sanitize
+
+import (
+	"bytes"
+	"encoding/json"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// Mode selects how content is sanitized.
+type Mode string
+
+// Supported sanitization modes.
+const (
+	Off    Mode = "off"    // Content is stored and delivered verbatim
+	Escape Mode = "escape" // HTML special characters are escaped
+	Strip  Mode = "strip"  // Script/style blocks and tags are removed
+)
+
+var (
+	scriptBlocks = regexp.MustCompile(`(?is)<script\b.*?</script\s*>|<style\b.*?</style\s*>`)
+	tags         = regexp.MustCompile(`(?s)<[^>]*>`)
+	angles       = strings.NewReplacer("<", "&lt;", ">", "&gt;")
+)
+
+// Apply returns content sanitized according to m. In Strip mode any angle
+// brackets left over after removing tags are escaped, so an unterminated tag
+// cannot survive. An unknown mode leaves content unchanged.
+func (m Mode) Apply(content string) string {
+	switch m {
+	case Escape:
+		return html.EscapeString(content)
+	case Strip:
+		content = scriptBlocks.ReplaceAllString(content, "")
+		content = tags.ReplaceAllString(content, "")
+		return angles.Replace(content)
+	default:
+		return content
+	}
+}
+
+// Unapply returns content that Apply turns back into sanitized, so content
+// that was already sanitized in mode m can be handled like new input without
+// being sanitized twice. Strip mode's output is left alone by Apply, so only
+// Escape mode needs undoing.
+func (m Mode) Unapply(sanitized string) string {
+	if m == Escape {
+		return html.UnescapeString(sanitized)
+	}
+	return sanitized
+}
+
+// ApplyContent sanitizes message content like Apply or, for structured
+// content, every string in its JSON so the JSON itself stays intact.
+// Structured content that is not valid JSON is sanitized as text.
+func (m Mode) ApplyContent(content string, structured bool) string {
+	if !structured || (m != Escape && m != Strip) {
+		return m.Apply(content)
+	}
+	return mapJSONStrings(content, m.Apply)
+}
+
+// UnapplyContent undoes ApplyContent the way Unapply undoes Apply.
+func (m Mode) UnapplyContent(sanitized string, structured bool) string {
+	if !structured || m != Escape {
+		return m.Unapply(sanitized)
+	}
+	return mapJSONStrings(sanitized, m.Unapply)
+}
+
+// mapJSONStrings applies f to every string value in a JSON document,
+// leaving object keys alone. A document that does not parse is passed to f
+// whole.
+func mapJSONStrings(content string, f func(string) string) string {
+	dec := json.NewDecoder(strings.NewReader(content))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return f(content)
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(mapStrings(doc, f)); err != nil {
+		return f(content)
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// mapStrings applies f to the strings of a decoded JSON value.
+func mapStrings(v interface{}, f func(string) string) interface{} {
+	switch v := v.(type) {
+	case string:
+		return f(v)
+	case []interface{}:
+		for i := range v {
+			v[i] = mapStrings(v[i], f)
+		}
+	case map[string]interface{}:
+		for key := range v {
+			v[key] = mapStrings(v[key], f)
+		}
+	}
+	return v
+}
@@ -0,0 +1,51 @@
+package sanitize
+
+import "testing"
+
+func TestApply(t *testing.T) {
+	const payload = `hi <script>alert("x")</script><b onclick="steal()">bold</b> 1 < 2`
+	tests := []struct {
+		mode Mode
+		want string
+	}{
+		{Off, payload},
+		{Escape, `hi &lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt;&lt;b onclick=&#34;steal()&#34;&gt;bold&lt;/b&gt; 1 &lt; 2`},
+		{Strip, `hi bold 1 &lt; 2`},
+		{Mode("unknown"), payload},
+	}
+	for _, tt := range tests {
+		if got := tt.mode.Apply(payload); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestStripUnterminatedTag(t *testing.T) {
+	if got := Strip.Apply(`<img src=x onerror=alert(1)`); got != `&lt;img src=x onerror=alert(1)` {
+		t.Errorf("got %q, want the tag escaped", got)
+	}
+}
+
+func TestApplyContentStructured(t *testing.T) {
+	content := `{"label":"<script>x</script>Office","lat":52.5}`
+	if got, want := Escape.ApplyContent(content, true), `{"label":"&lt;script&gt;x&lt;/script&gt;Office","lat":52.5}`; got != want {
+		t.Errorf("escape: got %s, want %s", got, want)
+	}
+	if got, want := Strip.ApplyContent(content, true), `{"label":"Office","lat":52.5}`; got != want {
+		t.Errorf("strip: got %s, want %s", got, want)
+	}
+	if got := Escape.ApplyContent("not json <b>", true); got != "not json &lt;b&gt;" {
+		t.Errorf("invalid JSON: got %q, want it sanitized as text", got)
+	}
+}
+
+func TestUnapply(t *testing.T) {
+	for _, content := range []string{`<script>alert("x")</script>`, `{"label":"<b>x</b>"}`} {
+		for _, structured := range []bool{false, true} {
+			sanitized := Escape.ApplyContent(content, structured)
+			if again := Escape.ApplyContent(Escape.UnapplyContent(sanitized, structured), structured); again != sanitized {
+				t.Errorf("%q: sanitizing twice gave %q, want %q", content, again, sanitized)
+			}
+		}
+	}
+}
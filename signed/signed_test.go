@@ -0,0 +1,44 @@
+package signed
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type value struct {
+	Name string `json:"n"`
+}
+
+func TestRoundTrip(t *testing.T) {
+	key := []byte("secret")
+	var got value
+	if err := Decode(key, Encode(key, value{Name: "alice"}), &got); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if got.Name != "alice" {
+		t.Errorf("got %q, want alice", got.Name)
+	}
+}
+
+func TestDecodeRejectsOtherTokens(t *testing.T) {
+	key := []byte("secret")
+	token := Encode(key, value{Name: "alice"})
+	body, sig, _ := strings.Cut(token, ".")
+	forged := base64.RawURLEncoding.EncodeToString([]byte(`{"n":"mallory"}`))
+	unparsable := base64.RawURLEncoding.EncodeToString([]byte("not json"))
+
+	for name, token := range map[string]string{
+		"no signature":     body,
+		"forged body":      forged + "." + sig,
+		"bad signature":    body + ".!!",
+		"another key":      Encode([]byte("other"), value{Name: "alice"}),
+		"body is not JSON": unparsable + "." + base64.RawURLEncoding.EncodeToString(sign(key, unparsable)),
+	} {
+		var got value
+		if err := Decode(key, token, &got); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: got %v, want %v", name, err, ErrInvalid)
+		}
+	}
+}